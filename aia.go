@@ -0,0 +1,242 @@
+package sigtool
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultAIATimeout bounds each Authority Information Access download
+	DefaultAIATimeout = 10 * time.Second
+	// maxAIAResponseSize bounds the size of a downloaded issuer certificate
+	maxAIAResponseSize = 1 << 20
+	// defaultAIAMaxDepth bounds how many issuers are chased per verification
+	defaultAIAMaxDepth = 5
+)
+
+// AIAFetcher downloads intermediate certificates that a signature omits,
+// following the CA Issuers URLs of the Authority Information Access
+// extension. Downloaded certificates are cached by URL, so a fetcher can be
+// shared across verifications; it is safe for concurrent use.
+type AIAFetcher struct {
+	// Client performs the downloads. When nil, a client with Timeout is used.
+	Client *http.Client
+	// Timeout bounds each download when Client is nil. Zero means
+	// DefaultAIATimeout.
+	Timeout time.Duration
+	// Offline disables network access; only cached certificates are used
+	Offline bool
+	// MaxDepth bounds how many issuers are chased per verification. Zero
+	// means 5.
+	MaxDepth int
+
+	mu    sync.Mutex
+	cache map[string][]*x509.Certificate
+}
+
+// NewAIAFetcher returns an AIAFetcher that bounds each download by timeout.
+//
+// Parameters:
+//   - timeout: The per-download timeout, or 0 for DefaultAIATimeout
+//
+// Returns:
+//   - *AIAFetcher: A fetcher with an empty cache
+//
+// Example usage:
+//
+//	fetcher := sigtool.NewAIAFetcher(5 * time.Second)
+//	err := sigtool.Verify("signed.exe", &sigtool.VerifyOptions{
+//	    UseSystemRoots: true,
+//	    AIAFetcher:     fetcher,
+//	})
+func NewAIAFetcher(timeout time.Duration) *AIAFetcher {
+	return &AIAFetcher{Timeout: timeout}
+}
+
+// FetchIssuers downloads the issuers of every certificate in certs whose
+// issuer is not itself in certs, repeating for the downloaded certificates
+// until the chain reaches a self-signed certificate or MaxDepth downloads.
+//
+// Parameters:
+//   - certs: The certificates available so far, typically the signer and the
+//     certificates embedded in the signature
+//
+// Returns:
+//   - []*x509.Certificate: The downloaded certificates
+//   - error: The first download failure, if any; certificates downloaded
+//     before the failure are still returned
+func (f *AIAFetcher) FetchIssuers(certs []*x509.Certificate) ([]*x509.Certificate, error) {
+	return f.FetchIssuersContext(context.Background(), certs)
+}
+
+// FetchIssuersContext is FetchIssuers with support for cancellation and
+// deadlines: ctx bounds every download, so a slow AIA host cannot outlive
+// it.
+//
+// Parameters:
+//   - ctx: The context controlling cancellation
+//   - certs: The certificates available so far
+//
+// Returns:
+//   - []*x509.Certificate: The downloaded certificates
+//   - error: The first download failure, if any
+func (f *AIAFetcher) FetchIssuersContext(ctx context.Context, certs []*x509.Certificate) ([]*x509.Certificate, error) {
+	maxDepth := f.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = defaultAIAMaxDepth
+	}
+
+	known := append([]*x509.Certificate(nil), certs...)
+	var fetched []*x509.Certificate
+	var firstErr error
+	for depth := 0; depth < maxDepth; depth++ {
+		missing := missingIssuers(known)
+		if len(missing) == 0 {
+			break
+		}
+		progress := false
+		for _, cert := range missing {
+			issuer, err := f.fetchIssuer(ctx, cert)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			if issuer == nil {
+				continue
+			}
+			known = append(known, issuer)
+			fetched = append(fetched, issuer)
+			progress = true
+		}
+		if !progress {
+			break
+		}
+	}
+	return fetched, firstErr
+}
+
+// missingIssuers returns the certificates of certs that are not self-signed
+// and whose issuer is not in certs
+func missingIssuers(certs []*x509.Certificate) []*x509.Certificate {
+	var missing []*x509.Certificate
+	for _, cert := range certs {
+		if bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+			continue
+		}
+		found := false
+		for _, candidate := range certs {
+			if bytes.Equal(cert.RawIssuer, candidate.RawSubject) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, cert)
+		}
+	}
+	return missing
+}
+
+// fetchIssuer returns the first issuer of cert that its AIA URLs yield, or
+// nil when it names no usable URL or the fetcher is offline without a cached
+// copy
+func (f *AIAFetcher) fetchIssuer(ctx context.Context, cert *x509.Certificate) (*x509.Certificate, error) {
+	var lastErr error
+	for _, url := range cert.IssuingCertificateURL {
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			continue
+		}
+		candidates, err := f.fetch(ctx, url)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, issuer := range candidates {
+			if cert.CheckSignatureFrom(issuer) == nil {
+				return issuer, nil
+			}
+		}
+	}
+	return nil, lastErr
+}
+
+// fetch returns the certificates at url from the cache or the network
+func (f *AIAFetcher) fetch(ctx context.Context, url string) ([]*x509.Certificate, error) {
+	f.mu.Lock()
+	cached, ok := f.cache[url]
+	f.mu.Unlock()
+	if ok {
+		return cached, nil
+	}
+	if f.Offline {
+		return nil, nil
+	}
+
+	client := f.Client
+	if client == nil {
+		timeout := f.Timeout
+		if timeout <= 0 {
+			timeout = DefaultAIATimeout
+		}
+		client = &http.Client{Timeout: timeout}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AIA URL %q: %w", url, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download issuer certificate from %q: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download issuer certificate from %q: %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxAIAResponseSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download issuer certificate from %q: %w", url, err)
+	}
+	if len(body) > maxAIAResponseSize {
+		return nil, fmt.Errorf("issuer certificate from %q exceeds %d bytes", url, maxAIAResponseSize)
+	}
+
+	certs, err := parseIssuerCertificates(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse issuer certificate from %q: %w", url, err)
+	}
+
+	f.mu.Lock()
+	if f.cache == nil {
+		f.cache = make(map[string][]*x509.Certificate)
+	}
+	f.cache[url] = certs
+	f.mu.Unlock()
+	return certs, nil
+}
+
+// parseIssuerCertificates decodes a DER certificate or a certs-only PKCS#7
+// bundle, the two formats CA Issuers URLs serve
+func parseIssuerCertificates(der []byte) ([]*x509.Certificate, error) {
+	if cert, err := x509.ParseCertificate(der); err == nil {
+		return []*x509.Certificate{cert}, nil
+	}
+	p7, err := parsePKCS7(der)
+	if err != nil {
+		return nil, errors.New("not a DER certificate or PKCS#7 bundle")
+	}
+	if len(p7.Certificates) == 0 {
+		return nil, errors.New("PKCS#7 bundle holds no certificates")
+	}
+	return p7.Certificates, nil
+}
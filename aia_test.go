@@ -0,0 +1,135 @@
+package sigtool
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// aiaChainForTest returns a root pool and a PE signed by a leaf whose
+// intermediate is only available from server
+func aiaChainForTest(t *testing.T, handler func(intermediate []byte) http.HandlerFunc) (*x509.CertPool, string, *httptest.Server) {
+	t.Helper()
+
+	root := issueCertificateForTest(t, testCATemplate("aia root", 1), nil)
+	intermediate := issueCertificateForTest(t, testCATemplate("aia intermediate", 2), root)
+	server := httptest.NewServer(handler(intermediate.Cert.Raw))
+	t.Cleanup(server.Close)
+
+	template := testLeafTemplate("aia signer", 3, x509.ExtKeyUsageCodeSigning)
+	template.IssuingCertificateURL = []string{"ldap://ignored.example", server.URL + "/intermediate.crt"}
+	leaf := issueCertificateForTest(t, template, intermediate)
+	leaf.Chain = nil
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Cert)
+	return roots, createSignedMockPEAs(t, leaf, crypto.SHA256), server
+}
+
+func serveCertificate(requests *int32) func([]byte) http.HandlerFunc {
+	return func(der []byte) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(requests, 1)
+			w.Header().Set("Content-Type", "application/pkix-cert")
+			_, _ = w.Write(der)
+		}
+	}
+}
+
+func TestVerify_AIAFetchesMissingIntermediate(t *testing.T) {
+	var requests int32
+	roots, filePath, _ := aiaChainForTest(t, serveCertificate(&requests))
+
+	if err := Verify(filePath, &VerifyOptions{Roots: roots}); !errors.Is(err, ErrChainVerification) {
+		t.Fatalf("Expected chain failure without AIA, got: %v", err)
+	}
+
+	fetcher := NewAIAFetcher(time.Second)
+	if err := Verify(filePath, &VerifyOptions{Roots: roots, AIAFetcher: fetcher}); err != nil {
+		t.Fatalf("Expected chain to verify with AIA, got: %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{Roots: roots, AIAFetcher: fetcher}); err != nil {
+		t.Fatalf("Expected cached chain to verify, got: %v", err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("Expected 1 download thanks to the cache, got %d", got)
+	}
+}
+
+func TestVerify_AIAOffline(t *testing.T) {
+	var requests int32
+	roots, filePath, _ := aiaChainForTest(t, serveCertificate(&requests))
+
+	fetcher := &AIAFetcher{Offline: true}
+	if err := Verify(filePath, &VerifyOptions{Roots: roots, AIAFetcher: fetcher}); !errors.Is(err, ErrChainVerification) {
+		t.Errorf("Expected chain failure while offline, got: %v", err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 0 {
+		t.Errorf("Expected no downloads while offline, got %d", got)
+	}
+}
+
+func TestVerify_AIATimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	roots, filePath, _ := aiaChainForTest(t, func([]byte) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}
+	})
+
+	err := Verify(filePath, &VerifyOptions{Roots: roots, AIAFetcher: NewAIAFetcher(50 * time.Millisecond)})
+	if !errors.Is(err, ErrChainVerification) || !strings.Contains(err.Error(), "AIA fetch") {
+		t.Errorf("Expected chain failure reporting the AIA timeout, got: %v", err)
+	}
+}
+
+func TestVerifyContext_AIACancelled(t *testing.T) {
+	roots, filePath, _ := aiaChainForTest(t, func([]byte) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(10 * time.Second):
+			}
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := VerifyContext(ctx, filePath, VerifyOptions{Roots: roots, AIAFetcher: NewAIAFetcher(time.Minute)})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline to abort the AIA download, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the AIA download to stop at the deadline, took %v", elapsed)
+	}
+}
+
+func TestAIAFetcher_HTTPError(t *testing.T) {
+	_, _, server := aiaChainForTest(t, func([]byte) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			http.NotFound(w, r)
+		}
+	})
+
+	template := testLeafTemplate("orphan", 9)
+	template.IssuingCertificateURL = []string{server.URL + "/missing.crt"}
+	parent := issueCertificateForTest(t, testCATemplate("unknown issuer", 8), nil)
+	orphan := issueCertificateForTest(t, template, parent)
+
+	fetched, err := NewAIAFetcher(time.Second).FetchIssuers([]*x509.Certificate{orphan.Cert})
+	if len(fetched) != 0 || err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected a 404 download error, got %d certificates and: %v", len(fetched), err)
+	}
+}
@@ -0,0 +1,127 @@
+package sigtool
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.mozilla.org/pkcs7"
+)
+
+// DigestAlgorithmReport summarizes the Authenticode file digest algorithms
+// used across the primary and nested signatures of a PE file.
+type DigestAlgorithmReport struct {
+	// Signatures holds the digest algorithm of each signature, the primary
+	// signature first followed by nested signatures
+	Signatures []crypto.Hash
+	// Algorithms holds the distinct digest algorithms in first-seen order
+	Algorithms []crypto.Hash
+}
+
+// DualSigned reports whether the file carries more than one signature.
+func (r *DigestAlgorithmReport) DualSigned() bool {
+	return len(r.Signatures) > 1
+}
+
+// SHA1Only reports whether every signature relies on SHA-1.
+func (r *DigestAlgorithmReport) SHA1Only() bool {
+	return len(r.Algorithms) == 1 && r.Algorithms[0] == crypto.SHA1
+}
+
+// String renders the report, e.g. "SHA-1 + SHA-256 dual-signed".
+func (r *DigestAlgorithmReport) String() string {
+	names := make([]string, 0, len(r.Signatures))
+	for _, h := range r.Signatures {
+		names = append(names, h.String())
+	}
+	s := strings.Join(names, " + ")
+	if r.DualSigned() {
+		s += " dual-signed"
+	}
+	return s
+}
+
+// ReportDigestAlgorithms lists the Authenticode digest algorithm of every
+// signature in a PE file without verifying them.
+//
+// This lets compliance tooling flag binaries that still rely on SHA-1 only,
+// as opposed to dual-signed binaries that also carry a SHA-256 signature.
+//
+// Parameters:
+//   - filePath: The path to the signed PE file
+//
+// Returns:
+//   - *DigestAlgorithmReport: The digest algorithms per signature
+//   - error: An error if a signature cannot be extracted or parsed
+//
+// Example usage:
+//
+//	report, err := sigtool.ReportDigestAlgorithms("signed.exe")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	if report.SHA1Only() {
+//	    fmt.Printf("SHA-1 only: %s\n", report)
+//	}
+func ReportDigestAlgorithms(filePath string) (*DigestAlgorithmReport, error) {
+	if strings.TrimSpace(filePath) == "" {
+		return nil, errors.New("file path cannot be empty")
+	}
+
+	// #nosec G304 - This tool is designed to read user-specified PE files
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %q: %w", filePath, err)
+	}
+	defer f.Close()
+
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	layout, err := readLayout(f, fileInfo.Size())
+	if err != nil {
+		return nil, err
+	}
+	raw, err := readSignature(f, layout)
+	if err != nil {
+		return nil, err
+	}
+
+	primary, err := parsePKCS7(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS#7 signature: %w", err)
+	}
+	signatures := []*pkcs7.PKCS7{primary}
+
+	nested, err := nestedSignatures(primary)
+	if err != nil {
+		return nil, err
+	}
+	for _, der := range nested {
+		p7, err := parsePKCS7(der)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse nested PKCS#7 signature: %w", err)
+		}
+		signatures = append(signatures, p7)
+	}
+
+	report := &DigestAlgorithmReport{}
+	seen := make(map[crypto.Hash]bool)
+	for _, p7 := range signatures {
+		algorithm, _, err := storedDigest(p7)
+		if err != nil {
+			return nil, err
+		}
+		report.Signatures = append(report.Signatures, algorithm)
+		if !seen[algorithm] {
+			seen[algorithm] = true
+			report.Algorithms = append(report.Algorithms, algorithm)
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,50 @@
+package sigtool
+
+import (
+	"crypto"
+	"strings"
+	"testing"
+)
+
+func TestReportDigestAlgorithms_DualSigned(t *testing.T) {
+	report, err := ReportDigestAlgorithms(createDualSignedMockPE(t, nil))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if len(report.Signatures) != 2 || report.Signatures[0] != crypto.SHA1 || report.Signatures[1] != crypto.SHA256 {
+		t.Errorf("Expected SHA-1 then SHA-256 signatures, got %v", report.Signatures)
+	}
+	if !report.DualSigned() || report.SHA1Only() {
+		t.Errorf("Expected dual-signed report, got DualSigned=%v SHA1Only=%v", report.DualSigned(), report.SHA1Only())
+	}
+	if got := report.String(); got != "SHA-1 + SHA-256 dual-signed" {
+		t.Errorf("Expected 'SHA-1 + SHA-256 dual-signed', got %q", got)
+	}
+}
+
+func TestReportDigestAlgorithms_SHA1Only(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA1)
+	report, err := ReportDigestAlgorithms(filePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if !report.SHA1Only() || report.DualSigned() {
+		t.Errorf("Expected SHA-1 only report, got %v", report.Signatures)
+	}
+	if got := report.String(); got != "SHA-1" {
+		t.Errorf("Expected 'SHA-1', got %q", got)
+	}
+}
+
+func TestReportDigestAlgorithms_Errors(t *testing.T) {
+	if _, err := ReportDigestAlgorithms(""); err == nil || !strings.Contains(err.Error(), "cannot be empty") {
+		t.Errorf("Expected 'cannot be empty' error, got: %v", err)
+	}
+
+	_, err := ReportDigestAlgorithms(createMockPEFile(t, false, nil))
+	if err == nil || !strings.Contains(err.Error(), "not digitally signed") {
+		t.Errorf("Expected 'not digitally signed' error, got: %v", err)
+	}
+}
@@ -0,0 +1,714 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/dsa" // #nosec G505 - APK Signature Scheme v2 defines DSA signatures
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// The APK Signing Block sits between the ZIP entries and the central
+// directory of an APK, ending with its size and this magic
+const (
+	apkSigningBlockMagic = "APK Sig Block 42"
+	// apkSigningBlockFooterSize is the size of the trailing block size and
+	// magic
+	apkSigningBlockFooterSize = 24
+	// IDs of the blocks of the signature schemes in the signing block
+	apkSchemeV2BlockID = 0x7109871a
+	apkSchemeV3BlockID = 0xf05368c0
+	// apkProofOfRotationID is the v3 signed attribute holding the signing
+	// certificate lineage
+	apkProofOfRotationID = 0x3ba06f8c
+	// apkStrippingProtectionID is the v2 signed attribute naming a newer
+	// scheme the APK is also signed with, so removing it is detected
+	apkStrippingProtectionID = 0xbeeff00d
+	// apkChunkSize is the size of the chunks the content digests are
+	// computed over
+	apkChunkSize = 1 << 20
+)
+
+// apkSignatureAlgorithm is an APK signature algorithm
+type apkSignatureAlgorithm struct {
+	name string
+	hash crypto.Hash
+	key  x509.PublicKeyAlgorithm
+	pss  bool
+}
+
+// apkSignatureAlgorithms are the signature algorithms sigtool verifies by
+// ID. The verity algorithms, whose content digest is a Merkle tree root
+// for fs-verity, are not supported; APKs signed with them also carry one
+// of these.
+var apkSignatureAlgorithms = map[uint32]apkSignatureAlgorithm{
+	0x0101: {"RSASSA-PSS-SHA256", crypto.SHA256, x509.RSA, true},
+	0x0102: {"RSASSA-PSS-SHA512", crypto.SHA512, x509.RSA, true},
+	0x0103: {"RSASSA-PKCS1-v1_5-SHA256", crypto.SHA256, x509.RSA, false},
+	0x0104: {"RSASSA-PKCS1-v1_5-SHA512", crypto.SHA512, x509.RSA, false},
+	0x0201: {"ECDSA-SHA256", crypto.SHA256, x509.ECDSA, false},
+	0x0202: {"ECDSA-SHA512", crypto.SHA512, x509.ECDSA, false},
+	0x0301: {"DSA-SHA256", crypto.SHA256, x509.DSA, false},
+}
+
+// apkAlgorithmName returns the name of the APK signature algorithm id
+func apkAlgorithmName(id uint32) string {
+	if a, ok := apkSignatureAlgorithms[id]; ok {
+		return a.name
+	}
+	return fmt.Sprintf("0x%04x", id)
+}
+
+// APKSigner is a signer of an APK Signature Scheme v2 or v3 block, as
+// reported by InspectAPKSignatures.
+type APKSigner struct {
+	// Scheme is the APK Signature Scheme version, 2 or 3
+	Scheme int
+	// MinSDK and MaxSDK are the Android API levels a v3 signer applies to,
+	// both zero for v2
+	MinSDK, MaxSDK uint32 `json:",omitempty"`
+	// Algorithms names the signature algorithms of the signer, such as
+	// "RSASSA-PKCS1-v1_5-SHA256"
+	Algorithms []string
+	// Signer is the signing certificate, which Android identifies the app
+	// developer by
+	Signer *CertificateInfo
+	// Certificates lists every certificate of the signer, the signing
+	// certificate first
+	Certificates []CertificateInfo
+	// Lineage is the proof-of-rotation of a v3 signer whose signing key was
+	// rotated: the signing certificates from the original to the current
+	// one, each signed by its predecessor
+	Lineage []APKLineageNode `json:",omitempty"`
+}
+
+// APKLineageNode is a signing certificate in the rotation lineage of an
+// APK v3 signer.
+type APKLineageNode struct {
+	// Certificate is the signing certificate
+	Certificate *CertificateInfo
+	// Flags are the capabilities the app grants the certificate: 1 installed
+	// data, 2 shared user ID, 4 permission, 8 rollback and 16 authentication
+	Flags uint32
+}
+
+// apkSigningBlock is the APK Signing Block of an APK
+type apkSigningBlock struct {
+	// offset is the offset of the block in the file
+	offset int64
+	raw    []byte
+	// blocks are the values of the block by ID
+	blocks map[uint32][]byte
+}
+
+// apkSignerBlock is a parsed signer of a v2 or v3 scheme block
+type apkSignerBlock struct {
+	scheme     int
+	signedData []byte
+	// digests are the content digests by signature algorithm
+	digests        map[uint32][]byte
+	digestOrder    []uint32
+	certificates   []*x509.Certificate
+	minSDK, maxSDK uint32
+	attributes     map[uint32][]byte
+	signatures     []apkSignatureValue
+	publicKey      []byte
+	lineage        []apkLineageLevel
+}
+
+// apkSignatureValue is a signature of a signer over its signed data
+type apkSignatureValue struct {
+	algorithm uint32
+	signature []byte
+}
+
+// apkLineageLevel is a level of a proof-of-rotation structure: a signing
+// certificate and the signature of the previous one over it
+type apkLineageLevel struct {
+	certificate *x509.Certificate
+	flags       uint32
+	// signedData is the certificate and signedAlgorithm, signed with
+	// signedAlgorithm by the certificate of the previous level
+	signedData      []byte
+	signedAlgorithm uint32
+	signature       []byte
+	// algorithm is the algorithm the certificate signs the next level with
+	algorithm uint32
+}
+
+// apkReader reads the little-endian, length-prefixed structures of APK
+// signature blocks, remembering the first error
+type apkReader struct {
+	b   []byte
+	err error
+}
+
+func (r *apkReader) fail() {
+	if r.err == nil {
+		r.err = errors.New("truncated APK signature structure")
+	}
+	r.b = nil
+}
+
+func (r *apkReader) uint32() uint32 {
+	if len(r.b) < 4 {
+		r.fail()
+		return 0
+	}
+	v := binary.LittleEndian.Uint32(r.b)
+	r.b = r.b[4:]
+	return v
+}
+
+// bytes reads a value with a 32-bit length prefix
+func (r *apkReader) bytes() []byte {
+	n := r.uint32()
+	if uint64(n) > uint64(len(r.b)) {
+		r.fail()
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+// sequence reads a length-prefixed sequence of length-prefixed values
+func (r *apkReader) sequence() [][]byte {
+	s := &apkReader{b: r.bytes()}
+	var values [][]byte
+	for r.err == nil && s.err == nil && len(s.b) > 0 {
+		values = append(values, s.bytes())
+	}
+	if s.err != nil && r.err == nil {
+		r.err = s.err
+	}
+	return values
+}
+
+// isAPKPackage reports whether the ZIP archive a is an Android package
+func isAPKPackage(a *zipArchive) bool {
+	return a.entry("AndroidManifest.xml") != nil
+}
+
+// isAPKSigningBlock reports whether data is an APK Signing Block, as
+// ExtractDigitalSignature returns for APKs
+func isAPKSigningBlock(data []byte) bool {
+	return len(data) >= 8+apkSigningBlockFooterSize && bytes.HasSuffix(data, []byte(apkSigningBlockMagic))
+}
+
+// readAPKSigningBlock returns the APK Signing Block of the archive a, or
+// nil when it has none
+func readAPKSigningBlock(a *zipArchive) (*apkSigningBlock, error) {
+	if a.directoryOffset < 8+apkSigningBlockFooterSize {
+		return nil, nil
+	}
+	footer := make([]byte, apkSigningBlockFooterSize)
+	if _, err := a.r.ReadAt(footer, a.directoryOffset-apkSigningBlockFooterSize); err != nil {
+		return nil, fmt.Errorf("failed to read APK Signing Block: %w", err)
+	}
+	if string(footer[8:]) != apkSigningBlockMagic {
+		return nil, nil
+	}
+	if a.zip64EOCD != nil {
+		return nil, fmt.Errorf("%w: APKs with Zip64 records are not supported", ErrNotZipArchive)
+	}
+	// The size counts the block without its leading size field
+	size := binary.LittleEndian.Uint64(footer)
+	if size < apkSigningBlockFooterSize || size > uint64(a.directoryOffset-8) {
+		return nil, &SignatureBoundsError{Offset: a.directoryOffset - apkSigningBlockFooterSize, Length: int64(min(size, math.MaxInt64)), FileSize: a.size, Reason: "APK Signing Block exceeds the archive data"}
+	}
+	total := int64(size) + 8
+	if total > MaxSignatureSize {
+		return nil, &SignatureSizeError{Size: total, Limit: MaxSignatureSize}
+	}
+	block := &apkSigningBlock{offset: a.directoryOffset - total, raw: make([]byte, total), blocks: make(map[uint32][]byte)}
+	if _, err := a.r.ReadAt(block.raw, block.offset); err != nil {
+		return nil, fmt.Errorf("failed to read APK Signing Block: %w", err)
+	}
+	if binary.LittleEndian.Uint64(block.raw) != size {
+		return nil, errors.New("APK Signing Block sizes do not match")
+	}
+	pairs := block.raw[8 : len(block.raw)-apkSigningBlockFooterSize]
+	for len(pairs) > 0 {
+		if len(pairs) < 8 {
+			return nil, errors.New("truncated APK Signing Block entry")
+		}
+		n := binary.LittleEndian.Uint64(pairs)
+		if n < 4 || n > uint64(len(pairs)-8) {
+			return nil, errors.New("APK Signing Block entry exceeds the block")
+		}
+		value := pairs[8 : 8+n]
+		block.blocks[binary.LittleEndian.Uint32(value)] = value[4:]
+		pairs = pairs[8+n:]
+	}
+	return block, nil
+}
+
+// signers parses the signers of the v3 and v2 scheme blocks of b, v3 first
+func (b *apkSigningBlock) signers() ([]*apkSignerBlock, error) {
+	var signers []*apkSignerBlock
+	for _, scheme := range []struct {
+		id      uint32
+		version int
+	}{{apkSchemeV3BlockID, 3}, {apkSchemeV2BlockID, 2}} {
+		value, ok := b.blocks[scheme.id]
+		if !ok {
+			continue
+		}
+		r := &apkReader{b: value}
+		blocks := r.sequence()
+		if r.err == nil && len(r.b) > 0 {
+			r.err = errors.New("trailing data")
+		}
+		if r.err != nil {
+			return nil, fmt.Errorf("malformed APK Signature Scheme v%d block: %w", scheme.version, r.err)
+		}
+		if len(blocks) == 0 {
+			return nil, fmt.Errorf("APK Signature Scheme v%d block has no signers", scheme.version)
+		}
+		for i, data := range blocks {
+			s, err := parseAPKSigner(scheme.version, data)
+			if err != nil {
+				return nil, fmt.Errorf("malformed APK Signature Scheme v%d signer %d: %w", scheme.version, i+1, err)
+			}
+			signers = append(signers, s)
+		}
+	}
+	if len(signers) == 0 {
+		return nil, fmt.Errorf("%w (APK has no v2 or v3 signature)", ErrNotSigned)
+	}
+	return signers, nil
+}
+
+// parseAPKSigner parses a signer of the scheme block version scheme
+func parseAPKSigner(scheme int, data []byte) (*apkSignerBlock, error) {
+	s := &apkSignerBlock{scheme: scheme, digests: make(map[uint32][]byte), attributes: make(map[uint32][]byte)}
+	r := &apkReader{b: data}
+	s.signedData = r.bytes()
+	var minSDK, maxSDK uint32
+	if scheme == 3 {
+		minSDK, maxSDK = r.uint32(), r.uint32()
+	}
+	for _, value := range r.sequence() {
+		v := &apkReader{b: value}
+		s.signatures = append(s.signatures, apkSignatureValue{algorithm: v.uint32(), signature: v.bytes()})
+		if v.err != nil {
+			return nil, v.err
+		}
+	}
+	s.publicKey = r.bytes()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	signed := &apkReader{b: s.signedData}
+	for _, value := range signed.sequence() {
+		v := &apkReader{b: value}
+		algorithm, digest := v.uint32(), v.bytes()
+		if v.err != nil {
+			return nil, v.err
+		}
+		s.digests[algorithm] = digest
+		s.digestOrder = append(s.digestOrder, algorithm)
+	}
+	for _, der := range signed.sequence() {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse signer certificate: %w", err)
+		}
+		s.certificates = append(s.certificates, cert)
+	}
+	if scheme == 3 {
+		s.minSDK, s.maxSDK = signed.uint32(), signed.uint32()
+	}
+	for _, value := range signed.sequence() {
+		v := &apkReader{b: value}
+		id := v.uint32()
+		if v.err != nil {
+			return nil, v.err
+		}
+		s.attributes[id] = v.b
+	}
+	if signed.err != nil {
+		return nil, signed.err
+	}
+	if len(s.certificates) == 0 {
+		return nil, errors.New("signer has no certificate")
+	}
+	if len(s.signatures) == 0 {
+		return nil, errors.New("signer has no signature")
+	}
+	if scheme == 3 && (minSDK != s.minSDK || maxSDK != s.maxSDK) {
+		return nil, errors.New("signed and unsigned SDK versions of the v3 signer differ")
+	}
+	if value, ok := s.attributes[apkProofOfRotationID]; ok && scheme == 3 {
+		lineage, err := parseAPKLineage(value)
+		if err != nil {
+			return nil, fmt.Errorf("malformed proof-of-rotation: %w", err)
+		}
+		s.lineage = lineage
+	}
+	return s, nil
+}
+
+// parseAPKLineage parses the proof-of-rotation attribute value of a v3
+// signer
+func parseAPKLineage(value []byte) ([]apkLineageLevel, error) {
+	r := &apkReader{b: value}
+	if version := r.uint32(); r.err == nil && version != 1 {
+		return nil, fmt.Errorf("unsupported version %d", version)
+	}
+	var levels []apkLineageLevel
+	for _, node := range r.sequence() {
+		n := &apkReader{b: node}
+		level := apkLineageLevel{signedData: n.bytes(), flags: n.uint32(), algorithm: n.uint32(), signature: n.bytes()}
+		signed := &apkReader{b: level.signedData}
+		der := signed.bytes()
+		level.signedAlgorithm = signed.uint32()
+		if err := errors.Join(n.err, signed.err); err != nil {
+			return nil, err
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse lineage certificate: %w", err)
+		}
+		level.certificate = cert
+		levels = append(levels, level)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(levels) == 0 {
+		return nil, errors.New("lineage is empty")
+	}
+	return levels, nil
+}
+
+// info describes s
+func (s *apkSignerBlock) info() APKSigner {
+	info := APKSigner{Scheme: s.scheme, MinSDK: s.minSDK, MaxSDK: s.maxSDK, Signer: newCertificateInfo(s.certificates[0])}
+	for _, sig := range s.signatures {
+		info.Algorithms = append(info.Algorithms, apkAlgorithmName(sig.algorithm))
+	}
+	for _, cert := range s.certificates {
+		info.Certificates = append(info.Certificates, *newCertificateInfo(cert))
+	}
+	for _, level := range s.lineage {
+		info.Lineage = append(info.Lineage, APKLineageNode{Certificate: newCertificateInfo(level.certificate), Flags: level.flags})
+	}
+	return info
+}
+
+// verify checks the signatures of s over its signed data with its public
+// key, which must be that of its certificate, and the rotation lineage of
+// a v3 signer. It returns the content digests s signs by hash algorithm.
+func (s *apkSignerBlock) verify() (map[crypto.Hash][]byte, error) {
+	key, err := x509.ParsePKIXPublicKey(s.publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signer public key: %w", err)
+	}
+	if !bytes.Equal(s.publicKey, s.certificates[0].RawSubjectPublicKeyInfo) {
+		return nil, errors.New("signer public key is not that of its certificate")
+	}
+	digests := make(map[crypto.Hash][]byte)
+	for _, sig := range s.signatures {
+		algorithm, ok := apkSignatureAlgorithms[sig.algorithm]
+		if !ok {
+			continue
+		}
+		if err := verifyAPKSignature(algorithm, key, s.signedData, sig.signature); err != nil {
+			return nil, fmt.Errorf("%w: %s signature of v%d signer %s: %w", ErrInvalidSignature, algorithm.name, s.scheme, s.certificates[0].Subject, err)
+		}
+		digest, ok := s.digests[sig.algorithm]
+		if !ok {
+			return nil, fmt.Errorf("v%d signer signs no %s content digest", s.scheme, algorithm.name)
+		}
+		digests[algorithm.hash] = digest
+	}
+	if len(digests) == 0 {
+		return nil, fmt.Errorf("v%d signer %s has no supported signature algorithm", s.scheme, s.certificates[0].Subject)
+	}
+	if len(s.digestOrder) != len(s.signatures) {
+		return nil, fmt.Errorf("v%d signer signs %d digests for %d signatures", s.scheme, len(s.digestOrder), len(s.signatures))
+	}
+
+	// Each lineage certificate is signed by its predecessor, and the last
+	// is the signing certificate
+	for i := 1; i < len(s.lineage); i++ {
+		prev, level := s.lineage[i-1], s.lineage[i]
+		algorithm, ok := apkSignatureAlgorithms[prev.algorithm]
+		if !ok || level.signedAlgorithm != prev.algorithm {
+			return nil, fmt.Errorf("unsupported signature algorithm %s in proof-of-rotation", apkAlgorithmName(level.signedAlgorithm))
+		}
+		if err := verifyAPKSignature(algorithm, prev.certificate.PublicKey, level.signedData, level.signature); err != nil {
+			return nil, fmt.Errorf("%w: proof-of-rotation signature of %s over %s: %w", ErrInvalidSignature, prev.certificate.Subject, level.certificate.Subject, err)
+		}
+	}
+	if n := len(s.lineage); n > 0 && !s.lineage[n-1].certificate.Equal(s.certificates[0]) {
+		return nil, errors.New("proof-of-rotation does not end with the signing certificate")
+	}
+	return digests, nil
+}
+
+// verifyAPKSignature checks the signature of data with key under algorithm
+func verifyAPKSignature(algorithm apkSignatureAlgorithm, key crypto.PublicKey, data, signature []byte) error {
+	h := algorithm.hash.New()
+	h.Write(data)
+	digest := h.Sum(nil)
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if algorithm.key != x509.RSA {
+			break
+		}
+		if algorithm.pss {
+			return rsa.VerifyPSS(key, algorithm.hash, digest, signature, &rsa.PSSOptions{SaltLength: algorithm.hash.Size(), Hash: algorithm.hash})
+		}
+		return rsa.VerifyPKCS1v15(key, algorithm.hash, digest, signature)
+	case *ecdsa.PublicKey:
+		if algorithm.key != x509.ECDSA {
+			break
+		}
+		if !ecdsa.VerifyASN1(key, digest, signature) {
+			return errors.New("ECDSA verification failure")
+		}
+		return nil
+	case *dsa.PublicKey:
+		if algorithm.key != x509.DSA {
+			break
+		}
+		var sig struct{ R, S *big.Int }
+		if rest, err := asn1.Unmarshal(signature, &sig); err != nil || len(rest) > 0 {
+			return errors.New("malformed DSA signature")
+		}
+		// The digest is truncated to the size of the subgroup
+		if n := (key.Q.BitLen() + 7) / 8; len(digest) > n {
+			digest = digest[:n]
+		}
+		if !dsa.Verify(key, digest, sig.R, sig.S) {
+			return errors.New("DSA verification failure")
+		}
+		return nil
+	}
+	return fmt.Errorf("%s signature with a %T key", algorithm.name, key)
+}
+
+// apkContentDigests computes the content digests of the APK a, whose
+// signing block starts at blockOffset, with each of algorithms: the digest
+// of the digests of the 1 MiB chunks of the ZIP entries, the central
+// directory and the end of central directory record, which is taken to
+// point at the signing block
+func apkContentDigests(a *zipArchive, blockOffset int64, algorithms []crypto.Hash) (map[crypto.Hash][]byte, error) {
+	eocd := append([]byte(nil), a.eocd...)
+	binary.LittleEndian.PutUint32(eocd[16:], uint32(blockOffset))
+	sections := []*io.SectionReader{
+		io.NewSectionReader(a.r, 0, blockOffset),
+		io.NewSectionReader(a.r, a.directoryOffset, a.directorySize),
+		io.NewSectionReader(bytes.NewReader(eocd), 0, int64(len(eocd))),
+	}
+	chunkDigests := make(map[crypto.Hash][]byte)
+	chunks := uint32(0)
+	chunk := make([]byte, apkChunkSize)
+	prefix := []byte{0xa5, 0, 0, 0, 0}
+	for _, section := range sections {
+		for offset := int64(0); offset < section.Size(); offset += apkChunkSize {
+			n := min(apkChunkSize, section.Size()-offset)
+			if _, err := section.ReadAt(chunk[:n], offset); err != nil {
+				return nil, fmt.Errorf("failed to hash APK: %w", err)
+			}
+			binary.LittleEndian.PutUint32(prefix[1:], uint32(n))
+			for _, algorithm := range algorithms {
+				h := algorithm.New()
+				h.Write(prefix)
+				h.Write(chunk[:n])
+				chunkDigests[algorithm] = h.Sum(chunkDigests[algorithm])
+			}
+			chunks++
+		}
+	}
+	digests := make(map[crypto.Hash][]byte)
+	for _, algorithm := range algorithms {
+		h := algorithm.New()
+		h.Write([]byte{0x5a})
+		binary.Write(h, binary.LittleEndian, chunks)
+		h.Write(chunkDigests[algorithm])
+		digests[algorithm] = h.Sum(nil)
+	}
+	return digests, nil
+}
+
+// openAPK parses the ZIP archive and the APK Signing Block of the APK r
+func openAPK(r io.ReaderAt, size int64) (*zipArchive, *apkSigningBlock, error) {
+	a, err := openZipArchive(r, size)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, err := readAPKSigningBlock(a)
+	if err != nil {
+		return nil, nil, err
+	}
+	if block == nil {
+		return nil, nil, fmt.Errorf("%w (APK has no APK Signing Block)", ErrNotSigned)
+	}
+	return a, block, nil
+}
+
+// readAPKSignature returns the APK Signing Block of the APK r, or the
+// first JAR signature block of an APK without one
+func readAPKSignature(r io.ReaderAt, size int64) ([]byte, error) {
+	_, block, err := openAPK(r, size)
+	if errors.Is(err, ErrNotSigned) {
+		return readJARSignature(r, size)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return block.raw, nil
+}
+
+// InspectAPKSignatures parses the APK Signature Scheme v2 and v3 blocks of
+// an Android package and reports their signers: the signing certificates,
+// signature algorithms, the Android versions v3 signers apply to and the
+// lineage of signing certificates rotated with v3.
+//
+// InspectAPKSignatures does not verify the signatures; use Verify to
+// establish trust in the reported values.
+//
+// Parameters:
+//   - filePath: The path to the APK
+//
+// Returns:
+//   - []APKSigner: The v3 signers followed by the v2 signers
+//   - error: ErrNotSigned if the APK has no v2 or v3 signature, or an error
+//     if a signature cannot be parsed
+//
+// Example usage:
+//
+//	signers, err := sigtool.InspectAPKSignatures("app-release.apk")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	for _, s := range signers {
+//	    fmt.Printf("v%d: %s (%s)\n", s.Scheme, s.Signer.Subject, s.Signer.SHA256Thumbprint)
+//	}
+func InspectAPKSignatures(filePath string) ([]APKSigner, error) {
+	if strings.TrimSpace(filePath) == "" {
+		return nil, errors.New("file path cannot be empty")
+	}
+	// #nosec G304 - This tool is designed to read user-specified files
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %q: %w", filePath, err)
+	}
+	defer f.Close()
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+	_, block, err := openAPK(f, fileInfo.Size())
+	if err != nil {
+		return nil, err
+	}
+	signers, err := block.signers()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]APKSigner, len(signers))
+	for i, s := range signers {
+		infos[i] = s.info()
+	}
+	return infos, nil
+}
+
+// verifyAPK verifies the APK Signature Scheme v3 and v2 signers of the APK
+// r as apksigner does: every signer's signatures must verify with its
+// certificate key, and unless disabled the content digests they sign must
+// match the APK. The signers of the v3 block, which Android 9 and later
+// install with, or else of the v2 block are then checked against the pins,
+// denylist and trust anchors of opts. Like Android, APKs without v2 or v3
+// signatures are verified from their JAR signature by verifyJAR.
+func verifyAPK(r io.ReaderAt, size int64, opts VerifyOptions) error {
+	a, block, err := openAPK(r, size)
+	if errors.Is(err, ErrNotSigned) {
+		return verifyJAR(r, size, opts)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to extract signature: %w", err)
+	}
+	signers, err := block.signers()
+	if errors.Is(err, ErrNotSigned) {
+		return verifyJAR(r, size, opts)
+	}
+	if err != nil {
+		return err
+	}
+	log := opts.logger()
+	log.Debug("read APK Signing Block", "fileSize", size, "offset", block.offset, "size", len(block.raw), "signers", len(signers))
+
+	_, hasV3 := block.blocks[apkSchemeV3BlockID]
+	signed := make([]map[crypto.Hash][]byte, len(signers))
+	needed := make(map[crypto.Hash]bool)
+	for i, s := range signers {
+		if signed[i], err = s.verify(); err != nil {
+			return err
+		}
+		for algorithm := range signed[i] {
+			needed[algorithm] = true
+		}
+		// A v2 signer naming v3 detects the removal of the v3 block
+		if value, ok := s.attributes[apkStrippingProtectionID]; ok && len(value) >= 4 && binary.LittleEndian.Uint32(value) == 3 && !hasV3 {
+			return fmt.Errorf("%w: the v2 signature requires an APK Signature Scheme v3 signature, which was removed", ErrInvalidSignature)
+		}
+		log.Debug("verified APK signer", "scheme", s.scheme, "signer", s.certificates[0].Subject.String(), "minSDK", s.minSDK, "maxSDK", s.maxSDK, "lineage", len(s.lineage))
+	}
+
+	if !opts.SkipContentDigest {
+		var algorithms []crypto.Hash
+		for _, algorithm := range []crypto.Hash{crypto.SHA256, crypto.SHA512} {
+			if needed[algorithm] {
+				algorithms = append(algorithms, algorithm)
+			}
+		}
+		computed, err := apkContentDigests(a, block.offset, algorithms)
+		if err != nil {
+			return err
+		}
+		for i, digests := range signed {
+			for algorithm, digest := range digests {
+				if subtle.ConstantTimeCompare(computed[algorithm], digest) != 1 {
+					return fmt.Errorf("APK Signature Scheme v%d content: %w", signers[i].scheme, &DigestMismatchError{Algorithm: algorithm, Signed: digest, Computed: computed[algorithm]})
+				}
+			}
+		}
+	}
+
+	trust, err := resolveTrust(opts)
+	if err != nil {
+		return err
+	}
+	for i, s := range signers {
+		if hasV3 && s.scheme != 3 {
+			continue
+		}
+		weak := weakCertificateFindings(s.certificates, i)
+		// The last lineage certificate is the signing certificate
+		for _, level := range s.lineage[:max(len(s.lineage)-1, 0)] {
+			weak = append(weak, weakCertificateFindings([]*x509.Certificate{level.certificate}, i)...)
+		}
+		if err := verifyCertificateTrust(s.certificates[0], s.certificates, weak, opts, trust, time.Time{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
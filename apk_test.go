@@ -0,0 +1,336 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// apkSignerForTest is a signer of a scheme block built by
+// apkSchemeBlockForTest
+type apkSignerForTest struct {
+	cert      *x509.Certificate
+	key       crypto.Signer
+	algorithm uint32
+	// lineage is the proof-of-rotation attribute of a v3 signer
+	lineage []byte
+}
+
+// apkU32ForTest returns v as a little-endian uint32
+func apkU32ForTest(v uint32) []byte {
+	return binary.LittleEndian.AppendUint32(nil, v)
+}
+
+// apkLengthPrefixedForTest returns each of values with a 32-bit length
+// prefix, concatenated
+func apkLengthPrefixedForTest(values ...[]byte) []byte {
+	var out []byte
+	for _, v := range values {
+		out = binary.LittleEndian.AppendUint32(out, uint32(len(v)))
+		out = append(out, v...)
+	}
+	return out
+}
+
+// apkSignForTest signs data with key under the APK signature algorithm
+func apkSignForTest(t testing.TB, key crypto.Signer, algorithm uint32, data []byte) []byte {
+	t.Helper()
+	a := apkSignatureAlgorithms[algorithm]
+	h := a.hash.New()
+	h.Write(data)
+	var opts crypto.SignerOpts = a.hash
+	if a.pss {
+		opts = &rsa.PSSOptions{SaltLength: a.hash.Size(), Hash: a.hash}
+	}
+	signature, err := key.Sign(rand.Reader, h.Sum(nil), opts)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	return signature
+}
+
+// apkContentDigestForTest computes the content digest of the unsigned ZIP
+// archive z as it will be once a signing block is inserted before its
+// central directory
+func apkContentDigestForTest(z []byte, h crypto.Hash) []byte {
+	eocd := z[len(z)-zipEOCDSize:]
+	directoryOffset := binary.LittleEndian.Uint32(eocd[16:])
+	var chunks []byte
+	count := uint32(0)
+	for _, section := range [][]byte{z[:directoryOffset], z[directoryOffset : len(z)-zipEOCDSize], eocd} {
+		for len(section) > 0 {
+			n := min(len(section), apkChunkSize)
+			d := h.New()
+			d.Write(append([]byte{0xa5}, apkU32ForTest(uint32(n))...))
+			d.Write(section[:n])
+			chunks = d.Sum(chunks)
+			section = section[n:]
+			count++
+		}
+	}
+	d := h.New()
+	d.Write(append([]byte{0x5a}, apkU32ForTest(count)...))
+	d.Write(chunks)
+	return d.Sum(nil)
+}
+
+// apkSchemeBlockForTest returns the scheme block of version scheme for the
+// unsigned ZIP archive z; v2 signers name v3 in their stripping protection
+// attribute when withV3 is set
+func apkSchemeBlockForTest(t testing.TB, scheme int, z []byte, withV3 bool, signers ...apkSignerForTest) []byte {
+	t.Helper()
+	var blocks [][]byte
+	for _, s := range signers {
+		digest := apkContentDigestForTest(z, apkSignatureAlgorithms[s.algorithm].hash)
+		var attributes [][]byte
+		if scheme == 2 && withV3 {
+			attributes = append(attributes, append(apkU32ForTest(apkStrippingProtectionID), apkU32ForTest(3)...))
+		}
+		if s.lineage != nil {
+			attributes = append(attributes, append(apkU32ForTest(apkProofOfRotationID), s.lineage...))
+		}
+		signedData := apkLengthPrefixedForTest(apkLengthPrefixedForTest(append(apkU32ForTest(s.algorithm), apkLengthPrefixedForTest(digest)...)))
+		signedData = append(signedData, apkLengthPrefixedForTest(apkLengthPrefixedForTest(s.cert.Raw))...)
+		var sdk []byte
+		if scheme == 3 {
+			sdk = append(apkU32ForTest(28), apkU32ForTest(0x7fffffff)...)
+			signedData = append(signedData, sdk...)
+		}
+		signedData = append(signedData, apkLengthPrefixedForTest(apkLengthPrefixedForTest(attributes...))...)
+
+		signature := append(apkU32ForTest(s.algorithm), apkLengthPrefixedForTest(apkSignForTest(t, s.key, s.algorithm, signedData))...)
+		signer := append(apkLengthPrefixedForTest(signedData), sdk...)
+		signer = append(signer, apkLengthPrefixedForTest(apkLengthPrefixedForTest(signature))...)
+		signer = append(signer, apkLengthPrefixedForTest(s.cert.RawSubjectPublicKeyInfo)...)
+		blocks = append(blocks, signer)
+	}
+	return apkLengthPrefixedForTest(apkLengthPrefixedForTest(blocks...))
+}
+
+// apkLineageForTest returns the proof-of-rotation attribute of certs, each
+// signed by its predecessor with RSASSA-PKCS1-v1_5-SHA256
+func apkLineageForTest(t testing.TB, ids ...*testIdentity) []byte {
+	t.Helper()
+	var nodes [][]byte
+	for i, id := range ids {
+		signedAlgorithm := uint32(0)
+		var signature []byte
+		if i > 0 {
+			signedAlgorithm = 0x0103
+		}
+		signedData := append(apkLengthPrefixedForTest(id.Cert.Raw), apkU32ForTest(signedAlgorithm)...)
+		if i > 0 {
+			signature = apkSignForTest(t, ids[i-1].Key, 0x0103, signedData)
+		}
+		node := apkLengthPrefixedForTest(signedData)
+		node = append(node, apkU32ForTest(0x1f)...)
+		node = append(node, apkU32ForTest(0x0103)...)
+		node = append(node, apkLengthPrefixedForTest(signature)...)
+		nodes = append(nodes, node)
+	}
+	return append(apkU32ForTest(1), apkLengthPrefixedForTest(apkLengthPrefixedForTest(nodes...))...)
+}
+
+// apkWithBlockForTest inserts an APK Signing Block of the scheme blocks
+// by ID before the central directory of the ZIP archive z
+func apkWithBlockForTest(z []byte, blocks map[uint32][]byte) []byte {
+	var pairs []byte
+	for _, id := range []uint32{apkSchemeV2BlockID, apkSchemeV3BlockID} {
+		if value, ok := blocks[id]; ok {
+			pairs = binary.LittleEndian.AppendUint64(pairs, uint64(4+len(value)))
+			pairs = append(pairs, apkU32ForTest(id)...)
+			pairs = append(pairs, value...)
+		}
+	}
+	size := uint64(len(pairs) + apkSigningBlockFooterSize)
+	block := binary.LittleEndian.AppendUint64(nil, size)
+	block = append(block, pairs...)
+	block = binary.LittleEndian.AppendUint64(block, size)
+	block = append(block, apkSigningBlockMagic...)
+
+	directoryOffset := binary.LittleEndian.Uint32(z[len(z)-zipEOCDSize+16:])
+	out := append(append([]byte(nil), z[:directoryOffset]...), block...)
+	out = append(out, z[directoryOffset:]...)
+	binary.LittleEndian.PutUint32(out[len(out)-zipEOCDSize+16:], directoryOffset+uint32(len(block)))
+	return out
+}
+
+// apkMembersForTest are the members of an unsigned APK
+func apkMembersForTest() []zipMemberForTest {
+	return []zipMemberForTest{
+		{"AndroidManifest.xml", []byte("\x03\x00\x08\x00manifest")},
+		{"classes.dex", bytes.Repeat([]byte("dex\n035\x00"), 256)},
+		{"resources.arsc", bytes.Repeat([]byte{0x02, 0x00, 0x0c, 0x00}, 128)},
+	}
+}
+
+// apkKeyForTest returns a self-signed app signing certificate, as a
+// keystore generates
+func apkKeyForTest(t testing.TB, cn string, serial int64) *testIdentity {
+	t.Helper()
+	return issueCertificateForTest(t, testLeafTemplate(cn, serial), nil)
+}
+
+func TestVerify_APK(t *testing.T) {
+	id := apkKeyForTest(t, "Android Debug", 9301)
+	z := zipForTest(t, apkMembersForTest())
+	signer := apkSignerForTest{cert: id.Cert, key: id.Key, algorithm: 0x0103}
+	apk := apkWithBlockForTest(z, map[uint32][]byte{
+		apkSchemeV2BlockID: apkSchemeBlockForTest(t, 2, z, true, signer),
+		apkSchemeV3BlockID: apkSchemeBlockForTest(t, 3, z, true, apkSignerForTest{cert: id.Cert, key: id.Key, algorithm: 0x0101}),
+	})
+	filePath := writeScriptForTest(t, "app.apk", apk)
+
+	if fileType, err := DetectFileType(filePath); err != nil || fileType != FileTypeAPK {
+		t.Fatalf("Expected FileTypeAPK, got %q, %v", fileType, err)
+	}
+	if block, err := ExtractDigitalSignature(filePath); err != nil || !isAPKSigningBlock(block) {
+		t.Fatalf("Expected the APK Signing Block, got %v", err)
+	}
+	if err := Verify(filePath, nil); err != nil {
+		t.Fatalf("Expected valid APK signatures, got %v", err)
+	}
+	thumbprint := newCertificateInfo(id.Cert).SHA256Thumbprint
+	if err := Verify(filePath, &VerifyOptions{RequiredThumbprints: []string{thumbprint}}); err != nil {
+		t.Errorf("Expected the pinned signer to verify, got %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{RequiredThumbprints: []string{strings.Repeat("00", 32)}}); !errors.Is(err, ErrSignerNotPinned) {
+		t.Errorf("Expected ErrSignerNotPinned for another thumbprint, got %v", err)
+	}
+
+	signers, err := InspectAPKSignatures(filePath)
+	if err != nil || len(signers) != 2 {
+		t.Fatalf("Expected two signers, got %+v, %v", signers, err)
+	}
+	if s := signers[0]; s.Scheme != 3 || s.MinSDK != 28 || s.Algorithms[0] != "RSASSA-PSS-SHA256" || s.Signer.SHA256Thumbprint != thumbprint {
+		t.Errorf("Unexpected v3 signer %+v", s)
+	}
+	if s := signers[1]; s.Scheme != 2 || s.MinSDK != 0 || s.Algorithms[0] != "RSASSA-PKCS1-v1_5-SHA256" || len(s.Certificates) != 1 {
+		t.Errorf("Unexpected v2 signer %+v", s)
+	}
+	if _, err := Inspect(filePath); err == nil || !strings.Contains(err.Error(), "InspectAPKSignatures") {
+		t.Errorf("Expected Inspect to refer to InspectAPKSignatures, got %v", err)
+	}
+
+	tampered := append([]byte(nil), apk...)
+	tampered[100] ^= 0xff
+	tamperedPath := writeScriptForTest(t, "app.apk", tampered)
+	var mismatch *DigestMismatchError
+	if err := Verify(tamperedPath, nil); !errors.As(err, &mismatch) {
+		t.Errorf("Expected DigestMismatchError for a modified entry, got %v", err)
+	}
+	if err := Verify(tamperedPath, &VerifyOptions{SkipContentDigest: true}); err != nil {
+		t.Errorf("Expected a modified entry to pass without digests, got %v", err)
+	}
+
+	// Removing the v3 block is detected by the v2 stripping protection
+	stripped := apkWithBlockForTest(z, map[uint32][]byte{apkSchemeV2BlockID: apkSchemeBlockForTest(t, 2, z, true, signer)})
+	if err := Verify(writeScriptForTest(t, "app.apk", stripped), nil); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for a stripped v3 signature, got %v", err)
+	}
+
+	other := apkKeyForTest(t, "Other", 9302)
+	forged := apkWithBlockForTest(z, map[uint32][]byte{apkSchemeV2BlockID: apkSchemeBlockForTest(t, 2, z, false, apkSignerForTest{cert: id.Cert, key: other.Key, algorithm: 0x0103})})
+	if err := Verify(writeScriptForTest(t, "app.apk", forged), nil); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for a signature by another key, got %v", err)
+	}
+
+	unsigned := writeScriptForTest(t, "app.apk", z)
+	if err := Verify(unsigned, nil); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned for an unsigned APK, got %v", err)
+	}
+	if _, err := InspectAPKSignatures(unsigned); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned from InspectAPKSignatures, got %v", err)
+	}
+}
+
+func TestVerify_APKRotation(t *testing.T) {
+	original := apkKeyForTest(t, "Original", 9311)
+	rotated := apkKeyForTest(t, "Rotated", 9312)
+	z := zipForTest(t, apkMembersForTest())
+	build := func(lineage []byte) string {
+		return writeScriptForTest(t, "app.apk", apkWithBlockForTest(z, map[uint32][]byte{
+			apkSchemeV2BlockID: apkSchemeBlockForTest(t, 2, z, true, apkSignerForTest{cert: original.Cert, key: original.Key, algorithm: 0x0103}),
+			apkSchemeV3BlockID: apkSchemeBlockForTest(t, 3, z, true, apkSignerForTest{cert: rotated.Cert, key: rotated.Key, algorithm: 0x0104, lineage: lineage}),
+		}))
+	}
+
+	filePath := build(apkLineageForTest(t, original, rotated))
+	// The pins apply to the v3 signer Android 9 and later install with
+	opts := &VerifyOptions{RequiredThumbprints: []string{newCertificateInfo(rotated.Cert).SHA256Thumbprint}}
+	if err := Verify(filePath, opts); err != nil {
+		t.Fatalf("Expected a rotated signing key to verify, got %v", err)
+	}
+	signers, err := InspectAPKSignatures(filePath)
+	if err != nil {
+		t.Fatalf("InspectAPKSignatures failed: %v", err)
+	}
+	lineage := signers[0].Lineage
+	if len(lineage) != 2 || lineage[0].Certificate.CommonName != "Original" || lineage[1].Certificate.CommonName != "Rotated" || lineage[1].Flags != 0x1f {
+		t.Errorf("Unexpected lineage %+v", lineage)
+	}
+
+	forged := apkLineageForTest(t, original, rotated)
+	forged[len(forged)-1] ^= 0xff
+	if err := Verify(build(forged), nil); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for a modified proof-of-rotation, got %v", err)
+	}
+	if err := Verify(build(apkLineageForTest(t, rotated, original)), nil); err == nil {
+		t.Error("Expected an error for a lineage not ending with the signing certificate")
+	}
+}
+
+func TestVerify_APKECDSA(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(9321), Subject: pkix.Name{CommonName: "ECDSA app"}, NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	z := zipForTest(t, apkMembersForTest())
+	apk := apkWithBlockForTest(z, map[uint32][]byte{apkSchemeV2BlockID: apkSchemeBlockForTest(t, 2, z, false, apkSignerForTest{cert: cert, key: key, algorithm: 0x0201})})
+	if err := Verify(writeScriptForTest(t, "app.apk", apk), nil); err != nil {
+		t.Errorf("Expected a valid ECDSA signature, got %v", err)
+	}
+}
+
+func TestReadAPKSigningBlock_Malformed(t *testing.T) {
+	id := apkKeyForTest(t, "Android Debug", 9331)
+	z := zipForTest(t, apkMembersForTest())
+	apk := apkWithBlockForTest(z, map[uint32][]byte{apkSchemeV2BlockID: apkSchemeBlockForTest(t, 2, z, false, apkSignerForTest{cert: id.Cert, key: id.Key, algorithm: 0x0103})})
+	blockEnd := int(binary.LittleEndian.Uint32(apk[len(apk)-zipEOCDSize+16:]))
+	blockStart := blockEnd - int(binary.LittleEndian.Uint64(apk[blockEnd-apkSigningBlockFooterSize:])) - 8
+	tests := []struct {
+		name   string
+		mutate func([]byte)
+	}{
+		{"footer size", func(b []byte) { binary.LittleEndian.PutUint64(b[blockEnd-apkSigningBlockFooterSize:], 1<<40) }},
+		{"leading size", func(b []byte) { b[blockStart] ^= 0x01 }},
+		{"entry size", func(b []byte) { binary.LittleEndian.PutUint64(b[blockStart+8:], 1<<20) }},
+		{"signer size", func(b []byte) { binary.LittleEndian.PutUint32(b[blockStart+20:], 1<<20) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := append([]byte(nil), apk...)
+			tt.mutate(data)
+			if _, err := InspectAPKSignatures(writeScriptForTest(t, "app.apk", data)); err == nil || errors.Is(err, ErrNotSigned) {
+				t.Errorf("Expected an error for a malformed signing block, got %v", err)
+			}
+		})
+	}
+}
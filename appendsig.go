@@ -0,0 +1,117 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+)
+
+// AppendSignature adds a nested Authenticode signature to the existing
+// signature of a PE file, as `signtool sign /as` does. Dual signing lets a
+// binary carry a SHA-1 signature for legacy Windows versions and a SHA-256
+// signature for current ones.
+//
+// The Authenticode digest is computed with opts.Hash, signed by signer and
+// stored in the 1.3.6.1.4.1.311.2.4.1 unsigned attribute of the primary
+// signature, after any nested signatures already there. The primary
+// signature is not changed otherwise. The new signature must use a digest
+// algorithm that no existing signature uses. The file is replaced
+// atomically.
+//
+// Parameters:
+//   - filePath: The path to the signed PE file
+//   - signer: The signing backend for the nested signature
+//   - opts: Signing options for the nested signature, or nil for SHA-256
+//
+// Returns:
+//   - error: ErrNotSigned for unsigned files, or an error if the digest
+//     algorithm is already used or the file cannot be signed or written
+//
+// Example usage:
+//
+//	// Primary SHA-1 signature for Windows Vista, nested SHA-256 signature
+//	err := sigtool.SignPE("app.exe", cert, key, &sigtool.SignOptions{Hash: crypto.SHA1})
+//	if err == nil {
+//	    err = sigtool.AppendSignature("app.exe", sigtool.NewSigner(key, cert), nil)
+//	}
+func AppendSignature(filePath string, signer Signer, opts *SignOptions) error {
+	if signer == nil {
+		return errors.New("a signer is required")
+	}
+	if opts == nil {
+		opts = &SignOptions{}
+	}
+	h := opts.Hash
+	if h == 0 {
+		h = crypto.SHA256
+	}
+
+	return updateSignature(filePath, func(signature, image []byte, layout *peLayout) ([]byte, error) {
+		sd, err := parseSignedData(signature)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Authenticode signature: %w", err)
+		}
+		if err := checkNestedAlgorithm(signature, sd, h); err != nil {
+			return nil, err
+		}
+
+		digest, err := authentihash(bytes.NewReader(image), layout, h)
+		if err != nil {
+			return nil, err
+		}
+		nested, err := signAuthenticode(digest, h, signer, opts)
+		if err != nil {
+			return nil, err
+		}
+		appendNestedSignature(&sd.SignerInfos[0], nested)
+		return encodeSignedData(sd)
+	})
+}
+
+// checkNestedAlgorithm fails when the primary signature or one of the nested
+// signatures of sd already digests the file with h
+func checkNestedAlgorithm(signature []byte, sd *signedData, h crypto.Hash) error {
+	existing := [][]byte{signature}
+	for _, attr := range sd.SignerInfos[0].UnauthenticatedAttributes {
+		if !attr.Type.Equal(oidNestedSignature) {
+			continue
+		}
+		rest := attr.Value.Bytes
+		for len(rest) > 0 {
+			var value asn1.RawValue
+			var err error
+			if rest, err = asn1.Unmarshal(rest, &value); err != nil {
+				return fmt.Errorf("failed to parse nested signature attribute: %w", err)
+			}
+			existing = append(existing, value.FullBytes)
+		}
+	}
+	for _, raw := range existing {
+		used, _, err := parseStoredDigest(raw)
+		if err != nil {
+			return fmt.Errorf("invalid Authenticode signature: %w", err)
+		}
+		if used == h {
+			return fmt.Errorf("file already has a %s signature", h)
+		}
+	}
+	return nil
+}
+
+// appendNestedSignature adds signature to the nested-signature attribute of
+// si, creating the attribute when it is missing
+func appendNestedSignature(si *signerInfo, signature []byte) {
+	for i, attr := range si.UnauthenticatedAttributes {
+		if attr.Type.Equal(oidNestedSignature) {
+			values := append(append([]byte(nil), attr.Value.Bytes...), signature...)
+			si.UnauthenticatedAttributes[i].Value = asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: values}
+			return
+		}
+	}
+	si.UnauthenticatedAttributes = append(si.UnauthenticatedAttributes, attribute{
+		Type:  oidNestedSignature,
+		Value: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: signature},
+	})
+}
@@ -0,0 +1,72 @@
+package sigtool
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAppendSignature(t *testing.T) {
+	root := issueCertificateForTest(t, testCATemplate("dual root", 1), nil)
+	leaf := issueCertificateForTest(t, testLeafTemplate("dual signer", 2, x509.ExtKeyUsageCodeSigning), root)
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Cert)
+	signer := NewSigner(leaf.Key, leaf.Cert)
+
+	filePath := writeUnsignedPEForTest(t, []byte("dual signed payload"))
+	if err := SignPE(filePath, leaf.Cert, leaf.Key, &SignOptions{Hash: crypto.SHA1}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := AppendSignature(filePath, signer, nil); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := AppendSignature(filePath, signer, &SignOptions{Hash: crypto.SHA384}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	sigs, err := EnumerateSignatures(filePath, VerifyOptions{Roots: roots})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	want := []crypto.Hash{crypto.SHA1, crypto.SHA256, crypto.SHA384}
+	if len(sigs) != len(want) {
+		t.Fatalf("Expected %d signatures, got %d", len(want), len(sigs))
+	}
+	for i, sig := range sigs {
+		if sig.DigestAlgorithm != want[i] || sig.Nested != (i > 0) || !sig.Valid() {
+			t.Errorf("Signature %d: expected valid %v, got %v nested=%v err=%v", i, want[i], sig.DigestAlgorithm, sig.Nested, sig.Err)
+		}
+	}
+	if err := Verify(filePath, &VerifyOptions{Roots: roots}); err != nil {
+		t.Errorf("Expected the primary signature to verify, got: %v", err)
+	}
+
+	signature, _ := ExtractDigitalSignature(filePath)
+	sd, err := parseSignedData(signature)
+	if err != nil || len(sd.SignerInfos[0].UnauthenticatedAttributes) != 1 {
+		t.Errorf("Expected a single nested-signature attribute, got %+v (%v)", sd, err)
+	}
+
+	err = AppendSignature(filePath, signer, &SignOptions{Hash: crypto.SHA256})
+	if err == nil || !strings.Contains(err.Error(), "already has a SHA-256 signature") {
+		t.Errorf("Expected duplicate algorithm error, got: %v", err)
+	}
+	err = AppendSignature(filePath, signer, &SignOptions{Hash: crypto.SHA1})
+	if err == nil || !strings.Contains(err.Error(), "already has a SHA-1 signature") {
+		t.Errorf("Expected duplicate algorithm error, got: %v", err)
+	}
+}
+
+func TestAppendSignature_Errors(t *testing.T) {
+	leaf := issueCertificateForTest(t, testLeafTemplate("dual signer", 2, x509.ExtKeyUsageCodeSigning), nil)
+
+	unsigned := writeUnsignedPEForTest(t, []byte("payload"))
+	if err := AppendSignature(unsigned, NewSigner(leaf.Key, leaf.Cert), nil); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned, got: %v", err)
+	}
+	if err := AppendSignature(unsigned, nil, nil); err == nil {
+		t.Error("Expected error for a nil signer, got nil")
+	}
+}
@@ -0,0 +1,187 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Type 2 AppImages are ELF runtimes with the squashfs image appended, marked
+// by this magic in the padding of the ELF identification. appimagetool
+// embeds the signature and the signer's public key in two sections.
+const (
+	appImageMagic = "AI\x02"
+	// appImageMagicOffset is the offset of the magic, EI_ABIVERSION
+	appImageMagicOffset = 8
+	// appImageSignatureSection holds the ASCII-armored detached OpenPGP
+	// signature of the digest, padded with NULs
+	appImageSignatureSection = ".sha256_sig"
+	// appImageKeySection holds the ASCII-armored public key of the signer,
+	// padded with NULs
+	appImageKeySection = ".sig_key"
+)
+
+// appImage is a type 2 AppImage parsed down to its signature sections
+type appImage struct {
+	r    io.ReaderAt
+	size int64
+	// signature and key are the signature and key sections, nil when the
+	// runtime has no such section
+	signature, key *elf.Section
+}
+
+// isAppImage reports whether r is an ELF file with the type 2 AppImage magic
+func isAppImage(r io.ReaderAt) bool {
+	ident := make([]byte, appImageMagicOffset+len(appImageMagic))
+	if _, err := r.ReadAt(ident, 0); err != nil {
+		return false
+	}
+	return string(ident[:4]) == elf.ELFMAG && string(ident[appImageMagicOffset:]) == appImageMagic
+}
+
+// openAppImage parses the ELF section headers of the AppImage r and locates
+// its signature sections
+func openAppImage(r io.ReaderAt, size int64) (*appImage, error) {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse AppImage runtime: %w", err)
+	}
+	a := &appImage{r: r, size: size, signature: f.Section(appImageSignatureSection), key: f.Section(appImageKeySection)}
+	for _, s := range []*elf.Section{a.signature, a.key} {
+		if s == nil {
+			continue
+		}
+		if s.Type == elf.SHT_NOBITS || s.Offset > uint64(size) || s.Size > uint64(size)-s.Offset {
+			return nil, &SignatureBoundsError{Offset: int64(s.Offset), Length: int64(s.Size), FileSize: size, Reason: fmt.Sprintf("%s section is outside the file", s.Name)}
+		}
+		if s.Size > MaxSignatureSize {
+			return nil, &SignatureSizeError{Size: int64(s.Size), Limit: MaxSignatureSize}
+		}
+	}
+	return a, nil
+}
+
+// readSection returns the contents of the section s without their NUL
+// padding, or nil when s is nil
+func (a *appImage) readSection(s *elf.Section) ([]byte, error) {
+	if s == nil {
+		return nil, nil
+	}
+	data := make([]byte, s.Size)
+	if _, err := a.r.ReadAt(data, int64(s.Offset)); err != nil {
+		return nil, fmt.Errorf("failed to read %s section: %w", s.Name, err)
+	}
+	return bytes.TrimRight(data, "\x00"), nil
+}
+
+// rawSignature returns the signature section of a, failing with
+// ErrNotSigned when it is missing or empty
+func (a *appImage) rawSignature() ([]byte, error) {
+	data, err := a.readSection(a.signature)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w (AppImage has no %s signature)", ErrNotSigned, appImageSignatureSection)
+	}
+	return data, nil
+}
+
+// pgpSignatures returns the OpenPGP signatures of a, carrying the public
+// key it embeds to name their signer
+func (a *appImage) pgpSignatures() ([]*pgpSignature, error) {
+	data, err := a.rawSignature()
+	if err != nil {
+		return nil, err
+	}
+	signatures, err := parsePGPSignatures(appImageSignatureSection, data)
+	if err != nil {
+		return nil, err
+	}
+	key, err := a.readSection(a.key)
+	if err != nil || len(key) == 0 {
+		return signatures, err
+	}
+	embedded, err := ParsePGPKeyring(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s section: %w", appImageKeySection, err)
+	}
+	for _, s := range signatures {
+		s.embedded = embedded
+	}
+	return signatures, nil
+}
+
+// digest returns the content appimagetool signs: the hexadecimal SHA-256
+// digest of the AppImage with its signature and key sections zeroed
+func (a *appImage) digest() ([]byte, error) {
+	var skip []*elf.Section
+	for _, s := range []*elf.Section{a.signature, a.key} {
+		if s != nil {
+			skip = append(skip, s)
+		}
+	}
+	sort.Slice(skip, func(i, j int) bool { return skip[i].Offset < skip[j].Offset })
+
+	h := sha256.New()
+	var offset int64
+	for _, s := range skip {
+		start, end := int64(s.Offset), int64(s.Offset+s.Size)
+		if start > offset {
+			if _, err := io.Copy(h, io.NewSectionReader(a.r, offset, start-offset)); err != nil {
+				return nil, fmt.Errorf("failed to hash AppImage: %w", err)
+			}
+			offset = start
+		}
+		if end > offset {
+			h.Write(make([]byte, end-offset))
+			offset = end
+		}
+	}
+	if _, err := io.Copy(h, io.NewSectionReader(a.r, offset, a.size-offset)); err != nil {
+		return nil, fmt.Errorf("failed to hash AppImage: %w", err)
+	}
+	return []byte(hex.EncodeToString(h.Sum(nil))), nil
+}
+
+// readAppImageSignature returns the signature section of the AppImage r
+func readAppImageSignature(r io.ReaderAt, size int64) ([]byte, error) {
+	a, err := openAppImage(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return a.rawSignature()
+}
+
+// verifyAppImage verifies the embedded signature of the AppImage r as
+// AppImageKit's validate does: the OpenPGP signature must be over the
+// SHA-256 digest of the AppImage with its signature sections zeroed, by a
+// key of opts.PGPKeyring. The public key the AppImage embeds names the
+// signer but is not trusted.
+func verifyAppImage(r io.ReaderAt, size int64, opts VerifyOptions) error {
+	a, err := openAppImage(r, size)
+	if err != nil {
+		return fmt.Errorf("failed to extract signature: %w", err)
+	}
+	signatures, err := a.pgpSignatures()
+	if err != nil {
+		return fmt.Errorf("failed to extract signature: %w", err)
+	}
+	digest, err := a.digest()
+	if err != nil {
+		return err
+	}
+	key, weak, err := verifyPGPSignatures(signatures, opts.PGPKeyring, func() io.Reader { return bytes.NewReader(digest) })
+	if err != nil {
+		return fmt.Errorf("%s signature: %w", appImageSignatureSection, err)
+	}
+	opts.logger().Debug("verified OpenPGP signature", "fileSize", size, "digest", string(digest), "key", key.PublicKey.KeyIdString(), "userID", pgpUserID(key.Entity))
+	if opts.RejectWeakCrypto && len(weak) > 0 {
+		return &WeakCryptoError{Findings: weak}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// AppImage sizes appimagetool reserves for the signature sections
+const (
+	appImageSignatureSizeForTest = 1024
+	appImageKeySizeForTest       = 8192
+)
+
+// appImageForTest returns a type 2 AppImage, a 64-bit ELF runtime with the
+// .sha256_sig and .sig_key sections followed by payload as the squashfs
+// image, signed with an armored signature by signer as appimagetool signs
+// it, and embedding the public key of embed; either may be nil
+func appImageForTest(t testing.TB, payload []byte, signer, embed *openpgp.Entity) []byte {
+	t.Helper()
+	const headerSize = 64
+	names := "\x00.shstrtab\x00" + appImageSignatureSection + "\x00" + appImageKeySection + "\x00"
+	namesOffset := uint64(headerSize)
+	sigOffset := namesOffset + uint64(len(names))
+	keyOffset := sigOffset + appImageSignatureSizeForTest
+	sectionsOffset := keyOffset + appImageKeySizeForTest
+
+	header := make([]byte, headerSize)
+	copy(header, "\x7fELF\x02\x01\x01")
+	copy(header[appImageMagicOffset:], appImageMagic)
+	binary.LittleEndian.PutUint16(header[16:], 2)  // ET_EXEC
+	binary.LittleEndian.PutUint16(header[18:], 62) // EM_X86_64
+	binary.LittleEndian.PutUint32(header[20:], 1)
+	binary.LittleEndian.PutUint64(header[40:], sectionsOffset)
+	binary.LittleEndian.PutUint16(header[52:], headerSize)
+	binary.LittleEndian.PutUint16(header[54:], 56)
+	binary.LittleEndian.PutUint16(header[58:], 64)
+	binary.LittleEndian.PutUint16(header[60:], 4)
+	binary.LittleEndian.PutUint16(header[62:], 1)
+
+	section := func(name, typ uint32, offset, size uint64) []byte {
+		b := make([]byte, 64)
+		binary.LittleEndian.PutUint32(b, name)
+		binary.LittleEndian.PutUint32(b[4:], typ)
+		binary.LittleEndian.PutUint64(b[24:], offset)
+		binary.LittleEndian.PutUint64(b[32:], size)
+		binary.LittleEndian.PutUint64(b[48:], 1)
+		return b
+	}
+	var image bytes.Buffer
+	image.Write(header)
+	image.WriteString(names)
+	image.Write(make([]byte, appImageSignatureSizeForTest+appImageKeySizeForTest))
+	image.Write(make([]byte, 64))
+	image.Write(section(1, 3, namesOffset, uint64(len(names))))
+	image.Write(section(11, 1, sigOffset, appImageSignatureSizeForTest))
+	image.Write(section(23, 1, keyOffset, appImageKeySizeForTest))
+	image.Write(payload)
+	data := image.Bytes()
+
+	if embed != nil {
+		var key bytes.Buffer
+		w, err := armor.Encode(&key, openpgp.PublicKeyType, nil)
+		if err != nil {
+			t.Fatalf("Failed to armor key: %v", err)
+		}
+		if err := embed.Serialize(w); err != nil {
+			t.Fatalf("Failed to export key: %v", err)
+		}
+		w.Close()
+		copy(data[keyOffset:keyOffset+appImageKeySizeForTest], key.Bytes())
+	}
+	if signer != nil {
+		zeroed := append([]byte(nil), data...)
+		copy(zeroed[keyOffset:], make([]byte, appImageKeySizeForTest))
+		digest := sha256.Sum256(zeroed)
+		var sig bytes.Buffer
+		if err := openpgp.ArmoredDetachSign(&sig, signer, bytes.NewReader([]byte(hex.EncodeToString(digest[:]))), nil); err != nil {
+			t.Fatalf("Failed to sign: %v", err)
+		}
+		copy(data[sigOffset:sigOffset+appImageSignatureSizeForTest], sig.Bytes())
+	}
+	return data
+}
+
+func TestVerify_AppImage(t *testing.T) {
+	signer := pgpEntityForTest(t, "Developer", 2048)
+	payload := append([]byte("hsqs"), bytes.Repeat([]byte("squashfs"), 512)...)
+	filePath := writeScriptForTest(t, "App-x86_64.AppImage", appImageForTest(t, payload, signer, signer))
+
+	if fileType, err := DetectFileType(filePath); err != nil || fileType != FileTypeAppImage {
+		t.Fatalf("Expected FileTypeAppImage, got %q, %v", fileType, err)
+	}
+	if signature, err := ExtractDigitalSignature(filePath); err != nil || !bytes.HasPrefix(signature, []byte("-----BEGIN PGP SIGNATURE")) {
+		t.Errorf("Expected the armored signature, got %q, %v", signature, err)
+	}
+	keyring := pgpKeyringForTest(t, signer)
+	if err := Verify(filePath, &VerifyOptions{PGPKeyring: keyring, RejectWeakCrypto: true}); err != nil {
+		t.Fatalf("Expected a valid AppImage signature, got %v", err)
+	}
+	// The embedded key is not trusted
+	if err := Verify(filePath, nil); !errors.Is(err, ErrSignerCertificateNotFound) {
+		t.Errorf("Expected ErrSignerCertificateNotFound without a keyring, got %v", err)
+	}
+	other := pgpEntityForTest(t, "Other", 2048)
+	if err := Verify(filePath, &VerifyOptions{PGPKeyring: pgpKeyringForTest(t, other)}); !errors.Is(err, ErrSignerCertificateNotFound) {
+		t.Errorf("Expected ErrSignerCertificateNotFound for another key, got %v", err)
+	}
+
+	infos, err := InspectPGPSignatures(filePath, nil)
+	if err != nil || len(infos) != 1 || infos[0].Kind != appImageSignatureSection || infos[0].HashAlgorithm != crypto.SHA256 {
+		t.Fatalf("Expected one signature, got %+v, %v", infos, err)
+	}
+	if infos[0].UserID != pgpUserID(signer) || infos[0].Fingerprint != fmt.Sprintf("%X", signer.PrimaryKey.Fingerprint) {
+		t.Errorf("Expected the embedded key to name the signer, got %+v", infos[0])
+	}
+
+	tampered := appImageForTest(t, payload, signer, signer)
+	tampered[len(tampered)-1] ^= 0xff
+	if err := Verify(writeScriptForTest(t, "App-x86_64.AppImage", tampered), &VerifyOptions{PGPKeyring: keyring}); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for a modified payload, got %v", err)
+	}
+	// Replacing the embedded key does not change the signed digest
+	swapped := writeScriptForTest(t, "App-x86_64.AppImage", appImageForTest(t, payload, signer, other))
+	if err := Verify(swapped, &VerifyOptions{PGPKeyring: keyring}); err != nil {
+		t.Errorf("Expected the signature to cover the AppImage without its key, got %v", err)
+	}
+	if infos, err := InspectPGPSignatures(swapped, nil); err != nil || len(infos) != 1 || infos[0].UserID != "" {
+		t.Errorf("Expected a key other than the signer's not to name it, got %+v, %v", infos, err)
+	}
+
+	unsigned := writeScriptForTest(t, "App-x86_64.AppImage", appImageForTest(t, payload, nil, nil))
+	if err := Verify(unsigned, &VerifyOptions{PGPKeyring: keyring}); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned for an unsigned AppImage, got %v", err)
+	}
+	if _, err := InspectPGPSignatures(unsigned, nil); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned inspecting an unsigned AppImage, got %v", err)
+	}
+}
+
+func TestOpenAppImage_Malformed(t *testing.T) {
+	image := appImageForTest(t, []byte("hsqs"), nil, nil)
+	// The .sha256_sig section header, the third of four at the end
+	shoff := binary.LittleEndian.Uint64(image[40:])
+	outside := append([]byte(nil), image...)
+	binary.LittleEndian.PutUint64(outside[shoff+2*64+24:], uint64(len(image)))
+	var bounds *SignatureBoundsError
+	if _, err := openAppImage(bytes.NewReader(outside), int64(len(outside))); !errors.As(err, &bounds) {
+		t.Errorf("Expected a SignatureBoundsError for a section past the end, got %v", err)
+	}
+	if _, err := openAppImage(bytes.NewReader(image[:32]), 32); err == nil {
+		t.Error("Expected an error for a truncated ELF header")
+	}
+	if isAppImage(bytes.NewReader([]byte("\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00"))) {
+		t.Error("Expected an ELF file without the magic not to be an AppImage")
+	}
+}
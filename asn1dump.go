@@ -0,0 +1,310 @@
+package sigtool
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+)
+
+// asn1Names names the object identifiers found in Authenticode signatures
+var asn1Names = map[string]string{
+	// PKCS#7 and PKCS#9
+	"1.2.840.113549.1.7.1":       "data",
+	"1.2.840.113549.1.7.2":       "signedData",
+	"1.2.840.113549.1.9.3":       "contentType",
+	"1.2.840.113549.1.9.4":       "messageDigest",
+	"1.2.840.113549.1.9.5":       "signingTime",
+	"1.2.840.113549.1.9.6":       "counterSignature",
+	"1.2.840.113549.1.9.15":      "smimeCapabilities",
+	"1.2.840.113549.1.9.16.1.4":  "id-ct-TSTInfo",
+	"1.2.840.113549.1.9.16.2.12": "signingCertificate",
+	"1.2.840.113549.1.9.16.2.47": "signingCertificateV2",
+	// Authenticode
+	"1.3.6.1.4.1.311.2.1.4":  "SpcIndirectDataContent",
+	"1.3.6.1.4.1.311.2.1.10": "SpcAgencyInfo",
+	"1.3.6.1.4.1.311.2.1.11": "SpcStatementType",
+	"1.3.6.1.4.1.311.2.1.12": "SpcSpOpusInfo",
+	"1.3.6.1.4.1.311.2.1.15": "SpcPeImageData",
+	"1.3.6.1.4.1.311.2.1.21": "SpcIndividualCodeSigning",
+	"1.3.6.1.4.1.311.2.1.22": "SpcCommercialCodeSigning",
+	"1.3.6.1.4.1.311.2.1.25": "SpcLink",
+	"1.3.6.1.4.1.311.2.1.30": "SpcSipInfo",
+	"1.3.6.1.4.1.311.2.4.1":  "SpcNestedSignature",
+	"1.3.6.1.4.1.311.3.3.1":  "SpcRFC3161Timestamp",
+	"1.3.6.1.4.1.311.10.3.5": "WHQLCrypto",
+	"1.3.6.1.4.1.311.10.3.6": "ntSystemComponent",
+	"1.3.6.1.4.1.311.61.1.1": "kernelModeCodeSigning",
+	// Digests and signatures
+	"1.2.840.113549.2.5":     "md5",
+	"1.3.14.3.2.26":          "sha1",
+	"2.16.840.1.101.3.4.2.1": "sha256",
+	"2.16.840.1.101.3.4.2.2": "sha384",
+	"2.16.840.1.101.3.4.2.3": "sha512",
+	"1.2.840.113549.1.1.1":   "rsaEncryption",
+	"1.2.840.113549.1.1.4":   "md5WithRSAEncryption",
+	"1.2.840.113549.1.1.5":   "sha1WithRSAEncryption",
+	"1.2.840.113549.1.1.10":  "rsassa-pss",
+	"1.2.840.113549.1.1.11":  "sha256WithRSAEncryption",
+	"1.2.840.113549.1.1.12":  "sha384WithRSAEncryption",
+	"1.2.840.113549.1.1.13":  "sha512WithRSAEncryption",
+	"1.2.840.10045.2.1":      "ecPublicKey",
+	"1.2.840.10045.3.1.7":    "prime256v1",
+	"1.3.132.0.34":           "secp384r1",
+	"1.3.132.0.35":           "secp521r1",
+	"1.2.840.10045.4.1":      "ecdsa-with-SHA1",
+	"1.2.840.10045.4.3.2":    "ecdsa-with-SHA256",
+	"1.2.840.10045.4.3.3":    "ecdsa-with-SHA384",
+	"1.2.840.10045.4.3.4":    "ecdsa-with-SHA512",
+	"1.2.840.10040.4.1":      "dsa",
+	"1.3.101.112":            "ed25519",
+	// Names
+	"2.5.4.3":                  "commonName",
+	"2.5.4.5":                  "serialNumber",
+	"2.5.4.6":                  "countryName",
+	"2.5.4.7":                  "localityName",
+	"2.5.4.8":                  "stateOrProvinceName",
+	"2.5.4.9":                  "streetAddress",
+	"2.5.4.10":                 "organizationName",
+	"2.5.4.11":                 "organizationalUnitName",
+	"2.5.4.15":                 "businessCategory",
+	"1.2.840.113549.1.9.1":     "emailAddress",
+	"1.3.6.1.4.1.311.60.2.1.3": "jurisdictionOfIncorporationCountryName",
+	// Certificate extensions and usages
+	"2.5.29.14":          "subjectKeyIdentifier",
+	"2.5.29.15":          "keyUsage",
+	"2.5.29.17":          "subjectAltName",
+	"2.5.29.19":          "basicConstraints",
+	"2.5.29.31":          "cRLDistributionPoints",
+	"2.5.29.32":          "certificatePolicies",
+	"2.5.29.35":          "authorityKeyIdentifier",
+	"2.5.29.37":          "extKeyUsage",
+	"1.3.6.1.5.5.7.1.1":  "authorityInfoAccess",
+	"1.3.6.1.5.5.7.2.1":  "id-qt-cps",
+	"1.3.6.1.5.5.7.3.3":  "codeSigning",
+	"1.3.6.1.5.5.7.3.8":  "timeStamping",
+	"1.3.6.1.5.5.7.48.1": "ocsp",
+	"1.3.6.1.5.5.7.48.2": "caIssuers",
+	"2.23.140.1.3":       "ev-codesigning",
+	"2.23.140.1.4.1":     "codesigning",
+}
+
+// Universal tags printed by DumpASN1 that encoding/asn1 has no constant for
+const (
+	asn1TagEnum      = 10
+	asn1TagBMPString = 30
+)
+
+// asn1TagNames names the universal tags
+var asn1TagNames = map[int]string{
+	asn1.TagBoolean:         "BOOLEAN",
+	asn1.TagInteger:         "INTEGER",
+	asn1.TagBitString:       "BIT STRING",
+	asn1.TagOctetString:     "OCTET STRING",
+	asn1.TagNull:            "NULL",
+	asn1.TagOID:             "OBJECT IDENTIFIER",
+	asn1TagEnum:             "ENUMERATED",
+	asn1.TagUTF8String:      "UTF8String",
+	asn1.TagSequence:        "SEQUENCE",
+	asn1.TagSet:             "SET",
+	asn1.TagNumericString:   "NumericString",
+	asn1.TagPrintableString: "PrintableString",
+	asn1.TagT61String:       "T61String",
+	asn1.TagIA5String:       "IA5String",
+	asn1.TagUTCTime:         "UTCTime",
+	asn1.TagGeneralizedTime: "GeneralizedTime",
+	asn1.TagGeneralString:   "GeneralString",
+	asn1TagBMPString:        "BMPString",
+}
+
+// maxDumpBytes bounds the bytes of a primitive value DumpASN1 prints
+const maxDumpBytes = 32
+
+// DumpASN1 writes the decoded ASN.1 tree of DER-encoded data, such as the
+// PKCS#7 signature returned by ExtractDigitalSignature.
+//
+// Each line gives the offset of an element, its header and content lengths,
+// its tag and its value, indented by depth. Object identifiers are printed
+// with their names (SpcIndirectDataContent, SpcSpOpusInfo,
+// SpcNestedSignature, the PKCS#9 attributes and the usual algorithms and
+// extensions), and OCTET and BIT STRINGs that hold DER, such as the
+// extensions of certificates, are decoded in place. Trailing zero padding
+// is reported rather than decoded. The tree up to a malformed element is
+// written before the error describing it, so partial output locates the
+// damage.
+//
+// Parameters:
+//   - w: The writer to print the tree to
+//   - data: The DER-encoded data
+//
+// Returns:
+//   - error: Error if data is not valid DER or w fails
+//
+// Example usage:
+//
+//	signature, err := sigtool.ExtractDigitalSignature("signed.exe")
+//	if err != nil {
+//	    return err
+//	}
+//	err = sigtool.DumpASN1(os.Stdout, signature)
+func DumpASN1(w io.Writer, data []byte) error {
+	d := &asn1Dumper{w: w}
+	if err := d.dump(data, 0, 0); err != nil {
+		return err
+	}
+	return d.err
+}
+
+// asn1Dumper writes the tree of DumpASN1, remembering the first write
+// error
+type asn1Dumper struct {
+	w   io.Writer
+	err error
+}
+
+func (d *asn1Dumper) printf(format string, args ...any) {
+	if d.err == nil {
+		_, d.err = fmt.Fprintf(d.w, format, args...)
+	}
+}
+
+// dump writes the elements of data, found at offset, at depth
+func (d *asn1Dumper) dump(data []byte, offset, depth int) error {
+	for len(data) > 0 && d.err == nil {
+		if depth == 0 && len(bytes.Trim(data, "\x00")) == 0 {
+			// Certificate table entries are padded to eight bytes
+			d.printf("%6d: %d bytes of zero padding\n", offset, len(data))
+			return nil
+		}
+		var v asn1.RawValue
+		rest, err := asn1.Unmarshal(data, &v)
+		if err != nil {
+			return fmt.Errorf("malformed ASN.1 at offset %d: %w", offset, err)
+		}
+		header := len(v.FullBytes) - len(v.Bytes)
+		d.printf("%6d: hl=%d l=%4d %s%s", offset, header, len(v.Bytes), strings.Repeat("  ", depth), tagName(v))
+
+		contentOffset := offset + header
+		switch {
+		case v.IsCompound:
+			d.printf("\n")
+			if err := d.dump(v.Bytes, contentOffset, depth+1); err != nil {
+				return err
+			}
+		case v.Class == asn1.ClassUniversal && (v.Tag == asn1.TagOctetString || v.Tag == asn1.TagBitString) && encapsulatesDER(v):
+			skip := 0
+			if v.Tag == asn1.TagBitString {
+				// The unused bits count
+				skip = 1
+			}
+			d.printf(" (encapsulates)\n")
+			if err := d.dump(v.Bytes[skip:], contentOffset+skip, depth+1); err != nil {
+				return err
+			}
+		default:
+			d.printf("%s\n", primitiveValue(v))
+		}
+		offset += len(data) - len(rest)
+		data = rest
+	}
+	return nil
+}
+
+// tagName names the tag of v
+func tagName(v asn1.RawValue) string {
+	switch v.Class {
+	case asn1.ClassUniversal:
+		if name, ok := asn1TagNames[v.Tag]; ok {
+			return name
+		}
+		return fmt.Sprintf("[UNIVERSAL %d]", v.Tag)
+	case asn1.ClassContextSpecific:
+		return fmt.Sprintf("[%d]", v.Tag)
+	case asn1.ClassApplication:
+		return fmt.Sprintf("[APPLICATION %d]", v.Tag)
+	default:
+		return fmt.Sprintf("[PRIVATE %d]", v.Tag)
+	}
+}
+
+// encapsulatesDER reports whether the OCTET or BIT STRING v holds exactly
+// one or more DER SEQUENCEs or SETs
+func encapsulatesDER(v asn1.RawValue) bool {
+	content := v.Bytes
+	if v.Tag == asn1.TagBitString {
+		if len(content) < 1 || content[0] != 0 {
+			return false
+		}
+		content = content[1:]
+	}
+	if len(content) < 2 || (content[0] != 0x30 && content[0] != 0x31) {
+		return false
+	}
+	for len(content) > 0 {
+		var inner asn1.RawValue
+		rest, err := asn1.Unmarshal(content, &inner)
+		if err != nil {
+			return false
+		}
+		content = rest
+	}
+	return true
+}
+
+// primitiveValue formats the value of the primitive element v, with a
+// leading space, or returns an empty string when it has none
+func primitiveValue(v asn1.RawValue) string {
+	if v.Class != asn1.ClassUniversal {
+		return " " + hexValue(v.Bytes)
+	}
+	switch v.Tag {
+	case asn1.TagNull:
+		return ""
+	case asn1.TagBoolean:
+		return fmt.Sprintf(" %t", len(v.Bytes) == 1 && v.Bytes[0] != 0)
+	case asn1.TagInteger, asn1TagEnum:
+		n := new(big.Int).SetBytes(v.Bytes)
+		if len(v.Bytes) > 0 && v.Bytes[0]&0x80 != 0 {
+			n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(8*len(v.Bytes))))
+		}
+		if len(v.Bytes) > 8 {
+			return " 0x" + hex.EncodeToString(v.Bytes)
+		}
+		return " " + n.String()
+	case asn1.TagOID:
+		var oid asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(v.FullBytes, &oid); err != nil {
+			return " " + hexValue(v.Bytes)
+		}
+		if name, ok := asn1Names[oid.String()]; ok {
+			return fmt.Sprintf(" %s (%s)", name, oid)
+		}
+		return " " + oid.String()
+	case asn1.TagUTF8String, asn1.TagPrintableString, asn1.TagIA5String, asn1.TagNumericString, asn1.TagT61String,
+		asn1.TagGeneralString, asn1.TagUTCTime, asn1.TagGeneralizedTime:
+		if utf8.Valid(v.Bytes) {
+			return fmt.Sprintf(" %q", v.Bytes)
+		}
+	case asn1TagBMPString:
+		if len(v.Bytes)%2 == 0 {
+			runes := make([]rune, 0, len(v.Bytes)/2)
+			for i := 0; i < len(v.Bytes); i += 2 {
+				runes = append(runes, rune(v.Bytes[i])<<8|rune(v.Bytes[i+1]))
+			}
+			return fmt.Sprintf(" %q", string(runes))
+		}
+	}
+	return " " + hexValue(v.Bytes)
+}
+
+// hexValue returns b in hexadecimal, truncated to maxDumpBytes
+func hexValue(b []byte) string {
+	if len(b) <= maxDumpBytes {
+		return hex.EncodeToString(b)
+	}
+	return fmt.Sprintf("%s... (%d bytes)", hex.EncodeToString(b[:maxDumpBytes]), len(b))
+}
@@ -0,0 +1,71 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"strings"
+	"testing"
+)
+
+func TestDumpASN1(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+	signature, err := ExtractDigitalSignature(filePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := DumpASN1(&buf, signature); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"     0: hl=4 l=",
+		"OBJECT IDENTIFIER signedData (1.2.840.113549.1.7.2)",
+		"OBJECT IDENTIFIER SpcIndirectDataContent (1.3.6.1.4.1.311.2.1.4)",
+		"OBJECT IDENTIFIER sha256 (2.16.840.1.101.3.4.2.1)",
+		"OBJECT IDENTIFIER messageDigest (1.2.840.113549.1.9.4)",
+		"OBJECT IDENTIFIER commonName (2.5.4.3)",
+		"(encapsulates)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected dump to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestDumpASN1_Malformed(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+	signature, err := ExtractDigitalSignature(filePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Cut the signature inside its certificates, so that the outer
+	// SEQUENCE claims more bytes than remain
+	var buf bytes.Buffer
+	err = DumpASN1(&buf, signature[:len(signature)/2])
+	if err == nil || !strings.Contains(err.Error(), "malformed ASN.1 at offset 0") {
+		t.Errorf("Expected malformed ASN.1 error at offset 0, got: %v", err)
+	}
+
+	// Alignment padding is not an error
+	buf.Reset()
+	if err := DumpASN1(&buf, append(signature, 0, 0, 0)); err != nil {
+		t.Errorf("Expected padded signature to dump, got: %v", err)
+	}
+	if !strings.Contains(buf.String(), "bytes of zero padding") {
+		t.Errorf("Expected padding to be reported, got:\n%s", buf.String())
+	}
+
+	// A valid element followed by garbage is dumped up to the garbage
+	buf.Reset()
+	data := append([]byte{0x05, 0x00}, 0xff)
+	err = DumpASN1(&buf, data)
+	if err == nil || !strings.Contains(err.Error(), "offset 2") {
+		t.Errorf("Expected malformed ASN.1 error at offset 2, got: %v", err)
+	}
+	if !strings.Contains(buf.String(), "NULL") {
+		t.Errorf("Expected the NULL before the garbage to be dumped, got:\n%s", buf.String())
+	}
+}
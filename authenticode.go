@@ -0,0 +1,340 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	// Register the hash implementations referenced by Authenticode digests
+	_ "crypto/md5"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+
+	"go.mozilla.org/pkcs7"
+)
+
+var (
+	// Authenticode content type carried in the PKCS#7 ContentInfo
+	oidSpcIndirectDataContent = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 4}
+
+	// Digest algorithm identifiers found in SpcIndirectDataContent
+	oidDigestMD5    = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 5}
+	oidDigestSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidDigestSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidDigestSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidDigestSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+// spcIndirectDataContent is the Authenticode signed content, binding the
+// signature to a digest of the PE image.
+type spcIndirectDataContent struct {
+	Data          spcAttributeTypeAndOptionalValue
+	MessageDigest digestInfo
+}
+
+type spcAttributeTypeAndOptionalValue struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"optional"`
+}
+
+type digestInfo struct {
+	DigestAlgorithm pkix.AlgorithmIdentifier
+	Digest          []byte
+}
+
+// SignatureBundle holds everything needed to judge the integrity of a signed
+// PE file: the raw signature and both sides of the Authenticode digest check.
+// For other file types only RawSignature is set.
+type SignatureBundle struct {
+	// RawSignature is the PKCS#7 signature extracted from the certificate table
+	RawSignature []byte
+	// StoredDigest is the file digest recorded in the signed SpcIndirectDataContent
+	StoredDigest []byte
+	// StoredAlgorithm is the hash algorithm used for StoredDigest
+	StoredAlgorithm crypto.Hash
+	// ComputedDigest is the Authenticode digest recomputed from the file contents
+	ComputedDigest []byte
+	// DigestMatch reports whether StoredDigest equals ComputedDigest
+	DigestMatch bool
+}
+
+// ExtractWithDigests extracts the digital signature from a signed PE file
+// together with the stored and recomputed Authenticode digests.
+//
+// The file is opened once and the signature, the signed digest and the
+// recomputed digest are all derived from that single handle. A DigestMatch of
+// false means the file contents were modified after signing or the signature
+// was copied from another binary.
+//
+// The digest fields are specific to PE files. For the other file types of
+// DetectFileType the bundle holds only the signature ExtractDigitalSignature
+// returns, with nil digests and a false DigestMatch; Verify checks their
+// content digest.
+//
+// Parameters:
+//   - filePath: The path to the signed file to inspect
+//
+// Returns:
+//   - *SignatureBundle: The signature and, for PE files, digest information
+//   - error: An error if extraction, parsing or hashing fails
+//
+// Example usage:
+//
+//	bundle, err := sigtool.ExtractWithDigests("signed.exe")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	if !bundle.DigestMatch {
+//	    fmt.Println("File was modified after signing")
+//	}
+func ExtractWithDigests(filePath string) (*SignatureBundle, error) {
+	if strings.TrimSpace(filePath) == "" {
+		return nil, errors.New("file path cannot be empty")
+	}
+
+	// #nosec G304 - This tool is designed to read user-specified PE files
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %q: %w", filePath, err)
+	}
+	defer f.Close()
+
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	return extractWithDigests(f, fileInfo.Size())
+}
+
+// extractWithDigests implements ExtractWithDigests on top of random access
+// to the file.
+func extractWithDigests(r io.ReaderAt, size int64) (*SignatureBundle, error) {
+	// Read errors are left to the PE parser to report
+	if fileType, _ := detectFileType(r, size); fileType != FileTypePE && fileType != FileTypeUnknown {
+		sig, err := extractSignature(r, size)
+		if err != nil {
+			return nil, err
+		}
+		return &SignatureBundle{RawSignature: sig}, nil
+	}
+
+	layout, err := readLayout(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := readSignature(r, layout)
+	if err != nil {
+		return nil, err
+	}
+
+	algorithm, stored, err := parseStoredDigest(sig)
+	if err != nil {
+		return nil, err
+	}
+
+	computed, err := authentihash(r, layout, algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignatureBundle{
+		RawSignature:    sig,
+		StoredDigest:    stored,
+		StoredAlgorithm: algorithm,
+		ComputedDigest:  computed,
+		DigestMatch:     bytes.Equal(stored, computed),
+	}, nil
+}
+
+// ComputeAuthentihash computes the Authenticode digest ("authentihash") of a
+// PE file using the given hash algorithm.
+//
+// The digest follows the Authenticode hashing rules for both PE32 and PE32+
+// images: the optional header CheckSum field, the security data directory
+// entry and the certificate table are excluded, and everything else up to the
+// certificate table (or the end of the file for unsigned images) is hashed.
+// The file does not need to be signed, which makes this useful for
+// threat-intelligence pivoting on unsigned samples.
+//
+// Parameters:
+//   - filePath: The path to the PE file to hash
+//   - h: The hash algorithm, such as crypto.SHA1 or crypto.SHA256
+//
+// Returns:
+//   - []byte: The Authenticode digest
+//   - error: An error if the file cannot be read or parsed
+//
+// Example usage:
+//
+//	digest, err := sigtool.ComputeAuthentihash("sample.exe", crypto.SHA256)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	fmt.Printf("authentihash: %x\n", digest)
+func ComputeAuthentihash(filePath string, h crypto.Hash) ([]byte, error) {
+	if strings.TrimSpace(filePath) == "" {
+		return nil, errors.New("file path cannot be empty")
+	}
+
+	// #nosec G304 - This tool is designed to read user-specified PE files
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %q: %w", filePath, err)
+	}
+	defer f.Close()
+
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	layout, err := readLayout(f, fileInfo.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	return authentihash(f, layout, h)
+}
+
+// parseStoredDigest returns the file digest and its algorithm from the
+// SpcIndirectDataContent of an Authenticode signature.
+func parseStoredDigest(signature []byte) (crypto.Hash, []byte, error) {
+	p7, err := parsePKCS7(signature)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to parse PKCS#7 signature: %w", err)
+	}
+
+	return storedDigest(p7)
+}
+
+// storedDigest returns the file digest and its algorithm from an already
+// parsed Authenticode signature, or the package content hash of a NuGet
+// package signature. For detached signatures, such as Mach-O code
+// signatures, whose content is not embedded, it returns the signed
+// messageDigest attribute and the signer digest algorithm; detached
+// signatures without signed attributes, such as kernel module signatures,
+// sign the content itself and have no digest to return.
+func storedDigest(p7 *pkcs7.PKCS7) (crypto.Hash, []byte, error) {
+	if isNuGetSignatureContent(p7.Content) {
+		return parseNuGetSignatureContent(p7.Content)
+	}
+	if len(p7.Content) == 0 && len(p7.Signers) > 0 {
+		var messageDigest []byte
+		err := p7.UnmarshalSignedAttribute(oidAttributeMessageDigest, &messageDigest)
+		if err == nil || len(p7.Signers[0].AuthenticatedAttributes) == 0 {
+			algorithm, err := hashForOID(p7.Signers[0].DigestAlgorithm.Algorithm)
+			if err != nil {
+				return 0, nil, err
+			}
+			return algorithm, messageDigest, nil
+		}
+	}
+	idc, err := parseIndirectData(p7.Content)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	algorithm, err := hashForOID(idc.MessageDigest.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return algorithm, idc.MessageDigest.Digest, nil
+}
+
+// parseIndirectData decodes SpcIndirectDataContent from the content of a
+// parsed PKCS#7 structure. The pkcs7 package strips the outer SEQUENCE
+// header, so it is restored before unmarshalling.
+func parseIndirectData(content []byte) (*spcIndirectDataContent, error) {
+	if len(content) == 0 {
+		return nil, errors.New("signature has no SpcIndirectDataContent")
+	}
+
+	der, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: content})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode SpcIndirectDataContent: %w", err)
+	}
+
+	var idc spcIndirectDataContent
+	rest, err := asn1.Unmarshal(der, &idc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SpcIndirectDataContent: %w", err)
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("trailing data after SpcIndirectDataContent")
+	}
+
+	return &idc, nil
+}
+
+// hashForOID maps a digest algorithm identifier to a crypto.Hash.
+func hashForOID(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case oid.Equal(oidDigestMD5):
+		return crypto.MD5, nil
+	case oid.Equal(oidDigestSHA1):
+		return crypto.SHA1, nil
+	case oid.Equal(oidDigestSHA256):
+		return crypto.SHA256, nil
+	case oid.Equal(oidDigestSHA384):
+		return crypto.SHA384, nil
+	case oid.Equal(oidDigestSHA512):
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("unsupported digest algorithm %s", oid)
+}
+
+// authentihash computes the Authenticode digest of the PE image described by
+// layout. The checksum field, the security directory entry and the
+// certificate table are excluded from the hash.
+func authentihash(r io.ReaderAt, layout *peLayout, algorithm crypto.Hash) ([]byte, error) {
+	if !algorithm.Available() {
+		return nil, fmt.Errorf("hash algorithm %v is not available", algorithm)
+	}
+
+	ranges, err := authentihashRanges(layout)
+	if err != nil {
+		return nil, err
+	}
+
+	h := algorithm.New()
+	for _, rng := range ranges {
+		if _, err := io.Copy(h, io.NewSectionReader(r, rng[0], rng[1]-rng[0])); err != nil {
+			return nil, fmt.Errorf("failed to hash file contents: %w", err)
+		}
+	}
+
+	return h.Sum(nil), nil
+}
+
+// authentihashRanges returns the ascending [start, end) byte ranges of the
+// PE image described by layout that the Authenticode digest covers
+func authentihashRanges(layout *peLayout) ([][2]int64, error) {
+	end := layout.size
+	if layout.certTableSize > 0 {
+		end = layout.certTableOffset
+	}
+	if end > layout.size || layout.checksumOffset+4 > end || !layout.noSecurityDir && layout.securityDirOffset+8 > end {
+		return nil, fmt.Errorf("invalid certificate table offset %d in file of size %d", end, layout.size)
+	}
+
+	if layout.noSecurityDir {
+		// Only the checksum is excluded from images without a security
+		// directory entry
+		return [][2]int64{{0, layout.checksumOffset}, {layout.checksumOffset + 4, end}}, nil
+	}
+	return [][2]int64{
+		{0, layout.checksumOffset},
+		{layout.checksumOffset + 4, layout.securityDirOffset},
+		{layout.securityDirOffset + 8, end},
+	}, nil
+}
@@ -0,0 +1,690 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Offsets within the PE32 image produced by mockPEImage
+const (
+	mockOptHeaderOffset = 88
+	mockChecksumOffset  = mockOptHeaderOffset + 64
+	mockSecDirOffset    = mockOptHeaderOffset + 96 + 4*8
+	mockHeaderSize      = 64 + 4 + 20 + 224
+)
+
+var (
+	testCertOnce sync.Once
+	testCert     *x509.Certificate
+	testKey      *rsa.PrivateKey
+)
+
+// testSigner returns a cached self-signed code signing certificate and key
+func testSigner(t testing.TB) (*x509.Certificate, *rsa.PrivateKey) {
+	t.Helper()
+
+	testCertOnce.Do(func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("Failed to generate key: %v", err)
+		}
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(1001),
+			Subject:               pkix.Name{CommonName: "sigtool test signer", Organization: []string{"sigtool"}},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(24 * time.Hour),
+			KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+			ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning, x509.ExtKeyUsageTimeStamping},
+			BasicConstraintsValid: true,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			t.Fatalf("Failed to create certificate: %v", err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatalf("Failed to parse certificate: %v", err)
+		}
+		testCert, testKey = cert, key
+	})
+
+	if testCert == nil {
+		t.Fatal("Test signer is unavailable")
+	}
+	return testCert, testKey
+}
+
+// mockPEImage builds a minimal unsigned PE32 image followed by payload
+func mockPEImage(payload []byte) []byte {
+	content := make([]byte, mockHeaderSize+len(payload))
+
+	copy(content[0:2], "MZ")
+	binary.LittleEndian.PutUint32(content[60:], 64)
+	copy(content[64:68], "PE\x00\x00")
+	binary.LittleEndian.PutUint16(content[68:], 0x014c)
+	binary.LittleEndian.PutUint16(content[84:], 224)
+	binary.LittleEndian.PutUint16(content[mockOptHeaderOffset:], 0x010b)
+	binary.LittleEndian.PutUint32(content[mockOptHeaderOffset+92:], 16)
+
+	copy(content[mockHeaderSize:], payload)
+	return content
+}
+
+// mockAuthentihash hashes an unsigned mock image the way Authenticode does
+func mockAuthentihash(image []byte, h crypto.Hash) []byte {
+	d := h.New()
+	d.Write(image[:mockChecksumOffset])
+	d.Write(image[mockChecksumOffset+4 : mockSecDirOffset])
+	d.Write(image[mockSecDirOffset+8:])
+	return d.Sum(nil)
+}
+
+type testContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type testIssuerAndSerial struct {
+	IssuerName   asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type testAttribute struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+type testSignerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     testIssuerAndSerial
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   []testAttribute `asn1:"optional,omitempty,tag:0"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+	UnauthenticatedAttributes []testAttribute `asn1:"optional,omitempty,tag:1"`
+}
+
+type testSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      testContentInfo
+	Certificates     asn1.RawValue    `asn1:"optional,tag:0"`
+	SignerInfos      []testSignerInfo `asn1:"set"`
+}
+
+// signAuthenticodeForTest builds an Authenticode PKCS#7 signature over digest.
+// Each mutator is applied to the finished SignerInfo, e.g. to add unsigned attributes.
+func signAuthenticodeForTest(t testing.TB, digest []byte, h crypto.Hash, mutators ...func(*testSignerInfo)) []byte {
+	t.Helper()
+
+	cert, key := testSigner(t)
+	return signAuthenticodeAsForTest(t, &testIdentity{Cert: cert, Key: key}, digest, h, mutators...)
+}
+
+// testIdentity is a signing certificate, its key and the extra certificates
+// embedded alongside it in signatures
+type testIdentity struct {
+	Cert  *x509.Certificate
+	Key   *rsa.PrivateKey
+	Chain []*x509.Certificate
+}
+
+// issueCertificateForTest creates a certificate from template issued by
+// parent, or self-signed when parent is nil. The returned identity embeds
+// the parent certificate and its chain, excluding self-signed roots.
+func issueCertificateForTest(t testing.TB, template *x509.Certificate, parent *testIdentity) *testIdentity {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	if template.NotBefore.IsZero() {
+		template.NotBefore = time.Now().Add(-time.Hour)
+	}
+	if template.NotAfter.IsZero() {
+		template.NotAfter = time.Now().Add(24 * time.Hour)
+	}
+
+	issuer, issuerKey := template, key
+	var chain []*x509.Certificate
+	if parent != nil {
+		issuer, issuerKey = parent.Cert, parent.Key
+		chain = append(chain, parent.Chain...)
+		if !bytes.Equal(parent.Cert.RawIssuer, parent.Cert.RawSubject) {
+			chain = append([]*x509.Certificate{parent.Cert}, chain...)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	return &testIdentity{Cert: cert, Key: key, Chain: chain}
+}
+
+// testCATemplate returns a CA certificate template named cn
+func testCATemplate(cn string, serial int64) *x509.Certificate {
+	return &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: cn, Organization: []string{"sigtool"}},
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+}
+
+// testLeafTemplate returns an end-entity certificate template named cn
+// carrying ekus
+func testLeafTemplate(cn string, serial int64, ekus ...x509.ExtKeyUsage) *x509.Certificate {
+	return &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{"sigtool"}},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  ekus,
+	}
+}
+
+// signAuthenticodeAsForTest is signAuthenticodeForTest signing as id
+func signAuthenticodeAsForTest(t testing.TB, id *testIdentity, digest []byte, h crypto.Hash, mutators ...func(*testSignerInfo)) []byte {
+	t.Helper()
+
+	cert := id.Cert
+	digestOID := map[crypto.Hash]asn1.ObjectIdentifier{
+		crypto.SHA1:   oidDigestSHA1,
+		crypto.SHA256: oidDigestSHA256,
+	}[h]
+	algID := pkix.AlgorithmIdentifier{Algorithm: digestOID, Parameters: asn1.NullRawValue}
+
+	idc, err := asn1.Marshal(spcIndirectDataContent{
+		Data: spcAttributeTypeAndOptionalValue{
+			Type: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 15},
+		},
+		MessageDigest: digestInfo{DigestAlgorithm: algID, Digest: digest},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal SpcIndirectDataContent: %v", err)
+	}
+
+	// The messageDigest attribute covers the content without its SEQUENCE header
+	var idcValue asn1.RawValue
+	if _, err := asn1.Unmarshal(idc, &idcValue); err != nil {
+		t.Fatalf("Failed to decode SpcIndirectDataContent: %v", err)
+	}
+	contentHash := h.New()
+	contentHash.Write(idcValue.Bytes)
+
+	attrs := []testAttribute{
+		testAttr(t, oidAttributeContentType, oidSpcIndirectDataContent),
+		testAttr(t, oidAttributeMessageDigest, contentHash.Sum(nil)),
+	}
+	signature := signAttributesWithKeyForTest(t, attrs, h, id.Key)
+
+	si := testSignerInfo{
+		Version: 1,
+		IssuerAndSerialNumber: testIssuerAndSerial{
+			IssuerName:   asn1.RawValue{FullBytes: cert.RawIssuer},
+			SerialNumber: cert.SerialNumber,
+		},
+		DigestAlgorithm:         algID,
+		AuthenticatedAttributes: attrs,
+		DigestEncryptionAlgorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1},
+			Parameters: asn1.NullRawValue,
+		},
+		EncryptedDigest: signature,
+	}
+	for _, mutate := range mutators {
+		mutate(&si)
+	}
+
+	certs := append([]byte(nil), cert.Raw...)
+	for _, c := range id.Chain {
+		certs = append(certs, c.Raw...)
+	}
+
+	sd, err := asn1.Marshal(testSignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{algID},
+		ContentInfo: testContentInfo{
+			ContentType: oidSpcIndirectDataContent,
+			Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: idc},
+		},
+		Certificates: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs},
+		SignerInfos:  []testSignerInfo{si},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal SignedData: %v", err)
+	}
+
+	p7, err := asn1.Marshal(testContentInfo{
+		ContentType: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2},
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal ContentInfo: %v", err)
+	}
+	return p7
+}
+
+// testAttr encodes a single-valued PKCS#7 attribute
+func testAttr(t testing.TB, oid asn1.ObjectIdentifier, value interface{}) testAttribute {
+	t.Helper()
+
+	der, err := asn1.Marshal(value)
+	if err != nil {
+		t.Fatalf("Failed to marshal attribute: %v", err)
+	}
+	return testAttribute{Type: oid, Value: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: der}}
+}
+
+// signAttributesForTest signs the DER SET OF attrs with the test key
+func signAttributesForTest(t testing.TB, attrs []testAttribute, h crypto.Hash) []byte {
+	t.Helper()
+
+	_, key := testSigner(t)
+	return signAttributesWithKeyForTest(t, attrs, h, key)
+}
+
+// signAttributesWithKeyForTest is signAttributesForTest with a custom key
+func signAttributesWithKeyForTest(t testing.TB, attrs []testAttribute, h crypto.Hash, key *rsa.PrivateKey) []byte {
+	t.Helper()
+
+	encoded, err := asn1.Marshal(struct {
+		A []testAttribute `asn1:"set"`
+	}{A: attrs})
+	if err != nil {
+		t.Fatalf("Failed to marshal attributes: %v", err)
+	}
+	var signed asn1.RawValue
+	if _, err := asn1.Unmarshal(encoded, &signed); err != nil {
+		t.Fatalf("Failed to decode attributes: %v", err)
+	}
+	attrHash := h.New()
+	attrHash.Write(signed.Bytes)
+	signature, err := key.Sign(rand.Reader, attrHash.Sum(nil), h)
+	if err != nil {
+		t.Fatalf("Failed to sign attributes: %v", err)
+	}
+	return signature
+}
+
+// withCounterSignature adds a legacy PKCS#9 countersignature asserting when
+func withCounterSignature(t testing.TB, when time.Time) func(*testSignerInfo) {
+	return func(si *testSignerInfo) {
+		t.Helper()
+		si.UnauthenticatedAttributes = append(si.UnauthenticatedAttributes,
+			counterSignatureForTest(t, si, si.EncryptedDigest, crypto.SHA256, when))
+	}
+}
+
+// counterSignatureForTest builds a countersignature attribute by the signer
+// of si over data asserting when
+func counterSignatureForTest(t testing.TB, si *testSignerInfo, data []byte, h crypto.Hash, when time.Time) testAttribute {
+	t.Helper()
+
+	digestOID := map[crypto.Hash]asn1.ObjectIdentifier{
+		crypto.SHA1:   oidDigestSHA1,
+		crypto.SHA256: oidDigestSHA256,
+	}[h]
+	digest := h.New()
+	digest.Write(data)
+	attrs := []testAttribute{
+		testAttr(t, oidAttributeContentType, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}),
+		testAttr(t, oidAttributeSigningTime, when.UTC()),
+		testAttr(t, oidAttributeMessageDigest, digest.Sum(nil)),
+	}
+	cs := testSignerInfo{
+		Version:                 1,
+		IssuerAndSerialNumber:   si.IssuerAndSerialNumber,
+		DigestAlgorithm:         pkix.AlgorithmIdentifier{Algorithm: digestOID, Parameters: asn1.NullRawValue},
+		AuthenticatedAttributes: attrs,
+		DigestEncryptionAlgorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1},
+			Parameters: asn1.NullRawValue,
+		},
+		EncryptedDigest: signAttributesForTest(t, attrs, h),
+	}
+	return testAttr(t, oidCounterSignature, cs)
+}
+
+// withAuthenticatedAttribute adds attr to the authenticated attributes and
+// re-signs them with the test signer key
+func withAuthenticatedAttribute(t testing.TB, attr testAttribute) func(*testSignerInfo) {
+	return func(si *testSignerInfo) {
+		t.Helper()
+
+		h, err := hashForOID(si.DigestAlgorithm.Algorithm)
+		if err != nil {
+			t.Fatalf("Unsupported digest algorithm: %v", err)
+		}
+		si.AuthenticatedAttributes = append(si.AuthenticatedAttributes, attr)
+		si.EncryptedDigest = signAttributesForTest(t, si.AuthenticatedAttributes, h)
+	}
+}
+
+// withNestedSignature stores signature in the nested-signature attribute
+func withNestedSignature(t testing.TB, signature []byte) func(*testSignerInfo) {
+	return func(si *testSignerInfo) {
+		t.Helper()
+		si.UnauthenticatedAttributes = append(si.UnauthenticatedAttributes,
+			testAttr(t, oidNestedSignature, asn1.RawValue{FullBytes: signature}))
+	}
+}
+
+// embedSignatureForTest appends signature to an unsigned mock image as a
+// WIN_CERTIFICATE entry and points the security directory at it
+func embedSignatureForTest(image, signature []byte) []byte {
+	length := 8 + len(signature)
+	padded := (length + 7) &^ 7
+
+	out := make([]byte, len(image)+padded)
+	copy(out, image)
+	binary.LittleEndian.PutUint32(out[mockSecDirOffset:], uint32(len(image)))
+	binary.LittleEndian.PutUint32(out[mockSecDirOffset+4:], uint32(padded))
+
+	entry := out[len(image):]
+	binary.LittleEndian.PutUint32(entry, uint32(length))
+	binary.LittleEndian.PutUint16(entry[4:], 0x0200)
+	binary.LittleEndian.PutUint16(entry[6:], 0x0002)
+	copy(entry[8:], signature)
+	return out
+}
+
+// createSignedMockPE writes a mock PE file carrying a genuine Authenticode
+// signature over its contents and returns the path and the image digest
+func createSignedMockPE(t testing.TB, h crypto.Hash) (string, []byte) {
+	t.Helper()
+	return createSignedMockPEWithPayload(t, h, bytes.Repeat([]byte("sigtool-section-data"), 16))
+}
+
+// createSignedMockPEAs is createSignedMockPE signing as id
+func createSignedMockPEAs(t testing.TB, id *testIdentity, h crypto.Hash, mutators ...func(*testSignerInfo)) string {
+	t.Helper()
+
+	image := mockPEImage(bytes.Repeat([]byte("sigtool-section-data"), 16))
+	signed := embedSignatureForTest(image, signAuthenticodeAsForTest(t, id, mockAuthentihash(image, h), h, mutators...))
+
+	filePath := filepath.Join(t.TempDir(), "signed.exe")
+	if err := os.WriteFile(filePath, signed, 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	return filePath
+}
+
+// createSignedMockPEWithPayload is createSignedMockPE with custom image
+// contents and optional signer info mutators
+func createSignedMockPEWithPayload(t testing.TB, h crypto.Hash, payload []byte, mutators ...func(*testSignerInfo)) (string, []byte) {
+	t.Helper()
+
+	image := mockPEImage(payload)
+	digest := mockAuthentihash(image, h)
+	signed := embedSignatureForTest(image, signAuthenticodeForTest(t, digest, h, mutators...))
+
+	filePath := filepath.Join(t.TempDir(), "signed.exe")
+	if err := os.WriteFile(filePath, signed, 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	return filePath, digest
+}
+
+func TestExtractWithDigests_ValidSignature(t *testing.T) {
+	for _, h := range []crypto.Hash{crypto.SHA1, crypto.SHA256} {
+		filePath, digest := createSignedMockPE(t, h)
+
+		bundle, err := ExtractWithDigests(filePath)
+		if err != nil {
+			t.Fatalf("%v: expected no error, got: %v", h, err)
+		}
+
+		if bundle.StoredAlgorithm != h {
+			t.Errorf("Expected stored algorithm %v, got %v", h, bundle.StoredAlgorithm)
+		}
+		if !bytes.Equal(bundle.StoredDigest, digest) {
+			t.Errorf("Expected stored digest %x, got %x", digest, bundle.StoredDigest)
+		}
+		if !bytes.Equal(bundle.ComputedDigest, digest) {
+			t.Errorf("Expected computed digest %x, got %x", digest, bundle.ComputedDigest)
+		}
+		if !bundle.DigestMatch {
+			t.Error("Expected digests to match")
+		}
+		if len(bundle.RawSignature) == 0 {
+			t.Error("Expected raw signature data")
+		}
+	}
+}
+
+func TestVerifySignatureBytes_ValidSignature(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	signature, err := ExtractDigitalSignatureFromBytes(content)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if err := VerifySignatureBytes(signature); err != nil {
+		t.Errorf("Expected valid signature, got: %v", err)
+	}
+	if err := IsValidDigitalSignature(filePath); err != nil {
+		t.Errorf("Expected valid signature, got: %v", err)
+	}
+}
+
+func TestIsValidDigitalSignature_CopiedSignature(t *testing.T) {
+	donor, _ := createSignedMockPE(t, crypto.SHA256)
+	signature, err := ExtractDigitalSignature(donor)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Graft the donor's valid signature onto a different image
+	thief := filepath.Join(t.TempDir(), "thief.exe")
+	image := embedSignatureForTest(mockPEImage([]byte("different-payload")), signature)
+	if err := os.WriteFile(thief, image, 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	// The PKCS#7 blob on its own still verifies
+	if err := VerifySignatureBytes(signature); err != nil {
+		t.Fatalf("Expected signature blob to verify, got: %v", err)
+	}
+
+	err = IsValidDigitalSignature(thief)
+	if !errors.Is(err, ErrDigestMismatch) {
+		t.Fatalf("Expected ErrDigestMismatch, got: %v", err)
+	}
+	var mismatch *DigestMismatchError
+	if !errors.As(err, &mismatch) || mismatch.Algorithm != crypto.SHA256 {
+		t.Errorf("Expected *DigestMismatchError for SHA-256, got: %v", err)
+	}
+}
+
+func TestExtractWithDigests_ModifiedContent(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	content[mockHeaderSize] ^= 0xff
+	if err := os.WriteFile(filePath, content, 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	bundle, err := ExtractWithDigests(filePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if bundle.DigestMatch {
+		t.Error("Expected digest mismatch for modified file")
+	}
+}
+
+func TestExtractWithDigests_ChecksumIgnored(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	binary.LittleEndian.PutUint32(content[mockChecksumOffset:], 0xdeadbeef)
+	if err := os.WriteFile(filePath, content, 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	bundle, err := ExtractWithDigests(filePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !bundle.DigestMatch {
+		t.Error("Expected checksum changes to be excluded from the digest")
+	}
+}
+
+func TestExtractWithDigests_Errors(t *testing.T) {
+	if _, err := ExtractWithDigests(" "); err == nil || !strings.Contains(err.Error(), "cannot be empty") {
+		t.Errorf("Expected 'cannot be empty' error, got: %v", err)
+	}
+
+	unsigned := createMockPEFile(t, false, nil)
+	if _, err := ExtractWithDigests(unsigned); err == nil || !strings.Contains(err.Error(), "not digitally signed") {
+		t.Errorf("Expected 'not digitally signed' error, got: %v", err)
+	}
+
+	invalid := createMockPEFile(t, true, []byte("invalid-pkcs7-data"))
+	if _, err := ExtractWithDigests(invalid); err == nil || !strings.Contains(err.Error(), "failed to parse PKCS#7") {
+		t.Errorf("Expected 'failed to parse PKCS#7' error, got: %v", err)
+	}
+}
+
+func TestExtractWithDigests_OtherFileTypes(t *testing.T) {
+	cab := signCabinetForTest(t, cabinetFilesForTest(t, []zipMemberForTest{{"setup.exe", []byte("setup")}}, false))
+	for name, filePath := range map[string]string{
+		"msi": writeSignedMSIForTest(t, false),
+		"cab": writeContainerForTest(t, "setup.cab", cab),
+	} {
+		t.Run(name, func(t *testing.T) {
+			want, err := ExtractDigitalSignature(filePath)
+			if err != nil {
+				t.Fatalf("ExtractDigitalSignature failed: %v", err)
+			}
+			bundle, err := ExtractWithDigests(filePath)
+			if err != nil {
+				t.Fatalf("Expected the %s signature, got: %v", name, err)
+			}
+			if !bytes.Equal(bundle.RawSignature, want) {
+				t.Error("Expected the same signature as ExtractDigitalSignature")
+			}
+			if bundle.StoredDigest != nil || bundle.ComputedDigest != nil || bundle.DigestMatch {
+				t.Errorf("Expected no Authenticode digests, got %+v", bundle)
+			}
+		})
+	}
+}
+
+// mockPE32PlusImage builds a minimal unsigned PE32+ image followed by payload
+func mockPE32PlusImage(payload []byte) []byte {
+	const optHeaderSize = 240
+	headerSize := 64 + 4 + 20 + optHeaderSize
+	content := make([]byte, headerSize+len(payload))
+
+	copy(content[0:2], "MZ")
+	binary.LittleEndian.PutUint32(content[60:], 64)
+	copy(content[64:68], "PE\x00\x00")
+	binary.LittleEndian.PutUint16(content[68:], 0x8664)
+	binary.LittleEndian.PutUint16(content[84:], optHeaderSize)
+	binary.LittleEndian.PutUint16(content[mockOptHeaderOffset:], 0x020b)
+	binary.LittleEndian.PutUint32(content[mockOptHeaderOffset+108:], 16)
+
+	copy(content[headerSize:], payload)
+	return content
+}
+
+func TestComputeAuthentihash_PE32(t *testing.T) {
+	image := mockPEImage([]byte("unsigned-payload"))
+	filePath := filepath.Join(t.TempDir(), "unsigned.exe")
+	if err := os.WriteFile(filePath, image, 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	for _, h := range []crypto.Hash{crypto.SHA1, crypto.SHA256} {
+		digest, err := ComputeAuthentihash(filePath, h)
+		if err != nil {
+			t.Fatalf("%v: expected no error, got: %v", h, err)
+		}
+		if expected := mockAuthentihash(image, h); !bytes.Equal(digest, expected) {
+			t.Errorf("%v: expected %x, got %x", h, expected, digest)
+		}
+	}
+}
+
+func TestComputeAuthentihash_PE32Plus(t *testing.T) {
+	image := mockPE32PlusImage([]byte("unsigned-payload"))
+	filePath := filepath.Join(t.TempDir(), "unsigned64.exe")
+	if err := os.WriteFile(filePath, image, 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	// PE32+ has a larger optional header, moving the security directory entry
+	const checksum = mockOptHeaderOffset + 64
+	const secDir = mockOptHeaderOffset + 112 + 4*8
+	d := crypto.SHA256.New()
+	d.Write(image[:checksum])
+	d.Write(image[checksum+4 : secDir])
+	d.Write(image[secDir+8:])
+	expected := d.Sum(nil)
+
+	digest, err := ComputeAuthentihash(filePath, crypto.SHA256)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !bytes.Equal(digest, expected) {
+		t.Errorf("Expected %x, got %x", expected, digest)
+	}
+}
+
+func TestComputeAuthentihash_SignedMatchesStoredDigest(t *testing.T) {
+	filePath, expected := createSignedMockPE(t, crypto.SHA256)
+
+	digest, err := ComputeAuthentihash(filePath, crypto.SHA256)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !bytes.Equal(digest, expected) {
+		t.Errorf("Expected certificate table to be excluded: want %x, got %x", expected, digest)
+	}
+}
+
+func TestComputeAuthentihash_Errors(t *testing.T) {
+	if _, err := ComputeAuthentihash("", crypto.SHA256); err == nil {
+		t.Error("Expected error for empty path, got nil")
+	}
+
+	filePath := createMockPEFile(t, false, nil)
+	if _, err := ComputeAuthentihash(filePath, crypto.Hash(0)); err == nil {
+		t.Error("Expected error for unavailable hash, got nil")
+	}
+}
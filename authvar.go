@@ -0,0 +1,221 @@
+package sigtool
+
+import (
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"time"
+
+	"go.mozilla.org/pkcs7"
+)
+
+// Authenticated variable updates start with an EFI_VARIABLE_AUTHENTICATION_2
+// descriptor: an EFI_TIME and a WIN_CERTIFICATE_UEFI_GUID holding the
+// PKCS#7 signature
+const (
+	efiTimeSize = 16
+	// winCertTypeEFIGUID is the wCertificateType of WIN_CERTIFICATE_UEFI_GUID
+	winCertTypeEFIGUID uint16 = 0x0ef1
+	// efiVariableAuthHeaderSize is the size of the descriptor up to the
+	// certificate data
+	efiVariableAuthHeaderSize = efiTimeSize + winCertificateHeaderLength + len(GUID{})
+)
+
+// Attributes of EFI variables read from efivarfs
+const (
+	efiVariableNonVolatile       = 0x01
+	efiVariableBootServiceAccess = 0x02
+	efiVariableRuntimeAccess     = 0x04
+	// efiVariableAttributesMask covers every attribute the UEFI
+	// specification defines
+	efiVariableAttributesMask = 0x7f
+)
+
+// efiCertTypePKCS7GUID is the CertType of WIN_CERTIFICATE_UEFI_GUID
+// holding a PKCS#7 SignedData
+var efiCertTypePKCS7GUID = mustParseGUID("4aafd29d-68df-49ee-8aa9-347d375665a7")
+
+// SignatureDatabase is the contents of a Secure Boot signature database
+// file as LoadSignatureDatabase reads it.
+type SignatureDatabase struct {
+	// Lists are the signature lists of the variable
+	Lists []EFISignatureList
+	// Attributes are the EFI variable attributes efivarfs files start
+	// with, and zero for other files
+	Attributes uint32
+	// Update describes the authentication descriptor of an authenticated
+	// variable update (.auth), and is nil for other files
+	Update *VariableAuthentication
+}
+
+// VariableAuthentication is the EFI_VARIABLE_AUTHENTICATION_2 descriptor of
+// an update to a time-based authenticated variable, such as db or dbx.
+type VariableAuthentication struct {
+	// Timestamp is the time of the update, which firmware requires to be
+	// later than that of the current variable
+	Timestamp time.Time
+	// Signature is the DER PKCS#7 SignedData by a KEK or PK key over the
+	// variable name, vendor GUID, attributes, timestamp and data; empty
+	// when the update is not signed
+	Signature []byte
+	// Signer describes the certificate of the signer when it is embedded
+	Signer *CertificateInfo
+	// Certificates describes every certificate embedded in the signature
+	Certificates []CertificateInfo
+}
+
+// ParseSignatureDatabase parses the contents of a Secure Boot signature
+// database file: signature lists as .esl files hold them, an authenticated
+// variable update (.auth), as signed db and dbx updates are distributed,
+// or a variable read from efivarfs, whose data follows the 4-byte variable
+// attributes.
+//
+// The signature of an update is decoded, not verified: firmware checks it
+// against the KEK or PK, which depends on the variable being written.
+//
+// Parameters:
+//   - data: The file contents
+//
+// Returns:
+//   - *SignatureDatabase: The signature lists and the update descriptor or
+//     variable attributes
+//   - error: An error if the file is malformed
+//
+// Example usage:
+//
+//	data, _ := os.ReadFile("DBXUpdate.bin")
+//	db, err := sigtool.ParseSignatureDatabase(data)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	if db.Update != nil && db.Update.Signer != nil {
+//	    fmt.Println("signed by", db.Update.Signer.Subject)
+//	}
+func ParseSignatureDatabase(data []byte) (*SignatureDatabase, error) {
+	db := &SignatureDatabase{}
+	switch {
+	case isVariableAuthentication(data):
+		update, length, err := parseVariableAuthentication(data)
+		if err != nil {
+			return nil, err
+		}
+		db.Update, data = update, data[length:]
+	case isEFIVariable(data):
+		db.Attributes, data = binary.LittleEndian.Uint32(data), data[4:]
+	}
+	lists, err := ParseSignatureLists(data)
+	if err != nil {
+		return nil, err
+	}
+	db.Lists = lists
+	return db, nil
+}
+
+// LoadSignatureDatabase reads a Secure Boot signature database file with
+// ParseSignatureDatabase.
+//
+// Parameters:
+//   - filePath: The path to the .esl, .auth or efivarfs file
+//
+// Returns:
+//   - *SignatureDatabase: The signature lists and the update descriptor or
+//     variable attributes
+//   - error: An error if the file cannot be read or is malformed
+//
+// Example usage:
+//
+//	db, err := sigtool.LoadSignatureDatabase("/sys/firmware/efi/efivars/db-d719b2cb-3d3a-4596-a3bc-dad00e67656f")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	for _, l := range db.Lists {
+//	    fmt.Printf("%s: %d entries\n", l.TypeName(), len(l.Signatures))
+//	}
+func LoadSignatureDatabase(filePath string) (*SignatureDatabase, error) {
+	// #nosec G304
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signature database: %w", err)
+	}
+	db, err := ParseSignatureDatabase(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	return db, nil
+}
+
+// isVariableAuthentication reports whether data starts with an
+// EFI_VARIABLE_AUTHENTICATION_2 descriptor
+func isVariableAuthentication(data []byte) bool {
+	if len(data) < efiVariableAuthHeaderSize {
+		return false
+	}
+	return binary.LittleEndian.Uint16(data[efiTimeSize+4:]) == WinCertRevision2_0 &&
+		binary.LittleEndian.Uint16(data[efiTimeSize+6:]) == winCertTypeEFIGUID
+}
+
+// isEFIVariable reports whether data starts with the attributes of a
+// persistent variable readable at runtime, as efivarfs files do. Signature
+// lists start with a type GUID none of whose well-known values looks so.
+func isEFIVariable(data []byte) bool {
+	if len(data) < 4 {
+		return false
+	}
+	const required = efiVariableNonVolatile | efiVariableBootServiceAccess | efiVariableRuntimeAccess
+	attributes := binary.LittleEndian.Uint32(data)
+	return attributes&^efiVariableAttributesMask == 0 && attributes&required == required
+}
+
+// parseVariableAuthentication decodes the EFI_VARIABLE_AUTHENTICATION_2
+// descriptor data starts with and returns its length
+func parseVariableAuthentication(data []byte) (*VariableAuthentication, int, error) {
+	length := int64(binary.LittleEndian.Uint32(data[efiTimeSize:]))
+	if length < int64(efiVariableAuthHeaderSize-efiTimeSize) || length > int64(len(data)-efiTimeSize) {
+		return nil, 0, fmt.Errorf("authenticated variable has invalid certificate length %d", length)
+	}
+	var certType GUID
+	copy(certType[:], data[efiTimeSize+winCertificateHeaderLength:])
+	if certType != efiCertTypePKCS7GUID {
+		return nil, 0, fmt.Errorf("unsupported authenticated variable certificate type %s", certType)
+	}
+
+	update := &VariableAuthentication{
+		Timestamp: efiTime(data[:efiTimeSize]),
+		Signature: data[efiVariableAuthHeaderSize : efiTimeSize+length],
+	}
+	if len(update.Signature) > 0 {
+		p7, err := parseVariableSignature(update.Signature)
+		if err != nil {
+			return nil, 0, err
+		}
+		if signer := p7.GetOnlySigner(); signer != nil {
+			update.Signer = newCertificateInfo(signer)
+		}
+		for _, cert := range p7.Certificates {
+			update.Certificates = append(update.Certificates, *newCertificateInfo(cert))
+		}
+	}
+	return update, int(efiTimeSize + length), nil
+}
+
+// parseVariableSignature parses the signature of an authenticated variable.
+// The UEFI specification calls for a bare SignedData, but some tools write
+// a ContentInfo, so both are accepted.
+func parseVariableSignature(signature []byte) (*pkcs7.PKCS7, error) {
+	if p7, err := parsePKCS7(signature); err == nil {
+		return p7, nil
+	}
+	wrapped, err := asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signature},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode ContentInfo: %w", err)
+	}
+	p7, err := parsePKCS7(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse authenticated variable signature: %w", err)
+	}
+	return p7, nil
+}
@@ -0,0 +1,107 @@
+package sigtool
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// variableAuthForTest returns an authenticated variable update of lists at
+// when, signed by the test signer with a bare SignedData unless
+// contentInfo is set
+func variableAuthForTest(t testing.TB, lists []byte, when time.Time, contentInfo bool) []byte {
+	t.Helper()
+	cert, key := testSigner(t)
+	signature := signDetachedForTest(t, &testIdentity{Cert: cert, Key: key}, lists)
+	if !contentInfo {
+		var outer testContentInfo
+		if _, err := asn1.Unmarshal(signature, &outer); err != nil {
+			t.Fatalf("Failed to parse ContentInfo: %v", err)
+		}
+		signature = outer.Content.Bytes
+	}
+
+	data := make([]byte, efiTimeSize)
+	binary.LittleEndian.PutUint16(data, uint16(when.Year()))
+	data[2], data[3], data[4], data[5], data[6] = byte(when.Month()), byte(when.Day()), byte(when.Hour()), byte(when.Minute()), byte(when.Second())
+	data = binary.LittleEndian.AppendUint32(data, uint32(winCertificateHeaderLength+len(GUID{})+len(signature)))
+	data = binary.LittleEndian.AppendUint16(data, WinCertRevision2_0)
+	data = binary.LittleEndian.AppendUint16(data, winCertTypeEFIGUID)
+	data = append(append(data, efiCertTypePKCS7GUID[:]...), signature...)
+	return append(data, lists...)
+}
+
+func TestParseSignatureDatabase_Update(t *testing.T) {
+	cert, _ := testSigner(t)
+	lists := append(eslForTest(t, EFICertSHA256GUID, bytes.Repeat([]byte{1}, 32)), eslForTest(t, EFICertX509GUID, cert.Raw)...)
+	when := time.Date(2010, 3, 6, 19, 17, 21, 0, time.UTC)
+
+	for _, contentInfo := range []bool{false, true} {
+		db, err := ParseSignatureDatabase(variableAuthForTest(t, lists, when, contentInfo))
+		if err != nil {
+			t.Fatalf("ParseSignatureDatabase failed: %v", err)
+		}
+		if db.Update == nil || !db.Update.Timestamp.Equal(when) {
+			t.Fatalf("Expected an update at %v, got %+v", when, db.Update)
+		}
+		if db.Update.Signer == nil || db.Update.Signer.SHA256Thumbprint != newCertificateInfo(cert).SHA256Thumbprint {
+			t.Errorf("Expected the test signer, got %+v", db.Update.Signer)
+		}
+		if len(db.Lists) != 2 || db.Lists[1].Signatures[0].Certificate == nil {
+			t.Errorf("Expected the hash and certificate lists, got %+v", db.Lists)
+		}
+	}
+
+	filePath := filepath.Join(t.TempDir(), "db.auth")
+	if err := os.WriteFile(filePath, variableAuthForTest(t, lists, when, false), 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if lists, err := LoadSignatureLists(filePath); err != nil || len(lists) != 2 {
+		t.Errorf("Expected LoadSignatureLists to read the lists of an update, got %d, %v", len(lists), err)
+	}
+}
+
+func TestParseSignatureDatabase_EFIVariable(t *testing.T) {
+	revoked := time.Date(2023, 5, 9, 0, 0, 0, 0, time.UTC)
+	entry := make([]byte, 48)
+	binary.LittleEndian.PutUint16(entry[32:], uint16(revoked.Year()))
+	entry[34], entry[35] = byte(revoked.Month()), byte(revoked.Day())
+	data := binary.LittleEndian.AppendUint32(nil, 0x27)
+	data = append(data, eslForTest(t, EFICertX509SHA256GUID, entry)...)
+
+	db, err := ParseSignatureDatabase(data)
+	if err != nil {
+		t.Fatalf("ParseSignatureDatabase failed: %v", err)
+	}
+	if db.Attributes != 0x27 || db.Update != nil || len(db.Lists) != 1 {
+		t.Fatalf("Expected an efivarfs variable, got %+v", db)
+	}
+	if got := db.Lists[0].Signatures[0].RevocationTime; !got.Equal(revoked) {
+		t.Errorf("RevocationTime = %v, want %v", got, revoked)
+	}
+}
+
+func TestParseSignatureDatabase_Malformed(t *testing.T) {
+	update := variableAuthForTest(t, nil, time.Now(), false)
+	badType := append([]byte(nil), update...)
+	badType[efiTimeSize+winCertificateHeaderLength] ^= 0xff
+	badLength := append([]byte(nil), update...)
+	binary.LittleEndian.PutUint32(badLength[efiTimeSize:], uint32(len(update)))
+	junk := []byte("not a signature")
+	badSignature := binary.LittleEndian.AppendUint32(append([]byte(nil), update[:efiTimeSize]...), uint32(winCertificateHeaderLength+len(GUID{})+len(junk)))
+	badSignature = append(badSignature, update[efiTimeSize+4:efiVariableAuthHeaderSize]...)
+	badSignature = append(badSignature, junk...)
+	for name, data := range map[string][]byte{
+		"certificate type":   badType,
+		"certificate length": badLength,
+		"signature":          badSignature,
+	} {
+		if _, err := ParseSignatureDatabase(data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package sigtool
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AWSCredentials are the access keys used to sign AWS requests.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is set for temporary credentials
+	SessionToken string
+}
+
+// AWSKMSConfig identifies an asymmetric AWS KMS signing key.
+type AWSKMSConfig struct {
+	// Region is the AWS region of the key, e.g. us-east-1
+	Region string
+	// KeyID is the key ID, key ARN, alias name or alias ARN
+	KeyID string
+	// Certificate is the signer certificate issued for the KMS key. KMS
+	// does not store certificates, so it must be obtained from the CA.
+	Certificate *x509.Certificate
+	// Chain holds intermediate certificates to embed in signatures
+	Chain []*x509.Certificate
+	// Credentials sign the requests. When nil, AWS_ACCESS_KEY_ID,
+	// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN are read from the
+	// environment.
+	Credentials *AWSCredentials
+	// Endpoint overrides the regional endpoint
+	// https://kms.<region>.amazonaws.com, e.g. for VPC endpoints
+	Endpoint string
+	// Client performs the requests. When nil, a client with Timeout is used.
+	Client *http.Client
+	// Timeout bounds each request. Zero means DefaultKMSTimeout.
+	Timeout time.Duration
+}
+
+// AWSKMSSigner is a Signer whose key stays in AWS KMS. Only the digest is
+// sent to KMS (MessageType DIGEST). It supports RSA (PKCS #1 v1.5) and ECDSA
+// keys and is safe for concurrent use.
+type AWSKMSSigner struct {
+	cfg      AWSKMSConfig
+	endpoint string
+	certs    []*x509.Certificate
+}
+
+// NewAWSKMSSigner returns a signer for the KMS key of cfg after checking
+// with GetPublicKey that the certificate belongs to the key.
+//
+// Parameters:
+//   - ctx: Bounds the public key retrieval
+//   - cfg: The region, key, certificate and credentials to use
+//
+// Returns:
+//   - *AWSKMSSigner: A signer for SignPEWith
+//   - error: An error if the key cannot be retrieved or does not match the
+//     certificate
+//
+// Example usage:
+//
+//	signer, err := sigtool.NewAWSKMSSigner(ctx, sigtool.AWSKMSConfig{
+//	    Region:      "eu-west-1",
+//	    KeyID:       "alias/code-signing",
+//	    Certificate: cert,
+//	})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	err = sigtool.SignPEWith("app.exe", signer, nil)
+func NewAWSKMSSigner(ctx context.Context, cfg AWSKMSConfig) (*AWSKMSSigner, error) {
+	if cfg.Region == "" || cfg.KeyID == "" {
+		return nil, errors.New("an AWS region and KMS key ID are required")
+	}
+	if cfg.Certificate == nil {
+		return nil, errors.New("a certificate for the KMS key is required")
+	}
+	if cfg.Credentials == nil {
+		cfg.Credentials = &AWSCredentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+	}
+	if cfg.Credentials.AccessKeyID == "" || cfg.Credentials.SecretAccessKey == "" {
+		return nil, errors.New("AWS credentials are required")
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://kms." + cfg.Region + ".amazonaws.com"
+	}
+
+	s := &AWSKMSSigner{cfg: cfg, endpoint: endpoint}
+	var key struct {
+		PublicKey []byte `json:"PublicKey"`
+	}
+	if err := s.call(ctx, "GetPublicKey", map[string]string{"KeyId": cfg.KeyID}, &key); err != nil {
+		return nil, err
+	}
+	pub, err := x509.ParsePKIXPublicKey(key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse KMS public key: %w", err)
+	}
+	switch pub.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("unsupported KMS key type %T", pub)
+	}
+	if !pub.(interface{ Equal(crypto.PublicKey) bool }).Equal(cfg.Certificate.PublicKey) {
+		return nil, errors.New("certificate does not match the KMS key")
+	}
+
+	s.certs = append([]*x509.Certificate{cfg.Certificate}, cfg.Chain...)
+	return s, nil
+}
+
+// Public returns the public key of the signer certificate.
+func (s *AWSKMSSigner) Public() crypto.PublicKey {
+	return s.certs[0].PublicKey
+}
+
+// Sign has KMS sign digest with RSASSA_PKCS1_V1_5_SHA_* or ECDSA_SHA_*.
+func (s *AWSKMSSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if _, ok := opts.(*rsa.PSSOptions); ok {
+		return nil, errors.New("RSA-PSS is not supported by the KMS signer")
+	}
+	size, err := kmsHashName(opts.HashFunc())
+	if err != nil {
+		return nil, err
+	}
+	algorithm := "RSASSA_PKCS1_V1_5_SHA_" + size
+	if _, ok := s.Public().(*ecdsa.PublicKey); ok {
+		algorithm = "ECDSA_SHA_" + size
+	}
+
+	ctx, cancel := kmsContext(s.cfg.Timeout)
+	defer cancel()
+	var result struct {
+		Signature []byte `json:"Signature"`
+	}
+	request := struct {
+		KeyID            string `json:"KeyId"`
+		Message          []byte `json:"Message"`
+		MessageType      string `json:"MessageType"`
+		SigningAlgorithm string `json:"SigningAlgorithm"`
+	}{s.cfg.KeyID, digest, "DIGEST", algorithm}
+	if err := s.call(ctx, "Sign", request, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Signature) == 0 {
+		return nil, errors.New("KMS returned an empty signature")
+	}
+	return result.Signature, nil
+}
+
+// Certificates returns the signer certificate followed by the configured
+// chain.
+func (s *AWSKMSSigner) Certificates() ([]*x509.Certificate, error) {
+	return s.certs, nil
+}
+
+// call invokes the KMS JSON API action with request and decodes the
+// response into out
+func (s *AWSKMSSigner) call(ctx context.Context, action string, request, out interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to encode KMS %s request: %w", action, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid KMS endpoint %q: %w", s.endpoint, err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+action)
+	signAWSRequest(req, body, s.cfg.Credentials, s.cfg.Region, "kms", time.Now())
+	return doKMSRequest(kmsClient(s.cfg.Client, s.cfg.Timeout), req, "KMS "+action, out)
+}
+
+// signAWSRequest adds AWS Signature Version 4 authentication to req, whose
+// body is body, for service in region at now. Every header already set on
+// req is signed.
+func signAWSRequest(req *http.Request, body []byte, creds *AWSCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalAWSQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+creds.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// canonicalAWSQuery encodes query in the sorted, RFC 3986 escaped form
+// Signature Version 4 signs
+func canonicalAWSQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsEscape percent-encodes s as RFC 3986 requires
+func awsEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data under key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
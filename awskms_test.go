@@ -0,0 +1,119 @@
+package sigtool
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// kmsForTest serves the KMS GetPublicKey and Sign actions for key
+func kmsForTest(t *testing.T, key *ecdsa.PrivateKey) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") ||
+			!strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/kms/aws4_request") {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"__type":"AccessDeniedException","message":"not authorized"}`))
+			return
+		}
+		var req struct {
+			KeyID            string `json:"KeyId"`
+			Message          []byte
+			MessageType      string
+			SigningAlgorithm string
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.GetPublicKey":
+			der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+			_ = json.NewEncoder(w).Encode(map[string][]byte{"PublicKey": der})
+		case "TrentService.Sign":
+			if req.MessageType != "DIGEST" || req.SigningAlgorithm != "ECDSA_SHA_256" {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"__type":"ValidationException","message":"unexpected request"}`))
+				return
+			}
+			signature, _ := ecdsa.SignASN1(rand.Reader, key, req.Message)
+			_ = json.NewEncoder(w).Encode(map[string][]byte{"Signature": signature})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestAWSKMSSigner(t *testing.T) {
+	root := issueCertificateForTest(t, testCATemplate("kms root", 1), nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Cert)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := testLeafTemplate("kms signer", 2, x509.ExtKeyUsageCodeSigning)
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, template, root.Cert, &key.PublicKey, root.Key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	server := kmsForTest(t, key)
+	cfg := AWSKMSConfig{
+		Region:      "eu-west-1",
+		KeyID:       "alias/code-signing",
+		Certificate: cert,
+		Credentials: &AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret", SessionToken: "session"},
+		Endpoint:    server.URL,
+	}
+	signer, err := NewAWSKMSSigner(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	filePath := writeUnsignedPEForTest(t, []byte("kms payload"))
+	if err := SignPEWith(filePath, signer, nil); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{Roots: roots}); err != nil {
+		t.Errorf("Expected KMS signature to verify, got: %v", err)
+	}
+
+	other := issueCertificateForTest(t, testLeafTemplate("other", 3, x509.ExtKeyUsageCodeSigning), nil)
+	cfg.Certificate = other.Cert
+	if _, err := NewAWSKMSSigner(context.Background(), cfg); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("Expected certificate mismatch error, got: %v", err)
+	}
+
+	cfg.Certificate = cert
+	cfg.Credentials = &AWSCredentials{AccessKeyID: "AKIDOTHER", SecretAccessKey: "secret"}
+	if _, err := NewAWSKMSSigner(context.Background(), cfg); err == nil || !strings.Contains(err.Error(), "AccessDeniedException") {
+		t.Errorf("Expected the KMS error type, got: %v", err)
+	}
+}
+
+func TestSignAWSRequest(t *testing.T) {
+	// The GET example of the AWS Signature Version 4 documentation
+	req, _ := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	creds := &AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signAWSRequest(req, nil, creds, "us-east-1", "iam", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, " +
+		"SignedHeaders=content-type;host;x-amz-date, " +
+		"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,201 @@
+package sigtool
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// azureKeyVaultAPIVersion is the Key Vault REST API version used
+const azureKeyVaultAPIVersion = "7.4"
+
+// AzureKeyVaultConfig identifies a Key Vault certificate whose key signs.
+type AzureKeyVaultConfig struct {
+	// VaultURL is the vault endpoint, e.g. https://myvault.vault.azure.net
+	VaultURL string
+	// CertificateName is the name of the Key Vault certificate
+	CertificateName string
+	// CertificateVersion pins a certificate version. When empty the
+	// current version is used.
+	CertificateVersion string
+	// Token returns an OAuth2 access token for the https://vault.azure.net
+	// resource, e.g. from azidentity or the managed identity endpoint. It is
+	// called before every request, so it should cache tokens itself.
+	Token func(ctx context.Context) (string, error)
+	// Chain holds intermediate certificates to embed in signatures
+	Chain []*x509.Certificate
+	// Client performs the requests. When nil, a client with Timeout is used.
+	Client *http.Client
+	// Timeout bounds each request. Zero means DefaultKMSTimeout.
+	Timeout time.Duration
+}
+
+// AzureKeyVaultSigner is a Signer whose key stays in Azure Key Vault. Only
+// the digest is sent to the vault, which signs it with the key of the
+// certificate. It supports RSA (PKCS #1 v1.5) and ECDSA keys and is safe for
+// concurrent use.
+type AzureKeyVaultSigner struct {
+	cfg   AzureKeyVaultConfig
+	keyID string
+	certs []*x509.Certificate
+}
+
+// NewAzureKeyVaultSigner retrieves the certificate named by cfg from Key
+// Vault and returns a signer for its key.
+//
+// Parameters:
+//   - ctx: Bounds the certificate retrieval
+//   - cfg: The vault, certificate and credentials to use
+//
+// Returns:
+//   - *AzureKeyVaultSigner: A signer for SignPEWith
+//   - error: An error if the certificate cannot be retrieved or parsed
+//
+// Example usage:
+//
+//	signer, err := sigtool.NewAzureKeyVaultSigner(ctx, sigtool.AzureKeyVaultConfig{
+//	    VaultURL:        "https://release.vault.azure.net",
+//	    CertificateName: "code-signing",
+//	    Token:           tokenFromManagedIdentity,
+//	})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	err = sigtool.SignPEWith("app.exe", signer, nil)
+func NewAzureKeyVaultSigner(ctx context.Context, cfg AzureKeyVaultConfig) (*AzureKeyVaultSigner, error) {
+	vault, err := url.Parse(cfg.VaultURL)
+	if err != nil || vault.Host == "" {
+		return nil, fmt.Errorf("invalid Key Vault URL %q", cfg.VaultURL)
+	}
+	if cfg.CertificateName == "" {
+		return nil, errors.New("a Key Vault certificate name is required")
+	}
+	if cfg.Token == nil {
+		return nil, errors.New("a Key Vault token source is required")
+	}
+	cfg.VaultURL = strings.TrimRight(cfg.VaultURL, "/")
+
+	certURL := cfg.VaultURL + "/certificates/" + url.PathEscape(cfg.CertificateName)
+	if cfg.CertificateVersion != "" {
+		certURL += "/" + url.PathEscape(cfg.CertificateVersion)
+	}
+	var bundle struct {
+		KeyID string `json:"kid"`
+		CER   string `json:"cer"`
+	}
+	s := &AzureKeyVaultSigner{cfg: cfg}
+	if err := s.call(ctx, http.MethodGet, certURL, nil, &bundle); err != nil {
+		return nil, err
+	}
+	der, err := decodeKeyVaultBytes(bundle.CER)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Key Vault certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Key Vault certificate: %w", err)
+	}
+	switch cert.PublicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("unsupported Key Vault key type %T", cert.PublicKey)
+	}
+	// The access token must never be sent outside the vault
+	if !strings.HasPrefix(bundle.KeyID, cfg.VaultURL+"/keys/") {
+		return nil, fmt.Errorf("key %q of the Key Vault certificate is outside %s", bundle.KeyID, cfg.VaultURL)
+	}
+
+	s.keyID = bundle.KeyID
+	s.certs = append([]*x509.Certificate{cert}, cfg.Chain...)
+	return s, nil
+}
+
+// Public returns the public key of the Key Vault certificate.
+func (s *AzureKeyVaultSigner) Public() crypto.PublicKey {
+	return s.certs[0].PublicKey
+}
+
+// Sign has Key Vault sign digest with RS256/384/512 or ES256/384/512.
+func (s *AzureKeyVaultSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if _, ok := opts.(*rsa.PSSOptions); ok {
+		return nil, errors.New("RSA-PSS is not supported by the Key Vault signer")
+	}
+	size, err := kmsHashName(opts.HashFunc())
+	if err != nil {
+		return nil, err
+	}
+	alg := "RS" + size
+	if _, ok := s.Public().(*ecdsa.PublicKey); ok {
+		alg = "ES" + size
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"alg":   alg,
+		"value": base64.RawURLEncoding.EncodeToString(digest),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode Key Vault request: %w", err)
+	}
+	var result struct {
+		Value string `json:"value"`
+	}
+	ctx, cancel := kmsContext(s.cfg.Timeout)
+	defer cancel()
+	if err := s.call(ctx, http.MethodPost, s.keyID+"/sign", body, &result); err != nil {
+		return nil, err
+	}
+	signature, err := decodeKeyVaultBytes(result.Value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Key Vault signature: %w", err)
+	}
+	if alg[0] == 'E' {
+		return ecdsaSignatureFromRaw(signature)
+	}
+	return signature, nil
+}
+
+// Certificates returns the Key Vault certificate followed by the configured
+// chain.
+func (s *AzureKeyVaultSigner) Certificates() ([]*x509.Certificate, error) {
+	return s.certs, nil
+}
+
+// call sends an authenticated Key Vault request and decodes the response
+// into out
+func (s *AzureKeyVaultSigner) call(ctx context.Context, method, endpoint string, body []byte, out interface{}) error {
+	token, err := s.cfg.Token(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get Key Vault access token: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint+"?api-version="+azureKeyVaultAPIVersion, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid Key Vault URL %q: %w", endpoint, err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return doKMSRequest(kmsClient(s.cfg.Client, s.cfg.Timeout), req, "Key Vault", out)
+}
+
+// decodeKeyVaultBytes decodes a Key Vault binary value, which is base64url
+// encoded, tolerating padding and the standard alphabet
+func decodeKeyVaultBytes(value string) ([]byte, error) {
+	value = strings.TrimRight(value, "=")
+	if data, err := base64.RawURLEncoding.DecodeString(value); err == nil {
+		return data, nil
+	}
+	return base64.RawStdEncoding.DecodeString(value)
+}
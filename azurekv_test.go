@@ -0,0 +1,111 @@
+package sigtool
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// keyVaultForTest serves the Key Vault certificate and sign APIs for id,
+// reporting the key at *keyID
+func keyVaultForTest(t *testing.T, id *testIdentity, keyID *string) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" || r.URL.Query().Get("api-version") != azureKeyVaultAPIVersion {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":{"code":"Unauthorized","message":"bad token"}}`))
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/certificates/code-signing":
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"kid": *keyID,
+				"cer": base64.RawURLEncoding.EncodeToString(id.Cert.Raw),
+			})
+		case r.Method == http.MethodPost && r.URL.Path == "/keys/code-signing/v1/sign":
+			var req struct{ Alg, Value string }
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Alg != "RS256" {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"error":{"code":"BadParameter","message":"unsupported algorithm"}}`))
+				return
+			}
+			digest, _ := base64.RawURLEncoding.DecodeString(req.Value)
+			signature, _ := rsa.SignPKCS1v15(nil, id.Key, crypto.SHA256, digest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"value": base64.RawURLEncoding.EncodeToString(signature)})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func testKeyVaultToken(context.Context) (string, error) { return "test-token", nil }
+
+func TestAzureKeyVaultSigner(t *testing.T) {
+	root := issueCertificateForTest(t, testCATemplate("vault root", 1), nil)
+	leaf := issueCertificateForTest(t, testLeafTemplate("vault signer", 2, x509.ExtKeyUsageCodeSigning), root)
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Cert)
+
+	var keyID string
+	server := keyVaultForTest(t, leaf, &keyID)
+	keyID = server.URL + "/keys/code-signing/v1"
+
+	signer, err := NewAzureKeyVaultSigner(context.Background(), AzureKeyVaultConfig{
+		VaultURL:        server.URL + "/",
+		CertificateName: "code-signing",
+		Token:           testKeyVaultToken,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	filePath := writeUnsignedPEForTest(t, []byte("vault payload"))
+	if err := SignPEWith(filePath, signer, nil); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{Roots: roots}); err != nil {
+		t.Errorf("Expected Key Vault signature to verify, got: %v", err)
+	}
+
+	// Service errors carry the Key Vault message
+	err = SignPEWith(filePath, signer, &SignOptions{Hash: crypto.SHA384})
+	if err == nil || !strings.Contains(err.Error(), "unsupported algorithm") {
+		t.Errorf("Expected the Key Vault error message, got: %v", err)
+	}
+}
+
+func TestAzureKeyVaultSigner_Errors(t *testing.T) {
+	leaf := issueCertificateForTest(t, testLeafTemplate("vault signer", 2, x509.ExtKeyUsageCodeSigning), nil)
+	keyID := "https://attacker.example/keys/code-signing/v1"
+	server := keyVaultForTest(t, leaf, &keyID)
+	cfg := AzureKeyVaultConfig{VaultURL: server.URL, CertificateName: "code-signing", Token: testKeyVaultToken}
+
+	if _, err := NewAzureKeyVaultSigner(context.Background(), cfg); err == nil || !strings.Contains(err.Error(), "outside") {
+		t.Errorf("Expected a key outside the vault to be rejected, got: %v", err)
+	}
+
+	cfg.Token = func(context.Context) (string, error) { return "wrong", nil }
+	if _, err := NewAzureKeyVaultSigner(context.Background(), cfg); err == nil || !strings.Contains(err.Error(), "bad token") {
+		t.Errorf("Expected the Key Vault error message, got: %v", err)
+	}
+
+	expired := errors.New("token expired")
+	cfg.Token = func(context.Context) (string, error) { return "", expired }
+	if _, err := NewAzureKeyVaultSigner(context.Background(), cfg); !errors.Is(err, expired) {
+		t.Errorf("Expected the token error, got: %v", err)
+	}
+
+	if _, err := NewAzureKeyVaultSigner(context.Background(), AzureKeyVaultConfig{VaultURL: "vault", CertificateName: "c", Token: testKeyVaultToken}); err == nil {
+		t.Error("Expected error for an invalid vault URL, got nil")
+	}
+}
@@ -0,0 +1,92 @@
+package sigtool
+
+import (
+	"context"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// BatchResult is the outcome of verifying one file with VerifyAll.
+type BatchResult struct {
+	// Index is the position of Path in the paths passed to VerifyAll
+	Index int
+	// Path is the verified file
+	Path string
+	// Err is nil if the signature is valid, otherwise the error of
+	// VerifyContext
+	Err error
+}
+
+// VerifyAll verifies many PE files concurrently with a bounded pool of
+// workers.
+//
+// Each file is verified like VerifyContext with opts, by at most
+// opts.Workers goroutines, or runtime.GOMAXPROCS(0) when it is zero. The
+// results are delivered on the returned channel as they complete, so their
+// order is not that of paths; use BatchResult.Index to restore it. Every
+// path yields exactly one result and the channel is closed after the last.
+// Once ctx is done the remaining files fail with an error wrapping
+// ctx.Err() without being read. A file whose verification panics fails
+// with a *PanicError instead of stopping the batch.
+//
+// The trust anchors and revocation checkers of opts are shared by the
+// workers; OCSPChecker, CRLChecker, AIAFetcher and Denylist are safe for
+// concurrent use, and their caches benefit every file.
+//
+// Parameters:
+//   - ctx: The context controlling cancellation
+//   - paths: The paths of the PE files to verify
+//   - opts: Certificate chain verification options, applied to every file
+//
+// Returns:
+//   - <-chan BatchResult: The results, closed once every file is done
+//
+// Example usage:
+//
+//	opts := sigtool.VerifyOptions{UseSystemRoots: true, Workers: 8}
+//	for result := range sigtool.VerifyAll(ctx, paths, opts) {
+//	    if result.Err != nil {
+//	        fmt.Printf("%s: %v\n", result.Path, result.Err)
+//	    }
+//	}
+func VerifyAll(ctx context.Context, paths []string, opts VerifyOptions) <-chan BatchResult {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = min(workers, max(len(paths), 1))
+
+	jobs := make(chan int)
+	results := make(chan BatchResult, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				results <- BatchResult{Index: index, Path: paths[index], Err: verifyRecovered(ctx, paths[index], opts)}
+			}
+		}()
+	}
+	go func() {
+		for index := range paths {
+			jobs <- index
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+// verifyRecovered verifies filePath like VerifyContext, returning a
+// *PanicError if the verification panics
+func verifyRecovered(ctx context.Context, filePath string, opts VerifyOptions) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+	return VerifyContext(ctx, filePath, opts)
+}
@@ -0,0 +1,100 @@
+package sigtool
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+)
+
+func TestVerifyAll(t *testing.T) {
+	var paths []string
+	for i := 0; i < 6; i++ {
+		filePath, _ := createSignedMockPE(t, crypto.SHA256)
+		paths = append(paths, filePath)
+	}
+	paths = append(paths, writeUnsignedPEForTest(t, []byte("unsigned")))
+
+	for _, workers := range []int{0, 1, 3, 100} {
+		t.Run(fmt.Sprint(workers), func(t *testing.T) {
+			seen := make([]bool, len(paths))
+			for result := range VerifyAll(context.Background(), paths, VerifyOptions{Workers: workers}) {
+				if seen[result.Index] {
+					t.Fatalf("Duplicate result for %s", result.Path)
+				}
+				seen[result.Index] = true
+				if result.Path != paths[result.Index] {
+					t.Errorf("Result %d has path %q, want %q", result.Index, result.Path, paths[result.Index])
+				}
+				unsigned := result.Index == len(paths)-1
+				if unsigned && !errors.Is(result.Err, ErrNotSigned) {
+					t.Errorf("Expected ErrNotSigned for the unsigned file, got: %v", result.Err)
+				}
+				if !unsigned && result.Err != nil {
+					t.Errorf("Expected %s to verify, got: %v", result.Path, result.Err)
+				}
+			}
+			for i, ok := range seen {
+				if !ok {
+					t.Errorf("No result for %s", paths[i])
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyAll_Cancelled(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+	paths := []string{filePath, filePath, filePath}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	count := 0
+	for result := range VerifyAll(ctx, paths, VerifyOptions{Workers: 2}) {
+		count++
+		if !errors.Is(result.Err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got: %v", result.Err)
+		}
+	}
+	if count != len(paths) {
+		t.Errorf("Got %d results, want %d", count, len(paths))
+	}
+}
+
+func TestVerifyAll_Empty(t *testing.T) {
+	for result := range VerifyAll(context.Background(), nil, VerifyOptions{}) {
+		t.Errorf("Unexpected result %+v", result)
+	}
+}
+
+// panicHandler is a slog.Handler that panics on every record
+type panicHandler struct{ slog.Handler }
+
+func (panicHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (panicHandler) Handle(context.Context, slog.Record) error { panic("malformed") }
+
+func TestVerifyAll_Panic(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+	paths := []string{filePath, filePath, filePath}
+
+	count := 0
+	for result := range VerifyAll(context.Background(), paths, VerifyOptions{Workers: 2, Logger: slog.New(panicHandler{})}) {
+		count++
+		var panicked *PanicError
+		if !errors.As(result.Err, &panicked) || panicked.Value != "malformed" || len(panicked.Stack) == 0 {
+			t.Fatalf("Expected a PanicError, got: %v", result.Err)
+		}
+		if !errors.Is(result.Err, ErrInvalidSignature) {
+			t.Errorf("Expected the PanicError to match ErrInvalidSignature")
+		}
+		if reason := reasonFor(result.Err, ""); reason != ReasonMalformedSignature {
+			t.Errorf("Expected %s, got %s", ReasonMalformedSignature, reason)
+		}
+	}
+	if count != len(paths) {
+		t.Errorf("Got %d results, want %d", count, len(paths))
+	}
+}
@@ -0,0 +1,406 @@
+package sigtool
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Canonicalization algorithms of XML signatures
+const (
+	c14nInclusive          = "http://www.w3.org/TR/2001/REC-xml-c14n-20010315"
+	c14nInclusiveComments  = "http://www.w3.org/TR/2001/REC-xml-c14n-20010315#WithComments"
+	c14nExclusive          = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	c14nExclusiveComments  = "http://www.w3.org/2001/10/xml-exc-c14n#WithComments"
+	xmlNamespace           = "http://www.w3.org/XML/1998/namespace"
+	maxXMLDepth            = 256
+	maxXMLNodes            = 1 << 20
+	xmlnsPrefix            = "xmlns"
+	xmlPrefix              = "xml"
+	canonicalDefaultPrefix = ""
+)
+
+// xmlNode is an element of a parsed XML document. Names keep their prefix
+// in Space, as canonicalization writes prefixes rather than namespaces.
+type xmlNode struct {
+	name   xml.Name
+	attrs  []xml.Attr
+	parent *xmlNode
+	// children are *xmlNode elements, xml.CharData and xml.Comment
+	children []any
+}
+
+// parseXML parses data into a tree of elements and returns the document
+// element. Processing instructions and the document type are dropped.
+func parseXML(data []byte) (*xmlNode, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var root, current *xmlNode
+	nodes := 0
+	for {
+		tok, err := d.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse XML: %w", err)
+		}
+		if nodes++; nodes > maxXMLNodes {
+			return nil, errors.New("XML document is too large")
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{name: t.Name, attrs: append([]xml.Attr(nil), t.Attr...), parent: current}
+			switch {
+			case current != nil:
+				if n.depth() > maxXMLDepth {
+					return nil, errors.New("XML document is nested too deeply")
+				}
+				current.children = append(current.children, n)
+			case root != nil:
+				return nil, errors.New("XML document has more than one document element")
+			default:
+				root = n
+			}
+			current = n
+		case xml.EndElement:
+			if current == nil || current.name != t.Name {
+				return nil, fmt.Errorf("failed to parse XML: unexpected end element %s", t.Name.Local)
+			}
+			current = current.parent
+		case xml.CharData:
+			if current != nil {
+				current.children = append(current.children, xml.CharData(append([]byte(nil), t...)))
+			}
+		case xml.Comment:
+			if current != nil {
+				current.children = append(current.children, xml.Comment(append([]byte(nil), t...)))
+			}
+		}
+	}
+	if root == nil || current != nil {
+		return nil, errors.New("failed to parse XML: no complete document element")
+	}
+	return root, nil
+}
+
+// depth returns the number of ancestors of n
+func (n *xmlNode) depth() int {
+	depth := 0
+	for p := n.parent; p != nil; p = p.parent {
+		depth++
+	}
+	return depth
+}
+
+// attr returns the value of the unprefixed attribute local of n
+func (n *xmlNode) attr(local string) string {
+	for _, a := range n.attrs {
+		if a.Name.Space == "" && a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// namespaces returns the namespace declarations in scope at n, by prefix,
+// with "" for the default namespace
+func (n *xmlNode) namespaces() map[string]string {
+	var chain []*xmlNode
+	for p := n; p != nil; p = p.parent {
+		chain = append(chain, p)
+	}
+	scope := map[string]string{}
+	for i := len(chain) - 1; i >= 0; i-- {
+		for _, a := range chain[i].attrs {
+			switch {
+			case a.Name.Space == "" && a.Name.Local == xmlnsPrefix:
+				scope[canonicalDefaultPrefix] = a.Value
+			case a.Name.Space == xmlnsPrefix:
+				scope[a.Name.Local] = a.Value
+			}
+		}
+	}
+	return scope
+}
+
+// namespace returns the namespace URI of the element n
+func (n *xmlNode) namespace() string {
+	return n.namespaces()[n.name.Space]
+}
+
+// is reports whether n is the element local in namespace
+func (n *xmlNode) is(namespace, local string) bool {
+	return n.name.Local == local && n.namespace() == namespace
+}
+
+// elements returns the child elements of n in namespace named local, or
+// all child elements when local is empty
+func (n *xmlNode) elements(namespace, local string) []*xmlNode {
+	var out []*xmlNode
+	for _, c := range n.children {
+		if e, ok := c.(*xmlNode); ok && (local == "" || e.is(namespace, local)) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// element returns the first child element of n in namespace named local
+func (n *xmlNode) element(namespace, local string) *xmlNode {
+	if e := n.elements(namespace, local); len(e) > 0 {
+		return e[0]
+	}
+	return nil
+}
+
+// text returns the character data of n and its descendants
+func (n *xmlNode) text() string {
+	var b strings.Builder
+	for _, c := range n.children {
+		switch c := c.(type) {
+		case xml.CharData:
+			b.Write(c)
+		case *xmlNode:
+			b.WriteString(c.text())
+		}
+	}
+	return b.String()
+}
+
+// findByID returns the element of the tree at n whose Id attribute is id
+func (n *xmlNode) findByID(id string) *xmlNode {
+	if n.attr("Id") == id {
+		return n
+	}
+	for _, c := range n.children {
+		if e, ok := c.(*xmlNode); ok {
+			if found := e.findByID(id); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// canonicalize writes n and its descendants in the canonical form of
+// method, treating n as the apex of a document subset: with inclusive
+// canonicalization it carries every namespace declaration in scope, with
+// exclusive canonicalization only those it uses and the prefixes of
+// inclusivePrefixes
+func canonicalize(n *xmlNode, method string, inclusivePrefixes []string) ([]byte, error) {
+	c := &canonicalizer{}
+	switch method {
+	case c14nInclusive, c14nInclusiveComments:
+	case c14nExclusive, c14nExclusiveComments:
+		c.exclusive = true
+		c.inclusive = make(map[string]bool)
+		for _, prefix := range inclusivePrefixes {
+			if prefix == "#default" {
+				prefix = canonicalDefaultPrefix
+			}
+			c.inclusive[prefix] = true
+		}
+	default:
+		return nil, fmt.Errorf("unsupported canonicalization method %q", method)
+	}
+	c.comments = method == c14nInclusiveComments || method == c14nExclusiveComments
+	var buf bytes.Buffer
+	c.write(&buf, n, n.namespaces(), map[string]string{})
+	return buf.Bytes(), nil
+}
+
+// canonicalizer writes canonical XML
+type canonicalizer struct {
+	exclusive bool
+	// inclusive are the prefixes exclusive canonicalization treats
+	// inclusively
+	inclusive map[string]bool
+	comments  bool
+}
+
+// write writes the element n, whose in-scope namespaces are scope, below
+// output ancestors that rendered the namespace declarations rendered
+func (c *canonicalizer) write(buf *bytes.Buffer, n *xmlNode, scope, rendered map[string]string) {
+	// Namespace declarations rendered on this element
+	declare := map[string]string{}
+	if c.exclusive {
+		used := map[string]bool{n.name.Space: true}
+		for _, a := range n.attrs {
+			if a.Name.Space != "" && a.Name.Space != xmlnsPrefix && a.Name.Space != xmlPrefix {
+				used[a.Name.Space] = true
+			}
+		}
+		for prefix := range c.inclusive {
+			used[prefix] = true
+		}
+		for prefix := range used {
+			uri, ok := scope[prefix]
+			if !ok {
+				continue
+			}
+			if prev, seen := rendered[prefix]; (seen && prev == uri) || (!seen && prefix == canonicalDefaultPrefix && uri == "") {
+				continue
+			}
+			declare[prefix] = uri
+		}
+	} else {
+		for prefix, uri := range scope {
+			if prev, seen := rendered[prefix]; (seen && prev == uri) || (!seen && prefix == canonicalDefaultPrefix && uri == "") {
+				continue
+			}
+			declare[prefix] = uri
+		}
+	}
+	// An empty default namespace is only rendered to undo an inherited one
+	if uri, ok := declare[canonicalDefaultPrefix]; ok && uri == "" && rendered[canonicalDefaultPrefix] == "" {
+		delete(declare, canonicalDefaultPrefix)
+	}
+
+	buf.WriteByte('<')
+	writeQName(buf, n.name)
+	prefixes := make([]string, 0, len(declare))
+	for prefix := range declare {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		if prefix == canonicalDefaultPrefix {
+			buf.WriteString(` xmlns="`)
+		} else {
+			buf.WriteString(` xmlns:` + prefix + `="`)
+		}
+		escapeAttr(buf, declare[prefix])
+		buf.WriteByte('"')
+	}
+
+	// Attributes sort by namespace URI, then local name; unqualified
+	// attributes have no namespace and come first
+	type attr struct {
+		space string
+		a     xml.Attr
+	}
+	var attrs []attr
+	for _, a := range n.attrs {
+		if (a.Name.Space == "" && a.Name.Local == xmlnsPrefix) || a.Name.Space == xmlnsPrefix {
+			continue
+		}
+		space := ""
+		switch a.Name.Space {
+		case "":
+		case xmlPrefix:
+			space = xmlNamespace
+		default:
+			space = scope[a.Name.Space]
+		}
+		attrs = append(attrs, attr{space, a})
+	}
+	sort.SliceStable(attrs, func(i, j int) bool {
+		if attrs[i].space != attrs[j].space {
+			return attrs[i].space < attrs[j].space
+		}
+		return attrs[i].a.Name.Local < attrs[j].a.Name.Local
+	})
+	for _, a := range attrs {
+		buf.WriteByte(' ')
+		writeQName(buf, a.a.Name)
+		buf.WriteString(`="`)
+		escapeAttr(buf, a.a.Value)
+		buf.WriteByte('"')
+	}
+	buf.WriteByte('>')
+
+	childRendered := rendered
+	if len(declare) > 0 {
+		childRendered = make(map[string]string, len(rendered)+len(declare))
+		for k, v := range rendered {
+			childRendered[k] = v
+		}
+		for k, v := range declare {
+			childRendered[k] = v
+		}
+	}
+	for _, child := range n.children {
+		switch child := child.(type) {
+		case *xmlNode:
+			childScope := scope
+			if hasNamespaceDeclarations(child) {
+				childScope = child.namespaces()
+			}
+			c.write(buf, child, childScope, childRendered)
+		case xml.CharData:
+			escapeText(buf, child)
+		case xml.Comment:
+			if c.comments {
+				buf.WriteString("<!--")
+				buf.Write(child)
+				buf.WriteString("-->")
+			}
+		}
+	}
+	buf.WriteString("</")
+	writeQName(buf, n.name)
+	buf.WriteByte('>')
+}
+
+// hasNamespaceDeclarations reports whether n declares a namespace
+func hasNamespaceDeclarations(n *xmlNode) bool {
+	for _, a := range n.attrs {
+		if (a.Name.Space == "" && a.Name.Local == xmlnsPrefix) || a.Name.Space == xmlnsPrefix {
+			return true
+		}
+	}
+	return false
+}
+
+// writeQName writes the prefixed name of an element or attribute
+func writeQName(buf *bytes.Buffer, name xml.Name) {
+	if name.Space != "" {
+		buf.WriteString(name.Space)
+		buf.WriteByte(':')
+	}
+	buf.WriteString(name.Local)
+}
+
+// escapeText writes character data escaped as canonical XML requires
+func escapeText(buf *bytes.Buffer, s []byte) {
+	for _, b := range s {
+		switch b {
+		case '&':
+			buf.WriteString("&amp;")
+		case '<':
+			buf.WriteString("&lt;")
+		case '>':
+			buf.WriteString("&gt;")
+		case '\r':
+			buf.WriteString("&#xD;")
+		default:
+			buf.WriteByte(b)
+		}
+	}
+}
+
+// escapeAttr writes an attribute value escaped as canonical XML requires
+func escapeAttr(buf *bytes.Buffer, s string) {
+	for i := 0; i < len(s); i++ {
+		switch b := s[i]; b {
+		case '&':
+			buf.WriteString("&amp;")
+		case '<':
+			buf.WriteString("&lt;")
+		case '"':
+			buf.WriteString("&quot;")
+		case '\t':
+			buf.WriteString("&#x9;")
+		case '\n':
+			buf.WriteString("&#xA;")
+		case '\r':
+			buf.WriteString("&#xD;")
+		default:
+			buf.WriteByte(b)
+		}
+	}
+}
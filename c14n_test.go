@@ -0,0 +1,49 @@
+package sigtool
+
+import "testing"
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		name, method, input, want string
+	}{
+		{
+			"attributes and empty elements",
+			c14nInclusive,
+			`<?xml version="1.0"?><doc b='2' a="1 &amp; &lt;"><!-- dropped --><e/></doc>`,
+			`<doc a="1 &amp; &lt;" b="2"><e></e></doc>`,
+		},
+		{
+			"namespaces",
+			c14nInclusive,
+			`<a:doc xmlns:b="urn:b" xmlns:a="urn:a" xmlns="urn:d"><e b:x="1" y="2" a:z="3"><f xmlns="urn:d"/></e></a:doc>`,
+			`<a:doc xmlns="urn:d" xmlns:a="urn:a" xmlns:b="urn:b"><e y="2" a:z="3" b:x="1"><f></f></e></a:doc>`,
+		},
+		{
+			"exclusive",
+			c14nExclusive,
+			`<a:doc xmlns:b="urn:b" xmlns:a="urn:a"><b:e/></a:doc>`,
+			`<a:doc xmlns:a="urn:a"><b:e xmlns:b="urn:b"></b:e></a:doc>`,
+		},
+		{
+			"text",
+			c14nInclusive,
+			"<doc>a &gt; b\r\n<![CDATA[<c>]]></doc>",
+			"<doc>a &gt; b\n&lt;c&gt;</doc>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := parseXML([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("parseXML failed: %v", err)
+			}
+			got, err := canonicalize(root, tt.method, nil)
+			if err != nil {
+				t.Fatalf("canonicalize failed: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,393 @@
+package sigtool
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// cabinetMagic starts every Microsoft cabinet (.cab) file
+var cabinetMagic = []byte("MSCF")
+
+// Cabinet header flags
+const (
+	cabFlagPrevCabinet    = 0x0001
+	cabFlagNextCabinet    = 0x0002
+	cabFlagReservePresent = 0x0004
+)
+
+const (
+	// cabHeaderSize is the size of the fixed cabinet header (CFHEADER)
+	cabHeaderSize = 36
+	// cabSignedHeaderSize is the size of the header of a signed cabinet:
+	// the fixed header, the reserve sizes and a 20-byte header reserve
+	cabSignedHeaderSize = 60
+	// cabSignatureReserve is the size of the header reserve of a signed
+	// cabinet, with no folder or data block reserve
+	cabSignatureReserve = 20
+	// cabSignatureMagic starts the header reserve of a signed cabinet
+	cabSignatureMagic = 0x00100000
+	// cabFolderSize is the size of a CFFOLDER entry without reserve
+	cabFolderSize = 8
+)
+
+// cabLayout locates the parts of a cabinet the Authenticode digest covers
+type cabLayout struct {
+	header []byte
+	// signatureOffset and signatureSize locate the PKCS#7 signature after
+	// the cabinet data; both are zero for unsigned cabinets
+	signatureOffset int64
+	signatureSize   int64
+}
+
+// isCabinet reports whether r starts with the cabinet signature
+func isCabinet(r io.ReaderAt, size int64) bool {
+	if size < cabHeaderSize {
+		return false
+	}
+	magic := make([]byte, len(cabinetMagic))
+	if _, err := r.ReadAt(magic, 0); err != nil {
+		return false
+	}
+	return bytes.Equal(magic, cabinetMagic)
+}
+
+// readCABLayout parses the header of the cabinet r. A signed cabinet has a
+// 20-byte header reserve holding the offset and size of the signature,
+// which follows the cabinet data and ends the file.
+func readCABLayout(r io.ReaderAt, size int64) (*cabLayout, error) {
+	if !isCabinet(r, size) {
+		return nil, ErrNotCabinet
+	}
+	header := make([]byte, min(size, cabSignedHeaderSize))
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("failed to read cabinet header: %w", err)
+	}
+	if reserved := binary.LittleEndian.Uint32(header[4:]); reserved != 0 {
+		return nil, fmt.Errorf("%w: reserved header field is %#x", ErrNotCabinet, reserved)
+	}
+	flags := binary.LittleEndian.Uint16(header[30:])
+	if flags&(cabFlagPrevCabinet|cabFlagNextCabinet) != 0 {
+		return nil, fmt.Errorf("%w: multivolume cabinets are not supported", ErrNotCabinet)
+	}
+
+	layout := &cabLayout{header: header}
+	// cbCFHeader, cbCFFolder and cbCFData, then the signature reserve
+	if flags&cabFlagReservePresent == 0 || len(header) < cabSignedHeaderSize ||
+		binary.LittleEndian.Uint32(header[36:]) != cabSignatureReserve ||
+		binary.LittleEndian.Uint32(header[40:]) != cabSignatureMagic {
+		return layout, nil
+	}
+	layout.signatureOffset = int64(binary.LittleEndian.Uint32(header[44:]))
+	layout.signatureSize = int64(binary.LittleEndian.Uint32(header[48:]))
+	if layout.signatureOffset == 0 && layout.signatureSize == 0 {
+		return layout, nil
+	}
+
+	switch {
+	case layout.signatureSize > MaxSignatureSize:
+		return nil, &SignatureSizeError{Size: layout.signatureSize, Limit: MaxSignatureSize}
+	case layout.signatureOffset < cabSignedHeaderSize || layout.signatureSize == 0:
+		return nil, &SignatureBoundsError{
+			Offset: layout.signatureOffset, Length: layout.signatureSize, FileSize: size,
+			Reason: fmt.Sprintf("cabinet signature at offset %d of %d bytes is invalid", layout.signatureOffset, layout.signatureSize),
+		}
+	case layout.signatureOffset+layout.signatureSize > size:
+		return nil, &SignatureBoundsError{
+			Offset: layout.signatureOffset, Length: layout.signatureSize, FileSize: size,
+			Reason: fmt.Sprintf("cabinet signature at offset %d of %d bytes exceeds file size %d", layout.signatureOffset, layout.signatureSize, size),
+		}
+	case layout.signatureOffset+layout.signatureSize < size:
+		// Data after the signature is covered by no digest
+		return nil, fmt.Errorf("%w: %d bytes follow the signature", ErrNotCabinet, size-layout.signatureOffset-layout.signatureSize)
+	}
+	return layout, nil
+}
+
+// readCABSignature returns the PKCS#7 signature of the cabinet r
+func readCABSignature(r io.ReaderAt, size int64) ([]byte, error) {
+	layout, err := readCABLayout(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return readCABSignatureData(r, layout)
+}
+
+// readCABSignatureData reads the signature located by layout
+func readCABSignatureData(r io.ReaderAt, layout *cabLayout) ([]byte, error) {
+	if layout.signatureSize == 0 {
+		return nil, fmt.Errorf("%w (cabinet has no signature reserve)", ErrNotSigned)
+	}
+	signature := make([]byte, layout.signatureSize)
+	if _, err := r.ReadAt(signature, layout.signatureOffset); err != nil {
+		return nil, fmt.Errorf("failed to read cabinet signature: %w", err)
+	}
+	return signature, nil
+}
+
+// verifyCAB performs full Authenticode verification of the cabinet in r:
+// unless disabled, the digest of the cabinet must match the signature; the
+// signer signature and chain are checked per opts.
+func verifyCAB(r io.ReaderAt, size int64, opts VerifyOptions) error {
+	layout, err := readCABLayout(r, size)
+	if err != nil {
+		return fmt.Errorf("failed to extract signature: %w", err)
+	}
+	signature, err := readCABSignatureData(r, layout)
+	if err != nil {
+		return fmt.Errorf("failed to extract signature: %w", err)
+	}
+	opts.logger().Debug("read cabinet signature", "fileSize", size, "offset", layout.signatureOffset, "size", layout.signatureSize)
+
+	return verifySignatureDigest(signature, opts, func(algorithm crypto.Hash) ([]byte, error) {
+		return cabDigest(r, layout, algorithm)
+	})
+}
+
+// cabDigest computes the Authenticode digest of a signed cabinet: the header
+// without the reserved1 and iCabinet fields, the reserve sizes and the
+// signature location, followed by the folder entries, file entries and data
+// blocks up to the signature
+func cabDigest(r io.ReaderAt, layout *cabLayout, algorithm crypto.Hash) ([]byte, error) {
+	if !algorithm.Available() {
+		return nil, fmt.Errorf("hash algorithm %v is not available", algorithm)
+	}
+	header := layout.header
+	// The folder entries follow the header and precede the file entries
+	folders := int64(binary.LittleEndian.Uint16(header[26:]))
+	if files := int64(binary.LittleEndian.Uint32(header[16:])); files != cabSignedHeaderSize+folders*cabFolderSize {
+		return nil, fmt.Errorf("%w: file entries at offset %d do not follow the %d folder entries", ErrNotCabinet, files, folders)
+	}
+
+	h := algorithm.New()
+	h.Write(header[0:4])
+	// cbCabinet, reserved2, coffFiles, reserved3, the version, cFolders,
+	// cFiles, flags and setID
+	h.Write(header[8:34])
+	// The last four bytes of the signature reserve
+	h.Write(header[56:60])
+	data := io.NewSectionReader(r, cabSignedHeaderSize, layout.signatureOffset-cabSignedHeaderSize)
+	if _, err := io.Copy(h, data); err != nil {
+		return nil, fmt.Errorf("failed to hash cabinet: %w", err)
+	}
+	return h.Sum(nil), nil
+}
+
+// Cabinet folder compression types (the low bits of typeCompress)
+const (
+	cabCompressMask  = 0x000f
+	cabCompressNone  = 0
+	cabCompressMSZIP = 1
+)
+
+const (
+	// cabFileSize is the size of a CFFILE entry without its name
+	cabFileSize = 16
+	// cabMaxBlockSize is the most a CFDATA block decompresses to
+	cabMaxBlockSize = 32 << 10
+	// cabFileNameUTF is the CFFILE attribute marking a UTF-8 name
+	cabFileNameUTF = 0x80
+)
+
+// cabFolder is a folder entry (CFFOLDER) of a cabinet: a run of data
+// blocks that decompress to the concatenated files of the folder
+type cabFolder struct {
+	offset      int64
+	blocks      int
+	compression uint16
+}
+
+// cabFile is a file entry (CFFILE) of a cabinet
+type cabFile struct {
+	name   string
+	size   int64
+	offset int64
+	folder int
+}
+
+// walkCABFiles calls fn with the name, size and contents of every file of
+// the cabinet r in folder order. Only uncompressed and MSZIP folders can be
+// read; fn must not retain contents after it returns.
+func walkCABFiles(r io.ReaderAt, size int64, fn func(name string, size int64, contents io.Reader) error) error {
+	if _, err := readCABLayout(r, size); err != nil {
+		return err
+	}
+	header := make([]byte, min(size, cabHeaderSize+4))
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return fmt.Errorf("failed to read cabinet header: %w", err)
+	}
+	offset := int64(cabHeaderSize)
+	var folderReserve, dataReserve int64
+	if binary.LittleEndian.Uint16(header[30:])&cabFlagReservePresent != 0 {
+		if len(header) < cabHeaderSize+4 {
+			return fmt.Errorf("%w: reserve sizes are truncated", ErrNotCabinet)
+		}
+		offset += 4 + int64(binary.LittleEndian.Uint16(header[36:]))
+		folderReserve = int64(header[38])
+		dataReserve = int64(header[39])
+	}
+
+	folders := make([]cabFolder, binary.LittleEndian.Uint16(header[26:]))
+	entry := make([]byte, cabFolderSize)
+	for i := range folders {
+		if _, err := r.ReadAt(entry, offset); err != nil {
+			return fmt.Errorf("%w: folder entry %d is truncated", ErrNotCabinet, i)
+		}
+		folders[i] = cabFolder{
+			offset:      int64(binary.LittleEndian.Uint32(entry)),
+			blocks:      int(binary.LittleEndian.Uint16(entry[4:])),
+			compression: binary.LittleEndian.Uint16(entry[6:]),
+		}
+		offset += cabFolderSize + folderReserve
+	}
+
+	files := make([]cabFile, binary.LittleEndian.Uint16(header[28:]))
+	offset = int64(binary.LittleEndian.Uint32(header[16:]))
+	// Names are at most 256 bytes with their terminator
+	entry = make([]byte, cabFileSize+256)
+	for i := range files {
+		n, err := r.ReadAt(entry, offset)
+		if n < cabFileSize || (err != nil && err != io.EOF) {
+			return fmt.Errorf("%w: file entry %d is truncated", ErrNotCabinet, i)
+		}
+		name, _, ok := bytes.Cut(entry[cabFileSize:n], []byte{0})
+		if !ok {
+			return fmt.Errorf("%w: file entry %d has an unterminated name", ErrNotCabinet, i)
+		}
+		folder := int(binary.LittleEndian.Uint16(entry[8:]))
+		if folder >= len(folders) {
+			return fmt.Errorf("%w: file entry %d is in folder %d of %d", ErrNotCabinet, i, folder, len(folders))
+		}
+		files[i] = cabFile{
+			name:   cabFileName(name, binary.LittleEndian.Uint16(entry[14:])&cabFileNameUTF != 0),
+			size:   int64(binary.LittleEndian.Uint32(entry)),
+			offset: int64(binary.LittleEndian.Uint32(entry[4:])),
+			folder: folder,
+		}
+		offset += cabFileSize + int64(len(name)) + 1
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].folder != files[j].folder {
+			return files[i].folder < files[j].folder
+		}
+		return files[i].offset < files[j].offset
+	})
+
+	var data *cabFolderReader
+	var position int64
+	for i, file := range files {
+		// Files of a folder are read in order; one overlapping the previous
+		// file restarts its folder
+		if i == 0 || file.folder != files[i-1].folder || file.offset < position {
+			f := folders[file.folder]
+			if f.compression&cabCompressMask > cabCompressMSZIP {
+				return fmt.Errorf("%w: folder %d compression type %d is not supported", ErrNotCabinet, file.folder, f.compression&cabCompressMask)
+			}
+			data = &cabFolderReader{r: r, folder: f, reserve: dataReserve}
+			position = 0
+		}
+		if _, err := io.CopyN(io.Discard, data, file.offset-position); err != nil {
+			return fmt.Errorf("failed to read %s: %w", file.name, err)
+		}
+		contents := &io.LimitedReader{R: data, N: file.size}
+		if err := fn(file.name, file.size, contents); err != nil {
+			return err
+		}
+		if _, err := io.Copy(io.Discard, contents); err != nil {
+			return fmt.Errorf("failed to read %s: %w", file.name, err)
+		}
+		if contents.N > 0 {
+			return fmt.Errorf("%w: %s is truncated", ErrNotCabinet, file.name)
+		}
+		position = file.offset + file.size
+	}
+	return nil
+}
+
+// cabFileName returns the name of a file entry with slash separators,
+// decoding it as UTF-8 when utf is set and as Latin-1 otherwise
+func cabFileName(name []byte, utf bool) string {
+	s := string(name)
+	if !utf {
+		runes := make([]rune, len(name))
+		for i, b := range name {
+			runes[i] = rune(b)
+		}
+		s = string(runes)
+	}
+	return strings.ReplaceAll(s, `\`, "/")
+}
+
+// cabFolderReader reads the decompressed data of a folder
+type cabFolderReader struct {
+	r       io.ReaderAt
+	folder  cabFolder
+	reserve int64
+	// window is the MSZIP history, the last 32 KiB decompressed
+	window []byte
+	// pending is the rest of the current block
+	pending []byte
+}
+
+// Read implements io.Reader, decompressing the data blocks of the folder
+// one at a time
+func (f *cabFolderReader) Read(p []byte) (int, error) {
+	for len(f.pending) == 0 {
+		if f.folder.blocks == 0 {
+			return 0, io.EOF
+		}
+		if err := f.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, f.pending)
+	f.pending = f.pending[n:]
+	return n, nil
+}
+
+// next decompresses the next data block (CFDATA) of the folder into pending
+func (f *cabFolderReader) next() error {
+	var header [8]byte
+	if _, err := f.r.ReadAt(header[:], f.folder.offset); err != nil {
+		return fmt.Errorf("%w: data block at offset %d is truncated", ErrNotCabinet, f.folder.offset)
+	}
+	compressed := make([]byte, binary.LittleEndian.Uint16(header[4:]))
+	uncompressed := int(binary.LittleEndian.Uint16(header[6:]))
+	if _, err := f.r.ReadAt(compressed, f.folder.offset+8+f.reserve); err != nil {
+		return fmt.Errorf("%w: data block at offset %d is truncated", ErrNotCabinet, f.folder.offset)
+	}
+	if uncompressed > cabMaxBlockSize {
+		return fmt.Errorf("%w: data block at offset %d decompresses to %d bytes", ErrNotCabinet, f.folder.offset, uncompressed)
+	}
+	at := f.folder.offset
+	f.folder.offset += 8 + f.reserve + int64(len(compressed))
+	f.folder.blocks--
+
+	if f.folder.compression&cabCompressMask == cabCompressNone {
+		if len(compressed) != uncompressed {
+			return fmt.Errorf("%w: stored data block at offset %d has %d of %d bytes", ErrNotCabinet, at, len(compressed), uncompressed)
+		}
+		f.pending = compressed
+		return nil
+	}
+
+	// Each MSZIP block is a deflate stream after a "CK" signature, using
+	// the data of the previous blocks as its dictionary
+	data, ok := bytes.CutPrefix(compressed, []byte("CK"))
+	if !ok {
+		return fmt.Errorf("%w: MSZIP data block at offset %d has no CK signature", ErrNotCabinet, at)
+	}
+	out := make([]byte, uncompressed)
+	if _, err := io.ReadFull(flate.NewReaderDict(bytes.NewReader(data), f.window), out); err != nil {
+		return fmt.Errorf("%w: MSZIP data block at offset %d: %v", ErrNotCabinet, at, err)
+	}
+	f.window = append(f.window, out...)
+	f.window = f.window[max(len(f.window)-cabMaxBlockSize, 0):]
+	f.pending = out
+	return nil
+}
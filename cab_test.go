@@ -0,0 +1,293 @@
+package sigtool
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// cabinetForTest builds a cabinet storing payload uncompressed as hello.txt.
+// With signed set, the header carries a signature reserve for a signature of
+// signatureSize bytes appended after the data.
+func cabinetForTest(payload []byte, signed bool, signatureSize int) []byte {
+	headerSize := cabHeaderSize
+	flags := uint16(0)
+	if signed {
+		headerSize = cabSignedHeaderSize
+		flags = cabFlagReservePresent
+	}
+	filesOffset := headerSize + cabFolderSize
+	fileEntry := append(make([]byte, 16), "hello.txt\x00"...)
+	dataOffset := filesOffset + len(fileEntry)
+	size := dataOffset + 8 + len(payload)
+
+	cab := make([]byte, size)
+	copy(cab, cabinetMagic)
+	binary.LittleEndian.PutUint32(cab[8:], uint32(size))
+	binary.LittleEndian.PutUint32(cab[16:], uint32(filesOffset))
+	cab[24], cab[25] = 3, 1
+	binary.LittleEndian.PutUint16(cab[26:], 1)
+	binary.LittleEndian.PutUint16(cab[28:], 1)
+	binary.LittleEndian.PutUint16(cab[30:], flags)
+	binary.LittleEndian.PutUint16(cab[32:], 0x1234)
+	if signed {
+		binary.LittleEndian.PutUint32(cab[36:], cabSignatureReserve)
+		binary.LittleEndian.PutUint32(cab[40:], cabSignatureMagic)
+		binary.LittleEndian.PutUint32(cab[44:], uint32(size))
+		binary.LittleEndian.PutUint32(cab[48:], uint32(signatureSize))
+	}
+
+	// One uncompressed folder with one data block holding the file
+	binary.LittleEndian.PutUint32(cab[headerSize:], uint32(dataOffset))
+	binary.LittleEndian.PutUint16(cab[headerSize+4:], 1)
+	binary.LittleEndian.PutUint32(fileEntry, uint32(len(payload)))
+	copy(cab[filesOffset:], fileEntry)
+	binary.LittleEndian.PutUint16(cab[dataOffset+4:], uint16(len(payload)))
+	binary.LittleEndian.PutUint16(cab[dataOffset+6:], uint16(len(payload)))
+	copy(cab[dataOffset+8:], payload)
+	return cab
+}
+
+// writeSignedCABForTest writes a cabinet signed over its Authenticode digest
+// and returns its path
+func writeSignedCABForTest(t *testing.T, payload []byte) string {
+	t.Helper()
+	// The digest does not cover the signature size, so it can be computed
+	// before signing
+	unsigned := cabinetForTest(payload, true, 0)
+	h := crypto.SHA256.New()
+	h.Write(unsigned[0:4])
+	h.Write(unsigned[8:34])
+	h.Write(unsigned[56:])
+	signature := signAuthenticodeForTest(t, h.Sum(nil), crypto.SHA256)
+
+	cab := append(cabinetForTest(payload, true, len(signature)), signature...)
+	filePath := filepath.Join(t.TempDir(), "driver.cab")
+	if err := os.WriteFile(filePath, cab, 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	return filePath
+}
+
+func TestVerify_CAB(t *testing.T) {
+	filePath := writeSignedCABForTest(t, []byte("hello, cabinet"))
+
+	if fileType, err := DetectFileType(filePath); err != nil || fileType != FileTypeCAB {
+		t.Errorf("Expected FileTypeCAB, got %q (error %v)", fileType, err)
+	}
+	if err := Verify(filePath, nil); err != nil {
+		t.Errorf("Expected a valid signature, got: %v", err)
+	}
+	signature, err := ExtractDigitalSignature(filePath)
+	if err != nil || len(signature) == 0 {
+		t.Errorf("Expected the cabinet signature, got %d bytes (error %v)", len(signature), err)
+	}
+	info, err := Inspect(filePath)
+	if err != nil || info.Signer == nil {
+		t.Errorf("Expected signer details, got %+v (error %v)", info, err)
+	}
+}
+
+func TestVerify_CABTampered(t *testing.T) {
+	filePath := writeSignedCABForTest(t, []byte("hello, cabinet"))
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	// The file data and the fields the digest covers are protected; the
+	// cabinet index is not
+	tests := []struct {
+		name   string
+		offset int
+		want   error
+	}{
+		{"payload", cabSignedHeaderSize + cabFolderSize + 26 + 8, ErrDigestMismatch},
+		{"setID", 32, ErrDigestMismatch},
+		{"iCabinet", 34, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := append([]byte(nil), content...)
+			tampered[tt.offset] ^= 0xff
+			tamperedPath := filepath.Join(t.TempDir(), "driver.cab")
+			if err := os.WriteFile(tamperedPath, tampered, 0600); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+			if err := Verify(tamperedPath, nil); !errors.Is(err, tt.want) || (tt.want == nil) != (err == nil) {
+				t.Errorf("Expected %v, got: %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestVerify_CABUnsigned(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "unsigned.cab")
+	if err := os.WriteFile(filePath, cabinetForTest([]byte("hello"), false, 0), 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if _, err := ExtractDigitalSignature(filePath); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned, got: %v", err)
+	}
+	if err := Verify(filePath, nil); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned from Verify, got: %v", err)
+	}
+}
+
+func TestVerify_CABMalformed(t *testing.T) {
+	signed, err := os.ReadFile(writeSignedCABForTest(t, []byte("hello, cabinet")))
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func([]byte) []byte
+		want   error
+	}{
+		{"trailing data", func(b []byte) []byte { return append(b, "payload"...) }, ErrNotCabinet},
+		{"truncated signature", func(b []byte) []byte { return b[:len(b)-1] }, ErrSignatureTruncated},
+		{"multivolume", func(b []byte) []byte {
+			binary.LittleEndian.PutUint16(b[30:], cabFlagReservePresent|cabFlagNextCabinet)
+			return b
+		}, ErrNotCabinet},
+		{"misplaced file entries", func(b []byte) []byte {
+			binary.LittleEndian.PutUint32(b[16:], 100)
+			return b
+		}, ErrNotCabinet},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "malformed.cab")
+			if err := os.WriteFile(filePath, tt.mutate(append([]byte(nil), signed...)), 0600); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+			if err := Verify(filePath, nil); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got: %v", tt.want, err)
+			}
+		})
+	}
+}
+
+// cabinetFilesForTest builds a cabinet with a signature reserve whose one
+// folder holds files, in data blocks that are MSZIP-compressed when mszip is
+// set and stored otherwise
+func cabinetFilesForTest(t *testing.T, files []zipMemberForTest, mszip bool) []byte {
+	t.Helper()
+	var entries, stream []byte
+	for _, f := range files {
+		entry := binary.LittleEndian.AppendUint32(nil, uint32(len(f.data)))
+		entry = binary.LittleEndian.AppendUint32(entry, uint32(len(stream)))
+		entry = append(entry, make([]byte, 8)...)
+		entries = append(entries, append(append(entry, f.name...), 0)...)
+		stream = append(stream, f.data...)
+	}
+
+	var blocks []byte
+	count := 0
+	for offset := 0; offset < len(stream) || count == 0; offset += cabMaxBlockSize {
+		block := stream[offset:min(offset+cabMaxBlockSize, len(stream))]
+		data := block
+		if mszip {
+			var buf bytes.Buffer
+			buf.WriteString("CK")
+			w, err := flate.NewWriterDict(&buf, flate.BestCompression, stream[max(offset-cabMaxBlockSize, 0):offset])
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write(block)
+			w.Close()
+			data = buf.Bytes()
+		}
+		header := make([]byte, 8)
+		binary.LittleEndian.PutUint16(header[4:], uint16(len(data)))
+		binary.LittleEndian.PutUint16(header[6:], uint16(len(block)))
+		blocks = append(append(blocks, header...), data...)
+		count++
+	}
+
+	filesOffset := cabSignedHeaderSize + cabFolderSize
+	dataOffset := filesOffset + len(entries)
+	size := dataOffset + len(blocks)
+	cab := make([]byte, filesOffset)
+	copy(cab, cabinetMagic)
+	binary.LittleEndian.PutUint32(cab[8:], uint32(size))
+	binary.LittleEndian.PutUint32(cab[16:], uint32(filesOffset))
+	cab[24], cab[25] = 3, 1
+	binary.LittleEndian.PutUint16(cab[26:], 1)
+	binary.LittleEndian.PutUint16(cab[28:], uint16(len(files)))
+	binary.LittleEndian.PutUint16(cab[30:], cabFlagReservePresent)
+	binary.LittleEndian.PutUint32(cab[36:], cabSignatureReserve)
+	binary.LittleEndian.PutUint32(cab[40:], cabSignatureMagic)
+	binary.LittleEndian.PutUint32(cab[cabSignedHeaderSize:], uint32(dataOffset))
+	binary.LittleEndian.PutUint16(cab[cabSignedHeaderSize+4:], uint16(count))
+	if mszip {
+		binary.LittleEndian.PutUint16(cab[cabSignedHeaderSize+6:], cabCompressMSZIP)
+	}
+	return append(append(cab, entries...), blocks...)
+}
+
+// signCabinetForTest appends a signature by the test signer to cab, a
+// cabinet with an empty signature reserve
+func signCabinetForTest(t *testing.T, cab []byte) []byte {
+	t.Helper()
+	signed := append([]byte(nil), cab...)
+	binary.LittleEndian.PutUint32(signed[44:], uint32(len(cab)))
+	h := crypto.SHA256.New()
+	h.Write(signed[0:4])
+	h.Write(signed[8:34])
+	h.Write(signed[56:])
+	signature := signAuthenticodeForTest(t, h.Sum(nil), crypto.SHA256)
+	binary.LittleEndian.PutUint32(signed[48:], uint32(len(signature)))
+	return append(signed, signature...)
+}
+
+func TestWalkCABFiles(t *testing.T) {
+	large := make([]byte, 3*cabMaxBlockSize+100)
+	for i := range large {
+		large[i] = byte(i * 7 / 5)
+	}
+	files := []zipMemberForTest{
+		{"update.mum", []byte("<assembly/>")},
+		{`amd64\large.bin`, large},
+		{"empty.txt", nil},
+	}
+	for _, mszip := range []bool{false, true} {
+		cab := signCabinetForTest(t, cabinetFilesForTest(t, files, mszip))
+		var got []zipMemberForTest
+		err := walkCABFiles(bytes.NewReader(cab), int64(len(cab)), func(name string, size int64, contents io.Reader) error {
+			data, err := io.ReadAll(contents)
+			if int64(len(data)) != size {
+				t.Errorf("%s: expected %d bytes, got %d", name, size, len(data))
+			}
+			got = append(got, zipMemberForTest{name, data})
+			return err
+		})
+		if err != nil {
+			t.Fatalf("MSZIP %v: walkCABFiles failed: %v", mszip, err)
+		}
+		if len(got) != len(files) {
+			t.Fatalf("MSZIP %v: expected %d files, got %d", mszip, len(files), len(got))
+		}
+		for i, f := range files {
+			if want := strings.ReplaceAll(f.name, `\`, "/"); got[i].name != want || !bytes.Equal(got[i].data, f.data) {
+				t.Errorf("MSZIP %v: file %d is %s of %d bytes, expected %s of %d", mszip, i, got[i].name, len(got[i].data), want, len(f.data))
+			}
+		}
+	}
+
+	// LZX folders cannot be read
+	cab := cabinetFilesForTest(t, files, false)
+	binary.LittleEndian.PutUint16(cab[cabSignedHeaderSize+6:], 3)
+	err := walkCABFiles(bytes.NewReader(cab), int64(len(cab)), func(string, int64, io.Reader) error { return nil })
+	if !errors.Is(err, ErrNotCabinet) {
+		t.Errorf("Expected ErrNotCabinet for an LZX folder, got %v", err)
+	}
+}
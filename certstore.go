@@ -0,0 +1,70 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+)
+
+// WindowsStores holds the certificates of the local machine's Windows
+// certificate stores, as used by WinVerifyTrust.
+type WindowsStores struct {
+	// Roots are the certificates of the ROOT store
+	Roots *x509.CertPool
+	// Intermediates are the certificates of the CA store
+	Intermediates []*x509.Certificate
+	// TrustedPublishers are the certificates of the TrustedPublisher store
+	TrustedPublishers []*x509.Certificate
+}
+
+// LoadWindowsStores reads the ROOT, CA and TrustedPublisher stores of the
+// local machine through the crypt32 APIs.
+//
+// It is only supported on Windows; on other platforms it returns
+// ErrWindowsStoresUnavailable. Certificates that Go cannot parse are skipped.
+//
+// Returns:
+//   - *WindowsStores: The certificates of each store
+//   - error: An error if a store cannot be opened or enumerated
+//
+// Example usage:
+//
+//	stores, err := sigtool.LoadWindowsStores()
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	err = sigtool.Verify("signed.exe", &sigtool.VerifyOptions{
+//	    Roots:         stores.Roots,
+//	    Intermediates: stores.Intermediates,
+//	})
+func LoadWindowsStores() (*WindowsStores, error) {
+	roots, err := loadWindowsStore("ROOT")
+	if err != nil {
+		return nil, err
+	}
+	intermediates, err := loadWindowsStore("CA")
+	if err != nil {
+		return nil, err
+	}
+	publishers, err := loadWindowsStore("TrustedPublisher")
+	if err != nil {
+		return nil, err
+	}
+
+	return &WindowsStores{
+		Roots:             certificatePool(roots),
+		Intermediates:     intermediates,
+		TrustedPublishers: publishers,
+	}, nil
+}
+
+// checkTrustedPublisher reports ErrUntrustedPublisher unless signer is one
+// of publishers
+func checkTrustedPublisher(signer *x509.Certificate, publishers []*x509.Certificate) error {
+	for _, cert := range publishers {
+		if bytes.Equal(cert.Raw, signer.Raw) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrUntrustedPublisher, signer.Subject)
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package sigtool
+
+import "crypto/x509"
+
+// loadWindowsStore is unavailable outside Windows
+func loadWindowsStore(name string) ([]*x509.Certificate, error) {
+	return nil, ErrWindowsStoresUnavailable
+}
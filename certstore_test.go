@@ -0,0 +1,46 @@
+package sigtool
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestLoadWindowsStores_Platform(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows stores are available on this platform")
+	}
+
+	if _, err := LoadWindowsStores(); !errors.Is(err, ErrWindowsStoresUnavailable) {
+		t.Errorf("Expected ErrWindowsStoresUnavailable, got: %v", err)
+	}
+
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+	if err := Verify(filePath, &VerifyOptions{UseWindowsStores: true}); !errors.Is(err, ErrWindowsStoresUnavailable) {
+		t.Errorf("Expected ErrWindowsStoresUnavailable from Verify, got: %v", err)
+	}
+}
+
+func TestVerify_RequireTrustedPublisherNeedsStores(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+
+	err := Verify(filePath, &VerifyOptions{RequireTrustedPublisher: true})
+	if err == nil || !strings.Contains(err.Error(), "requires UseWindowsStores") {
+		t.Errorf("Expected 'requires UseWindowsStores' error, got: %v", err)
+	}
+}
+
+func TestCheckTrustedPublisher(t *testing.T) {
+	cert, _ := testSigner(t)
+	tsa, _ := testTSA(t)
+
+	if err := checkTrustedPublisher(cert, []*x509.Certificate{tsa, cert}); err != nil {
+		t.Errorf("Expected trusted publisher, got: %v", err)
+	}
+	if err := checkTrustedPublisher(cert, []*x509.Certificate{tsa}); !errors.Is(err, ErrUntrustedPublisher) {
+		t.Errorf("Expected ErrUntrustedPublisher, got: %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+//go:build windows
+
+package sigtool
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	certStoreProvSystemW        = 10
+	certSystemStoreLocalMachine = 2 << 16
+	certStoreReadOnlyFlag       = 0x00008000
+	certStoreOpenExistingFlag   = 0x00004000
+	cryptENotFound              = syscall.Errno(0x80092004)
+	x509ASNEncodingAndPKCS7ASN  = syscall.X509_ASN_ENCODING | syscall.PKCS_7_ASN_ENCODING
+)
+
+// loadWindowsStore returns the parseable certificates of the named local
+// machine system store
+func loadWindowsStore(name string) ([]*x509.Certificate, error) {
+	storeName, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate store name %q: %w", name, err)
+	}
+
+	store, err := syscall.CertOpenStore(
+		certStoreProvSystemW,
+		x509ASNEncodingAndPKCS7ASN,
+		0,
+		certSystemStoreLocalMachine|certStoreReadOnlyFlag|certStoreOpenExistingFlag,
+		uintptr(unsafe.Pointer(storeName)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s certificate store: %w", name, err)
+	}
+	defer syscall.CertCloseStore(store, 0)
+
+	var certs []*x509.Certificate
+	var ctx *syscall.CertContext
+	for {
+		ctx, err = syscall.CertEnumCertificatesInStore(store, ctx)
+		if err != nil {
+			if errors.Is(err, cryptENotFound) {
+				break
+			}
+			return nil, fmt.Errorf("failed to enumerate %s certificate store: %w", name, err)
+		}
+		if ctx == nil {
+			break
+		}
+
+		der := unsafe.Slice(ctx.EncodedCert, ctx.Length)
+		cert, err := x509.ParseCertificate(append([]byte(nil), der...))
+		if err != nil {
+			continue
+		}
+		certs = append(certs, cert)
+	}
+
+	return certs, nil
+}
@@ -0,0 +1,15 @@
+//go:build windows
+
+package sigtool
+
+import "testing"
+
+func TestLoadWindowsStores_Windows(t *testing.T) {
+	stores, err := LoadWindowsStores()
+	if err != nil {
+		t.Fatalf("Expected Windows stores to load, got: %v", err)
+	}
+	if stores.Roots == nil {
+		t.Error("Expected a ROOT store pool")
+	}
+}
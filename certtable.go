@@ -0,0 +1,213 @@
+package sigtool
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// WIN_CERTIFICATE revision values
+const (
+	WinCertRevision1_0 uint16 = 0x0100
+	WinCertRevision2_0 uint16 = 0x0200
+)
+
+// WIN_CERTIFICATE certificate type values
+const (
+	WinCertTypeX509            uint16 = 0x0001
+	WinCertTypePKCSSignedData  uint16 = 0x0002
+	WinCertTypeReserved1       uint16 = 0x0003
+	WinCertTypeTSStackSigned   uint16 = 0x0004
+	winCertificateHeaderLength        = 8
+)
+
+// WinCertificate is a single WIN_CERTIFICATE entry of a PE certificate table.
+type WinCertificate struct {
+	// Offset is the file offset of the entry, including its 8-byte header
+	Offset int64
+	// Length is the dwLength field: the entry size including the header
+	// but excluding alignment padding
+	Length uint32
+	// Revision is the wRevision field, normally WinCertRevision2_0
+	Revision uint16
+	// CertificateType is the wCertificateType field, normally
+	// WinCertTypePKCSSignedData for Authenticode
+	CertificateType uint16
+	// Data is the bCertificate payload following the header
+	Data []byte
+	// Padding holds the alignment bytes stored between the end of the entry
+	// and the next 8-byte boundary or the end of the table
+	Padding []byte
+}
+
+// Bytes returns the entry exactly as stored in the certificate table: the
+// 8-byte header, the payload and its alignment padding.
+func (c WinCertificate) Bytes() []byte {
+	raw := make([]byte, winCertificateHeaderLength, winCertificateHeaderLength+len(c.Data)+len(c.Padding))
+	binary.LittleEndian.PutUint32(raw, c.Length)
+	binary.LittleEndian.PutUint16(raw[4:], c.Revision)
+	binary.LittleEndian.PutUint16(raw[6:], c.CertificateType)
+	raw = append(raw, c.Data...)
+	return append(raw, c.Padding...)
+}
+
+// ExtractAllCertificates returns every WIN_CERTIFICATE entry stored in the
+// certificate table of a PE file.
+//
+// The security directory can hold several 8-byte aligned entries back to
+// back; ExtractDigitalSignature only returns the first one. This function
+// walks the whole table and reports the revision and certificate type of each
+// entry along with its payload.
+//
+// Parameters:
+//   - filePath: The path to the signed PE file
+//
+// Returns:
+//   - []WinCertificate: The entries in table order
+//   - error: An error if the table cannot be read or is malformed
+//
+// Example usage:
+//
+//	certs, err := sigtool.ExtractAllCertificates("signed.exe")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	for _, c := range certs {
+//	    fmt.Printf("revision %#x type %#x: %d bytes\n", c.Revision, c.CertificateType, len(c.Data))
+//	}
+func ExtractAllCertificates(filePath string) ([]WinCertificate, error) {
+	if strings.TrimSpace(filePath) == "" {
+		return nil, errors.New("file path cannot be empty")
+	}
+
+	// #nosec G304 - This tool is designed to read user-specified PE files
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %q: %w", filePath, err)
+	}
+	defer f.Close()
+
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	layout, err := readLayout(f, fileInfo.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	return readCertificateTable(f, layout)
+}
+
+// ExtractCertificateTable returns the certificate table of a PE file exactly
+// as stored in the security directory.
+//
+// Unlike ExtractDigitalSignature, which returns only the PKCS#7 payload of
+// the first entry, the result keeps every WIN_CERTIFICATE header and the
+// alignment padding between entries, so it can be byte-compared with the
+// table of another file or re-embedded unchanged.
+//
+// Parameters:
+//   - filePath: The path to the signed PE file
+//
+// Returns:
+//   - []byte: The raw certificate table
+//   - error: An error if the file is not signed or the table is out of bounds
+//
+// Example usage:
+//
+//	a, _ := sigtool.ExtractCertificateTable("original.exe")
+//	b, _ := sigtool.ExtractCertificateTable("rebuilt.exe")
+//	fmt.Println("identical security directory:", bytes.Equal(a, b))
+func ExtractCertificateTable(filePath string) ([]byte, error) {
+	if strings.TrimSpace(filePath) == "" {
+		return nil, errors.New("file path cannot be empty")
+	}
+
+	// #nosec G304 - This tool is designed to read user-specified PE files
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %q: %w", filePath, err)
+	}
+	defer f.Close()
+
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	layout, err := readLayout(f, fileInfo.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	return readCertificateTableRaw(f, layout)
+}
+
+// readCertificateTableRaw reads the bytes of the table described by layout
+func readCertificateTableRaw(r io.ReaderAt, layout *peLayout) ([]byte, error) {
+	if layout.certTableOffset == 0 || layout.certTableSize == 0 {
+		return nil, ErrNotSigned
+	}
+	if layout.certTableSize > MaxSignatureSize {
+		return nil, &SignatureSizeError{Size: layout.certTableSize, Limit: MaxSignatureSize}
+	}
+
+	start := layout.certTableOffset
+	end := start + layout.certTableSize
+	if start < 0 || end > layout.size {
+		return nil, &SignatureBoundsError{
+			Offset:   start,
+			Length:   layout.certTableSize,
+			FileSize: layout.size,
+			Reason:   "certificate table extends beyond file bounds",
+		}
+	}
+
+	table := make([]byte, layout.certTableSize)
+	if _, err := r.ReadAt(table, start); err != nil {
+		return nil, fmt.Errorf("failed to read certificate table: %w", err)
+	}
+	return table, nil
+}
+
+// readCertificateTable walks the WIN_CERTIFICATE entries of the table
+// described by layout
+func readCertificateTable(r io.ReaderAt, layout *peLayout) ([]WinCertificate, error) {
+	table, err := readCertificateTableRaw(r, layout)
+	if err != nil {
+		return nil, err
+	}
+	start := layout.certTableOffset
+
+	var certs []WinCertificate
+	for pos := int64(0); pos+winCertificateHeaderLength <= int64(len(table)); {
+		length := binary.LittleEndian.Uint32(table[pos:])
+		if length < winCertificateHeaderLength || pos+int64(length) > int64(len(table)) {
+			return nil, &SignatureBoundsError{
+				Offset:   start + pos,
+				Length:   int64(length),
+				FileSize: layout.size,
+				Reason:   fmt.Sprintf("invalid WIN_CERTIFICATE length %d at offset %d", length, start+pos),
+			}
+		}
+
+		// Entries are aligned on 8-byte boundaries
+		next := min(pos+(int64(length)+7)&^7, int64(len(table)))
+		certs = append(certs, WinCertificate{
+			Offset:          start + pos,
+			Length:          length,
+			Revision:        binary.LittleEndian.Uint16(table[pos+4:]),
+			CertificateType: binary.LittleEndian.Uint16(table[pos+6:]),
+			Data:            table[pos+winCertificateHeaderLength : pos+int64(length)],
+			Padding:         table[pos+int64(length) : next],
+		})
+		pos = next
+	}
+
+	return certs, nil
+}
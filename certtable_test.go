@@ -0,0 +1,146 @@
+package sigtool
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// winCertificateEntry encodes a WIN_CERTIFICATE entry padded to 8 bytes
+func winCertificateEntry(revision, certType uint16, data []byte) []byte {
+	length := 8 + len(data)
+	entry := make([]byte, (length+7)&^7)
+	binary.LittleEndian.PutUint32(entry, uint32(length))
+	binary.LittleEndian.PutUint16(entry[4:], revision)
+	binary.LittleEndian.PutUint16(entry[6:], certType)
+	copy(entry[8:], data)
+	return entry
+}
+
+// createMockPEWithTable writes a mock PE whose certificate table is table
+func createMockPEWithTable(t *testing.T, table []byte) string {
+	t.Helper()
+
+	image := mockPEImage(nil)
+	binary.LittleEndian.PutUint32(image[mockSecDirOffset:], uint32(len(image)))
+	binary.LittleEndian.PutUint32(image[mockSecDirOffset+4:], uint32(len(table)))
+
+	filePath := filepath.Join(t.TempDir(), "table.exe")
+	if err := os.WriteFile(filePath, append(image, table...), 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	return filePath
+}
+
+func TestExtractAllCertificates_MultipleEntries(t *testing.T) {
+	first := []byte("first-pkcs7-blob")
+	second := []byte("x509")
+	table := append(winCertificateEntry(WinCertRevision2_0, WinCertTypePKCSSignedData, first),
+		winCertificateEntry(WinCertRevision1_0, WinCertTypeX509, second)...)
+	filePath := createMockPEWithTable(t, table)
+
+	certs, err := ExtractAllCertificates(filePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(certs) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(certs))
+	}
+
+	if certs[0].Revision != WinCertRevision2_0 || certs[0].CertificateType != WinCertTypePKCSSignedData {
+		t.Errorf("Unexpected first entry header: %+v", certs[0])
+	}
+	if !bytes.Equal(certs[0].Data, first) || certs[0].Length != uint32(8+len(first)) {
+		t.Errorf("Unexpected first entry payload %q (length %d)", certs[0].Data, certs[0].Length)
+	}
+	if certs[1].Revision != WinCertRevision1_0 || certs[1].CertificateType != WinCertTypeX509 {
+		t.Errorf("Unexpected second entry header: %+v", certs[1])
+	}
+	if !bytes.Equal(certs[1].Data, second) {
+		t.Errorf("Unexpected second entry payload %q", certs[1].Data)
+	}
+	if certs[1].Offset != certs[0].Offset+int64(len(table)-16) {
+		t.Errorf("Expected second entry to start on an 8-byte boundary, got offset %d", certs[1].Offset)
+	}
+}
+
+func TestExtractAllCertificates_InvalidLength(t *testing.T) {
+	table := winCertificateEntry(WinCertRevision2_0, WinCertTypePKCSSignedData, []byte("blob"))
+	binary.LittleEndian.PutUint32(table, 4096)
+	filePath := createMockPEWithTable(t, table)
+
+	_, err := ExtractAllCertificates(filePath)
+	if !errors.Is(err, ErrSignatureTruncated) {
+		t.Errorf("Expected ErrSignatureTruncated, got: %v", err)
+	}
+}
+
+func TestExtractAllCertificates_Unsigned(t *testing.T) {
+	_, err := ExtractAllCertificates(createMockPEFile(t, false, nil))
+	if !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned, got: %v", err)
+	}
+}
+
+func TestExtractCertificateTable(t *testing.T) {
+	table := append(winCertificateEntry(WinCertRevision2_0, WinCertTypePKCSSignedData, []byte("first-pkcs7")),
+		winCertificateEntry(WinCertRevision1_0, WinCertTypeX509, []byte("x509"))...)
+	// Non-zero padding must be preserved byte for byte
+	table[19] = 0xcc
+	filePath := createMockPEWithTable(t, table)
+
+	raw, err := ExtractCertificateTable(filePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !bytes.Equal(raw, table) {
+		t.Errorf("Expected the table as stored, got %x", raw)
+	}
+
+	certs, err := ExtractAllCertificates(filePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	var rebuilt []byte
+	for _, c := range certs {
+		rebuilt = append(rebuilt, c.Bytes()...)
+	}
+	if !bytes.Equal(rebuilt, table) {
+		t.Errorf("Expected the entries to reassemble the table, got %x", rebuilt)
+	}
+	if !bytes.Equal(certs[0].Padding, []byte{0xcc, 0, 0, 0, 0}) {
+		t.Errorf("Unexpected padding of the first entry: %x", certs[0].Padding)
+	}
+
+	if _, err := ExtractCertificateTable(createMockPEWithTable(t, nil)); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned, got: %v", err)
+	}
+}
+
+func TestExtractDigitalSignature_NonPKCS7Type(t *testing.T) {
+	payload := []byte("x509-certificate")
+	filePath := createMockPEWithTable(t, winCertificateEntry(WinCertRevision1_0, WinCertTypeX509, payload))
+
+	_, err := ExtractDigitalSignature(filePath)
+	if !errors.Is(err, ErrUnsupportedCertificateType) {
+		t.Fatalf("Expected ErrUnsupportedCertificateType, got: %v", err)
+	}
+	var typeErr *CertificateTypeError
+	if !errors.As(err, &typeErr) {
+		t.Fatalf("Expected *CertificateTypeError, got %T", err)
+	}
+	if typeErr.Type != WinCertTypeX509 || typeErr.Revision != WinCertRevision1_0 || !bytes.HasPrefix(typeErr.Data, payload) {
+		t.Errorf("Unexpected error details: %+v", typeErr)
+	}
+	if !strings.Contains(err.Error(), "WIN_CERT_TYPE_X509") {
+		t.Errorf("Expected the type name in the error, got: %v", err)
+	}
+
+	if err := IsValidDigitalSignature(filePath); !errors.Is(err, ErrUnsupportedCertificateType) {
+		t.Errorf("Expected ErrUnsupportedCertificateType from validation, got: %v", err)
+	}
+}
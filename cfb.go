@@ -0,0 +1,324 @@
+package sigtool
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"unicode/utf16"
+)
+
+// compoundFileMagic starts every OLE compound file, the container of
+// Windows Installer packages and legacy Office documents
+var compoundFileMagic = []byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}
+
+// Special sector numbers of the compound file allocation tables
+const (
+	cfbMaxRegularSector = 0xfffffffa
+	cfbEndOfChain       = 0xfffffffe
+	cfbFreeSector       = 0xffffffff
+	cfbNoStream         = 0xffffffff
+)
+
+// Compound file directory entry object types
+const (
+	cfbStorage = 1
+	cfbStream  = 2
+	cfbRoot    = 5
+)
+
+const (
+	cfbHeaderSize   = 512
+	cfbEntrySize    = 128
+	cfbHeaderDIFATs = 109
+	// maxCompoundStreamSize bounds the streams read into memory
+	maxCompoundStreamSize = 1 << 30
+)
+
+// compoundFile is a parsed OLE compound file (MS-CFB): its allocation
+// tables and directory
+type compoundFile struct {
+	r              io.ReaderAt
+	size           int64
+	major          uint16
+	sectorSize     int64
+	miniSectorSize int64
+	miniCutoff     uint64
+	fat            []uint32
+	miniFAT        []uint32
+	entries        []cfbEntry
+	// miniStream is the root entry stream holding the small streams, read
+	// on first use
+	miniStream []byte
+}
+
+// cfbEntry is a compound file directory entry
+type cfbEntry struct {
+	// rawName is the UTF-16LE name including its NUL terminator, as the
+	// Windows Installer digest orders entries by it
+	rawName            []byte
+	objectType         byte
+	left, right, child uint32
+	clsid              [16]byte
+	stateBits          [4]byte
+	created, modified  [8]byte
+	start              uint32
+	size               uint64
+	name               string
+	// id is the index of the entry in the directory
+	id uint32
+}
+
+// isCompoundFile reports whether r starts with the compound file signature
+func isCompoundFile(r io.ReaderAt, size int64) bool {
+	if size < cfbHeaderSize {
+		return false
+	}
+	magic := make([]byte, len(compoundFileMagic))
+	if _, err := r.ReadAt(magic, 0); err != nil {
+		return false
+	}
+	return bytes.Equal(magic, compoundFileMagic)
+}
+
+// openCompoundFile parses the header, allocation tables and directory of the
+// compound file r
+func openCompoundFile(r io.ReaderAt, size int64) (*compoundFile, error) {
+	if !isCompoundFile(r, size) {
+		return nil, ErrNotCompoundFile
+	}
+	header := make([]byte, cfbHeaderSize)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("failed to read compound file header: %w", err)
+	}
+	cf := &compoundFile{r: r, size: size, major: binary.LittleEndian.Uint16(header[26:])}
+	sectorShift := binary.LittleEndian.Uint16(header[30:])
+	miniShift := binary.LittleEndian.Uint16(header[32:])
+	if (cf.major != 3 || sectorShift != 9) && (cf.major != 4 || sectorShift != 12) || miniShift != 6 {
+		return nil, fmt.Errorf("%w: unsupported version %d with sector shift %d", ErrNotCompoundFile, cf.major, sectorShift)
+	}
+	cf.sectorSize = 1 << sectorShift
+	cf.miniSectorSize = 1 << miniShift
+	cf.miniCutoff = uint64(binary.LittleEndian.Uint32(header[56:]))
+
+	// The sectors of the FAT are listed in the header and then in the chain
+	// of DIFAT sectors
+	fatSectors := binary.LittleEndian.Uint32(header[44:])
+	if int64(fatSectors) > size/cf.sectorSize {
+		return nil, fmt.Errorf("%w: %d FAT sectors in a file of %d bytes", ErrNotCompoundFile, fatSectors, size)
+	}
+	difat := make([]uint32, 0, fatSectors)
+	for i := 0; i < cfbHeaderDIFATs && uint32(len(difat)) < fatSectors; i++ {
+		difat = append(difat, binary.LittleEndian.Uint32(header[76+4*i:]))
+	}
+	next := binary.LittleEndian.Uint32(header[68:])
+	perSector := int(cf.sectorSize/4) - 1
+	for visited := 0; uint32(len(difat)) < fatSectors; visited++ {
+		if next > cfbMaxRegularSector || int64(visited) > size/cf.sectorSize {
+			return nil, fmt.Errorf("%w: truncated DIFAT", ErrNotCompoundFile)
+		}
+		sector, err := cf.readSector(next)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < perSector && uint32(len(difat)) < fatSectors; i++ {
+			difat = append(difat, binary.LittleEndian.Uint32(sector[4*i:]))
+		}
+		next = binary.LittleEndian.Uint32(sector[4*perSector:])
+	}
+	for _, s := range difat {
+		sector, err := cf.readSector(s)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read FAT: %w", err)
+		}
+		cf.fat = append(cf.fat, sectorEntries(sector)...)
+	}
+
+	dir, err := cf.readChain(binary.LittleEndian.Uint32(header[48:]), -1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compound file directory: %w", err)
+	}
+	for offset := 0; offset+cfbEntrySize <= len(dir); offset += cfbEntrySize {
+		e := parseCFBEntry(dir[offset:offset+cfbEntrySize], cf.major)
+		e.id = uint32(len(cf.entries))
+		cf.entries = append(cf.entries, e)
+	}
+	if len(cf.entries) == 0 || cf.entries[0].objectType != cfbRoot {
+		return nil, fmt.Errorf("%w: missing root entry", ErrNotCompoundFile)
+	}
+
+	if miniFATStart := binary.LittleEndian.Uint32(header[60:]); miniFATStart <= cfbMaxRegularSector {
+		miniFAT, err := cf.readChain(miniFATStart, -1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mini FAT: %w", err)
+		}
+		cf.miniFAT = sectorEntries(miniFAT)
+	}
+	return cf, nil
+}
+
+// parseCFBEntry decodes a 128-byte directory entry
+func parseCFBEntry(b []byte, major uint16) cfbEntry {
+	e := cfbEntry{
+		objectType: b[66],
+		left:       binary.LittleEndian.Uint32(b[68:]),
+		right:      binary.LittleEndian.Uint32(b[72:]),
+		child:      binary.LittleEndian.Uint32(b[76:]),
+		start:      binary.LittleEndian.Uint32(b[116:]),
+		size:       binary.LittleEndian.Uint64(b[120:]),
+	}
+	nameLen := min(int(binary.LittleEndian.Uint16(b[64:])), 64) &^ 1
+	e.rawName = append([]byte(nil), b[:nameLen]...)
+	copy(e.clsid[:], b[80:96])
+	copy(e.stateBits[:], b[96:100])
+	copy(e.created[:], b[100:108])
+	copy(e.modified[:], b[108:116])
+	if major == 3 {
+		// Version 3 files may leave garbage in the high half of the size
+		e.size &= 0xffffffff
+	}
+	units := make([]uint16, 0, nameLen/2)
+	for i := 0; i+1 < nameLen; i += 2 {
+		if u := binary.LittleEndian.Uint16(b[i:]); u != 0 {
+			units = append(units, u)
+		}
+	}
+	e.name = string(utf16.Decode(units))
+	return e
+}
+
+// sectorEntries decodes the little-endian sector numbers of an allocation
+// table sector
+func sectorEntries(b []byte) []uint32 {
+	entries := make([]uint32, len(b)/4)
+	for i := range entries {
+		entries[i] = binary.LittleEndian.Uint32(b[4*i:])
+	}
+	return entries
+}
+
+// readSector returns the regular sector n
+func (cf *compoundFile) readSector(n uint32) ([]byte, error) {
+	offset := (int64(n) + 1) * cf.sectorSize
+	if n > cfbMaxRegularSector || offset+cf.sectorSize > cf.size {
+		// The last sector of a file may be truncated
+		if n <= cfbMaxRegularSector && offset < cf.size {
+			buf := make([]byte, cf.sectorSize)
+			if _, err := cf.r.ReadAt(buf[:cf.size-offset], offset); err != nil {
+				return nil, fmt.Errorf("failed to read sector %d: %w", n, err)
+			}
+			return buf, nil
+		}
+		return nil, fmt.Errorf("%w: sector %d is outside the file", ErrNotCompoundFile, n)
+	}
+	buf := make([]byte, cf.sectorSize)
+	if _, err := cf.r.ReadAt(buf, offset); err != nil {
+		return nil, fmt.Errorf("failed to read sector %d: %w", n, err)
+	}
+	return buf, nil
+}
+
+// readChain returns the sectors of the FAT chain starting at start,
+// truncated to size bytes unless size is negative
+func (cf *compoundFile) readChain(start uint32, size int64) ([]byte, error) {
+	var out []byte
+	for n, visited := start, 0; n != cfbEndOfChain; visited++ {
+		if n >= uint32(len(cf.fat)) || visited > len(cf.fat) {
+			return nil, fmt.Errorf("%w: broken sector chain at %d", ErrNotCompoundFile, n)
+		}
+		if size >= 0 && int64(len(out)) >= size {
+			break
+		}
+		sector, err := cf.readSector(n)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sector...)
+		n = cf.fat[n]
+	}
+	if size >= 0 {
+		if int64(len(out)) < size {
+			return nil, fmt.Errorf("%w: stream of %d bytes is truncated", ErrNotCompoundFile, size)
+		}
+		out = out[:size]
+	}
+	return out, nil
+}
+
+// readStream returns the contents of the stream entry e
+func (cf *compoundFile) readStream(e *cfbEntry) ([]byte, error) {
+	if e.size > maxCompoundStreamSize || int64(e.size) > cf.size {
+		return nil, fmt.Errorf("%w: stream %q of %d bytes is too large", ErrNotCompoundFile, e.name, e.size)
+	}
+	if e.size == 0 {
+		return nil, nil
+	}
+	if e.objectType == cfbRoot || e.size >= cf.miniCutoff {
+		return cf.readChain(e.start, int64(e.size))
+	}
+
+	if cf.miniStream == nil {
+		root := &cf.entries[0]
+		if int64(root.size) > cf.size {
+			return nil, fmt.Errorf("%w: mini stream of %d bytes is too large", ErrNotCompoundFile, root.size)
+		}
+		mini, err := cf.readChain(root.start, int64(root.size))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mini stream: %w", err)
+		}
+		cf.miniStream = mini
+	}
+	out := make([]byte, 0, e.size)
+	for n, visited := e.start, 0; uint64(len(out)) < e.size; visited++ {
+		if n >= uint32(len(cf.miniFAT)) || visited > len(cf.miniFAT) {
+			return nil, fmt.Errorf("%w: broken mini sector chain in stream %q", ErrNotCompoundFile, e.name)
+		}
+		offset := int64(n) * cf.miniSectorSize
+		if offset+cf.miniSectorSize > int64(len(cf.miniStream)) {
+			return nil, fmt.Errorf("%w: mini sector %d is outside the mini stream", ErrNotCompoundFile, n)
+		}
+		out = append(out, cf.miniStream[offset:offset+cf.miniSectorSize]...)
+		n = cf.miniFAT[n]
+	}
+	return out[:e.size], nil
+}
+
+// children returns the entries of the storage entry id, in tree order
+func (cf *compoundFile) children(id uint32) ([]*cfbEntry, error) {
+	var out []*cfbEntry
+	visited := make(map[uint32]bool)
+	var walk func(n uint32) error
+	walk = func(n uint32) error {
+		if n == cfbNoStream {
+			return nil
+		}
+		if n >= uint32(len(cf.entries)) || visited[n] {
+			return fmt.Errorf("%w: broken directory tree at entry %d", ErrNotCompoundFile, n)
+		}
+		visited[n] = true
+		e := &cf.entries[n]
+		if err := walk(e.left); err != nil {
+			return err
+		}
+		out = append(out, e)
+		return walk(e.right)
+	}
+	if err := walk(cf.entries[id].child); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// findChild returns the child of the storage entry id named name
+func (cf *compoundFile) findChild(id uint32, name string) (*cfbEntry, error) {
+	children, err := cf.children(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range children {
+		if e.name == name {
+			return e, nil
+		}
+	}
+	return nil, nil
+}
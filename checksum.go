@@ -0,0 +1,45 @@
+package sigtool
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// UpdateChecksum recomputes the CheckSum field of the optional header of a
+// PE file and stores it, replacing the file atomically. Drivers, boot images
+// and some catalog tools are rejected when the stored checksum is stale.
+//
+// SignPE, AttachSignature, RemoveDigitalSignature and the other operations
+// that rewrite the certificate table update the checksum themselves; this is
+// for images changed by other tools. The checksum is excluded from the
+// Authenticode digest, so updating it keeps an existing signature valid.
+//
+// Parameters:
+//   - filePath: The path to the PE file
+//
+// Returns:
+//   - error: An error if the file is not a PE image or cannot be written
+//
+// Example usage:
+//
+//	if err := sigtool.UpdateChecksum("driver.sys"); err != nil {
+//	    log.Fatal(err)
+//	}
+func UpdateChecksum(filePath string) error {
+	// #nosec G304
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	layout, err := readLayout(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	if binary.LittleEndian.Uint32(data[layout.checksumOffset:]) == peChecksum(data, layout.checksumOffset) {
+		return nil
+	}
+	updateChecksum(data, layout)
+	return writeFileAtomic(filePath, data)
+}
@@ -0,0 +1,53 @@
+package sigtool
+
+import (
+	"crypto"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateChecksum(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	binary.LittleEndian.PutUint32(data[mockChecksumOffset:], 0xdeadbeef)
+	if err := os.WriteFile(filePath, data, 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if err := UpdateChecksum(filePath); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	data, err = os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if got, want := binary.LittleEndian.Uint32(data[mockChecksumOffset:]), peChecksum(data, mockChecksumOffset); got != want {
+		t.Errorf("Expected checksum %#x, got %#x", want, got)
+	}
+	if err := Verify(filePath, nil); err != nil {
+		t.Errorf("Expected the signature to survive a checksum update, got: %v", err)
+	}
+
+	// An up-to-date checksum leaves the file untouched
+	if err := UpdateChecksum(filePath); err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+}
+
+func TestUpdateChecksum_Invalid(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "invalid.exe")
+	if err := os.WriteFile(filePath, []byte("not a PE file"), 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := UpdateChecksum(filePath); err == nil {
+		t.Error("Expected error for a non-PE file, got nil")
+	}
+	if err := UpdateChecksum(filePath + ".missing"); err == nil {
+		t.Error("Expected error for a missing file, got nil")
+	}
+}
@@ -0,0 +1,94 @@
+package sigtool
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// DefaultKMSTimeout bounds each request to a cloud key management service
+	DefaultKMSTimeout = 30 * time.Second
+	// maxKMSResponseSize bounds the size of a key management service response
+	maxKMSResponseSize = 1 << 20
+)
+
+// kmsClient returns client, or a client bounded by timeout when it is nil
+func kmsClient(client *http.Client, timeout time.Duration) *http.Client {
+	if client != nil {
+		return client
+	}
+	if timeout <= 0 {
+		timeout = DefaultKMSTimeout
+	}
+	return &http.Client{Timeout: timeout}
+}
+
+// kmsContext returns the context for a crypto.Signer call, which carries
+// none of its own
+func kmsContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		timeout = DefaultKMSTimeout
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// doKMSRequest sends req with client and decodes the JSON response body into
+// out. Error responses are reported with the message of the service.
+func doKMSRequest(client *http.Client, req *http.Request, service string, out interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", service, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxKMSResponseSize+1))
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", service, err)
+	}
+	if len(body) > maxKMSResponseSize {
+		return fmt.Errorf("%s response exceeds %d bytes", service, maxKMSResponseSize)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// Azure wraps errors in an "error" object; AWS uses __type and
+		// message at the top level
+		var failure struct {
+			Error *struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(body, &failure) == nil {
+			switch {
+			case failure.Error != nil:
+				return fmt.Errorf("%s request failed: %s: %s: %s", service, resp.Status, failure.Error.Code, failure.Error.Message)
+			case failure.Type != "":
+				return fmt.Errorf("%s request failed: %s: %s: %s", service, resp.Status, failure.Type, failure.Message)
+			}
+		}
+		return fmt.Errorf("%s request failed: %s", service, resp.Status)
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("invalid %s response: %w", service, err)
+	}
+	return nil
+}
+
+// kmsHashName returns the digest suffix cloud signing algorithms use for h
+func kmsHashName(h crypto.Hash) (string, error) {
+	switch h {
+	case crypto.SHA256:
+		return "256", nil
+	case crypto.SHA384:
+		return "384", nil
+	case crypto.SHA512:
+		return "512", nil
+	}
+	return "", fmt.Errorf("unsupported KMS signing hash %s", h)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/konidev20/sigtool"
+)
+
+// apkSignerJSON is a sigtool.APKSigner in JSON output
+type apkSignerJSON struct {
+	Scheme       int                `json:"scheme"`
+	MinSDK       uint32             `json:"minSdk,omitempty"`
+	MaxSDK       uint32             `json:"maxSdk,omitempty"`
+	Algorithms   []string           `json:"algorithms"`
+	Signer       *certificateJSON   `json:"signer"`
+	Certificates []*certificateJSON `json:"certificates"`
+	Lineage      []apkLineageJSON   `json:"lineage,omitempty"`
+}
+
+// apkLineageJSON is a sigtool.APKLineageNode in JSON output
+type apkLineageJSON struct {
+	Certificate *certificateJSON `json:"certificate"`
+	Flags       uint32           `json:"flags"`
+}
+
+// newAPKSignersJSON returns the JSON form of signers
+func newAPKSignersJSON(signers []sigtool.APKSigner) []apkSignerJSON {
+	var out []apkSignerJSON
+	for _, s := range signers {
+		signer := apkSignerJSON{Scheme: s.Scheme, MinSDK: s.MinSDK, MaxSDK: s.MaxSDK, Algorithms: s.Algorithms, Signer: newCertificateJSON(s.Signer)}
+		for i := range s.Certificates {
+			signer.Certificates = append(signer.Certificates, newCertificateJSON(&s.Certificates[i]))
+		}
+		for _, node := range s.Lineage {
+			signer.Lineage = append(signer.Lineage, apkLineageJSON{Certificate: newCertificateJSON(node.Certificate), Flags: node.Flags})
+		}
+		out = append(out, signer)
+	}
+	return out
+}
+
+// readAPKSigners returns the v2 and v3 signers of input when it is an APK,
+// and nil for other files and APKs signed only with the JAR signature
+// scheme, which inspect like JARs
+func readAPKSigners(input string) ([]sigtool.APKSigner, error) {
+	fileType, err := sigtool.DetectFileType(input)
+	if err != nil || fileType != sigtool.FileTypeAPK {
+		return nil, err
+	}
+	signers, err := sigtool.InspectAPKSignatures(input)
+	if errors.Is(err, sigtool.ErrNotSigned) {
+		return nil, nil
+	}
+	return signers, err
+}
+
+// printAPKSigners prints the signing certificate, algorithms and rotation
+// lineage of each APK signer
+func printAPKSigners(signers []sigtool.APKSigner) {
+	printf("APK signers:\n")
+	for _, s := range signers {
+		printf("  v%d: %s", s.Scheme, s.Signer.Subject)
+		if s.Scheme == 3 {
+			printf(" (SDK %d-%d)", s.MinSDK, s.MaxSDK)
+		}
+		printLine()
+		printf("    SHA-256 thumbprint: %s\n", s.Signer.SHA256Thumbprint)
+		printf("    Algorithms: %s\n", strings.Join(s.Algorithms, ", "))
+		for i, node := range s.Lineage {
+			printf("    Lineage %d: %s (%s), flags %#x\n", i+1, node.Certificate.Subject, node.Certificate.SHA256Thumbprint, node.Flags)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/konidev20/sigtool"
+)
+
+// runCerts implements the certs subcommand, which writes the certificates
+// embedded in a signature to PEM or DER files. It returns the exit code.
+func runCerts(args []string) int {
+	fs := flag.NewFlagSet("certs", flag.ContinueOnError)
+	registerVerbosity(fs)
+	inParam := fs.String("in", "", "This specifies the input Signed PE filename to read from")
+	formatParam := fs.String("format", "pem", "This specifies the certificate encoding: pem, der or pkcs12 (always a bundle)")
+	outParam := fs.String("out", "", "This specifies the output directory, or the output file with -bundle")
+	bundle := fs.Bool("bundle", false, "This specifies if all certificates are written to a single file (PEM bundle or PKCS#7 .p7b for der)")
+	password := fs.String("password", "", "This specifies the PKCS#12 password; defaults to the SIGTOOL_PKCS12_PASSWORD environment variable")
+	legacy := fs.Bool("legacy", false, "This specifies if the PKCS#12 file uses legacy 3DES encryption for older importers")
+	jsonReport := fs.Bool("json", false, "This specifies if the written files are printed as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: gosigtool certs -in <signed_pe_file> [-format pem|der|pkcs12] [-bundle] [-out <path>]\n\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return usageExit(err)
+	}
+	if *inParam == "" {
+		fmt.Fprintf(os.Stderr, "Error: input file (-in) is required\n\n")
+		fs.Usage()
+		return exitUsage
+	}
+
+	base := filepath.Base(*inParam)
+	result := fileResult{Input: *inParam}
+	var err error
+	if strings.EqualFold(*formatParam, "pkcs12") {
+		result.Output, err = writePKCS12(*inParam, *outParam, base, *password, *legacy)
+		return reportFiles(*jsonReport, result, err, "Wrote PKCS#12 trust store to %q")
+	}
+
+	format := sigtool.CertificateFormat(strings.ToLower(*formatParam))
+	var ext, bundleExt string
+	switch format {
+	case sigtool.FormatPEM:
+		ext, bundleExt = ".pem", ".pem"
+	case sigtool.FormatDER:
+		ext, bundleExt = ".cer", ".p7b"
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unsupported -format %q (expected pem, der or pkcs12)\n", *formatParam)
+		return exitUsage
+	}
+
+	if *bundle {
+		result.Output, err = writeBundle(*inParam, *outParam, base+bundleExt, format)
+		return reportFiles(*jsonReport, result, err, "Wrote certificate bundle to %q")
+	}
+
+	result.Files, err = writeCertificates(*inParam, *outParam, base, ext, format)
+	if err != nil || *jsonReport {
+		return reportFiles(*jsonReport, result, err, "")
+	}
+	for i, outputPath := range result.Files {
+		printf("Wrote certificate %d to %q\n", i, outputPath)
+	}
+	return exitValid
+}
+
+// writeBundle writes the certificates of input to a single file, output or
+// defaultName when it is empty, and returns its path
+func writeBundle(input, output, defaultName string, format sigtool.CertificateFormat) (string, error) {
+	data, err := sigtool.ExportCertificateBundle(input, format)
+	if err != nil {
+		return "", fmt.Errorf("exporting certificates: %w", err)
+	}
+	if output == "" {
+		output = defaultName
+	}
+	if err := os.WriteFile(output, data, 0600); err != nil {
+		return "", fmt.Errorf("writing output file %q: %w", output, err)
+	}
+	return output, nil
+}
+
+// writeCertificates writes each certificate of input to its own file in
+// dir and returns their paths
+func writeCertificates(input, dir, base, ext string, format sigtool.CertificateFormat) ([]string, error) {
+	certs, err := sigtool.ExportCertificates(input, format)
+	if err != nil {
+		return nil, fmt.Errorf("exporting certificates: %w", err)
+	}
+	if dir == "" {
+		dir = "."
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("creating output directory %q: %w", dir, err)
+	}
+	files := make([]string, 0, len(certs))
+	for i, data := range certs {
+		outputPath := filepath.Join(dir, fmt.Sprintf("%s-%d%s", base, i, ext))
+		if err := os.WriteFile(outputPath, data, 0600); err != nil {
+			return nil, fmt.Errorf("writing output file %q: %w", outputPath, err)
+		}
+		files = append(files, outputPath)
+	}
+	return files, nil
+}
+
+// writePKCS12 writes the certificates of input to a password-protected
+// PKCS#12 file and returns its path
+func writePKCS12(input, outputPath, base, password string, legacy bool) (string, error) {
+	if password == "" {
+		password = os.Getenv("SIGTOOL_PKCS12_PASSWORD")
+	}
+	if password == "" {
+		return "", errors.New("-format pkcs12 requires -password or SIGTOOL_PKCS12_PASSWORD")
+	}
+	encryption := sigtool.PKCS12Modern
+	if legacy {
+		encryption = sigtool.PKCS12Legacy
+	}
+
+	pfx, err := sigtool.ExportPKCS12(input, password, encryption)
+	if err != nil {
+		return "", fmt.Errorf("exporting certificates: %w", err)
+	}
+	if outputPath == "" {
+		outputPath = base + ".p12"
+	}
+	if err := os.WriteFile(outputPath, pfx, 0600); err != nil {
+		return "", fmt.Errorf("writing output file %q: %w", outputPath, err)
+	}
+	return outputPath, nil
+}
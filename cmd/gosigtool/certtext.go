@@ -0,0 +1,214 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/konidev20/sigtool"
+)
+
+// keyUsageNames names the key usage bits in the order openssl prints them
+var keyUsageNames = []struct {
+	usage x509.KeyUsage
+	name  string
+}{
+	{x509.KeyUsageDigitalSignature, "Digital Signature"},
+	{x509.KeyUsageContentCommitment, "Non Repudiation"},
+	{x509.KeyUsageKeyEncipherment, "Key Encipherment"},
+	{x509.KeyUsageDataEncipherment, "Data Encipherment"},
+	{x509.KeyUsageKeyAgreement, "Key Agreement"},
+	{x509.KeyUsageCertSign, "Certificate Sign"},
+	{x509.KeyUsageCRLSign, "CRL Sign"},
+	{x509.KeyUsageEncipherOnly, "Encipher Only"},
+	{x509.KeyUsageDecipherOnly, "Decipher Only"},
+}
+
+// extKeyUsageNames names the extended key usages crypto/x509 recognizes
+var extKeyUsageNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:                            "Any Extended Key Usage",
+	x509.ExtKeyUsageServerAuth:                     "TLS Web Server Authentication",
+	x509.ExtKeyUsageClientAuth:                     "TLS Web Client Authentication",
+	x509.ExtKeyUsageCodeSigning:                    "Code Signing",
+	x509.ExtKeyUsageEmailProtection:                "E-mail Protection",
+	x509.ExtKeyUsageIPSECEndSystem:                 "IPSec End System",
+	x509.ExtKeyUsageIPSECTunnel:                    "IPSec Tunnel",
+	x509.ExtKeyUsageIPSECUser:                      "IPSec User",
+	x509.ExtKeyUsageTimeStamping:                   "Time Stamping",
+	x509.ExtKeyUsageOCSPSigning:                    "OCSP Signing",
+	x509.ExtKeyUsageMicrosoftServerGatedCrypto:     "Microsoft Server Gated Crypto",
+	x509.ExtKeyUsageNetscapeServerGatedCrypto:      "Netscape Server Gated Crypto",
+	x509.ExtKeyUsageMicrosoftCommercialCodeSigning: "Microsoft Commercial Code Signing",
+	x509.ExtKeyUsageMicrosoftKernelCodeSigning:     "Microsoft Kernel Code Signing",
+}
+
+// unknownEKUNames names extended key usages of code signing that
+// crypto/x509 does not recognize
+var unknownEKUNames = map[string]string{
+	"1.3.6.1.4.1.311.10.3.5":  "Windows Hardware Driver Verification",
+	"1.3.6.1.4.1.311.10.3.6":  "Windows System Component Verification",
+	"1.3.6.1.4.1.311.10.3.13": "Lifetime Signing",
+	"1.3.6.1.4.1.311.61.1.1":  "Kernel Mode Code Signing",
+	"1.3.6.1.4.1.311.76.8.1":  "Microsoft Publisher",
+}
+
+// policyNames names well-known certificate policies
+var policyNames = map[string]string{
+	"2.23.140.1.3":   "CA/Browser Forum EV Code Signing",
+	"2.23.140.1.4.1": "CA/Browser Forum Code Signing",
+	"2.5.29.32.0":    "Any Policy",
+}
+
+// printCertificateText prints c openssl-style, as "x509 -text" does, under
+// the heading title
+func printCertificateText(title string, c *sigtool.CertificateInfo) {
+	cert := c.Certificate
+	printf("%s:\n", title)
+	if cert == nil {
+		printf("    Subject: %s\n    Issuer: %s\n", c.Subject, c.Issuer)
+		return
+	}
+	printf("    Version: %d\n", cert.Version)
+	printf("    Serial Number: %s\n", colonHex(cert.SerialNumber.Bytes()))
+	printf("    Signature Algorithm: %s\n", cert.SignatureAlgorithm)
+	printf("    Issuer: %s\n", c.Issuer)
+	printf("    Validity\n")
+	printf("        Not Before: %s\n", cert.NotBefore.UTC().Format(time.RFC3339))
+	printf("        Not After : %s\n", cert.NotAfter.UTC().Format(time.RFC3339))
+	printf("    Subject: %s\n", c.Subject)
+	printf("    Subject Public Key Info:\n")
+	printf("        Public Key Algorithm: %s\n", cert.PublicKeyAlgorithm)
+	if key := publicKeyDescription(cert.PublicKey); key != "" {
+		printf("        %s\n", key)
+	}
+
+	printf("    X509v3 extensions:\n")
+	if cert.BasicConstraintsValid {
+		constraint := "CA:FALSE"
+		if cert.IsCA {
+			constraint = "CA:TRUE"
+			if cert.MaxPathLen > 0 || cert.MaxPathLenZero {
+				constraint += fmt.Sprintf(", pathlen:%d", cert.MaxPathLen)
+			}
+		}
+		printf("        Basic Constraints: %s\n", constraint)
+	}
+	if usages := keyUsageList(cert.KeyUsage); len(usages) > 0 {
+		printf("        Key Usage: %s\n", strings.Join(usages, ", "))
+	}
+	if ekus := extKeyUsageList(cert); len(ekus) > 0 {
+		printf("        Extended Key Usage: %s\n", strings.Join(ekus, ", "))
+	}
+	if sans := subjectAltNames(cert); len(sans) > 0 {
+		printf("        Subject Alternative Name: %s\n", strings.Join(sans, ", "))
+	}
+	if len(cert.PolicyIdentifiers) > 0 {
+		printf("        Certificate Policies:\n")
+		for _, oid := range cert.PolicyIdentifiers {
+			printf("            Policy: %s\n", oidDescription(oid, policyNames))
+		}
+	}
+	if len(cert.SubjectKeyId) > 0 {
+		printf("        Subject Key Identifier: %s\n", colonHex(cert.SubjectKeyId))
+	}
+	if len(cert.AuthorityKeyId) > 0 {
+		printf("        Authority Key Identifier: %s\n", colonHex(cert.AuthorityKeyId))
+	}
+	for _, url := range cert.CRLDistributionPoints {
+		printf("        CRL Distribution Point: %s\n", url)
+	}
+	for _, url := range cert.OCSPServer {
+		printf("        OCSP: %s\n", url)
+	}
+	for _, url := range cert.IssuingCertificateURL {
+		printf("        CA Issuers: %s\n", url)
+	}
+
+	printf("    Thumbprints:\n")
+	printf("        SHA-1: %s\n", c.SHA1Thumbprint)
+	printf("        SHA-256: %s\n", c.SHA256Thumbprint)
+}
+
+// publicKeyDescription describes the size or curve of key
+func publicKeyDescription(key any) string {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA Public-Key: (%d bit)", k.N.BitLen())
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("EC Public-Key: (%d bit) %s", k.Curve.Params().BitSize, k.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return "ED25519 Public-Key"
+	}
+	return ""
+}
+
+// keyUsageList names the bits of usage
+func keyUsageList(usage x509.KeyUsage) []string {
+	var names []string
+	for _, u := range keyUsageNames {
+		if usage&u.usage != 0 {
+			names = append(names, u.name)
+		}
+	}
+	return names
+}
+
+// extKeyUsageList names the extended key usages of cert
+func extKeyUsageList(cert *x509.Certificate) []string {
+	var names []string
+	for _, usage := range cert.ExtKeyUsage {
+		if name, ok := extKeyUsageNames[usage]; ok {
+			names = append(names, name)
+		} else {
+			names = append(names, fmt.Sprintf("ExtKeyUsage(%d)", usage))
+		}
+	}
+	for _, oid := range cert.UnknownExtKeyUsage {
+		names = append(names, oidDescription(oid, unknownEKUNames))
+	}
+	return names
+}
+
+// subjectAltNames lists the subject alternative names of cert
+func subjectAltNames(cert *x509.Certificate) []string {
+	var names []string
+	for _, name := range cert.DNSNames {
+		names = append(names, "DNS:"+name)
+	}
+	for _, email := range cert.EmailAddresses {
+		names = append(names, "email:"+email)
+	}
+	for _, ip := range cert.IPAddresses {
+		names = append(names, "IP Address:"+ip.String())
+	}
+	for _, uri := range cert.URIs {
+		names = append(names, "URI:"+uri.String())
+	}
+	return names
+}
+
+// oidDescription returns oid with its name from names, when known
+func oidDescription(oid asn1.ObjectIdentifier, names map[string]string) string {
+	if name, ok := names[oid.String()]; ok {
+		return fmt.Sprintf("%s (%s)", name, oid)
+	}
+	return oid.String()
+}
+
+// colonHex returns b as colon-separated hexadecimal bytes
+func colonHex(b []byte) string {
+	if len(b) == 0 {
+		return "00"
+	}
+	parts := make([]string, len(b))
+	for i, v := range b {
+		parts[i] = hex.EncodeToString([]byte{v})
+	}
+	return strings.Join(parts, ":")
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/konidev20/sigtool/internal/yamlsubset"
+)
+
+// configEnv names the environment variable that overrides the path of the
+// configuration file
+const configEnv = "SIGTOOL_CONFIG"
+
+// config holds the flag defaults of a configuration file: values applying
+// to every subcommand that defines the flag, and per-subcommand sections
+// overriding them
+type config struct {
+	values   map[string][]string
+	sections map[string]map[string][]string
+}
+
+// defaultConfigPath returns the path of the configuration file used when
+// neither -config nor SIGTOOL_CONFIG is set: sigtool/config.yaml in the
+// user configuration directory, ~/.config on Linux
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "sigtool", "config.yaml")
+}
+
+// loadConfig reads the configuration file path. A missing file is not an
+// error unless required is set.
+func loadConfig(path string, required bool) (*config, error) {
+	// #nosec G304
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !required && errors.Is(err, fs.ErrNotExist) {
+			return &config{}, nil
+		}
+		return nil, fmt.Errorf("reading configuration: %w", err)
+	}
+	c, err := parseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing configuration %q: %w", path, err)
+	}
+	return c, nil
+}
+
+// parseConfig parses a configuration file: a mapping of flag names to
+// scalars or lists of scalars, and mappings of the same form keyed by
+// subcommand name, in the YAML subset of yamlsubset.Parse
+func parseConfig(data []byte) (*config, error) {
+	doc, err := yamlsubset.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	root, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("expected a mapping of flag names")
+	}
+	c := &config{values: make(map[string][]string), sections: make(map[string]map[string][]string)}
+	for key, value := range root {
+		if section, ok := value.(map[string]interface{}); ok {
+			c.sections[key] = make(map[string][]string, len(section))
+			for name, value := range section {
+				items, err := configItems(value)
+				if err != nil {
+					return nil, fmt.Errorf("%s.%s: %w", key, name, err)
+				}
+				c.sections[key][name] = items
+			}
+			continue
+		}
+		items, err := configItems(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		c.values[key] = items
+	}
+	return c, nil
+}
+
+// configItems returns the flag values of a key: its scalar, each scalar of
+// its list, or none when it is empty
+func configItems(value interface{}) ([]string, error) {
+	switch value := value.(type) {
+	case nil:
+		return []string{}, nil
+	case yamlsubset.Scalar:
+		return []string{value.Value}, nil
+	case []interface{}:
+		items := make([]string, 0, len(value))
+		for _, item := range value {
+			scalar, ok := item.(yamlsubset.Scalar)
+			if !ok {
+				return nil, errors.New("list items must be scalars")
+			}
+			items = append(items, scalar.Value)
+		}
+		return items, nil
+	}
+	return nil, errors.New("unexpected nested mapping")
+}
+
+// apply sets the flags of fs, the flag set of subcommand, that the
+// configuration gives and the command line does not
+func (c *config) apply(fs *flag.FlagSet, subcommand string) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	values := make(map[string][]string, len(c.values))
+	for key, value := range c.values {
+		values[key] = value
+	}
+	for key, value := range c.sections[subcommand] {
+		values[key] = value
+	}
+	for key, value := range values {
+		if set[key] || key == "config" || fs.Lookup(key) == nil {
+			continue
+		}
+		for _, item := range value {
+			if err := fs.Set(key, item); err != nil {
+				return fmt.Errorf("configuration %s: %w", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// parseFlags parses args with fs, adding the -config flag, and then fills
+// the flags not given on the command line from the configuration file:
+// -config, else SIGTOOL_CONFIG, else the default path when it exists.
+// Configuration errors are printed on stderr.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	_, err := parseFlagsExplicit(fs, args)
+	return err
+}
+
+// parseFlagsExplicit is parseFlags, also returning the names of the flags
+// given on the command line rather than by the configuration file
+func parseFlagsExplicit(fs *flag.FlagSet, args []string) (map[string]bool, error) {
+	configPath := fs.String("config", "", "This specifies the configuration file of flag defaults, instead of $"+configEnv+" or "+defaultConfigPath())
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	path, required := *configPath, true
+	if path == "" {
+		path = os.Getenv(configEnv)
+	}
+	if path == "" {
+		path, required = defaultConfigPath(), false
+	}
+	if path == "" {
+		return explicit, nil
+	}
+	c, err := loadConfig(path, required)
+	if err == nil {
+		err = c.apply(fs, fs.Name())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return nil, err
+	}
+	return explicit, nil
+}
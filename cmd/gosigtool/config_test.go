@@ -0,0 +1,161 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		values   map[string][]string
+		sections map[string]map[string][]string
+	}{
+		{"scalars", "cafile: /etc/roots.pem\nocsp: true\n", map[string][]string{"cafile": {"/etc/roots.pem"}, "ocsp": {"true"}}, nil},
+		{"block list", "tsa:\n  - http://a\n  - http://b\n", map[string][]string{"tsa": {"http://a", "http://b"}}, nil},
+		{"flow list", "tsa: [http://a, 'http://b']\n", map[string][]string{"tsa": {"http://a", "http://b"}}, nil},
+		{"empty list", "tsa:\ncrl: []\n", map[string][]string{"tsa": {}, "crl": {}}, nil},
+		{"sections", "cafile: a.pem\nverify:\n  output: sarif\n  tsa:\n    - http://a\npolicy:\n  policy: p.json\n", map[string][]string{"cafile": {"a.pem"}},
+			map[string]map[string][]string{"verify": {"output": {"sarif"}, "tsa": {"http://a"}}, "policy": {"policy": {"p.json"}}}},
+		{"quoting", "subject: \"CN=Release, O=Example\"\nname: 'it''s'\n", map[string][]string{"subject": {"CN=Release, O=Example"}, "name": {"it's"}}, nil},
+		{"escaped quotes", "template: \"{{.Path}} \\\"{{.Status}}\\\"\"\n", map[string][]string{"template": {"{{.Path}} \"{{.Status}}\""}}, nil},
+		{"comments", "# defaults\ncafile: a.pem # bundle\ntsa: [\"http://a#b\", c] # servers\nsubject: 'CN=#1' # signer\n", map[string][]string{"cafile": {"a.pem"}, "tsa": {"http://a#b", "c"}, "subject": {"CN=#1"}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := parseConfig([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("parseConfig returned an error: %v", err)
+			}
+			if tt.sections == nil {
+				tt.sections = map[string]map[string][]string{}
+			}
+			if !reflect.DeepEqual(c.values, tt.values) {
+				t.Errorf("Expected values %v, got %v", tt.values, c.values)
+			}
+			if !reflect.DeepEqual(c.sections, tt.sections) {
+				t.Errorf("Expected sections %v, got %v", tt.sections, c.sections)
+			}
+		})
+	}
+}
+
+func TestParseConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"tab indentation", "verify:\n\toutput: sarif\n", "line 2: tabs are not allowed for indentation"},
+		{"missing colon", "cafile\n", "line 1: expected \"key: value\""},
+		{"list item outside a list", "cafile: a.pem\n- b.pem\n", "line 2: list item outside a list"},
+		{"unterminated list", "tsa: [a, b\n", "line 1: unterminated list"},
+		{"not a mapping", "- a\n", "expected a mapping of flag names"},
+		{"nested section", "verify:\n  trust:\n    cafile: a.pem\n", "verify.trust: unexpected nested mapping"},
+		{"list of mappings", "tsa:\n  - url: http://a\n", "tsa: list items must be scalars"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseConfig([]byte(tt.data)); err == nil || err.Error() != tt.want {
+				t.Errorf("Expected %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+// flagsForTest returns a verify-like flag set with a scalar, a boolean and
+// a repeatable flag
+func flagsForTest(name string) (*flag.FlagSet, *string, *bool, *stringList) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	output := fs.String("output", "text", "")
+	ocsp := fs.Bool("ocsp", false, "")
+	var tsa stringList
+	fs.Var(&tsa, "tsa", "")
+	return fs, output, ocsp, &tsa
+}
+
+func TestConfigApply(t *testing.T) {
+	c, err := parseConfig([]byte("output: json\nocsp: true\ntsa: [http://a, http://b]\nunknown: x\nverify:\n  output: sarif\n"))
+	if err != nil {
+		t.Fatalf("parseConfig returned an error: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		subcommand string
+		args       []string
+		output     string
+		ocsp       bool
+		tsa        []string
+	}{
+		{"top-level values", "sign", nil, "json", true, []string{"http://a", "http://b"}},
+		{"section overrides top level", "verify", nil, "sarif", true, []string{"http://a", "http://b"}},
+		{"flag overrides section", "verify", []string{"-output", "text"}, "text", true, []string{"http://a", "http://b"}},
+		{"flag overrides boolean", "sign", []string{"-ocsp=false"}, "json", false, []string{"http://a", "http://b"}},
+		{"flag replaces list", "sign", []string{"-tsa", "http://c"}, "json", true, []string{"http://c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs, output, ocsp, tsa := flagsForTest(tt.subcommand)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatalf("Failed to parse flags: %v", err)
+			}
+			if err := c.apply(fs, tt.subcommand); err != nil {
+				t.Fatalf("apply returned an error: %v", err)
+			}
+			if *output != tt.output || *ocsp != tt.ocsp || !reflect.DeepEqual([]string(*tsa), tt.tsa) {
+				t.Errorf("Expected output=%s ocsp=%v tsa=%v, got output=%s ocsp=%v tsa=%v", tt.output, tt.ocsp, tt.tsa, *output, *ocsp, *tsa)
+			}
+		})
+	}
+
+	bad := &config{values: map[string][]string{"ocsp": {"maybe"}}}
+	fs, _, _, _ := flagsForTest("verify")
+	if err := bad.apply(fs, "verify"); err == nil || !strings.HasPrefix(err.Error(), "configuration ocsp:") {
+		t.Errorf("Expected an error for an invalid boolean, got %v", err)
+	}
+}
+
+func TestParseFlags_Config(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("output: json\nverify:\n  ocsp: true\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write configuration: %v", err)
+	}
+	t.Setenv(configEnv, path)
+
+	fs, output, ocsp, _ := flagsForTest("verify")
+	if err := parseFlags(fs, []string{"-output", "sarif"}); err != nil {
+		t.Fatalf("parseFlags returned an error: %v", err)
+	}
+	if *output != "sarif" || !*ocsp {
+		t.Errorf("Expected the flag to override the configuration and the section to apply, got output=%s ocsp=%v", *output, *ocsp)
+	}
+
+	fs, _, _, _ = flagsForTest("verify")
+	if err := parseFlags(fs, []string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}); err == nil {
+		t.Error("Expected an error for a missing -config file")
+	}
+}
+
+func TestRunLegacy_ConfigVerificationFlags(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte("cafile: roots.pem\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write configuration: %v", err)
+	}
+	t.Setenv(configEnv, path)
+	missing := filepath.Join(dir, "missing.exe")
+
+	// A configured trust flag does not turn plain extraction into a usage error
+	if code := runLegacy([]string{"-in", missing, "-out", filepath.Join(dir, "out.pkcs7")}); code == exitUsage {
+		t.Errorf("Expected the configured cafile to be ignored without -validate, got exit code %d", code)
+	}
+	if code := runLegacy([]string{"-in", missing, "-cafile", "roots.pem"}); code != exitUsage {
+		t.Errorf("Expected exit code %d for -cafile without -validate, got %d", exitUsage, code)
+	}
+}
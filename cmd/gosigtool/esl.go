@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/konidev20/sigtool"
+)
+
+// eslResult is the JSON form of a Secure Boot signature database file
+type eslResult struct {
+	Path       string         `json:"path"`
+	Attributes uint32         `json:"attributes,omitempty"`
+	Update     *eslUpdateJSON `json:"update,omitempty"`
+	Lists      []eslListJSON  `json:"lists,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	db         *sigtool.SignatureDatabase
+}
+
+// eslUpdateJSON is a sigtool.VariableAuthentication in JSON output
+type eslUpdateJSON struct {
+	Timestamp    time.Time          `json:"timestamp"`
+	Signed       bool               `json:"signed"`
+	Signer       *certificateJSON   `json:"signer,omitempty"`
+	Certificates []*certificateJSON `json:"certificates,omitempty"`
+}
+
+// eslListJSON is a sigtool.EFISignatureList in JSON output
+type eslListJSON struct {
+	Type     string         `json:"type"`
+	TypeName string         `json:"typeName"`
+	Entries  []eslEntryJSON `json:"entries"`
+}
+
+// eslEntryJSON is a sigtool.EFISignatureData in JSON output
+type eslEntryJSON struct {
+	Owner          string           `json:"owner"`
+	Certificate    *certificateJSON `json:"certificate,omitempty"`
+	Data           string           `json:"data,omitempty"`
+	RevocationTime *time.Time       `json:"revocationTime,omitempty"`
+}
+
+// newESLResult returns the JSON form of db read from path
+func newESLResult(path string, db *sigtool.SignatureDatabase) eslResult {
+	result := eslResult{Path: path, Attributes: db.Attributes, db: db}
+	if u := db.Update; u != nil {
+		result.Update = &eslUpdateJSON{Timestamp: u.Timestamp, Signed: len(u.Signature) > 0, Signer: newCertificateJSON(u.Signer)}
+		for i := range u.Certificates {
+			result.Update.Certificates = append(result.Update.Certificates, newCertificateJSON(&u.Certificates[i]))
+		}
+	}
+	for _, l := range db.Lists {
+		list := eslListJSON{Type: l.Type.String(), TypeName: l.TypeName(), Entries: []eslEntryJSON{}}
+		for _, s := range l.Signatures {
+			entry := eslEntryJSON{Owner: s.Owner.String(), Certificate: newCertificateJSON(s.Certificate)}
+			if s.Certificate == nil {
+				entry.Data = hex.EncodeToString(s.Data)
+			}
+			if !s.RevocationTime.IsZero() {
+				revoked := s.RevocationTime
+				entry.RevocationTime = &revoked
+			}
+			list.Entries = append(list.Entries, entry)
+		}
+		result.Lists = append(result.Lists, list)
+	}
+	return result
+}
+
+// runESL implements the esl subcommand, which prints the contents of
+// Secure Boot signature databases: the db, dbx, KEK and PK as .esl files,
+// authenticated variable updates (.auth) or efivarfs variables. It returns
+// the exit code.
+func runESL(args []string) int {
+	fs := flag.NewFlagSet("esl", flag.ContinueOnError)
+	registerVerbosity(fs)
+	jsonReport := fs.Bool("json", false, "This specifies if the signature lists are printed as JSON")
+	text := fs.Bool("text", false, "This specifies if every certificate is printed in full, as openssl x509 -text does")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: gosigtool esl [-json | -text] <db.esl|dbx.auth|efivarfs variable>...\n\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return usageExit(err)
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "Error: at least one signature database file is required\n\n")
+		fs.Usage()
+		return exitUsage
+	}
+
+	code := exitValid
+	results := make([]eslResult, 0, fs.NArg())
+	for _, path := range fs.Args() {
+		db, err := sigtool.LoadSignatureDatabase(path)
+		if err != nil {
+			code = worstExit(code, failureExit(err))
+			results = append(results, eslResult{Path: path, Error: err.Error()})
+			continue
+		}
+		results = append(results, newESLResult(path, db))
+	}
+
+	if *jsonReport {
+		return printJSON(results, code)
+	}
+	for _, result := range results {
+		if result.Error != "" {
+			fmt.Fprintf(os.Stderr, "Error reading %q: %s\n", result.Path, result.Error)
+			continue
+		}
+		printESL(result.Path, result.db, *text)
+	}
+	return code
+}
+
+// printESL prints the update descriptor and signature lists of db, read
+// from path, with every certificate in full when text is set
+func printESL(path string, db *sigtool.SignatureDatabase, text bool) {
+	printf("%s:\n", path)
+	if db.Attributes != 0 {
+		printf("  Attributes: %#x\n", db.Attributes)
+	}
+	if u := db.Update; u != nil {
+		printf("  Update timestamp: %s\n", u.Timestamp.Format(time.RFC3339))
+		switch {
+		case len(u.Signature) == 0:
+			printf("  Update signer: none (unsigned)\n")
+		case u.Signer != nil:
+			printf("  Update signer: %s\n", u.Signer.Subject)
+		default:
+			printf("  Update signer: not embedded\n")
+		}
+	}
+	if len(db.Lists) == 0 {
+		printf("  No signature lists\n")
+	}
+	for i, l := range db.Lists {
+		printf("  List %d: %s, %d entries\n", i, l.TypeName(), len(l.Signatures))
+		for j, s := range l.Signatures {
+			switch {
+			case s.Certificate != nil && text:
+				printCertificateText(fmt.Sprintf("    [%d] owner %s", j, s.Owner), s.Certificate)
+			case s.Certificate != nil:
+				printf("    [%d] owner %s: %s (SHA-256 %s)\n", j, s.Owner, s.Certificate.Subject, s.Certificate.SHA256Thumbprint)
+			case strings.HasPrefix(l.TypeName(), "EFI_CERT_X509_SHA") && s.RevocationTime.IsZero():
+				printf("    [%d] owner %s: TBS hash %x, always revoked\n", j, s.Owner, s.Data[:len(s.Data)-16])
+			case strings.HasPrefix(l.TypeName(), "EFI_CERT_X509_SHA"):
+				printf("    [%d] owner %s: TBS hash %x, revoked after %s\n", j, s.Owner, s.Data[:len(s.Data)-16], s.RevocationTime.Format(time.RFC3339))
+			default:
+				printf("    [%d] owner %s: %x\n", j, s.Owner, s.Data)
+			}
+		}
+	}
+}
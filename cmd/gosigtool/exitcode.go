@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io/fs"
+
+	"github.com/konidev20/sigtool"
+)
+
+// Exit codes. Commands that verify signatures report the worst outcome
+// over their files; the others exit with exitValid on success, exitIOError
+// when a file cannot be read or written, exitUnsigned when their input is
+// not signed and exitInvalid otherwise.
+const (
+	// exitValid: every file is signed and valid, or the command succeeded
+	exitValid = 0
+	// exitInvalid: a signature is invalid, a file is not a valid PE file or
+	// the command failed
+	exitInvalid = 1
+	// exitUnsigned: a file is not signed
+	exitUnsigned = 2
+	// exitPolicy: a signature is valid but violates the requested policy,
+	// such as a signer pin, the denylist, weak cryptography or a policy file
+	exitPolicy = 3
+	// exitIOError: a file cannot be read or written
+	exitIOError = 4
+	// exitUsage: the command line is invalid
+	exitUsage = 64
+)
+
+// exitSeverity orders the exit codes from best to worst
+var exitSeverity = map[int]int{
+	exitValid:    0,
+	exitUnsigned: 1,
+	exitPolicy:   2,
+	exitInvalid:  3,
+	exitIOError:  4,
+	exitUsage:    5,
+}
+
+// worstExit returns the more severe of the exit codes a and b
+func worstExit(a, b int) int {
+	if exitSeverity[b] > exitSeverity[a] {
+		return b
+	}
+	return a
+}
+
+// exitCodeFor classifies a verification error: nil is exitValid, file
+// system errors exitIOError, ErrNotSigned exitUnsigned, policy failures on
+// otherwise valid signatures exitPolicy and anything else exitInvalid
+func exitCodeFor(err error) int {
+	var pathErr *fs.PathError
+	switch {
+	case err == nil:
+		return exitValid
+	case errors.As(err, &pathErr):
+		return exitIOError
+	case errors.Is(err, sigtool.ErrNotSigned):
+		return exitUnsigned
+	case errors.Is(err, sigtool.ErrSignerNotPinned), errors.Is(err, sigtool.ErrDeniedCertificate),
+		errors.Is(err, sigtool.ErrWeakCrypto), errors.Is(err, sigtool.ErrUntrustedPublisher):
+		return exitPolicy
+	default:
+		return exitInvalid
+	}
+}
+
+// failureExit is exitCodeFor for commands that do not verify: any failure
+// other than a file system error or an unsigned input is exitInvalid
+func failureExit(err error) int {
+	if code := exitCodeFor(err); code != exitPolicy {
+		return code
+	}
+	return exitInvalid
+}
+
+// usageExit returns the exit code of a failed flag parse: exitValid when
+// help was requested, exitIOError when the configuration file cannot be
+// read and exitUsage otherwise
+func usageExit(err error) int {
+	var pathErr *fs.PathError
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		return exitValid
+	case errors.As(err, &pathErr):
+		return exitIOError
+	}
+	return exitUsage
+}
+
+// optionsExit returns the exit code of invalid options: exitIOError when a
+// file they name cannot be read and exitUsage otherwise
+func optionsExit(err error) int {
+	if code := exitCodeFor(err); code == exitIOError {
+		return code
+	}
+	return exitUsage
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/konidev20/sigtool"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// runExtract implements the extract subcommand, which writes the PKCS#7
+// signature or the whole certificate table of a PE file to a file. It
+// returns the exit code.
+func runExtract(args []string) int {
+	fs := flag.NewFlagSet("extract", flag.ContinueOnError)
+	registerVerbosity(fs)
+	inParam := fs.String("in", "", "This specifies the input Signed PE filename to read from, or - for standard input")
+	outParam := fs.String("out", "", "This specifies the output signature filename to write to, or - for standard output; it defaults to the input name with an extension for the signature format")
+	jsonReport := fs.Bool("json", false, "This specifies if a JSON report of the signature and its digests should be printed")
+	rawTable := fs.Bool("raw", false, "This specifies if the whole certificate table, WIN_CERTIFICATE headers and padding included, is written instead of the PKCS#7 signature")
+	formatParam := fs.String("format", "der", "This specifies the signature encoding: der, or pem for a -----BEGIN PKCS7----- block as openssl expects (an ASCII-armored .asc file for OpenPGP signatures; not available for OPC and APK Signing Block signatures)")
+	strictPE := fs.Bool("strict-pe", false, "This specifies if files with malformed PE headers are rejected instead of parsed leniently")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: gosigtool extract -in <signed_pe_file> [-out <pkcs7_file>] [-format der|pem] [-raw] [-json]\n\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return usageExit(err)
+	}
+	if *inParam == "" {
+		fmt.Fprintf(os.Stderr, "Error: input file (-in) is required\n\n")
+		fs.Usage()
+		return exitUsage
+	}
+	if err := checkStdio(*inParam, *outParam, *jsonReport); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+	format := sigtool.CertificateFormat(strings.ToLower(*formatParam))
+	if format != sigtool.FormatDER && format != sigtool.FormatPEM {
+		fmt.Fprintf(os.Stderr, "Error: unsupported -format %q (expected der or pem)\n", *formatParam)
+		return exitUsage
+	}
+	if format == sigtool.FormatPEM && *rawTable {
+		fmt.Fprintf(os.Stderr, "Error: -format pem cannot be combined with -raw\n")
+		return exitUsage
+	}
+	input, cleanup, err := inputPath(*inParam)
+	if err != nil {
+		return reportFiles(*jsonReport, fileResult{Input: *inParam}, err, "")
+	}
+	defer cleanup()
+
+	if *strictPE {
+		if err := sigtool.ValidatePEHeaders(input); err != nil {
+			return reportFiles(*jsonReport, fileResult{Input: *inParam}, err, "")
+		}
+	}
+
+	outputPath, bundle, err := extractSignature(input, *outParam, format, *rawTable, *jsonReport)
+	if err != nil {
+		return reportFiles(*jsonReport, fileResult{Input: *inParam}, err, "")
+	}
+	if *jsonReport {
+		info, findings, mismatch, _ := inspectFile(input)
+		if err := printReport(*inParam, outputPath, false, bundle, info, findings, mismatch); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON report: %v\n", err)
+			return exitIOError
+		}
+		return exitValid
+	}
+	if outputPath != stdio {
+		printf("Successfully extracted signature to %q\n", outputPath)
+	}
+	return exitValid
+}
+
+// encodeSignature encodes sig, the signature ExtractDigitalSignature returns
+// for a file of fileType, in format, and returns the extension of its file.
+// PKCS#7 signatures are .pkcs7 files, or PEM PKCS7 blocks in .pem files;
+// OpenPGP signatures are binary .sig files, or ASCII-armored .asc files,
+// which is how armored ones are always written. The XML signatures of OPC
+// packages (.xml) and APK Signing Blocks (.apksig) have no PEM form.
+func encodeSignature(fileType sigtool.FileType, sig []byte, format sigtool.CertificateFormat) (string, []byte, error) {
+	pemRequested := format == sigtool.FormatPEM
+	switch {
+	case fileType == sigtool.FileTypeOPC:
+		if pemRequested {
+			return "", nil, errors.New("-format pem is not available for the XML signature of an OPC package")
+		}
+		return ".xml", sig, nil
+	case fileType == sigtool.FileTypeRPM, fileType == sigtool.FileTypeDeb, fileType == sigtool.FileTypeAppImage:
+		if bytes.HasPrefix(bytes.TrimSpace(sig), []byte("-----BEGIN PGP")) {
+			return ".asc", sig, nil
+		}
+		if !pemRequested {
+			return ".sig", sig, nil
+		}
+		var armored bytes.Buffer
+		w, err := armor.Encode(&armored, openpgp.SignatureType, nil)
+		if err == nil {
+			_, err = w.Write(sig)
+		}
+		if err == nil {
+			err = w.Close()
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("armoring OpenPGP signature: %w", err)
+		}
+		return ".asc", armored.Bytes(), nil
+	case fileType == sigtool.FileTypeAPK && bytes.HasSuffix(sig, []byte("APK Sig Block 42")):
+		if pemRequested {
+			return "", nil, errors.New("-format pem is not available for an APK Signing Block")
+		}
+		return ".apksig", sig, nil
+	case pemRequested:
+		return ".pem", pem.EncodeToMemory(&pem.Block{Type: "PKCS7", Bytes: sig}), nil
+	}
+	return ".pkcs7", sig, nil
+}
+
+// extractSignature writes the signature of input, encoded in format by
+// encodeSignature, or its whole certificate table when rawTable is set, to
+// output ("-" for standard output) or to a file named after input in the
+// working directory. It returns the path written and, when withDigests is set, the
+// signature bundle with its digests.
+func extractSignature(input, output string, format sigtool.CertificateFormat, rawTable, withDigests bool) (string, *sigtool.SignatureBundle, error) {
+	var bundle *sigtool.SignatureBundle
+	var buf []byte
+	var err error
+	if withDigests {
+		bundle, err = sigtool.ExtractWithDigests(input)
+		if bundle != nil {
+			buf = bundle.RawSignature
+		}
+	} else {
+		buf, err = sigtool.ExtractDigitalSignature(input)
+	}
+	if err == nil && rawTable {
+		buf, err = sigtool.ExtractCertificateTable(input)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("extracting signature: %w", err)
+	}
+	ext := ".wincert"
+	if !rawTable {
+		// Read errors were reported by the extraction
+		fileType, _ := sigtool.DetectFileType(input)
+		if ext, buf, err = encodeSignature(fileType, buf, format); err != nil {
+			return "", nil, err
+		}
+	}
+
+	if output == "" {
+		fileName := filepath.Base(input)
+		if fileName == "." || fileName == "" {
+			return "", nil, errors.New("unable to determine output filename from input path")
+		}
+		output = fileName + ext
+	}
+	if err := writeOutput(output, buf); err != nil {
+		return "", nil, err
+	}
+	return output, bundle, nil
+}
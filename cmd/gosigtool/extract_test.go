@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/pem"
+	"io"
+	"testing"
+
+	"github.com/konidev20/sigtool"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+func TestEncodeSignature(t *testing.T) {
+	pkcs7 := []byte{0x30, 0x03, 0x02, 0x01, 0x01}
+	armored := []byte("-----BEGIN PGP SIGNATURE-----\n\nwsBcBAAB\n-----END PGP SIGNATURE-----\n")
+	block := append([]byte("\x10\x00\x00\x00\x00\x00\x00\x00"), "APK Sig Block 42"...)
+	tests := []struct {
+		name     string
+		fileType sigtool.FileType
+		sig      []byte
+		format   sigtool.CertificateFormat
+		ext      string
+		label    string
+	}{
+		{"pe der", sigtool.FileTypePE, pkcs7, sigtool.FormatDER, ".pkcs7", ""},
+		{"pe pem", sigtool.FileTypePE, pkcs7, sigtool.FormatPEM, ".pem", "PKCS7"},
+		{"msi pem", sigtool.FileTypeMSI, pkcs7, sigtool.FormatPEM, ".pem", "PKCS7"},
+		{"opc", sigtool.FileTypeOPC, []byte("<Signature/>"), sigtool.FormatDER, ".xml", ""},
+		{"rpm binary", sigtool.FileTypeRPM, []byte{0x89, 0x01}, sigtool.FormatDER, ".sig", ""},
+		{"rpm pem", sigtool.FileTypeRPM, []byte{0x89, 0x01}, sigtool.FormatPEM, ".asc", "PGP SIGNATURE"},
+		{"deb armored", sigtool.FileTypeDeb, armored, sigtool.FormatDER, ".asc", "PGP SIGNATURE"},
+		{"appimage armored pem", sigtool.FileTypeAppImage, armored, sigtool.FormatPEM, ".asc", "PGP SIGNATURE"},
+		{"apk signing block", sigtool.FileTypeAPK, block, sigtool.FormatDER, ".apksig", ""},
+		{"apk jar signature", sigtool.FileTypeAPK, pkcs7, sigtool.FormatPEM, ".pem", "PKCS7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ext, out, err := encodeSignature(tt.fileType, tt.sig, tt.format)
+			if err != nil {
+				t.Fatalf("encodeSignature returned an error: %v", err)
+			}
+			if ext != tt.ext {
+				t.Errorf("Expected extension %s, got %s", tt.ext, ext)
+			}
+			if tt.label == "" {
+				if !bytes.Equal(out, tt.sig) {
+					t.Errorf("Expected the signature unchanged, got %q", out)
+				}
+				return
+			}
+			if !bytes.HasPrefix(out, []byte("-----BEGIN "+tt.label+"-----")) {
+				t.Errorf("Expected a %s block, got %q", tt.label, out)
+			}
+			switch {
+			case tt.label == "PKCS7":
+				if p, _ := pem.Decode(out); p == nil || !bytes.Equal(p.Bytes, tt.sig) {
+					t.Errorf("Expected the PEM block to hold the signature, got %q", out)
+				}
+			case !bytes.Equal(tt.sig, armored):
+				block, err := armor.Decode(bytes.NewReader(out))
+				if err != nil {
+					t.Fatalf("Expected an OpenPGP armored signature, got %v", err)
+				}
+				if body, _ := io.ReadAll(block.Body); !bytes.Equal(body, tt.sig) {
+					t.Errorf("Expected the armor to hold the signature, got %x", body)
+				}
+			}
+		})
+	}
+
+	for _, fileType := range []sigtool.FileType{sigtool.FileTypeOPC, sigtool.FileTypeAPK} {
+		sig := []byte("<Signature/>")
+		if fileType == sigtool.FileTypeAPK {
+			sig = block
+		}
+		if _, _, err := encodeSignature(fileType, sig, sigtool.FormatPEM); err == nil {
+			t.Errorf("%s: expected -format pem to be rejected", fileType)
+		}
+	}
+}
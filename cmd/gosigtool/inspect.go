@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/konidev20/sigtool"
+)
+
+// runInspect implements the inspect subcommand, which prints the signer,
+// certificates, digest and timestamp of the signature of a PE file without
+// verifying it, along with the file hashes, authentihashes, imphash and
+// rich header hash, the identity of MSIX packages and the signatures of
+// NuGet packages and the notarization of Mach-O binaries and disk images,
+// the OpenPGP signatures of RPM and Debian packages and AppImages or the v2
+// and v3 signers of APKs. It returns the exit code.
+func runInspect(args []string) int {
+	fs := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	registerVerbosity(fs)
+	inParam := fs.String("in", "", "This specifies the input Signed PE filename to inspect, or - for standard input")
+	jsonReport := fs.Bool("json", false, "This specifies if the signature details are printed as JSON")
+	textParam := fs.Bool("text", false, "This specifies if every certificate is printed in full, openssl-style, with its validity, key usages, EKUs, SANs, policies and thumbprints")
+	dumpASN1 := fs.Bool("dump-asn1", false, "This specifies if the decoded ASN.1 tree of the PKCS#7 signature, with object identifiers named, is printed instead of the signature details")
+	checkNotarization := fs.Bool("check-notarization", false, "This specifies if Apple's ticket service is asked for the notarization ticket of a Mach-O binary or disk image without a stapled one")
+	var pgpKeyrings stringList
+	fs.Var(&pgpKeyrings, "pgp-keyring", "This specifies an OpenPGP key file or keyring whose keys name the signers of RPM and Debian packages and AppImages; may be repeated")
+	tmplParam := fs.String("template", "", "This specifies a Go template printed with the signature details, such as '{{.Signer.CommonName}} {{.DigestAlgorithm}}'")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: gosigtool inspect [-json | -template <template> | -text | -dump-asn1] [-check-notarization] [-pgp-keyring <key_file>] -in <signed_pe_file>\n\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return usageExit(err)
+	}
+	if *inParam == "" && fs.NArg() == 1 {
+		*inParam = fs.Arg(0)
+	}
+	if *inParam == "" {
+		fmt.Fprintf(os.Stderr, "Error: input file (-in) is required\n\n")
+		fs.Usage()
+		return exitUsage
+	}
+	if *jsonReport && *tmplParam != "" {
+		fmt.Fprintf(os.Stderr, "Error: -template cannot be combined with -json\n")
+		return exitUsage
+	}
+	if *textParam && (*jsonReport || *tmplParam != "") {
+		fmt.Fprintf(os.Stderr, "Error: -text cannot be combined with -json or -template\n")
+		return exitUsage
+	}
+	if *dumpASN1 && (*jsonReport || *tmplParam != "" || *textParam) {
+		fmt.Fprintf(os.Stderr, "Error: -dump-asn1 cannot be combined with -json, -template or -text\n")
+		return exitUsage
+	}
+	tmpl, err := parseTemplate(*tmplParam)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+	input, cleanup, err := inputPath(*inParam)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitCodeFor(err)
+	}
+	defer cleanup()
+
+	if *jsonReport {
+		result := inspectResult{Path: *inParam}
+		hashes, err := sigtool.ComputeFileHashes(input)
+		result.Hashes = newHashesJSON(hashes)
+		result.Warnings = appendWarning(result.Warnings, "unable to hash the file", err)
+		if pgp, err := readPGPSignatures(input, pgpKeyrings); pgp != nil || err != nil {
+			result.PGPSignatures = newPGPSignaturesJSON(pgp)
+			if err != nil {
+				result.Error = err.Error()
+			}
+			return printJSON(result, exitCodeFor(err))
+		}
+		if apk, err := readAPKSigners(input); apk != nil || err != nil {
+			result.APKSigners = newAPKSignersJSON(apk)
+			if err != nil {
+				result.Error = err.Error()
+			}
+			return printJSON(result, exitCodeFor(err))
+		}
+		info, err := sigtool.Inspect(input)
+		if err != nil {
+			result.Error = err.Error()
+			return printJSON(result, exitCodeFor(err))
+		}
+		result.Signature = newSignatureJSON(info)
+		identity, err := readPackage(input)
+		result.Package = newPackageJSON(identity, info)
+		result.Warnings = appendWarning(result.Warnings, "unable to read the package identity", err)
+		nuget, err := readNuGet(input)
+		result.NuGet = newNuGetJSON(nuget)
+		result.Warnings = appendWarning(result.Warnings, "unable to read the NuGet signatures", err)
+		notarization, err := readNotarization(input, *checkNotarization)
+		result.Notarization = newNotarizationJSON(notarization)
+		result.Warnings = appendWarning(result.Warnings, "unable to read the notarization ticket", err)
+		findings, err := sigtool.FindWeakCrypto(input)
+		result.WeakCrypto = newWeakCryptoJSON(findings)
+		result.Warnings = appendWarning(result.Warnings, "unable to check for weak cryptography", err)
+		mismatch, err := sigtool.CheckCompanyName(input)
+		result.CompanyMismatch = newCompanyMismatchJSON(mismatch)
+		result.Warnings = appendWarning(result.Warnings, "unable to compare the company name with the signer", err)
+		return printJSON(result, exitValid)
+	}
+
+	if *dumpASN1 {
+		signature, err := sigtool.ExtractDigitalSignature(input)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitCodeFor(err)
+		}
+		if err := sigtool.DumpASN1(os.Stdout, signature); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitInvalid
+		}
+		return exitValid
+	}
+	if *tmplParam != "" {
+		info, err := sigtool.Inspect(input)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitCodeFor(err)
+		}
+		data := newTemplateData(*inParam, "", "", newSignatureJSON(info))
+		hashes, err := sigtool.ComputeFileHashes(input)
+		if err != nil {
+			warnf("unable to hash the file: %v\n", err)
+		}
+		data.Hashes = newHashesJSON(hashes)
+		return printTemplate(tmpl, []templateData{data}, exitValid)
+	}
+
+	if hashes, err := sigtool.ComputeFileHashes(input); err != nil {
+		warnf("unable to hash the file: %v\n", err)
+	} else {
+		printHashes("", newHashesJSON(hashes))
+	}
+	if pgp, err := readPGPSignatures(input, pgpKeyrings); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitCodeFor(err)
+	} else if pgp != nil {
+		printPGPSignatures(pgp)
+		return exitValid
+	}
+	if apk, err := readAPKSigners(input); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitCodeFor(err)
+	} else if apk != nil {
+		printAPKSigners(apk)
+		return exitValid
+	}
+	info, findings, mismatch, err := inspectFile(input)
+	if err != nil {
+		return exitCodeFor(err)
+	}
+	printWarnings(info, findings, mismatch)
+	if info.Signer != nil {
+		printf("Signer: %s\n", info.Signer.Subject)
+		printf("Issuer: %s\n", info.Signer.Issuer)
+		printf("Serial number: %s\n", info.Signer.SerialNumber)
+		printf("SHA-256 thumbprint: %s\n", info.Signer.SHA256Thumbprint)
+	}
+	printf("Digest: %s %s\n", info.DigestAlgorithm, hex.EncodeToString(info.Digest))
+	if !info.SigningTime.IsZero() {
+		printf("Signing time: %s\n", info.SigningTime.UTC().Format(time.RFC3339))
+	}
+	if ts := info.Timestamp; ts != nil {
+		printf("Timestamp: %s %s", ts.Type, ts.Time.UTC().Format(time.RFC3339))
+		if ts.Signer != nil {
+			printf(" by %s", ts.Signer.Subject)
+		}
+		printLine()
+	}
+	printProgramInfo(info)
+	if identity, err := readPackage(input); err != nil {
+		warnf("unable to read the package identity: %v\n", err)
+	} else if p := newPackageJSON(identity, info); p != nil {
+		printf("Package: %s %s\n", p.Name, p.Version)
+		printf("Publisher: %s\n", p.Publisher)
+		printf("Package family name: %s\n", p.FamilyName)
+		if !p.SignerMatches {
+			warnf("package publisher does not match the signer, so Windows will refuse to install it\n")
+		}
+	}
+	if nuget, err := readNuGet(input); err != nil {
+		warnf("unable to read the NuGet signatures: %v\n", err)
+	} else if nuget != nil {
+		printNuGet(nuget)
+	}
+	if notarization, err := readNotarization(input, *checkNotarization); err != nil {
+		warnf("unable to read the notarization ticket: %v\n", err)
+	} else if notarization != nil {
+		printNotarization(notarization)
+	}
+	if *textParam {
+		printCertificatesText(info)
+		return exitValid
+	}
+	printf("Certificates:\n")
+	for _, c := range info.Certificates {
+		printf("  %s\n    issuer %s, valid %s to %s\n", c.Subject, c.Issuer, c.NotBefore.UTC().Format(time.DateOnly), c.NotAfter.UTC().Format(time.DateOnly))
+	}
+	return exitValid
+}
+
+// inspectResult is the JSON output of the inspect subcommand
+type inspectResult struct {
+	Path            string              `json:"path"`
+	Hashes          *hashesJSON         `json:"hashes,omitempty"`
+	Signature       *signatureJSON      `json:"signature,omitempty"`
+	PGPSignatures   []pgpSignatureJSON  `json:"pgpSignatures,omitempty"`
+	APKSigners      []apkSignerJSON     `json:"apkSigners,omitempty"`
+	Package         *packageJSON        `json:"package,omitempty"`
+	NuGet           *nugetJSON          `json:"nuget,omitempty"`
+	Notarization    *notarizationJSON   `json:"notarization,omitempty"`
+	WeakCrypto      []weakCryptoFinding `json:"weakCrypto,omitempty"`
+	CompanyMismatch *companyMismatch    `json:"companyMismatch,omitempty"`
+	Warnings        []string            `json:"warnings,omitempty"`
+	Error           string              `json:"error,omitempty"`
+}
+
+// readPackage returns the identity of input when it is an MSIX or APPX
+// package or bundle, and nil for other files
+func readPackage(input string) (*sigtool.PackageIdentity, error) {
+	fileType, err := sigtool.DetectFileType(input)
+	if err != nil || fileType != sigtool.FileTypeMSIX {
+		return nil, err
+	}
+	return sigtool.ReadPackageIdentity(input)
+}
+
+// readNuGet returns the identity and signatures of input when it is a NuGet
+// package, and nil for other files
+func readNuGet(input string) (*sigtool.NuGetPackageInfo, error) {
+	fileType, err := sigtool.DetectFileType(input)
+	if err != nil || fileType != sigtool.FileTypeNuGet {
+		return nil, err
+	}
+	return sigtool.InspectNuGet(input)
+}
+
+// printNuGet prints the id and version of a NuGet package and the signer,
+// timestamp and repository details of each of its signatures
+func printNuGet(p *sigtool.NuGetPackageInfo) {
+	printf("NuGet package: %s %s\n", p.ID, p.Version)
+	for _, sig := range p.Signatures {
+		printf("%s signature: %s\n", sig.Type, sig.Signer.Subject)
+		if ts := sig.Timestamp; ts != nil {
+			printf("  Timestamp: %s", ts.Time.UTC().Format(time.RFC3339))
+			if ts.Signer != nil {
+				printf(" by %s", ts.Signer.Subject)
+			}
+			printLine()
+		}
+		if sig.ServiceIndex != "" {
+			printf("  Service index: %s\n", sig.ServiceIndex)
+		}
+		if len(sig.Owners) > 0 {
+			printf("  Owners: %s\n", strings.Join(sig.Owners, ", "))
+		}
+	}
+}
+
+// readNotarization returns the notarization status of input when it is a
+// Mach-O binary or disk image, and nil for other files. When online is set, Apple's
+// ticket service is asked for code without a stapled ticket.
+func readNotarization(input string, online bool) (*sigtool.NotarizationInfo, error) {
+	fileType, err := sigtool.DetectFileType(input)
+	if err != nil || (fileType != sigtool.FileTypeMachO && fileType != sigtool.FileTypeDMG) {
+		return nil, err
+	}
+	var lookup *sigtool.NotaryLookup
+	if online {
+		lookup = &sigtool.NotaryLookup{}
+	}
+	return sigtool.InspectNotarization(input, lookup)
+}
+
+// printNotarization prints whether each code signature is notarized and
+// the CDHashes its stapled ticket binds
+func printNotarization(n *sigtool.NotarizationInfo) {
+	printf("Notarized: %v\n", n.Notarized())
+	for _, c := range n.Code {
+		indent := "  "
+		if c.Arch != "" {
+			printf("  %s:\n", c.Arch)
+			indent = "    "
+		}
+		switch {
+		case c.Stapled:
+			printf("%sStapled ticket: %d bytes\n", indent, c.TicketSize)
+		case c.Online:
+			printf("%sTicket found by Apple's ticket service\n", indent)
+		default:
+			printf("%sNo notarization ticket\n", indent)
+		}
+		for _, cdhash := range c.CDHashes {
+			bound := ""
+			if slices.ContainsFunc(c.Bound, func(b []byte) bool { return bytes.Equal(b, cdhash) }) {
+				bound = " (bound by the ticket)"
+			}
+			printf("%sCDHash: %s%s\n", indent, hex.EncodeToString(cdhash), bound)
+		}
+		if c.LookupErr != nil {
+			warnf("unable to look up the notarization ticket: %v\n", c.LookupErr)
+		}
+	}
+}
+
+// appendWarning appends the warning "what: err" to warnings when err is set
+func appendWarning(warnings []string, what string, err error) []string {
+	if err == nil {
+		return warnings
+	}
+	return append(warnings, fmt.Sprintf("%s: %v", what, err))
+}
+
+// inspectFile returns the signature details, weak cryptography findings
+// and company name mismatch of input, printing a warning for each that
+// cannot be determined, and the error of inspecting the signature
+func inspectFile(input string) (*sigtool.SignatureInfo, []sigtool.WeakCryptoFinding, *sigtool.CompanyMismatch, error) {
+	info, inspectErr := sigtool.Inspect(input)
+	if inspectErr != nil {
+		warnf("unable to inspect signature: %v\n", inspectErr)
+	}
+	findings, err := sigtool.FindWeakCrypto(input)
+	if err != nil {
+		warnf("unable to check for weak cryptography: %v\n", err)
+	}
+	mismatch, err := sigtool.CheckCompanyName(input)
+	if err != nil {
+		warnf("unable to compare the company name with the signer: %v\n", err)
+	}
+	return info, findings, mismatch, inspectErr
+}
+
+// printWarnings prints the weak cryptography, self-signed, test-signing and
+// masquerading warnings for a signature
+func printWarnings(info *sigtool.SignatureInfo, findings []sigtool.WeakCryptoFinding, mismatch *sigtool.CompanyMismatch) {
+	for _, f := range findings {
+		warnf("signature %d: %s\n", f.Signature, f)
+	}
+	if info != nil && info.Signer != nil && info.Signer.SelfSigned {
+		warnf("signer certificate %q is self-signed\n", info.Signer.Subject)
+	}
+	if info != nil {
+		for _, c := range info.Certificates {
+			if c.TestSigningMarker != "" {
+				warnf("test-signing certificate %q (%s)\n", c.Subject, c.TestSigningMarker)
+			}
+		}
+	}
+	if mismatch != nil {
+		warnf("possible masquerading: %s\n", mismatch)
+	}
+}
+
+// printHashes prints the digests of a file, each line prefixed with indent
+func printHashes(indent string, h *hashesJSON) {
+	printf("%sMD5: %s\n", indent, h.MD5)
+	printf("%sSHA-1: %s\n", indent, h.SHA1)
+	printf("%sSHA-256: %s\n", indent, h.SHA256)
+	if h.AuthentihashSHA256 != "" {
+		printf("%sAuthentihash SHA-1: %s\n", indent, h.AuthentihashSHA1)
+		printf("%sAuthentihash SHA-256: %s\n", indent, h.AuthentihashSHA256)
+	}
+	if h.Imphash != "" {
+		printf("%sImphash: %s\n", indent, h.Imphash)
+	}
+	if h.RichHeaderHash != "" {
+		printf("%sRich header hash: %s\n", indent, h.RichHeaderHash)
+	}
+}
+
+// printProgramInfo prints the program name, publisher URL and EV status of
+// a signature
+func printProgramInfo(info *sigtool.SignatureInfo) {
+	if info == nil {
+		return
+	}
+	if info.ProgramName != "" {
+		printf("Program name: %s\n", info.ProgramName)
+	}
+	if info.MoreInfoURL != "" {
+		printf("More info: %s\n", info.MoreInfoURL)
+	}
+	if info.ExtendedValidation {
+		printLine("Extended Validation: yes")
+	}
+}
+
+// printCertificatesText prints every embedded certificate of info in full,
+// the signer first, followed by the timestamp signer when it is not
+// embedded in the primary signature
+func printCertificatesText(info *sigtool.SignatureInfo) {
+	printed := make(map[string]bool)
+	n := 0
+	show := func(c *sigtool.CertificateInfo, role string) {
+		if c == nil || printed[c.SHA256Thumbprint] {
+			return
+		}
+		printed[c.SHA256Thumbprint] = true
+		n++
+		title := fmt.Sprintf("Certificate %d", n)
+		if role != "" {
+			title += " (" + role + ")"
+		}
+		printLine()
+		printCertificateText(title, c)
+	}
+	show(info.Signer, "signer")
+	for i := range info.Certificates {
+		show(&info.Certificates[i], "")
+	}
+	if info.Timestamp != nil {
+		show(info.Timestamp.Signer, "timestamp signer")
+	}
+}
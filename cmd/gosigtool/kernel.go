@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/konidev20/sigtool"
+)
+
+// kernelResult is the JSON form of a kernel-mode policy report
+type kernelResult struct {
+	Path      string                      `json:"path"`
+	Kind      sigtool.KernelSignatureKind `json:"kind,omitempty"`
+	Compliant bool                        `json:"compliant"`
+	Checks    []kernelCheck               `json:"checks,omitempty"`
+	Error     string                      `json:"error,omitempty"`
+}
+
+type kernelCheck struct {
+	Requirement string `json:"requirement"`
+	Passed      bool   `json:"passed"`
+	Detail      string `json:"detail"`
+}
+
+// runKernel implements the kernel subcommand, which checks drivers against
+// the Windows kernel-mode code signing policy and reports the failed
+// requirements. It returns 0 when every driver complies and 1 otherwise.
+func runKernel(args []string) int {
+	fs := flag.NewFlagSet("kernel", flag.ContinueOnError)
+	registerVerbosity(fs)
+	jsonReport := fs.Bool("json", false, "This specifies if the results are printed as JSON")
+	var trust trustFlags
+	trust.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: gosigtool kernel [trust flags] <driver.sys>...\n\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return usageExit(err)
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "Error: at least one driver is required\n\n")
+		fs.Usage()
+		return exitUsage
+	}
+
+	opts, err := trust.verifyOptions()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return optionsExit(err)
+	}
+	if opts == nil {
+		opts = &sigtool.VerifyOptions{}
+	}
+	opts = withLogger(opts)
+
+	code := exitValid
+	results := make([]kernelResult, 0, fs.NArg())
+	for _, path := range fs.Args() {
+		result := kernelResult{Path: path}
+		report, err := sigtool.CheckKernelPolicy(path, *opts)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Kind = report.Kind
+			result.Compliant = report.Compliant()
+			for _, c := range report.Checks {
+				result.Checks = append(result.Checks, kernelCheck{Requirement: c.Requirement, Passed: c.Passed, Detail: c.Detail})
+			}
+		}
+		switch {
+		case err != nil:
+			code = worstExit(code, exitCodeFor(err))
+		case !result.Compliant:
+			code = worstExit(code, exitPolicy)
+		}
+		results = append(results, result)
+	}
+
+	if *jsonReport {
+		return printJSON(results, code)
+	}
+	for _, result := range results {
+		switch {
+		case result.Error != "":
+			printf("FAIL %s\n  %s\n", result.Path, result.Error)
+			continue
+		case result.Compliant:
+			printf("PASS %s (%s)\n", result.Path, result.Kind)
+		default:
+			printf("FAIL %s (%s)\n", result.Path, result.Kind)
+		}
+		for _, c := range result.Checks {
+			if !c.Passed {
+				printf("  [%s] %s\n", c.Requirement, c.Detail)
+			}
+		}
+	}
+	return code
+}
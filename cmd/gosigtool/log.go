@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"github.com/konidev20/sigtool"
+)
+
+// Verbosity levels selected by -q, -v and -vv
+const (
+	verbosityQuiet   = -1
+	verbosityNormal  = 0
+	verbosityVerbose = 1
+	verbosityDebug   = 2
+)
+
+// verbosity is the verbosity level of the command
+var verbosity = verbosityNormal
+
+// verbosityFlag is a boolean flag that sets verbosity to its value
+type verbosityFlag int
+
+func (f verbosityFlag) String() string   { return "false" }
+func (f verbosityFlag) IsBoolFlag() bool { return true }
+
+func (f verbosityFlag) Set(s string) error {
+	set, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	if set {
+		verbosity = int(f)
+	}
+	return nil
+}
+
+// registerVerbosity defines -q, -v and -vv on fs
+func registerVerbosity(fs *flag.FlagSet) {
+	fs.Var(verbosityFlag(verbosityQuiet), "q", "This specifies if text results and warnings are suppressed, leaving errors and the exit code; requested output such as -json or -out - is still written")
+	fs.Var(verbosityFlag(verbosityVerbose), "v", "This specifies if progress and notable verification steps are logged on stderr")
+	fs.Var(verbosityFlag(verbosityDebug), "vv", "This specifies if every verification step, including the offsets read, digests and chains built, is logged on stderr")
+}
+
+// logger returns the logger of the verbosity level, or nil below -v
+func logger() *slog.Logger {
+	level := slog.LevelInfo
+	switch verbosity {
+	case verbosityVerbose:
+	case verbosityDebug:
+		level = slog.LevelDebug
+	default:
+		return nil
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+}
+
+// logInfo logs msg at info level with -v or -vv
+func logInfo(msg string, args ...any) {
+	if l := logger(); l != nil {
+		l.Info(msg, args...)
+	}
+}
+
+// withLogger sets the Logger of opts with -v or -vv, allocating the zero
+// options when opts is nil, and returns opts
+func withLogger(opts *sigtool.VerifyOptions) *sigtool.VerifyOptions {
+	l := logger()
+	if l == nil {
+		return opts
+	}
+	if opts == nil {
+		opts = &sigtool.VerifyOptions{}
+	}
+	opts.Logger = l
+	return opts
+}
+
+// printf prints a text result on stdout unless -q is set
+func printf(format string, args ...any) {
+	if verbosity != verbosityQuiet {
+		fmt.Printf(format, args...)
+	}
+}
+
+// printLine is printf for fmt.Println
+func printLine(args ...any) {
+	if verbosity != verbosityQuiet {
+		fmt.Println(args...)
+	}
+}
+
+// warnf prints a warning on stderr unless -q is set
+func warnf(format string, args ...any) {
+	if verbosity != verbosityQuiet {
+		fmt.Fprintf(os.Stderr, "Warning: "+format, args...)
+	}
+}
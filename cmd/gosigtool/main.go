@@ -1,57 +1,373 @@
 package main
 
 import (
+	"encoding/hex"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
-	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/konidev20/sigtool"
 )
 
+// commands maps each subcommand to its implementation, which returns the
+// exit code
+var commands = map[string]func(args []string) int{
+	"extract":   runExtract,
+	"verify":    runVerify,
+	"inspect":   runInspect,
+	"sign":      runSign,
+	"strip":     runStrip,
+	"timestamp": runTimestamp,
+	"scan":      runScan,
+	"certs":     runCerts,
+	"policy":    runPolicy,
+	"kernel":    runKernel,
+	"watch":     runWatch,
+	"diff":      runDiff,
+	"esl":       runESL,
+	"repo":      runRepo,
+}
+
+const usage = `Usage: gosigtool <command> [flags]
+
+Commands:
+  extract    write the PKCS#7 signature of a PE file to a file
+  verify     validate the signatures of PE files
+  inspect    print the signer, certificates and timestamp of a signature
+  sign       Authenticode-sign a PE file
+  strip      remove the signature of a PE file
+  timestamp  add an RFC 3161 timestamp to a signature
+  scan       report the signature status of PE files
+  certs      write the certificates embedded in a signature
+  policy     audit PE files against a signing policy
+  kernel     check drivers against the kernel-mode signing policy
+  watch      verify PE files as they appear in directories
+  diff       compare the signatures of two PE files
+  esl        print the contents of Secure Boot signature databases
+  repo       verify APT repository releases and the packages they list
+
+Run "gosigtool <command> -h" for the flags of a command. The flat -in,
+-out and -validate flags of earlier releases are still accepted.
+`
+
 func main() {
-	inParam := flag.String("in", "", "This specifies the input Signed PE filename to read from")
-	outParam := flag.String("out", "", "This specifies the output PKCS#7 filename to write to")
-	isVerificationRequired := flag.Bool("validate", false, "This specifies if the PKCS#7 signature of the file should be verified")
+	if len(os.Args) == 1 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(exitUsage)
+	}
+	if len(os.Args) > 1 {
+		if run, ok := commands[os.Args[1]]; ok {
+			os.Exit(run(os.Args[2:]))
+		}
+		if os.Args[1] == "help" {
+			fmt.Print(usage)
+			return
+		}
+	}
+	os.Exit(runLegacy(os.Args[1:]))
+}
 
-	flag.Parse()
+// runLegacy implements the flat flags of earlier releases, which extract
+// the signature of a PE file and optionally validate it. It returns the
+// exit code.
+func runLegacy(args []string) int {
+	fs := flag.NewFlagSet("gosigtool", flag.ContinueOnError)
+	registerVerbosity(fs)
+	inParam := fs.String("in", "", "This specifies the input Signed PE filename to read from")
+	outParam := fs.String("out", "", "This specifies the output signature filename to write to")
+	isVerificationRequired := fs.Bool("validate", false, "This specifies if the PKCS#7 signature of the file should be verified")
+	jsonReport := fs.Bool("json", false, "This specifies if a JSON report of the signature and its digests should be printed")
+	rawTable := fs.Bool("raw", false, "This specifies if the whole certificate table, WIN_CERTIFICATE headers and padding included, is written instead of the PKCS#7 signature")
+	strictPE := fs.Bool("strict-pe", false, "This specifies if files with malformed PE headers are rejected instead of parsed leniently")
+	diffParam := fs.String("diff", "", "This specifies another Signed PE filename whose signature is compared against the input")
+	var vf verifyFlags
+	vf.register(fs)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage+"\nLegacy flags:\n")
+		fs.PrintDefaults()
+	}
+	explicit, err := parseFlagsExplicit(fs, args)
+	if err != nil {
+		return usageExit(err)
+	}
 	if *inParam == "" {
 		fmt.Fprintf(os.Stderr, "Error: input file (-in) is required\n\n")
-		flag.PrintDefaults()
-		os.Exit(1)
+		fs.Usage()
+		return exitUsage
 	}
 
-	buf, err := sigtool.ExtractDigitalSignature(*inParam)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error extracting signature: %v\n", err)
-		os.Exit(1)
+	// Verification flags from the configuration file apply only with
+	// -validate, since the file is shared with the verify subcommands
+	var verifyOpts *sigtool.VerifyOptions
+	if *isVerificationRequired {
+		if verifyOpts, err = vf.verifyOptions(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return optionsExit(err)
+		}
+	} else if name := verificationFlagGiven(explicit); name != "" {
+		fmt.Fprintf(os.Stderr, "Error: verification flags require -validate (-%s given)\n", name)
+		return exitUsage
 	}
 
-	if *isVerificationRequired {
-		err = sigtool.IsValidDigitalSignature(*inParam)
+	if *diffParam != "" {
+		diff, err := sigtool.DiffSignatures(*inParam, *diffParam)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error validating signature: %v\n", err)
-			os.Exit(1)
+			fmt.Fprintf(os.Stderr, "Error comparing signatures: %v\n", err)
+			return exitCodeFor(err)
+		}
+		if *jsonReport {
+			return printJSON(diff, exitValid)
 		}
-		fmt.Println("Signature is valid")
+		printf("%s", diff)
+		return exitValid
+	}
+
+	if *strictPE {
+		if err := sigtool.ValidatePEHeaders(*inParam); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitCodeFor(err)
+		}
+	}
+	if *isVerificationRequired {
+		if code := verifyFile(*inParam, withLogger(verifyOpts), vf.allChecks); code != exitValid {
+			return code
+		}
+		if !*jsonReport {
+			printLine("Signature is valid")
+		}
+	}
+
+	outputPath, bundle, err := extractSignature(*inParam, *outParam, sigtool.FormatDER, *rawTable, *jsonReport)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitCodeFor(err)
+	}
+	info, findings, mismatch, _ := inspectFile(*inParam)
+	if *jsonReport {
+		if err := printReport(*inParam, outputPath, *isVerificationRequired, bundle, info, findings, mismatch); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON report: %v\n", err)
+			return exitIOError
+		}
+		return exitValid
+	}
+
+	printWarnings(info, findings, mismatch)
+	if outputPath != stdio {
+		printf("Successfully extracted signature to %q\n", outputPath)
+		printProgramInfo(info)
+	}
+	return exitValid
+}
+
+// verificationFlagGiven returns the verification flag of explicit, the
+// flags given on the command line, or "" when there is none
+func verificationFlagGiven(explicit map[string]bool) string {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	var vf verifyFlags
+	vf.register(fs)
+	var given string
+	fs.VisitAll(func(f *flag.Flag) {
+		if given == "" && explicit[f.Name] {
+			given = f.Name
+		}
+	})
+	return given
+}
+
+// trustFlags holds the command-line flags that control chain validation
+type trustFlags struct {
+	atTime           string
+	caFile           string
+	caPath           string
+	msRoots          bool
+	winStore         bool
+	trustedPublisher bool
+	crossCert        string
+	aia              bool
+	aiaTimeout       time.Duration
+	ocsp             bool
+	ocspHardFail     bool
+	ocspTimeout      time.Duration
+	crlFiles         stringList
+	crlCheck         bool
+	crlHardFail      bool
+}
+
+// register defines the trust flags on fs
+func (f *trustFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.atTime, "at-time", "", "This specifies the time (RFC 3339 or YYYY-MM-DD) at which the certificate chain must be valid")
+	fs.StringVar(&f.caFile, "cafile", "", "This specifies a PEM bundle of trusted root and intermediate certificates used instead of the system roots")
+	fs.StringVar(&f.caPath, "capath", "", "This specifies a directory of PEM certificates used instead of the system roots")
+	fs.BoolVar(&f.msRoots, "msroots", false, "This specifies if the embedded Microsoft code-signing roots are used instead of the system roots (requires a build with -tags sigtool_msroots)")
+	fs.BoolVar(&f.winStore, "winstore", false, "This specifies if the local machine's Windows ROOT and CA certificate stores are used instead of the system roots (Windows only)")
+	fs.StringVar(&f.crossCert, "cross-cert", "", "This specifies a PEM or DER file of cross-certificates used to build alternative chains")
+	fs.BoolVar(&f.aia, "aia", false, "This specifies if missing intermediate certificates are downloaded from their Authority Information Access URLs")
+	fs.DurationVar(&f.aiaTimeout, "aia-timeout", sigtool.DefaultAIATimeout, "This specifies the timeout of each Authority Information Access download")
+	fs.BoolVar(&f.ocsp, "ocsp", false, "This specifies if the signer and timestamp authority chains are checked for revocation with OCSP (soft-fail)")
+	fs.BoolVar(&f.ocspHardFail, "ocsp-hard-fail", false, "This specifies if an undeterminable OCSP status fails validation (implies -ocsp)")
+	fs.DurationVar(&f.ocspTimeout, "ocsp-timeout", sigtool.DefaultOCSPTimeout, "This specifies the timeout of each OCSP request")
+	fs.Var(&f.crlFiles, "crl", "This specifies a local DER or PEM CRL (base or delta) used for revocation checking; may be repeated")
+	fs.BoolVar(&f.crlCheck, "crl-check", false, "This specifies if the signer and timestamp authority chains are checked against CRLs from their distribution points (soft-fail)")
+	fs.BoolVar(&f.crlHardFail, "crl-hard-fail", false, "This specifies if an undeterminable CRL status fails validation (implies -crl-check)")
+	fs.BoolVar(&f.trustedPublisher, "trusted-publisher", false, "This specifies if the signer must be in the Windows TrustedPublisher store (implies -winstore)")
+}
+
+// stringList is a repeatable string flag
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// verifyOptions returns the chain verification options selected by the
+// trust flags, or nil when none is set. Without a CA bundle the chain is
+// validated against the Windows stores with -winstore, the embedded
+// Microsoft roots with -msroots and the system roots otherwise.
+func (f *trustFlags) verifyOptions() (*sigtool.VerifyOptions, error) {
+	if f.atTime == "" && f.caFile == "" && f.caPath == "" && !f.msRoots && !f.winStore && !f.trustedPublisher && !f.aia && f.crossCert == "" && !f.ocsp && !f.ocspHardFail &&
+		len(f.crlFiles) == 0 && !f.crlCheck && !f.crlHardFail {
+		return nil, nil
 	}
 
-	var outputPath string
-	if *outParam != "" {
-		outputPath = *outParam
-	} else {
-		fileName := filepath.Base(*inParam)
-		if fileName == "." || fileName == "" {
-			fmt.Fprintf(os.Stderr, "Error: unable to determine output filename from input path\n")
-			os.Exit(1)
+	opts := &sigtool.VerifyOptions{
+		UseSystemRoots:          true,
+		UseMicrosoftRoots:       f.msRoots,
+		UseWindowsStores:        f.winStore || f.trustedPublisher,
+		RequireTrustedPublisher: f.trustedPublisher,
+	}
+	if f.crossCert != "" {
+		cross, err := sigtool.LoadCertificates(f.crossCert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load cross-certificates: %w", err)
+		}
+		opts.CrossCertificates = cross
+	}
+	if f.aia {
+		opts.AIAFetcher = sigtool.NewAIAFetcher(f.aiaTimeout)
+	}
+	if f.ocsp || f.ocspHardFail {
+		opts.OCSP = sigtool.NewOCSPChecker(f.ocspTimeout, f.ocspHardFail)
+	}
+	if len(f.crlFiles) > 0 || f.crlCheck || f.crlHardFail {
+		opts.CRL = sigtool.NewCRLChecker(0, f.crlHardFail)
+		for _, path := range f.crlFiles {
+			if err := opts.CRL.LoadCRLFile(path); err != nil {
+				return nil, fmt.Errorf("failed to load CRL: %w", err)
+			}
+		}
+	}
+	if f.atTime != "" {
+		at, err := parseTime(f.atTime)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -at-time value: %w", err)
 		}
-		outputPath = fileName + ".pkcs7"
+		opts.VerificationTime = at
 	}
+	if f.caFile != "" || f.caPath != "" {
+		roots, intermediates, err := sigtool.LoadTrustAnchors(f.caFile, f.caPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load CA certificates: %w", err)
+		}
+		opts.Roots = roots
+		opts.Intermediates = intermediates
+	}
+	return opts, nil
+}
 
-	if err := os.WriteFile(outputPath, buf, 0600); err != nil {
-		fmt.Fprintf(os.Stderr, "Error writing output file %q: %v\n", outputPath, err)
-		os.Exit(1)
+// parseTime accepts an RFC 3339 timestamp or a plain YYYY-MM-DD date in UTC
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
 	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected RFC 3339 or YYYY-MM-DD, got %q", value)
+	}
+	return t, nil
+}
+
+// report is the JSON document printed by the -json flag
+type report struct {
+	Input           string              `json:"input"`
+	Output          string              `json:"output"`
+	Validated       bool                `json:"validated"`
+	SignatureSize   int                 `json:"signatureSize"`
+	RawSignature    []byte              `json:"rawSignature"`
+	StoredAlgorithm string              `json:"storedAlgorithm,omitempty"`
+	StoredDigest    string              `json:"storedDigest,omitempty"`
+	ComputedDigest  string              `json:"computedDigest,omitempty"`
+	DigestMatch     *bool               `json:"digestMatch,omitempty"`
+	ProgramName     string              `json:"programName,omitempty"`
+	MoreInfoURL     string              `json:"moreInfoUrl,omitempty"`
+	TestSigned      bool                `json:"testSigned"`
+	EV              bool                `json:"extendedValidation"`
+	WeakCrypto      []weakCryptoFinding `json:"weakCrypto,omitempty"`
+	CompanyMismatch *companyMismatch    `json:"companyMismatch,omitempty"`
+	Signature       *signatureJSON      `json:"signature,omitempty"`
+}
 
-	fmt.Printf("Successfully extracted signature to %q\n", outputPath)
+// companyMismatch is a sigtool.CompanyMismatch in the JSON report
+type companyMismatch struct {
+	CompanyName string `json:"companyName"`
+	Vendor      string `json:"vendor"`
+	Signer      string `json:"signer"`
+}
+
+// weakCryptoFinding is a sigtool.WeakCryptoFinding in the JSON report
+type weakCryptoFinding struct {
+	Kind      string `json:"kind"`
+	Signature int    `json:"signature"`
+	Subject   string `json:"subject,omitempty"`
+	Detail    string `json:"detail"`
+}
+
+func printReport(input, output string, validated bool, bundle *sigtool.SignatureBundle, info *sigtool.SignatureInfo, findings []sigtool.WeakCryptoFinding, mismatch *sigtool.CompanyMismatch) error {
+	r := report{
+		Input:         input,
+		Output:        output,
+		Validated:     validated,
+		SignatureSize: len(bundle.RawSignature),
+		RawSignature:  bundle.RawSignature,
+	}
+	// Only PE files carry the Authenticode digests
+	if bundle.StoredDigest != nil {
+		r.StoredAlgorithm = bundle.StoredAlgorithm.String()
+		r.StoredDigest = hex.EncodeToString(bundle.StoredDigest)
+		r.ComputedDigest = hex.EncodeToString(bundle.ComputedDigest)
+		r.DigestMatch = &bundle.DigestMatch
+	}
+	if info != nil {
+		r.ProgramName = info.ProgramName
+		r.MoreInfoURL = info.MoreInfoURL
+		r.TestSigned = info.TestSigned
+		r.EV = info.ExtendedValidation
+	}
+	r.WeakCrypto = newWeakCryptoJSON(findings)
+	r.CompanyMismatch = newCompanyMismatchJSON(mismatch)
+	r.Signature = newSignatureJSON(info)
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func newWeakCryptoJSON(findings []sigtool.WeakCryptoFinding) []weakCryptoFinding {
+	var out []weakCryptoFinding
+	for _, f := range findings {
+		out = append(out, weakCryptoFinding{Kind: f.Kind.String(), Signature: f.Signature, Subject: f.Subject, Detail: f.Detail})
+	}
+	return out
+}
+
+func newCompanyMismatchJSON(mismatch *sigtool.CompanyMismatch) *companyMismatch {
+	if mismatch == nil {
+		return nil
+	}
+	return &companyMismatch{CompanyName: mismatch.CompanyName, Vendor: mismatch.Vendor, Signer: mismatch.Signer}
 }
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/konidev20/sigtool"
+)
+
+// certificateJSON is a sigtool.CertificateInfo in JSON output
+type certificateJSON struct {
+	Subject            string    `json:"subject"`
+	CommonName         string    `json:"commonName,omitempty"`
+	Issuer             string    `json:"issuer"`
+	SerialNumber       string    `json:"serialNumber"`
+	NotBefore          time.Time `json:"notBefore"`
+	NotAfter           time.Time `json:"notAfter"`
+	SHA1Thumbprint     string    `json:"sha1Thumbprint"`
+	SHA256Thumbprint   string    `json:"sha256Thumbprint"`
+	SelfSigned         bool      `json:"selfSigned"`
+	TestSigningMarker  string    `json:"testSigningMarker,omitempty"`
+	ExtendedValidation bool      `json:"extendedValidation"`
+}
+
+// timestampJSON is a sigtool.TimestampInfo in JSON output
+type timestampJSON struct {
+	Type   string           `json:"type"`
+	Time   time.Time        `json:"time"`
+	Signer *certificateJSON `json:"signer,omitempty"`
+}
+
+// signatureJSON is a sigtool.SignatureInfo in JSON output
+type signatureJSON struct {
+	Signer             *certificateJSON  `json:"signer,omitempty"`
+	DigestAlgorithm    string            `json:"digestAlgorithm"`
+	Digest             string            `json:"digest"`
+	SigningTime        *time.Time        `json:"signingTime,omitempty"`
+	Certificates       []certificateJSON `json:"certificates"`
+	Timestamp          *timestampJSON    `json:"timestamp,omitempty"`
+	ProgramName        string            `json:"programName,omitempty"`
+	MoreInfoURL        string            `json:"moreInfoUrl,omitempty"`
+	TestSigned         bool              `json:"testSigned"`
+	ExtendedValidation bool              `json:"extendedValidation"`
+}
+
+// hashesJSON is a sigtool.FileHashes in JSON output
+type hashesJSON struct {
+	MD5                string `json:"md5"`
+	SHA1               string `json:"sha1"`
+	SHA256             string `json:"sha256"`
+	AuthentihashSHA1   string `json:"authentihashSha1,omitempty"`
+	AuthentihashSHA256 string `json:"authentihashSha256,omitempty"`
+	Imphash            string `json:"imphash,omitempty"`
+	RichHeaderHash     string `json:"richHeaderHash,omitempty"`
+}
+
+// packageJSON is a sigtool.PackageIdentity in JSON output, with whether
+// the publisher matches the signer as Windows requires
+type packageJSON struct {
+	Name                  string `json:"name"`
+	Publisher             string `json:"publisher"`
+	Version               string `json:"version"`
+	ProcessorArchitecture string `json:"processorArchitecture,omitempty"`
+	PublisherID           string `json:"publisherId"`
+	FamilyName            string `json:"familyName"`
+	Bundle                bool   `json:"bundle"`
+	SignerMatches         bool   `json:"signerMatches"`
+}
+
+// nugetJSON is a sigtool.NuGetPackageInfo in JSON output
+type nugetJSON struct {
+	ID         string               `json:"id"`
+	Version    string               `json:"version"`
+	Signatures []nugetSignatureJSON `json:"signatures"`
+}
+
+// nugetSignatureJSON is a sigtool.NuGetSignature in JSON output
+type nugetSignatureJSON struct {
+	Type         string           `json:"type"`
+	Signer       *certificateJSON `json:"signer"`
+	Timestamp    *timestampJSON   `json:"timestamp,omitempty"`
+	ServiceIndex string           `json:"serviceIndex,omitempty"`
+	Owners       []string         `json:"owners,omitempty"`
+}
+
+// payloadJSON is a sigtool.PayloadSignature in JSON output
+type payloadJSON struct {
+	Path          string           `json:"path"`
+	Type          string           `json:"type"`
+	Size          int64            `json:"size"`
+	Valid         bool             `json:"valid"`
+	Error         string           `json:"error,omitempty"`
+	Signer        *certificateJSON `json:"signer,omitempty"`
+	PayloadsError string           `json:"payloadsError,omitempty"`
+}
+
+// architectureJSON is a sigtool.MachOSignature in JSON output
+type architectureJSON struct {
+	Arch       string           `json:"arch"`
+	Identifier string           `json:"identifier,omitempty"`
+	TeamID     string           `json:"teamId,omitempty"`
+	CDHash     string           `json:"cdhash,omitempty"`
+	Valid      bool             `json:"valid"`
+	Error      string           `json:"error,omitempty"`
+	Signer     *certificateJSON `json:"signer,omitempty"`
+}
+
+// notarizationJSON is a sigtool.NotarizationInfo in JSON output
+type notarizationJSON struct {
+	Notarized bool                `json:"notarized"`
+	Code      []notarizedCodeJSON `json:"code"`
+}
+
+// notarizedCodeJSON is a sigtool.NotarizedCode in JSON output
+type notarizedCodeJSON struct {
+	Arch        string   `json:"arch,omitempty"`
+	CDHashes    []string `json:"cdhashes,omitempty"`
+	Stapled     bool     `json:"stapled"`
+	TicketSize  int      `json:"ticketSize,omitempty"`
+	Bound       []string `json:"bound,omitempty"`
+	Online      bool     `json:"online,omitempty"`
+	LookupError string   `json:"lookupError,omitempty"`
+}
+
+// fileResult is the JSON output of the subcommands that write a file
+type fileResult struct {
+	Input  string   `json:"input"`
+	Output string   `json:"output,omitempty"`
+	Files  []string `json:"files,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+func newCertificateJSON(c *sigtool.CertificateInfo) *certificateJSON {
+	if c == nil {
+		return nil
+	}
+	return &certificateJSON{
+		Subject:            c.Subject,
+		CommonName:         c.CommonName,
+		Issuer:             c.Issuer,
+		SerialNumber:       c.SerialNumber,
+		NotBefore:          c.NotBefore,
+		NotAfter:           c.NotAfter,
+		SHA1Thumbprint:     c.SHA1Thumbprint,
+		SHA256Thumbprint:   c.SHA256Thumbprint,
+		SelfSigned:         c.SelfSigned,
+		TestSigningMarker:  c.TestSigningMarker,
+		ExtendedValidation: c.ExtendedValidation,
+	}
+}
+
+func newHashesJSON(h *sigtool.FileHashes) *hashesJSON {
+	if h == nil {
+		return nil
+	}
+	return &hashesJSON{
+		MD5:                hex.EncodeToString(h.MD5),
+		SHA1:               hex.EncodeToString(h.SHA1),
+		SHA256:             hex.EncodeToString(h.SHA256),
+		AuthentihashSHA1:   hex.EncodeToString(h.AuthentihashSHA1),
+		AuthentihashSHA256: hex.EncodeToString(h.AuthentihashSHA256),
+		Imphash:            hex.EncodeToString(h.Imphash),
+		RichHeaderHash:     hex.EncodeToString(h.RichHeaderHash),
+	}
+}
+
+func newPackageJSON(p *sigtool.PackageIdentity, info *sigtool.SignatureInfo) *packageJSON {
+	if p == nil {
+		return nil
+	}
+	return &packageJSON{
+		Name:                  p.Name,
+		Publisher:             p.Publisher,
+		Version:               p.Version,
+		ProcessorArchitecture: p.ProcessorArchitecture,
+		PublisherID:           p.PublisherID,
+		FamilyName:            p.FamilyName,
+		Bundle:                p.Bundle,
+		SignerMatches:         info != nil && info.Signer != nil && sigtool.MatchSignerName(info.Signer.Certificate, p.Publisher),
+	}
+}
+
+func newNuGetJSON(p *sigtool.NuGetPackageInfo) *nugetJSON {
+	if p == nil {
+		return nil
+	}
+	n := &nugetJSON{ID: p.ID, Version: p.Version, Signatures: make([]nugetSignatureJSON, 0, len(p.Signatures))}
+	for _, sig := range p.Signatures {
+		s := nugetSignatureJSON{
+			Type:         string(sig.Type),
+			Signer:       newCertificateJSON(sig.Signer),
+			ServiceIndex: sig.ServiceIndex,
+			Owners:       sig.Owners,
+		}
+		if ts := sig.Timestamp; ts != nil {
+			s.Timestamp = &timestampJSON{Type: string(ts.Type), Time: ts.Time, Signer: newCertificateJSON(ts.Signer)}
+		}
+		n.Signatures = append(n.Signatures, s)
+	}
+	return n
+}
+
+func newPayloadsJSON(payloads []sigtool.PayloadSignature) []payloadJSON {
+	out := make([]payloadJSON, 0, len(payloads))
+	for _, p := range payloads {
+		out = append(out, payloadJSON{
+			Path:          p.Path,
+			Type:          string(p.Type),
+			Size:          p.Size,
+			Valid:         p.Valid(),
+			Error:         errorString(p.Err),
+			Signer:        newCertificateJSON(p.Signer),
+			PayloadsError: errorString(p.PayloadsErr),
+		})
+	}
+	return out
+}
+
+func newArchitecturesJSON(slices []sigtool.MachOSignature) []architectureJSON {
+	out := make([]architectureJSON, 0, len(slices))
+	for _, s := range slices {
+		out = append(out, architectureJSON{
+			Arch:       s.Arch,
+			Identifier: s.Identifier,
+			TeamID:     s.TeamID,
+			CDHash:     hex.EncodeToString(s.CDHash),
+			Valid:      s.Valid(),
+			Error:      errorString(s.Err),
+			Signer:     newCertificateJSON(s.Signer),
+		})
+	}
+	return out
+}
+
+func newNotarizationJSON(info *sigtool.NotarizationInfo) *notarizationJSON {
+	if info == nil {
+		return nil
+	}
+	n := &notarizationJSON{Notarized: info.Notarized(), Code: make([]notarizedCodeJSON, 0, len(info.Code))}
+	for _, c := range info.Code {
+		n.Code = append(n.Code, notarizedCodeJSON{
+			Arch:        c.Arch,
+			CDHashes:    hexStrings(c.CDHashes),
+			Stapled:     c.Stapled,
+			TicketSize:  c.TicketSize,
+			Bound:       hexStrings(c.Bound),
+			Online:      c.Online,
+			LookupError: errorString(c.LookupErr),
+		})
+	}
+	return n
+}
+
+// hexStrings returns each of values hex-encoded
+func hexStrings(values [][]byte) []string {
+	var out []string
+	for _, v := range values {
+		out = append(out, hex.EncodeToString(v))
+	}
+	return out
+}
+
+func newSignatureJSON(info *sigtool.SignatureInfo) *signatureJSON {
+	if info == nil {
+		return nil
+	}
+	s := &signatureJSON{
+		Signer:             newCertificateJSON(info.Signer),
+		DigestAlgorithm:    info.DigestAlgorithm.String(),
+		Digest:             hex.EncodeToString(info.Digest),
+		Certificates:       make([]certificateJSON, 0, len(info.Certificates)),
+		ProgramName:        info.ProgramName,
+		MoreInfoURL:        info.MoreInfoURL,
+		TestSigned:         info.TestSigned,
+		ExtendedValidation: info.ExtendedValidation,
+	}
+	if !info.SigningTime.IsZero() {
+		s.SigningTime = &info.SigningTime
+	}
+	for i := range info.Certificates {
+		s.Certificates = append(s.Certificates, *newCertificateJSON(&info.Certificates[i]))
+	}
+	if ts := info.Timestamp; ts != nil {
+		s.Timestamp = &timestampJSON{Type: string(ts.Type), Time: ts.Time, Signer: newCertificateJSON(ts.Signer)}
+	}
+	return s
+}
+
+// errorString returns the message of err, or an empty string when it is nil
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// printJSON writes v to stdout as indented JSON and returns code, or 1 when
+// v cannot be written
+func printJSON(v any, code int) int {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing JSON report: %v\n", err)
+		return exitIOError
+	}
+	return code
+}
+
+// reportFiles prints the outcome of a subcommand that writes files: result
+// as JSON when jsonReport is set, and otherwise err on stderr or message,
+// formatted with the output path, on stdout. It returns the exit code.
+func reportFiles(jsonReport bool, result fileResult, err error, message string) int {
+	code := exitValid
+	if err != nil {
+		result.Output, result.Files, result.Error = "", nil, err.Error()
+		code = failureExit(err)
+	}
+	if jsonReport {
+		return printJSON(result, code)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return code
+	}
+	// Standard output holds the written file
+	if result.Output != stdio {
+		printf(message+"\n", result.Output)
+	}
+	return code
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/konidev20/sigtool"
+)
+
+// pgpSignatureJSON is a sigtool.PGPSignatureInfo in JSON output
+type pgpSignatureJSON struct {
+	Kind          string    `json:"kind"`
+	Version       int       `json:"version"`
+	KeyID         string    `json:"keyId,omitempty"`
+	Algorithm     string    `json:"algorithm"`
+	HashAlgorithm string    `json:"hashAlgorithm"`
+	CreationTime  time.Time `json:"creationTime"`
+	Fingerprint   string    `json:"fingerprint,omitempty"`
+	UserID        string    `json:"userId,omitempty"`
+}
+
+// newPGPSignaturesJSON returns the JSON form of signatures
+func newPGPSignaturesJSON(signatures []sigtool.PGPSignatureInfo) []pgpSignatureJSON {
+	var out []pgpSignatureJSON
+	for _, s := range signatures {
+		out = append(out, pgpSignatureJSON{
+			Kind:          s.Kind,
+			Version:       s.Version,
+			KeyID:         s.KeyID,
+			Algorithm:     s.PublicKeyAlgorithm,
+			HashAlgorithm: s.HashAlgorithm.String(),
+			CreationTime:  s.CreationTime,
+			Fingerprint:   s.Fingerprint,
+			UserID:        s.UserID,
+		})
+	}
+	return out
+}
+
+// loadPGPKeyring reads the OpenPGP keys of paths, returning nil when none
+// is given
+func loadPGPKeyring(paths []string) (*sigtool.PGPKeyring, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	keyring, err := sigtool.LoadPGPKeyring(paths...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load OpenPGP keys: %w", err)
+	}
+	return keyring, nil
+}
+
+// readPGPSignatures returns the OpenPGP signatures of input when it is an
+// RPM or Debian package or an AppImage, naming their signers from the keys
+// of keyrings, and nil for other files
+func readPGPSignatures(input string, keyrings []string) ([]sigtool.PGPSignatureInfo, error) {
+	switch fileType, err := sigtool.DetectFileType(input); {
+	case err != nil:
+		return nil, err
+	case fileType != sigtool.FileTypeRPM && fileType != sigtool.FileTypeDeb && fileType != sigtool.FileTypeAppImage:
+		return nil, nil
+	}
+	keyring, err := loadPGPKeyring(keyrings)
+	if err != nil {
+		return nil, err
+	}
+	return sigtool.InspectPGPSignatures(input, keyring)
+}
+
+// printPGPSignatures prints the signing key, algorithms and creation time
+// of each OpenPGP signature
+func printPGPSignatures(signatures []sigtool.PGPSignatureInfo) {
+	printf("OpenPGP signatures:\n")
+	for _, s := range signatures {
+		printf("  %s: v%d %s/%s by key %s, made %s\n", s.Kind, s.Version, s.PublicKeyAlgorithm, s.HashAlgorithm, s.KeyID, s.CreationTime.UTC().Format(time.RFC3339))
+		if s.UserID != "" {
+			printf("    %s\n    fingerprint %s\n", s.UserID, s.Fingerprint)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/konidev20/sigtool"
+)
+
+// runPolicy implements the policy subcommand, which evaluates PE files
+// against a JSON or YAML policy and reports the violated rules. It returns
+// 0 when every file passes and 1 otherwise.
+func runPolicy(args []string) int {
+	fs := flag.NewFlagSet("policy", flag.ContinueOnError)
+	registerVerbosity(fs)
+	policyParam := fs.String("policy", "", "This specifies the JSON or YAML policy file to evaluate the files against")
+	jsonReport := fs.Bool("json", false, "This specifies if the results are printed as JSON")
+	var trust trustFlags
+	trust.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: gosigtool policy -policy <policy.json|policy.yaml> [trust flags] <pe_file>...\n\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return usageExit(err)
+	}
+	if *policyParam == "" || fs.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "Error: a policy (-policy) and at least one file are required\n\n")
+		fs.Usage()
+		return exitUsage
+	}
+
+	policy, err := sigtool.LoadPolicy(*policyParam)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return optionsExit(err)
+	}
+	opts, err := trust.verifyOptions()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return optionsExit(err)
+	}
+	if opts == nil {
+		opts = &sigtool.VerifyOptions{}
+	}
+	opts = withLogger(opts)
+
+	code := exitValid
+	results := make([]*sigtool.PolicyResult, 0, fs.NArg())
+	for _, path := range fs.Args() {
+		result := policy.Evaluate(path, *opts)
+		results = append(results, result)
+		if !result.Pass() {
+			code = exitPolicy
+		}
+	}
+
+	if *jsonReport {
+		return printJSON(results, code)
+	}
+	for _, result := range results {
+		if result.Pass() {
+			printf("PASS %s\n", result.Path)
+			continue
+		}
+		printf("FAIL %s\n", result.Path)
+		for _, v := range result.Violations {
+			printf("  [%s] %s\n", v.RuleID, v.Message)
+		}
+	}
+	return code
+}
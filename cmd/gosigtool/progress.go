@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Progress report intervals: a terminal line is redrawn often, while logs
+// get a line now and then
+const (
+	terminalProgressInterval = 200 * time.Millisecond
+	logProgressInterval      = 30 * time.Second
+)
+
+// progress reports on stderr how far a scan of total files has got, with
+// the last path verified and the estimated time remaining. On a terminal the
+// report is one line redrawn in place; otherwise a line is printed every
+// logProgressInterval.
+type progress struct {
+	total    int
+	done     int
+	start    time.Time
+	last     time.Time
+	terminal bool
+	// width is the length of the line drawn on the terminal
+	width int
+}
+
+// newProgress starts reporting the progress of a scan of total files
+func newProgress(total int) *progress {
+	now := time.Now()
+	p := &progress{total: total, start: now, last: now}
+	if info, err := os.Stderr.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		p.terminal = true
+	}
+	return p
+}
+
+// update records that path was verified, reporting the progress when the
+// interval has elapsed
+func (p *progress) update(path string) {
+	p.done++
+	now := time.Now()
+	interval := logProgressInterval
+	if p.terminal {
+		interval = terminalProgressInterval
+	}
+	if now.Sub(p.last) < interval {
+		return
+	}
+	p.last = now
+	p.print(p.line(now, path))
+}
+
+// finish clears the terminal line
+func (p *progress) finish() {
+	if p.terminal && p.width > 0 {
+		fmt.Fprintf(os.Stderr, "\r%s\r", strings.Repeat(" ", p.width))
+	}
+}
+
+// line returns the progress report after path
+func (p *progress) line(now time.Time, path string) string {
+	percent := 0.0
+	if p.total > 0 {
+		percent = 100 * float64(p.done) / float64(p.total)
+	}
+	line := fmt.Sprintf("scanned %d/%d files (%.1f%%)", p.done, p.total, percent)
+	if p.done > 0 && p.done < p.total {
+		elapsed := now.Sub(p.start)
+		eta := time.Duration(float64(elapsed) / float64(p.done) * float64(p.total-p.done))
+		line += fmt.Sprintf(", ETA %s", eta.Round(time.Second))
+	}
+	if p.terminal {
+		// Keep the line on one terminal row
+		const maxPath = 60
+		if len(path) > maxPath {
+			path = "..." + path[len(path)-maxPath+3:]
+		}
+	}
+	return line + ": " + path
+}
+
+// print writes line to stderr, in place on a terminal
+func (p *progress) print(line string) {
+	if !p.terminal {
+		fmt.Fprintln(os.Stderr, line)
+		return
+	}
+	padding := ""
+	if len(line) < p.width {
+		padding = strings.Repeat(" ", p.width-len(line))
+	}
+	fmt.Fprintf(os.Stderr, "\r%s%s", line, padding)
+	p.width = len(line)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/konidev20/sigtool"
+)
+
+// repoResult is the JSON form of a verified APT repository release
+type repoResult struct {
+	Path       string            `json:"path"`
+	Valid      bool              `json:"valid"`
+	Error      string            `json:"error,omitempty"`
+	Origin     string            `json:"origin,omitempty"`
+	Suite      string            `json:"suite,omitempty"`
+	Codename   string            `json:"codename,omitempty"`
+	Date       *time.Time        `json:"date,omitempty"`
+	ValidUntil *time.Time        `json:"validUntil,omitempty"`
+	Signature  *pgpSignatureJSON `json:"signature,omitempty"`
+	Indexes    []repoFileResult  `json:"indexes,omitempty"`
+	Packages   []repoFileResult  `json:"packages,omitempty"`
+}
+
+// repoFileResult is the outcome of checking an index or package against
+// the release
+type repoFileResult struct {
+	Path  string `json:"path"`
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+}
+
+// runRepo implements the repo subcommand, which verifies the signature of
+// an APT repository release, an InRelease file or a Release file with its
+// Release.gpg, then checks downloaded indexes and packages against it as
+// apt does. It returns the exit code.
+func runRepo(args []string) int {
+	fs := flag.NewFlagSet("repo", flag.ContinueOnError)
+	registerVerbosity(fs)
+	var pgpKeyrings, indexes stringList
+	fs.Var(&pgpKeyrings, "pgp-keyring", "This specifies an OpenPGP key file or keyring, such as /usr/share/keyrings/debian-archive-keyring.gpg, whose keys the release must be signed by; may be repeated")
+	detached := fs.String("detached", "", "This specifies the Release.gpg signature of a Release file; without it the release must be an InRelease file")
+	fs.Var(&indexes, "index", "This specifies a downloaded index as <name>=<path>, with the name the release lists, such as main/binary-amd64/Packages.gz=Packages.gz; the packages are checked against the first; may be repeated")
+	atTime := fs.String("at-time", "", "This specifies the time the Valid-Until date of the release is checked at, (RFC 3339 or YYYY-MM-DD), instead of now")
+	jsonReport := fs.Bool("json", false, "This specifies if the results are printed as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: gosigtool repo -pgp-keyring <key_file> [-detached <Release.gpg>] [-index <name>=<path>]... [-at-time <time>] [-json] <InRelease|Release> [package.deb...]\n\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return usageExit(err)
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "Error: a release file is required\n\n")
+		fs.Usage()
+		return exitUsage
+	}
+	if len(pgpKeyrings) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: -pgp-keyring is required\n\n")
+		fs.Usage()
+		return exitUsage
+	}
+	type index struct{ name, path string }
+	var parsed []index
+	for _, value := range indexes {
+		name, path, ok := strings.Cut(value, "=")
+		if !ok || name == "" || path == "" {
+			fmt.Fprintf(os.Stderr, "Error: -index %q is not <name>=<path>\n\n", value)
+			return exitUsage
+		}
+		parsed = append(parsed, index{name, path})
+	}
+	if fs.NArg() > 1 && len(parsed) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: checking packages requires an -index\n\n")
+		return exitUsage
+	}
+	keyring, err := loadPGPKeyring(pgpKeyrings)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitCodeFor(err)
+	}
+	opts := &sigtool.VerifyOptions{PGPKeyring: keyring}
+	if *atTime != "" {
+		if opts.VerificationTime, err = parseTime(*atTime); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid -at-time value: %v\n\n", err)
+			return exitUsage
+		}
+	}
+
+	result := repoResult{Path: fs.Arg(0)}
+	release, err := sigtool.VerifyDebianRelease(fs.Arg(0), *detached, opts)
+	if err != nil {
+		result.Error = err.Error()
+		if *jsonReport {
+			return printJSON(result, exitCodeFor(err))
+		}
+		fmt.Fprintf(os.Stderr, "Release %s is not valid: %v\n", fs.Arg(0), err)
+		return exitCodeFor(err)
+	}
+	result.Valid = true
+	result.Origin, result.Suite, result.Codename = release.Origin, release.Suite, release.Codename
+	if !release.Date.IsZero() {
+		result.Date = &release.Date
+	}
+	if !release.ValidUntil.IsZero() {
+		result.ValidUntil = &release.ValidUntil
+	}
+	result.Signature = &newPGPSignaturesJSON([]sigtool.PGPSignatureInfo{release.Signature})[0]
+
+	code := exitValid
+	for _, idx := range parsed {
+		err := release.CheckFile(idx.name, idx.path)
+		code = worstExit(code, exitCodeFor(err))
+		result.Indexes = append(result.Indexes, repoFileResult{Path: idx.path, Valid: err == nil, Error: errorString(err)})
+	}
+	for _, pkg := range fs.Args()[1:] {
+		err := release.VerifyPackage(parsed[0].name, parsed[0].path, pkg)
+		code = worstExit(code, exitCodeFor(err))
+		result.Packages = append(result.Packages, repoFileResult{Path: pkg, Valid: err == nil, Error: errorString(err)})
+	}
+
+	if *jsonReport {
+		return printJSON(result, code)
+	}
+	printf("Release %s is valid: %s %s (%s)\n", result.Path, release.Origin, release.Codename, release.Suite)
+	printPGPSignatures([]sigtool.PGPSignatureInfo{release.Signature})
+	if !release.ValidUntil.IsZero() {
+		printf("Valid until %s\n", release.ValidUntil.UTC().Format(time.RFC3339))
+	}
+	for _, group := range [][]repoFileResult{result.Indexes, result.Packages} {
+		for _, r := range group {
+			if r.Valid {
+				printf("%s: listed in the release\n", r.Path)
+			} else {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", r.Path, r.Error)
+			}
+		}
+	}
+	return code
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/konidev20/sigtool"
+)
+
+// Report formats of the commands that verify files
+const (
+	reportText  = "text"
+	reportJSON  = "json"
+	reportCSV   = "csv"
+	reportSARIF = "sarif"
+	// reportTemplate formats each file with -template
+	reportTemplate = "template"
+)
+
+// reportFormat returns the report format selected by -output, which -json
+// abbreviates, or reportTemplate when tmpl is set
+func reportFormat(output string, jsonReport bool, tmpl string) (string, error) {
+	switch output {
+	case reportText, reportJSON, reportCSV, reportSARIF:
+	default:
+		return "", fmt.Errorf("unsupported -output %q (expected text, json, csv or sarif)", output)
+	}
+	if tmpl != "" {
+		if jsonReport || output != reportText {
+			return "", errors.New("-template cannot be combined with -json or -output")
+		}
+		return reportTemplate, nil
+	}
+	if jsonReport {
+		if output != reportText && output != reportJSON {
+			return "", fmt.Errorf("-json cannot be combined with -output %s", output)
+		}
+		return reportJSON, nil
+	}
+	return output, nil
+}
+
+// printCSV writes header and rows to stdout as CSV and returns code, or
+// exitIOError when they cannot be written
+func printCSV(header []string, rows [][]string, code int) int {
+	w := csv.NewWriter(os.Stdout)
+	_ = w.Write(header)
+	_ = w.WriteAll(rows)
+	if err := w.Error(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing CSV report: %v\n", err)
+		return exitIOError
+	}
+	return code
+}
+
+// SARIF rules of failures that VerifyDetailed does not classify
+const (
+	ruleUnsigned   = "unsigned-file"
+	ruleInvalid    = "invalid-signature"
+	rulePolicy     = "policy-violation"
+	ruleUnreadable = "unreadable-file"
+)
+
+// ruleDescriptions describes the SARIF rules other than reason codes
+var ruleDescriptions = map[string]string{
+	ruleUnsigned:   "The file has no Authenticode signature",
+	ruleInvalid:    "The Authenticode signature is invalid",
+	rulePolicy:     "The signature is valid but violates the verification policy",
+	ruleUnreadable: "The file cannot be read",
+}
+
+// ruleFor returns the SARIF rule of the verification error err
+func ruleFor(err error) string {
+	switch exitCodeFor(err) {
+	case exitUnsigned:
+		return ruleUnsigned
+	case exitPolicy:
+		return rulePolicy
+	case exitIOError:
+		return ruleUnreadable
+	default:
+		return ruleInvalid
+	}
+}
+
+// finding is one SARIF result: a file failing a rule
+type finding struct {
+	path string
+	rule string
+	// description describes rule when it is not one of ruleDescriptions
+	description string
+	// level is the SARIF level, error or warning
+	level   string
+	message string
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// printSARIF writes findings to stdout as a SARIF 2.1.0 log and returns
+// code, or exitIOError when it cannot be written. Valid files produce no
+// result; the rules are those the findings use.
+func printSARIF(findings []finding, code int) int {
+	descriptions := make(map[string]string)
+	results := make([]sarifResult, 0, len(findings))
+	for _, f := range findings {
+		description := ruleDescriptions[f.rule]
+		if description == "" {
+			description = f.description
+		}
+		descriptions[f.rule] = description
+		results = append(results, sarifResult{
+			RuleID:  f.rule,
+			Level:   f.level,
+			Message: sarifMessage{Text: f.message},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: artifactURI(f.path)}},
+			}},
+		})
+	}
+
+	rules := make([]sarifRule, 0, len(descriptions))
+	for id, description := range descriptions {
+		rules = append(rules, sarifRule{ID: id, ShortDescription: sarifMessage{Text: description}})
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+
+	return printJSON(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "gosigtool",
+				InformationURI: "https://github.com/konidev20/sigtool",
+				Rules:          rules,
+			}},
+			Results: results,
+		}},
+	}, code)
+}
+
+// artifactURI returns the SARIF URI of path: relative paths stay relative,
+// so that code-scanning dashboards resolve them against the repository, and
+// absolute paths become file URIs
+func artifactURI(path string) string {
+	slashed := filepath.ToSlash(path)
+	if !filepath.IsAbs(path) {
+		return (&url.URL{Path: slashed}).String()
+	}
+	if slashed[0] != '/' {
+		// A Windows drive letter path
+		slashed = "/" + slashed
+	}
+	return (&url.URL{Scheme: "file", Path: slashed}).String()
+}
+
+// signerColumns returns the subject and SHA-256 thumbprint columns of a CSV
+// row for signer
+func signerColumns(signer *certificateJSON) []string {
+	if signer == nil {
+		return []string{"", ""}
+	}
+	return []string{signer.Subject, signer.SHA256Thumbprint}
+}
+
+// hashColumns returns the digest columns of a CSV row for hashes, which may
+// be nil when the file could not be hashed
+func hashColumns(h *hashesJSON) []string {
+	if h == nil {
+		return []string{"", "", "", "", "", "", ""}
+	}
+	return []string{h.MD5, h.SHA1, h.SHA256, h.AuthentihashSHA1, h.AuthentihashSHA256, h.Imphash, h.RichHeaderHash}
+}
+
+// failedChecks returns the failed checks of checks
+func failedChecks(checks []sigtool.CheckResult) []sigtool.CheckResult {
+	var failed []sigtool.CheckResult
+	for _, c := range checks {
+		if c.Status == sigtool.StatusFailed {
+			failed = append(failed, c)
+		}
+	}
+	return failed
+}
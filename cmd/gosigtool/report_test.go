@@ -0,0 +1,275 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/big"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/konidev20/sigtool"
+)
+
+func TestReportFormat(t *testing.T) {
+	tests := []struct {
+		name       string
+		output     string
+		jsonReport bool
+		tmpl       string
+		want       string
+		err        string
+	}{
+		{"default", reportText, false, "", reportText, ""},
+		{"csv", reportCSV, false, "", reportCSV, ""},
+		{"sarif", reportSARIF, false, "", reportSARIF, ""},
+		{"json flag", reportText, true, "", reportJSON, ""},
+		{"json flag and output", reportJSON, true, "", reportJSON, ""},
+		{"template", reportText, false, "{{.Path}}", reportTemplate, ""},
+		{"unsupported output", "xml", false, "", "", `unsupported -output "xml" (expected text, json, csv or sarif)`},
+		{"json flag and csv", reportCSV, true, "", "", "-json cannot be combined with -output csv"},
+		{"template and json flag", reportText, true, "{{.Path}}", "", "-template cannot be combined with -json or -output"},
+		{"template and output", reportSARIF, false, "{{.Path}}", "", "-template cannot be combined with -json or -output"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := reportFormat(tt.output, tt.jsonReport, tt.tmpl)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("Expected %q, got %q, %v", tt.err, got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Expected %q, got %q, %v", tt.want, got, err)
+			}
+		})
+	}
+}
+
+func TestRuleFor(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		exit int
+		rule string
+	}{
+		{"unreadable", &fs.PathError{Op: "open", Path: "a.exe", Err: fs.ErrNotExist}, exitIOError, ruleUnreadable},
+		{"unsigned", fmt.Errorf("extract: %w", sigtool.ErrNotSigned), exitUnsigned, ruleUnsigned},
+		{"signer not pinned", sigtool.ErrSignerNotPinned, exitPolicy, rulePolicy},
+		{"denied certificate", sigtool.ErrDeniedCertificate, exitPolicy, rulePolicy},
+		{"weak crypto", fmt.Errorf("signer: %w", sigtool.ErrWeakCrypto), exitPolicy, rulePolicy},
+		{"untrusted publisher", sigtool.ErrUntrustedPublisher, exitPolicy, rulePolicy},
+		{"invalid signature", sigtool.ErrInvalidSignature, exitInvalid, ruleInvalid},
+		{"digest mismatch", sigtool.ErrDigestMismatch, exitInvalid, ruleInvalid},
+		{"panic", &sigtool.PanicError{Value: "malformed"}, exitInvalid, ruleInvalid},
+		{"other", errors.New("not a PE file"), exitInvalid, ruleInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if exit := exitCodeFor(tt.err); exit != tt.exit {
+				t.Errorf("Expected exit code %d, got %d", tt.exit, exit)
+			}
+			if rule := ruleFor(tt.err); rule != tt.rule {
+				t.Errorf("Expected rule %s, got %s", tt.rule, rule)
+			}
+		})
+	}
+	if exit := exitCodeFor(nil); exit != exitValid {
+		t.Errorf("Expected exit code %d for no error, got %d", exitValid, exit)
+	}
+}
+
+func TestArtifactURI(t *testing.T) {
+	tests := []struct {
+		name string
+		// goos restricts the case to Windows or to the other systems, unix,
+		// when set
+		goos string
+		path string
+		want string
+	}{
+		{"relative", "", filepath.Join("bin", "setup.exe"), "bin/setup.exe"},
+		{"relative with spaces", "", filepath.Join("my files", "a b.exe"), "my%20files/a%20b.exe"},
+		{"relative with colon", "", "a:b.exe", "./a:b.exe"},
+		{"absolute", "unix", "/opt/app/setup.exe", "file:///opt/app/setup.exe"},
+		{"absolute with spaces", "unix", "/opt/my app/a#1.exe", "file:///opt/my%20app/a%231.exe"},
+		{"windows drive", "windows", `C:\Program Files\app\setup.exe`, "file:///C:/Program%20Files/app/setup.exe"},
+		{"windows relative", "windows", `bin\setup.exe`, "bin/setup.exe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.goos != "" && (tt.goos == "windows") != (runtime.GOOS == "windows") {
+				t.Skipf("%s paths only", tt.goos)
+			}
+			if got := artifactURI(tt.path); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+// peForTest returns a minimal unsigned PE32 image carrying payload
+func peForTest(payload []byte) []byte {
+	const optHeaderOffset = 88
+	image := make([]byte, optHeaderOffset+224+len(payload))
+	copy(image, "MZ")
+	binary.LittleEndian.PutUint32(image[60:], 64)
+	copy(image[64:], "PE\x00\x00")
+	binary.LittleEndian.PutUint16(image[68:], 0x014c)
+	binary.LittleEndian.PutUint16(image[84:], 224)
+	binary.LittleEndian.PutUint16(image[optHeaderOffset:], 0x010b)
+	binary.LittleEndian.PutUint32(image[optHeaderOffset+92:], 16)
+	copy(image[optHeaderOffset+224:], payload)
+	return image
+}
+
+// writeFixturesForTest writes signed.exe, signed with a self-signed
+// certificate, and unsigned.exe to dir and returns the certificate's
+// SHA-256 thumbprint
+func writeFixturesForTest(t *testing.T, dir string) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Report Signer", Organization: []string{"sigtool"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+
+	signed := filepath.Join(dir, "signed.exe")
+	for name, payload := range map[string]string{signed: "signed payload", filepath.Join(dir, "unsigned.exe"): "unsigned payload"} {
+		if err := os.WriteFile(name, peForTest([]byte(payload)), 0o600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	if err := sigtool.SignPE(signed, cert, key, nil); err != nil {
+		t.Fatalf("Failed to sign %s: %v", signed, err)
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// captureStdout returns what fn prints on stdout and its exit code
+func captureStdout(t *testing.T, fn func() int) (string, int) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- string(data)
+	}()
+	code := fn()
+	w.Close()
+	return <-out, code
+}
+
+func TestRunVerify_Reports(t *testing.T) {
+	dir := t.TempDir()
+	thumbprint := writeFixturesForTest(t, dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get the working directory: %v", err)
+	}
+	// Relative paths keep the reports independent of the temporary directory
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{reportCSV, `path,valid,error,failed_checks,signer_subject,signer_sha256
+signed.exe,true,,,"CN=Report Signer,O=sigtool",THUMBPRINT
+unsigned.exe,false,failed to extract signature: PE file is not digitally signed,,,
+`},
+		{reportSARIF, `{
+  "$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+  "version": "2.1.0",
+  "runs": [
+    {
+      "tool": {
+        "driver": {
+          "name": "gosigtool",
+          "informationUri": "https://github.com/konidev20/sigtool",
+          "rules": [
+            {
+              "id": "unsigned-file",
+              "shortDescription": {
+                "text": "The file has no Authenticode signature"
+              }
+            }
+          ]
+        }
+      },
+      "results": [
+        {
+          "ruleId": "unsigned-file",
+          "level": "error",
+          "message": {
+            "text": "failed to extract signature: PE file is not digitally signed"
+          },
+          "locations": [
+            {
+              "physicalLocation": {
+                "artifactLocation": {
+                  "uri": "unsigned.exe"
+                }
+              }
+            }
+          ]
+        }
+      ]
+    }
+  ]
+}
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.output, func(t *testing.T) {
+			got, code := captureStdout(t, func() int {
+				return runVerify([]string{"-output", tt.output, "signed.exe", "unsigned.exe"})
+			})
+			if code != exitUnsigned {
+				t.Errorf("Expected exit code %d, got %d", exitUnsigned, code)
+			}
+			if want := strings.ReplaceAll(tt.want, "THUMBPRINT", thumbprint); got != want {
+				t.Errorf("Expected the report\n%s\ngot\n%s", want, got)
+			}
+		})
+	}
+}
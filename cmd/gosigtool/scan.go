@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/konidev20/sigtool"
+)
+
+// runScan implements the scan subcommand, which reports whether each of a
+// set of PE files, or with -r of the PE files of directory trees, is
+// unsigned, validly signed or has an invalid signature.
+// It returns 0 when no file has an invalid signature and 1 otherwise;
+// unsigned files fail the scan only with -require-signed.
+func runScan(args []string) int {
+	fs := flag.NewFlagSet("scan", flag.ContinueOnError)
+	registerVerbosity(fs)
+	requireSigned := fs.Bool("require-signed", false, "This specifies if unsigned files fail the scan")
+	jsonReport := fs.Bool("json", false, "This specifies if the results are printed as JSON (-output json)")
+	output := fs.String("output", reportText, "This specifies the report format: text, json, csv for spreadsheets or sarif for code-scanning dashboards")
+	workers := fs.Int("workers", runtime.GOMAXPROCS(0), "This specifies the number of files verified concurrently")
+	tmplParam := fs.String("template", "", "This specifies a Go template printed for each file, such as '{{.Path}} {{.Status}} {{.Signer.CommonName}}'")
+	withHashes := fs.Bool("hashes", false, "This specifies if the MD5, SHA-1 and SHA-256 digests, the SHA-1 and SHA-256 authentihashes, the imphash and the rich header hash of each file are reported")
+	noProgress := fs.Bool("no-progress", false, "This specifies if the progress of recursive scans (files scanned, current path and estimated time remaining) is not reported on stderr")
+	var walk walkFlags
+	walk.register(fs)
+	var trust trustFlags
+	trust.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: gosigtool scan [trust flags] [-require-signed] [-hashes] [-output text|json|csv|sarif | -template <template>] [-r [-include <glob>] [-exclude <glob>] [-follow-symlinks] [-no-progress]] <pe_file|dir>...\n\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return usageExit(err)
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "Error: at least one file or directory is required\n\n")
+		fs.Usage()
+		return exitUsage
+	}
+	format, err := reportFormat(*output, *jsonReport, *tmplParam)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+	tmpl, err := parseTemplate(*tmplParam)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+	if err := walk.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+	paths, err := walk.collect(fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return optionsExit(err)
+	}
+
+	opts, err := trust.verifyOptions()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return optionsExit(err)
+	}
+
+	if opts == nil {
+		opts = &sigtool.VerifyOptions{}
+	}
+	opts = withLogger(opts)
+	opts.Workers = *workers
+
+	// Interrupting a long scan reports the files already verified
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	code := exitValid
+	results := make([]scanResult, len(paths))
+	errs := make([]error, len(paths))
+	// Verbose logs already report each file
+	var report *progress
+	if walk.recursive && !*noProgress && verbosity == verbosityNormal {
+		report = newProgress(len(paths))
+	}
+	logInfo("scanning files", "count", len(paths), "workers", opts.Workers)
+	for batch := range sigtool.VerifyAll(ctx, paths, *opts) {
+		logInfo("verified signature", "path", batch.Path, "error", batch.Err)
+		if report != nil {
+			report.update(batch.Path)
+		}
+		result := newScanResult(batch.Path, batch.Err, format != reportText)
+		if *withHashes {
+			var hashes *sigtool.FileHashes
+			err := recovered(func() (err error) { hashes, err = sigtool.ComputeFileHashes(batch.Path); return err })
+			if err != nil {
+				warnf("%s: unable to hash the file: %v\n", batch.Path, err)
+			}
+			result.Hashes = newHashesJSON(hashes)
+		}
+		if exit := exitCodeFor(batch.Err); exit != exitUnsigned || *requireSigned {
+			code = worstExit(code, exit)
+		}
+		results[batch.Index] = result
+		errs[batch.Index] = batch.Err
+	}
+	if report != nil {
+		report.finish()
+	}
+
+	switch format {
+	case reportJSON:
+		return printJSON(results, code)
+	case reportTemplate:
+		data := make([]templateData, 0, len(results))
+		for _, result := range results {
+			d := newTemplateData(result.Path, result.Status, result.Error, result.signature)
+			d.Hashes = result.Hashes
+			data = append(data, d)
+		}
+		return printTemplate(tmpl, data, code)
+	case reportCSV:
+		header := []string{"path", "status", "error", "signer_subject", "signer_sha256"}
+		if *withHashes {
+			header = append(header, "md5", "sha1", "sha256", "authentihash_sha1", "authentihash_sha256", "imphash", "rich_header_hash")
+		}
+		rows := make([][]string, 0, len(results))
+		for _, result := range results {
+			row := append([]string{result.Path, result.Status, result.Error}, signerColumns(result.Signer)...)
+			if *withHashes {
+				row = append(row, hashColumns(result.Hashes)...)
+			}
+			rows = append(rows, row)
+		}
+		return printCSV(header, rows, code)
+	case reportSARIF:
+		var findings []finding
+		for i, result := range results {
+			if result.Status == statusValid {
+				continue
+			}
+			level := "error"
+			if result.Status == statusUnsigned && !*requireSigned {
+				level = "warning"
+			}
+			message := result.Error
+			if message == "" {
+				message = "file is not signed"
+			}
+			findings = append(findings, finding{path: result.Path, rule: ruleFor(errs[i]), level: level, message: message})
+		}
+		return printSARIF(findings, code)
+	}
+	for _, result := range results {
+		if result.Error != "" {
+			printf("%s: %s: %s\n", result.Path, result.Status, result.Error)
+		} else {
+			printf("%s: %s\n", result.Path, result.Status)
+		}
+		if result.Hashes != nil {
+			printHashes("  ", result.Hashes)
+		}
+	}
+	return code
+}
+
+// Signature statuses reported by scan
+const (
+	statusValid    = "valid"
+	statusUnsigned = "unsigned"
+	statusInvalid  = "invalid"
+)
+
+// scanResult is the signature status of one scanned file
+type scanResult struct {
+	Path   string           `json:"path"`
+	Status string           `json:"status"`
+	Error  string           `json:"error,omitempty"`
+	Signer *certificateJSON `json:"signer,omitempty"`
+	Hashes *hashesJSON      `json:"hashes,omitempty"`
+	// signature is the signature of a signed file, for -template
+	signature *signatureJSON
+}
+
+// statusFor returns the signature status of a file with the verification
+// error err
+func statusFor(err error) string {
+	switch {
+	case err == nil:
+		return statusValid
+	case errors.Is(err, sigtool.ErrNotSigned):
+		return statusUnsigned
+	default:
+		return statusInvalid
+	}
+}
+
+// newScanResult classifies the verification error err of path. The signer
+// is looked up for signed files when withSigner is set.
+func newScanResult(path string, err error, withSigner bool) scanResult {
+	result := scanResult{Path: path, Status: statusFor(err), Error: errorString(err)}
+	if result.Status == statusUnsigned {
+		result.Error = ""
+		return result
+	}
+	if withSigner {
+		var info *sigtool.SignatureInfo
+		if err := recovered(func() (err error) { info, err = sigtool.Inspect(path); return err }); err == nil {
+			result.signature = newSignatureJSON(info)
+			result.Signer = result.signature.Signer
+		}
+	}
+	return result
+}
+
+// recovered runs fn, returning a *sigtool.PanicError if it panics, so that
+// one malformed file does not stop scan or watch
+func recovered(fn func() error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &sigtool.PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+	return fn()
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/konidev20/sigtool"
+)
+
+func TestRecovered(t *testing.T) {
+	err := recovered(func() error { panic("malformed") })
+	var panicked *sigtool.PanicError
+	if !errors.As(err, &panicked) || panicked.Value != "malformed" {
+		t.Fatalf("Expected a PanicError, got %v", err)
+	}
+	if statusFor(err) != statusInvalid || exitCodeFor(err) != exitInvalid {
+		t.Errorf("Expected a panic to be reported as an invalid signature, got %s and exit code %d", statusFor(err), exitCodeFor(err))
+	}
+
+	want := errors.New("not signed")
+	if err := recovered(func() error { return want }); err != want {
+		t.Errorf("Expected the error of fn, got %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/konidev20/sigtool"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// signHashes maps the -hash flag values to digest algorithms
+var signHashes = map[string]crypto.Hash{
+	"sha256": crypto.SHA256,
+	"sha384": crypto.SHA384,
+	"sha512": crypto.SHA512,
+}
+
+// runSign implements the sign subcommand, which Authenticode-signs a PE
+// file in place or into a copy with a certificate and private key from PEM
+// files or a PKCS#12 file. It returns the exit code.
+func runSign(args []string) int {
+	fs := flag.NewFlagSet("sign", flag.ContinueOnError)
+	registerVerbosity(fs)
+	inParam := fs.String("in", "", "This specifies the input PE filename to sign, or - for standard input")
+	outParam := fs.String("out", "", "This specifies the output signed PE filename, or - for standard output; the input is modified in place when empty")
+	certParam := fs.String("cert", "", "This specifies a PEM or DER file holding the signer certificate followed by its intermediates")
+	keyParam := fs.String("key", "", "This specifies a PEM file holding the PKCS#8, PKCS#1 or SEC 1 private key of the signer certificate")
+	pfxParam := fs.String("pfx", "", "This specifies a PKCS#12 file holding the signer certificate, its private key and intermediates, instead of -cert and -key")
+	password := fs.String("password", "", "This specifies the PKCS#12 password; defaults to the SIGTOOL_PKCS12_PASSWORD environment variable")
+	hashParam := fs.String("hash", "sha256", "This specifies the digest algorithm: sha256, sha384 or sha512")
+	programName := fs.String("program-name", "", "This specifies the program description recorded in the signature")
+	moreInfoURL := fs.String("more-info-url", "", "This specifies the publisher URL recorded in the signature")
+	jsonReport := fs.Bool("json", false, "This specifies if the result is printed as JSON")
+	var urls stringList
+	fs.Var(&urls, "tsa", "This specifies the URL of an RFC 3161 timestamp authority; may be repeated, later URLs are fallbacks")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: gosigtool sign -in <pe_file> (-cert <cert_file> -key <key_file> | -pfx <pfx_file>) [-tsa <url>...] [-out <signed_pe_file>]\n\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return usageExit(err)
+	}
+	if *inParam == "" || (*pfxParam == "") == (*certParam == "" || *keyParam == "") {
+		fmt.Fprintf(os.Stderr, "Error: input file (-in) and either -cert and -key or -pfx are required\n\n")
+		fs.Usage()
+		return exitUsage
+	}
+	h, ok := signHashes[strings.ToLower(*hashParam)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: unsupported -hash %q (expected sha256, sha384 or sha512)\n", *hashParam)
+		return exitUsage
+	}
+	if err := checkStdio(*inParam, *outParam, *jsonReport); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+	result := fileResult{Input: *inParam}
+
+	var certs []*x509.Certificate
+	var key crypto.Signer
+	var err error
+	if *pfxParam != "" {
+		if *password == "" {
+			*password = os.Getenv("SIGTOOL_PKCS12_PASSWORD")
+		}
+		certs, key, err = loadPKCS12Signer(*pfxParam, *password)
+	} else {
+		certs, key, err = loadPEMSigner(*certParam, *keyParam)
+	}
+	if err != nil {
+		return reportFiles(*jsonReport, result, err, "")
+	}
+
+	opts := &sigtool.SignOptions{
+		Hash:          h,
+		Intermediates: certs[1:],
+		ProgramName:   *programName,
+		MoreInfoURL:   *moreInfoURL,
+	}
+	if len(urls) > 0 {
+		opts.Timestamp = &sigtool.TimestampOptions{URLs: urls}
+	}
+
+	result.Output, err = modifyFile(*inParam, *outParam, func(target string) error {
+		if err := sigtool.SignPE(target, certs[0], key, opts); err != nil {
+			return fmt.Errorf("signing file: %w", err)
+		}
+		return nil
+	})
+	return reportFiles(*jsonReport, result, err, "Wrote signed file to %q")
+}
+
+// loadPEMSigner loads the signer certificate and intermediates of certPath
+// and the private key of keyPath
+func loadPEMSigner(certPath, keyPath string) ([]*x509.Certificate, crypto.Signer, error) {
+	certs, err := sigtool.LoadCertificates(certPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load certificates: %w", err)
+	}
+	if len(certs) == 0 {
+		return nil, nil, fmt.Errorf("no certificates found in %q", certPath)
+	}
+
+	// #nosec G304
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, fmt.Errorf("no PEM private key found in %q", keyPath)
+	}
+	var parsed any
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	key, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported private key type %T", parsed)
+	}
+	return certs, key, nil
+}
+
+// loadPKCS12Signer loads the signer certificate, private key and
+// intermediates of a password-protected PKCS#12 file
+func loadPKCS12Signer(path, password string) ([]*x509.Certificate, crypto.Signer, error) {
+	// #nosec G304
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read PKCS#12 file: %w", err)
+	}
+	parsed, cert, intermediates, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode PKCS#12 file: %w", err)
+	}
+	key, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, nil, errors.New("PKCS#12 private key cannot sign")
+	}
+	return append([]*x509.Certificate{cert}, intermediates...), key, nil
+}
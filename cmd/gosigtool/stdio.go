@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// stdio is the -in and -out value naming standard input or output
+const stdio = "-"
+
+// checkStdio reports an invalid use of standard input or output: a file
+// read from stdin cannot be modified in place, and JSON output cannot share
+// stdout with the written file
+func checkStdio(in, out string, jsonReport bool) error {
+	if in == stdio && out == "" {
+		return errors.New("reading from standard input (-in -) requires -out")
+	}
+	if out == stdio && jsonReport {
+		return errors.New("-out - cannot be combined with -json")
+	}
+	return nil
+}
+
+// inputPath returns the path of the file in names: in itself, or a
+// temporary copy of standard input when in is "-". The library reads PE
+// files at random offsets, so stdin is spooled to disk rather than
+// buffered in memory. The returned function removes the copy.
+func inputPath(in string) (string, func(), error) {
+	if in != stdio {
+		return in, func() {}, nil
+	}
+	f, err := os.CreateTemp("", "gosigtool-stdin-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("spooling standard input: %w", err)
+	}
+	cleanup := func() { _ = os.Remove(f.Name()) }
+	if _, err := io.Copy(f, os.Stdin); err != nil {
+		f.Close()
+		cleanup()
+		return "", nil, fmt.Errorf("spooling standard input: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("spooling standard input: %w", err)
+	}
+	return f.Name(), cleanup, nil
+}
+
+// writeOutput writes data to the file out, or to standard output when out
+// is "-"
+func writeOutput(out string, data []byte) error {
+	if out == stdio {
+		if _, err := os.Stdout.Write(data); err != nil {
+			return fmt.Errorf("writing standard output: %w", err)
+		}
+		return nil
+	}
+	if err := os.WriteFile(out, data, 0600); err != nil {
+		return fmt.Errorf("writing output file %q: %w", out, err)
+	}
+	return nil
+}
+
+// modifyFile runs modify on the file a subcommand changes: in itself when
+// out is empty, otherwise a copy of in written to out or, when out is "-",
+// streamed to standard output. Either may be "-". The copy is removed when
+// modify fails. It returns the path of the result.
+func modifyFile(in, out string, modify func(path string) error) (string, error) {
+	src, cleanup, err := inputPath(in)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	target := src
+	switch {
+	case out == "":
+	case out == stdio && in == stdio:
+		// The spooled copy of stdin is modified directly
+	case out == stdio:
+		if target, err = copyToTemp(src); err != nil {
+			return "", err
+		}
+		defer os.Remove(target)
+	default:
+		if err := copyFile(src, out); err != nil {
+			return "", err
+		}
+		target = out
+	}
+
+	if err := modify(target); err != nil {
+		if out != "" && out != stdio {
+			_ = os.Remove(out)
+		}
+		return "", err
+	}
+	if out == stdio {
+		// #nosec G304
+		data, err := os.ReadFile(target)
+		if err != nil {
+			return "", fmt.Errorf("reading output: %w", err)
+		}
+		if err := writeOutput(stdio, data); err != nil {
+			return "", err
+		}
+		return stdio, nil
+	}
+	if out == "" {
+		return in, nil
+	}
+	return out, nil
+}
+
+// copyFile copies the file in to out
+func copyFile(in, out string) error {
+	// #nosec G304
+	data, err := os.ReadFile(in)
+	if err != nil {
+		return fmt.Errorf("reading input file %q: %w", in, err)
+	}
+	if err := os.WriteFile(out, data, 0600); err != nil {
+		return fmt.Errorf("writing output file %q: %w", out, err)
+	}
+	return nil
+}
+
+// copyToTemp copies the file in to a new temporary file and returns its
+// path
+func copyToTemp(in string) (string, error) {
+	f, err := os.CreateTemp("", "gosigtool-out-*")
+	if err != nil {
+		return "", fmt.Errorf("creating temporary file: %w", err)
+	}
+	name := f.Name()
+	f.Close()
+	if err := copyFile(in, name); err != nil {
+		_ = os.Remove(name)
+		return "", err
+	}
+	return name, nil
+}
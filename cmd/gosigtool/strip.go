@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/konidev20/sigtool"
+)
+
+// runStrip implements the strip subcommand, which removes the signature of
+// a PE file in place or into a copy. It returns the exit code.
+func runStrip(args []string) int {
+	fs := flag.NewFlagSet("strip", flag.ContinueOnError)
+	registerVerbosity(fs)
+	inParam := fs.String("in", "", "This specifies the input Signed PE filename to strip, or - for standard input")
+	outParam := fs.String("out", "", "This specifies the output unsigned PE filename, or - for standard output; the input is modified in place when empty")
+	jsonReport := fs.Bool("json", false, "This specifies if the result is printed as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: gosigtool strip -in <signed_pe_file> [-out <unsigned_pe_file>]\n\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return usageExit(err)
+	}
+	if *inParam == "" {
+		fmt.Fprintf(os.Stderr, "Error: input file (-in) is required\n\n")
+		fs.Usage()
+		return exitUsage
+	}
+
+	if err := checkStdio(*inParam, *outParam, *jsonReport); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+
+	output, err := modifyFile(*inParam, *outParam, func(target string) error {
+		if err := sigtool.RemoveDigitalSignature(target); err != nil {
+			return fmt.Errorf("removing signature: %w", err)
+		}
+		return nil
+	})
+	return reportFiles(*jsonReport, fileResult{Input: *inParam, Output: output}, err, "Wrote unsigned file to %q")
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// templateData is the value a -template is executed with for each file:
+// the fields of its signature, as in JSON output, and the outcome of the
+// command. Signer is never nil, so that templates such as
+// {{.Signer.CommonName}} print an empty string for unsigned files.
+type templateData struct {
+	Path string
+	// Status is valid, unsigned or invalid; it is empty for inspect
+	Status string
+	Valid  bool
+	Error  string
+	// Hashes are the digests of the file, for inspect and scan -hashes
+	Hashes *hashesJSON
+	signatureJSON
+}
+
+// newTemplateData returns the template data of the file path
+func newTemplateData(path, status, errMessage string, signature *signatureJSON) templateData {
+	data := templateData{Path: path, Status: status, Valid: status == statusValid, Error: errMessage}
+	if signature != nil {
+		data.signatureJSON = *signature
+	}
+	if data.Signer == nil {
+		data.Signer = &certificateJSON{}
+	}
+	return data
+}
+
+// templateFuncs are the functions available to -template, after those of
+// docker inspect --format
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		buf, err := json.Marshal(v)
+		return string(buf), err
+	},
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// parseTemplate parses the -template text
+func parseTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("template").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing -template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// printTemplate prints tmpl executed with each of data on its own line and
+// returns code, or exitUsage when the template fails for a file and
+// exitIOError when the output cannot be written
+func printTemplate(tmpl *template.Template, data []templateData, code int) int {
+	var buf bytes.Buffer
+	for _, d := range data {
+		buf.Reset()
+		if err := tmpl.Execute(&buf, d); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", d.Path, err)
+			code = worstExit(code, exitUsage)
+			continue
+		}
+		buf.WriteByte('\n')
+		if _, err := os.Stdout.Write(buf.Bytes()); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+			return exitIOError
+		}
+	}
+	return code
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/konidev20/sigtool"
+)
+
+// verifyFlags holds the command-line flags that select verification
+// options, shared by the verify subcommand and the legacy flags
+type verifyFlags struct {
+	trust               trustFlags
+	rejectWeak          bool
+	useDenylist         bool
+	denylistFiles       stringList
+	requiredThumbprints stringList
+	requiredSubjects    stringList
+	requiredTeamID      string
+	moduleCerts         stringList
+	secureBootDB        stringList
+	secureBootDBX       stringList
+	pgpKeyrings         stringList
+	formatOnly          bool
+	allChecks           bool
+}
+
+// register defines the verification flags, trust flags included, on fs
+func (f *verifyFlags) register(fs *flag.FlagSet) {
+	fs.BoolVar(&f.rejectWeak, "reject-weak-crypto", false, "This specifies if validation fails when the signature uses MD5 or SHA-1 digests, SHA-1 certificate signatures, RSA keys under 2048 bits or DSA keys")
+	fs.BoolVar(&f.useDenylist, "denylist", false, "This specifies if validation fails for certificates on the built-in denylist of publicly known stolen code-signing certificates")
+	fs.Var(&f.denylistFiles, "denylist-file", "This specifies a denylist file of serial:, sha1: or sha256: certificate identifiers added to the built-in denylist; may be repeated (implies -denylist)")
+	fs.Var(&f.requiredThumbprints, "require-thumbprint", "This specifies the SHA-1 or SHA-256 thumbprint the signer certificate must have; may be repeated to allow several signers")
+	fs.Var(&f.requiredSubjects, "require-subject", "This specifies the subject distinguished name or common name the signer certificate must have; may be repeated to allow several signers")
+	fs.StringVar(&f.requiredTeamID, "require-team-id", "", "This specifies the Apple Developer Team ID every architecture of a Mach-O binary must be signed with")
+	fs.Var(&f.moduleCerts, "module-cert", "This specifies a PEM or DER file of Linux kernel module signing certificates, such as certs/signing_key.x509, that signed kernel modules must be signed by; may be repeated")
+	fs.Var(&f.secureBootDB, "secure-boot-db", "This specifies an EFI signature list (.esl), authenticated update (.auth) or efivarfs file of the Secure Boot db; EFI images are then verified as UEFI firmware does, against the db and dbx instead of the trust flags; may be repeated")
+	fs.Var(&f.secureBootDBX, "secure-boot-dbx", "This specifies an EFI signature list (.esl), authenticated update (.auth) or efivarfs file of the Secure Boot dbx whose revoked image hashes and signers EFI images must not match; may be repeated")
+	fs.Var(&f.pgpKeyrings, "pgp-keyring", "This specifies an OpenPGP key file or keyring, such as an RPM-GPG-KEY file, whose keys RPM and Debian packages and AppImages must be signed by; may be repeated")
+	fs.BoolVar(&f.formatOnly, "format-only", false, "This specifies if validation checks the signature structure and file digest without validating the certificate chain, for offline forensic use")
+	fs.BoolVar(&f.allChecks, "all-checks", false, "This specifies if validation runs every check and reports each failure with its reason code instead of stopping at the first")
+	f.trust.register(fs)
+}
+
+// verifyOptions returns the verification options selected by the flags, or
+// nil when none is set
+func (f *verifyFlags) verifyOptions() (*sigtool.VerifyOptions, error) {
+	opts, err := f.trust.verifyOptions()
+	if err != nil {
+		return nil, err
+	}
+	if f.formatOnly {
+		if opts != nil {
+			return nil, errors.New("-format-only cannot be combined with trust flags")
+		}
+		opts = &sigtool.VerifyOptions{FormatOnly: true}
+	}
+	ensure := func() {
+		if opts == nil {
+			opts = &sigtool.VerifyOptions{}
+		}
+	}
+	if f.rejectWeak {
+		ensure()
+		opts.RejectWeakCrypto = true
+	}
+	if f.useDenylist || len(f.denylistFiles) > 0 {
+		denylist := sigtool.NewDenylist()
+		for _, path := range f.denylistFiles {
+			if err := denylist.LoadFile(path); err != nil {
+				return nil, err
+			}
+		}
+		ensure()
+		opts.Denylist = denylist
+	}
+	if len(f.requiredThumbprints) > 0 || len(f.requiredSubjects) > 0 {
+		ensure()
+		opts.RequiredThumbprints = f.requiredThumbprints
+		opts.RequiredSubjects = f.requiredSubjects
+	}
+	if f.requiredTeamID != "" {
+		ensure()
+		opts.RequiredTeamID = f.requiredTeamID
+	}
+	for _, path := range f.moduleCerts {
+		certs, err := sigtool.LoadCertificates(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load module signing certificates: %w", err)
+		}
+		ensure()
+		opts.ModuleSigningCertificates = append(opts.ModuleSigningCertificates, certs...)
+	}
+	if len(f.secureBootDB) > 0 || len(f.secureBootDBX) > 0 {
+		if f.allChecks {
+			return nil, errors.New("-secure-boot-db and -secure-boot-dbx cannot be combined with -all-checks")
+		}
+		policy := &sigtool.SecureBootPolicy{}
+		for _, path := range f.secureBootDB {
+			lists, err := sigtool.LoadSignatureLists(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load the Secure Boot db: %w", err)
+			}
+			policy.DB = append(policy.DB, lists...)
+		}
+		for _, path := range f.secureBootDBX {
+			lists, err := sigtool.LoadSignatureLists(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load the Secure Boot dbx: %w", err)
+			}
+			policy.DBX = append(policy.DBX, lists...)
+		}
+		ensure()
+		opts.SecureBoot = policy
+	}
+	if len(f.pgpKeyrings) > 0 {
+		keyring, err := loadPGPKeyring(f.pgpKeyrings)
+		if err != nil {
+			return nil, err
+		}
+		ensure()
+		opts.PGPKeyring = keyring
+	}
+	return opts, nil
+}
+
+// verifyResult is the outcome of verifying one file
+type verifyResult struct {
+	Path      string                `json:"path"`
+	Valid     bool                  `json:"valid"`
+	Error     string                `json:"error,omitempty"`
+	Checks    []sigtool.CheckResult `json:"checks,omitempty"`
+	Signature *signatureJSON        `json:"signature,omitempty"`
+	Payloads  []payloadJSON         `json:"payloads,omitempty"`
+	// Architectures holds the outcome of each slice of a universal Mach-O
+	// binary
+	Architectures []architectureJSON `json:"architectures,omitempty"`
+	// err is the verification error
+	err error
+}
+
+// verifyPath verifies the signature of path with opts, running every check
+// when allChecks is set
+func verifyPath(path string, opts *sigtool.VerifyOptions, allChecks bool) verifyResult {
+	result := verifyResult{Path: path}
+	if allChecks {
+		detailed := sigtool.VerifyDetailed(path, opts)
+		result.Valid = detailed.Valid()
+		result.Checks = detailed.Checks
+		result.err = detailed.Err()
+		result.Error = errorString(result.err)
+		return result
+	}
+
+	var err error
+	if opts != nil {
+		err = sigtool.Verify(path, opts)
+	} else {
+		err = sigtool.IsValidDigitalSignature(path)
+	}
+	result.Valid = err == nil
+	result.err = err
+	result.Error = errorString(err)
+	return result
+}
+
+// verifyInput verifies the file path, or standard input when it is "-",
+// like verifyPath, adding the signature details when withSignature is set
+// and the files it carries when withPayloads is set
+func verifyInput(path string, opts *sigtool.VerifyOptions, allChecks, withSignature, withPayloads bool) verifyResult {
+	file, cleanup, err := inputPath(path)
+	if err != nil {
+		return verifyResult{Path: path, Error: err.Error(), err: err}
+	}
+	defer cleanup()
+	logInfo("verifying signature", "path", path)
+
+	result := verifyPath(file, opts, allChecks)
+	result.Path = path
+	if withSignature {
+		if info, err := sigtool.Inspect(file); err == nil {
+			result.Signature = newSignatureJSON(info)
+		}
+	}
+	if withPayloads {
+		result.addPayloads(file, opts)
+	}
+	result.addArchitectures(file, opts)
+	return result
+}
+
+// addArchitectures verifies each architecture of file when it is a
+// universal Mach-O binary
+func (r *verifyResult) addArchitectures(file string, opts *sigtool.VerifyOptions) {
+	if fileType, err := sigtool.DetectFileType(file); err != nil || fileType != sigtool.FileTypeMachO {
+		return
+	}
+	var machoOpts sigtool.VerifyOptions
+	if opts != nil {
+		machoOpts = *opts
+	}
+	slices, err := sigtool.VerifyMachO(file, machoOpts)
+	if err != nil || len(slices) < 2 {
+		return
+	}
+	r.Architectures = newArchitecturesJSON(slices)
+}
+
+// printArchitectures prints the outcome of each architecture of r
+func (r verifyResult) printArchitectures() {
+	for _, a := range r.Architectures {
+		if a.Valid {
+			printf("  %s: Signature is valid\n", a.Arch)
+		} else {
+			printf("  %s: %s\n", a.Arch, a.Error)
+		}
+	}
+}
+
+// addPayloads verifies the files carried by file when it is an update
+// package, cabinet or self-extracting executable, failing r with the first
+// payload whose signature is invalid
+func (r *verifyResult) addPayloads(file string, opts *sigtool.VerifyOptions) {
+	fileType, err := sigtool.DetectFileType(file)
+	if err != nil || (fileType != sigtool.FileTypeCAB && fileType != sigtool.FileTypePE) {
+		return
+	}
+	var containerOpts sigtool.VerifyOptions
+	if opts != nil {
+		containerOpts = *opts
+	}
+	report, err := sigtool.VerifyContainer(file, containerOpts)
+	if err != nil {
+		warnf("unable to read the payloads of %q: %v\n", r.Path, err)
+		return
+	}
+	r.Payloads = newPayloadsJSON(report.Payloads)
+	if r.err != nil {
+		return
+	}
+	for _, p := range report.Payloads {
+		if p.Type != sigtool.FileTypeUnknown && !p.Valid() {
+			r.err = fmt.Errorf("payload %s: %w", p.Path, p.Err)
+			r.Valid = false
+			r.Error = errorString(r.err)
+			return
+		}
+	}
+}
+
+// printPayloads prints the outcome of each payload of r
+func (r verifyResult) printPayloads() {
+	for _, p := range r.Payloads {
+		switch {
+		case p.Type == string(sigtool.FileTypeUnknown):
+			printf("  %s: not a signed file type\n", p.Path)
+		case p.Valid:
+			printf("  %s: Signature is valid\n", p.Path)
+		default:
+			printf("  %s: %s\n", p.Path, p.Error)
+		}
+		if p.PayloadsError != "" {
+			printf("  %s: unable to read its payloads: %s\n", p.Path, p.PayloadsError)
+		}
+	}
+}
+
+// printFailure prints why the signature of r is invalid
+func (r verifyResult) printFailure() {
+	if r.Checks == nil {
+		fmt.Fprintf(os.Stderr, "Error validating signature of %q: %s\n", r.Path, r.Error)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Error validating signature of %q:\n", r.Path)
+	for _, c := range r.Checks {
+		if c.Status == sigtool.StatusFailed {
+			fmt.Fprintf(os.Stderr, "  [%s] %s: %s\n", c.Check, c.Reason, c.Message)
+		}
+	}
+}
+
+// verifyFile verifies the signature of path like verifyPath and prints the
+// failures. It returns the exit code of the outcome.
+func verifyFile(path string, opts *sigtool.VerifyOptions, allChecks bool) int {
+	result := verifyPath(path, opts, allChecks)
+	if !result.Valid {
+		result.printFailure()
+	}
+	return exitCodeFor(result.err)
+}
+
+// runVerify implements the verify subcommand, which validates the
+// signatures of PE files. It returns 0 when every signature is valid and 1
+// otherwise.
+func runVerify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	registerVerbosity(fs)
+	inParam := fs.String("in", "", "This specifies the input Signed PE filename to verify, or - for standard input; further files may be given as arguments")
+	strictPE := fs.Bool("strict-pe", false, "This specifies if files with malformed PE headers are rejected instead of parsed leniently")
+	jsonReport := fs.Bool("json", false, "This specifies if the results, with the signer, certificates and timestamp of each signature, are printed as JSON (-output json)")
+	output := fs.String("output", reportText, "This specifies the report format: text, json, csv for spreadsheets or sarif for code-scanning dashboards")
+	tmplParam := fs.String("template", "", "This specifies a Go template printed for each file, such as '{{.Signer.CommonName}} {{.DigestAlgorithm}}'")
+	payloads := fs.Bool("payloads", false, "This specifies if the files carried by Windows update packages (.msu), cabinets and self-extracting executables are verified too, failing validation when a signed payload is invalid")
+	var vf verifyFlags
+	vf.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: gosigtool verify [flags] [-output text|json|csv|sarif | -template <template>] -in <signed_pe_file> | <signed_pe_file>...\n\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return usageExit(err)
+	}
+	paths := fs.Args()
+	if *inParam != "" {
+		paths = append([]string{*inParam}, paths...)
+	}
+	if len(paths) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: input file (-in) is required\n\n")
+		fs.Usage()
+		return exitUsage
+	}
+
+	format, err := reportFormat(*output, *jsonReport, *tmplParam)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+	tmpl, err := parseTemplate(*tmplParam)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+
+	opts, err := vf.verifyOptions()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return optionsExit(err)
+	}
+	if *strictPE {
+		if opts == nil {
+			opts = &sigtool.VerifyOptions{}
+		}
+		opts.StrictPEParsing = true
+	}
+	opts = withLogger(opts)
+
+	code := exitValid
+	results := make([]verifyResult, 0, len(paths))
+	for _, path := range paths {
+		result := verifyInput(path, opts, vf.allChecks, format != reportText, *payloads)
+		code = worstExit(code, exitCodeFor(result.err))
+		results = append(results, result)
+	}
+
+	switch format {
+	case reportJSON:
+		return printJSON(results, code)
+	case reportTemplate:
+		data := make([]templateData, 0, len(results))
+		for _, result := range results {
+			data = append(data, newTemplateData(result.Path, statusFor(result.err), result.Error, result.Signature))
+		}
+		return printTemplate(tmpl, data, code)
+	case reportCSV:
+		return printCSV([]string{"path", "valid", "error", "failed_checks", "signer_subject", "signer_sha256"}, verifyRows(results), code)
+	case reportSARIF:
+		return printSARIF(verifyFindings(results), code)
+	}
+	for _, result := range results {
+		if !result.Valid {
+			result.printFailure()
+		} else {
+			printf("%s: Signature is valid\n", result.Path)
+		}
+		result.printArchitectures()
+		result.printPayloads()
+	}
+	return code
+}
+
+// verifyRows returns the CSV rows of results
+func verifyRows(results []verifyResult) [][]string {
+	rows := make([][]string, 0, len(results))
+	for _, result := range results {
+		var reasons []string
+		for _, c := range failedChecks(result.Checks) {
+			reasons = append(reasons, string(c.Reason))
+		}
+		var signer *certificateJSON
+		if result.Signature != nil {
+			signer = result.Signature.Signer
+		}
+		row := []string{result.Path, strconv.FormatBool(result.Valid), result.Error, strings.Join(reasons, ";")}
+		rows = append(rows, append(row, signerColumns(signer)...))
+	}
+	return rows
+}
+
+// verifyFindings returns the SARIF findings of results: one per failed
+// check with -all-checks, otherwise one per invalid file
+func verifyFindings(results []verifyResult) []finding {
+	var findings []finding
+	for _, result := range results {
+		if result.Valid {
+			continue
+		}
+		if result.Checks == nil {
+			findings = append(findings, finding{path: result.Path, rule: ruleFor(result.err), level: "error", message: result.Error})
+			continue
+		}
+		for _, c := range failedChecks(result.Checks) {
+			findings = append(findings, finding{
+				path:        result.Path,
+				rule:        string(c.Reason),
+				description: fmt.Sprintf("The %s check failed", c.Check),
+				level:       "error",
+				message:     c.Message,
+			})
+		}
+	}
+	return findings
+}
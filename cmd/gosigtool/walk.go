@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/konidev20/sigtool"
+)
+
+// walkFlags holds the command-line flags that select the files of a
+// directory tree
+type walkFlags struct {
+	recursive      bool
+	include        stringList
+	exclude        stringList
+	followSymlinks bool
+}
+
+// register defines the walk flags on fs
+func (f *walkFlags) register(fs *flag.FlagSet) {
+	fs.BoolVar(&f.recursive, "r", false, "This specifies if directory arguments are walked recursively and every file of a type sigtool detects from its headers rather than its extension (PE, MSI, CAB, MSIX, RPM, deb, APK, JAR, AppImage and the others of DetectFileType) found in them is scanned")
+	fs.Var(&f.include, "include", "This specifies a glob pattern files found in directories must match; patterns without a slash match the base name, others the path relative to the directory; may be repeated")
+	fs.Var(&f.exclude, "exclude", "This specifies a glob pattern of files and directories skipped while walking, matched like -include; may be repeated")
+	fs.BoolVar(&f.followSymlinks, "follow-symlinks", false, "This specifies if symbolic links found while walking are followed instead of skipped; directory cycles are visited once")
+}
+
+// validate reports an invalid -include or -exclude pattern
+func (f *walkFlags) validate() error {
+	for _, pattern := range append(append([]string(nil), f.include...), f.exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// collect returns the files to scan for args: each file argument, and with
+// -r the signable files of each directory argument. Unreadable directories and
+// files are reported on stderr and skipped.
+func (f *walkFlags) collect(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		if !f.recursive {
+			return nil, fmt.Errorf("%q is a directory (use -r to scan it)", arg)
+		}
+		w := &walker{flags: f, root: arg, visited: make(map[string]bool)}
+		w.walkDir(arg, "")
+		files = append(files, w.files...)
+	}
+	return files, nil
+}
+
+// walker collects the signable files of one directory tree
+type walker struct {
+	flags *walkFlags
+	root  string
+	// visited holds the resolved paths of the directories walked, so that
+	// followed symbolic links cannot loop
+	visited map[string]bool
+	files   []string
+	// dirs holds the directories listed
+	dirs []string
+}
+
+// walkDir walks dir, whose path relative to the root is rel
+func (w *walker) walkDir(dir, rel string) {
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		if abs, err := filepath.Abs(resolved); err == nil {
+			resolved = abs
+		}
+		if w.visited[resolved] {
+			return
+		}
+		w.visited[resolved] = true
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		warnf("%v\n", err)
+		return
+	}
+	w.dirs = append(w.dirs, dir)
+	for _, entry := range entries {
+		name := filepath.Join(dir, entry.Name())
+		entryRel := path.Join(rel, entry.Name())
+		if matchAny(w.flags.exclude, entryRel) {
+			continue
+		}
+
+		mode := entry.Type()
+		if mode&os.ModeSymlink != 0 {
+			if !w.flags.followSymlinks {
+				continue
+			}
+			info, err := os.Stat(name)
+			if err != nil {
+				warnf("%v\n", err)
+				continue
+			}
+			mode = info.Mode().Type()
+		}
+		switch {
+		case mode.IsDir():
+			if w.flags.recursive {
+				w.walkDir(name, entryRel)
+			}
+		case mode.IsRegular():
+			if len(w.flags.include) > 0 && !matchAny(w.flags.include, entryRel) {
+				continue
+			}
+			fileType, err := sigtool.DetectFileType(name)
+			if err != nil {
+				warnf("%v\n", err)
+				continue
+			}
+			if fileType != sigtool.FileTypeUnknown {
+				w.files = append(w.files, name)
+			}
+		}
+	}
+}
+
+// matchAny reports whether the slash-separated relative path rel matches
+// one of patterns. A pattern without a slash matches the base name.
+func matchAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(rel)
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"time"
+
+	"github.com/konidev20/sigtool"
+)
+
+// Watch events
+const (
+	eventCreated  = "created"
+	eventModified = "modified"
+	eventRemoved  = "removed"
+)
+
+// watchEvent is one JSON line of the watch subcommand
+type watchEvent struct {
+	Time   time.Time        `json:"time"`
+	Event  string           `json:"event"`
+	Path   string           `json:"path"`
+	Status string           `json:"status,omitempty"`
+	Error  string           `json:"error,omitempty"`
+	Signer *certificateJSON `json:"signer,omitempty"`
+}
+
+// watchedFile is the state of a PE file found by the watcher
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+	// pending is the event to report once the file stops changing, or empty
+	pending string
+}
+
+// notifier reports changes to the directories it watches, so that the
+// watcher walks the trees only after a change. It is implemented with
+// inotify on Linux and ReadDirectoryChangesW on Windows.
+type notifier interface {
+	// add watches dir, but not its subdirectories, and reports whether it
+	// was not watched already
+	add(dir string) (bool, error)
+	// events receives a value after one or more changes
+	events() <-chan struct{}
+	close() error
+}
+
+// runWatch implements the watch subcommand, which verifies each PE file
+// that appears or changes in directories once its size and modification
+// time are stable over one interval, so that files still being written are
+// not reported. Every event is printed as a JSON line. It runs until
+// interrupted and returns the exit code.
+//
+// The directories, and each subdirectory found with -r, are watched for
+// file system notifications, and walked again only after a change. When
+// notifications are unavailable, or with -poll for network shares that
+// deliver none, every directory is walked each interval instead.
+func runWatch(args []string) int {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	registerVerbosity(fs)
+	interval := fs.Duration("interval", 2*time.Second, "This specifies how long a file must stay unchanged before it is verified, and how often the directories are walked when they are polled")
+	pollOnly := fs.Bool("poll", false, "This specifies if the directories are walked every interval instead of watched for file system notifications, for network shares that deliver none")
+	initial := fs.Bool("initial", false, "This specifies if the PE files already present when watching starts are verified and reported as created")
+	var walk walkFlags
+	walk.register(fs)
+	var vf verifyFlags
+	vf.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: gosigtool watch [trust flags] [-interval <duration>] [-poll] [-initial] [-r [-include <glob>] [-exclude <glob>] [-follow-symlinks]] <dir>...\n\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return usageExit(err)
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "Error: at least one directory is required\n\n")
+		fs.Usage()
+		return exitUsage
+	}
+	if *interval <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: -interval must be positive\n")
+		return exitUsage
+	}
+	if err := walk.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+	for _, dir := range fs.Args() {
+		info, err := os.Stat(dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitIOError
+		}
+		if !info.IsDir() {
+			fmt.Fprintf(os.Stderr, "Error: %q is not a directory\n", dir)
+			return exitUsage
+		}
+	}
+
+	opts, err := vf.verifyOptions()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return optionsExit(err)
+	}
+	if opts == nil {
+		opts = &sigtool.VerifyOptions{}
+	}
+	opts = withLogger(opts)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var watcher notifier
+	if !*pollOnly {
+		if watcher, err = newNotifier(); err != nil {
+			warnf("%v; polling every %s instead\n", err, *interval)
+		}
+	}
+	defer func() {
+		if watcher != nil {
+			watcher.close()
+		}
+	}()
+
+	enc := json.NewEncoder(os.Stdout)
+	files := make(map[string]*watchedFile)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for first, changed := true, true; ; first = false {
+		var events []watchEvent
+		switch {
+		case changed || watcher == nil:
+			found, dirs := walkTrees(&walk, fs.Args())
+			events = update(ctx, files, found, true, first && !*initial, *opts)
+			changed = false
+			if watcher == nil {
+				break
+			}
+			for _, dir := range dirs {
+				added, err := watcher.add(dir)
+				if err != nil {
+					warnf("%v; polling every %s instead\n", err, *interval)
+					watcher.close()
+					watcher = nil
+					break
+				}
+				// Files created before the watch was added are found by
+				// walking again
+				changed = changed || added
+			}
+		default:
+			// Without a notification nothing changed over the interval, so
+			// the files waiting to settle have
+			events = update(ctx, files, pendingFiles(files), false, false, *opts)
+		}
+		for _, event := range events {
+			if err := enc.Encode(event); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing event: %v\n", err)
+				return exitIOError
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return exitValid
+		case <-ticker.C:
+		}
+		if watcher != nil {
+			select {
+			case <-watcher.events():
+				changed = true
+			default:
+			}
+		}
+	}
+}
+
+// walkTrees returns the PE files of dirs and the directories listed
+func walkTrees(walk *walkFlags, dirs []string) (found, listed []string) {
+	for _, dir := range dirs {
+		w := &walker{flags: walk, root: dir, visited: make(map[string]bool)}
+		w.walkDir(dir, "")
+		found = append(found, w.files...)
+		listed = append(listed, w.dirs...)
+	}
+	return found, listed
+}
+
+// pendingFiles returns the sorted paths of the files with an event to
+// report
+func pendingFiles(files map[string]*watchedFile) []string {
+	var paths []string
+	for path, file := range files {
+		if file.pending != "" {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// update stats the PE files found, updates files and returns the events
+// of this poll: a created or modified event, with the verification
+// outcome, for each file unchanged since the previous poll that had
+// changed before it, and when found lists every file, a removed event for
+// each file gone. With baseline set the files found are recorded without
+// events.
+func update(ctx context.Context, files map[string]*watchedFile, found []string, complete, baseline bool, opts sigtool.VerifyOptions) []watchEvent {
+	var events []watchEvent
+	present := make(map[string]bool, len(found))
+	for _, path := range found {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		present[path] = true
+		file, known := files[path]
+		switch {
+		case !known:
+			file = &watchedFile{size: info.Size(), modTime: info.ModTime()}
+			if !baseline {
+				file.pending = eventCreated
+			}
+			files[path] = file
+		case file.size != info.Size() || !file.modTime.Equal(info.ModTime()):
+			file.size, file.modTime = info.Size(), info.ModTime()
+			if file.pending == "" {
+				file.pending = eventModified
+			}
+		case file.pending != "":
+			if ctx.Err() != nil {
+				return events
+			}
+			err := recovered(func() error { return sigtool.VerifyContext(ctx, path, opts) })
+			result := newScanResult(path, err, true)
+			events = append(events, watchEvent{Time: time.Now().UTC(), Event: file.pending, Path: path, Status: result.Status, Error: result.Error, Signer: result.Signer})
+			file.pending = ""
+		}
+	}
+	for path := range files {
+		if complete && !present[path] {
+			delete(files, path)
+			events = append(events, watchEvent{Time: time.Now().UTC(), Event: eventRemoved, Path: path})
+		}
+	}
+	return events
+}
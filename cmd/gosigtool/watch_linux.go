@@ -0,0 +1,94 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// inotifyMask selects the events that change the signable files of a
+// directory, or remove the directory itself
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE | syscall.IN_ATTRIB |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF | syscall.IN_ONLYDIR
+
+// inotifyNotifier watches directories with inotify
+type inotifyNotifier struct {
+	fd      int
+	file    *os.File
+	changes chan struct{}
+
+	mu sync.Mutex
+	// watches maps the watch descriptor of each directory to its path, and
+	// watched the paths back, so that a directory removed and created again
+	// is watched again
+	watches map[int32]string
+	watched map[string]bool
+}
+
+// newNotifier returns an inotify notifier
+func newNotifier() (notifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize inotify: %w", err)
+	}
+	// The descriptor is non-blocking, so reads go through the runtime
+	// poller and Close interrupts them; File.Fd would make it blocking again
+	n := &inotifyNotifier{
+		fd:      fd,
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		changes: make(chan struct{}, 1),
+		watches: make(map[int32]string),
+		watched: make(map[string]bool),
+	}
+	go n.read()
+	return n, nil
+}
+
+func (n *inotifyNotifier) add(dir string) (bool, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.watched[dir] {
+		return false, nil
+	}
+	wd, err := syscall.InotifyAddWatch(n.fd, dir, inotifyMask)
+	if err != nil {
+		return false, fmt.Errorf("failed to watch %s: %w", dir, err)
+	}
+	n.watches[int32(wd)] = dir
+	n.watched[dir] = true
+	return true, nil
+}
+
+func (n *inotifyNotifier) events() <-chan struct{} { return n.changes }
+
+func (n *inotifyNotifier) close() error { return n.file.Close() }
+
+// read signals a change for each batch of events read until the notifier
+// is closed, and forgets the directories whose watch was removed
+func (n *inotifyNotifier) read() {
+	buf := make([]byte, 64*1024)
+	for {
+		size, err := n.file.Read(buf)
+		if err != nil {
+			return
+		}
+		n.mu.Lock()
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= size; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			if event.Mask&syscall.IN_IGNORED != 0 {
+				delete(n.watched, n.watches[event.Wd])
+				delete(n.watches, event.Wd)
+			}
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+		}
+		n.mu.Unlock()
+		select {
+		case n.changes <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !windows
+
+package main
+
+import "errors"
+
+// newNotifier is unavailable outside Linux and Windows, where watch polls
+func newNotifier() (notifier, error) {
+	return nil, errors.New("file system notifications are not supported on this platform")
+}
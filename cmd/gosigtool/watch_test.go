@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNotifier(t *testing.T) {
+	n, err := newNotifier()
+	if err != nil {
+		t.Skipf("File system notifications are unavailable: %v", err)
+	}
+	defer n.close()
+
+	dir := t.TempDir()
+	if added, err := n.add(dir); err != nil || !added {
+		t.Fatalf("Expected the directory to be added, got %v, %v", added, err)
+	}
+	if added, err := n.add(dir); err != nil || added {
+		t.Errorf("Expected a directory watched already to be skipped, got %v, %v", added, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "setup.exe"), []byte("MZ"), 0o600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	select {
+	case <-n.events():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a notification for the new file")
+	}
+}
+
+func TestWalkTrees_Directories(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0o700); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	_, listed := walkTrees(&walkFlags{recursive: true}, []string{dir})
+	if len(listed) != 2 || listed[0] != dir || listed[1] != sub {
+		t.Errorf("Expected the root and its subdirectory to be listed for watching, got %v", listed)
+	}
+	_, listed = walkTrees(&walkFlags{}, []string{dir})
+	if len(listed) != 1 || listed[0] != dir {
+		t.Errorf("Expected only the root without -r, got %v", listed)
+	}
+}
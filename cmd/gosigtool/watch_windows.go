@@ -0,0 +1,133 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// directoryChangeMask selects the changes to the signable files of a
+// directory
+const directoryChangeMask = syscall.FILE_NOTIFY_CHANGE_FILE_NAME | syscall.FILE_NOTIFY_CHANGE_DIR_NAME |
+	syscall.FILE_NOTIFY_CHANGE_SIZE | syscall.FILE_NOTIFY_CHANGE_LAST_WRITE
+
+// directoryWatch is one directory read with ReadDirectoryChangesW. The
+// overlapped structure comes first so that the completion can be mapped
+// back to the watch.
+type directoryWatch struct {
+	overlapped syscall.Overlapped
+	handle     syscall.Handle
+	path       string
+	buf        [16 * 1024]byte
+}
+
+// directoryNotifier watches directories with ReadDirectoryChangesW, its
+// completions queued on one I/O completion port
+type directoryNotifier struct {
+	port    syscall.Handle
+	changes chan struct{}
+
+	mu      sync.Mutex
+	watches map[string]*directoryWatch
+}
+
+// newNotifier returns a ReadDirectoryChangesW notifier
+func newNotifier() (notifier, error) {
+	port, err := syscall.CreateIoCompletionPort(syscall.InvalidHandle, 0, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create an I/O completion port: %w", err)
+	}
+	n := &directoryNotifier{
+		port:    port,
+		changes: make(chan struct{}, 1),
+		watches: make(map[string]*directoryWatch),
+	}
+	go n.read()
+	return n, nil
+}
+
+func (n *directoryNotifier) add(dir string) (bool, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.watches[dir] != nil {
+		return false, nil
+	}
+	name, err := syscall.UTF16PtrFromString(dir)
+	if err != nil {
+		return false, fmt.Errorf("failed to watch %s: %w", dir, err)
+	}
+	handle, err := syscall.CreateFile(name, syscall.FILE_LIST_DIRECTORY,
+		syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, nil,
+		syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS|syscall.FILE_FLAG_OVERLAPPED, 0)
+	if err != nil {
+		return false, fmt.Errorf("failed to watch %s: %w", dir, err)
+	}
+	if _, err := syscall.CreateIoCompletionPort(handle, n.port, 0, 0); err != nil {
+		syscall.CloseHandle(handle)
+		return false, fmt.Errorf("failed to watch %s: %w", dir, err)
+	}
+	w := &directoryWatch{handle: handle, path: dir}
+	if err := w.read(); err != nil {
+		syscall.CloseHandle(handle)
+		return false, fmt.Errorf("failed to watch %s: %w", dir, err)
+	}
+	n.watches[dir] = w
+	return true, nil
+}
+
+func (n *directoryNotifier) events() <-chan struct{} { return n.changes }
+
+// close closes the directories, then wakes read with an empty completion
+// so that it closes the port
+func (n *directoryNotifier) close() error {
+	n.mu.Lock()
+	for _, w := range n.watches {
+		syscall.CloseHandle(w.handle)
+	}
+	n.watches = nil
+	n.mu.Unlock()
+	return syscall.PostQueuedCompletionStatus(n.port, 0, 0, nil)
+}
+
+// read signals a change for each completion until the notifier is closed,
+// and forgets the directories that can no longer be read, such as those
+// removed
+func (n *directoryNotifier) read() {
+	defer syscall.CloseHandle(n.port)
+	for {
+		var size uint32
+		var key uint32
+		var overlapped *syscall.Overlapped
+		err := syscall.GetQueuedCompletionStatus(n.port, &size, &key, &overlapped, syscall.INFINITE)
+		if overlapped == nil {
+			return
+		}
+		// The overlapped structure is the first field of its watch
+		w := (*directoryWatch)(unsafe.Pointer(overlapped))
+
+		n.mu.Lock()
+		if n.watches != nil && n.watches[w.path] == w {
+			if err == nil {
+				err = w.read()
+			}
+			if err != nil {
+				syscall.CloseHandle(w.handle)
+				delete(n.watches, w.path)
+			}
+		}
+		n.mu.Unlock()
+		select {
+		case n.changes <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// read queues the next read of the changes to the directory; a completion
+// with no data means the changes overflowed the buffer
+func (w *directoryWatch) read() error {
+	return syscall.ReadDirectoryChanges(w.handle, &w.buf[0], uint32(len(w.buf)), false, directoryChangeMask, nil, &w.overlapped, 0)
+}
@@ -0,0 +1,398 @@
+package sigtool
+
+import (
+	"archive/zip"
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	// maxContainerDepth bounds how deep VerifyContainer recurses into
+	// containers among the payloads of a container
+	maxContainerDepth = 2
+	// sfxSearchSize is how much of the overlay of a self-extracting
+	// executable is searched for the start of a cabinet
+	sfxSearchSize = 64 << 10
+	// rtRCData is the RT_RCDATA resource type, which holds the cabinet of
+	// IExpress packages
+	rtRCData = 10
+)
+
+// ContainerReport is the outcome of verifying a container and the files it
+// carries with VerifyContainer.
+type ContainerReport struct {
+	// Type is the format of the container: FileTypeCAB for Windows update
+	// packages (.msu) and cabinets, FileTypePE for self-extracting
+	// executables
+	Type FileType
+	// Signer is the signing certificate of the container, when it is signed
+	Signer *CertificateInfo `json:",omitempty"`
+	// Err is nil when the signature of the container verified successfully,
+	// otherwise it describes why verification failed
+	Err error `json:"-"`
+	// Payloads lists the files of the container in archive order, each
+	// followed by the files of the containers among them
+	Payloads []PayloadSignature
+}
+
+// PayloadSignature is the signature of a file carried by a container.
+type PayloadSignature struct {
+	// Path is the name of the file in the container, prefixed with the
+	// names of the enclosing payloads and a slash for nested containers
+	Path string
+	// Type is the format of the file, FileTypeUnknown for files sigtool
+	// cannot check
+	Type FileType
+	// Size is the size of the file in bytes
+	Size int64
+	// Signer is the signing certificate of the file, when it is signed
+	Signer *CertificateInfo `json:",omitempty"`
+	// Err is nil when the signature of the file verified successfully,
+	// otherwise it describes why verification failed; it wraps ErrNotSigned
+	// for unsigned files and files of unknown type
+	Err error `json:"-"`
+	// PayloadsErr is set when the file is a container whose own files
+	// cannot be read, such as an LZX-compressed cabinet
+	PayloadsErr error `json:"-"`
+}
+
+// Valid reports whether the signature of the payload verified successfully.
+func (p *PayloadSignature) Valid() bool {
+	return p.Err == nil
+}
+
+// Valid reports whether the signature of the container and of every
+// payload sigtool can check verified successfully. Payloads of unknown
+// type, such as the manifests of an update package, are not considered.
+func (r *ContainerReport) Valid() bool {
+	if r.Err != nil {
+		return false
+	}
+	for i := range r.Payloads {
+		if r.Payloads[i].Type != FileTypeUnknown && !r.Payloads[i].Valid() {
+			return false
+		}
+	}
+	return true
+}
+
+// VerifyContainer verifies the signature of a Windows update package
+// (.msu), cabinet or self-extracting executable and of every file it
+// carries.
+//
+// Update packages are signed cabinets holding signed cabinets and
+// manifests; self-extracting executables are PE files with a cabinet or ZIP
+// archive in their overlay, or, for IExpress packages, a cabinet in an
+// RT_RCDATA resource. Each payload is verified like Verify with opts, and
+// cabinets and self-extracting executables among them are searched in turn,
+// to a depth of two. A failure of the container or of a payload is
+// reported in its Err field and does not prevent the others from being
+// checked. Only uncompressed and MSZIP cabinet folders can be read: an
+// LZX-compressed container fails with ErrNotCabinet, and a payload that is
+// one reports it in PayloadsErr. PE files without an embedded archive
+// report no payloads.
+//
+// Parameters:
+//   - filePath: The path to the update package, cabinet or executable
+//   - opts: Verification options applied to the container and every payload
+//
+// Returns:
+//   - *ContainerReport: The outcome of the container and of its payloads
+//   - error: An error if the file cannot be read, is not a cabinet or PE
+//     file, or its archive cannot be extracted
+//
+// Example usage:
+//
+//	report, err := sigtool.VerifyContainer("windows10.0-kb5034441-x64.msu", sigtool.VerifyOptions{})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	for _, p := range report.Payloads {
+//	    fmt.Printf("%s %s valid=%v\n", p.Path, p.Type, p.Valid())
+//	}
+func VerifyContainer(filePath string, opts VerifyOptions) (*ContainerReport, error) {
+	if strings.TrimSpace(filePath) == "" {
+		return nil, errors.New("file path cannot be empty")
+	}
+
+	// #nosec G304 - This tool is designed to read user-specified files
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %q: %w", filePath, err)
+	}
+	defer f.Close()
+
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+	return verifyContainer(f, fileInfo.Size(), opts)
+}
+
+// verifyContainer implements VerifyContainer for r of the given size
+func verifyContainer(r io.ReaderAt, size int64, opts VerifyOptions) (*ContainerReport, error) {
+	fileType, err := detectFileType(r, size)
+	if err != nil {
+		return nil, err
+	}
+	if fileType != FileTypeCAB && fileType != FileTypePE {
+		return nil, fmt.Errorf("%s files are not containers", fileTypeName(fileType))
+	}
+	report := &ContainerReport{Type: fileType, Err: verifyAuthenticode(r, size, opts), Signer: payloadSigner(r, size)}
+	payloads, err := containerPayloads(r, size, fileType, "", 0, opts)
+	if err != nil {
+		return nil, err
+	}
+	report.Payloads = payloads
+	return report, nil
+}
+
+// fileTypeName returns fileType for messages, "unrecognised" when unknown
+func fileTypeName(fileType FileType) string {
+	if fileType == FileTypeUnknown {
+		return "unrecognised"
+	}
+	return string(fileType)
+}
+
+// containerPayloads verifies the files of the cabinet or self-extracting
+// executable r of the given type, naming each with prefix, and returns them
+// followed by the payloads of the containers among them until depth
+// reaches maxContainerDepth
+func containerPayloads(r io.ReaderAt, size int64, fileType FileType, prefix string, depth int, opts VerifyOptions) ([]PayloadSignature, error) {
+	if fileType == FileTypePE {
+		archive, err := embeddedArchive(r, size)
+		if err != nil || archive == nil {
+			return nil, err
+		}
+		if !isCabinet(archive, archive.Size()) {
+			return zipPayloads(archive, prefix, depth, opts)
+		}
+		r, size = archive, archive.Size()
+	}
+
+	var payloads []PayloadSignature
+	err := walkCABFiles(r, size, func(name string, size int64, contents io.Reader) error {
+		nested, err := verifyPayload(prefix+name, size, contents, depth, opts)
+		payloads = append(payloads, nested...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return payloads, nil
+}
+
+// zipPayloads verifies the members of the ZIP archive of a self-extracting
+// executable, which may follow a stub in r
+func zipPayloads(r *io.SectionReader, prefix string, depth int, opts VerifyOptions) ([]PayloadSignature, error) {
+	zr, err := zip.NewReader(r, r.Size())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotZipArchive, err)
+	}
+	var payloads []PayloadSignature
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", f.Name, err)
+		}
+		nested, err := verifyPayload(prefix+f.Name, int64(f.UncompressedSize64), rc, depth, opts)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		payloads = append(payloads, nested...)
+	}
+	return payloads, nil
+}
+
+// verifyPayload copies the payload named name to a temporary file and
+// verifies it per opts, returning it followed by its own payloads when it
+// is a container
+func verifyPayload(name string, size int64, contents io.Reader, depth int, opts VerifyOptions) ([]PayloadSignature, error) {
+	tmp, err := os.CreateTemp("", "sigtool-payload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if _, err := io.Copy(tmp, contents); err != nil {
+		return nil, fmt.Errorf("failed to extract %s: %w", name, err)
+	}
+
+	payload := PayloadSignature{Path: name, Size: size}
+	payload.Type, err = detectFileType(tmp, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if payload.Type == FileTypeUnknown {
+		payload.Err = fmt.Errorf("%w (%s is not a file type sigtool verifies)", ErrNotSigned, path.Base(name))
+		return []PayloadSignature{payload}, nil
+	}
+	payload.Err = verifyAuthenticode(tmp, size, opts)
+	payload.Signer = payloadSigner(tmp, size)
+	opts.logger().Debug("verified container payload", "path", name, "type", payload.Type, "valid", payload.Err == nil)
+
+	payloads := []PayloadSignature{payload}
+	if depth+1 < maxContainerDepth && (payload.Type == FileTypeCAB || payload.Type == FileTypePE) {
+		nested, err := containerPayloads(tmp, size, payload.Type, name+"/", depth+1, opts)
+		if err != nil {
+			payloads[0].PayloadsErr = err
+			return payloads, nil
+		}
+		payloads = append(payloads, nested...)
+	}
+	return payloads, nil
+}
+
+// payloadSigner returns the signing certificate of r, or nil when it has no
+// PKCS#7 signature that names one
+func payloadSigner(r io.ReaderAt, size int64) *CertificateInfo {
+	signature, err := extractSignature(r, size)
+	if err != nil {
+		return nil
+	}
+	info, err := inspectSignature(signature)
+	if err != nil {
+		return nil
+	}
+	return info.Signer
+}
+
+// embeddedArchive returns the cabinet or ZIP archive embedded in the
+// self-extracting executable r: a cabinet near the start of its overlay or
+// in an RT_RCDATA resource, or a ZIP archive ending its overlay. It returns
+// nil when the executable carries neither.
+func embeddedArchive(r io.ReaderAt, size int64) (*io.SectionReader, error) {
+	end, err := imageEnd(r)
+	if err != nil {
+		return nil, err
+	}
+	layout, err := readLayout(r, size)
+	if err != nil {
+		return nil, err
+	}
+	overlayEnd := size
+	if layout.certTableSize > 0 {
+		overlayEnd = layout.certTableOffset
+	}
+
+	if overlayEnd > end {
+		head := make([]byte, min(overlayEnd-end, sfxSearchSize))
+		if _, err := r.ReadAt(head, end); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to read overlay: %w", err)
+		}
+		for i := 0; ; i++ {
+			n := bytes.Index(head[i:], cabinetMagic)
+			if n < 0 {
+				break
+			}
+			i += n
+			archive := io.NewSectionReader(r, end+int64(i), overlayEnd-end-int64(i))
+			if _, err := readCABLayout(archive, archive.Size()); err == nil {
+				return archive, nil
+			}
+		}
+		archive := io.NewSectionReader(r, end, overlayEnd-end)
+		if _, err := zip.NewReader(archive, archive.Size()); err == nil {
+			return archive, nil
+		}
+	}
+
+	pefile, err := pe.NewFile(r)
+	if err != nil {
+		return nil, &PEFormatError{Err: err}
+	}
+	defer pefile.Close()
+	data, err := resourceCabinet(pefile)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	return io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data))), nil
+}
+
+// resourceCabinet returns the first RT_RCDATA resource of pefile that is a
+// cabinet, or nil when it has none
+func resourceCabinet(pefile *pe.File) ([]byte, error) {
+	var dir pe.DataDirectory
+	switch h := pefile.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		if h.NumberOfRvaAndSizes > pe.IMAGE_DIRECTORY_ENTRY_RESOURCE {
+			dir = h.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_RESOURCE]
+		}
+	case *pe.OptionalHeader64:
+		if h.NumberOfRvaAndSizes > pe.IMAGE_DIRECTORY_ENTRY_RESOURCE {
+			dir = h.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_RESOURCE]
+		}
+	}
+	if dir.VirtualAddress == 0 || dir.Size == 0 {
+		return nil, nil
+	}
+	rsrc, err := readRVA(pefile, dir.VirtualAddress, dir.Size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read resource directory: %w", err)
+	}
+	next, ok, err := findResourceEntry(rsrc, 0, rtRCData, false)
+	if err != nil || !ok || next&0x80000000 == 0 {
+		return nil, err
+	}
+
+	// Every name and language of the type is a candidate
+	names, err := resourceEntries(rsrc, next&^0x80000000)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if name&0x80000000 == 0 {
+			continue
+		}
+		languages, err := resourceEntries(rsrc, name&^0x80000000)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range languages {
+			if entry&0x80000000 != 0 || int64(entry)+16 > int64(len(rsrc)) {
+				return nil, errors.New("invalid resource directory: bad data entry")
+			}
+			rva := binary.LittleEndian.Uint32(rsrc[entry:])
+			size := binary.LittleEndian.Uint32(rsrc[entry+4:])
+			if size < cabHeaderSize {
+				continue
+			}
+			magic, err := readRVA(pefile, rva, uint32(len(cabinetMagic)))
+			if err != nil || !bytes.Equal(magic, cabinetMagic) {
+				continue
+			}
+			return readRVA(pefile, rva, size)
+		}
+	}
+	return nil, nil
+}
+
+// resourceEntries returns the offset fields of every entry of the resource
+// directory at offset
+func resourceEntries(rsrc []byte, offset uint32) ([]uint32, error) {
+	if int64(offset)+16 > int64(len(rsrc)) {
+		return nil, errors.New("invalid resource directory: truncated")
+	}
+	n := int64(binary.LittleEndian.Uint16(rsrc[offset+12:])) + int64(binary.LittleEndian.Uint16(rsrc[offset+14:]))
+	entries := int64(offset) + 16
+	if entries+8*n > int64(len(rsrc)) {
+		return nil, errors.New("invalid resource directory: truncated")
+	}
+	out := make([]uint32, n)
+	for i := range out {
+		out[i] = binary.LittleEndian.Uint32(rsrc[entries+8*int64(i)+4:])
+	}
+	return out, nil
+}
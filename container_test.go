@@ -0,0 +1,138 @@
+package sigtool
+
+import (
+	"crypto"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// signedPEForTest returns a mock PE image with payload as its overlay,
+// signed by the test signer
+func signedPEForTest(t *testing.T, payload []byte) []byte {
+	t.Helper()
+	image := mockPEImage(payload)
+	return embedSignatureForTest(image, signAuthenticodeForTest(t, mockAuthentihash(image, crypto.SHA256), crypto.SHA256))
+}
+
+// writeContainerForTest writes data to a file named name and returns its
+// path
+func writeContainerForTest(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(filePath, data, 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	return filePath
+}
+
+// updatePackageForTest returns a signed update package holding a signed
+// cabinet with setup, and a properties file
+func updatePackageForTest(t *testing.T, setup []byte) []byte {
+	t.Helper()
+	inner := signCabinetForTest(t, cabinetFilesForTest(t, []zipMemberForTest{
+		{`amd64\setup.exe`, setup},
+		{"update.mum", []byte("<assembly/>")},
+	}, true))
+	return signCabinetForTest(t, cabinetFilesForTest(t, []zipMemberForTest{
+		{"Windows10.0-KB1-x64.cab", inner},
+		{"Windows10.0-KB1-x64-pkgProperties.txt", []byte("Applies to=\"Windows 10\"\r\n")},
+	}, true))
+}
+
+func TestVerifyContainer_UpdatePackage(t *testing.T) {
+	filePath := writeContainerForTest(t, "Windows10.0-KB1-x64.msu", updatePackageForTest(t, signedPEForTest(t, []byte("setup"))))
+
+	report, err := VerifyContainer(filePath, VerifyOptions{Roots: testRoots(t)})
+	if err != nil {
+		t.Fatalf("VerifyContainer failed: %v", err)
+	}
+	if report.Type != FileTypeCAB || report.Err != nil || report.Signer == nil {
+		t.Fatalf("Expected a valid signed cabinet, got %s (%v)", report.Type, report.Err)
+	}
+	want := []struct {
+		path     string
+		fileType FileType
+	}{
+		{"Windows10.0-KB1-x64.cab", FileTypeCAB},
+		{"Windows10.0-KB1-x64.cab/amd64/setup.exe", FileTypePE},
+		{"Windows10.0-KB1-x64.cab/update.mum", FileTypeUnknown},
+		{"Windows10.0-KB1-x64-pkgProperties.txt", FileTypeUnknown},
+	}
+	if len(report.Payloads) != len(want) {
+		t.Fatalf("Expected %d payloads, got %+v", len(want), report.Payloads)
+	}
+	for i, w := range want {
+		p := report.Payloads[i]
+		if p.Path != w.path || p.Type != w.fileType {
+			t.Errorf("Payload %d: expected %s (%s), got %s (%s)", i, w.path, w.fileType, p.Path, p.Type)
+		}
+		if w.fileType != FileTypeUnknown && (!p.Valid() || p.Signer == nil) {
+			t.Errorf("%s: expected a valid signature, got %v", p.Path, p.Err)
+		}
+		if w.fileType == FileTypeUnknown && !errors.Is(p.Err, ErrNotSigned) {
+			t.Errorf("%s: expected ErrNotSigned, got %v", p.Path, p.Err)
+		}
+	}
+	if !report.Valid() {
+		t.Error("Expected the report to be valid")
+	}
+}
+
+func TestVerifyContainer_TamperedPayload(t *testing.T) {
+	setup := signedPEForTest(t, []byte("setup"))
+	setup[len(mockPEImage(nil))] ^= 0xff
+	filePath := writeContainerForTest(t, "Windows10.0-KB1-x64.msu", updatePackageForTest(t, setup))
+
+	report, err := VerifyContainer(filePath, VerifyOptions{})
+	if err != nil {
+		t.Fatalf("VerifyContainer failed: %v", err)
+	}
+	if report.Err != nil {
+		t.Errorf("Expected the update package signature to verify, got %v", report.Err)
+	}
+	if report.Valid() {
+		t.Error("Expected the report to be invalid")
+	}
+	for _, p := range report.Payloads {
+		if p.Path == "Windows10.0-KB1-x64.cab/amd64/setup.exe" && !errors.Is(p.Err, ErrDigestMismatch) {
+			t.Errorf("Expected ErrDigestMismatch for the modified payload, got %v", p.Err)
+		}
+	}
+}
+
+func TestVerifyContainer_SelfExtracting(t *testing.T) {
+	archives := map[string][]byte{
+		"zip": zipForTest(t, []zipMemberForTest{{"setup.exe", signedPEForTest(t, []byte("setup"))}}),
+		"cab": cabinetFilesForTest(t, []zipMemberForTest{{"setup.exe", signedPEForTest(t, []byte("setup"))}}, false),
+	}
+	for name, archive := range archives {
+		t.Run(name, func(t *testing.T) {
+			filePath := writeContainerForTest(t, "sfx.exe", signedPEForTest(t, append([]byte("stub configuration"), archive...)))
+			report, err := VerifyContainer(filePath, VerifyOptions{})
+			if err != nil {
+				t.Fatalf("VerifyContainer failed: %v", err)
+			}
+			if report.Type != FileTypePE || report.Err != nil {
+				t.Errorf("Expected a valid signed executable, got %s (%v)", report.Type, report.Err)
+			}
+			if len(report.Payloads) != 1 || report.Payloads[0].Path != "setup.exe" || !report.Payloads[0].Valid() {
+				t.Errorf("Expected the valid setup.exe payload, got %+v", report.Payloads)
+			}
+		})
+	}
+
+	// Executables without an archive carry no payloads
+	report, err := VerifyContainer(writeContainerForTest(t, "plain.exe", signedPEForTest(t, []byte("code"))), VerifyOptions{})
+	if err != nil || len(report.Payloads) != 0 || !report.Valid() {
+		t.Errorf("Expected a valid executable without payloads, got %+v (%v)", report, err)
+	}
+}
+
+func TestVerifyContainer_NotContainer(t *testing.T) {
+	filePath := writeContainerForTest(t, "notes.txt", []byte("plain text"))
+	if _, err := VerifyContainer(filePath, VerifyOptions{}); err == nil {
+		t.Error("Expected an error for a file that is not a container")
+	}
+}
@@ -0,0 +1,107 @@
+package sigtool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ExtractDigitalSignatureContext is ExtractDigitalSignature with support for
+// cancellation and deadlines.
+//
+// The context is checked before every read from the file, so extraction from
+// slow storage such as network shares stops promptly once ctx is done. When
+// the context ends the returned error wraps ctx.Err().
+//
+// Parameters:
+//   - ctx: The context controlling cancellation
+//   - filePath: The path to the file to extract the signature from, of
+//     any type ExtractDigitalSignature accepts
+//
+// Returns:
+//   - []byte: The raw signature data, as ExtractDigitalSignature returns it
+//   - error: An error if extraction fails or the context is done
+func ExtractDigitalSignatureContext(ctx context.Context, filePath string) ([]byte, error) {
+	var buf []byte
+	err := withContextFile(ctx, filePath, func(r io.ReaderAt, size int64) error {
+		var err error
+		buf, err = extractSignature(r, size)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// VerifyContext performs full Authenticode verification of a PE file with
+// support for cancellation and deadlines.
+//
+// The Authenticode digest is recomputed from the file and compared with the
+// digest stored in the signature, the signer signature is verified and the
+// certificate chain is checked according to opts. Hashing large files checks
+// the context between reads, and the context bounds the OCSP requests, CRL
+// downloads and AIA downloads of opts.OCSP, opts.CRL and opts.AIAFetcher;
+// when the context ends the returned error wraps ctx.Err().
+//
+// Parameters:
+//   - ctx: The context controlling cancellation
+//   - filePath: The path to the PE file to verify
+//   - opts: Certificate chain verification options
+//
+// Returns:
+//   - error: nil if the signature is valid, otherwise an error describing the failure
+func VerifyContext(ctx context.Context, filePath string, opts VerifyOptions) error {
+	opts.ctx = ctx
+	return withContextFile(ctx, filePath, func(r io.ReaderAt, size int64) error {
+		return verifyAuthenticode(r, size, opts)
+	})
+}
+
+// withContextFile opens filePath and runs fn with a reader that fails once
+// ctx is done.
+func withContextFile(ctx context.Context, filePath string, fn func(r io.ReaderAt, size int64) error) error {
+	if ctx == nil {
+		return errors.New("context cannot be nil")
+	}
+	if strings.TrimSpace(filePath) == "" {
+		return errors.New("file path cannot be empty")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// #nosec G304 - This tool is designed to read user-specified PE files
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file %q: %w", filePath, err)
+	}
+	defer f.Close()
+
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	err = fn(&contextReaderAt{ctx: ctx, r: f}, fileInfo.Size())
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("operation aborted: %w", ctx.Err())
+	}
+	return err
+}
+
+// contextReaderAt is an io.ReaderAt that refuses to read once its context is done
+type contextReaderAt struct {
+	ctx context.Context
+	r   io.ReaderAt
+}
+
+func (c *contextReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.ReadAt(p, off)
+}
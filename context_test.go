@@ -0,0 +1,110 @@
+package sigtool
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestExtractDigitalSignatureContext(t *testing.T) {
+	signatureData := []byte("mock-pkcs7-signature-data")
+	filePath := createMockPEFile(t, true, signatureData)
+
+	result, err := ExtractDigitalSignatureContext(context.Background(), filePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !bytes.Equal(result, signatureData) {
+		t.Errorf("Expected signature data %q, got %q", signatureData, result)
+	}
+}
+
+func TestExtractDigitalSignatureContext_MSI(t *testing.T) {
+	filePath := writeSignedMSIForTest(t, false)
+	want, err := ExtractDigitalSignature(filePath)
+	if err != nil {
+		t.Fatalf("ExtractDigitalSignature failed: %v", err)
+	}
+	got, err := ExtractDigitalSignatureContext(context.Background(), filePath)
+	if err != nil {
+		t.Fatalf("Expected the MSI signature, got: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("Expected the same signature as ExtractDigitalSignature")
+	}
+}
+
+func TestExtractDigitalSignatureContext_Cancelled(t *testing.T) {
+	filePath := createMockPEFile(t, true, []byte("mock-pkcs7-signature-data"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := ExtractDigitalSignatureContext(ctx, filePath)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got: %v", err)
+	}
+}
+
+func TestContextReaderAt_StopsAfterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &contextReaderAt{ctx: ctx, r: bytes.NewReader([]byte("data"))}
+
+	buf := make([]byte, 2)
+	if _, err := r.ReadAt(buf, 0); err != nil {
+		t.Fatalf("Expected read to succeed, got: %v", err)
+	}
+
+	cancel()
+	if _, err := r.ReadAt(buf, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got: %v", err)
+	}
+}
+
+func TestVerifyContext(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+
+	if err := VerifyContext(context.Background(), filePath, VerifyOptions{}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	cert, _ := testSigner(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	if err := VerifyContext(context.Background(), filePath, VerifyOptions{Roots: roots}); err != nil {
+		t.Fatalf("Expected chain verification to succeed, got: %v", err)
+	}
+}
+
+func TestVerifyContext_ModifiedContent(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	content[mockHeaderSize] ^= 0xff
+	if err := os.WriteFile(filePath, content, 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	err = VerifyContext(context.Background(), filePath, VerifyOptions{})
+	if err == nil || !strings.Contains(err.Error(), "does not match signed digest") {
+		t.Errorf("Expected digest mismatch error, got: %v", err)
+	}
+}
+
+func TestVerifyContext_Cancelled(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := VerifyContext(ctx, filePath, VerifyOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got: %v", err)
+	}
+}
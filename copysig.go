@@ -0,0 +1,90 @@
+package sigtool
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+)
+
+// CopySignature copies the certificate table of src into dst, replacing any
+// signature dst already carries.
+//
+// Every WIN_CERTIFICATE entry is copied byte for byte, so the signature blob
+// stays cryptographically valid while its Authenticode digest no longer
+// matches dst. This produces "signature thief" samples for exercising
+// detection: verification of dst fails with ErrDigestMismatch, whereas
+// checks that only validate the PKCS#7 blob are fooled. The security
+// directory and the checksum of dst are updated and dst is replaced
+// atomically.
+//
+// Parameters:
+//   - src: The path to the signed PE file to copy the signature from
+//   - dst: The path to the PE file receiving the signature
+//
+// Returns:
+//   - error: ErrNotSigned if src has no signature, or an error if either
+//     file cannot be parsed or dst cannot be written
+//
+// Example usage:
+//
+//	if err := sigtool.CopySignature("signed.exe", "thief.exe"); err != nil {
+//	    log.Fatal(err)
+//	}
+//	err := sigtool.Verify("thief.exe", nil)
+//	fmt.Println(errors.Is(err, sigtool.ErrDigestMismatch)) // true
+func CopySignature(src, dst string) error {
+	table, err := readCertificateTableBytes(src)
+	if err != nil {
+		return err
+	}
+
+	// #nosec G304
+	data, err := os.ReadFile(dst)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	image, layout, err := unsignedImage(data)
+	if err != nil {
+		return err
+	}
+	image = alignImage(image, layout)
+
+	signed, err := appendRawCertificateTable(image, layout, table)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(dst, signed)
+}
+
+// readCertificateTableBytes returns the raw certificate table of filePath,
+// padded to the certificate table alignment
+func readCertificateTableBytes(filePath string) ([]byte, error) {
+	// #nosec G304
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	layout, err := readLayout(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	if layout.certTableOffset == 0 || layout.certTableSize == 0 {
+		return nil, ErrNotSigned
+	}
+	if layout.certTableSize > MaxSignatureSize {
+		return nil, &SignatureSizeError{Size: layout.certTableSize, Limit: MaxSignatureSize}
+	}
+	end := layout.certTableOffset + layout.certTableSize
+	if end > int64(len(data)) {
+		return nil, &SignatureBoundsError{
+			Offset:   layout.certTableOffset,
+			Length:   layout.certTableSize,
+			FileSize: int64(len(data)),
+			Reason:   "certificate table extends beyond file bounds",
+		}
+	}
+
+	table := make([]byte, alignCertificateTable(layout.certTableSize))
+	copy(table, data[layout.certTableOffset:end])
+	return table, nil
+}
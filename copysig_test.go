@@ -0,0 +1,38 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"testing"
+)
+
+func TestCopySignature(t *testing.T) {
+	src, _ := createSignedMockPE(t, crypto.SHA256)
+	dst := writeUnsignedPEForTest(t, []byte("different program"))
+
+	if err := CopySignature(src, dst); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	want, _ := ExtractDigitalSignature(src)
+	got, err := ExtractDigitalSignature(dst)
+	if err != nil || !bytes.Equal(got, want) {
+		t.Fatalf("Expected the copied signature, got %d bytes (%v)", len(got), err)
+	}
+	if err := VerifySignatureBytes(got); err != nil {
+		t.Errorf("Expected the copied blob to stay valid, got: %v", err)
+	}
+	var mismatch *DigestMismatchError
+	if err := Verify(dst, nil); !errors.Is(err, ErrDigestMismatch) || !errors.As(err, &mismatch) {
+		t.Errorf("Expected ErrDigestMismatch for the sig-thief sample, got: %v", err)
+	}
+}
+
+func TestCopySignature_UnsignedSource(t *testing.T) {
+	src := writeUnsignedPEForTest(t, []byte("unsigned"))
+	dst := writeUnsignedPEForTest(t, []byte("target"))
+	if err := CopySignature(src, dst); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned, got: %v", err)
+	}
+}
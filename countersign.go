@@ -0,0 +1,65 @@
+package sigtool
+
+import (
+	"context"
+	"encoding/asn1"
+	"fmt"
+)
+
+// TimestampPE adds an RFC 3161 timestamp to the existing Authenticode
+// signature of a PE file without re-signing it, as `signtool timestamp`
+// does. A timestamp lets the signature outlive the signer certificate.
+//
+// The encrypted digest of the signature is timestamped and the token is
+// stored as its 1.3.6.1.4.1.311.3.3.1 unsigned attribute, replacing any
+// existing RFC 3161 or legacy timestamp. Other unsigned attributes, such as
+// nested signatures, are kept. The file is replaced atomically.
+//
+// Parameters:
+//   - ctx: Bounds the timestamp requests
+//   - filePath: The path to the signed PE file
+//   - opts: The timestamp authorities and retry policy
+//
+// Returns:
+//   - error: ErrNotSigned for unsigned files, or an error if no authority
+//     grants a timestamp or the file cannot be written
+//
+// Example usage:
+//
+//	err := sigtool.TimestampPE(ctx, "app.exe", &sigtool.TimestampOptions{
+//	    URLs: []string{"http://timestamp.digicert.com"},
+//	})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+func TimestampPE(ctx context.Context, filePath string, opts *TimestampOptions) error {
+	return updateSignature(filePath, func(signature, _ []byte, _ *peLayout) ([]byte, error) {
+		return timestampSignature(ctx, signature, opts)
+	})
+}
+
+// timestampSignature returns signature with an RFC 3161 timestamp of its
+// primary signer in place of any existing timestamp
+func timestampSignature(ctx context.Context, signature []byte, opts *TimestampOptions) ([]byte, error) {
+	sd, err := parseSignedData(signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Authenticode signature: %w", err)
+	}
+	si := &sd.SignerInfos[0]
+	token, err := RequestTimestamp(ctx, si.EncryptedDigest, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := []attribute{{
+		Type:  oidRFC3161Timestamp,
+		Value: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: token},
+	}}
+	for _, attr := range si.UnauthenticatedAttributes {
+		if !attr.Type.Equal(oidRFC3161Timestamp) && !attr.Type.Equal(oidCounterSignature) {
+			attrs = append(attrs, attr)
+		}
+	}
+	si.UnauthenticatedAttributes = attrs
+	return encodeSignedData(sd)
+}
@@ -0,0 +1,124 @@
+package sigtool
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseSignedData_RoundTrip(t *testing.T) {
+	cert, _ := testSigner(t)
+	for name, opt := range map[string]func(*testSignerInfo){
+		"plain":            func(*testSignerInfo) {},
+		"rfc3161":          withRFC3161Timestamp(t, cert.NotBefore.Add(time.Minute)),
+		"countersignature": withCounterSignature(t, cert.NotBefore.Add(time.Minute)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			filePath, _ := createSignedMockPEWithPayload(t, crypto.SHA256, []byte("payload"), opt)
+			signature, err := ExtractDigitalSignature(filePath)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			sd, err := parseSignedData(signature)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			encoded, err := encodeSignedData(sd)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if !bytes.HasPrefix(signature, encoded) || len(signature)-len(encoded) >= 8 {
+				t.Errorf("Expected the signature to re-encode unchanged")
+			}
+		})
+	}
+}
+
+func TestTimestampPE(t *testing.T) {
+	root := issueCertificateForTest(t, testCATemplate("timestamp root", 1), nil)
+	leaf := issueCertificateForTest(t, testLeafTemplate("timestamp signer", 2, x509.ExtKeyUsageCodeSigning), root)
+	tsa, _ := testTSA(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Cert)
+	roots.AddCert(tsa)
+	server, _ := tsaServerForTest(t, 0, nil)
+
+	filePath := writeUnsignedPEForTest(t, []byte("payload to timestamp"))
+	if err := SignPE(filePath, leaf.Cert, leaf.Key, nil); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	before, err := ExtractWithDigests(filePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if err := TimestampPE(context.Background(), filePath, &TimestampOptions{URLs: []string{server.URL}}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{Roots: roots}); err != nil {
+		t.Errorf("Expected timestamped signature to verify, got: %v", err)
+	}
+	after, err := ExtractWithDigests(filePath)
+	if err != nil || !bytes.Equal(after.StoredDigest, before.StoredDigest) {
+		t.Errorf("Expected the signed digest to be kept, got %+v (%v)", after, err)
+	}
+	info, err := Inspect(filePath)
+	if err != nil || info.Timestamp == nil || info.Timestamp.Type != TimestampRFC3161 {
+		t.Fatalf("Expected an RFC 3161 timestamp, got %+v (%v)", info, err)
+	}
+	first := info.Timestamp.Time
+
+	// Timestamping again replaces the timestamp rather than adding one
+	if err := TimestampPE(context.Background(), filePath, &TimestampOptions{URLs: []string{server.URL}}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	signature, _ := ExtractDigitalSignature(filePath)
+	sd, err := parseSignedData(signature)
+	if err != nil || len(sd.SignerInfos[0].UnauthenticatedAttributes) != 1 {
+		t.Errorf("Expected exactly one unsigned attribute, got %+v (%v)", sd, err)
+	}
+	if info, _ := Inspect(filePath); info == nil || info.Timestamp == nil || info.Timestamp.Time.Before(first) {
+		t.Errorf("Expected the new timestamp, got %+v", info)
+	}
+}
+
+func TestTimestampPE_ReplacesCounterSignature(t *testing.T) {
+	cert, _ := testSigner(t)
+	filePath, _ := createSignedMockPEWithPayload(t, crypto.SHA256, []byte("payload"), withCounterSignature(t, cert.NotBefore.Add(time.Minute)))
+	server, _ := tsaServerForTest(t, 0, nil)
+
+	if err := TimestampPE(context.Background(), filePath, &TimestampOptions{URLs: []string{server.URL}}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := Verify(filePath, nil); err != nil {
+		t.Errorf("Expected timestamped signature to verify, got: %v", err)
+	}
+	info, err := Inspect(filePath)
+	if err != nil || info.Timestamp == nil || info.Timestamp.Type != TimestampRFC3161 {
+		t.Errorf("Expected the countersignature to be replaced, got %+v (%v)", info, err)
+	}
+}
+
+func TestTimestampPE_Errors(t *testing.T) {
+	server, _ := tsaServerForTest(t, 0, nil)
+	opts := &TimestampOptions{URLs: []string{server.URL}}
+
+	unsigned := writeUnsignedPEForTest(t, []byte("payload"))
+	if err := TimestampPE(context.Background(), unsigned, opts); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned, got: %v", err)
+	}
+
+	down, _ := tsaServerForTest(t, 100, nil)
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+	before, _ := ExtractDigitalSignature(filePath)
+	if err := TimestampPE(context.Background(), filePath, &TimestampOptions{URLs: []string{down.URL}}); err == nil {
+		t.Error("Expected error when the authority is down, got nil")
+	}
+	if after, _ := ExtractDigitalSignature(filePath); !bytes.Equal(before, after) {
+		t.Error("Expected a failed timestamp to leave the file unchanged")
+	}
+}
@@ -0,0 +1,383 @@
+package sigtool
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultCRLTimeout bounds each CRL download
+	DefaultCRLTimeout = 15 * time.Second
+	// maxCRLSize bounds the size of a downloaded CRL
+	maxCRLSize = 32 << 20
+	// crlReasonRemoveFromCRL marks a delta CRL entry that reinstates a
+	// certificate previously on hold
+	crlReasonRemoveFromCRL = 8
+)
+
+var (
+	oidExtensionDeltaCRLIndicator = asn1.ObjectIdentifier{2, 5, 29, 27}
+	oidExtensionFreshestCRL       = asn1.ObjectIdentifier{2, 5, 29, 46}
+)
+
+// distributionPoint mirrors the RFC 5280 DistributionPoint structure used by
+// the freshest CRL extension
+type distributionPoint struct {
+	DistributionPoint distributionPointName `asn1:"optional,tag:0"`
+	Reason            asn1.BitString        `asn1:"optional,tag:1"`
+	CRLIssuer         asn1.RawValue         `asn1:"optional,tag:2"`
+}
+
+type distributionPointName struct {
+	FullName     []asn1.RawValue  `asn1:"optional,tag:0"`
+	RelativeName pkix.RDNSequence `asn1:"optional,tag:1"`
+}
+
+// CRLChecker checks certificates against certificate revocation lists, either
+// supplied locally with AddCRL or downloaded from the HTTP CRL distribution
+// points of the certificates. Delta CRLs, supplied locally or named by the
+// freshest CRL extension, are applied on top of their base CRL. Downloaded
+// CRLs are cached by URL until their nextUpdate time; the checker is safe for
+// concurrent use.
+//
+// Only CRLs issued and signed by the certificate's issuer are used; indirect
+// CRLs are not supported. Revocations are compared with the verification
+// time as documented on OCSPChecker, and checking soft-fails unless HardFail
+// is set.
+type CRLChecker struct {
+	// Client performs the downloads. When nil, a client with Timeout is used.
+	Client *http.Client
+	// Timeout bounds each download when Client is nil. Zero means
+	// DefaultCRLTimeout.
+	Timeout time.Duration
+	// HardFail rejects certificates whose revocation status cannot be
+	// determined
+	HardFail bool
+	// Offline disables downloads; only local CRLs are used
+	Offline bool
+
+	mu    sync.Mutex
+	local []*x509.RevocationList
+	cache map[string]*x509.RevocationList
+}
+
+// NewCRLChecker returns a CRLChecker that bounds each download by timeout.
+//
+// Parameters:
+//   - timeout: The per-download timeout, or 0 for DefaultCRLTimeout
+//   - hardFail: Whether an undeterminable status fails verification
+//
+// Returns:
+//   - *CRLChecker: A checker without local CRLs
+//
+// Example usage:
+//
+//	checker := sigtool.NewCRLChecker(0, true)
+//	if err := checker.LoadCRLFile("issuing-ca.crl"); err != nil {
+//	    log.Fatal(err)
+//	}
+//	checker.Offline = true
+//	err := sigtool.Verify("signed.exe", &sigtool.VerifyOptions{
+//	    UseSystemRoots: true,
+//	    CRL:            checker,
+//	})
+func NewCRLChecker(timeout time.Duration, hardFail bool) *CRLChecker {
+	return &CRLChecker{Timeout: timeout, HardFail: hardFail}
+}
+
+// AddCRL adds a base or delta CRL in DER or PEM form. Its signature is
+// checked against the issuer when it is used.
+//
+// Parameters:
+//   - data: The encoded CRL
+//
+// Returns:
+//   - error: An error if data is not a CRL
+func (c *CRLChecker) AddCRL(data []byte) error {
+	if block, _ := pem.Decode(data); block != nil && block.Type == "X509 CRL" {
+		data = block.Bytes
+	}
+	crl, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse CRL: %w", err)
+	}
+	c.mu.Lock()
+	c.local = append(c.local, crl)
+	c.mu.Unlock()
+	return nil
+}
+
+// LoadCRLFile adds the base or delta CRL stored in filePath.
+//
+// Parameters:
+//   - filePath: The path to a DER or PEM encoded CRL
+//
+// Returns:
+//   - error: An error if the file cannot be read or is not a CRL
+func (c *CRLChecker) LoadCRLFile(filePath string) error {
+	// #nosec G304 - CRL files are user-specified inputs
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read CRL %q: %w", filePath, err)
+	}
+	if err := c.AddCRL(data); err != nil {
+		return fmt.Errorf("%s: %w", filePath, err)
+	}
+	return nil
+}
+
+// CheckChain checks every certificate of chain except the last against its
+// issuer, the next certificate in chain.
+//
+// Parameters:
+//   - chain: A validated chain ordered from leaf to root
+//   - at: The verification time revocations are compared with
+//
+// Returns:
+//   - error: A *RevocationError for a revoked certificate, an error matching
+//     ErrRevocationUnknown in hard-fail mode, or nil
+func (c *CRLChecker) CheckChain(chain []*x509.Certificate, at time.Time) error {
+	return checkChainRevocation(context.Background(), chain, at, c.HardFail, c)
+}
+
+// revocationStatus returns the status of cert according to the current base
+// CRL of issuer and, when available, its delta CRL
+func (c *CRLChecker) revocationStatus(ctx context.Context, cert, issuer *x509.Certificate) (*certificateStatus, error) {
+	base, err := c.baseCRL(ctx, cert, issuer)
+	if err != nil {
+		return nil, err
+	}
+	entry := findCRLEntry(base, cert.SerialNumber)
+
+	if delta := c.deltaCRL(ctx, cert, issuer, base); delta != nil {
+		if deltaEntry := findCRLEntry(delta, cert.SerialNumber); deltaEntry != nil {
+			entry = deltaEntry
+			if deltaEntry.ReasonCode == crlReasonRemoveFromCRL {
+				entry = nil
+			}
+		}
+	}
+
+	if entry == nil {
+		return &certificateStatus{}, nil
+	}
+	return &certificateStatus{revoked: true, revokedAt: entry.RevocationTime, reason: entry.ReasonCode}, nil
+}
+
+// baseCRL returns a current complete CRL for cert, preferring local CRLs
+func (c *CRLChecker) baseCRL(ctx context.Context, cert, issuer *x509.Certificate) (*x509.RevocationList, error) {
+	if crl := c.localCRL(issuer, func(crl *x509.RevocationList) bool { return !isDeltaCRL(crl) }); crl != nil {
+		return crl, nil
+	}
+	if len(cert.CRLDistributionPoints) == 0 {
+		return nil, errors.New("certificate names no CRL distribution point")
+	}
+
+	var lastErr error
+	for _, url := range cert.CRLDistributionPoints {
+		crl, err := c.download(ctx, url, issuer)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if crl == nil {
+			continue
+		}
+		if isDeltaCRL(crl) {
+			lastErr = fmt.Errorf("CRL from %q is a delta CRL", url)
+			continue
+		}
+		return crl, nil
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no CRL is available for the certificate")
+	}
+	return nil, lastErr
+}
+
+// deltaCRL returns a current delta CRL that applies to base, or nil. Delta
+// CRLs are optional: download failures leave the base CRL authoritative.
+func (c *CRLChecker) deltaCRL(ctx context.Context, cert, issuer *x509.Certificate, base *x509.RevocationList) *x509.RevocationList {
+	applies := func(crl *x509.RevocationList) bool {
+		baseNumber, ok := deltaCRLBase(crl)
+		return ok && base.Number != nil && crl.Number != nil &&
+			baseNumber.Cmp(base.Number) <= 0 && crl.Number.Cmp(base.Number) > 0
+	}
+	if crl := c.localCRL(issuer, applies); crl != nil {
+		return crl
+	}
+
+	urls := freshestCRLURLs(cert.Extensions)
+	urls = append(urls, freshestCRLURLs(base.Extensions)...)
+	for _, url := range urls {
+		crl, err := c.download(ctx, url, issuer)
+		if err == nil && crl != nil && applies(crl) {
+			return crl
+		}
+	}
+	return nil
+}
+
+// localCRL returns the most recent local CRL issued by issuer that is
+// current, correctly signed and accepted by match
+func (c *CRLChecker) localCRL(issuer *x509.Certificate, match func(*x509.RevocationList) bool) *x509.RevocationList {
+	c.mu.Lock()
+	local := append([]*x509.RevocationList(nil), c.local...)
+	c.mu.Unlock()
+
+	var best *x509.RevocationList
+	for _, crl := range local {
+		if checkCRL(crl, issuer, time.Now()) != nil || !match(crl) {
+			continue
+		}
+		if best == nil || crl.ThisUpdate.After(best.ThisUpdate) {
+			best = crl
+		}
+	}
+	return best
+}
+
+// download returns the current CRL at url from the cache or the network. It
+// returns nil without error for unsupported URLs and while offline.
+func (c *CRLChecker) download(ctx context.Context, url string, issuer *x509.Certificate) (*x509.RevocationList, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, nil
+	}
+	c.mu.Lock()
+	cached, ok := c.cache[url]
+	c.mu.Unlock()
+	if ok && checkCRL(cached, issuer, time.Now()) == nil {
+		return cached, nil
+	}
+	if c.Offline {
+		return nil, nil
+	}
+
+	client := c.Client
+	if client == nil {
+		timeout := c.Timeout
+		if timeout <= 0 {
+			timeout = DefaultCRLTimeout
+		}
+		client = &http.Client{Timeout: timeout}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CRL URL %q: %w", url, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download CRL from %q: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download CRL from %q: %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCRLSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download CRL from %q: %w", url, err)
+	}
+	if len(body) > maxCRLSize {
+		return nil, fmt.Errorf("CRL from %q exceeds %d bytes", url, maxCRLSize)
+	}
+
+	crl, err := x509.ParseRevocationList(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CRL from %q: %w", url, err)
+	}
+	if err := checkCRL(crl, issuer, time.Now()); err != nil {
+		return nil, fmt.Errorf("invalid CRL from %q: %w", url, err)
+	}
+
+	c.mu.Lock()
+	if c.cache == nil {
+		c.cache = make(map[string]*x509.RevocationList)
+	}
+	c.cache[url] = crl
+	c.mu.Unlock()
+	return crl, nil
+}
+
+// checkCRL requires crl to be issued and signed by issuer and current at now
+func checkCRL(crl *x509.RevocationList, issuer *x509.Certificate, now time.Time) error {
+	if !bytes.Equal(crl.RawIssuer, issuer.RawSubject) {
+		return errors.New("CRL was not issued by the certificate issuer")
+	}
+	if err := crl.CheckSignatureFrom(issuer); err != nil {
+		return fmt.Errorf("bad CRL signature: %w", err)
+	}
+	if crl.ThisUpdate.After(now.Add(revocationClockSkew)) {
+		return errors.New("CRL is not yet valid")
+	}
+	if !crl.NextUpdate.IsZero() && crl.NextUpdate.Before(now.Add(-revocationClockSkew)) {
+		return errors.New("CRL is stale")
+	}
+	return nil
+}
+
+// findCRLEntry returns the entry of crl for serial, or nil
+func findCRLEntry(crl *x509.RevocationList, serial *big.Int) *x509.RevocationListEntry {
+	for i := range crl.RevokedCertificateEntries {
+		if crl.RevokedCertificateEntries[i].SerialNumber.Cmp(serial) == 0 {
+			return &crl.RevokedCertificateEntries[i]
+		}
+	}
+	return nil
+}
+
+// isDeltaCRL reports whether crl carries the delta CRL indicator
+func isDeltaCRL(crl *x509.RevocationList) bool {
+	_, ok := deltaCRLBase(crl)
+	return ok
+}
+
+// deltaCRLBase returns the base CRL number of a delta CRL
+func deltaCRLBase(crl *x509.RevocationList) (*big.Int, bool) {
+	for _, ext := range crl.Extensions {
+		if !ext.Id.Equal(oidExtensionDeltaCRLIndicator) {
+			continue
+		}
+		var base *big.Int
+		if _, err := asn1.Unmarshal(ext.Value, &base); err != nil {
+			return nil, false
+		}
+		return base, true
+	}
+	return nil, false
+}
+
+// freshestCRLURLs returns the URIs of the freshest CRL extension in exts
+func freshestCRLURLs(exts []pkix.Extension) []string {
+	var urls []string
+	for _, ext := range exts {
+		if !ext.Id.Equal(oidExtensionFreshestCRL) {
+			continue
+		}
+		var points []distributionPoint
+		if _, err := asn1.Unmarshal(ext.Value, &points); err != nil {
+			continue
+		}
+		for _, point := range points {
+			for _, name := range point.DistributionPoint.FullName {
+				if name.Class == asn1.ClassContextSpecific && name.Tag == 6 {
+					urls = append(urls, string(name.Bytes))
+				}
+			}
+		}
+	}
+	return urls
+}
@@ -0,0 +1,253 @@
+package sigtool
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// crlForTest returns a DER CRL issued by issuer. A non-nil baseNumber makes
+// it a delta CRL of that base.
+func crlForTest(t *testing.T, issuer *testIdentity, number int64, baseNumber *big.Int, entries ...x509.RevocationListEntry) []byte {
+	t.Helper()
+
+	template := &x509.RevocationList{
+		Number:                    big.NewInt(number),
+		ThisUpdate:                time.Now().Add(-time.Hour),
+		NextUpdate:                time.Now().Add(time.Hour),
+		RevokedCertificateEntries: entries,
+	}
+	if baseNumber != nil {
+		value, err := asn1.Marshal(baseNumber)
+		if err != nil {
+			t.Fatalf("Failed to marshal delta CRL indicator: %v", err)
+		}
+		template.ExtraExtensions = []pkix.Extension{{Id: oidExtensionDeltaCRLIndicator, Critical: true, Value: value}}
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, template, issuer.Cert, issuer.Key)
+	if err != nil {
+		t.Fatalf("Failed to create CRL: %v", err)
+	}
+	return der
+}
+
+// freshestCRLExtensionForTest returns a freshest CRL extension naming url
+func freshestCRLExtensionForTest(t *testing.T, url string) pkix.Extension {
+	t.Helper()
+
+	value, err := asn1.Marshal([]distributionPoint{{
+		DistributionPoint: distributionPointName{
+			FullName: []asn1.RawValue{{Class: asn1.ClassContextSpecific, Tag: 6, Bytes: []byte(url)}},
+		},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to marshal freshest CRL extension: %v", err)
+	}
+	return pkix.Extension{Id: oidExtensionFreshestCRL, Value: value}
+}
+
+// serveBytes returns a server answering every request with *body
+func serveBytes(t *testing.T, body *[]byte, requests *int32) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		if *body == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pkix-crl")
+		_, _ = w.Write(*body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func revokedEntry(serial *big.Int, at time.Time, reason int) x509.RevocationListEntry {
+	return x509.RevocationListEntry{SerialNumber: serial, RevocationTime: at, ReasonCode: reason}
+}
+
+func TestVerify_CRLDistributionPoint(t *testing.T) {
+	root := issueCertificateForTest(t, testCATemplate("crl root", 1), nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Cert)
+
+	var crl []byte
+	var requests int32
+	server := serveBytes(t, &crl, &requests)
+	template := testLeafTemplate("crl signer", 2, x509.ExtKeyUsageCodeSigning)
+	template.CRLDistributionPoints = []string{"ldap://ignored.example", server.URL + "/root.crl"}
+	leaf := issueCertificateForTest(t, template, root)
+	filePath := createSignedMockPEAs(t, leaf, crypto.SHA256)
+
+	crl = crlForTest(t, root, 1, nil, revokedEntry(big.NewInt(99), time.Now().Add(-time.Hour), 0))
+	checker := NewCRLChecker(time.Second, true)
+	if err := Verify(filePath, &VerifyOptions{Roots: roots, CRL: checker}); err != nil {
+		t.Fatalf("Expected unlisted signer to verify, got: %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{Roots: roots, CRL: checker}); err != nil {
+		t.Fatalf("Expected cached CRL to verify, got: %v", err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("Expected 1 CRL download thanks to the cache, got %d", got)
+	}
+
+	crl = crlForTest(t, root, 2, nil, revokedEntry(leaf.Cert.SerialNumber, time.Now().Add(-10*time.Minute), 1))
+	err := Verify(filePath, &VerifyOptions{Roots: roots, CRL: NewCRLChecker(time.Second, false)})
+	var revocation *RevocationError
+	if !errors.Is(err, ErrCertificateRevoked) || !errors.As(err, &revocation) || revocation.Reason != 1 {
+		t.Errorf("Expected *RevocationError with reason keyCompromise, got: %v", err)
+	}
+}
+
+func TestVerifyContext_CRLCancelled(t *testing.T) {
+	root := issueCertificateForTest(t, testCATemplate("crl root", 1), nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Cert)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	t.Cleanup(server.Close)
+	template := testLeafTemplate("crl signer", 2, x509.ExtKeyUsageCodeSigning)
+	template.CRLDistributionPoints = []string{server.URL + "/root.crl"}
+	leaf := issueCertificateForTest(t, template, root)
+	filePath := createSignedMockPEAs(t, leaf, crypto.SHA256)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := VerifyContext(ctx, filePath, VerifyOptions{Roots: roots, CRL: NewCRLChecker(time.Minute, true)})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline to abort the CRL download, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the CRL download to stop at the deadline, took %v", elapsed)
+	}
+}
+
+func TestVerify_LocalCRLFile(t *testing.T) {
+	root := issueCertificateForTest(t, testCATemplate("crl root", 1), nil)
+	other := issueCertificateForTest(t, testCATemplate("other root", 1), nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Cert)
+	leaf := issueCertificateForTest(t, testLeafTemplate("crl signer", 2, x509.ExtKeyUsageCodeSigning), root)
+	filePath := createSignedMockPEAs(t, leaf, crypto.SHA256)
+
+	// A CRL from another issuer does not determine the status
+	checker := &CRLChecker{HardFail: true, Offline: true}
+	if err := checker.AddCRL(crlForTest(t, other, 1, nil, revokedEntry(leaf.Cert.SerialNumber, time.Now().Add(-time.Hour), 0))); err != nil {
+		t.Fatalf("Failed to add CRL: %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{Roots: roots, CRL: checker}); !errors.Is(err, ErrRevocationUnknown) {
+		t.Errorf("Expected ErrRevocationUnknown without a CRL from the issuer, got: %v", err)
+	}
+
+	crlPath := filepath.Join(t.TempDir(), "root.crl")
+	der := crlForTest(t, root, 1, nil, revokedEntry(leaf.Cert.SerialNumber, time.Now().Add(-time.Hour), 0))
+	if err := os.WriteFile(crlPath, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0600); err != nil {
+		t.Fatalf("Failed to write CRL: %v", err)
+	}
+	if err := checker.LoadCRLFile(crlPath); err != nil {
+		t.Fatalf("Failed to load CRL file: %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{Roots: roots, CRL: checker}); !errors.Is(err, ErrCertificateRevoked) {
+		t.Errorf("Expected ErrCertificateRevoked from the local CRL, got: %v", err)
+	}
+
+	if err := checker.LoadCRLFile(filePath); err == nil {
+		t.Error("Expected error loading a non-CRL file, got nil")
+	}
+}
+
+func TestCRLChecker_DeltaCRL(t *testing.T) {
+	root := issueCertificateForTest(t, testCATemplate("crl root", 1), nil)
+	leaf := issueCertificateForTest(t, testLeafTemplate("crl signer", 2, x509.ExtKeyUsageCodeSigning), root)
+	chain := []*x509.Certificate{leaf.Cert, root.Cert}
+	revokedAt := time.Now().Add(-time.Hour)
+
+	checker := &CRLChecker{Offline: true}
+	if err := checker.AddCRL(crlForTest(t, root, 10, nil)); err != nil {
+		t.Fatalf("Failed to add base CRL: %v", err)
+	}
+	if err := checker.CheckChain(chain, time.Now()); err != nil {
+		t.Fatalf("Expected unlisted certificate to pass, got: %v", err)
+	}
+	if err := checker.AddCRL(crlForTest(t, root, 11, big.NewInt(10), revokedEntry(leaf.Cert.SerialNumber, revokedAt, 0))); err != nil {
+		t.Fatalf("Failed to add delta CRL: %v", err)
+	}
+	if err := checker.CheckChain(chain, time.Now()); !errors.Is(err, ErrCertificateRevoked) {
+		t.Errorf("Expected delta CRL revocation, got: %v", err)
+	}
+
+	// A certificate on hold in the base CRL is reinstated by removeFromCRL
+	onHold := &CRLChecker{Offline: true}
+	_ = onHold.AddCRL(crlForTest(t, root, 20, nil, revokedEntry(leaf.Cert.SerialNumber, revokedAt, 6)))
+	if err := onHold.CheckChain(chain, time.Now()); !errors.Is(err, ErrCertificateRevoked) {
+		t.Errorf("Expected certificate on hold to be revoked, got: %v", err)
+	}
+	_ = onHold.AddCRL(crlForTest(t, root, 21, big.NewInt(20), revokedEntry(leaf.Cert.SerialNumber, revokedAt, crlReasonRemoveFromCRL)))
+	if err := onHold.CheckChain(chain, time.Now()); err != nil {
+		t.Errorf("Expected removeFromCRL to reinstate the certificate, got: %v", err)
+	}
+}
+
+func TestCRLChecker_FreshestCRL(t *testing.T) {
+	root := issueCertificateForTest(t, testCATemplate("crl root", 1), nil)
+
+	var base, delta []byte
+	var requests int32
+	baseServer := serveBytes(t, &base, &requests)
+	deltaServer := serveBytes(t, &delta, &requests)
+	template := testLeafTemplate("crl signer", 2, x509.ExtKeyUsageCodeSigning)
+	template.CRLDistributionPoints = []string{baseServer.URL}
+	template.ExtraExtensions = []pkix.Extension{freshestCRLExtensionForTest(t, deltaServer.URL)}
+	leaf := issueCertificateForTest(t, template, root)
+	chain := []*x509.Certificate{leaf.Cert, root.Cert}
+
+	base = crlForTest(t, root, 5, nil)
+	delta = crlForTest(t, root, 6, big.NewInt(5), revokedEntry(leaf.Cert.SerialNumber, time.Now().Add(-time.Hour), 0))
+	if err := NewCRLChecker(time.Second, true).CheckChain(chain, time.Now()); !errors.Is(err, ErrCertificateRevoked) {
+		t.Errorf("Expected revocation from the freshest CRL, got: %v", err)
+	}
+
+	// A delta CRL for an older base does not apply
+	delta = crlForTest(t, root, 4, big.NewInt(3), revokedEntry(leaf.Cert.SerialNumber, time.Now().Add(-time.Hour), 0))
+	if err := NewCRLChecker(time.Second, true).CheckChain(chain, time.Now()); err != nil {
+		t.Errorf("Expected outdated delta CRL to be ignored, got: %v", err)
+	}
+}
+
+func TestVerify_OCSPFallsBackToCRL(t *testing.T) {
+	roots, leaf, responder := ocspChainForTest(t)
+	responder.fail = true
+	filePath := createSignedMockPEAs(t, leaf, crypto.SHA256)
+
+	err := Verify(filePath, &VerifyOptions{Roots: roots, OCSP: NewOCSPChecker(time.Second, true)})
+	if !errors.Is(err, ErrRevocationUnknown) {
+		t.Fatalf("Expected ErrRevocationUnknown with OCSP blocked, got: %v", err)
+	}
+
+	crls := &CRLChecker{Offline: true}
+	if err := crls.AddCRL(crlForTest(t, responder.issuer, 1, nil)); err != nil {
+		t.Fatalf("Failed to add CRL: %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{Roots: roots, OCSP: NewOCSPChecker(time.Second, true), CRL: crls}); err != nil {
+		t.Errorf("Expected CRL to determine the status when OCSP is blocked, got: %v", err)
+	}
+}
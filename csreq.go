@@ -0,0 +1,428 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Code requirement blob magic numbers and the designated requirement type
+const (
+	csMagicRequirement  = 0xfade0c00
+	csMagicRequirements = 0xfade0c01
+	csRequirementExpr   = 1
+	csDesignatedReq     = 3
+	// maxRequirementDepth bounds the nesting of requirement expressions
+	maxRequirementDepth = 64
+)
+
+// Requirement expression opcodes, as compiled by csreq
+const (
+	reqOpFalse              = 0
+	reqOpTrue               = 1
+	reqOpIdent              = 2
+	reqOpAppleAnchor        = 3
+	reqOpAnchorHash         = 4
+	reqOpAnd                = 6
+	reqOpOr                 = 7
+	reqOpCDHash             = 8
+	reqOpNot                = 9
+	reqOpCertField          = 11
+	reqOpCertGeneric        = 14
+	reqOpAppleGenericAnchor = 15
+	reqOpCertPolicy         = 17
+	reqOpPlatform           = 20
+	reqOpFlagMask           = 0xff000000
+)
+
+// Requirement match operations
+const (
+	reqMatchExists     = 0
+	reqMatchEqual      = 1
+	reqMatchContains   = 2
+	reqMatchBeginsWith = 3
+	reqMatchEndsWith   = 4
+	reqMatchLess       = 5
+	reqMatchGreater    = 6
+	reqMatchLessEq     = 7
+	reqMatchGreaterEq  = 8
+	reqMatchAbsent     = 14
+)
+
+// appleRootHashes holds the SHA-256 fingerprints of the Apple root
+// certificates that "anchor apple" and "anchor apple generic" name: Apple
+// Root CA and Apple Root CA - G3
+var appleRootHashes = map[[sha256.Size]byte]bool{
+	{0xb0, 0xb1, 0x73, 0x0e, 0xcb, 0xc7, 0xff, 0x45, 0x05, 0x14, 0x2c, 0x49, 0xf1, 0x29, 0x5e, 0x6e, 0xda, 0x6b, 0xca, 0xed, 0x7e, 0x2c, 0x68, 0xc5, 0xbe, 0x91, 0xb5, 0xa1, 0x10, 0x01, 0xf0, 0x24}: true,
+	{0x63, 0x34, 0x3a, 0xbf, 0xb8, 0x9a, 0x6a, 0x03, 0xeb, 0xb5, 0x7e, 0x9b, 0x3f, 0x5f, 0xa7, 0xbe, 0x7c, 0x4f, 0x5c, 0x75, 0x6f, 0x30, 0x17, 0xb3, 0xa8, 0xc4, 0x88, 0xc3, 0x65, 0x3e, 0x91, 0x79}: true,
+}
+
+// certFieldOIDs maps the certificate fields requirements name, such as
+// subject.OU, to their attribute types
+var certFieldOIDs = map[string]asn1.ObjectIdentifier{
+	"CN":     {2, 5, 4, 3},
+	"C":      {2, 5, 4, 6},
+	"L":      {2, 5, 4, 7},
+	"ST":     {2, 5, 4, 8},
+	"STREET": {2, 5, 4, 9},
+	"O":      {2, 5, 4, 10},
+	"OU":     {2, 5, 4, 11},
+	"E":      {1, 2, 840, 113549, 1, 9, 1},
+	"EMAIL":  {1, 2, 840, 113549, 1, 9, 1},
+}
+
+// requirementContext is what a code requirement is evaluated against: the
+// code directories of a slice and the certificate chain of its signer,
+// leaf first
+type requirementContext struct {
+	directories []*codeDirectory
+	chain       []*x509.Certificate
+}
+
+// designatedRequirement returns the designated requirement of the
+// requirement set blob, or nil when it has none
+func designatedRequirement(set []byte) ([]byte, error) {
+	if len(set) < 12 || binary.BigEndian.Uint32(set) != csMagicRequirements {
+		return nil, errors.New("not a requirement set")
+	}
+	count := int64(binary.BigEndian.Uint32(set[8:]))
+	if 12+8*count > int64(len(set)) {
+		return nil, fmt.Errorf("%w: requirement set index of %d entries", ErrSignatureTruncated, count)
+	}
+	for i := int64(0); i < count; i++ {
+		entry := set[12+8*i:]
+		if binary.BigEndian.Uint32(entry) != csDesignatedReq {
+			continue
+		}
+		blob, err := codeSigningBlob(set, binary.BigEndian.Uint32(entry[4:]))
+		if err != nil {
+			return nil, err
+		}
+		if binary.BigEndian.Uint32(blob) != csMagicRequirement || len(blob) < 12 {
+			return nil, errors.New("designated requirement is not a requirement blob")
+		}
+		if kind := binary.BigEndian.Uint32(blob[8:]); kind != csRequirementExpr {
+			return nil, fmt.Errorf("unsupported requirement kind %d", kind)
+		}
+		return blob[12:], nil
+	}
+	return nil, nil
+}
+
+// evaluateRequirement evaluates the compiled requirement expression expr
+// against ctx, failing with ErrRequirementNotSatisfied when it is false
+func evaluateRequirement(expr []byte, ctx *requirementContext) error {
+	r := &requirementReader{data: expr}
+	ok, err := r.eval(ctx, 0)
+	if err != nil {
+		return fmt.Errorf("failed to evaluate designated requirement: %w", err)
+	}
+	if !ok {
+		return ErrRequirementNotSatisfied
+	}
+	return nil
+}
+
+// requirementReader reads the operands of a compiled requirement
+type requirementReader struct {
+	data []byte
+	off  int
+}
+
+// uint32 reads a big-endian 32-bit operand
+func (r *requirementReader) uint32() (uint32, error) {
+	if r.off+4 > len(r.data) {
+		return 0, fmt.Errorf("%w: requirement expression", ErrSignatureTruncated)
+	}
+	v := binary.BigEndian.Uint32(r.data[r.off:])
+	r.off += 4
+	return v, nil
+}
+
+// bytes reads a length-prefixed operand, padded to four bytes
+func (r *requirementReader) bytes() ([]byte, error) {
+	n, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if int64(n) > int64(len(r.data)-r.off) {
+		return nil, fmt.Errorf("%w: requirement expression", ErrSignatureTruncated)
+	}
+	v := r.data[r.off : r.off+int(n)]
+	r.off = min(len(r.data), r.off+int(n+3)&^3)
+	return v, nil
+}
+
+// eval evaluates the next expression. Both operands of and and or are
+// always read, so a false left operand does not leave the right unread.
+func (r *requirementReader) eval(ctx *requirementContext, depth int) (bool, error) {
+	if depth > maxRequirementDepth {
+		return false, errors.New("requirement expression is nested too deeply")
+	}
+	op, err := r.uint32()
+	if err != nil {
+		return false, err
+	}
+	switch op &^ reqOpFlagMask {
+	case reqOpFalse:
+		return false, nil
+	case reqOpTrue:
+		return true, nil
+	case reqOpIdent:
+		ident, err := r.bytes()
+		if err != nil {
+			return false, err
+		}
+		return string(ident) == ctx.directories[0].identifier, nil
+	case reqOpAppleAnchor, reqOpAppleGenericAnchor:
+		anchor := ctx.anchor()
+		return anchor != nil && appleRootHashes[sha256.Sum256(anchor.Raw)], nil
+	case reqOpAnchorHash:
+		cert, err := r.certificate(ctx)
+		if err != nil {
+			return false, err
+		}
+		hash, err := r.bytes()
+		if err != nil {
+			return false, err
+		}
+		if cert == nil {
+			return false, nil
+		}
+		sum := sha1.Sum(cert.Raw)
+		return subtle.ConstantTimeCompare(sum[:], hash) == 1, nil
+	case reqOpAnd, reqOpOr:
+		left, err := r.eval(ctx, depth+1)
+		if err != nil {
+			return false, err
+		}
+		right, err := r.eval(ctx, depth+1)
+		if err != nil {
+			return false, err
+		}
+		if op&^reqOpFlagMask == reqOpAnd {
+			return left && right, nil
+		}
+		return left || right, nil
+	case reqOpNot:
+		v, err := r.eval(ctx, depth+1)
+		return !v, err
+	case reqOpCDHash:
+		hash, err := r.bytes()
+		if err != nil {
+			return false, err
+		}
+		for _, cd := range ctx.directories {
+			if cdhash := cd.cdhash(); cdhash != nil && bytes.Equal(cdhash, hash) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case reqOpCertField:
+		cert, err := r.certificate(ctx)
+		if err != nil {
+			return false, err
+		}
+		field, err := r.bytes()
+		if err != nil {
+			return false, err
+		}
+		values, err := certificateField(cert, string(field))
+		if err != nil {
+			return false, err
+		}
+		return r.match(values)
+	case reqOpCertGeneric, reqOpCertPolicy:
+		cert, err := r.certificate(ctx)
+		if err != nil {
+			return false, err
+		}
+		oid, err := r.bytes()
+		if err != nil {
+			return false, err
+		}
+		present := cert != nil && certificateHasOID(cert, oid, op&^reqOpFlagMask == reqOpCertPolicy)
+		match, err := r.uint32()
+		if err != nil {
+			return false, err
+		}
+		switch match {
+		case reqMatchExists:
+			return present, nil
+		case reqMatchAbsent:
+			return !present, nil
+		}
+		return false, fmt.Errorf("unsupported certificate extension match %d", match)
+	case reqOpPlatform:
+		platform, err := r.uint32()
+		if err != nil {
+			return false, err
+		}
+		return uint32(ctx.directories[0].platform) == platform, nil
+	}
+	return false, fmt.Errorf("unsupported requirement opcode %d", op&^reqOpFlagMask)
+}
+
+// certificate reads a certificate index, counted from the leaf when
+// non-negative and from the anchor when negative, and returns that
+// certificate of the chain or nil when there is none
+func (r *requirementReader) certificate(ctx *requirementContext) (*x509.Certificate, error) {
+	v, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+	index := int(int32(v))
+	if index < 0 {
+		if ctx.anchor() == nil {
+			return nil, nil
+		}
+		index += len(ctx.chain)
+	}
+	if index < 0 || index >= len(ctx.chain) {
+		return nil, nil
+	}
+	return ctx.chain[index], nil
+}
+
+// match reads a match operation and applies it to values, true when any
+// value matches
+func (r *requirementReader) match(values []string) (bool, error) {
+	op, err := r.uint32()
+	if err != nil {
+		return false, err
+	}
+	switch op {
+	case reqMatchExists:
+		return len(values) > 0, nil
+	case reqMatchAbsent:
+		return len(values) == 0, nil
+	case reqMatchEqual, reqMatchContains, reqMatchBeginsWith, reqMatchEndsWith,
+		reqMatchLess, reqMatchGreater, reqMatchLessEq, reqMatchGreaterEq:
+	default:
+		return false, fmt.Errorf("unsupported requirement match %d", op)
+	}
+	operand, err := r.bytes()
+	if err != nil {
+		return false, err
+	}
+	want := string(operand)
+	for _, v := range values {
+		var ok bool
+		switch op {
+		case reqMatchEqual:
+			ok = v == want
+		case reqMatchContains:
+			ok = strings.Contains(v, want)
+		case reqMatchBeginsWith:
+			ok = strings.HasPrefix(v, want)
+		case reqMatchEndsWith:
+			ok = strings.HasSuffix(v, want)
+		case reqMatchLess:
+			ok = v < want
+		case reqMatchGreater:
+			ok = v > want
+		case reqMatchLessEq:
+			ok = v <= want
+		case reqMatchGreaterEq:
+			ok = v >= want
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// anchor returns the self-signed certificate ending the chain, or nil when
+// the chain does not reach one
+func (ctx *requirementContext) anchor() *x509.Certificate {
+	if len(ctx.chain) == 0 {
+		return nil
+	}
+	if last := ctx.chain[len(ctx.chain)-1]; isSelfSigned(last) {
+		return last
+	}
+	return nil
+}
+
+// certificateField returns the values of a subject or issuer attribute of
+// cert named as in requirements, such as subject.CN, or none when cert is
+// nil
+func certificateField(cert *x509.Certificate, field string) ([]string, error) {
+	part, attr, ok := strings.Cut(field, ".")
+	oid, known := certFieldOIDs[strings.ToUpper(attr)]
+	if !ok || !known || (part != "subject" && part != "issuer") {
+		return nil, fmt.Errorf("unsupported certificate field %q", field)
+	}
+	if cert == nil {
+		return nil, nil
+	}
+	name := cert.Subject
+	if part == "issuer" {
+		name = cert.Issuer
+	}
+	var values []string
+	for _, atv := range name.Names {
+		if s, ok := atv.Value.(string); ok && atv.Type.Equal(oid) {
+			values = append(values, s)
+		}
+	}
+	return values, nil
+}
+
+// certificateHasOID reports whether cert has the extension, or the policy
+// when policy is set, whose object identifier has the DER contents oid
+func certificateHasOID(cert *x509.Certificate, oid []byte, policy bool) bool {
+	der, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagOID, Bytes: oid})
+	if err != nil {
+		return false
+	}
+	var id asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(der, &id); err != nil {
+		return false
+	}
+	if policy {
+		for _, p := range cert.PolicyIdentifiers {
+			if p.Equal(id) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// signerChain returns the certificate path from signer through the
+// certificates embedded with it, ending at a self-signed certificate when
+// they include one. Signatures are checked with CheckSignature, which still
+// accepts the SHA-1 signatures of the older Apple certificates.
+func signerChain(signer *x509.Certificate, certs []*x509.Certificate) []*x509.Certificate {
+	chain := []*x509.Certificate{signer}
+	for cur := signer; !isSelfSigned(cur) && len(chain) <= len(certs); {
+		var issuer *x509.Certificate
+		for _, c := range certs {
+			if bytes.Equal(c.RawSubject, cur.RawIssuer) && c.CheckSignature(cur.SignatureAlgorithm, cur.RawTBSCertificate, cur.Signature) == nil {
+				issuer = c
+				break
+			}
+		}
+		if issuer == nil {
+			break
+		}
+		chain = append(chain, issuer)
+		cur = issuer
+	}
+	return chain
+}
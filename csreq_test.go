@@ -0,0 +1,88 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// reqForTest returns the requirement expression op with its operands
+func reqForTest(op uint32, operands ...[]byte) []byte {
+	return append(binary.BigEndian.AppendUint32(nil, op), bytes.Join(operands, nil)...)
+}
+
+// reqDataForTest returns s as a length-prefixed requirement operand
+func reqDataForTest(s string) []byte {
+	data := binary.BigEndian.AppendUint32(nil, uint32(len(s)))
+	data = append(data, s...)
+	return append(data, make([]byte, (4-len(s)%4)%4)...)
+}
+
+// reqIntForTest returns v as a requirement operand
+func reqIntForTest(v int32) []byte {
+	return binary.BigEndian.AppendUint32(nil, uint32(v))
+}
+
+func TestEvaluateRequirement(t *testing.T) {
+	id, root := machoIdentityForTest(t)
+	cd, err := parseCodeDirectory(codeDirectoryForTest([]byte("code"), crypto.SHA256, nil))
+	if err != nil {
+		t.Fatalf("parseCodeDirectory failed: %v", err)
+	}
+	ctx := &requirementContext{directories: []*codeDirectory{cd}, chain: signerChain(id.Cert, append(id.Chain, root))}
+	if len(ctx.chain) != 3 || ctx.anchor() != root {
+		t.Fatalf("Expected the chain to reach the root, got %d certificates", len(ctx.chain))
+	}
+
+	tests := []struct {
+		name string
+		expr []byte
+		want bool
+	}{
+		{"true", reqForTest(reqOpTrue), true},
+		{"not", reqForTest(reqOpNot, reqForTest(reqOpTrue)), false},
+		{"or", reqForTest(reqOpOr, reqForTest(reqOpFalse), reqForTest(reqOpIdent, reqDataForTest("com.example.hello"))), true},
+		{"other identifier", reqForTest(reqOpIdent, reqDataForTest("com.example.other")), false},
+		{"cdhash", reqForTest(reqOpCDHash, reqDataForTest(string(cd.cdhash()))), true},
+		{"anchor common name", reqForTest(reqOpCertField, reqIntForTest(-1), reqDataForTest("subject.CN"), reqIntForTest(reqMatchBeginsWith), reqDataForTest("sigtool test Apple")), true},
+		{"intermediate organization", reqForTest(reqOpCertField, reqIntForTest(1), reqDataForTest("subject.O"), reqIntForTest(reqMatchContains), reqDataForTest("tool")), true},
+		{"missing certificate", reqForTest(reqOpCertField, reqIntForTest(5), reqDataForTest("subject.CN"), reqIntForTest(reqMatchExists)), false},
+		{"leaf marker", reqForTest(reqOpCertGeneric, reqIntForTest(0), reqDataForTest("\x2a\x86\x48\x86\xf7\x63\x64\x06\x01\x0d"), reqIntForTest(reqMatchExists)), true},
+		{"leaf without CA marker", reqForTest(reqOpCertGeneric, reqIntForTest(0), reqDataForTest("\x2a\x86\x48\x86\xf7\x63\x64\x06\x02\x06"), reqIntForTest(reqMatchAbsent)), true},
+		{"apple anchor", reqForTest(reqOpAppleGenericAnchor), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := evaluateRequirement(tt.expr, ctx)
+			if tt.want && err != nil {
+				t.Errorf("Expected the requirement to be satisfied, got %v", err)
+			}
+			if !tt.want && !errors.Is(err, ErrRequirementNotSatisfied) {
+				t.Errorf("Expected ErrRequirementNotSatisfied, got %v", err)
+			}
+		})
+	}
+}
+
+func TestEvaluateRequirement_Errors(t *testing.T) {
+	cd, err := parseCodeDirectory(codeDirectoryForTest([]byte("code"), crypto.SHA256, nil))
+	if err != nil {
+		t.Fatalf("parseCodeDirectory failed: %v", err)
+	}
+	ctx := &requirementContext{directories: []*codeDirectory{cd}}
+	tests := map[string][]byte{
+		"truncated":          reqForTest(reqOpAnd, reqForTest(reqOpTrue)),
+		"unsupported opcode": reqForTest(21),
+		"long operand":       reqForTest(reqOpIdent, reqIntForTest(64)),
+		"unknown field":      reqForTest(reqOpCertField, reqIntForTest(0), reqDataForTest("subject.XX"), reqIntForTest(reqMatchExists)),
+	}
+	for name, expr := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := evaluateRequirement(expr, ctx); err == nil || errors.Is(err, ErrRequirementNotSatisfied) {
+				t.Errorf("Expected an evaluation error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package sigtool
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/md5"  // #nosec G501 - dpkg-sig records MD5 digests alongside SHA-1
+	"crypto/sha1" // #nosec G505 - dpkg-sig records SHA-1 digests of the package members
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Debian packages are ar archives of debian-binary, control.tar.* and
+// data.tar.*, followed by any _gpg* signature members debsigs or dpkg-sig
+// add
+const (
+	arMagic      = "!<arch>\n"
+	arHeaderSize = 60
+	// debSignaturePrefix starts the names of signature members, such as
+	// _gpgorigin, _gpgbuilder and _gpgmaint
+	debSignaturePrefix = "_gpg"
+)
+
+// arMember locates the data of a member of an ar archive
+type arMember struct {
+	name         string
+	offset, size int64
+}
+
+// debPackage is a Debian binary package
+type debPackage struct {
+	r       io.ReaderAt
+	members []arMember
+}
+
+// isDebianPackage reports whether r is an ar archive whose first member
+// is debian-binary
+func isDebianPackage(r io.ReaderAt, size int64) bool {
+	if size < int64(len(arMagic))+arHeaderSize {
+		return false
+	}
+	header := make([]byte, len(arMagic)+len("debian-binary"))
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return false
+	}
+	return string(header) == arMagic+"debian-binary"
+}
+
+// openDebianPackage reads the member table of the Debian package r
+func openDebianPackage(r io.ReaderAt, size int64) (*debPackage, error) {
+	if !isDebianPackage(r, size) {
+		return nil, errors.New("not a Debian package")
+	}
+	pkg := &debPackage{r: r}
+	header := make([]byte, arHeaderSize)
+	for offset := int64(len(arMagic)); offset < size; {
+		if size-offset < arHeaderSize {
+			return nil, fmt.Errorf("%w: ar member header at offset %d is truncated", ErrSignatureTruncated, offset)
+		}
+		if _, err := r.ReadAt(header, offset); err != nil {
+			return nil, fmt.Errorf("failed to read ar member header: %w", err)
+		}
+		if string(header[58:60]) != "`\n" {
+			return nil, fmt.Errorf("bad ar member header at offset %d", offset)
+		}
+		length, err := strconv.ParseInt(strings.TrimSpace(string(header[48:58])), 10, 64)
+		if err != nil || length < 0 || length > size-offset-arHeaderSize {
+			return nil, &SignatureBoundsError{Offset: offset, Length: length, FileSize: size, Reason: "ar member exceeds the file"}
+		}
+		// GNU ar terminates names with a slash
+		name := strings.TrimSuffix(strings.TrimRight(string(header[:16]), " "), "/")
+		pkg.members = append(pkg.members, arMember{name: name, offset: offset + arHeaderSize, size: length})
+		// Members are padded to an even offset
+		offset += arHeaderSize + length + length%2
+	}
+	if len(pkg.members) < 3 || !strings.HasPrefix(pkg.members[1].name, "control.tar") || !strings.HasPrefix(pkg.members[2].name, "data.tar") {
+		return nil, errors.New("Debian package does not start with debian-binary, control.tar and data.tar members")
+	}
+	return pkg, nil
+}
+
+// content returns a reader of the data of m
+func (p *debPackage) content(m arMember) *io.SectionReader {
+	return io.NewSectionReader(p.r, m.offset, m.size)
+}
+
+// signatureMembers returns the _gpg* members of p
+func (p *debPackage) signatureMembers() []arMember {
+	var members []arMember
+	for _, m := range p.members {
+		if strings.HasPrefix(m.name, debSignaturePrefix) {
+			members = append(members, m)
+		}
+	}
+	return members
+}
+
+// readSignatureMember returns the contents of the signature member m
+func (p *debPackage) readSignatureMember(m arMember) ([]byte, error) {
+	if m.size > MaxSignatureSize {
+		return nil, &SignatureSizeError{Size: m.size, Limit: MaxSignatureSize}
+	}
+	data := make([]byte, m.size)
+	if _, err := p.r.ReadAt(data, m.offset); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", m.name, err)
+	}
+	return data, nil
+}
+
+// debsigsContent returns the content debsigs signatures cover: the
+// debian-binary, control.tar and data.tar members concatenated
+func (p *debPackage) debsigsContent() io.Reader {
+	return io.MultiReader(p.content(p.members[0]), p.content(p.members[1]), p.content(p.members[2]))
+}
+
+// pgpSignatures returns the OpenPGP signatures of the signature members
+// of p
+func (p *debPackage) pgpSignatures() ([]*pgpSignature, error) {
+	var signatures []*pgpSignature
+	for _, m := range p.signatureMembers() {
+		data, err := p.readSignatureMember(m)
+		if err != nil {
+			return nil, err
+		}
+		var s []*pgpSignature
+		if isClearsigned(data) {
+			s, _, _, err = parseClearsigned(m.name, data)
+		} else {
+			s, err = parsePGPSignatures(m.name, data)
+		}
+		if err != nil {
+			return nil, err
+		}
+		signatures = append(signatures, s...)
+	}
+	if len(signatures) == 0 {
+		return nil, fmt.Errorf("%w (package has no _gpg signature member)", ErrNotSigned)
+	}
+	return signatures, nil
+}
+
+// readDebianSignature returns the contents of the first signature member
+// of the Debian package r
+func readDebianSignature(r io.ReaderAt, size int64) ([]byte, error) {
+	pkg, err := openDebianPackage(r, size)
+	if err != nil {
+		return nil, err
+	}
+	members := pkg.signatureMembers()
+	if len(members) == 0 {
+		return nil, fmt.Errorf("%w (package has no _gpg signature member)", ErrNotSigned)
+	}
+	return pkg.readSignatureMember(members[0])
+}
+
+// verifyDebian verifies the signature members of the Debian package r,
+// each of which must be by a key of opts.PGPKeyring. A debsigs member is a
+// detached signature over debian-binary, control.tar and data.tar; a
+// dpkg-sig member is a cleartext signed list of the MD5 and SHA-1 digests
+// of the members, which unless disabled must match them and cover the
+// three package members.
+func verifyDebian(r io.ReaderAt, size int64, opts VerifyOptions) error {
+	pkg, err := openDebianPackage(r, size)
+	if err != nil {
+		return fmt.Errorf("failed to extract signature: %w", err)
+	}
+	log := opts.logger()
+	members := pkg.signatureMembers()
+	if len(members) == 0 {
+		return fmt.Errorf("%w (package has no _gpg signature member)", ErrNotSigned)
+	}
+	var weak []WeakCryptoFinding
+	for _, m := range members {
+		data, err := pkg.readSignatureMember(m)
+		if err != nil {
+			return fmt.Errorf("failed to extract signature: %w", err)
+		}
+		var signatures []*pgpSignature
+		signed := pkg.debsigsContent
+		var manifest []byte
+		if isClearsigned(data) {
+			var text []byte
+			if signatures, text, manifest, err = parseClearsigned(m.name, data); err != nil {
+				return err
+			}
+			signed = func() io.Reader { return bytes.NewReader(text) }
+		} else if signatures, err = parsePGPSignatures(m.name, data); err != nil {
+			return err
+		}
+		key, findings, err := verifyPGPSignatures(signatures, opts.PGPKeyring, signed)
+		if err != nil {
+			return fmt.Errorf("%s signature: %w", m.name, err)
+		}
+		log.Debug("verified OpenPGP signature", "member", m.name, "key", key.PublicKey.KeyIdString(), "userID", pgpUserID(key.Entity))
+		weak = append(weak, findings...)
+		if manifest == nil {
+			continue
+		}
+		// The dpkg-sig manifest binds the members by SHA-1
+		weak = append(weak, WeakCryptoFinding{Kind: WeakFileDigest, Detail: crypto.SHA1.String()})
+		if !opts.SkipContentDigest {
+			if err := pkg.verifyManifest(m.name, manifest); err != nil {
+				return err
+			}
+		}
+	}
+	if opts.RejectWeakCrypto && len(weak) > 0 {
+		return &WeakCryptoError{Findings: weak}
+	}
+	return nil
+}
+
+// verifyManifest checks the Files field of the dpkg-sig manifest of the
+// signature member name against the members of p
+func (p *debPackage) verifyManifest(name string, manifest []byte) error {
+	type file struct {
+		md5, sha1 []byte
+		size      int64
+	}
+	files := make(map[string]file)
+	inFiles := false
+	scanner := bufio.NewScanner(bytes.NewReader(manifest))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+			inFiles = strings.HasPrefix(line, "Files:")
+			continue
+		}
+		if !inFiles || strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			return fmt.Errorf("malformed %s file entry %q", name, strings.TrimSpace(line))
+		}
+		md5Digest, err1 := hex.DecodeString(fields[0])
+		sha1Digest, err2 := hex.DecodeString(fields[1])
+		size, err3 := strconv.ParseInt(fields[2], 10, 64)
+		if err := errors.Join(err1, err2, err3); err != nil {
+			return fmt.Errorf("malformed %s file entry for %s: %w", name, fields[3], err)
+		}
+		files[fields[3]] = file{md5: md5Digest, sha1: sha1Digest, size: size}
+	}
+	for _, m := range p.members[:3] {
+		if _, ok := files[m.name]; !ok {
+			return fmt.Errorf("%w: %s is not listed in %s", ErrUnsignedPart, m.name, name)
+		}
+	}
+	for fileName, f := range files {
+		i := -1
+		for j, m := range p.members {
+			if m.name == fileName {
+				i = j
+			}
+		}
+		if i < 0 {
+			return fmt.Errorf("%s lists %s, which is not in the package", name, fileName)
+		}
+		m := p.members[i]
+		if m.size != f.size {
+			return fmt.Errorf("%w: %s is %d bytes, %s lists %d", ErrDigestMismatch, m.name, m.size, name, f.size)
+		}
+		md5Hash, sha1Hash := md5.New(), sha1.New() // #nosec G401 - dpkg-sig defines these digests
+		if _, err := io.Copy(io.MultiWriter(md5Hash, sha1Hash), p.content(m)); err != nil {
+			return fmt.Errorf("failed to hash %s: %w", m.name, err)
+		}
+		if computed := sha1Hash.Sum(nil); subtle.ConstantTimeCompare(computed, f.sha1) != 1 {
+			return fmt.Errorf("%s: %w", m.name, &DigestMismatchError{Algorithm: crypto.SHA1, Signed: f.sha1, Computed: computed})
+		}
+		if computed := md5Hash.Sum(nil); subtle.ConstantTimeCompare(computed, f.md5) != 1 {
+			return fmt.Errorf("%s: %w", m.name, &DigestMismatchError{Algorithm: crypto.MD5, Signed: f.md5, Computed: computed})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package sigtool
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+// debMemberForTest is a member of an ar archive built by arArchiveForTest
+type debMemberForTest struct {
+	name string
+	data []byte
+}
+
+// debCoreMembersForTest are the members of an unsigned Debian package; the
+// control archive has an odd size to exercise member padding
+var debCoreMembersForTest = []debMemberForTest{
+	{"debian-binary", []byte("2.0\n")},
+	{"control.tar.gz", bytes.Repeat([]byte("c"), 101)},
+	{"data.tar.xz", bytes.Repeat([]byte("d"), 512)},
+}
+
+// arArchiveForTest returns a GNU ar archive of members
+func arArchiveForTest(members ...debMemberForTest) []byte {
+	out := []byte(arMagic)
+	for _, m := range members {
+		out = append(out, fmt.Sprintf("%-16s%-12d%-6d%-6d%-8s%-10d`\n", m.name+"/", 0, 0, 0, "100644", len(m.data))...)
+		out = append(out, m.data...)
+		if len(m.data)%2 == 1 {
+			out = append(out, '\n')
+		}
+	}
+	return out
+}
+
+// clearsignForTest returns text signed in cleartext by signer
+func clearsignForTest(t testing.TB, signer *openpgp.Entity, text string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := clearsign.Encode(&buf, signer.PrivateKey, nil)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	if _, err := w.Write([]byte(text)); err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// dpkgSigManifestForTest returns the dpkg-sig manifest of members
+func dpkgSigManifestForTest(members []debMemberForTest) string {
+	var b strings.Builder
+	b.WriteString("Version: 4\nSigner: \nDate: Sat Aug 10 09:37:41 2024\nRole: builder\nFiles: \n")
+	for _, m := range members {
+		fmt.Fprintf(&b, "\t%x %x %d %s\n", md5.Sum(m.data), sha1.Sum(m.data), len(m.data), m.name)
+	}
+	return b.String()
+}
+
+func TestVerify_DebianDebsigs(t *testing.T) {
+	signer := pgpEntityForTest(t, "Origin", 2048)
+	keyring := pgpKeyringForTest(t, signer)
+	var content []byte
+	for _, m := range debCoreMembersForTest {
+		content = append(content, m.data...)
+	}
+	signature := pgpSignForTest(t, signer, content, crypto.SHA256)
+	data := arArchiveForTest(append(debCoreMembersForTest, debMemberForTest{"_gpgorigin", signature})...)
+	filePath := writeScriptForTest(t, "demo_1.0_amd64.deb", data)
+
+	if fileType, err := DetectFileType(filePath); err != nil || fileType != FileTypeDeb {
+		t.Fatalf("Expected FileTypeDeb, got %q, %v", fileType, err)
+	}
+	if extracted, err := ExtractDigitalSignature(filePath); err != nil || !bytes.Equal(extracted, signature) {
+		t.Fatalf("Expected the _gpgorigin member, got %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{PGPKeyring: keyring}); err != nil {
+		t.Fatalf("Expected a valid debsigs signature, got %v", err)
+	}
+	if err := Verify(filePath, nil); !errors.Is(err, ErrSignerCertificateNotFound) {
+		t.Errorf("Expected ErrSignerCertificateNotFound without a keyring, got %v", err)
+	}
+	signatures, err := InspectPGPSignatures(filePath, keyring)
+	if err != nil || len(signatures) != 1 || signatures[0].Kind != "_gpgorigin" || signatures[0].UserID != "Origin <origin@example.com>" {
+		t.Fatalf("Unexpected signatures %+v, %v", signatures, err)
+	}
+
+	tampered := append([]byte(nil), data...)
+	tampered[bytes.Index(tampered, []byte("dddd"))] ^= 0xff
+	if err := Verify(writeScriptForTest(t, "demo_1.0_amd64.deb", tampered), &VerifyOptions{PGPKeyring: keyring}); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for a modified data member, got %v", err)
+	}
+
+	unsigned := writeScriptForTest(t, "demo_1.0_amd64.deb", arArchiveForTest(debCoreMembersForTest...))
+	if err := Verify(unsigned, &VerifyOptions{PGPKeyring: keyring}); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned for an unsigned package, got %v", err)
+	}
+}
+
+func TestVerify_DebianDpkgSig(t *testing.T) {
+	signer := pgpEntityForTest(t, "Builder", 2048)
+	keyring := pgpKeyringForTest(t, signer)
+	build := func(manifest string, members []debMemberForTest) string {
+		signature := clearsignForTest(t, signer, manifest)
+		return writeScriptForTest(t, "demo_1.0_amd64.deb", arArchiveForTest(append(members, debMemberForTest{"_gpgbuilder", signature})...))
+	}
+
+	filePath := build(dpkgSigManifestForTest(debCoreMembersForTest), debCoreMembersForTest)
+	if err := Verify(filePath, &VerifyOptions{PGPKeyring: keyring}); err != nil {
+		t.Fatalf("Expected a valid dpkg-sig signature, got %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{PGPKeyring: keyring, RejectWeakCrypto: true}); !errors.Is(err, ErrWeakCrypto) {
+		t.Errorf("Expected ErrWeakCrypto for the SHA-1 manifest, got %v", err)
+	}
+
+	// A signed manifest of other members no longer matches the package
+	modified := append([]debMemberForTest(nil), debCoreMembersForTest...)
+	modified[2] = debMemberForTest{"data.tar.xz", bytes.Repeat([]byte("e"), 512)}
+	var mismatch *DigestMismatchError
+	if err := Verify(build(dpkgSigManifestForTest(debCoreMembersForTest), modified), &VerifyOptions{PGPKeyring: keyring}); !errors.As(err, &mismatch) || mismatch.Algorithm != crypto.SHA1 {
+		t.Errorf("Expected a SHA-1 DigestMismatchError for a modified member, got %v", err)
+	}
+	if err := Verify(build(dpkgSigManifestForTest(debCoreMembersForTest[:2]), debCoreMembersForTest), &VerifyOptions{PGPKeyring: keyring}); !errors.Is(err, ErrUnsignedPart) {
+		t.Errorf("Expected ErrUnsignedPart for a manifest without data.tar, got %v", err)
+	}
+}
+
+func TestOpenDebianPackage_Malformed(t *testing.T) {
+	valid := arArchiveForTest(debCoreMembersForTest...)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"truncated", valid[:len(valid)-10]},
+		{"missing data member", arArchiveForTest(debCoreMembersForTest[:2]...)},
+		{"bad header", append(append([]byte(nil), valid[:len(arMagic)+58]...), 'x', 'x')},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := openDebianPackage(bytes.NewReader(tt.data), int64(len(tt.data))); err == nil {
+				t.Error("Expected an error for a malformed package")
+			}
+		})
+	}
+}
+
+// debRepositoryForTest writes the Release file of a repository holding
+// the package deb and returns the Release text and the paths of its plain
+// and gzip-compressed Packages indexes
+func debRepositoryForTest(t *testing.T, deb []byte, validUntil time.Time) (string, string, string) {
+	t.Helper()
+	packages := fmt.Sprintf("Package: demo\nVersion: 1.0\nArchitecture: amd64\nFilename: pool/main/d/demo/demo_1.0_amd64.deb\nSize: %d\nSHA256: %x\n\nPackage: other\nFilename: pool/main/o/other/other_1.0_amd64.deb\nSize: 1\nSHA256: %x\n", len(deb), sha256.Sum256(deb), sha256.Sum256(nil))
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(packages))
+	zw.Close()
+
+	release := "Origin: Demo\nLabel: Demo\nSuite: stable\nCodename: demo\nDate: Sat, 10 Aug 2024 09:37:41 UTC\n"
+	if !validUntil.IsZero() {
+		release += "Valid-Until: " + validUntil.UTC().Format(time.RFC1123) + "\n"
+	}
+	release += "MD5Sum:\n"
+	release += fmt.Sprintf(" %x %d main/binary-amd64/Packages\n", md5.Sum([]byte(packages)), len(packages))
+	release += "SHA256:\n"
+	release += fmt.Sprintf(" %x %d main/binary-amd64/Packages\n", sha256.Sum256([]byte(packages)), len(packages))
+	release += fmt.Sprintf(" %x %d main/binary-amd64/Packages.gz\n", sha256.Sum256(gz.Bytes()), gz.Len())
+	return release, writeScriptForTest(t, "Packages", []byte(packages)), writeScriptForTest(t, "Packages.gz", gz.Bytes())
+}
+
+func TestVerifyDebianRelease(t *testing.T) {
+	archive := pgpEntityForTest(t, "Archive", 2048)
+	unknown := pgpEntityForTest(t, "Unknown", 2048)
+	keyring := pgpKeyringForTest(t, archive)
+	deb := arArchiveForTest(debCoreMembersForTest...)
+	debPath := writeScriptForTest(t, "demo_1.0_amd64.deb", deb)
+	text, packagesPath, gzPath := debRepositoryForTest(t, deb, time.Date(2024, 8, 17, 9, 37, 41, 0, time.UTC))
+	opts := &VerifyOptions{PGPKeyring: keyring, VerificationTime: time.Date(2024, 8, 12, 0, 0, 0, 0, time.UTC)}
+
+	inRelease := writeScriptForTest(t, "InRelease", clearsignForTest(t, archive, text))
+	release, err := VerifyDebianRelease(inRelease, "", opts)
+	if err != nil {
+		t.Fatalf("Expected a valid InRelease file, got %v", err)
+	}
+	if release.Origin != "Demo" || release.Codename != "demo" || release.Date.IsZero() || release.Signature.UserID != "Archive <archive@example.com>" {
+		t.Errorf("Unexpected release %+v", release)
+	}
+	if len(release.Files) != 2 || release.Files[0].Algorithm != crypto.SHA256 {
+		t.Fatalf("Expected the two SHA-256 indexes, got %+v", release.Files)
+	}
+	if err := release.VerifyPackage("main/binary-amd64/Packages", packagesPath, debPath); err != nil {
+		t.Errorf("Expected the package to be listed, got %v", err)
+	}
+	if err := release.VerifyPackage("main/binary-amd64/Packages.gz", gzPath, debPath); err != nil {
+		t.Errorf("Expected the package to be listed in the compressed index, got %v", err)
+	}
+	if err := release.CheckFile("main/binary-amd64/Packages.gz", packagesPath); !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("Expected ErrDigestMismatch for another index, got %v", err)
+	}
+	if err := release.CheckFile("main/binary-i386/Packages", packagesPath); !errors.Is(err, ErrUnsignedPart) {
+		t.Errorf("Expected ErrUnsignedPart for an unlisted index, got %v", err)
+	}
+	other := writeScriptForTest(t, "demo_1.0_amd64.deb", append(deb, 0))
+	if err := release.VerifyPackage("main/binary-amd64/Packages", packagesPath, other); !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("Expected ErrDigestMismatch for a modified package, got %v", err)
+	}
+	if err := release.VerifyPackage("main/binary-amd64/Packages", packagesPath, writeScriptForTest(t, "missing_1.0_amd64.deb", deb)); !errors.Is(err, ErrUnsignedPart) {
+		t.Errorf("Expected ErrUnsignedPart for an unlisted package, got %v", err)
+	}
+
+	// Release with a detached signature by an unknown key and the archive key
+	releasePath := writeScriptForTest(t, "Release", []byte(text))
+	signatures := append(pgpSignForTest(t, unknown, []byte(text), crypto.SHA256), pgpSignForTest(t, archive, []byte(text), crypto.SHA512)...)
+	signaturePath := writeScriptForTest(t, "Release.gpg", signatures)
+	if release, err := VerifyDebianRelease(releasePath, signaturePath, opts); err != nil || release.Signature.KeyID != archive.PrimaryKey.KeyIdString() {
+		t.Errorf("Expected the archive signature to verify, got %+v, %v", release, err)
+	}
+	if infos, err := InspectPGPSignatures(signaturePath, keyring); err != nil || len(infos) != 2 {
+		t.Errorf("Expected two detached signatures, got %+v, %v", infos, err)
+	}
+	if _, err := VerifyDebianRelease(releasePath, signaturePath, &VerifyOptions{PGPKeyring: pgpKeyringForTest(t, unknown), VerificationTime: opts.VerificationTime}); err != nil {
+		t.Errorf("Expected the signature by the other keyring to verify, got %v", err)
+	}
+	if _, err := VerifyDebianRelease(releasePath, "", opts); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned for a Release file without signature, got %v", err)
+	}
+	tampered := writeScriptForTest(t, "Release", []byte(strings.Replace(text, "stable", "unstable", 1)))
+	if _, err := VerifyDebianRelease(tampered, signaturePath, opts); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for a modified release, got %v", err)
+	}
+	if _, err := VerifyDebianRelease(inRelease, "", &VerifyOptions{PGPKeyring: pgpKeyringForTest(t, unknown)}); !errors.Is(err, ErrSignerCertificateNotFound) {
+		t.Errorf("Expected ErrSignerCertificateNotFound for another keyring, got %v", err)
+	}
+	expired := &VerifyOptions{PGPKeyring: keyring, VerificationTime: time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)}
+	if _, err := VerifyDebianRelease(inRelease, "", expired); !errors.Is(err, ErrReleaseExpired) {
+		t.Errorf("Expected ErrReleaseExpired after Valid-Until, got %v", err)
+	}
+}
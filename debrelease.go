@@ -0,0 +1,367 @@
+package sigtool
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DebianRelease is the Release file of an APT repository, as verified by
+// VerifyDebianRelease.
+type DebianRelease struct {
+	// Origin, Label, Suite and Codename identify the repository, such as
+	// "Debian" and "bookworm"
+	Origin   string `json:",omitempty"`
+	Label    string `json:",omitempty"`
+	Suite    string `json:",omitempty"`
+	Codename string `json:",omitempty"`
+	// Date is the time the release was published and ValidUntil the time
+	// after which APT refuses it, zero when the release does not expire
+	Date       time.Time
+	ValidUntil time.Time `json:",omitempty"`
+	// Files are the indexes the release lists with a SHA-256 or SHA-512
+	// digest
+	Files []DebianReleaseFile
+	// Signature describes the signature that verified
+	Signature PGPSignatureInfo
+}
+
+// DebianReleaseFile is an index listed by a Release file.
+type DebianReleaseFile struct {
+	// Path is the path of the index relative to the release, such as
+	// "main/binary-amd64/Packages.gz"
+	Path string
+	// Size is the size of the index in bytes
+	Size int64
+	// Algorithm and Digest are the strongest digest the release gives
+	Algorithm crypto.Hash
+	Digest    []byte
+}
+
+// releaseDigestFields are the Release fields of strong index digests, the
+// strongest first
+var releaseDigestFields = []struct {
+	name      string
+	algorithm crypto.Hash
+}{
+	{"SHA512", crypto.SHA512},
+	{"SHA256", crypto.SHA256},
+}
+
+// VerifyDebianRelease verifies the signature of the Release file of an APT
+// repository as apt does: either an InRelease file, signed in cleartext,
+// or a Release file with its detached Release.gpg signature. At least one
+// signature must be by a key of opts.PGPKeyring, and the release must not
+// be past its Valid-Until date at opts.VerificationTime, or the current
+// time when zero.
+//
+// Parameters:
+//   - releasePath: The path to the InRelease or Release file
+//   - signaturePath: The path to the Release.gpg signature of a Release
+//     file, or empty for an InRelease file
+//   - opts: The verification options; PGPKeyring is required
+//
+// Returns:
+//   - *DebianRelease: The verified release and the indexes it lists
+//   - error: ErrSignerCertificateNotFound or ErrInvalidSignature when no
+//     signature verifies, ErrReleaseExpired when the release has expired
+//
+// Example usage:
+//
+//	keyring, _ := sigtool.LoadPGPKeyring("/usr/share/keyrings/debian-archive-keyring.gpg")
+//	release, err := sigtool.VerifyDebianRelease("InRelease", "", &sigtool.VerifyOptions{PGPKeyring: keyring})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	fmt.Printf("%s %s, signed by %s\n", release.Origin, release.Codename, release.Signature.UserID)
+func VerifyDebianRelease(releasePath, signaturePath string, opts *VerifyOptions) (*DebianRelease, error) {
+	if opts == nil {
+		opts = &VerifyOptions{}
+	}
+	if strings.TrimSpace(releasePath) == "" {
+		return nil, errors.New("file path cannot be empty")
+	}
+	// #nosec G304 - This tool is designed to read user-specified files
+	data, err := os.ReadFile(releasePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read release %q: %w", releasePath, err)
+	}
+
+	var signatures []*pgpSignature
+	signed, text := data, data
+	if signaturePath == "" {
+		if !isClearsigned(data) {
+			return nil, fmt.Errorf("%w: %q is not a cleartext signed InRelease file; give the Release.gpg signature of a Release file", ErrNotSigned, releasePath)
+		}
+		if signatures, signed, text, err = parseClearsigned("InRelease", data); err != nil {
+			return nil, err
+		}
+	} else {
+		// #nosec G304 - This tool is designed to read user-specified files
+		signature, err := os.ReadFile(signaturePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signature %q: %w", signaturePath, err)
+		}
+		if signatures, err = parsePGPSignatures("Release.gpg", signature); err != nil {
+			return nil, err
+		}
+	}
+	key, weak, err := verifyPGPSignatures(signatures, opts.PGPKeyring, func() io.Reader { return bytes.NewReader(signed) })
+	if err != nil {
+		return nil, err
+	}
+	if opts.RejectWeakCrypto && len(weak) > 0 {
+		return nil, &WeakCryptoError{Findings: weak}
+	}
+
+	release, err := parseDebianRelease(text)
+	if err != nil {
+		return nil, err
+	}
+	// Describe the signature that verified rather than one by an unknown key
+	release.Signature = signatures[0].info(opts.PGPKeyring)
+	for _, s := range signatures {
+		if id, ok := s.keyID(); ok && id == key.PublicKey.KeyId {
+			release.Signature = s.info(opts.PGPKeyring)
+			break
+		}
+	}
+	now := opts.VerificationTime
+	if now.IsZero() {
+		now = time.Now()
+	}
+	if !release.ValidUntil.IsZero() && now.After(release.ValidUntil) {
+		return nil, fmt.Errorf("%w: valid until %s", ErrReleaseExpired, release.ValidUntil.UTC().Format(time.RFC3339))
+	}
+	return release, nil
+}
+
+// parseDebianRelease parses the fields of the Release file text
+func parseDebianRelease(text []byte) (*DebianRelease, error) {
+	paragraphs := parseDeb822(text)
+	if len(paragraphs) == 0 {
+		return nil, errors.New("release file is empty")
+	}
+	fields := paragraphs[0]
+	release := &DebianRelease{Origin: fields["Origin"], Label: fields["Label"], Suite: fields["Suite"], Codename: fields["Codename"]}
+	var err error
+	if release.Date, err = parseReleaseTime(fields["Date"]); err != nil {
+		return nil, fmt.Errorf("malformed release Date: %w", err)
+	}
+	if release.ValidUntil, err = parseReleaseTime(fields["Valid-Until"]); err != nil {
+		return nil, fmt.Errorf("malformed release Valid-Until: %w", err)
+	}
+	listed := make(map[string]bool)
+	for _, f := range releaseDigestFields {
+		for _, line := range strings.Split(fields[f.name], "\n") {
+			parts := strings.Fields(line)
+			if len(parts) == 0 {
+				continue
+			}
+			if len(parts) != 3 {
+				return nil, fmt.Errorf("malformed release %s entry %q", f.name, line)
+			}
+			if listed[parts[2]] {
+				continue
+			}
+			digest, err := hex.DecodeString(parts[0])
+			if err != nil || len(digest) != f.algorithm.Size() {
+				return nil, fmt.Errorf("malformed release %s digest of %s", f.name, parts[2])
+			}
+			size, err := strconv.ParseInt(parts[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("malformed release size of %s: %w", parts[2], err)
+			}
+			listed[parts[2]] = true
+			release.Files = append(release.Files, DebianReleaseFile{Path: parts[2], Size: size, Algorithm: f.algorithm, Digest: digest})
+		}
+	}
+	return release, nil
+}
+
+// parseReleaseTime parses a Release date such as "Sat, 10 Aug 2024
+// 09:37:41 UTC", returning the zero time for an empty one
+func parseReleaseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC1123, value)
+	if err != nil {
+		return time.Parse(time.RFC1123Z, value)
+	}
+	return t, nil
+}
+
+// parseDeb822 parses the paragraphs of a control file, such as a Release
+// or Packages file, into their fields; continuation lines are joined with
+// newlines
+func parseDeb822(text []byte) []map[string]string {
+	var paragraphs []map[string]string
+	var fields map[string]string
+	var last string
+	scanner := bufio.NewScanner(bytes.NewReader(text))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case strings.TrimSpace(line) == "":
+			fields = nil
+		case line[0] == ' ' || line[0] == '\t':
+			if fields != nil && last != "" {
+				fields[last] += "\n" + strings.TrimSpace(line)
+			}
+		default:
+			name, value, ok := strings.Cut(line, ":")
+			if !ok {
+				continue
+			}
+			if fields == nil {
+				fields = make(map[string]string)
+				paragraphs = append(paragraphs, fields)
+			}
+			last = name
+			fields[name] = strings.TrimSpace(value)
+		}
+	}
+	return paragraphs
+}
+
+// file returns the index of r at name
+func (r *DebianRelease) file(name string) (*DebianReleaseFile, error) {
+	for i := range r.Files {
+		if r.Files[i].Path == name {
+			return &r.Files[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s is not listed in the release", ErrUnsignedPart, name)
+}
+
+// CheckFile checks that the file at filePath is the index the release
+// lists as name, by size and digest.
+//
+// Parameters:
+//   - name: The path of the index in the release, such as
+//     "main/binary-amd64/Packages.gz"
+//   - filePath: The path to the downloaded index
+//
+// Returns:
+//   - error: ErrUnsignedPart when the release does not list name, a
+//     DigestMismatchError when the file differs
+//
+// Example usage:
+//
+//	if err := release.CheckFile("main/binary-amd64/Packages.gz", "Packages.gz"); err != nil {
+//	    log.Fatal(err)
+//	}
+func (r *DebianRelease) CheckFile(name, filePath string) error {
+	listed, err := r.file(name)
+	if err != nil {
+		return err
+	}
+	// #nosec G304 - This tool is designed to read user-specified files
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file %q: %w", filePath, err)
+	}
+	defer f.Close()
+	h := listed.Algorithm.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return fmt.Errorf("failed to hash %q: %w", filePath, err)
+	}
+	if size != listed.Size {
+		return fmt.Errorf("%w: %s is %d bytes, the release lists %d", ErrDigestMismatch, name, size, listed.Size)
+	}
+	if computed := h.Sum(nil); subtle.ConstantTimeCompare(computed, listed.Digest) != 1 {
+		return fmt.Errorf("%s: %w", name, &DigestMismatchError{Algorithm: listed.Algorithm, Signed: listed.Digest, Computed: computed})
+	}
+	return nil
+}
+
+// VerifyPackage checks that the Debian package at debPath is listed, by
+// file name, size and SHA-256 digest, in the Packages index at indexPath,
+// which the release must list as indexName. Together with
+// VerifyDebianRelease this verifies a package the way apt does when it
+// downloads it. Plain and gzip-compressed indexes are read.
+//
+// Parameters:
+//   - indexName: The path of the index in the release, such as
+//     "main/binary-amd64/Packages.gz"
+//   - indexPath: The path to the downloaded index
+//   - debPath: The path to the package
+//
+// Returns:
+//   - error: ErrUnsignedPart when the index or the package is not listed, a
+//     DigestMismatchError when either differs
+//
+// Example usage:
+//
+//	err := release.VerifyPackage("main/binary-amd64/Packages.gz", "Packages.gz", "hello_2.10-3_amd64.deb")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+func (r *DebianRelease) VerifyPackage(indexName, indexPath, debPath string) error {
+	if err := r.CheckFile(indexName, indexPath); err != nil {
+		return err
+	}
+	// #nosec G304 - This tool is designed to read user-specified files
+	index, err := os.ReadFile(indexPath)
+	if err != nil {
+		return fmt.Errorf("failed to read index %q: %w", indexPath, err)
+	}
+	switch path.Ext(indexName) {
+	case ".gz":
+		zr, err := gzip.NewReader(bytes.NewReader(index))
+		if err != nil {
+			return fmt.Errorf("failed to decompress %s: %w", indexName, err)
+		}
+		if index, err = io.ReadAll(zr); err != nil {
+			return fmt.Errorf("failed to decompress %s: %w", indexName, err)
+		}
+	case "":
+	default:
+		return fmt.Errorf("unsupported index compression %q; give the plain or .gz index", path.Ext(indexName))
+	}
+
+	base := filepath.Base(debPath)
+	for _, fields := range parseDeb822(index) {
+		if path.Base(fields["Filename"]) != base {
+			continue
+		}
+		signed, err := hex.DecodeString(fields["SHA256"])
+		if err != nil || len(signed) != crypto.SHA256.Size() {
+			return fmt.Errorf("%s lists no SHA-256 digest for %s", indexName, base)
+		}
+		// #nosec G304 - This tool is designed to read user-specified files
+		f, err := os.Open(debPath)
+		if err != nil {
+			return fmt.Errorf("failed to open file %q: %w", debPath, err)
+		}
+		defer f.Close()
+		h := crypto.SHA256.New()
+		size, err := io.Copy(h, f)
+		if err != nil {
+			return fmt.Errorf("failed to hash %q: %w", debPath, err)
+		}
+		if listed, err := strconv.ParseInt(fields["Size"], 10, 64); err == nil && listed != size {
+			return fmt.Errorf("%w: %s is %d bytes, %s lists %d", ErrDigestMismatch, base, size, indexName, listed)
+		}
+		if computed := h.Sum(nil); subtle.ConstantTimeCompare(computed, signed) != 1 {
+			return fmt.Errorf("%s: %w", base, &DigestMismatchError{Algorithm: crypto.SHA256, Signed: signed, Computed: computed})
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: %s is not listed in %s", ErrUnsignedPart, base, indexName)
+}
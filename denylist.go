@@ -0,0 +1,185 @@
+package sigtool
+
+import (
+	"bufio"
+	"crypto/sha1" // #nosec G505 - SHA-1 thumbprints identify certificates, they are not used for security
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+)
+
+// DenylistEntry identifies a certificate that must not be trusted. Either
+// Serial or Thumbprint is set.
+type DenylistEntry struct {
+	// Serial is the certificate serial number in hexadecimal
+	Serial string
+	// Thumbprint is the SHA-1 or SHA-256 fingerprint of the certificate in
+	// hexadecimal
+	Thumbprint string
+	// Description explains why the certificate is denied
+	Description string
+}
+
+// knownBadCertificates are publicly documented code-signing certificates
+// whose private keys were stolen and used to sign malware
+var knownBadCertificates = []DenylistEntry{
+	{Serial: "43bb437d609866286dd839e1d00309f5", Description: "NVIDIA Corporation certificate leaked in the 2022 Lapsus$ breach"},
+	{Serial: "14781bc862e8dc503a559346f5dcc518", Description: "NVIDIA Corporation certificate leaked in the 2022 Lapsus$ breach"},
+}
+
+// Denylist is a set of certificates rejected by verification regardless of
+// their revocation status. It is safe for concurrent use.
+type Denylist struct {
+	mu          sync.RWMutex
+	serials     map[string]DenylistEntry
+	thumbprints map[string]DenylistEntry
+}
+
+// NewDenylist returns a denylist holding the known-bad certificates shipped
+// with sigtool followed by entries.
+//
+// The shipped entries cover code-signing certificates whose theft was
+// publicly disclosed, so binaries signed with them are flagged even after
+// the CRL and OCSP infrastructure of their CA is gone.
+//
+// Parameters:
+//   - entries: Additional certificates to deny
+//
+// Returns:
+//   - *Denylist: A denylist for VerifyOptions.Denylist
+//
+// Example usage:
+//
+//	denylist := sigtool.NewDenylist(sigtool.DenylistEntry{
+//	    Thumbprint:  "3a0682ab7fb478ba82fd11ce4db9b0adea55da05",
+//	    Description: "internal key compromised in incident 42",
+//	})
+//	err := sigtool.Verify("signed.exe", &sigtool.VerifyOptions{Denylist: denylist})
+func NewDenylist(entries ...DenylistEntry) *Denylist {
+	d := &Denylist{serials: make(map[string]DenylistEntry), thumbprints: make(map[string]DenylistEntry)}
+	for _, entry := range knownBadCertificates {
+		_ = d.Add(entry)
+	}
+	for _, entry := range entries {
+		_ = d.Add(entry)
+	}
+	return d
+}
+
+// Add denies the certificate identified by entry. Hexadecimal values may use
+// either case and contain colons or spaces.
+func (d *Denylist) Add(entry DenylistEntry) error {
+	serial := normalizeHex(entry.Serial)
+	thumbprint := normalizeHex(entry.Thumbprint)
+	if serial == "" && thumbprint == "" {
+		return fmt.Errorf("denylist entry %q has no serial number or thumbprint", entry.Description)
+	}
+	if thumbprint != "" && len(thumbprint) != 2*sha1.Size && len(thumbprint) != 2*sha256.Size {
+		return fmt.Errorf("invalid certificate thumbprint %q: expected a SHA-1 or SHA-256 fingerprint", entry.Thumbprint)
+	}
+	if serial != "" {
+		n, ok := new(big.Int).SetString(serial, 16)
+		if !ok {
+			return fmt.Errorf("invalid certificate serial number %q", entry.Serial)
+		}
+		serial = n.Text(16)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if serial != "" {
+		d.serials[serial] = entry
+	}
+	if thumbprint != "" {
+		d.thumbprints[thumbprint] = entry
+	}
+	return nil
+}
+
+// Load adds the entries of a denylist file read from r. Each line holds
+// "serial:<hex>", "sha1:<hex>" or "sha256:<hex>", optionally followed by a
+// description; blank lines and lines starting with # are ignored.
+func (d *Denylist) Load(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		value, description, _ := strings.Cut(text, " ")
+		kind, id, ok := strings.Cut(value, ":")
+		if !ok {
+			return fmt.Errorf("denylist line %d: expected serial:, sha1: or sha256: prefix", line)
+		}
+		entry := DenylistEntry{Description: strings.TrimSpace(description)}
+		switch strings.ToLower(kind) {
+		case "serial":
+			entry.Serial = id
+		case "sha1", "sha256":
+			entry.Thumbprint = id
+		default:
+			return fmt.Errorf("denylist line %d: unknown identifier type %q", line, kind)
+		}
+		if err := d.Add(entry); err != nil {
+			return fmt.Errorf("denylist line %d: %w", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read denylist: %w", err)
+	}
+	return nil
+}
+
+// LoadFile adds the entries of the denylist file at path; see Load.
+func (d *Denylist) LoadFile(path string) error {
+	// #nosec G304 - denylists are user-specified files
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open denylist %q: %w", path, err)
+	}
+	defer f.Close()
+	return d.Load(f)
+}
+
+// Lookup returns the entry denying cert, if any.
+func (d *Denylist) Lookup(cert *x509.Certificate) (DenylistEntry, bool) {
+	sha1Sum := sha1.Sum(cert.Raw) // #nosec G401 - certificate fingerprint
+	sha256Sum := sha256.Sum256(cert.Raw)
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if entry, ok := d.thumbprints[hex.EncodeToString(sha256Sum[:])]; ok {
+		return entry, true
+	}
+	if entry, ok := d.thumbprints[hex.EncodeToString(sha1Sum[:])]; ok {
+		return entry, true
+	}
+	if cert.SerialNumber != nil {
+		if entry, ok := d.serials[new(big.Int).Abs(cert.SerialNumber).Text(16)]; ok {
+			return entry, true
+		}
+	}
+	return DenylistEntry{}, false
+}
+
+// check fails with a DeniedCertificateError for the first denied
+// certificate of certs
+func (d *Denylist) check(certs []*x509.Certificate) error {
+	for _, cert := range certs {
+		if entry, ok := d.Lookup(cert); ok {
+			return &DeniedCertificateError{Certificate: cert, Entry: entry}
+		}
+	}
+	return nil
+}
+
+// normalizeHex lowercases s and removes colons and spaces
+func normalizeHex(s string) string {
+	return strings.ToLower(strings.NewReplacer(":", "", " ", "").Replace(strings.TrimSpace(s)))
+}
@@ -0,0 +1,77 @@
+package sigtool
+
+import (
+	"crypto"
+	"crypto/sha1" // #nosec G505 - test fingerprints
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestDenylist_KnownBadCertificates(t *testing.T) {
+	serial, _ := new(big.Int).SetString("43BB437D609866286DD839E1D00309F5", 16)
+	entry, ok := NewDenylist().Lookup(&x509.Certificate{SerialNumber: serial})
+	if !ok || !strings.Contains(entry.Description, "NVIDIA") {
+		t.Errorf("Expected the leaked NVIDIA certificate to be denied, got %+v (%v)", entry, ok)
+	}
+	if _, ok := NewDenylist().Lookup(&x509.Certificate{SerialNumber: big.NewInt(1)}); ok {
+		t.Error("Expected an unrelated certificate not to be denied")
+	}
+}
+
+func TestDenylist_Load(t *testing.T) {
+	cert, _ := testSigner(t)
+	sum := sha1.Sum(cert.Raw) // #nosec G401
+	d := NewDenylist()
+	err := d.Load(strings.NewReader("# stolen keys\n\nsha1:" + strings.ToUpper(hex.EncodeToString(sum[:])) + " test signer\nserial:0A:0B\n"))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if entry, ok := d.Lookup(cert); !ok || entry.Description != "test signer" {
+		t.Errorf("Expected the SHA-1 thumbprint to match, got %+v (%v)", entry, ok)
+	}
+	if _, ok := d.Lookup(&x509.Certificate{SerialNumber: big.NewInt(0x0a0b)}); !ok {
+		t.Error("Expected the serial number with colons to match")
+	}
+
+	for _, bad := range []string{"0a0b", "md5:00", "sha256:abcd", "serial:xyz"} {
+		if err := NewDenylist().Load(strings.NewReader(bad)); err == nil || !strings.Contains(err.Error(), "line 1") {
+			t.Errorf("%q: expected a line 1 error, got: %v", bad, err)
+		}
+	}
+}
+
+func TestVerify_Denylist(t *testing.T) {
+	ca := issueCertificateForTest(t, testCATemplate("denylist root", 80), nil)
+	leaf := issueCertificateForTest(t, testLeafTemplate("denylist signer", 81, x509.ExtKeyUsageCodeSigning), ca)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+	filePath := createSignedMockPEAs(t, leaf, crypto.SHA256)
+
+	if err := Verify(filePath, &VerifyOptions{Roots: roots, Denylist: NewDenylist()}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	leafSum := sha256.Sum256(leaf.Cert.Raw)
+	err := Verify(filePath, &VerifyOptions{Denylist: NewDenylist(DenylistEntry{Thumbprint: hex.EncodeToString(leafSum[:]), Description: "compromised"})})
+	var denied *DeniedCertificateError
+	if !errors.Is(err, ErrDeniedCertificate) || !errors.As(err, &denied) || !denied.Certificate.Equal(leaf.Cert) {
+		t.Fatalf("Expected the signer to be denied, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "compromised") {
+		t.Errorf("Expected the description in the error, got: %v", err)
+	}
+
+	// The root is not embedded and is only found through the validated chain
+	root := NewDenylist(DenylistEntry{Serial: ca.Cert.SerialNumber.Text(16)})
+	if err := Verify(filePath, &VerifyOptions{Denylist: root}); err != nil {
+		t.Errorf("Expected no error without chain validation, got: %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{Roots: roots, Denylist: root}); !errors.Is(err, ErrDeniedCertificate) {
+		t.Errorf("Expected the root to be denied, got: %v", err)
+	}
+}
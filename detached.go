@@ -0,0 +1,179 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"go.mozilla.org/pkcs7"
+)
+
+// VerifyDetached verifies a detached PKCS#7 or CMS signature over an
+// arbitrary file, such as the .p7s files written by openssl cms -sign or
+// openssl smime -sign without -nodetach. The signature may be DER or PEM
+// encoded. Every signer must have signed the file: with signed attributes,
+// their messageDigest must match the digest of the file and the signature
+// must be over them; without, the signature must be over the file digest.
+// Each signer is then checked against opts like an Authenticode signer,
+// at the time of its RFC 3161 timestamp when it has one.
+//
+// Parameters:
+//   - contentPath: The path to the signed file
+//   - signaturePath: The path to the detached .p7s or .p7b signature
+//   - opts: The verification options; nil verifies the signatures without
+//     validating the certificate chains
+//
+// Returns:
+//   - error: nil if every signer verifies; ErrNotSigned when the signature
+//     has no signers, ErrDigestMismatch when the file does not match the
+//     signed messageDigest, ErrInvalidSignature when a signature does not
+//     verify or embeds its content, or a chain validation error
+//
+// Example usage:
+//
+//	err := sigtool.VerifyDetached("release.tar.gz", "release.tar.gz.p7s", &sigtool.VerifyOptions{Roots: roots})
+//	if errors.Is(err, sigtool.ErrDigestMismatch) {
+//	    log.Fatal("release.tar.gz was modified after signing")
+//	}
+func VerifyDetached(contentPath, signaturePath string, opts *VerifyOptions) error {
+	if opts == nil {
+		opts = &VerifyOptions{}
+	}
+	if strings.TrimSpace(contentPath) == "" || strings.TrimSpace(signaturePath) == "" {
+		return errors.New("file path cannot be empty")
+	}
+	p7, err := readDetachedSignature(signaturePath)
+	if err != nil {
+		return err
+	}
+
+	// #nosec G304 - This tool is designed to read user-specified files
+	f, err := os.Open(contentPath)
+	if err != nil {
+		return fmt.Errorf("failed to open file %q: %w", contentPath, err)
+	}
+	defer f.Close()
+	return verifyDetached(f, p7, *opts)
+}
+
+// readDetachedSignature reads and parses the DER or PEM encoded detached
+// signature at path
+func readDetachedSignature(path string) (*pkcs7.PKCS7, error) {
+	// #nosec G304 - This tool is designed to read user-specified files
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open signature %q: %w", path, err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, MaxSignatureSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signature %q: %w", path, err)
+	}
+	if len(data) > MaxSignatureSize {
+		return nil, &SignatureSizeError{Size: int64(len(data)), Limit: MaxSignatureSize}
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+
+	p7, err := parsePKCS7(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS#7 signature: %w", err)
+	}
+	if len(p7.Signers) == 0 {
+		return nil, fmt.Errorf("%w (PKCS#7 file %q has no signers)", ErrNotSigned, path)
+	}
+	if len(p7.Content) > 0 {
+		return nil, fmt.Errorf("%w: signature is not detached, it embeds %d bytes of content", ErrInvalidSignature, len(p7.Content))
+	}
+	return p7, nil
+}
+
+// verifyDetached verifies every signer of the detached signature p7 over
+// the content r, hashing r once with each digest algorithm the signers use
+func verifyDetached(r io.Reader, p7 *pkcs7.PKCS7, opts VerifyOptions) error {
+	algorithms := make([]crypto.Hash, len(p7.Signers))
+	hashes := map[crypto.Hash]hash.Hash{}
+	var writers []io.Writer
+	for i, si := range p7.Signers {
+		algorithm, err := hashForOID(si.DigestAlgorithm.Algorithm)
+		if err != nil {
+			return fmt.Errorf("unsupported signer digest algorithm: %w", err)
+		}
+		algorithms[i] = algorithm
+		if hashes[algorithm] == nil {
+			hashes[algorithm] = algorithm.New()
+			writers = append(writers, hashes[algorithm])
+		}
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), r); err != nil {
+		return fmt.Errorf("failed to hash file: %w", err)
+	}
+
+	trust, err := resolveTrust(opts)
+	if err != nil {
+		return err
+	}
+	for i, si := range p7.Signers {
+		// The attribute helpers read the primary signer
+		single := *p7
+		single.Signers = p7.Signers[i : i+1]
+		algorithm := algorithms[i]
+		signer := findCertificate(p7, issuerAndSerial{IssuerName: si.IssuerAndSerialNumber.IssuerName, SerialNumber: si.IssuerAndSerialNumber.SerialNumber})
+		if signer == nil {
+			return fmt.Errorf("signer %d: %w: serial %x", i+1, ErrSignerCertificateNotFound, si.IssuerAndSerialNumber.SerialNumber)
+		}
+
+		digest := hashes[algorithm].Sum(nil)
+		if signed := authenticatedAttributes(&single); len(signed) > 0 {
+			var messageDigest []byte
+			if raw, ok := findAttribute(signed, oidAttributeMessageDigest); !ok {
+				return fmt.Errorf("signer %d: %w: no messageDigest attribute", i+1, ErrInvalidSignature)
+			} else if _, err := asn1.Unmarshal(raw, &messageDigest); err != nil {
+				return fmt.Errorf("signer %d: failed to parse messageDigest attribute: %w", i+1, err)
+			}
+			if !bytes.Equal(digest, messageDigest) {
+				return fmt.Errorf("signer %d: %w", i+1, &DigestMismatchError{Algorithm: algorithm, Signed: messageDigest, Computed: digest})
+			}
+			// The signature is over the DER SET OF the signed attributes
+			encoded, err := asn1.Marshal(struct {
+				A []attribute `asn1:"set"`
+			}{A: signed})
+			if err != nil {
+				return fmt.Errorf("signer %d: failed to encode signed attributes: %w", i+1, err)
+			}
+			var attrs asn1.RawValue
+			if _, err := asn1.Unmarshal(encoded, &attrs); err != nil {
+				return fmt.Errorf("signer %d: failed to encode signed attributes: %w", i+1, err)
+			}
+			attrHash := algorithm.New()
+			attrHash.Write(attrs.Bytes)
+			digest = attrHash.Sum(nil)
+		}
+		if err := verifyDigestSignature(signer, algorithm, digest, si.EncryptedDigest); err != nil {
+			return fmt.Errorf("signer %d: %w: %w", i+1, ErrInvalidSignature, err)
+		}
+		opts.logger().Debug("verified detached signer", "signer", i+1, "subject", signer.Subject.String(), "algorithm", algorithm.String())
+
+		signingTime, err := verifyTimestampAttribute(unauthenticatedAttributes(&single), si.EncryptedDigest, trust)
+		if err != nil {
+			return fmt.Errorf("signer %d: %w", i+1, err)
+		}
+		var weak []WeakCryptoFinding
+		if algorithm == crypto.MD5 || algorithm == crypto.SHA1 {
+			weak = append(weak, WeakCryptoFinding{Kind: WeakFileDigest, Signature: i, Detail: algorithm.String()})
+		}
+		weak = append(weak, weakCertificateFindings(p7.Certificates, i)...)
+		if err := verifyCertificateTrust(signer, p7.Certificates, weak, opts, trust, signingTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
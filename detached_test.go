@@ -0,0 +1,133 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"go.mozilla.org/pkcs7"
+)
+
+// detachedForTest returns a detached signature over content by each of ids,
+// with signed attributes and SHA-256 as openssl cms -sign -binary writes it
+func detachedForTest(t testing.TB, content []byte, ids ...*testIdentity) []byte {
+	t.Helper()
+	sd, err := pkcs7.NewSignedData(content)
+	if err != nil {
+		t.Fatalf("Failed to create SignedData: %v", err)
+	}
+	sd.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+	for _, id := range ids {
+		if err := sd.AddSignerChain(id.Cert, id.Key, id.Chain, pkcs7.SignerInfoConfig{}); err != nil {
+			t.Fatalf("Failed to add signer: %v", err)
+		}
+	}
+	sd.Detach()
+	signature, err := sd.Finish()
+	if err != nil {
+		t.Fatalf("Failed to finish SignedData: %v", err)
+	}
+	return signature
+}
+
+func TestVerifyDetached(t *testing.T) {
+	id, _ := machoIdentityForTest(t)
+	content := bytes.Repeat([]byte("release tarball "), 1024)
+	contentPath := writeScriptForTest(t, "release.tar.gz", content)
+	signature := signDetachedForTest(t, id, content)
+	signaturePath := writeScriptForTest(t, "release.tar.gz.p7s", signature)
+
+	if err := VerifyDetached(contentPath, signaturePath, nil); err != nil {
+		t.Fatalf("Expected a valid detached signature, got %v", err)
+	}
+	if err := VerifyDetached(contentPath, signaturePath, &VerifyOptions{Roots: machoRootsForTest(t)}); err != nil {
+		t.Fatalf("Expected the signer to chain to the root, got %v", err)
+	}
+	if err := VerifyDetached(contentPath, signaturePath, &VerifyOptions{Roots: x509.NewCertPool()}); err == nil {
+		t.Error("Expected chain validation to fail without the root")
+	}
+	thumbprint := sha256.Sum256(id.Cert.Raw)
+	if err := VerifyDetached(contentPath, signaturePath, &VerifyOptions{RequiredThumbprints: []string{hex.EncodeToString(thumbprint[:])}}); err != nil {
+		t.Errorf("Expected the pinned signer to verify, got %v", err)
+	}
+	if err := VerifyDetached(contentPath, signaturePath, &VerifyOptions{RequiredThumbprints: []string{"00"}}); !errors.Is(err, ErrSignerNotPinned) {
+		t.Errorf("Expected ErrSignerNotPinned for another thumbprint, got %v", err)
+	}
+
+	pemPath := writeScriptForTest(t, "release.tar.gz.pem", pem.EncodeToMemory(&pem.Block{Type: "PKCS7", Bytes: signature}))
+	if err := VerifyDetached(contentPath, pemPath, nil); err != nil {
+		t.Errorf("Expected a PEM signature to verify, got %v", err)
+	}
+
+	tampered := append([]byte(nil), content...)
+	tampered[10] ^= 0xff
+	tamperedPath := writeScriptForTest(t, "release.tar.gz", tampered)
+	var mismatch *DigestMismatchError
+	if err := VerifyDetached(tamperedPath, signaturePath, nil); !errors.As(err, &mismatch) || mismatch.Algorithm != crypto.SHA256 {
+		t.Errorf("Expected a DigestMismatchError for a modified file, got %v", err)
+	}
+
+	// Without signed attributes the signature is over the file digest itself
+	unsignedAttrs := kernelModuleForTest(t, id, content, crypto.SHA256, true)
+	raw := unsignedAttrs[len(content) : len(unsignedAttrs)-12-len(kmodSignatureMagic)]
+	rawPath := writeScriptForTest(t, "release.tar.gz.p7s", raw)
+	if err := VerifyDetached(contentPath, rawPath, nil); err != nil {
+		t.Errorf("Expected a signature without signed attributes to verify, got %v", err)
+	}
+	if err := VerifyDetached(tamperedPath, rawPath, nil); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for a modified file, got %v", err)
+	}
+}
+
+func TestVerifyDetached_Signers(t *testing.T) {
+	id, _ := machoIdentityForTest(t)
+	other := kernelKeyForTest(t, "sigtool test second signer", 9301)
+	content := []byte("firmware image")
+	contentPath := writeScriptForTest(t, "firmware.bin", content)
+
+	signaturePath := writeScriptForTest(t, "firmware.bin.p7s", detachedForTest(t, content, id, other))
+	if err := VerifyDetached(contentPath, signaturePath, nil); err != nil {
+		t.Fatalf("Expected both signers to verify, got %v", err)
+	}
+	// Each signer must chain, and the second is self-signed
+	if err := VerifyDetached(contentPath, signaturePath, &VerifyOptions{Roots: machoRootsForTest(t)}); err == nil {
+		t.Error("Expected the second signer to fail chain validation")
+	}
+
+	other.Cert = kernelKeyForTest(t, "sigtool test second signer", 9302).Cert
+	mismatched := writeScriptForTest(t, "firmware.bin.p7s", detachedForTest(t, content, other))
+	if err := VerifyDetached(contentPath, mismatched, nil); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for a signature by another key, got %v", err)
+	}
+
+	attached, err := pkcs7.NewSignedData(content)
+	if err != nil {
+		t.Fatalf("Failed to create SignedData: %v", err)
+	}
+	if err := attached.AddSigner(id.Cert, id.Key, pkcs7.SignerInfoConfig{}); err != nil {
+		t.Fatalf("Failed to add signer: %v", err)
+	}
+	attachedSignature, err := attached.Finish()
+	if err != nil {
+		t.Fatalf("Failed to finish SignedData: %v", err)
+	}
+	if err := VerifyDetached(contentPath, writeScriptForTest(t, "firmware.p7m", attachedSignature), nil); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for an attached signature, got %v", err)
+	}
+
+	certificates, err := pkcs7.DegenerateCertificate(id.Cert.Raw)
+	if err != nil {
+		t.Fatalf("Failed to create certificates-only PKCS#7: %v", err)
+	}
+	if err := VerifyDetached(contentPath, writeScriptForTest(t, "certs.p7b", certificates), nil); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned for a certificates-only PKCS#7, got %v", err)
+	}
+	if err := VerifyDetached(contentPath, "", nil); err == nil {
+		t.Error("Expected an error for an empty signature path")
+	}
+}
@@ -0,0 +1,261 @@
+package sigtool
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mozilla.org/pkcs7"
+)
+
+var (
+	// Unauthenticated attributes that carry a timestamp countersignature
+	oidCounterSignature  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 6}
+	oidRFC3161Timestamp  = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 3, 3, 1}
+	timestampAttributeID = []asn1.ObjectIdentifier{oidCounterSignature, oidRFC3161Timestamp}
+)
+
+// FieldDiff describes how a single aspect of a signature differs between two files.
+type FieldDiff struct {
+	// Changed reports whether Before and After differ
+	Changed bool
+	// Before is the value for the first file
+	Before string
+	// After is the value for the second file
+	After string
+}
+
+// SignatureRelation classifies how the signatures of two files relate.
+type SignatureRelation string
+
+const (
+	// RelationIdentical means both files carry the same signature bytes and
+	// their contents match it
+	RelationIdentical SignatureRelation = "identical"
+	// RelationCopied means both files carry the same signature bytes but
+	// the contents of at least one do not match it: the signature was
+	// copied from one file to the other
+	RelationCopied SignatureRelation = "copied"
+	// RelationTimestampOnly means the signer signed the same content with
+	// the same signature and only the unsigned attributes, such as the
+	// timestamp, differ
+	RelationTimestampOnly SignatureRelation = "timestamp-only"
+	// RelationDifferent means the files were signed separately
+	RelationDifferent SignatureRelation = "different"
+)
+
+// SignatureDiff reports what changed between the signatures of two PE files.
+type SignatureDiff struct {
+	// Signer compares the subject and serial number of the signing certificate
+	Signer FieldDiff
+	// Algorithm compares the Authenticode digest algorithm
+	Algorithm FieldDiff
+	// Timestamp compares whether a timestamp countersignature is present
+	Timestamp FieldDiff
+	// TimestampTime compares the type and time of the timestamp
+	TimestampTime FieldDiff
+	// CertificateChain compares the SHA-256 thumbprints of the embedded certificates
+	CertificateChain FieldDiff
+	// ContentDigest compares the signed Authenticode digest of the file contents
+	ContentDigest FieldDiff
+	// RawSignature compares the SHA-256 of the PKCS#7 signature bytes
+	RawSignature FieldDiff
+	// Relation classifies how the two signatures relate
+	Relation SignatureRelation
+}
+
+// Changed reports whether any aspect of the signature differs.
+func (d *SignatureDiff) Changed() bool {
+	return d.Signer.Changed || d.Algorithm.Changed || d.Timestamp.Changed ||
+		d.TimestampTime.Changed || d.CertificateChain.Changed || d.ContentDigest.Changed ||
+		d.RawSignature.Changed
+}
+
+// String renders the diff in a human-readable form suitable for CLI output.
+func (d *SignatureDiff) String() string {
+	var b strings.Builder
+	fields := []struct {
+		name string
+		diff FieldDiff
+	}{
+		{"Signer", d.Signer},
+		{"Algorithm", d.Algorithm},
+		{"Timestamp", d.Timestamp},
+		{"Timestamp time", d.TimestampTime},
+		{"Certificate chain", d.CertificateChain},
+		{"Content digest", d.ContentDigest},
+		{"Raw signature", d.RawSignature},
+	}
+	for _, f := range fields {
+		if f.diff.Changed {
+			fmt.Fprintf(&b, "%s: changed\n  before: %s\n  after:  %s\n", f.name, f.diff.Before, f.diff.After)
+		} else {
+			fmt.Fprintf(&b, "%s: unchanged (%s)\n", f.name, f.diff.Before)
+		}
+	}
+	if d.Relation != "" {
+		fmt.Fprintf(&b, "Relation: %s\n", d.Relation)
+	}
+	return b.String()
+}
+
+// DiffSignatures compares the signatures of two PE files and reports which
+// aspects of how they are signed differ.
+//
+// This is intended for release auditing: comparing a new build against the
+// previous one answers whether the signer, digest algorithm, timestamping,
+// certificate chain or signed content changed between releases. For triage
+// the Relation tells whether one signature was copied to the other file or
+// whether only the timestamp differs.
+//
+// Parameters:
+//   - fileA: The path to the first (previous) PE file
+//   - fileB: The path to the second (new) PE file
+//
+// Returns:
+//   - *SignatureDiff: The per-field comparison
+//   - error: An error if either signature cannot be extracted or parsed
+//
+// Example usage:
+//
+//	diff, err := sigtool.DiffSignatures("v1.exe", "v2.exe")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	if diff.Signer.Changed {
+//	    fmt.Printf("Signer changed from %s to %s\n", diff.Signer.Before, diff.Signer.After)
+//	}
+func DiffSignatures(fileA, fileB string) (*SignatureDiff, error) {
+	before, err := loadSignatureState(fileA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signature of %q: %w", fileA, err)
+	}
+	after, err := loadSignatureState(fileB)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signature of %q: %w", fileB, err)
+	}
+	return diffStates(before, after), nil
+}
+
+// diffStates compares the signatures before and after
+func diffStates(before, after *signatureState) *SignatureDiff {
+	return &SignatureDiff{
+		Signer:           compareField(before.signer, after.signer),
+		Algorithm:        compareField(before.algorithm, after.algorithm),
+		Timestamp:        compareField(before.timestamp, after.timestamp),
+		TimestampTime:    compareField(before.timestampTime, after.timestampTime),
+		CertificateChain: compareField(before.chain, after.chain),
+		ContentDigest:    compareField(before.digest, after.digest),
+		RawSignature:     compareField(before.raw, after.raw),
+		Relation:         relation(before, after),
+	}
+}
+
+// relation classifies the signatures before and after
+func relation(before, after *signatureState) SignatureRelation {
+	switch {
+	case before.raw == after.raw && before.digestMatch && after.digestMatch:
+		return RelationIdentical
+	case before.raw == after.raw:
+		return RelationCopied
+	case before.digest == after.digest && before.signerSignature != "" && before.signerSignature == after.signerSignature:
+		return RelationTimestampOnly
+	default:
+		return RelationDifferent
+	}
+}
+
+// signatureState is the comparable summary of a single file's signature
+type signatureState struct {
+	signer        string
+	algorithm     string
+	timestamp     string
+	timestampTime string
+	chain         string
+	digest        string
+	// raw is the SHA-256 of the signature bytes
+	raw string
+	// signerSignature is the signature value of the primary signer, which
+	// covers the signed attributes but not the timestamp
+	signerSignature string
+	// digestMatch reports whether the file contents match the signature
+	digestMatch bool
+}
+
+func loadSignatureState(filePath string) (*signatureState, error) {
+	bundle, err := ExtractWithDigests(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return newSignatureState(bundle)
+}
+
+// newSignatureState summarises the signature of bundle
+func newSignatureState(bundle *SignatureBundle) (*signatureState, error) {
+	p7, err := parsePKCS7(bundle.RawSignature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS#7 signature: %w", err)
+	}
+
+	rawSum := sha256.Sum256(bundle.RawSignature)
+	state := &signatureState{
+		signer:        "none",
+		algorithm:     bundle.StoredAlgorithm.String(),
+		timestamp:     "absent",
+		timestampTime: "none",
+		chain:         certificateThumbprints(p7.Certificates),
+		digest:        hex.EncodeToString(bundle.StoredDigest),
+		raw:           hex.EncodeToString(rawSum[:]),
+		digestMatch:   bundle.DigestMatch,
+	}
+	if signer := p7.GetOnlySigner(); signer != nil {
+		state.signer = fmt.Sprintf("%s (serial %s)", signer.Subject, signer.SerialNumber)
+	}
+	if len(p7.Signers) > 0 {
+		state.signerSignature = hex.EncodeToString(p7.Signers[0].EncryptedDigest)
+	}
+	if hasTimestamp(p7) {
+		state.timestamp = "present"
+		state.timestampTime = "unreadable"
+		if ts, err := parseTimestamp(p7); err == nil && ts != nil {
+			state.timestampTime = fmt.Sprintf("%s %s", ts.Type, ts.Time.UTC().Format(time.RFC3339))
+		}
+	}
+
+	return state, nil
+}
+
+func compareField(before, after string) FieldDiff {
+	return FieldDiff{Changed: before != after, Before: before, After: after}
+}
+
+// certificateThumbprints lists the SHA-256 thumbprints of certs in order
+func certificateThumbprints(certs []*x509.Certificate) string {
+	if len(certs) == 0 {
+		return "none"
+	}
+	prints := make([]string, 0, len(certs))
+	for _, cert := range certs {
+		sum := sha256.Sum256(cert.Raw)
+		prints = append(prints, hex.EncodeToString(sum[:]))
+	}
+	return strings.Join(prints, ", ")
+}
+
+// hasTimestamp reports whether any signer carries a timestamp countersignature
+func hasTimestamp(p7 *pkcs7.PKCS7) bool {
+	for _, signer := range p7.Signers {
+		for _, attr := range signer.UnauthenticatedAttributes {
+			for _, oid := range timestampAttributeID {
+				if attr.Type.Equal(oid) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
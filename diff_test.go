@@ -0,0 +1,106 @@
+package sigtool
+
+import (
+	"crypto"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffSignatures_Identical(t *testing.T) {
+	fileA, _ := createSignedMockPE(t, crypto.SHA256)
+	fileB, _ := createSignedMockPE(t, crypto.SHA256)
+
+	diff, err := DiffSignatures(fileA, fileB)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if diff.Changed() {
+		t.Errorf("Expected no changes, got:\n%s", diff)
+	}
+	if !strings.Contains(diff.Signer.Before, "sigtool test signer") {
+		t.Errorf("Expected signer subject in diff, got %q", diff.Signer.Before)
+	}
+	if diff.Timestamp.Before != "absent" {
+		t.Errorf("Expected timestamp to be absent, got %q", diff.Timestamp.Before)
+	}
+}
+
+func TestDiffSignatures_ContentAndAlgorithmChanged(t *testing.T) {
+	fileA, _ := createSignedMockPEWithPayload(t, crypto.SHA1, []byte("release-1"))
+	fileB, _ := createSignedMockPEWithPayload(t, crypto.SHA256, []byte("release-2"))
+
+	diff, err := DiffSignatures(fileA, fileB)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if !diff.Algorithm.Changed || diff.Algorithm.Before != "SHA-1" || diff.Algorithm.After != "SHA-256" {
+		t.Errorf("Expected algorithm change SHA-1 -> SHA-256, got %+v", diff.Algorithm)
+	}
+	if !diff.ContentDigest.Changed {
+		t.Error("Expected content digest change")
+	}
+	if diff.Signer.Changed || diff.CertificateChain.Changed || diff.Timestamp.Changed {
+		t.Errorf("Expected signer, chain and timestamp to be unchanged, got:\n%s", diff)
+	}
+
+	out := diff.String()
+	if !strings.Contains(out, "Algorithm: changed") || !strings.Contains(out, "Signer: unchanged") {
+		t.Errorf("Unexpected rendering:\n%s", out)
+	}
+}
+
+func TestDiffSignatures_UnsignedFile(t *testing.T) {
+	signed, _ := createSignedMockPE(t, crypto.SHA256)
+	unsigned := createMockPEFile(t, false, nil)
+
+	_, err := DiffSignatures(signed, unsigned)
+	if err == nil {
+		t.Fatal("Expected error for unsigned file, got nil")
+	}
+	if !strings.Contains(err.Error(), "not digitally signed") {
+		t.Errorf("Expected 'not digitally signed' error, got: %v", err)
+	}
+}
+
+func TestDiffSignatures_Relation(t *testing.T) {
+	original, _ := createSignedMockPEWithPayload(t, crypto.SHA256, []byte("release-1"))
+	if diff, err := DiffSignatures(original, original); err != nil || diff.Relation != RelationIdentical {
+		t.Errorf("Expected identical signatures, got %v (error %v)", diff, err)
+	}
+
+	// A signature transplanted onto another binary no longer matches it
+	target, _ := createSignedMockPEWithPayload(t, crypto.SHA256, []byte("release-2"))
+	if err := CopySignature(original, target); err != nil {
+		t.Fatalf("Failed to copy signature: %v", err)
+	}
+	diff, err := DiffSignatures(original, target)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if diff.Relation != RelationCopied || diff.RawSignature.Changed {
+		t.Errorf("Expected a copied signature, got:\n%s", diff)
+	}
+}
+
+func TestDiffSignatures_TimestampOnly(t *testing.T) {
+	payload := []byte("release-1")
+	first := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	fileA, _ := createSignedMockPEWithPayload(t, crypto.SHA256, payload, withRFC3161Timestamp(t, first))
+	fileB, _ := createSignedMockPEWithPayload(t, crypto.SHA256, payload, withRFC3161Timestamp(t, first.Add(time.Hour)))
+
+	diff, err := DiffSignatures(fileA, fileB)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if diff.Relation != RelationTimestampOnly {
+		t.Errorf("Expected only the timestamp to differ, got:\n%s", diff)
+	}
+	if !diff.TimestampTime.Changed || diff.TimestampTime.Before != "RFC3161 2024-01-02T03:04:05Z" {
+		t.Errorf("Expected the timestamp time to change, got %+v", diff.TimestampTime)
+	}
+	if diff.ContentDigest.Changed || diff.Signer.Changed {
+		t.Errorf("Expected the signed content and signer to be unchanged, got:\n%s", diff)
+	}
+}
@@ -0,0 +1,142 @@
+package sigtool
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// UDIF disk images end with a 512-byte "koly" trailer, which locates the
+// code signature of a signed image
+const (
+	udifTrailerSize    = 512
+	udifTrailerMagic   = "koly"
+	udifTrailerVersion = 4
+	// Offsets of the code signature offset and length in the trailer
+	udifCodeSignatureOffsetAt = 296
+	udifCodeSignatureLengthAt = 304
+	// Offsets of the data fork, resource fork and XML plist offset and
+	// length pairs in the trailer
+	udifDataForkAt     = 24
+	udifResourceForkAt = 40
+	udifXMLAt          = 216
+
+	// csSlotRepSpecific is the special slot of a disk image signature
+	// hashing the koly trailer
+	csSlotRepSpecific = 6
+)
+
+// udifTrailer is the koly trailer of a UDIF disk image
+type udifTrailer struct {
+	raw                 []byte
+	codeSignatureOffset int64
+	codeSignatureLength int64
+}
+
+// isDiskImage reports whether r ends with a UDIF koly trailer whose data
+// fork, resource fork and XML plist lie before it, so that other files
+// carrying such a trailer as trailing data are not taken for disk images
+func isDiskImage(r io.ReaderAt, size int64) bool {
+	trailer, err := readUDIFTrailer(r, size)
+	if err != nil {
+		return false
+	}
+	end := uint64(size - udifTrailerSize)
+	for _, at := range []int{udifDataForkAt, udifResourceForkAt, udifXMLAt} {
+		offset, length := binary.BigEndian.Uint64(trailer.raw[at:]), binary.BigEndian.Uint64(trailer.raw[at+8:])
+		if offset > end || length > end-offset {
+			return false
+		}
+	}
+	return true
+}
+
+// readUDIFTrailer reads the koly trailer at the end of the disk image r
+func readUDIFTrailer(r io.ReaderAt, size int64) (*udifTrailer, error) {
+	if size < udifTrailerSize {
+		return nil, errors.New("not a UDIF disk image")
+	}
+	raw := make([]byte, udifTrailerSize)
+	if _, err := r.ReadAt(raw, size-udifTrailerSize); err != nil {
+		return nil, fmt.Errorf("failed to read disk image trailer: %w", err)
+	}
+	if !bytes.Equal(raw[:4], []byte(udifTrailerMagic)) ||
+		binary.BigEndian.Uint32(raw[4:]) != udifTrailerVersion ||
+		binary.BigEndian.Uint32(raw[8:]) != udifTrailerSize {
+		return nil, errors.New("not a UDIF disk image")
+	}
+	return &udifTrailer{
+		raw:                 raw,
+		codeSignatureOffset: int64(binary.BigEndian.Uint64(raw[udifCodeSignatureOffsetAt:])),
+		codeSignatureLength: int64(binary.BigEndian.Uint64(raw[udifCodeSignatureLengthAt:])),
+	}, nil
+}
+
+// readDMGCodeSignature reads the embedded code signature that the koly
+// trailer of the disk image r locates
+func readDMGCodeSignature(r io.ReaderAt, size int64) (*codeSignature, *udifTrailer, error) {
+	trailer, err := readUDIFTrailer(r, size)
+	if err != nil {
+		return nil, nil, err
+	}
+	offset, length := trailer.codeSignatureOffset, trailer.codeSignatureLength
+	if length == 0 {
+		return nil, nil, fmt.Errorf("%w (disk image has no code signature)", ErrNotSigned)
+	}
+	if length > maxCodeSignatureSize {
+		return nil, nil, &SignatureSizeError{Size: length, Limit: maxCodeSignatureSize}
+	}
+	if offset < 0 || length < 0 || offset+length > size-udifTrailerSize {
+		return nil, nil, &SignatureBoundsError{
+			Offset: offset, Length: length, FileSize: size,
+			Reason: "disk image code signature exceeds the image",
+		}
+	}
+	data := make([]byte, length)
+	if _, err := r.ReadAt(data, offset); err != nil {
+		return nil, nil, fmt.Errorf("failed to read code signature: %w", err)
+	}
+	sig, err := parseCodeSignature(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sig, trailer, nil
+}
+
+// signedTrailer returns the koly trailer as the rep-specific special slot
+// hashes it: with the code signature offset and length zeroed, since they
+// are only known once the signature is written
+func (t *udifTrailer) signedTrailer() []byte {
+	signed := append([]byte(nil), t.raw...)
+	clear(signed[udifCodeSignatureOffsetAt : udifCodeSignatureLengthAt+8])
+	return signed
+}
+
+// readDMGSignature returns the CMS signature of the disk image r
+func readDMGSignature(r io.ReaderAt, size int64) ([]byte, error) {
+	sig, _, err := readDMGCodeSignature(r, size)
+	if err != nil {
+		return nil, err
+	}
+	if len(sig.cms) == 0 {
+		return nil, fmt.Errorf("%w (disk image is ad-hoc signed)", ErrNotSigned)
+	}
+	return sig.cms, nil
+}
+
+// verifyDMG verifies the code signature of the disk image r like a Mach-O
+// slice: the code directory hashes the image up to its signature, and its
+// rep-specific special slot the koly trailer
+func verifyDMG(r io.ReaderAt, size int64, opts VerifyOptions) error {
+	sig, trailer, err := readDMGCodeSignature(r, size)
+	if err != nil {
+		return fmt.Errorf("failed to extract signature: %w", err)
+	}
+	sig.special[csSlotRepSpecific] = trailer.signedTrailer()
+	cd := sig.directories[0]
+	opts.logger().Debug("read disk image code signature", "fileSize", size, "offset", trailer.codeSignatureOffset, "size", trailer.codeSignatureLength, "identifier", cd.identifier)
+	_, err = verifyCodeSignature(sig, io.NewSectionReader(r, 0, trailer.codeSignatureOffset), "disk image", opts)
+	return err
+}
@@ -0,0 +1,113 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// dmgForTest returns a UDIF disk image of data with a code signature over
+// it by machoIdentityForTest, or an ad-hoc one unless signed is set,
+// carrying a stapled ticket when ticket is set, and the CDHash of the
+// signature
+func dmgForTest(t testing.TB, data []byte, signed, ticket bool) ([]byte, []byte) {
+	t.Helper()
+	trailer := make([]byte, udifTrailerSize)
+	copy(trailer, udifTrailerMagic)
+	binary.BigEndian.PutUint32(trailer[4:], udifTrailerVersion)
+	binary.BigEndian.PutUint32(trailer[8:], udifTrailerSize)
+	copy(trailer[64:], "data fork")
+	binary.BigEndian.PutUint64(trailer[udifDataForkAt+8:], uint64(len(data)))
+
+	cd := codeDirectoryForTest(data, crypto.SHA256, map[uint32][]byte{csSlotRepSpecific: trailer})
+	var cms []byte
+	if signed {
+		id, _ := machoIdentityForTest(t)
+		cms = signDetachedForTest(t, id, cd)
+	}
+	slots, blobs := []uint32{csSlotCodeDirectory, csSlotSignature}, [][]byte{cd, blobWrapperForTest(cms)}
+	if ticket {
+		slots, blobs = append(slots, csSlotTicket), append(blobs, ticketForTest(cdHashForTest(cd)))
+	}
+	signature := superBlobForTest(slots, blobs)
+
+	binary.BigEndian.PutUint64(trailer[udifCodeSignatureOffsetAt:], uint64(len(data)))
+	binary.BigEndian.PutUint64(trailer[udifCodeSignatureLengthAt:], uint64(len(signature)))
+	image := append(append(append([]byte(nil), data...), signature...), trailer...)
+	return image, cdHashForTest(cd)
+}
+
+func TestVerify_DiskImage(t *testing.T) {
+	data := bytes.Repeat([]byte("disk image data "), 1024)
+	image, _ := dmgForTest(t, data, true, false)
+	filePath := writeScriptForTest(t, "image.dmg", image)
+	if fileType, err := DetectFileType(filePath); err != nil || fileType != FileTypeDMG {
+		t.Fatalf("Expected FileTypeDMG, got %q, %v", fileType, err)
+	}
+	opts := &VerifyOptions{Roots: machoRootsForTest(t), RequiredTeamID: "ABCDE12345"}
+	if err := Verify(filePath, opts); err != nil {
+		t.Fatalf("Expected valid disk image signature, got %v", err)
+	}
+	if signature, err := ExtractDigitalSignature(filePath); err != nil || len(signature) == 0 {
+		t.Errorf("Expected the CMS signature of the disk image, got %v", err)
+	}
+
+	tampered := append([]byte(nil), image...)
+	tampered[5000] ^= 0xff
+	if err := Verify(writeScriptForTest(t, "image.dmg", tampered), opts); !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("Expected ErrDigestMismatch for modified image data, got %v", err)
+	}
+
+	// The trailer is covered by the rep-specific special slot
+	tampered = append([]byte(nil), image...)
+	tampered[len(tampered)-udifTrailerSize+64] ^= 0xff
+	if err := Verify(writeScriptForTest(t, "image.dmg", tampered), opts); !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("Expected ErrDigestMismatch for a modified trailer, got %v", err)
+	}
+
+	adHoc, _ := dmgForTest(t, data, false, false)
+	if err := Verify(writeScriptForTest(t, "image.dmg", adHoc), nil); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned for an ad-hoc signed disk image, got %v", err)
+	}
+	if _, err := ExtractDigitalSignature(writeScriptForTest(t, "image.dmg", adHoc)); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned extracting an ad-hoc signature, got %v", err)
+	}
+}
+
+func TestVerify_DiskImageBounds(t *testing.T) {
+	image, _ := dmgForTest(t, []byte("disk image data"), true, false)
+	binary.BigEndian.PutUint64(image[len(image)-udifTrailerSize+udifCodeSignatureLengthAt:], uint64(len(image)))
+	var boundsErr *SignatureBoundsError
+	if err := Verify(writeScriptForTest(t, "image.dmg", image), nil); !errors.As(err, &boundsErr) {
+		t.Errorf("Expected SignatureBoundsError for a signature past the trailer, got %v", err)
+	}
+}
+
+func TestDetectFileType_UDIFTrailer(t *testing.T) {
+	image, _ := dmgForTest(t, []byte("disk image data"), true, false)
+	trailer := image[len(image)-udifTrailerSize:]
+
+	// A PE carrying a koly trailer as overlay data is still a PE
+	pe := writeScriptForTest(t, "signed.exe", append(signedPEForTest(t, []byte("overlay")), trailer...))
+	if fileType, err := DetectFileType(pe); err != nil || fileType != FileTypePE {
+		t.Fatalf("Expected FileTypePE, got %q, %v", fileType, err)
+	}
+	if err := Verify(pe, nil); err != nil {
+		t.Errorf("Expected the PE to verify, got %v", err)
+	}
+
+	// The forks the trailer locates must lie before it
+	for _, at := range []int{udifDataForkAt, udifResourceForkAt, udifXMLAt} {
+		bad := append([]byte(nil), image...)
+		binary.BigEndian.PutUint64(bad[len(bad)-udifTrailerSize+at:], uint64(len(bad)))
+		binary.BigEndian.PutUint64(bad[len(bad)-udifTrailerSize+at+8:], 1)
+		if fileType, err := DetectFileType(writeScriptForTest(t, "image.dmg", bad)); err != nil || fileType != FileTypeUnknown {
+			t.Errorf("Field at %d: expected FileTypeUnknown for a fork past the trailer, got %q, %v", at, fileType, err)
+		}
+	}
+	if fileType, err := DetectFileType(writeScriptForTest(t, "image.dmg", image)); err != nil || fileType != FileTypeDMG {
+		t.Errorf("Expected FileTypeDMG, got %q, %v", fileType, err)
+	}
+}
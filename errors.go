@@ -0,0 +1,285 @@
+package sigtool
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Sentinel errors returned (possibly wrapped) by the extraction and
+// verification functions. Use errors.Is to test for them.
+var (
+	// ErrNotSigned indicates that the PE file has no security directory
+	ErrNotSigned = errors.New("PE file is not digitally signed")
+	// ErrNotPE indicates that the input could not be parsed as a PE file
+	ErrNotPE = errors.New("not a valid PE file")
+	// ErrSignatureTruncated indicates that the certificate table lies
+	// outside the file or could not be read completely
+	ErrSignatureTruncated = errors.New("signature data is truncated")
+	// ErrSignatureTooLarge indicates that the certificate table exceeds MaxSignatureSize
+	ErrSignatureTooLarge = errors.New("signature is too large")
+	// ErrDigestMismatch indicates that the file contents do not match the
+	// Authenticode digest recorded in the signature
+	ErrDigestMismatch = errors.New("file digest does not match signed digest")
+	// ErrMessageDigestMismatch indicates that the signed messageDigest
+	// attribute does not match the digest of the signed SpcIndirectDataContent
+	ErrMessageDigestMismatch = errors.New("messageDigest attribute does not match the signed content")
+	// ErrInvalidSignature indicates that the signer's signature over the
+	// authenticated attributes does not verify
+	ErrInvalidSignature = errors.New("signature verification failed")
+	// ErrChainVerification indicates that the signer certificate does not
+	// chain to a trusted root under the requested options
+	ErrChainVerification = errors.New("certificate chain verification failed")
+	// ErrMicrosoftRootsUnavailable indicates that the embedded Microsoft root
+	// bundle was requested from a build without the sigtool_msroots tag
+	ErrMicrosoftRootsUnavailable = errors.New("embedded Microsoft roots are not available; rebuild with -tags sigtool_msroots")
+	// ErrWindowsStoresUnavailable indicates that the Windows certificate
+	// stores were requested on another platform
+	ErrWindowsStoresUnavailable = errors.New("windows certificate stores are only available on Windows")
+	// ErrUntrustedPublisher indicates that the signer certificate is not in
+	// the Windows TrustedPublisher store
+	ErrUntrustedPublisher = errors.New("signer certificate is not a trusted publisher")
+	// ErrNotCodeSigning indicates that the signer certificate does not carry
+	// the Code Signing extended key usage
+	ErrNotCodeSigning = errors.New("signer certificate is not valid for code signing")
+	// ErrCertificateRevoked indicates that a certificate of the signer or
+	// timestamp authority chain was revoked before the verification time
+	ErrCertificateRevoked = errors.New("certificate has been revoked")
+	// ErrRevocationUnknown indicates that a hard-fail revocation check could
+	// not determine the status of a certificate
+	ErrRevocationUnknown = errors.New("certificate revocation status is unknown")
+	// ErrSignerCertificateNotFound indicates that no embedded certificate
+	// matches the issuer and serial number of the SignerInfo
+	ErrSignerCertificateNotFound = errors.New("signer certificate is not embedded in the signature")
+	// ErrPKCS11Unavailable indicates that a PKCS#11 signer was requested
+	// from a build without cgo or the sigtool_pkcs11 tag
+	ErrPKCS11Unavailable = errors.New("PKCS#11 signing is not available; rebuild with cgo and -tags sigtool_pkcs11")
+	// ErrCertificateSlack indicates that the certificate table holds data
+	// beyond the PKCS#7 signature other than alignment padding
+	ErrCertificateSlack = errors.New("certificate table contains data beyond the signature")
+	// ErrUnsupportedCertificateType indicates that the first certificate
+	// table entry is not a WIN_CERT_TYPE_PKCS_SIGNED_DATA signature
+	ErrUnsupportedCertificateType = errors.New("certificate table entry is not a PKCS#7 signature")
+	// ErrWeakCrypto indicates that the signature relies on MD5, SHA-1, short
+	// RSA keys or DSA and RejectWeakCrypto is set
+	ErrWeakCrypto = errors.New("signature uses weak cryptography")
+	// ErrDeniedCertificate indicates that a certificate of the signature is
+	// on the denylist of VerifyOptions
+	ErrDeniedCertificate = errors.New("certificate is on the denylist")
+	// ErrSignerNotPinned indicates that the signer certificate does not match
+	// the RequiredThumbprints or RequiredSubjects of VerifyOptions
+	ErrSignerNotPinned = errors.New("signer certificate does not match the pinned signer")
+	// ErrNoVersionInfo indicates that the PE file has no VERSIONINFO
+	// resource
+	ErrNoVersionInfo = errors.New("PE file has no VERSIONINFO resource")
+	// ErrNotCompoundFile indicates that a Windows Installer package is not a
+	// parseable OLE compound file
+	ErrNotCompoundFile = errors.New("not a valid compound file")
+	// ErrMSIMetadataMismatch indicates that the MsiDigitalSignatureEx hash
+	// of a Windows Installer package does not match its directory metadata
+	ErrMSIMetadataMismatch = errors.New("MsiDigitalSignatureEx does not match the package metadata")
+	// ErrNotCabinet indicates that a cabinet is not a parseable single
+	// volume cabinet file
+	ErrNotCabinet = errors.New("not a valid cabinet file")
+	// ErrNotZipArchive indicates that a package is not a parseable ZIP
+	// archive or lacks a part its signature covers
+	ErrNotZipArchive = errors.New("not a valid ZIP archive")
+	// ErrBlockMapMismatch indicates that a file of an MSIX or APPX package
+	// does not match the block map the package signature covers
+	ErrBlockMapMismatch = errors.New("package contents do not match the block map")
+	// ErrPublisherMismatch indicates that the publisher an MSIX or APPX
+	// package declares is not the subject of its signer certificate, so
+	// Windows refuses to install it
+	ErrPublisherMismatch = errors.New("package publisher does not match the signer")
+	// ErrUnsignedPart indicates that a part of a signed OPC package, such as
+	// a VSIX extension, or an entry of a signed JAR is not covered by its
+	// signatures, as when a file is added after signing
+	ErrUnsignedPart = errors.New("package part is not covered by the signature")
+	// ErrTeamIDMismatch indicates that the Team ID of a Mach-O code
+	// directory is not the organizational unit of its signer, or not the
+	// one VerifyOptions.RequiredTeamID requires
+	ErrTeamIDMismatch = errors.New("team identifier does not match")
+	// ErrRequirementNotSatisfied indicates that a Mach-O binary does not
+	// satisfy the designated requirement embedded in its code signature
+	ErrRequirementNotSatisfied = errors.New("code does not satisfy its designated requirement")
+	// ErrForbiddenByDBX indicates that the authentihash of an EFI image or
+	// one of its signers is in the Secure Boot forbidden signature database
+	ErrForbiddenByDBX = errors.New("image is forbidden by the Secure Boot dbx")
+	// ErrNotAuthorizedByDB indicates that no signature of an EFI image
+	// chains to the Secure Boot authorized signature database and its
+	// authentihash is not in it either
+	ErrNotAuthorizedByDB = errors.New("image is not authorized by the Secure Boot db")
+	// ErrReleaseExpired indicates that the Valid-Until date of an APT
+	// repository Release file is before the verification time
+	ErrReleaseExpired = errors.New("repository release file has expired")
+)
+
+// PEFormatError is returned when the PE headers cannot be parsed.
+// It matches ErrNotPE with errors.Is.
+type PEFormatError struct {
+	// Err is the underlying parse error
+	Err error
+}
+
+func (e *PEFormatError) Error() string {
+	return fmt.Sprintf("failed to parse PE file: %v", e.Err)
+}
+
+// Unwrap returns the underlying parse error.
+func (e *PEFormatError) Unwrap() error { return e.Err }
+
+// Is reports whether target is ErrNotPE.
+func (e *PEFormatError) Is(target error) bool { return target == ErrNotPE }
+
+// SignatureSizeError is returned when the certificate table is larger than
+// the allowed maximum. It matches ErrSignatureTooLarge with errors.Is.
+type SignatureSizeError struct {
+	// Size is the certificate table size declared in the security directory
+	Size int64
+	// Limit is the maximum accepted size
+	Limit int64
+}
+
+func (e *SignatureSizeError) Error() string {
+	return fmt.Sprintf("signature size %d exceeds maximum allowed size %d", e.Size, e.Limit)
+}
+
+// Is reports whether target is ErrSignatureTooLarge.
+func (e *SignatureSizeError) Is(target error) bool { return target == ErrSignatureTooLarge }
+
+// SignatureBoundsError is returned when the certificate table described by
+// the security directory does not fit in the file. It matches
+// ErrSignatureTruncated with errors.Is.
+type SignatureBoundsError struct {
+	// Offset is the file offset of the signature data
+	Offset int64
+	// Length is the number of signature bytes expected
+	Length int64
+	// FileSize is the size of the file
+	FileSize int64
+	// Reason describes which bounds check failed
+	Reason string
+}
+
+func (e *SignatureBoundsError) Error() string {
+	return e.Reason
+}
+
+// Is reports whether target is ErrSignatureTruncated.
+func (e *SignatureBoundsError) Is(target error) bool { return target == ErrSignatureTruncated }
+
+// CertificateTypeError is returned when the certificate table entry holding
+// the signature is not WIN_CERT_TYPE_PKCS_SIGNED_DATA, for example an
+// X.509 certificate (WinCertTypeX509). The payload is not parsed; callers
+// that understand the type can use Data. It matches
+// ErrUnsupportedCertificateType with errors.Is.
+type CertificateTypeError struct {
+	// Type is the wCertificateType field of the entry
+	Type uint16
+	// Revision is the wRevision field of the entry
+	Revision uint16
+	// Data is the payload following the 8-byte header
+	Data []byte
+}
+
+func (e *CertificateTypeError) Error() string {
+	return fmt.Sprintf("unsupported WIN_CERTIFICATE type %s", certificateTypeName(e.Type))
+}
+
+// Is reports whether target is ErrUnsupportedCertificateType.
+func (e *CertificateTypeError) Is(target error) bool { return target == ErrUnsupportedCertificateType }
+
+// certificateTypeName returns the WIN_CERT_TYPE name of t
+func certificateTypeName(t uint16) string {
+	switch t {
+	case WinCertTypeX509:
+		return "WIN_CERT_TYPE_X509"
+	case WinCertTypePKCSSignedData:
+		return "WIN_CERT_TYPE_PKCS_SIGNED_DATA"
+	case WinCertTypeReserved1:
+		return "WIN_CERT_TYPE_RESERVED_1"
+	case WinCertTypeTSStackSigned:
+		return "WIN_CERT_TYPE_TS_STACK_SIGNED"
+	}
+	return fmt.Sprintf("%#06x", t)
+}
+
+// DigestMismatchError is returned when the Authenticode digest of the file
+// differs from the digest recorded in its signature, for example because the
+// file was modified after signing or the signature was copied from another
+// binary. It matches ErrDigestMismatch with errors.Is.
+type DigestMismatchError struct {
+	// Algorithm is the hash algorithm of both digests
+	Algorithm crypto.Hash
+	// Signed is the digest recorded in the signature
+	Signed []byte
+	// Computed is the digest of the file contents
+	Computed []byte
+}
+
+func (e *DigestMismatchError) Error() string {
+	return fmt.Sprintf("file digest %x does not match signed digest %x", e.Computed, e.Signed)
+}
+
+// Is reports whether target is ErrDigestMismatch.
+func (e *DigestMismatchError) Is(target error) bool { return target == ErrDigestMismatch }
+
+// RevocationError is returned when a certificate of a validated chain has
+// been revoked. It matches ErrCertificateRevoked with errors.Is.
+type RevocationError struct {
+	// Certificate is the revoked certificate
+	Certificate *x509.Certificate
+	// RevokedAt is the revocation time reported by the responder
+	RevokedAt time.Time
+	// Reason is the RFC 5280 CRLReason code
+	Reason int
+}
+
+func (e *RevocationError) Error() string {
+	return fmt.Sprintf("certificate %q (serial %x) was revoked at %s", e.Certificate.Subject, e.Certificate.SerialNumber, e.RevokedAt.UTC().Format(time.RFC3339))
+}
+
+// Is reports whether target is ErrCertificateRevoked.
+func (e *RevocationError) Is(target error) bool { return target == ErrCertificateRevoked }
+
+// DeniedCertificateError is returned when a certificate of the signature or
+// its validated chain is on the denylist. It matches ErrDeniedCertificate
+// with errors.Is.
+type DeniedCertificateError struct {
+	// Certificate is the denied certificate
+	Certificate *x509.Certificate
+	// Entry is the denylist entry it matched
+	Entry DenylistEntry
+}
+
+func (e *DeniedCertificateError) Error() string {
+	msg := fmt.Sprintf("certificate %q (serial %x) is on the denylist", e.Certificate.Subject, e.Certificate.SerialNumber)
+	if e.Entry.Description != "" {
+		msg += ": " + e.Entry.Description
+	}
+	return msg
+}
+
+// Is reports whether target is ErrDeniedCertificate.
+func (e *DeniedCertificateError) Is(target error) bool { return target == ErrDeniedCertificate }
+
+// PanicError is returned by VerifyAll for a file whose verification
+// panicked, so that one file does not stop the batch. The parsers return
+// errors for the malformed inputs they recognise, so a panic is a bug; it
+// matches ErrInvalidSignature with errors.Is, as the file cannot be
+// trusted, and is reported with ReasonMalformedSignature.
+type PanicError struct {
+	// Value is the value passed to panic
+	Value interface{}
+	// Stack is the stack trace of the panicking goroutine
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("verification panicked: %v", e.Value)
+}
+
+// Is reports whether target is ErrInvalidSignature.
+func (e *PanicError) Is(target error) bool { return target == ErrInvalidSignature }
@@ -0,0 +1,118 @@
+package sigtool
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSentinelErrors_NotSigned(t *testing.T) {
+	_, err := ExtractDigitalSignature(createMockPEFile(t, false, nil))
+	if !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned, got: %v", err)
+	}
+
+	// The sentinel must survive the wrapping done by IsValidDigitalSignature
+	err = IsValidDigitalSignature(createMockPEFile(t, false, nil))
+	if !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected wrapped ErrNotSigned, got: %v", err)
+	}
+}
+
+func TestSentinelErrors_NotPE(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "notpe.txt")
+	if err := os.WriteFile(filePath, []byte("not a PE file"), 0600); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	_, err := ExtractDigitalSignature(filePath)
+	if !errors.Is(err, ErrNotPE) {
+		t.Errorf("Expected ErrNotPE, got: %v", err)
+	}
+
+	var formatErr *PEFormatError
+	if !errors.As(err, &formatErr) || formatErr.Err == nil {
+		t.Errorf("Expected *PEFormatError with underlying error, got: %v", err)
+	}
+}
+
+func TestSentinelErrors_TooLarge(t *testing.T) {
+	_, err := ExtractDigitalSignature(createMockPEFile(t, true, make([]byte, MaxSignatureSize+1)))
+	if !errors.Is(err, ErrSignatureTooLarge) {
+		t.Errorf("Expected ErrSignatureTooLarge, got: %v", err)
+	}
+
+	var sizeErr *SignatureSizeError
+	if !errors.As(err, &sizeErr) || sizeErr.Limit != MaxSignatureSize {
+		t.Errorf("Expected *SignatureSizeError with limit %d, got: %v", MaxSignatureSize, err)
+	}
+}
+
+func TestSentinelErrors_Truncated(t *testing.T) {
+	filePath := createMockPEFile(t, true, []byte("mock-pkcs7-signature-data"))
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	if err := os.WriteFile(filePath, content[:len(content)-4], 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	_, err = ExtractDigitalSignature(filePath)
+	if !errors.Is(err, ErrSignatureTruncated) {
+		t.Errorf("Expected ErrSignatureTruncated, got: %v", err)
+	}
+
+	var boundsErr *SignatureBoundsError
+	if !errors.As(err, &boundsErr) || boundsErr.FileSize != int64(len(content)-4) {
+		t.Errorf("Expected *SignatureBoundsError with file size %d, got: %v", len(content)-4, err)
+	}
+}
+
+func TestSentinelErrors_MessageDigestMismatch(t *testing.T) {
+	// Replace the messageDigest attribute and re-sign, so only the
+	// attribute no longer matches the signed content
+	filePath, _ := createSignedMockPEWithPayload(t, crypto.SHA256, []byte("payload"), func(si *testSignerInfo) {
+		for i, attr := range si.AuthenticatedAttributes {
+			if attr.Type.Equal(oidAttributeMessageDigest) {
+				si.AuthenticatedAttributes[i] = testAttr(t, oidAttributeMessageDigest, make([]byte, 32))
+			}
+		}
+		si.EncryptedDigest = signAttributesForTest(t, si.AuthenticatedAttributes, crypto.SHA256)
+	})
+
+	err := IsValidDigitalSignature(filePath)
+	if !errors.Is(err, ErrMessageDigestMismatch) {
+		t.Errorf("Expected ErrMessageDigestMismatch, got: %v", err)
+	}
+	if errors.Is(err, ErrInvalidSignature) || errors.Is(err, ErrChainVerification) {
+		t.Errorf("Expected only the messageDigest failure, got: %v", err)
+	}
+}
+
+func TestSentinelErrors_InvalidSignature(t *testing.T) {
+	filePath, _ := createSignedMockPEWithPayload(t, crypto.SHA256, []byte("payload"), func(si *testSignerInfo) {
+		si.EncryptedDigest[0] ^= 0xff
+	})
+
+	err := IsValidDigitalSignature(filePath)
+	if !errors.Is(err, ErrInvalidSignature) || errors.Is(err, ErrMessageDigestMismatch) {
+		t.Errorf("Expected ErrInvalidSignature, got: %v", err)
+	}
+}
+
+func TestSentinelErrors_ChainVerification(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+
+	err := Verify(filePath, &VerifyOptions{Roots: x509.NewCertPool()})
+	if !errors.Is(err, ErrChainVerification) {
+		t.Errorf("Expected ErrChainVerification, got: %v", err)
+	}
+	var authorityErr x509.UnknownAuthorityError
+	if !errors.As(err, &authorityErr) {
+		t.Errorf("Expected the underlying x509 error to be preserved, got: %v", err)
+	}
+}
@@ -0,0 +1,272 @@
+package sigtool
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// eslHeaderSize is the size of an EFI_SIGNATURE_LIST header: the signature
+// type GUID and the list, header and signature sizes
+const eslHeaderSize = 28
+
+// GUID is a UEFI GUID as stored in firmware structures: the first three
+// fields are little-endian.
+type GUID [16]byte
+
+// String returns the GUID in its canonical lowercase form.
+func (g GUID) String() string {
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+		binary.LittleEndian.Uint32(g[0:]), binary.LittleEndian.Uint16(g[4:]), binary.LittleEndian.Uint16(g[6:]), g[8:10], g[10:])
+}
+
+// ParseGUID parses a GUID in its canonical form, with or without braces.
+//
+// Parameters:
+//   - s: The GUID, such as "77fa9abd-0359-4d32-bd60-28f4e78f784b"
+//
+// Returns:
+//   - GUID: The GUID in its firmware encoding
+//   - error: An error if s is not a GUID
+//
+// Example usage:
+//
+//	owner, err := sigtool.ParseGUID("77fa9abd-0359-4d32-bd60-28f4e78f784b")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+func ParseGUID(s string) (GUID, error) {
+	var g GUID
+	parts := strings.Split(strings.Trim(s, "{}"), "-")
+	if len(parts) != 5 || len(parts[0]) != 8 || len(parts[1]) != 4 || len(parts[2]) != 4 || len(parts[3]) != 4 || len(parts[4]) != 12 {
+		return g, fmt.Errorf("invalid GUID %q", s)
+	}
+	raw, err := hex.DecodeString(strings.Join(parts, ""))
+	if err != nil {
+		return g, fmt.Errorf("invalid GUID %q: %w", s, err)
+	}
+	binary.LittleEndian.PutUint32(g[0:], binary.BigEndian.Uint32(raw[0:]))
+	binary.LittleEndian.PutUint16(g[4:], binary.BigEndian.Uint16(raw[4:]))
+	binary.LittleEndian.PutUint16(g[6:], binary.BigEndian.Uint16(raw[6:]))
+	copy(g[8:], raw[8:])
+	return g, nil
+}
+
+// mustParseGUID is ParseGUID for the well-known GUIDs below
+func mustParseGUID(s string) GUID {
+	g, err := ParseGUID(s)
+	if err != nil {
+		panic(err)
+	}
+	return g
+}
+
+// Signature types of EFI_SIGNATURE_LIST entries defined by the UEFI
+// specification
+var (
+	// EFICertSHA256GUID entries are SHA-256 authentihashes of EFI images
+	EFICertSHA256GUID = mustParseGUID("c1c41626-504c-4092-aca9-41f936934328")
+	// EFICertSHA1GUID entries are SHA-1 authentihashes
+	EFICertSHA1GUID = mustParseGUID("826ca512-cf10-4ac9-b187-be01496631bd")
+	// EFICertSHA384GUID entries are SHA-384 authentihashes
+	EFICertSHA384GUID = mustParseGUID("ff3e5307-9fd0-48c9-85f1-8ad56c701e01")
+	// EFICertSHA512GUID entries are SHA-512 authentihashes
+	EFICertSHA512GUID = mustParseGUID("093e0fae-a6c4-4f50-9f1b-d41b2b89c19a")
+	// EFICertRSA2048GUID entries are RSA-2048 public key moduli
+	EFICertRSA2048GUID = mustParseGUID("3c5766e8-269c-4e34-aa14-ed776e85b3b6")
+	// EFICertX509GUID entries are DER-encoded X.509 certificates
+	EFICertX509GUID = mustParseGUID("a5c059a1-94e4-4aa7-87b5-ab155c2bf072")
+	// EFICertX509SHA256GUID entries are the SHA-256 digest of the
+	// TBSCertificate of a certificate followed by the EFI_TIME of its
+	// revocation
+	EFICertX509SHA256GUID = mustParseGUID("3bd2a492-96c0-4079-b420-fcf98ef103ed")
+	// EFICertX509SHA384GUID is EFICertX509SHA256GUID with SHA-384
+	EFICertX509SHA384GUID = mustParseGUID("7076876e-80c2-4ee6-aad2-28b349a6865b")
+	// EFICertX509SHA512GUID is EFICertX509SHA256GUID with SHA-512
+	EFICertX509SHA512GUID = mustParseGUID("446dbf63-2502-4cda-bcfa-2465d2b0fe9d")
+)
+
+// eslSignatureType describes a well-known signature type
+type eslSignatureType struct {
+	name string
+	// hash is the digest of authentihash and X.509 TBS hash entries
+	hash crypto.Hash
+	// size is the fixed size of the entry data, zero for certificates
+	size int
+}
+
+// eslSignatureTypes are the signature types sigtool understands
+var eslSignatureTypes = map[GUID]eslSignatureType{
+	EFICertSHA256GUID:     {name: "EFI_CERT_SHA256_GUID", hash: crypto.SHA256, size: 32},
+	EFICertSHA1GUID:       {name: "EFI_CERT_SHA1_GUID", hash: crypto.SHA1, size: 20},
+	EFICertSHA384GUID:     {name: "EFI_CERT_SHA384_GUID", hash: crypto.SHA384, size: 48},
+	EFICertSHA512GUID:     {name: "EFI_CERT_SHA512_GUID", hash: crypto.SHA512, size: 64},
+	EFICertRSA2048GUID:    {name: "EFI_CERT_RSA2048_GUID", size: 256},
+	EFICertX509GUID:       {name: "EFI_CERT_X509_GUID"},
+	EFICertX509SHA256GUID: {name: "EFI_CERT_X509_SHA256_GUID", hash: crypto.SHA256, size: 32 + 16},
+	EFICertX509SHA384GUID: {name: "EFI_CERT_X509_SHA384_GUID", hash: crypto.SHA384, size: 48 + 16},
+	EFICertX509SHA512GUID: {name: "EFI_CERT_X509_SHA512_GUID", hash: crypto.SHA512, size: 64 + 16},
+}
+
+// EFISignatureList is an EFI_SIGNATURE_LIST: signatures of one type, such
+// as certificates or image hashes, held by a Secure Boot variable.
+type EFISignatureList struct {
+	// Type is the signature type, one of the EFICert GUIDs for the types
+	// the UEFI specification defines
+	Type GUID
+	// Header is the type-specific list header, empty for the defined types
+	Header []byte
+	// Signatures are the entries of the list
+	Signatures []EFISignatureData
+}
+
+// TypeName returns the name of the signature type of l, such as
+// "EFI_CERT_X509_GUID", or its GUID when the type is not well known.
+func (l EFISignatureList) TypeName() string {
+	if t, ok := eslSignatureTypes[l.Type]; ok {
+		return t.name
+	}
+	return l.Type.String()
+}
+
+// EFISignatureData is an EFI_SIGNATURE_DATA entry of a signature list.
+type EFISignatureData struct {
+	// Owner identifies the agent that added the entry, such as
+	// 77fa9abd-0359-4d32-bd60-28f4e78f784b for Microsoft
+	Owner GUID
+	// Data is the signature: a DER certificate, a hash or a TBS hash and
+	// revocation time, depending on the list type
+	Data []byte
+	// Certificate describes the certificate of EFI_CERT_X509_GUID entries,
+	// and is nil for other entries or when Data is not a certificate
+	Certificate *CertificateInfo
+	// RevocationTime is the EFI_TIME of EFI_CERT_X509_SHA256_GUID and the
+	// other TBS hash entries, after which signatures by the certificate are
+	// revoked; zero revokes them all
+	RevocationTime time.Time
+}
+
+// ParseSignatureLists parses the EFI_SIGNATURE_LIST structures packed
+// back to back in data, the contents of the db, dbx, KEK and PK variables
+// and of the .esl files efitools and sbsigntools produce.
+//
+// Entries of the well-known types must have the size the UEFI
+// specification gives; lists of other types are returned unchecked. Empty
+// data, as an empty dbx, holds no lists.
+//
+// Parameters:
+//   - data: The signature lists
+//
+// Returns:
+//   - []EFISignatureList: The lists in order
+//   - error: An error if a list is malformed
+//
+// Example usage:
+//
+//	data, _ := os.ReadFile("db.esl")
+//	lists, err := sigtool.ParseSignatureLists(data)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	for _, l := range lists {
+//	    fmt.Printf("%s: %d entries\n", l.TypeName(), len(l.Signatures))
+//	}
+func ParseSignatureLists(data []byte) ([]EFISignatureList, error) {
+	var lists []EFISignatureList
+	for offset := 0; offset < len(data); {
+		rest := data[offset:]
+		if len(rest) < eslHeaderSize {
+			return nil, fmt.Errorf("truncated signature list at offset %d", offset)
+		}
+		var l EFISignatureList
+		copy(l.Type[:], rest)
+		listSize := int64(binary.LittleEndian.Uint32(rest[16:]))
+		headerSize := int64(binary.LittleEndian.Uint32(rest[20:]))
+		signatureSize := int64(binary.LittleEndian.Uint32(rest[24:]))
+		if listSize < eslHeaderSize+headerSize || listSize > int64(len(rest)) {
+			return nil, fmt.Errorf("signature list at offset %d has invalid size %d", offset, listSize)
+		}
+		entries := listSize - eslHeaderSize - headerSize
+		if signatureSize <= int64(len(GUID{})) || entries%signatureSize != 0 {
+			return nil, fmt.Errorf("signature list at offset %d has invalid signature size %d", offset, signatureSize)
+		}
+		if t, ok := eslSignatureTypes[l.Type]; ok && t.size != 0 && signatureSize != int64(len(GUID{})+t.size) {
+			return nil, fmt.Errorf("%s list at offset %d has signature size %d, want %d", t.name, offset, signatureSize, len(GUID{})+t.size)
+		}
+
+		l.Header = rest[eslHeaderSize : eslHeaderSize+headerSize]
+		for pos := eslHeaderSize + headerSize; pos < listSize; pos += signatureSize {
+			var s EFISignatureData
+			copy(s.Owner[:], rest[pos:])
+			s.Data = rest[pos+int64(len(GUID{})) : pos+signatureSize]
+			switch t := eslSignatureTypes[l.Type]; {
+			case l.Type == EFICertX509GUID:
+				if cert, err := x509.ParseCertificate(s.Data); err == nil {
+					s.Certificate = newCertificateInfo(cert)
+				}
+			case t.hash != 0 && t.size == t.hash.Size()+16:
+				s.RevocationTime = efiTime(s.Data[t.hash.Size():])
+			}
+			l.Signatures = append(l.Signatures, s)
+		}
+		lists = append(lists, l)
+		offset += int(listSize)
+	}
+	return lists, nil
+}
+
+// LoadSignatureLists reads the signature lists of a db, dbx or KEK file:
+// an .esl file, an authenticated variable update (.auth) or a variable
+// read from efivarfs, as LoadSignatureDatabase does.
+//
+// Parameters:
+//   - filePath: The path to the variable file
+//
+// Returns:
+//   - []EFISignatureList: The lists in order
+//   - error: An error if the file cannot be read or is malformed
+//
+// Example usage:
+//
+//	dbx, err := sigtool.LoadSignatureLists("dbxupdate.bin")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+func LoadSignatureLists(filePath string) ([]EFISignatureList, error) {
+	db, err := LoadSignatureDatabase(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return db.Lists, nil
+}
+
+// signatureListCertificates returns the X.509 certificates of lists
+func signatureListCertificates(lists []EFISignatureList) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for _, l := range lists {
+		if l.Type != EFICertX509GUID {
+			continue
+		}
+		for i, s := range l.Signatures {
+			if s.Certificate == nil {
+				return nil, fmt.Errorf("entry %d of an EFI_CERT_X509_GUID list is not a certificate", i)
+			}
+			certs = append(certs, s.Certificate.Certificate)
+		}
+	}
+	return certs, nil
+}
+
+// efiTime decodes an EFI_TIME, returning the zero time for an all-zero or
+// invalid one
+func efiTime(b []byte) time.Time {
+	year := int(binary.LittleEndian.Uint16(b))
+	if year == 0 || b[2] == 0 || b[3] == 0 {
+		return time.Time{}
+	}
+	return time.Date(year, time.Month(b[2]), int(b[3]), int(b[4]), int(b[5]), int(b[6]), int(binary.LittleEndian.Uint32(b[8:])), time.UTC)
+}
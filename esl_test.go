@@ -0,0 +1,94 @@
+package sigtool
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// microsoftOwnerForTest is the owner GUID Microsoft signature list entries
+// carry
+const microsoftOwnerForTest = "77fa9abd-0359-4d32-bd60-28f4e78f784b"
+
+// eslForTest returns an EFI_SIGNATURE_LIST of signatureType holding one
+// entry per data, all of the size of the first
+func eslForTest(t testing.TB, signatureType GUID, data ...[]byte) []byte {
+	t.Helper()
+	owner, err := ParseGUID(microsoftOwnerForTest)
+	if err != nil {
+		t.Fatalf("ParseGUID failed: %v", err)
+	}
+	size := len(GUID{}) + len(data[0])
+	list := append([]byte(nil), signatureType[:]...)
+	list = binary.LittleEndian.AppendUint32(list, uint32(eslHeaderSize+size*len(data)))
+	list = binary.LittleEndian.AppendUint32(list, 0)
+	list = binary.LittleEndian.AppendUint32(list, uint32(size))
+	for _, d := range data {
+		list = append(append(list, owner[:]...), d...)
+	}
+	return list
+}
+
+func TestParseGUID(t *testing.T) {
+	g, err := ParseGUID("{" + microsoftOwnerForTest + "}")
+	if err != nil {
+		t.Fatalf("ParseGUID failed: %v", err)
+	}
+	if !bytes.Equal(g[:4], []byte{0xbd, 0x9a, 0xfa, 0x77}) {
+		t.Errorf("Expected a little-endian first field, got % x", g[:4])
+	}
+	if g.String() != microsoftOwnerForTest {
+		t.Errorf("String() = %q, want %q", g.String(), microsoftOwnerForTest)
+	}
+	for _, s := range []string{"", "77fa9abd-0359-4d32-bd60", "77fa9abd-0359-4d32-bd60-28f4e78f784z"} {
+		if _, err := ParseGUID(s); err == nil {
+			t.Errorf("Expected an error parsing %q", s)
+		}
+	}
+}
+
+func TestParseSignatureLists(t *testing.T) {
+	cert, _ := testSigner(t)
+	hashes := [][]byte{bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)}
+	data := append(eslForTest(t, EFICertX509GUID, cert.Raw), eslForTest(t, EFICertSHA256GUID, hashes...)...)
+
+	lists, err := ParseSignatureLists(data)
+	if err != nil {
+		t.Fatalf("ParseSignatureLists failed: %v", err)
+	}
+	if len(lists) != 2 || lists[0].TypeName() != "EFI_CERT_X509_GUID" || lists[1].TypeName() != "EFI_CERT_SHA256_GUID" {
+		t.Fatalf("Expected an X.509 and a SHA-256 list, got %+v", lists)
+	}
+	if !bytes.Equal(lists[0].Signatures[0].Data, cert.Raw) || lists[0].Signatures[0].Owner.String() != microsoftOwnerForTest {
+		t.Errorf("Unexpected certificate entry %+v", lists[0].Signatures[0])
+	}
+	if len(lists[1].Signatures) != 2 || !bytes.Equal(lists[1].Signatures[1].Data, hashes[1]) {
+		t.Errorf("Unexpected hash entries %+v", lists[1].Signatures)
+	}
+	if lists, err := ParseSignatureLists(nil); err != nil || len(lists) != 0 {
+		t.Errorf("Expected no lists for empty data, got %v, %v", lists, err)
+	}
+
+	unknown := eslForTest(t, GUID{1}, []byte("opaque"))
+	if lists, err := ParseSignatureLists(unknown); err != nil || lists[0].TypeName() != (GUID{1}).String() {
+		t.Errorf("Expected a list of an unknown type to parse, got %+v, %v", lists, err)
+	}
+}
+
+func TestParseSignatureLists_Malformed(t *testing.T) {
+	valid := eslForTest(t, EFICertSHA256GUID, bytes.Repeat([]byte{1}, 32))
+	truncated := valid[:len(valid)-1]
+	wrongSize := eslForTest(t, EFICertSHA256GUID, bytes.Repeat([]byte{1}, 20))
+	uneven := append([]byte(nil), valid...)
+	binary.LittleEndian.PutUint32(uneven[16:], uint32(len(valid)-1))
+	for name, data := range map[string][]byte{
+		"truncated":    truncated,
+		"short header": valid[:eslHeaderSize-1],
+		"hash size":    wrongSize,
+		"partial":      uneven,
+	} {
+		if _, err := ParseSignatureLists(data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
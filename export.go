@@ -0,0 +1,165 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"go.mozilla.org/pkcs7"
+)
+
+// CertificateFormat selects the encoding of exported certificates.
+type CertificateFormat string
+
+const (
+	// FormatPEM encodes certificates as PEM "CERTIFICATE" blocks
+	FormatPEM CertificateFormat = "pem"
+	// FormatDER encodes certificates as raw DER; DER bundles are certs-only
+	// PKCS#7 (.p7b) files
+	FormatDER CertificateFormat = "der"
+)
+
+// ExportCertificates returns every certificate embedded in the signature of
+// a PE file, one encoded certificate per element.
+//
+// The certificates of the PKCS#7 bag come first, in their stored order,
+// followed by those embedded in an RFC 3161 timestamp token that are not
+// already in the bag. The result is the raw material for OpenSSL-style
+// tooling: the chain is not validated or reordered.
+//
+// Parameters:
+//   - filePath: The path to the signed PE file
+//   - format: FormatPEM or FormatDER
+//
+// Returns:
+//   - [][]byte: The encoded certificates
+//   - error: An error if the signature cannot be extracted or format is unknown
+//
+// Example usage:
+//
+//	certs, err := sigtool.ExportCertificates("signed.exe", sigtool.FormatPEM)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	for i, cert := range certs {
+//	    _ = os.WriteFile(fmt.Sprintf("cert-%d.pem", i), cert, 0644)
+//	}
+func ExportCertificates(filePath string, format CertificateFormat) ([][]byte, error) {
+	certs, err := signatureCertificates(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := make([][]byte, 0, len(certs))
+	for _, cert := range certs {
+		data, err := encodeCertificate(cert, format)
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, data)
+	}
+	return encoded, nil
+}
+
+// ExportCertificateBundle returns the certificates reported by
+// ExportCertificates as a single bundle: concatenated PEM blocks for
+// FormatPEM, or a certs-only PKCS#7 structure for FormatDER.
+//
+// Parameters:
+//   - filePath: The path to the signed PE file
+//   - format: FormatPEM or FormatDER
+//
+// Returns:
+//   - []byte: The encoded bundle
+//   - error: An error if the signature cannot be extracted or format is unknown
+//
+// Example usage:
+//
+//	bundle, err := sigtool.ExportCertificateBundle("signed.exe", sigtool.FormatDER)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	_ = os.WriteFile("chain.p7b", bundle, 0644)
+func ExportCertificateBundle(filePath string, format CertificateFormat) ([]byte, error) {
+	certs, err := signatureCertificates(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatPEM:
+		var buf bytes.Buffer
+		for _, cert := range certs {
+			if err := pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}); err != nil {
+				return nil, fmt.Errorf("failed to encode certificate: %w", err)
+			}
+		}
+		return buf.Bytes(), nil
+	case FormatDER:
+		var raw []byte
+		for _, cert := range certs {
+			raw = append(raw, cert.Raw...)
+		}
+		bundle, err := pkcs7.DegenerateCertificate(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode PKCS#7 bundle: %w", err)
+		}
+		return bundle, nil
+	default:
+		return nil, fmt.Errorf("unsupported certificate format %q", format)
+	}
+}
+
+// signatureCertificates returns the certificates embedded in the signature
+// of filePath and in its RFC 3161 timestamp token, without duplicates
+func signatureCertificates(filePath string) ([]*x509.Certificate, error) {
+	signature, err := ExtractDigitalSignature(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract signature: %w", err)
+	}
+	if isXMLSignature(signature) {
+		_, certs, err := xmlSignatureCertificates(signature)
+		return certs, err
+	}
+	p7, err := parsePKCS7(signature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS#7 signature: %w", err)
+	}
+
+	certs := append([]*x509.Certificate(nil), p7.Certificates...)
+	if value, ok := findAttribute(unauthenticatedAttributes(p7), oidRFC3161Timestamp); ok {
+		token, _, err := parseTimestampToken(value)
+		if err != nil {
+			return nil, err
+		}
+		for _, cert := range token.Certificates {
+			if !containsCertificate(certs, cert) {
+				certs = append(certs, cert)
+			}
+		}
+	}
+	return certs, nil
+}
+
+// containsCertificate reports whether certs holds cert
+func containsCertificate(certs []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, c := range certs {
+		if c.Equal(cert) {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeCertificate encodes cert in format
+func encodeCertificate(cert *x509.Certificate, format CertificateFormat) ([]byte, error) {
+	switch format {
+	case FormatPEM:
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), nil
+	case FormatDER:
+		return append([]byte(nil), cert.Raw...), nil
+	default:
+		return nil, fmt.Errorf("unsupported certificate format %q", format)
+	}
+}
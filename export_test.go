@@ -0,0 +1,95 @@
+package sigtool
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mozilla.org/pkcs7"
+)
+
+func TestExportCertificates(t *testing.T) {
+	root := issueCertificateForTest(t, testCATemplate("export root", 1), nil)
+	intermediate := issueCertificateForTest(t, testCATemplate("export intermediate", 2), root)
+	leaf := issueCertificateForTest(t, testLeafTemplate("export signer", 3, x509.ExtKeyUsageCodeSigning), intermediate)
+	tsa, _ := testTSA(t)
+	filePath := createSignedMockPEAs(t, leaf, crypto.SHA256, withRFC3161Timestamp(t, time.Now()))
+	want := []*x509.Certificate{leaf.Cert, intermediate.Cert, tsa}
+
+	der, err := ExportCertificates(filePath, FormatDER)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(der) != len(want) {
+		t.Fatalf("Expected %d certificates, got %d", len(want), len(der))
+	}
+	for i, data := range der {
+		cert, err := x509.ParseCertificate(data)
+		if err != nil || !cert.Equal(want[i]) {
+			t.Errorf("Certificate %d: expected %s, got %v (%v)", i, want[i].Subject, cert, err)
+		}
+	}
+
+	pemCerts, err := ExportCertificates(filePath, FormatPEM)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	block, rest := pem.Decode(pemCerts[0])
+	if block == nil || block.Type != "CERTIFICATE" || len(rest) != 0 || string(block.Bytes) != string(leaf.Cert.Raw) {
+		t.Errorf("Expected a single PEM certificate for the signer, got %q", pemCerts[0])
+	}
+
+	if _, err := ExportCertificates(filePath, "txt"); err == nil || !strings.Contains(err.Error(), "unsupported certificate format") {
+		t.Errorf("Expected unsupported format error, got: %v", err)
+	}
+}
+
+func TestExportCertificateBundle(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+	signer, _ := testSigner(t)
+
+	bundle, err := ExportCertificateBundle(filePath, FormatPEM)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	certs, err := pemCertificatesForTest(bundle)
+	if err != nil || len(certs) != 1 || !certs[0].Equal(signer) {
+		t.Errorf("Expected PEM bundle with the signer, got %d certificates (%v)", len(certs), err)
+	}
+
+	p7b, err := ExportCertificateBundle(filePath, FormatDER)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	p7, err := pkcs7.Parse(p7b)
+	if err != nil || len(p7.Certificates) != 1 || !p7.Certificates[0].Equal(signer) {
+		t.Errorf("Expected PKCS#7 bundle with the signer, got %v (%v)", p7, err)
+	}
+}
+
+func TestExportCertificates_Unsigned(t *testing.T) {
+	filePath := createMockPEFile(t, false, nil)
+	if _, err := ExportCertificates(filePath, FormatPEM); err == nil {
+		t.Error("Expected error for unsigned file, got nil")
+	}
+}
+
+// pemCertificatesForTest decodes every certificate in data
+func pemCertificatesForTest(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs, nil
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+}
@@ -0,0 +1,171 @@
+package sigtool
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// FileType identifies the container format of a signed file, which decides
+// where its signature is stored and how its digest is computed.
+type FileType string
+
+const (
+	// FileTypeUnknown is a file sigtool cannot check
+	FileTypeUnknown FileType = ""
+	// FileTypePE is a Windows PE image: an executable, DLL or driver
+	FileTypePE FileType = "pe"
+	// FileTypeMSI is a Windows Installer package or patch (.msi, .msp), an
+	// OLE compound file
+	FileTypeMSI FileType = "msi"
+	// FileTypeCAB is a Microsoft cabinet (.cab), as used by driver packages
+	// and ActiveX controls
+	FileTypeCAB FileType = "cab"
+	// FileTypeMSIX is an MSIX or APPX package or bundle, a ZIP archive with
+	// a block map
+	FileTypeMSIX FileType = "msix"
+	// FileTypeNuGet is a NuGet package (.nupkg, .snupkg), a ZIP archive
+	// with a .nuspec manifest at its root
+	FileTypeNuGet FileType = "nupkg"
+	// FileTypeOPC is an Open Packaging Conventions package signed with XML
+	// signatures, such as a Visual Studio extension (.vsix) or an Office
+	// document, a ZIP archive with [Content_Types].xml
+	FileTypeOPC FileType = "opc"
+	// FileTypeVBScript, FileTypeJScript and FileTypeWSF are signed Windows
+	// Script Host scripts (.vbs, .js, .wsf), recognised by their signature
+	// block
+	FileTypeVBScript FileType = "vbs"
+	FileTypeJScript  FileType = "js"
+	FileTypeWSF      FileType = "wsf"
+	// FileTypeVBA is an Office document with a signed VBA macro project: a
+	// macro-enabled Office Open XML document (.docm, .xlsm, .pptm) or a
+	// legacy compound file document (.doc, .xls)
+	FileTypeVBA FileType = "vba"
+	// FileTypeMachO is a macOS or iOS Mach-O binary, thin or universal
+	// (fat), with code signatures embedded per architecture
+	FileTypeMachO FileType = "macho"
+	// FileTypeDMG is a UDIF disk image (.dmg), with a code signature
+	// located by its koly trailer
+	FileTypeDMG FileType = "dmg"
+	// FileTypePKG is a macOS installer package (.pkg), a xar archive with
+	// signatures over its table of contents
+	FileTypePKG FileType = "pkg"
+	// FileTypeKernelModule is a signed Linux kernel module (.ko), with a
+	// PKCS#7 signature appended to it
+	FileTypeKernelModule FileType = "kmod"
+	// FileTypeRPM is an RPM package (.rpm), with OpenPGP signatures and
+	// digests of its header and payload in its signature header
+	FileTypeRPM FileType = "rpm"
+	// FileTypeDeb is a Debian package (.deb), an ar archive with debsigs or
+	// dpkg-sig OpenPGP signature members
+	FileTypeDeb FileType = "deb"
+	// FileTypeAPK is an Android package (.apk), a ZIP archive with an
+	// AndroidManifest.xml, signed with APK Signature Scheme v2 or v3 in the
+	// APK Signing Block before its central directory, or like a JAR
+	FileTypeAPK FileType = "apk"
+	// FileTypeJAR is a Java archive (.jar, .war, .ear), a ZIP archive with
+	// a META-INF/MANIFEST.MF, signed with the JAR signature scheme in
+	// META-INF/*.SF and their signature blocks
+	FileTypeJAR FileType = "jar"
+	// FileTypeAppImage is a type 2 AppImage, an ELF runtime with a squashfs
+	// image appended, signed with OpenPGP in its .sha256_sig section
+	FileTypeAppImage FileType = "appimage"
+)
+
+// DetectFileType identifies the format of a file from its contents rather
+// than its extension.
+//
+// Parameters:
+//   - filePath: The path to the file to identify
+//
+// Returns:
+//   - FileType: The format, or FileTypeUnknown for files sigtool cannot check
+//   - error: An error if the file cannot be read
+//
+// Example usage:
+//
+//	fileType, err := sigtool.DetectFileType("setup.msi")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	fmt.Println(fileType)
+func DetectFileType(filePath string) (FileType, error) {
+	if strings.TrimSpace(filePath) == "" {
+		return FileTypeUnknown, errors.New("file path cannot be empty")
+	}
+
+	// #nosec G304 - This tool is designed to read user-specified files
+	f, err := os.Open(filePath)
+	if err != nil {
+		return FileTypeUnknown, fmt.Errorf("failed to open file %q: %w", filePath, err)
+	}
+	defer f.Close()
+
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return FileTypeUnknown, fmt.Errorf("failed to get file info: %w", err)
+	}
+	fileType, err := detectFileType(f, fileInfo.Size())
+	if err != nil {
+		return FileTypeUnknown, fmt.Errorf("failed to read file %q: %w", filePath, err)
+	}
+	return fileType, nil
+}
+
+// detectFileType identifies the format of r from its magic bytes
+func detectFileType(r io.ReaderAt, size int64) (FileType, error) {
+	switch {
+	case isCompoundFile(r, size):
+		if cf, err := openCompoundFile(r, size); err == nil && isVBACompoundFile(cf) {
+			return FileTypeVBA, nil
+		}
+		return FileTypeMSI, nil
+	case isCabinet(r, size):
+		return FileTypeCAB, nil
+	case isZipArchive(r, size):
+		// Archives that do not parse are not packages sigtool can check
+		a, err := openZipArchive(r, size)
+		switch {
+		case err != nil:
+		case isMSIXPackage(a):
+			return FileTypeMSIX, nil
+		case isNuGetPackage(a):
+			return FileTypeNuGet, nil
+		case isVBAPackage(a):
+			return FileTypeVBA, nil
+		case isOPCPackage(a):
+			return FileTypeOPC, nil
+		case isAPKPackage(a):
+			return FileTypeAPK, nil
+		case isJARPackage(a):
+			return FileTypeJAR, nil
+		}
+		return FileTypeUnknown, nil
+	case isMachO(r):
+		return FileTypeMachO, nil
+	case isXarArchive(r):
+		return FileTypePKG, nil
+	case isAppImage(r):
+		return FileTypeAppImage, nil
+	case isRPMPackage(r, size):
+		return FileTypeRPM, nil
+	case isDebianPackage(r, size):
+		return FileTypeDeb, nil
+	}
+	// The MZ and PE signatures come before the formats recognised by a
+	// trailer, which a signed PE may carry as overlay data
+	ok, err := isPEImage(r)
+	switch {
+	case err != nil:
+		return FileTypeUnknown, err
+	case ok:
+		return FileTypePE, nil
+	case isDiskImage(r, size):
+		return FileTypeDMG, nil
+	case isKernelModule(r, size):
+		return FileTypeKernelModule, nil
+	}
+	return scriptFileType(r, size), nil
+}
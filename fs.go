@@ -0,0 +1,230 @@
+package sigtool
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// The fs.FS variants cover the functions that only read a file:
+// ExtractDigitalSignature, IsValidDigitalSignature, ExtractWithDigests,
+// Verify, VerifyDetailed, Inspect and DiffSignatures. Those that rewrite it,
+// such as RemoveDigitalSignature and SignPE, have none, as an fs.FS is
+// read-only.
+
+// ExtractDigitalSignatureFS extracts the PKCS#7 digital signature from a signed
+// PE file stored in fsys.
+//
+// This behaves like ExtractDigitalSignature but reads through an fs.FS, so it
+// works with embedded filesystems, zip archives and test fakes. Files that do
+// not support random access are read into memory.
+//
+// Parameters:
+//   - fsys: The filesystem containing the PE file
+//   - name: The slash-separated path of the PE file within fsys
+//
+// Returns:
+//   - []byte: The raw PKCS#7 signature data
+//   - error: An error if extraction fails for any reason
+//
+// Example usage:
+//
+//	signature, err := sigtool.ExtractDigitalSignatureFS(os.DirFS("/opt/app"), "bin/signed.exe")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+func ExtractDigitalSignatureFS(fsys fs.FS, name string) ([]byte, error) {
+	r, size, closeFn, err := openFS(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFn()
+
+	return ExtractDigitalSignatureFromReader(r, size)
+}
+
+// IsValidDigitalSignatureFS validates the digital signature of a PE file stored
+// in fsys, including the Authenticode content digest, like IsValidDigitalSignature.
+//
+// Parameters:
+//   - fsys: The filesystem containing the PE file
+//   - name: The slash-separated path of the PE file within fsys
+//
+// Returns:
+//   - error: nil if the signature is valid, otherwise an error describing the validation failure
+func IsValidDigitalSignatureFS(fsys fs.FS, name string) error {
+	r, size, closeFn, err := openFS(fsys, name)
+	if err != nil {
+		return fmt.Errorf("failed to extract signature: %w", err)
+	}
+	defer closeFn()
+
+	return verifyAuthenticode(r, size, VerifyOptions{})
+}
+
+// ExtractWithDigestsFS is ExtractWithDigests for a file stored in fsys.
+//
+// Parameters:
+//   - fsys: The filesystem containing the PE file
+//   - name: The slash-separated path of the PE file within fsys
+//
+// Returns:
+//   - *SignatureBundle: The signature and digest information
+//   - error: An error if extraction, parsing or hashing fails
+func ExtractWithDigestsFS(fsys fs.FS, name string) (*SignatureBundle, error) {
+	r, size, closeFn, err := openFS(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFn()
+
+	return extractWithDigests(r, size)
+}
+
+// VerifyFS is Verify for a file stored in fsys.
+//
+// Parameters:
+//   - fsys: The filesystem containing the signed file
+//   - name: The slash-separated path of the file within fsys
+//   - opts: Certificate chain verification options; nil behaves like IsValidDigitalSignatureFS
+//
+// Returns:
+//   - error: nil if the signature is valid, otherwise an error describing the validation failure
+//
+// Example usage:
+//
+//	err := sigtool.VerifyFS(os.DirFS("/opt/app"), "bin/signed.exe", &sigtool.VerifyOptions{UseSystemRoots: true})
+func VerifyFS(fsys fs.FS, name string, opts *VerifyOptions) error {
+	if opts == nil {
+		opts = &VerifyOptions{}
+	}
+	r, size, closeFn, err := openFS(fsys, name)
+	if err != nil {
+		return fmt.Errorf("failed to extract signature: %w", err)
+	}
+	defer closeFn()
+
+	return verifyAuthenticode(r, size, *opts)
+}
+
+// VerifyDetailedFS is VerifyDetailed for a file stored in fsys. The Path
+// of the result is name.
+//
+// Parameters:
+//   - fsys: The filesystem containing the signed file
+//   - name: The slash-separated path of the file within fsys
+//   - opts: Verification options; nil means the zero value
+//
+// Returns:
+//   - *VerificationResult: The outcome of every check
+func VerifyDetailedFS(fsys fs.FS, name string, opts *VerifyOptions) *VerificationResult {
+	if opts == nil {
+		opts = &VerifyOptions{}
+	}
+	v := &detailedVerification{result: &VerificationResult{Path: name}, opts: *opts}
+	r, size, closeFn, err := openFS(fsys, name)
+	if err != nil {
+		v.structure(err)
+		return v.result
+	}
+	defer closeFn()
+
+	v.runSignature(v.checkReader(r, size))
+	return v.result
+}
+
+// InspectFS is Inspect for a file stored in fsys.
+//
+// Parameters:
+//   - fsys: The filesystem containing the signed file
+//   - name: The slash-separated path of the file within fsys
+//
+// Returns:
+//   - *SignatureInfo: The decoded signature details
+//   - error: An error if the signature cannot be extracted or parsed
+func InspectFS(fsys fs.FS, name string) (*SignatureInfo, error) {
+	signature, err := ExtractDigitalSignatureFS(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract signature: %w", err)
+	}
+
+	return inspectSignature(signature)
+}
+
+// DiffSignaturesFS is DiffSignatures for files stored in filesystems, such
+// as the archives of two releases.
+//
+// Parameters:
+//   - fsysA: The filesystem containing the first (previous) file
+//   - nameA: The slash-separated path of the first file within fsysA
+//   - fsysB: The filesystem containing the second (new) file
+//   - nameB: The slash-separated path of the second file within fsysB
+//
+// Returns:
+//   - *SignatureDiff: The per-field comparison
+//   - error: An error if either signature cannot be extracted or parsed
+//
+// Example usage:
+//
+//	diff, err := sigtool.DiffSignaturesFS(previous, "bin/app.exe", current, "bin/app.exe")
+func DiffSignaturesFS(fsysA fs.FS, nameA string, fsysB fs.FS, nameB string) (*SignatureDiff, error) {
+	before, err := loadSignatureStateFS(fsysA, nameA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signature of %q: %w", nameA, err)
+	}
+	after, err := loadSignatureStateFS(fsysB, nameB)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signature of %q: %w", nameB, err)
+	}
+	return diffStates(before, after), nil
+}
+
+// loadSignatureStateFS is loadSignatureState for a file stored in fsys
+func loadSignatureStateFS(fsys fs.FS, name string) (*signatureState, error) {
+	bundle, err := ExtractWithDigestsFS(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return newSignatureState(bundle)
+}
+
+// openFS opens name in fsys and returns random access to its contents along
+// with its size and a function that releases the underlying file.
+func openFS(fsys fs.FS, name string) (io.ReaderAt, int64, func() error, error) {
+	if fsys == nil {
+		return nil, 0, nil, errors.New("filesystem cannot be nil")
+	}
+	if strings.TrimSpace(name) == "" {
+		return nil, 0, nil, errors.New("file path cannot be empty")
+	}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to open file %q: %w", name, err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, 0, nil, fmt.Errorf("%q is a directory", name)
+	}
+
+	if ra, ok := f.(io.ReaderAt); ok {
+		return ra, info.Size(), f.Close, nil
+	}
+
+	// Fall back to buffering files without random access, such as zip entries
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to read file %q: %w", name, err)
+	}
+	return bytes.NewReader(data), int64(len(data)), func() error { return nil }, nil
+}
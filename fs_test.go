@@ -0,0 +1,142 @@
+package sigtool
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestExtractDigitalSignatureFS_MapFS(t *testing.T) {
+	filePath, digest := createSignedMockPE(t, crypto.SHA256)
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	fsys := fstest.MapFS{"bin/signed.exe": &fstest.MapFile{Data: content}}
+
+	signature, err := ExtractDigitalSignatureFS(fsys, "bin/signed.exe")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(signature) == 0 {
+		t.Error("Expected signature data")
+	}
+
+	if err := IsValidDigitalSignatureFS(fsys, "bin/signed.exe"); err != nil {
+		t.Errorf("Expected valid signature, got: %v", err)
+	}
+
+	bundle, err := ExtractWithDigestsFS(fsys, "bin/signed.exe")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !bundle.DigestMatch || !bytes.Equal(bundle.ComputedDigest, digest) {
+		t.Errorf("Expected matching digest %x, got %+v", digest, bundle)
+	}
+}
+
+func TestVerifyFS(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	tampered := append([]byte(nil), content...)
+	tampered[mockHeaderSize] ^= 0xff
+	fsys := fstest.MapFS{
+		"bin/signed.exe":   &fstest.MapFile{Data: content},
+		"bin/tampered.exe": &fstest.MapFile{Data: tampered},
+	}
+
+	if err := VerifyFS(fsys, "bin/signed.exe", nil); err != nil {
+		t.Errorf("Expected a valid signature, got: %v", err)
+	}
+	if err := VerifyFS(fsys, "bin/tampered.exe", &VerifyOptions{}); !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("Expected ErrDigestMismatch, got: %v", err)
+	}
+
+	result := VerifyDetailedFS(fsys, "bin/signed.exe", nil)
+	if !result.Valid() || result.Path != "bin/signed.exe" {
+		t.Errorf("Expected a valid result for bin/signed.exe, got %+v", result)
+	}
+	if result := VerifyDetailedFS(fsys, "bin/tampered.exe", nil); result.Valid() || result.Failed()[0].Check != CheckDigest {
+		t.Errorf("Expected the digest check to fail, got %+v", result.Failed())
+	}
+	if result := VerifyDetailedFS(fsys, "missing.exe", nil); result.Valid() || result.Failed()[0].Check != CheckStructure {
+		t.Errorf("Expected the structure check to fail for a missing file, got %+v", result.Failed())
+	}
+
+	info, err := InspectFS(fsys, "bin/signed.exe")
+	if err != nil || info.Signer == nil {
+		t.Errorf("Expected the signer, got %+v, %v", info, err)
+	}
+
+	diff, err := DiffSignaturesFS(fsys, "bin/signed.exe", fstest.MapFS{"app.exe": &fstest.MapFile{Data: content}}, "app.exe")
+	if err != nil || diff.Relation != RelationIdentical {
+		t.Errorf("Expected identical signatures, got %+v, %v", diff, err)
+	}
+	if diff, err := DiffSignaturesFS(fsys, "bin/signed.exe", fsys, "bin/tampered.exe"); err != nil || diff.Relation != RelationCopied {
+		t.Errorf("Expected a copied signature, got %+v, %v", diff, err)
+	}
+	if _, err := DiffSignaturesFS(fsys, "bin/signed.exe", fsys, "missing.exe"); err == nil || !strings.Contains(err.Error(), "missing.exe") {
+		t.Errorf("Expected an error naming the missing file, got %v", err)
+	}
+}
+
+func TestExtractDigitalSignatureFS_ZipWithoutReaderAt(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("signed.exe")
+	if err != nil {
+		t.Fatalf("Failed to create zip entry: %v", err)
+	}
+	if _, err := w.Write(content); err != nil {
+		t.Fatalf("Failed to write zip entry: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to close zip: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Failed to open zip: %v", err)
+	}
+
+	if err := IsValidDigitalSignatureFS(zr, "signed.exe"); err != nil {
+		t.Errorf("Expected valid signature, got: %v", err)
+	}
+}
+
+func TestExtractDigitalSignatureFS_Errors(t *testing.T) {
+	fsys := fstest.MapFS{"dir/file.txt": &fstest.MapFile{Data: []byte("x")}}
+
+	testCases := []struct {
+		name     string
+		expected string
+	}{
+		{"", "cannot be empty"},
+		{"missing.exe", "failed to open file"},
+		{"dir", "is a directory"},
+		{"dir/file.txt", "failed to parse PE file"},
+	}
+	for _, tc := range testCases {
+		_, err := ExtractDigitalSignatureFS(fsys, tc.name)
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("%q: expected %q error, got: %v", tc.name, tc.expected, err)
+		}
+	}
+
+	if _, err := ExtractDigitalSignatureFS(nil, "x"); err == nil {
+		t.Error("Expected error for nil filesystem, got nil")
+	}
+}
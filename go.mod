@@ -2,4 +2,9 @@ module github.com/konidev20/sigtool
 
 go 1.21.0
 
-require go.mozilla.org/pkcs7 v0.9.0
+require (
+	github.com/miekg/pkcs11 v1.1.2
+	go.mozilla.org/pkcs7 v0.9.0
+	golang.org/x/crypto v0.32.0
+	software.sslmate.com/src/go-pkcs12 v0.7.3
+)
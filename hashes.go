@@ -0,0 +1,147 @@
+package sigtool
+
+import (
+	"crypto"
+	"crypto/md5"  // #nosec G501 - MD5 is reported for threat-intelligence lookups, not used for security
+	"crypto/sha1" // #nosec G505 - SHA-1 is reported for threat-intelligence lookups, not used for security
+	"crypto/sha256"
+	"debug/pe"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// FileHashes holds the digests analysts pivot on in threat-intelligence
+// platforms such as VirusTotal and MISP.
+type FileHashes struct {
+	// MD5, SHA1 and SHA256 are digests of the whole file
+	MD5    []byte
+	SHA1   []byte
+	SHA256 []byte
+	// AuthentihashSHA1 and AuthentihashSHA256 are the Authenticode digests
+	// of the file, as ComputeAuthentihash computes them; both are nil when
+	// the file is not a PE image
+	AuthentihashSHA1   []byte
+	AuthentihashSHA256 []byte
+	// Imphash is the MD5 of the import table, as pefile and VirusTotal
+	// compute it; it is nil when the file has no imports, its import table
+	// is malformed or debug/pe cannot parse it
+	Imphash []byte
+	// RichHeaderHash is the MD5 of the decoded rich header the Microsoft
+	// linker writes after the DOS stub; it is nil when there is none
+	RichHeaderHash []byte
+}
+
+// ComputeFileHashes computes the MD5, SHA-1 and SHA-256 digests of a file
+// together with its SHA-1 and SHA-256 authentihashes, reading the file only
+// once, and the imphash and rich header hash of PE images from their
+// headers. Files that are not PE images get the whole-file digests only.
+//
+// Parameters:
+//   - filePath: The path to the file to hash
+//
+// Returns:
+//   - *FileHashes: The digests of the file
+//   - error: An error if the file cannot be read, or if its PE headers locate
+//     the certificate table outside the file
+//
+// Example usage:
+//
+//	hashes, err := sigtool.ComputeFileHashes("sample.exe")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	fmt.Printf("sha256: %x\nauthentihash: %x\n", hashes.SHA256, hashes.AuthentihashSHA256)
+func ComputeFileHashes(filePath string) (*FileHashes, error) {
+	if strings.TrimSpace(filePath) == "" {
+		return nil, errors.New("file path cannot be empty")
+	}
+
+	// #nosec G304 - This tool is designed to read user-specified PE files
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %q: %w", filePath, err)
+	}
+	defer f.Close()
+
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	// Only the headers are read to locate the excluded fields; the contents
+	// are then streamed once through every digest
+	var ranges [][2]int64
+	layout, err := readLayout(f, fileInfo.Size())
+	switch {
+	case err == nil:
+		if ranges, err = authentihashRanges(layout); err != nil {
+			return nil, err
+		}
+	case !errors.Is(err, ErrNotPE):
+		return nil, err
+	}
+
+	md5Hash, sha1Hash, sha256Hash := md5.New(), sha1.New(), sha256.New()
+	writers := []io.Writer{md5Hash, sha1Hash, sha256Hash}
+	var authentihashes *rangeWriter
+	if ranges != nil {
+		authentihashes = &rangeWriter{ranges: ranges, hashes: []hash.Hash{crypto.SHA1.New(), crypto.SHA256.New()}}
+		writers = append(writers, authentihashes)
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), io.NewSectionReader(f, 0, fileInfo.Size())); err != nil {
+		return nil, fmt.Errorf("failed to hash file contents: %w", err)
+	}
+
+	hashes := &FileHashes{MD5: md5Hash.Sum(nil), SHA1: sha1Hash.Sum(nil), SHA256: sha256Hash.Sum(nil)}
+	if authentihashes == nil {
+		return hashes, nil
+	}
+	hashes.AuthentihashSHA1 = authentihashes.hashes[0].Sum(nil)
+	hashes.AuthentihashSHA256 = authentihashes.hashes[1].Sum(nil)
+	hashes.RichHeaderHash = richHeaderHash(f, fileInfo.Size())
+	// Images only the lenient header parser accepts have no imphash, and a
+	// malformed import table does not hide the other digests
+	if pefile, err := pe.NewFile(f); err == nil {
+		defer pefile.Close()
+		hashes.Imphash, _ = imphash(pefile)
+	}
+	return hashes, nil
+}
+
+// rangeWriter writes to hashes the bytes written to it that fall within
+// ranges, which are ascending [start, end) offsets of the stream
+type rangeWriter struct {
+	ranges [][2]int64
+	hashes []hash.Hash
+	// offset is the stream offset of the next byte written
+	offset int64
+}
+
+func (w *rangeWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 && len(w.ranges) > 0 {
+		rng := w.ranges[0]
+		if w.offset >= rng[1] {
+			w.ranges = w.ranges[1:]
+			continue
+		}
+		if w.offset < rng[0] {
+			skip := min(rng[0]-w.offset, int64(len(p)))
+			p = p[skip:]
+			w.offset += skip
+			continue
+		}
+		take := min(rng[1]-w.offset, int64(len(p)))
+		for _, h := range w.hashes {
+			h.Write(p[:take])
+		}
+		p = p[take:]
+		w.offset += take
+	}
+	w.offset += int64(len(p))
+	return n, nil
+}
@@ -0,0 +1,66 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/md5"  // #nosec G501 - test digests
+	"crypto/sha1" // #nosec G505 - test digests
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestComputeFileHashes_SignedPE(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	hashes, err := ComputeFileHashes(filePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	md5Sum, sha1Sum, sha256Sum := md5.Sum(content), sha1.Sum(content), sha256.Sum256(content)
+	if !bytes.Equal(hashes.MD5, md5Sum[:]) || !bytes.Equal(hashes.SHA1, sha1Sum[:]) || !bytes.Equal(hashes.SHA256, sha256Sum[:]) {
+		t.Errorf("Expected whole-file digests %x %x %x, got %x %x %x", md5Sum, sha1Sum, sha256Sum, hashes.MD5, hashes.SHA1, hashes.SHA256)
+	}
+	for h, digest := range map[crypto.Hash][]byte{crypto.SHA1: hashes.AuthentihashSHA1, crypto.SHA256: hashes.AuthentihashSHA256} {
+		expected, err := ComputeAuthentihash(filePath, h)
+		if err != nil {
+			t.Fatalf("%v: expected no error, got: %v", h, err)
+		}
+		if !bytes.Equal(digest, expected) {
+			t.Errorf("%v: expected authentihash %x, got %x", h, expected, digest)
+		}
+	}
+}
+
+func TestComputeFileHashes_NotPE(t *testing.T) {
+	content := []byte("not a portable executable")
+	filePath := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(filePath, content, 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	hashes, err := ComputeFileHashes(filePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if sum := sha256.Sum256(content); !bytes.Equal(hashes.SHA256, sum[:]) {
+		t.Errorf("Expected SHA-256 %x, got %x", sum, hashes.SHA256)
+	}
+	if hashes.AuthentihashSHA1 != nil || hashes.AuthentihashSHA256 != nil {
+		t.Errorf("Expected no authentihashes for a file that is not PE, got %x %x", hashes.AuthentihashSHA1, hashes.AuthentihashSHA256)
+	}
+}
+
+func TestComputeFileHashes_Errors(t *testing.T) {
+	if _, err := ComputeFileHashes(""); err == nil {
+		t.Error("Expected error for empty path, got nil")
+	}
+	if _, err := ComputeFileHashes(filepath.Join(t.TempDir(), "missing.exe")); err == nil {
+		t.Error("Expected error for missing file, got nil")
+	}
+}
@@ -0,0 +1,201 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto/md5" // #nosec G501 - imphash and the rich header hash are MD5 by definition
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Limits on the import table walked for the imphash, so that a malformed
+// table cannot make it loop for long
+const (
+	maxImportDescriptors = 4096
+	maxImportThunks      = 1 << 16
+	maxImportNameLength  = 512
+	// maxRichHeaderEnd bounds the DOS stub searched for the rich header
+	maxRichHeaderEnd = 1 << 16
+)
+
+// Rich header markers and the offset its "DanS" marker follows the DOS
+// header and stub at
+const (
+	richHeaderStart = 0x80
+	richMarker      = "Rich"
+	dansMarker      = 0x536e6144
+)
+
+// importOrdinalNames names the functions imported by ordinal from the
+// Winsock libraries, as pefile does when computing the imphash
+var importOrdinalNames = map[string]map[uint16]string{
+	"ws2_32.dll":  winsockOrdinals,
+	"wsock32.dll": winsockOrdinals,
+}
+
+// winsockOrdinals are the Windows Sockets 1.1 export ordinals
+var winsockOrdinals = map[uint16]string{
+	1: "accept", 2: "bind", 3: "closesocket", 4: "connect", 5: "getpeername",
+	6: "getsockname", 7: "getsockopt", 8: "htonl", 9: "htons", 10: "ioctlsocket",
+	11: "inet_addr", 12: "inet_ntoa", 13: "listen", 14: "ntohl", 15: "ntohs",
+	16: "recv", 17: "recvfrom", 18: "select", 19: "send", 20: "sendto",
+	21: "setsockopt", 22: "shutdown", 23: "socket",
+	51: "gethostbyaddr", 52: "gethostbyname", 53: "getprotobyname", 54: "getprotobynumber",
+	55: "getservbyname", 56: "getservbyport", 57: "gethostname",
+	101: "WSAAsyncSelect", 102: "WSAAsyncGetHostByAddr", 103: "WSAAsyncGetHostByName",
+	104: "WSAAsyncGetProtoByNumber", 105: "WSAAsyncGetProtoByName", 106: "WSAAsyncGetServByPort",
+	107: "WSAAsyncGetServByName", 108: "WSACancelAsyncRequest", 109: "WSASetBlockingHook",
+	110: "WSAUnhookBlockingHook", 111: "WSAGetLastError", 112: "WSASetLastError",
+	113: "WSACancelBlockingCall", 114: "WSAIsBlocking", 115: "WSAStartup", 116: "WSACleanup",
+	151: "__WSAFDIsSet", 500: "WEP",
+}
+
+// imphash returns the import hash of pefile as pefile and VirusTotal
+// compute it: the MD5 of the comma-separated "library.function" names of
+// its imports in table order, lowercased, with the .dll, .ocx or .sys
+// extension dropped and unnamed ordinals written as ordN. It returns nil
+// for images without imports.
+func imphash(pefile *pe.File) ([]byte, error) {
+	var dir pe.DataDirectory
+	thunkSize, ordinalFlag := uint32(4), uint64(1)<<31
+	switch h := pefile.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		if h.NumberOfRvaAndSizes > pe.IMAGE_DIRECTORY_ENTRY_IMPORT {
+			dir = h.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_IMPORT]
+		}
+	case *pe.OptionalHeader64:
+		if h.NumberOfRvaAndSizes > pe.IMAGE_DIRECTORY_ENTRY_IMPORT {
+			dir = h.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_IMPORT]
+		}
+		thunkSize, ordinalFlag = 8, uint64(1)<<63
+	}
+	if dir.VirtualAddress == 0 {
+		return nil, nil
+	}
+
+	var names []string
+	thunks := 0
+	for i := uint32(0); i < maxImportDescriptors; i++ {
+		// IMAGE_IMPORT_DESCRIPTOR: OriginalFirstThunk, TimeDateStamp,
+		// ForwarderChain, Name and FirstThunk
+		desc, err := readRVA(pefile, dir.VirtualAddress+20*i, 20)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read import descriptor %d: %w", i, err)
+		}
+		if bytes.Equal(desc, make([]byte, 20)) {
+			break
+		}
+		dllName, err := readRVAString(pefile, binary.LittleEndian.Uint32(desc[12:]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read import library name: %w", err)
+		}
+		library := strings.ToLower(dllName)
+		if dot := strings.LastIndexByte(library, '.'); dot >= 0 {
+			switch library[dot+1:] {
+			case "dll", "ocx", "sys":
+				library = library[:dot]
+			}
+		}
+
+		thunk := binary.LittleEndian.Uint32(desc)
+		if thunk == 0 {
+			thunk = binary.LittleEndian.Uint32(desc[16:])
+		}
+		for ; ; thunk += thunkSize {
+			if thunks++; thunks > maxImportThunks {
+				return nil, errors.New("import table has too many entries")
+			}
+			entry, err := readRVA(pefile, thunk, thunkSize)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read imports of %s: %w", dllName, err)
+			}
+			value := uint64(binary.LittleEndian.Uint32(entry))
+			if thunkSize == 8 {
+				value = binary.LittleEndian.Uint64(entry)
+			}
+			if value == 0 {
+				break
+			}
+			var function string
+			if value&ordinalFlag != 0 {
+				ordinal := uint16(value)
+				if function = importOrdinalNames[strings.ToLower(dllName)][ordinal]; function == "" {
+					function = fmt.Sprintf("ord%d", ordinal)
+				}
+			} else if function, err = readRVAString(pefile, uint32(value)+2); err != nil {
+				return nil, fmt.Errorf("failed to read import name: %w", err)
+			}
+			names = append(names, library+"."+strings.ToLower(function))
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	sum := md5.Sum([]byte(strings.Join(names, ","))) // #nosec G401
+	return sum[:], nil
+}
+
+// readRVAString returns the NUL-terminated string of pefile at the relative
+// virtual address rva
+func readRVAString(pefile *pe.File, rva uint32) (string, error) {
+	for _, s := range pefile.Sections {
+		if rva < s.VirtualAddress || rva-s.VirtualAddress >= max(s.VirtualSize, s.Size) {
+			continue
+		}
+		start := int64(rva - s.VirtualAddress)
+		size := min(int64(maxImportNameLength), int64(s.Size)-start)
+		if size <= 0 {
+			return "", fmt.Errorf("RVA %#x is beyond the data of section %s", rva, s.Name)
+		}
+		buf := make([]byte, size)
+		if _, err := s.ReadAt(buf, start); err != nil && !errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("failed to read section %s: %w", s.Name, err)
+		}
+		end := bytes.IndexByte(buf, 0)
+		if end < 0 {
+			return "", fmt.Errorf("string at RVA %#x is not terminated", rva)
+		}
+		return string(buf[:end]), nil
+	}
+	return "", fmt.Errorf("RVA %#x is not in any section", rva)
+}
+
+// richHeaderHash returns the MD5 of the decoded rich header of the PE image
+// r, the linker metadata between the DOS stub and the PE header, as pefile
+// and VirusTotal compute it: from the "DanS" marker up to the "Rich" marker,
+// XORed with the key that follows it. It returns nil for images without a
+// rich header.
+func richHeaderHash(r io.ReaderAt, fileSize int64) []byte {
+	var lfanew [4]byte
+	if _, err := r.ReadAt(lfanew[:], 0x3c); err != nil {
+		return nil
+	}
+	end := min(int64(binary.LittleEndian.Uint32(lfanew[:])), fileSize, maxRichHeaderEnd)
+	if end <= richHeaderStart+16 {
+		return nil
+	}
+	stub := make([]byte, end)
+	if _, err := r.ReadAt(stub, 0); err != nil {
+		return nil
+	}
+
+	rich := bytes.Index(stub[richHeaderStart:], []byte(richMarker))
+	if rich < 16 || rich%4 != 0 || richHeaderStart+rich+8 > len(stub) {
+		return nil
+	}
+	data := stub[richHeaderStart : richHeaderStart+rich]
+	key := stub[richHeaderStart+rich+4 : richHeaderStart+rich+8]
+	clear := make([]byte, len(data))
+	for i := range data {
+		clear[i] = data[i] ^ key[i%4]
+	}
+	// "DanS" is followed by three zero padding dwords
+	if binary.LittleEndian.Uint32(clear) != dansMarker || !bytes.Equal(clear[4:16], make([]byte, 12)) {
+		return nil
+	}
+	sum := md5.Sum(clear) // #nosec G401
+	return sum[:]
+}
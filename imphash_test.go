@@ -0,0 +1,124 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/md5" // #nosec G501 - test digests
+	"debug/pe"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// importPEForTest builds a PE32 image with a rich header and an .idata
+// section importing CreateFileW and ExitProcess from KERNEL32.dll and
+// ordinals 23 and 999 from WS2_32.dll
+func importPEForTest() (image, richData []byte) {
+	const (
+		peOffset   = 0xc0
+		optOffset  = peOffset + 24
+		secOffset  = optOffset + 224
+		rawOffset  = 0x200
+		rva        = 0x1000
+		sectionLen = 0x200
+		key        = 0x1234abcd
+	)
+	image = make([]byte, rawOffset+sectionLen)
+	copy(image, "MZ")
+	binary.LittleEndian.PutUint32(image[0x3c:], peOffset)
+
+	// DanS, three padding dwords and one @comp.id entry, XORed with the key
+	richData = make([]byte, 24)
+	binary.LittleEndian.PutUint32(richData, dansMarker)
+	binary.LittleEndian.PutUint32(richData[16:], 0x00ff7809)
+	binary.LittleEndian.PutUint32(richData[20:], 42)
+	for i := 0; i < len(richData); i += 4 {
+		binary.LittleEndian.PutUint32(image[richHeaderStart+i:], binary.LittleEndian.Uint32(richData[i:])^key)
+	}
+	copy(image[richHeaderStart+len(richData):], richMarker)
+	binary.LittleEndian.PutUint32(image[richHeaderStart+len(richData)+4:], key)
+
+	copy(image[peOffset:], "PE\x00\x00")
+	binary.LittleEndian.PutUint16(image[peOffset+4:], 0x14c)
+	binary.LittleEndian.PutUint16(image[peOffset+6:], 1)
+	binary.LittleEndian.PutUint16(image[peOffset+20:], 224)
+	binary.LittleEndian.PutUint16(image[optOffset:], 0x10b)
+	binary.LittleEndian.PutUint32(image[optOffset+56:], rva+0x1000)
+	binary.LittleEndian.PutUint32(image[optOffset+60:], rawOffset)
+	binary.LittleEndian.PutUint32(image[optOffset+92:], 16)
+	binary.LittleEndian.PutUint32(image[optOffset+104:], rva)
+	binary.LittleEndian.PutUint32(image[optOffset+108:], 60)
+
+	section := image[secOffset:]
+	copy(section, ".idata")
+	binary.LittleEndian.PutUint32(section[8:], sectionLen)
+	binary.LittleEndian.PutUint32(section[12:], rva)
+	binary.LittleEndian.PutUint32(section[16:], sectionLen)
+	binary.LittleEndian.PutUint32(section[20:], rawOffset)
+	binary.LittleEndian.PutUint32(section[36:], 0xc0000040)
+
+	// Two import descriptors and the terminator, the lookup tables at 0x40
+	// and 0x50, then the names
+	idata := image[rawOffset:]
+	putString := func(offset int, s string) uint32 {
+		copy(idata[offset:], s)
+		return uint32(rva + offset)
+	}
+	binary.LittleEndian.PutUint32(idata[0:], rva+0x40)
+	binary.LittleEndian.PutUint32(idata[12:], putString(0x60, "KERNEL32.dll"))
+	binary.LittleEndian.PutUint32(idata[16:], rva+0x40)
+	binary.LittleEndian.PutUint32(idata[20:], rva+0x50)
+	binary.LittleEndian.PutUint32(idata[32:], putString(0x70, "WS2_32.dll"))
+	binary.LittleEndian.PutUint32(idata[36:], rva+0x50)
+	binary.LittleEndian.PutUint32(idata[0x40:], putString(0x80+2, "CreateFileW")-2)
+	binary.LittleEndian.PutUint32(idata[0x44:], putString(0x90+2, "ExitProcess")-2)
+	binary.LittleEndian.PutUint32(idata[0x50:], 0x80000000|23)
+	binary.LittleEndian.PutUint32(idata[0x54:], 0x80000000|999)
+	return image, richData
+}
+
+func TestComputeFileHashes_ImphashAndRichHeader(t *testing.T) {
+	image, richData := importPEForTest()
+	filePath := filepath.Join(t.TempDir(), "imports.exe")
+	if err := os.WriteFile(filePath, image, 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	hashes, err := ComputeFileHashes(filePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	imports := md5.Sum([]byte("kernel32.createfilew,kernel32.exitprocess,ws2_32.socket,ws2_32.ord999"))
+	if !bytes.Equal(hashes.Imphash, imports[:]) {
+		t.Errorf("Expected imphash %x, got %x", imports, hashes.Imphash)
+	}
+	rich := md5.Sum(richData)
+	if !bytes.Equal(hashes.RichHeaderHash, rich[:]) {
+		t.Errorf("Expected rich header hash %x, got %x", rich, hashes.RichHeaderHash)
+	}
+}
+
+func TestComputeFileHashes_NoImportsOrRichHeader(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+	hashes, err := ComputeFileHashes(filePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if hashes.Imphash != nil || hashes.RichHeaderHash != nil {
+		t.Errorf("Expected no imphash or rich header hash, got %x %x", hashes.Imphash, hashes.RichHeaderHash)
+	}
+}
+
+func TestImphash_MalformedImportTable(t *testing.T) {
+	image, _ := importPEForTest()
+	// Point the KERNEL32.dll lookup table outside every section
+	binary.LittleEndian.PutUint32(image[0x200:], 0x9000)
+	pefile, err := pe.NewFile(bytes.NewReader(image))
+	if err != nil {
+		t.Fatalf("Failed to parse test image: %v", err)
+	}
+	if _, err := imphash(pefile); err == nil {
+		t.Error("Expected error for a lookup table outside every section, got nil")
+	}
+}
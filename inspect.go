@@ -0,0 +1,249 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha1" // #nosec G505 - SHA-1 thumbprints are an identifier, not a security control
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mozilla.org/pkcs7"
+)
+
+// CertificateInfo summarizes an X.509 certificate embedded in a signature.
+type CertificateInfo struct {
+	// Subject is the distinguished name of the certificate subject
+	Subject string
+	// CommonName is the common name (CN) of the certificate subject, or
+	// empty when it has none
+	CommonName string `json:",omitempty"`
+	// Issuer is the distinguished name of the certificate issuer
+	Issuer string
+	// SerialNumber is the certificate serial number in hexadecimal
+	SerialNumber string
+	// NotBefore and NotAfter bound the certificate validity period
+	NotBefore time.Time
+	NotAfter  time.Time
+	// SHA1Thumbprint and SHA256Thumbprint are hex digests of the DER certificate
+	SHA1Thumbprint   string
+	SHA256Thumbprint string
+	// SelfSigned reports whether the certificate is issued by itself
+	SelfSigned bool
+	// TestSigningMarker is the test-signing marker found in the subject or
+	// issuer, such as "WDKTestCert" or "DO_NOT_TRUST", or empty
+	TestSigningMarker string `json:",omitempty"`
+	// ExtendedValidation reports whether the certificate asserts the CA/Browser
+	// Forum EV code-signing policy
+	ExtendedValidation bool
+	// Certificate is the parsed certificate
+	Certificate *x509.Certificate `json:"-"`
+}
+
+// SignatureInfo describes who signed a PE file and how.
+type SignatureInfo struct {
+	// Signer is the certificate that produced the signature
+	Signer *CertificateInfo
+	// DigestAlgorithm is the hash algorithm of the Authenticode file digest
+	DigestAlgorithm crypto.Hash
+	// Digest is the Authenticode file digest recorded in the signature
+	Digest []byte
+	// SigningTime is the signing time asserted by the signature or its
+	// timestamp; it is the zero time when neither is available
+	SigningTime time.Time
+	// Certificates lists every certificate embedded in the signature
+	Certificates []CertificateInfo
+	// Timestamp describes the timestamp countersignature, when present
+	Timestamp *TimestampInfo `json:",omitempty"`
+	// ProgramName is the program description from the SpcSpOpusInfo
+	// authenticated attribute, when present
+	ProgramName string `json:",omitempty"`
+	// MoreInfoURL is the publisher URL from the SpcSpOpusInfo authenticated
+	// attribute, when present
+	MoreInfoURL string `json:",omitempty"`
+	// TestSigned reports a self-signed signer or a test-signing marker in
+	// any embedded certificate. Test-signed binaries only load on machines
+	// with test signing enabled and should not reach production.
+	TestSigned bool
+	// ExtendedValidation reports whether the signer certificate is an EV
+	// code-signing certificate, which Windows requires for kernel-mode
+	// driver submission and SmartScreen grants immediate reputation
+	ExtendedValidation bool
+}
+
+// oidEVCodeSigning is the CA/Browser Forum EV code-signing certificate
+// policy
+var oidEVCodeSigning = asn1.ObjectIdentifier{2, 23, 140, 1, 3}
+
+// testSigningMarkers are names that identify test-signing certificates,
+// such as those the WDK creates and debugging proxy roots
+var testSigningMarkers = []string{"WDKTestCert", "DO_NOT_TRUST", "Microsoft Testing Root"}
+
+// Inspect parses the digital signature of a PE file and reports the signer,
+// digest algorithm, signing time, embedded certificates and timestamp.
+//
+// Inspect does not verify the signature; use IsValidDigitalSignature or
+// VerifyContext to establish trust in the reported values.
+//
+// Parameters:
+//   - filePath: The path to the signed PE file
+//
+// Returns:
+//   - *SignatureInfo: The decoded signature details
+//   - error: An error if the signature cannot be extracted or parsed
+//
+// Example usage:
+//
+//	info, err := sigtool.Inspect("signed.exe")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	fmt.Printf("Signed by %s\n", info.Signer.Subject)
+func Inspect(filePath string) (*SignatureInfo, error) {
+	signature, err := ExtractDigitalSignature(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract signature: %w", err)
+	}
+
+	return inspectSignature(signature)
+}
+
+// inspectSignature builds a SignatureInfo from a raw PKCS#7 or XML
+// signature
+func inspectSignature(signature []byte) (*SignatureInfo, error) {
+	if isXMLSignature(signature) {
+		return inspectXMLSignature(signature)
+	}
+	if isPGPSignature(signature) || bytes.HasPrefix(bytes.TrimSpace(signature), []byte("-----BEGIN PGP SIGNATURE")) {
+		return nil, errors.New("OpenPGP signatures are described by InspectPGPSignatures")
+	}
+	if isAPKSigningBlock(signature) {
+		return nil, errors.New("APK signatures are described by InspectAPKSignatures")
+	}
+	p7, err := parsePKCS7(signature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS#7 signature: %w", err)
+	}
+
+	algorithm, digest, err := storedDigest(p7)
+	if err != nil {
+		return nil, err
+	}
+
+	signer := p7.GetOnlySigner()
+	if signer == nil {
+		return nil, errors.New("signature must have exactly one signer with an embedded certificate")
+	}
+
+	info := &SignatureInfo{
+		Signer:          newCertificateInfo(signer),
+		DigestAlgorithm: algorithm,
+		Digest:          digest,
+	}
+	addCertificateInfo(info, p7.Certificates)
+
+	if info.Timestamp, err = parseTimestamp(p7); err != nil {
+		return nil, err
+	}
+
+	var opus asn1.RawValue
+	if err := p7.UnmarshalSignedAttribute(oidSpcSpOpusInfo, &opus); err == nil {
+		if info.ProgramName, info.MoreInfoURL, err = parseSpcSpOpusInfo(opus.FullBytes); err != nil {
+			return nil, err
+		}
+	}
+
+	var signingTime time.Time
+	if err := p7.UnmarshalSignedAttribute(oidAttributeSigningTime, &signingTime); err == nil {
+		info.SigningTime = signingTime
+	} else if info.Timestamp != nil {
+		info.SigningTime = info.Timestamp.Time
+	}
+
+	return info, nil
+}
+
+// addCertificateInfo lists certs, the embedded certificates, in info and
+// derives the test-signing and EV status from them and info.Signer
+func addCertificateInfo(info *SignatureInfo, certs []*x509.Certificate) {
+	info.TestSigned = info.Signer.SelfSigned || info.Signer.TestSigningMarker != ""
+	info.ExtendedValidation = info.Signer.ExtendedValidation
+	for _, cert := range certs {
+		certInfo := newCertificateInfo(cert)
+		info.TestSigned = info.TestSigned || certInfo.TestSigningMarker != ""
+		info.Certificates = append(info.Certificates, *certInfo)
+	}
+}
+
+// newCertificateInfo summarizes cert
+func newCertificateInfo(cert *x509.Certificate) *CertificateInfo {
+	sum1 := sha1.Sum(cert.Raw) // #nosec G401 - thumbprint only
+	sum256 := sha256.Sum256(cert.Raw)
+	return &CertificateInfo{
+		Subject:            cert.Subject.String(),
+		CommonName:         cert.Subject.CommonName,
+		Issuer:             cert.Issuer.String(),
+		SerialNumber:       fmt.Sprintf("%x", cert.SerialNumber),
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		SHA1Thumbprint:     hex.EncodeToString(sum1[:]),
+		SHA256Thumbprint:   hex.EncodeToString(sum256[:]),
+		SelfSigned:         selfIssued(cert),
+		TestSigningMarker:  testSigningMarker(cert),
+		ExtendedValidation: hasPolicy(cert, oidEVCodeSigning),
+		Certificate:        cert,
+	}
+}
+
+// selfIssued reports whether cert is issued by itself. Unlike isSelfSigned
+// it is used for reporting, so key identifiers are trusted when present and
+// signatures with algorithms crypto/x509 no longer verifies, such as SHA-1,
+// are accepted on the name match alone.
+func selfIssued(cert *x509.Certificate) bool {
+	if !bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		return false
+	}
+	if len(cert.AuthorityKeyId) > 0 && len(cert.SubjectKeyId) > 0 {
+		return bytes.Equal(cert.AuthorityKeyId, cert.SubjectKeyId)
+	}
+	err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature)
+	var insecure x509.InsecureAlgorithmError
+	return err == nil || errors.As(err, &insecure)
+}
+
+// hasPolicy reports whether cert asserts the certificate policy oid
+func hasPolicy(cert *x509.Certificate, oid asn1.ObjectIdentifier) bool {
+	for _, policy := range cert.PolicyIdentifiers {
+		if policy.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
+
+// testSigningMarker returns the test-signing marker in the subject or
+// issuer of cert, or an empty string
+func testSigningMarker(cert *x509.Certificate) string {
+	names := strings.ToLower(cert.Subject.String() + "\n" + cert.Issuer.String())
+	for _, marker := range testSigningMarkers {
+		if strings.Contains(names, strings.ToLower(marker)) {
+			return marker
+		}
+	}
+	return ""
+}
+
+// findCertificate returns the certificate embedded in p7 that matches ias
+func findCertificate(p7 *pkcs7.PKCS7, ias issuerAndSerial) *x509.Certificate {
+	for _, cert := range p7.Certificates {
+		if cert.SerialNumber.Cmp(ias.SerialNumber) == 0 && bytes.Equal(cert.RawIssuer, ias.IssuerName.FullBytes) {
+			return cert
+		}
+	}
+	return nil
+}
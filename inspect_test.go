@@ -0,0 +1,218 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+func TestInspect_SignedPE(t *testing.T) {
+	filePath, digest := createSignedMockPE(t, crypto.SHA256)
+
+	info, err := Inspect(filePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	cert, _ := testSigner(t)
+	if info.Signer.Subject != cert.Subject.String() {
+		t.Errorf("Expected signer subject %q, got %q", cert.Subject, info.Signer.Subject)
+	}
+	if info.Signer.CommonName != cert.Subject.CommonName {
+		t.Errorf("Expected signer common name %q, got %q", cert.Subject.CommonName, info.Signer.CommonName)
+	}
+	if info.Signer.Issuer != cert.Issuer.String() {
+		t.Errorf("Expected signer issuer %q, got %q", cert.Issuer, info.Signer.Issuer)
+	}
+	if info.Signer.SerialNumber != "3e9" {
+		t.Errorf("Expected serial 3e9, got %q", info.Signer.SerialNumber)
+	}
+	if len(info.Signer.SHA256Thumbprint) != 64 || len(info.Signer.SHA1Thumbprint) != 40 {
+		t.Errorf("Unexpected thumbprints %q / %q", info.Signer.SHA256Thumbprint, info.Signer.SHA1Thumbprint)
+	}
+	if info.DigestAlgorithm != crypto.SHA256 || !bytes.Equal(info.Digest, digest) {
+		t.Errorf("Expected SHA-256 digest %x, got %v %x", digest, info.DigestAlgorithm, info.Digest)
+	}
+	if len(info.Certificates) != 1 {
+		t.Errorf("Expected 1 certificate, got %d", len(info.Certificates))
+	}
+	if info.Timestamp != nil || !info.SigningTime.IsZero() {
+		t.Errorf("Expected no timestamp, got %+v at %v", info.Timestamp, info.SigningTime)
+	}
+}
+
+func TestInspect_CounterSignature(t *testing.T) {
+	when := time.Date(2020, 5, 17, 12, 30, 0, 0, time.UTC)
+	image := mockPEImage([]byte("payload"))
+	signature := signAuthenticodeForTest(t, mockAuthentihash(image, crypto.SHA256), crypto.SHA256, withCounterSignature(t, when))
+
+	filePath := createMockPEFile(t, true, signature)
+	info, err := Inspect(filePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if info.Timestamp == nil {
+		t.Fatal("Expected timestamp info")
+	}
+	if info.Timestamp.Type != TimestampCounterSignature {
+		t.Errorf("Expected countersignature timestamp, got %q", info.Timestamp.Type)
+	}
+	if !info.Timestamp.Time.Equal(when) || !info.SigningTime.Equal(when) {
+		t.Errorf("Expected timestamp %v, got %v / %v", when, info.Timestamp.Time, info.SigningTime)
+	}
+	if info.Timestamp.Signer == nil || !strings.Contains(info.Timestamp.Signer.Subject, "sigtool test signer") {
+		t.Errorf("Expected timestamp signer, got %+v", info.Timestamp.Signer)
+	}
+}
+
+func TestInspect_Errors(t *testing.T) {
+	_, err := Inspect(createMockPEFile(t, false, nil))
+	if err == nil || !strings.Contains(err.Error(), "not digitally signed") {
+		t.Errorf("Expected 'not digitally signed' error, got: %v", err)
+	}
+
+	_, err = Inspect(createMockPEFile(t, true, []byte("invalid-pkcs7-data")))
+	if err == nil || !strings.Contains(err.Error(), "failed to parse PKCS#7") {
+		t.Errorf("Expected 'failed to parse PKCS#7' error, got: %v", err)
+	}
+}
+
+// opusInfoForTest builds an SpcSpOpusInfo attribute from already encoded
+// SpcString and SpcLink values
+func opusInfoForTest(t *testing.T, programName, moreInfo asn1.RawValue) testAttribute {
+	t.Helper()
+
+	var fields []byte
+	fields = append(fields, contextValue(t, 0, true, programName.FullBytes).FullBytes...)
+	fields = append(fields, contextValue(t, 1, true, moreInfo.FullBytes).FullBytes...)
+	return testAttr(t, oidSpcSpOpusInfo, asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: fields})
+}
+
+// contextValue returns an encoded context-specific value
+func contextValue(t *testing.T, tag int, compound bool, content []byte) asn1.RawValue {
+	t.Helper()
+
+	der, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tag, IsCompound: compound, Bytes: content})
+	if err != nil {
+		t.Fatalf("Failed to marshal value: %v", err)
+	}
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tag, IsCompound: compound, Bytes: content, FullBytes: der}
+}
+
+func TestInspect_OpusInfo(t *testing.T) {
+	var bmp []byte
+	for _, r := range utf16.Encode([]rune("Test Tool™")) {
+		bmp = append(bmp, byte(r>>8), byte(r))
+	}
+	attr := opusInfoForTest(t,
+		contextValue(t, 0, false, bmp),
+		contextValue(t, 0, false, []byte("https://example.com/tool")))
+
+	filePath, _ := createSignedMockPEWithPayload(t, crypto.SHA256, []byte("payload"), withAuthenticatedAttribute(t, attr))
+	if err := IsValidDigitalSignature(filePath); err != nil {
+		t.Fatalf("Expected signature with opus info to verify, got: %v", err)
+	}
+
+	info, err := Inspect(filePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if info.ProgramName != "Test Tool™" {
+		t.Errorf("Expected program name 'Test Tool™', got %q", info.ProgramName)
+	}
+	if info.MoreInfoURL != "https://example.com/tool" {
+		t.Errorf("Expected publisher URL, got %q", info.MoreInfoURL)
+	}
+}
+
+func TestInspect_OpusInfoASCIIAndFileLink(t *testing.T) {
+	file := contextValue(t, 1, false, []byte("readme.txt"))
+	attr := opusInfoForTest(t,
+		contextValue(t, 1, false, []byte("ascii tool")),
+		contextValue(t, 2, true, file.FullBytes))
+
+	filePath, _ := createSignedMockPEWithPayload(t, crypto.SHA256, []byte("payload"), withAuthenticatedAttribute(t, attr))
+	info, err := Inspect(filePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if info.ProgramName != "ascii tool" || info.MoreInfoURL != "readme.txt" {
+		t.Errorf("Expected 'ascii tool' and 'readme.txt', got %q and %q", info.ProgramName, info.MoreInfoURL)
+	}
+}
+
+func TestInspect_NoOpusInfo(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+	info, err := Inspect(filePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if info.ProgramName != "" || info.MoreInfoURL != "" {
+		t.Errorf("Expected no opus info, got %q and %q", info.ProgramName, info.MoreInfoURL)
+	}
+}
+
+func TestInspect_TestSigning(t *testing.T) {
+	selfSigned, _ := createSignedMockPE(t, crypto.SHA256)
+	info, err := Inspect(selfSigned)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !info.Signer.SelfSigned || !info.TestSigned {
+		t.Errorf("Expected a self-signed signer to be flagged, got SelfSigned=%v TestSigned=%v", info.Signer.SelfSigned, info.TestSigned)
+	}
+
+	ca := issueCertificateForTest(t, testCATemplate("inspect root", 110), nil)
+	leaf := issueCertificateForTest(t, testLeafTemplate("release signer", 111, x509.ExtKeyUsageCodeSigning), ca)
+	info, err = Inspect(createSignedMockPEAs(t, leaf, crypto.SHA256))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if info.Signer.SelfSigned || info.TestSigned {
+		t.Errorf("Expected a CA-issued signer not to be flagged, got %+v", info.Signer)
+	}
+
+	wdk := issueCertificateForTest(t, testLeafTemplate("WDKTestCert builder,133", 112, x509.ExtKeyUsageCodeSigning), ca)
+	info, err = Inspect(createSignedMockPEAs(t, wdk, crypto.SHA256))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if info.Signer.TestSigningMarker != "WDKTestCert" || !info.TestSigned {
+		t.Errorf("Expected the WDK test certificate to be flagged, got %+v", info.Signer)
+	}
+
+	untrusted := issueCertificateForTest(t, testCATemplate("DO_NOT_TRUST_FiddlerRoot", 113), nil)
+	if marker := testSigningMarker(untrusted.Cert); marker != "DO_NOT_TRUST" {
+		t.Errorf("Expected the DO_NOT_TRUST marker, got %q", marker)
+	}
+}
+
+func TestInspect_ExtendedValidation(t *testing.T) {
+	ca := issueCertificateForTest(t, testCATemplate("EV root", 120), nil)
+	template := testLeafTemplate("EV signer", 121, x509.ExtKeyUsageCodeSigning)
+	template.PolicyIdentifiers = []asn1.ObjectIdentifier{{2, 23, 140, 1, 3}}
+	ev := issueCertificateForTest(t, template, ca)
+	standard := issueCertificateForTest(t, testLeafTemplate("OV signer", 122, x509.ExtKeyUsageCodeSigning), ca)
+
+	info, err := Inspect(createSignedMockPEAs(t, ev, crypto.SHA256))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !info.ExtendedValidation || !info.Signer.ExtendedValidation {
+		t.Errorf("Expected an EV signer, got %+v", info.Signer)
+	}
+
+	info, err = Inspect(createSignedMockPEAs(t, standard, crypto.SHA256))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if info.ExtendedValidation {
+		t.Error("Expected a non-EV signer")
+	}
+}
@@ -0,0 +1,468 @@
+// Package yamlsubset parses the YAML subset used by sigtool configuration
+// and policy files: nested block mappings, block (- item) and flow ([a, b],
+// {a: b}) collections, plain and quoted scalars and comments. Anchors,
+// aliases, tags, multi-line scalars and multiple documents are not
+// supported, tabs are not allowed for indentation, and a plain scalar
+// containing ": " must be quoted. A leading byte order mark is ignored.
+package yamlsubset
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Scalar is a parsed scalar. Quoted scalars are always strings; plain ones
+// may also be booleans or null, as JSON resolves them.
+type Scalar struct {
+	Value  string
+	Quoted bool
+}
+
+// line is a non-blank line without its comment
+type line struct {
+	no     int
+	indent int
+	text   string
+}
+
+// parser reads the block structure of lines
+type parser struct {
+	lines []line
+	pos   int
+}
+
+// Parse parses data into map[string]interface{} mappings, []interface{}
+// sequences and Scalar values. Keys without a value hold nil, and an empty
+// document is an empty mapping.
+func Parse(data []byte) (interface{}, error) {
+	lines, err := splitLines(bytes.TrimPrefix(data, []byte("\ufeff")))
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return map[string]interface{}{}, nil
+	}
+	p := &parser{lines: lines}
+	v, err := p.block(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].no)
+	}
+	return v, nil
+}
+
+// splitLines returns the non-blank lines of data without their comments,
+// rejecting tab indentation
+func splitLines(data []byte) ([]line, error) {
+	var lines []line
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for no := 1; scanner.Scan(); no++ {
+		text := strings.TrimRight(stripComment(scanner.Text()), " \t\r")
+		trimmed := strings.TrimLeft(text, " \t")
+		if trimmed == "" || trimmed == "---" || trimmed == "..." {
+			continue
+		}
+		indent := len(text) - len(trimmed)
+		if strings.Contains(text[:indent], "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", no)
+		}
+		lines = append(lines, line{no: no, indent: indent, text: trimmed})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// stripComment removes a # comment from s. A # starts a comment at the
+// start of s or after a space, outside quoted scalars.
+func stripComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\', quote == '\'' && c == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" \t[{,:", s[i-1]) >= 0):
+			quote = c
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// block parses the mapping or sequence whose entries start at indent
+func (p *parser) block(indent int) (interface{}, error) {
+	if isItem(p.lines[p.pos].text) {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+// isItem reports whether text is a block sequence item
+func isItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// mapping parses the block mapping whose keys start at indent
+func (p *parser) mapping(indent int) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent < indent {
+			break
+		}
+		if l.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", l.no)
+		}
+		if isItem(l.text) {
+			return nil, fmt.Errorf("line %d: list item outside a list", l.no)
+		}
+		key, value, ok, err := splitEntry(l.text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", l.no, err)
+		}
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", l.no)
+		}
+		if _, dup := m[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key %q", l.no, key)
+		}
+		p.pos++
+
+		if value != "" {
+			v, err := parseValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", l.no, err)
+			}
+			m[key] = v
+			continue
+		}
+		// A sequence value may start at the indentation of its key
+		m[key] = nil
+		if p.pos < len(p.lines) {
+			next := p.lines[p.pos]
+			if next.indent > indent || (next.indent == indent && isItem(next.text)) {
+				v, err := p.block(next.indent)
+				if err != nil {
+					return nil, err
+				}
+				m[key] = v
+			}
+		}
+	}
+	return m, nil
+}
+
+// sequence parses the block sequence whose items start at indent
+func (p *parser) sequence(indent int) ([]interface{}, error) {
+	items := []interface{}{}
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent < indent || (l.indent == indent && !isItem(l.text)) {
+			break
+		}
+		if l.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", l.no)
+		}
+		rest := strings.TrimLeft(strings.TrimPrefix(l.text, "-"), " ")
+		if rest == "" {
+			p.pos++
+			var item interface{}
+			if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+				v, err := p.block(p.lines[p.pos].indent)
+				if err != nil {
+					return nil, err
+				}
+				item = v
+			}
+			items = append(items, item)
+			continue
+		}
+
+		// A nested collection starts on the line of its dash, and its
+		// following lines are indented to the same column
+		_, _, entry, err := splitEntry(rest)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", l.no, err)
+		}
+		if entry || isItem(rest) {
+			column := indent + len(l.text) - len(rest)
+			p.lines[p.pos] = line{no: l.no, indent: column, text: rest}
+			v, err := p.block(column)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+			continue
+		}
+		v, err := parseValue(rest)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", l.no, err)
+		}
+		items = append(items, v)
+		p.pos++
+	}
+	return items, nil
+}
+
+// splitEntry splits a block mapping entry "key: value" into its unquoted
+// key and its value, reporting whether text is an entry at all
+func splitEntry(text string) (key, value string, ok bool, err error) {
+	if text[0] == '"' || text[0] == '\'' {
+		f := &flow{s: text}
+		k, err := f.quoted()
+		if err != nil {
+			return "", "", false, err
+		}
+		rest := text[f.i:]
+		if !strings.HasPrefix(rest, ":") || (len(rest) > 1 && rest[1] != ' ') {
+			return "", "", false, nil
+		}
+		return k, strings.TrimSpace(rest[1:]), true, nil
+	}
+	if text[0] == '[' || text[0] == '{' {
+		return "", "", false, nil
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i == len(text)-1 || text[i+1] == ' ') {
+			key = strings.TrimSpace(text[:i])
+			if key == "" {
+				return "", "", false, nil
+			}
+			return key, strings.TrimSpace(text[i+1:]), true, nil
+		}
+	}
+	return "", "", false, nil
+}
+
+// parseValue parses the value of a mapping entry or sequence item given on
+// its line: a flow collection, a quoted scalar or a plain scalar
+func parseValue(s string) (interface{}, error) {
+	switch s[0] {
+	case '[', '{', '"', '\'':
+		f := &flow{s: s}
+		v, err := f.value()
+		if err != nil {
+			return nil, err
+		}
+		if f.space(); f.i < len(f.s) {
+			return nil, fmt.Errorf("unexpected %q after value", f.s[f.i:])
+		}
+		return v, nil
+	case '|', '>':
+		return nil, errors.New("multi-line scalars are not supported")
+	case '&', '*', '!':
+		return nil, errors.New("anchors, aliases and tags are not supported")
+	}
+	if strings.Contains(s, ": ") {
+		return nil, errors.New("unexpected \": \" in a plain scalar; quote the value")
+	}
+	return Scalar{Value: s}, nil
+}
+
+// flow parses the flow collections and quoted scalars of s
+type flow struct {
+	s string
+	i int
+}
+
+// space skips spaces
+func (f *flow) space() {
+	for f.i < len(f.s) && f.s[f.i] == ' ' {
+		f.i++
+	}
+}
+
+// value parses a flow collection or scalar
+func (f *flow) value() (interface{}, error) {
+	f.space()
+	if f.i == len(f.s) {
+		return nil, errors.New("missing value")
+	}
+	switch f.s[f.i] {
+	case '[':
+		return f.sequence()
+	case '{':
+		return f.mapping()
+	case '"', '\'':
+		s, err := f.quoted()
+		if err != nil {
+			return nil, err
+		}
+		return Scalar{Value: s, Quoted: true}, nil
+	}
+	return Scalar{Value: f.plain(false)}, nil
+}
+
+// sequence parses a flow sequence
+func (f *flow) sequence() ([]interface{}, error) {
+	items := []interface{}{}
+	f.i++
+	for {
+		if f.space(); f.i < len(f.s) && f.s[f.i] == ']' {
+			f.i++
+			return items, nil
+		}
+		v, err := f.value()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+		if !f.separator(']') {
+			return nil, errors.New("unterminated list")
+		}
+	}
+}
+
+// mapping parses a flow mapping
+func (f *flow) mapping() (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	f.i++
+	for {
+		if f.space(); f.i < len(f.s) && f.s[f.i] == '}' {
+			f.i++
+			return m, nil
+		}
+		var key string
+		if f.i < len(f.s) && (f.s[f.i] == '"' || f.s[f.i] == '\'') {
+			k, err := f.quoted()
+			if err != nil {
+				return nil, err
+			}
+			key = k
+		} else {
+			key = f.plain(true)
+		}
+		if f.space(); key == "" || f.i == len(f.s) || f.s[f.i] != ':' {
+			return nil, errors.New("expected \"key: value\" in mapping")
+		}
+		if _, dup := m[key]; dup {
+			return nil, fmt.Errorf("duplicate key %q", key)
+		}
+		f.i++
+		v, err := f.value()
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+		if !f.separator('}') {
+			return nil, errors.New("unterminated mapping")
+		}
+	}
+}
+
+// separator consumes the comma after a flow entry, or the end of the
+// collection; it reports false when neither follows
+func (f *flow) separator(end byte) bool {
+	if f.space(); f.i == len(f.s) {
+		return false
+	}
+	switch f.s[f.i] {
+	case ',':
+		f.i++
+		return true
+	case end:
+		return true
+	}
+	return false
+}
+
+// plain parses a plain scalar up to the next flow indicator. Keys also end
+// at a colon followed by a space or an indicator.
+func (f *flow) plain(key bool) string {
+	start := f.i
+	for ; f.i < len(f.s); f.i++ {
+		c := f.s[f.i]
+		if c == ',' || c == ']' || c == '}' {
+			break
+		}
+		if key && c == ':' && (f.i+1 == len(f.s) || strings.IndexByte(" ,]}", f.s[f.i+1]) >= 0) {
+			break
+		}
+	}
+	return strings.TrimSpace(f.s[start:f.i])
+}
+
+// quoted parses a double-quoted scalar with backslash escapes, or a
+// single-quoted scalar where a doubled quote stands for one
+func (f *flow) quoted() (string, error) {
+	quote := f.s[f.i]
+	if quote == '\'' {
+		var b strings.Builder
+		for i := f.i + 1; i < len(f.s); i++ {
+			if f.s[i] != '\'' {
+				b.WriteByte(f.s[i])
+				continue
+			}
+			if i+1 < len(f.s) && f.s[i+1] == '\'' {
+				b.WriteByte('\'')
+				i++
+				continue
+			}
+			f.i = i + 1
+			return b.String(), nil
+		}
+		return "", errors.New("unterminated quoted scalar")
+	}
+	for i := f.i + 1; i < len(f.s); i++ {
+		switch f.s[i] {
+		case '\\':
+			i++
+		case '"':
+			s, err := strconv.Unquote(f.s[f.i : i+1])
+			if err != nil {
+				return "", fmt.Errorf("invalid quoted scalar %s: %w", f.s[f.i:i+1], err)
+			}
+			f.i = i + 1
+			return s, nil
+		}
+	}
+	return "", errors.New("unterminated quoted scalar")
+}
+
+// JSON converts a value returned by Parse for encoding/json: plain true
+// and false become booleans, null, ~ and empty values nil, and every other
+// scalar a string, so that digits-only values such as thumbprints keep
+// decoding into string fields
+func JSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[key] = JSON(value)
+		}
+		return m
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = JSON(item)
+		}
+		return items
+	case Scalar:
+		if v.Quoted {
+			return v.Value
+		}
+		switch v.Value {
+		case "true", "True", "TRUE":
+			return true
+		case "false", "False", "FALSE":
+			return false
+		case "null", "Null", "NULL", "~", "":
+			return nil
+		}
+		return v.Value
+	}
+	return nil
+}
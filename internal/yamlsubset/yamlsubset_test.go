@@ -0,0 +1,109 @@
+package yamlsubset
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// s returns a plain scalar
+func s(value string) Scalar { return Scalar{Value: value} }
+
+// q returns a quoted scalar
+func q(value string) Scalar { return Scalar{Value: value, Quoted: true} }
+
+type (
+	m = map[string]interface{}
+	l = []interface{}
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want interface{}
+	}{
+		{"empty", "", m{}},
+		{"comments only", "# sigtool\n---\n\n", m{}},
+		{"scalars", "cafile: /etc/roots.pem\nworkers: 16\n", m{"cafile": s("/etc/roots.pem"), "workers": s("16")}},
+		{"empty value", "tsa:\nocsp: true\n", m{"tsa": nil, "ocsp": s("true")}},
+		{"byte order mark", "\ufeffa: b\n", m{"a": s("b")}},
+		{"quoted colon and space", "a: \"b: c\"\n", m{"a": q("b: c")}},
+		{"plain colons", "url: http://example.com:80/x\npath: C:\\roots.pem\n", m{"url": s("http://example.com:80/x"), "path": s("C:\\roots.pem")}},
+		{"block list", "tsa:\n  - http://a\n  - http://b\n", m{"tsa": l{s("http://a"), s("http://b")}}},
+		{"block list at key indentation", "tsa:\n- a\n- b\nocsp: true\n", m{"tsa": l{s("a"), s("b")}, "ocsp": s("true")}},
+		{"flow list", "tsa: [a, \"b, c\", 'd']\n", m{"tsa": l{s("a"), q("b, c"), q("d")}}},
+		{"empty flow list", "tsa: []\n", m{"tsa": l{}}},
+		{"flow mapping", "signer: {subject: CN=Release, thumbprint: \"ab\"}\n", m{"signer": m{"subject": s("CN=Release"), "thumbprint": q("ab")}}},
+		{"nested flow", "a: [[1, 2], {b: [c]}]\n", m{"a": l{l{s("1"), s("2")}, m{"b": l{s("c")}}}}},
+		{"sections", "cafile: a.pem\nverify:\n  output: sarif\n  cafile: b.pem\n", m{"cafile": s("a.pem"), "verify": m{"output": s("sarif"), "cafile": s("b.pem")}}},
+		{"nested sections", "a:\n  b:\n    c: d\n  e: f\n", m{"a": m{"b": m{"c": s("d")}, "e": s("f")}}},
+		{"list of mappings", "signers:\n  - subject: CN=A\n    issuer: CN=CA\n  - thumbprint: ab\n", m{"signers": l{m{"subject": s("CN=A"), "issuer": s("CN=CA")}, m{"thumbprint": s("ab")}}}},
+		{"nested list", "a:\n  - - b\n    - c\n  -\n    - d\n", m{"a": l{l{s("b"), s("c")}, l{s("d")}}}},
+		{"double quotes", "a: \"x # y\"\n", m{"a": q("x # y")}},
+		{"escaped double quotes", "a: \"say \\\"hi\\\" # x\"\n", m{"a": q("say \"hi\" # x")}},
+		{"escapes", "a: \"tab\\there\\u00e9\"\n", m{"a": q("tab\there\u00e9")}},
+		{"single quotes", "a: 'it''s # here'\n", m{"a": q("it's # here")}},
+		{"quoted key", "\"a: b\": c\n", m{"a: b": s("c")}},
+		{"inline comment", "a: b # note\nc: [d, e] # note\n", m{"a": s("b"), "c": l{s("d"), s("e")}}},
+		{"comment after quotes", "a: \"b\" # note\n", m{"a": q("b")}},
+		{"hash without space", "a: b#c\n", m{"a": s("b#c")}},
+		{"apostrophe in plain scalar", "a: it's # note\n", m{"a": s("it's")}},
+		{"top-level list", "- a\n- b\n", l{s("a"), s("b")}},
+		{"crlf", "a: b\r\nc: d\r\n", m{"a": s("b"), "c": s("d")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("Parse returned an error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %#v, got %#v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"tab indentation", "verify:\n\toutput: sarif\n", "line 2: tabs are not allowed for indentation"},
+		{"tab after spaces", "verify:\n  \toutput: sarif\n", "line 2: tabs are not allowed for indentation"},
+		{"missing colon", "cafile\n", "line 1: expected \"key: value\""},
+		{"list item outside a list", "a: b\n- c\n", "line 2: list item outside a list"},
+		{"unexpected indentation", "a: b\n  c: d\n", "line 2: unexpected indentation"},
+		{"misaligned mapping", "a:\n    b: c\n  d: e\n", "line 3: unexpected indentation"},
+		{"duplicate key", "a: b\na: c\n", "line 2: duplicate key \"a\""},
+		{"unterminated list", "a: [b, c\n", "line 1: unterminated list"},
+		{"unterminated mapping", "a: {b: c\n", "line 1: unterminated mapping"},
+		{"unterminated quote", "a: \"b\n", "line 1: unterminated quoted scalar"},
+		{"text after quotes", "a: \"b\" c\n", "line 1: unexpected"},
+		{"multi-line scalar", "a: |\n  b\n", "line 1: multi-line scalars are not supported"},
+		{"colon in plain scalar", "k: a: b\n", "line 1: unexpected \": \" in a plain scalar; quote the value"},
+		{"colon in plain list item", "k:\n  - a: b: c\n", "line 2: unexpected \": \" in a plain scalar; quote the value"},
+		{"anchor", "a: &x b\n", "line 1: anchors, aliases and tags are not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.data))
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("Expected an error starting with %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestJSON(t *testing.T) {
+	doc, err := Parse([]byte("a: true\nb: \"true\"\nc: 16\nd: 1.5\ne: ~\nf:\ng: [False, x]\n"))
+	if err != nil {
+		t.Fatalf("Parse returned an error: %v", err)
+	}
+	want := m{"a": true, "b": "true", "c": "16", "d": "1.5", "e": nil, "f": nil, "g": l{false, "x"}}
+	if got := JSON(doc); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %#v, got %#v", want, got)
+	}
+}
@@ -0,0 +1,575 @@
+package sigtool
+
+import (
+	"crypto"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"go.mozilla.org/pkcs7"
+)
+
+// jarManifestName is the manifest of a JAR, which lists the digests of its
+// entries
+const jarManifestName = "META-INF/MANIFEST.MF"
+
+// jarDigestAlgorithms are the digest attribute name prefixes of manifests
+// and signature files, strongest first
+var jarDigestAlgorithms = []struct {
+	name      string
+	algorithm crypto.Hash
+}{
+	{"SHA-512", crypto.SHA512},
+	{"SHA-384", crypto.SHA384},
+	{"SHA-256", crypto.SHA256},
+	{"SHA-1", crypto.SHA1},
+	{"SHA1", crypto.SHA1},
+}
+
+// JARSigner is a signer of a JAR, or of the JAR signature of an APK, as
+// reported by InspectJARSignatures.
+type JARSigner struct {
+	// Name is the base name of the signature file and block, such as
+	// "CERT" for META-INF/CERT.SF and META-INF/CERT.RSA
+	Name string
+	// Signer is the signing certificate
+	Signer *CertificateInfo
+	// Certificates lists the certificates embedded in the signature block
+	Certificates []CertificateInfo
+	// Timestamp is the RFC 3161 timestamp of the signature, nil when it is
+	// not timestamped
+	Timestamp *TimestampInfo `json:",omitempty"`
+	// APKSchemes lists the APK Signature Scheme versions the signature file
+	// declares the APK is also signed with, from X-Android-APK-Signed
+	APKSchemes []int `json:",omitempty"`
+}
+
+// jarAttribute is a name and value of a manifest or signature file section
+type jarAttribute struct {
+	name, value string
+}
+
+// jarSection is a section of a manifest or signature file
+type jarSection struct {
+	// raw is the section as it appears in the file, with the blank line
+	// ending it, which is what the signature file digests
+	raw        []byte
+	attributes []jarAttribute
+}
+
+// jarDigest is a digest attribute of a section
+type jarDigest struct {
+	algorithm crypto.Hash
+	value     []byte
+}
+
+// jarSignature is a signature file of a JAR and the PKCS#7 signature block
+// signing it
+type jarSignature struct {
+	name string
+	// fileName and blockName are the names of the signature file and block
+	fileName, blockName string
+	// raw is the signature block
+	raw  []byte
+	p7   *pkcs7.PKCS7
+	file []jarSection
+	// sf is the signature file, the content the block signs
+	sf     []byte
+	signer *x509.Certificate
+	// weakDigest is set when the manifest digests the signature relies on
+	// are no stronger than SHA-1
+	weakDigest bool
+}
+
+// get returns the value of the attribute name, which is matched without
+// regard to case
+func (s *jarSection) get(name string) (string, bool) {
+	for _, attr := range s.attributes {
+		if strings.EqualFold(attr.name, name) {
+			return attr.value, true
+		}
+	}
+	return "", false
+}
+
+// digests returns the digest attributes of s with the name suffix, such as
+// "-Digest" or "-Digest-Manifest", strongest first
+func (s *jarSection) digests(suffix string) ([]jarDigest, error) {
+	var digests []jarDigest
+	for _, known := range jarDigestAlgorithms {
+		value, ok := s.get(known.name + suffix)
+		if !ok {
+			continue
+		}
+		digest, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("malformed %s%s attribute: %w", known.name, suffix, err)
+		}
+		digests = append(digests, jarDigest{algorithm: known.algorithm, value: digest})
+	}
+	return digests, nil
+}
+
+// checkJARDigests reports a DigestMismatchError unless data matches every
+// digest of digests
+func checkJARDigests(digests []jarDigest, data []byte) error {
+	for _, d := range digests {
+		h := d.algorithm.New()
+		h.Write(data)
+		if computed := h.Sum(nil); subtle.ConstantTimeCompare(d.value, computed) != 1 {
+			return &DigestMismatchError{Algorithm: d.algorithm, Signed: d.value, Computed: computed}
+		}
+	}
+	return nil
+}
+
+// parseJARManifest splits a manifest or signature file into its sections,
+// the main section first, joining continuation lines
+func parseJARManifest(data []byte) ([]jarSection, error) {
+	var sections []jarSection
+	// The main section may be empty, when the file starts with a blank line
+	current, start := &jarSection{}, 0
+	for pos := 0; pos < len(data); {
+		end := pos
+		for end < len(data) && data[end] != '\r' && data[end] != '\n' {
+			end++
+		}
+		next := end
+		if next < len(data) {
+			next++
+			if data[end] == '\r' && next < len(data) && data[next] == '\n' {
+				next++
+			}
+		}
+		line := data[pos:end]
+		switch {
+		case len(line) == 0:
+			if current != nil {
+				current.raw = data[start:next]
+				sections = append(sections, *current)
+				current = nil
+			}
+		case line[0] == ' ':
+			if current == nil || len(current.attributes) == 0 {
+				return nil, fmt.Errorf("continuation line without an attribute at offset %d", pos)
+			}
+			current.attributes[len(current.attributes)-1].value += string(line[1:])
+		default:
+			if current == nil {
+				current, start = &jarSection{}, pos
+			}
+			name, value, ok := strings.Cut(string(line), ": ")
+			if !ok || name == "" {
+				return nil, fmt.Errorf("malformed attribute at offset %d", pos)
+			}
+			current.attributes = append(current.attributes, jarAttribute{name: name, value: value})
+		}
+		pos = next
+	}
+	if current != nil && (len(current.attributes) > 0 || len(sections) == 0) {
+		current.raw = data[start:]
+		sections = append(sections, *current)
+	}
+	return sections, nil
+}
+
+// isJARSignatureFile reports whether name is the manifest or a signature
+// file or block of a JAR, which the signatures do not cover
+func isJARSignatureFile(name string) bool {
+	upper := strings.ToUpper(name)
+	rest, ok := strings.CutPrefix(upper, "META-INF/")
+	if !ok || strings.Contains(rest, "/") {
+		return false
+	}
+	switch path.Ext(rest) {
+	case ".SF", ".RSA", ".DSA", ".EC":
+		return true
+	}
+	return rest == "MANIFEST.MF" || strings.HasPrefix(rest, "SIG-")
+}
+
+// isJARPackage reports whether a has a JAR manifest
+func isJARPackage(a *zipArchive) bool {
+	return a.entry(jarManifestName) != nil
+}
+
+// readJARSignatures parses the signature blocks of the JAR a, META-INF/*.RSA,
+// *.DSA and *.EC, and the signature files they sign
+func readJARSignatures(a *zipArchive) ([]*jarSignature, error) {
+	var signatures []*jarSignature
+	for _, e := range a.entries {
+		dir, base := path.Split(e.name)
+		ext := path.Ext(base)
+		if dir != "META-INF/" {
+			continue
+		}
+		switch strings.ToUpper(ext) {
+		case ".RSA", ".DSA", ".EC":
+		default:
+			continue
+		}
+		raw, err := a.readFile(e.name)
+		if err != nil {
+			return nil, err
+		}
+		if len(raw) > MaxSignatureSize {
+			return nil, &SignatureSizeError{Size: int64(len(raw)), Limit: MaxSignatureSize}
+		}
+		s := &jarSignature{name: strings.TrimSuffix(base, ext), blockName: e.name, raw: raw}
+		s.fileName = dir + s.name + ".SF"
+		if s.sf, err = a.readFile(s.fileName); err != nil {
+			return nil, err
+		} else if s.sf == nil {
+			return nil, fmt.Errorf("%w: signature block %s has no signature file %s", ErrInvalidSignature, e.name, s.fileName)
+		}
+		if s.p7, err = parsePKCS7(raw); err != nil {
+			return nil, fmt.Errorf("failed to parse PKCS#7 signature %s: %w", e.name, err)
+		}
+		if len(s.p7.Signers) != 1 {
+			return nil, fmt.Errorf("%w: %s has %d signers", ErrInvalidSignature, e.name, len(s.p7.Signers))
+		}
+		if s.signer, err = signerCertificate(s.p7); err != nil {
+			return nil, fmt.Errorf("%s: %w", e.name, err)
+		}
+		if s.file, err = parseJARManifest(s.sf); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", s.fileName, err)
+		}
+		signatures = append(signatures, s)
+	}
+	if len(signatures) == 0 {
+		return nil, fmt.Errorf("%w (JAR has no signature)", ErrNotSigned)
+	}
+	return signatures, nil
+}
+
+// apkSchemes returns the APK Signature Scheme versions named by the
+// X-Android-APK-Signed attribute of the signature file
+func (s *jarSignature) apkSchemes() []int {
+	value, ok := s.file[0].get("X-Android-APK-Signed")
+	if !ok {
+		return nil
+	}
+	var schemes []int
+	for _, field := range strings.Split(value, ",") {
+		if scheme, err := strconv.Atoi(strings.TrimSpace(field)); err == nil {
+			schemes = append(schemes, scheme)
+		}
+	}
+	return schemes
+}
+
+// info summarizes s
+func (s *jarSignature) info() (JARSigner, error) {
+	info := JARSigner{Name: s.name, Signer: newCertificateInfo(s.signer), APKSchemes: s.apkSchemes()}
+	for _, cert := range s.p7.Certificates {
+		info.Certificates = append(info.Certificates, *newCertificateInfo(cert))
+	}
+	var err error
+	if info.Timestamp, err = parseTimestamp(s.p7); err != nil {
+		return JARSigner{}, fmt.Errorf("%s: %w", s.blockName, err)
+	}
+	return info, nil
+}
+
+// verify checks the signature of the signature file and that it matches
+// the manifest as jarsigner does: the digest of the whole manifest, or else
+// of its main attributes and of each section the signature file lists. It
+// returns the names of the entries signed, or nil when the signature covers
+// the whole manifest.
+func (s *jarSignature) verify(manifest []byte, sections []jarSection) (map[string]bool, error) {
+	s.p7.Content = s.sf
+	if err := s.p7.Verify(); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidSignature, s.blockName, err)
+	}
+	sfName := s.fileName
+
+	whole, err := s.file[0].digests("-Digest-Manifest")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", sfName, err)
+	}
+	if len(whole) > 0 && checkJARDigests(whole, manifest) == nil {
+		s.weakDigest = whole[0].algorithm == crypto.SHA1
+		return nil, nil
+	}
+	main, err := s.file[0].digests("-Digest-Manifest-Main-Attributes")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", sfName, err)
+	}
+	if err := checkJARDigests(main, sections[0].raw); err != nil {
+		return nil, fmt.Errorf("%s manifest main attributes: %w", sfName, err)
+	}
+
+	byName := make(map[string]*jarSection, len(sections))
+	for i := range sections[1:] {
+		name, _ := sections[i+1].get("Name")
+		byName[name] = &sections[i+1]
+	}
+	signed := make(map[string]bool)
+	for i := range s.file[1:] {
+		section := &s.file[i+1]
+		name, ok := section.get("Name")
+		if !ok {
+			return nil, fmt.Errorf("%w: %s has a section without a name", ErrInvalidSignature, sfName)
+		}
+		entry, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s signs %q, which the manifest does not list", ErrInvalidSignature, sfName, name)
+		}
+		digests, err := section.digests("-Digest")
+		if err != nil {
+			return nil, fmt.Errorf("%s entry %q: %w", sfName, name, err)
+		}
+		if len(digests) == 0 {
+			return nil, fmt.Errorf("%w: %s entry %q has no supported digest", ErrInvalidSignature, sfName, name)
+		}
+		if err := checkJARDigests(digests, entry.raw); err != nil {
+			return nil, fmt.Errorf("%s entry %q: %w", sfName, name, err)
+		}
+		s.weakDigest = s.weakDigest || digests[0].algorithm == crypto.SHA1
+		signed[name] = true
+	}
+	return signed, nil
+}
+
+// checkJAREntries checks each entry of a the manifest lists against its
+// digests, and reports whether the digests are no stronger than SHA-1
+func checkJAREntries(a *zipArchive, sections []jarSection) (bool, error) {
+	files := make(map[string]int, len(a.reader.File))
+	for i, f := range a.reader.File {
+		files[f.Name] = i
+	}
+	weak := false
+	for i := range sections[1:] {
+		section := &sections[i+1]
+		name, _ := section.get("Name")
+		digests, err := section.digests("-Digest")
+		if err != nil {
+			return false, fmt.Errorf("%s entry %q: %w", jarManifestName, name, err)
+		}
+		if len(digests) == 0 {
+			continue
+		}
+		index, ok := files[name]
+		if !ok {
+			return false, fmt.Errorf("%w: the manifest lists %q, which is not in the archive", ErrInvalidSignature, name)
+		}
+		hashes := make([]hash.Hash, len(digests))
+		writers := make([]io.Writer, len(digests))
+		for j, d := range digests {
+			hashes[j] = d.algorithm.New()
+			writers[j] = hashes[j]
+		}
+		rc, err := a.reader.File[index].Open()
+		if err != nil {
+			return false, fmt.Errorf("failed to open %s: %w", name, err)
+		}
+		_, err = io.Copy(io.MultiWriter(writers...), rc)
+		rc.Close()
+		if err != nil {
+			return false, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		for j, d := range digests {
+			if computed := hashes[j].Sum(nil); subtle.ConstantTimeCompare(d.value, computed) != 1 {
+				return false, fmt.Errorf("%s: %w", name, &DigestMismatchError{Algorithm: d.algorithm, Signed: d.value, Computed: computed})
+			}
+		}
+		weak = weak || digests[0].algorithm == crypto.SHA1
+	}
+	return weak, nil
+}
+
+// openJAR parses the ZIP archive r and its manifest and signatures
+func openJAR(r io.ReaderAt, size int64) (*zipArchive, []*jarSignature, error) {
+	a, err := openZipArchive(r, size)
+	if err != nil {
+		return nil, nil, err
+	}
+	signatures, err := readJARSignatures(a)
+	if err != nil {
+		return nil, nil, err
+	}
+	return a, signatures, nil
+}
+
+// readJARSignature returns the first signature block of the JAR r
+func readJARSignature(r io.ReaderAt, size int64) ([]byte, error) {
+	_, signatures, err := openJAR(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return signatures[0].raw, nil
+}
+
+// InspectJARSignatures parses the signature files and blocks in META-INF of
+// a JAR, or of an APK signed with the JAR signature scheme, and reports
+// their signers.
+//
+// InspectJARSignatures does not verify the signatures; use Verify to
+// establish trust in the reported values.
+//
+// Parameters:
+//   - filePath: The path to the JAR or APK
+//
+// Returns:
+//   - []JARSigner: The signers in archive order
+//   - error: ErrNotSigned if the archive has no signature block, or an
+//     error if a signature cannot be parsed
+//
+// Example usage:
+//
+//	signers, err := sigtool.InspectJARSignatures("library.jar")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	for _, s := range signers {
+//	    fmt.Printf("%s: %s\n", s.Name, s.Signer.Subject)
+//	}
+func InspectJARSignatures(filePath string) ([]JARSigner, error) {
+	if strings.TrimSpace(filePath) == "" {
+		return nil, errors.New("file path cannot be empty")
+	}
+	// #nosec G304 - This tool is designed to read user-specified files
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %q: %w", filePath, err)
+	}
+	defer f.Close()
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+	_, signatures, err := openJAR(f, fileInfo.Size())
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]JARSigner, len(signatures))
+	for i, s := range signatures {
+		if infos[i], err = s.info(); err != nil {
+			return nil, err
+		}
+	}
+	return infos, nil
+}
+
+// verifyJAR verifies the JAR signatures of r as jarsigner and the Android
+// v1 verifier do: every signature block must sign its signature file, which
+// must match the manifest, and unless disabled each entry must match its
+// manifest digests. Every entry other than the manifest and signatures must
+// be signed by every signer, whose certificates are then checked per opts.
+func verifyJAR(r io.ReaderAt, size int64, opts VerifyOptions) error {
+	a, signatures, err := openJAR(r, size)
+	if err != nil {
+		return fmt.Errorf("failed to extract signature: %w", err)
+	}
+	log := opts.logger()
+	log.Debug("read JAR signatures", "fileSize", size, "signers", len(signatures))
+	manifest, err := a.readFile(jarManifestName)
+	if err != nil {
+		return err
+	}
+	if manifest == nil {
+		return fmt.Errorf("%w: JAR has no %s", ErrInvalidSignature, jarManifestName)
+	}
+	sections, err := parseJARManifest(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", jarManifestName, err)
+	}
+	listed := make(map[string]bool, len(sections))
+	for _, section := range sections[1:] {
+		name, ok := section.get("Name")
+		if !ok {
+			return fmt.Errorf("%w: %s has a section without a name", ErrInvalidSignature, jarManifestName)
+		}
+		if listed[name] {
+			return fmt.Errorf("%w: %s lists %q twice", ErrInvalidSignature, jarManifestName, name)
+		}
+		digests, err := section.digests("-Digest")
+		if err != nil {
+			return fmt.Errorf("%s entry %q: %w", jarManifestName, name, err)
+		}
+		listed[name] = len(digests) > 0
+	}
+
+	signed := make([]map[string]bool, len(signatures))
+	for i, s := range signatures {
+		if signed[i], err = s.verify(manifest, sections); err != nil {
+			return err
+		}
+		log.Debug("verified JAR signature", "signature", s.blockName, "signer", s.signer.Subject.String(), "wholeManifest", signed[i] == nil)
+		// A signature file naming a newer scheme detects the removal of
+		// the APK Signing Block
+		for _, scheme := range s.apkSchemes() {
+			id := map[int]uint32{2: apkSchemeV2BlockID, 3: apkSchemeV3BlockID}[scheme]
+			if id == 0 {
+				continue
+			}
+			block, err := readAPKSigningBlock(a)
+			if err != nil {
+				return err
+			}
+			if block == nil || block.blocks[id] == nil {
+				return fmt.Errorf("%w: %s requires an APK Signature Scheme v%d signature, which was removed", ErrInvalidSignature, s.fileName, scheme)
+			}
+		}
+	}
+
+	seen := make(map[string]bool, len(a.entries))
+	for _, e := range a.entries {
+		if seen[e.name] {
+			return fmt.Errorf("%w: duplicate entry %q", ErrNotZipArchive, e.name)
+		}
+		seen[e.name] = true
+		if strings.HasSuffix(e.name, "/") || isJARSignatureFile(e.name) {
+			continue
+		}
+		if !listed[e.name] {
+			return fmt.Errorf("%w: %s is not listed in the manifest", ErrUnsignedPart, e.name)
+		}
+		for i, s := range signatures {
+			if signed[i] != nil && !signed[i][e.name] {
+				return fmt.Errorf("%w: %s is not signed by %s", ErrUnsignedPart, e.name, s.blockName)
+			}
+		}
+	}
+	weakEntries := false
+	if !opts.SkipContentDigest {
+		if weakEntries, err = checkJAREntries(a, sections); err != nil {
+			return err
+		}
+	}
+
+	trust, err := resolveTrust(opts)
+	if err != nil {
+		return err
+	}
+	for i, s := range signatures {
+		signingTime, err := verifyTimestampAttribute(unauthenticatedAttributes(s.p7), s.p7.Signers[0].EncryptedDigest, trust)
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.blockName, err)
+		}
+		algorithm, err := hashForOID(s.p7.Signers[0].DigestAlgorithm.Algorithm)
+		if err != nil {
+			return fmt.Errorf("unsupported signer digest algorithm: %w", err)
+		}
+		var weak []WeakCryptoFinding
+		if algorithm == crypto.MD5 || algorithm == crypto.SHA1 {
+			weak = append(weak, WeakCryptoFinding{Kind: WeakFileDigest, Signature: i, Detail: algorithm.String()})
+		}
+		if s.weakDigest || weakEntries {
+			weak = append(weak, WeakCryptoFinding{Kind: WeakFileDigest, Signature: i, Detail: "SHA-1 manifest digests"})
+		}
+		weak = append(weak, weakCertificateFindings(s.p7.Certificates, i)...)
+		if err := verifyCertificateTrust(s.signer, s.p7.Certificates, weak, opts, trust, signingTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
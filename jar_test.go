@@ -0,0 +1,265 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"go.mozilla.org/pkcs7"
+)
+
+// jarDigestNamesForTest are the digest attribute prefixes jarsigner writes
+var jarDigestNamesForTest = map[crypto.Hash]string{crypto.SHA1: "SHA1", crypto.SHA256: "SHA-256"}
+
+// jarLineForTest returns the manifest line of an attribute, wrapped at 72
+// bytes with continuation lines as jarsigner writes it
+func jarLineForTest(name, value string) string {
+	line := name + ": " + value
+	var b strings.Builder
+	for len(line) > 72 {
+		b.WriteString(line[:72] + "\r\n ")
+		line = line[72:]
+	}
+	b.WriteString(line + "\r\n")
+	return b.String()
+}
+
+// jarDigestForTest returns the base64 h digest of data
+func jarDigestForTest(h crypto.Hash, data []byte) string {
+	d := h.New()
+	d.Write(data)
+	return base64.StdEncoding.EncodeToString(d.Sum(nil))
+}
+
+// jarSectionForTest returns the manifest section of the member m
+func jarSectionForTest(h crypto.Hash, m zipMemberForTest) string {
+	return jarLineForTest("Name", m.name) + jarLineForTest(jarDigestNamesForTest[h]+"-Digest", jarDigestForTest(h, m.data)) + "\r\n"
+}
+
+// jarMetaForTest returns the META-INF members of a JAR of members signed by
+// ids, as jarsigner writes them: the manifest with h digests first, then a
+// signature file and block per signer, CERT, CERT2 and so on. sfMain adds
+// attributes to the main section of the signature files.
+func jarMetaForTest(t *testing.T, members []zipMemberForTest, h crypto.Hash, sfMain string, ids ...*testIdentity) []zipMemberForTest {
+	t.Helper()
+	main := "Manifest-Version: 1.0\r\nCreated-By: 17.0.2 (Test)\r\n\r\n"
+	manifest := main
+	var sections []string
+	for _, m := range members {
+		sections = append(sections, jarSectionForTest(h, m))
+		manifest += sections[len(sections)-1]
+	}
+	meta := []zipMemberForTest{{jarManifestName, []byte(manifest)}}
+
+	prefix := jarDigestNamesForTest[h]
+	sf := "Signature-Version: 1.0\r\n" +
+		jarLineForTest(prefix+"-Digest-Manifest-Main-Attributes", jarDigestForTest(h, []byte(main))) +
+		jarLineForTest(prefix+"-Digest-Manifest", jarDigestForTest(h, []byte(manifest))) +
+		sfMain + "Created-By: 17.0.2 (Test)\r\n\r\n"
+	for i, m := range members {
+		sf += jarLineForTest("Name", m.name) + jarLineForTest(prefix+"-Digest", jarDigestForTest(h, []byte(sections[i]))) + "\r\n"
+	}
+	for i, id := range ids {
+		name := "CERT"
+		if i > 0 {
+			name = fmt.Sprintf("CERT%d", i+1)
+		}
+		meta = append(meta,
+			zipMemberForTest{"META-INF/" + name + ".SF", []byte(sf)},
+			zipMemberForTest{"META-INF/" + name + ".RSA", signDetachedForTest(t, id, []byte(sf))})
+	}
+	return meta
+}
+
+// jarMembersForTest returns the entries of a small library JAR, one with a
+// name long enough to need continuation lines in the manifest
+func jarMembersForTest() []zipMemberForTest {
+	return []zipMemberForTest{
+		{"com/example/Library.class", append([]byte{0xca, 0xfe, 0xba, 0xbe}, bytes.Repeat([]byte("class"), 64)...)},
+		{"com/example/internal/generated/VeryLongGeneratedClassNameForProtocolBuffers$Builder.class", []byte{0xca, 0xfe, 0xba, 0xbe, 0, 0, 0, 61}},
+		{"META-INF/services/com.example.Provider", []byte("com.example.Library\n")},
+	}
+}
+
+func TestVerify_JAR(t *testing.T) {
+	id := apkKeyForTest(t, "Example Library Signer", 9401)
+	members := jarMembersForTest()
+	meta := jarMetaForTest(t, members, crypto.SHA256, "", id)
+	filePath := writeScriptForTest(t, "library.jar", zipForTest(t, append(meta, members...)))
+
+	if fileType, err := DetectFileType(filePath); err != nil || fileType != FileTypeJAR {
+		t.Fatalf("Expected FileTypeJAR, got %q, %v", fileType, err)
+	}
+	block, err := ExtractDigitalSignature(filePath)
+	if err != nil {
+		t.Fatalf("Expected the signature block, got %v", err)
+	}
+	if _, err := pkcs7.Parse(block); err != nil {
+		t.Errorf("Expected a PKCS#7 signature block, got %v", err)
+	}
+	if info, err := Inspect(filePath); err != nil || info.Signer.SHA256Thumbprint != newCertificateInfo(id.Cert).SHA256Thumbprint {
+		t.Errorf("Expected Inspect to report the signer, got %+v, %v", info, err)
+	}
+	if err := Verify(filePath, nil); err != nil {
+		t.Fatalf("Expected a valid JAR signature, got %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{RequiredThumbprints: []string{newCertificateInfo(id.Cert).SHA256Thumbprint}, RejectWeakCrypto: true}); err != nil {
+		t.Errorf("Expected the pinned SHA-256 signer to verify, got %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{RequiredThumbprints: []string{strings.Repeat("00", 32)}}); !errors.Is(err, ErrSignerNotPinned) {
+		t.Errorf("Expected ErrSignerNotPinned for another thumbprint, got %v", err)
+	}
+	signers, err := InspectJARSignatures(filePath)
+	if err != nil || len(signers) != 1 || signers[0].Name != "CERT" || signers[0].Signer.CommonName != "Example Library Signer" || len(signers[0].Certificates) == 0 {
+		t.Errorf("Expected the CERT signer, got %+v, %v", signers, err)
+	}
+
+	// A modified class still listed with its original digest
+	tampered := append([]zipMemberForTest(nil), members...)
+	tampered[0] = zipMemberForTest{tampered[0].name, []byte("patched")}
+	tamperedPath := writeScriptForTest(t, "library.jar", zipForTest(t, append(meta, tampered...)))
+	var mismatch *DigestMismatchError
+	if err := Verify(tamperedPath, nil); !errors.As(err, &mismatch) {
+		t.Errorf("Expected a DigestMismatchError for a modified entry, got %v", err)
+	}
+	if err := Verify(tamperedPath, &VerifyOptions{SkipContentDigest: true}); err != nil {
+		t.Errorf("Expected SkipContentDigest to skip the entry digests, got %v", err)
+	}
+
+	// An entry added without a manifest section
+	added := append(append(meta, members...), zipMemberForTest{"com/example/Injected.class", []byte{0xca, 0xfe}})
+	if err := Verify(writeScriptForTest(t, "library.jar", zipForTest(t, added)), nil); !errors.Is(err, ErrUnsignedPart) {
+		t.Errorf("Expected ErrUnsignedPart for an unlisted entry, got %v", err)
+	}
+
+	// A signature file without the whole manifest digest signs its sections
+	sf := bytes.Replace(meta[1].data, []byte(jarLineForTest("SHA-256-Digest-Manifest", jarDigestForTest(crypto.SHA256, meta[0].data))), nil, 1)
+	sectioned := []zipMemberForTest{meta[0], {meta[1].name, sf}, {meta[2].name, signDetachedForTest(t, id, sf)}}
+	if err := Verify(writeScriptForTest(t, "library.jar", zipForTest(t, append(sectioned, members...))), nil); err != nil {
+		t.Errorf("Expected the signed sections to verify, got %v", err)
+	}
+
+	// An entry added to the manifest after signing: the whole manifest
+	// digest no longer matches and the signature file does not list it
+	injected := zipMemberForTest{"com/example/Injected.class", []byte{0xca, 0xfe}}
+	extended := append([]zipMemberForTest(nil), meta...)
+	extended[0] = zipMemberForTest{jarManifestName, append(append([]byte(nil), meta[0].data...), jarSectionForTest(crypto.SHA256, injected)...)}
+	if err := Verify(writeScriptForTest(t, "library.jar", zipForTest(t, append(extended, members...))), nil); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for a manifest entry missing from the archive, got %v", err)
+	}
+	if err := Verify(writeScriptForTest(t, "library.jar", zipForTest(t, append(append(extended, members...), injected))), nil); !errors.Is(err, ErrUnsignedPart) {
+		t.Errorf("Expected ErrUnsignedPart for an entry the signature file does not list, got %v", err)
+	}
+
+	// A manifest section changed after signing
+	forged := append([]zipMemberForTest(nil), meta...)
+	forged[0] = zipMemberForTest{jarManifestName, bytes.Replace(meta[0].data, []byte(jarDigestForTest(crypto.SHA256, members[0].data)), []byte(jarDigestForTest(crypto.SHA256, []byte("patched"))), 1)}
+	forged = append(forged, tampered...)
+	if err := Verify(writeScriptForTest(t, "library.jar", zipForTest(t, forged)), nil); !errors.As(err, &mismatch) {
+		t.Errorf("Expected a DigestMismatchError for a modified manifest section, got %v", err)
+	}
+
+	// A signature file changed after signing
+	resigned := append([]zipMemberForTest(nil), meta...)
+	resigned[1] = zipMemberForTest{resigned[1].name, append(append([]byte(nil), meta[1].data...), "Name: extra\r\nSHA-256-Digest: AAAA\r\n\r\n"...)}
+	if err := Verify(writeScriptForTest(t, "library.jar", zipForTest(t, append(resigned, members...))), nil); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for a modified signature file, got %v", err)
+	}
+
+	unsigned := writeScriptForTest(t, "library.jar", zipForTest(t, append(meta[:1], members...)))
+	if err := Verify(unsigned, nil); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned for an unsigned JAR, got %v", err)
+	}
+	if _, err := InspectJARSignatures(unsigned); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned inspecting an unsigned JAR, got %v", err)
+	}
+}
+
+func TestVerify_JARSigners(t *testing.T) {
+	first := apkKeyForTest(t, "First Signer", 9402)
+	second := apkKeyForTest(t, "Second Signer", 9403)
+	members := jarMembersForTest()
+	filePath := writeScriptForTest(t, "library.jar", zipForTest(t, append(jarMetaForTest(t, members, crypto.SHA256, "", first, second), members...)))
+	if err := Verify(filePath, nil); err != nil {
+		t.Fatalf("Expected both signatures to verify, got %v", err)
+	}
+	signers, err := InspectJARSignatures(filePath)
+	if err != nil || len(signers) != 2 || signers[1].Name != "CERT2" || signers[1].Signer.CommonName != "Second Signer" {
+		t.Errorf("Expected the CERT and CERT2 signers, got %+v, %v", signers, err)
+	}
+	if err := Verify(filePath, &VerifyOptions{RequiredThumbprints: []string{newCertificateInfo(first.Cert).SHA256Thumbprint}}); !errors.Is(err, ErrSignerNotPinned) {
+		t.Errorf("Expected every signer to be pinned, got %v", err)
+	}
+
+	weak := writeScriptForTest(t, "library.jar", zipForTest(t, append(jarMetaForTest(t, members, crypto.SHA1, "", first), members...)))
+	if err := Verify(weak, nil); err != nil {
+		t.Errorf("Expected SHA-1 manifest digests to verify, got %v", err)
+	}
+	if err := Verify(weak, &VerifyOptions{RejectWeakCrypto: true}); !errors.Is(err, ErrWeakCrypto) {
+		t.Errorf("Expected ErrWeakCrypto for SHA-1 manifest digests, got %v", err)
+	}
+}
+
+func TestVerify_APKJARSignature(t *testing.T) {
+	id := apkKeyForTest(t, "Android Legacy", 9404)
+	members := apkMembersForTest()
+	filePath := writeScriptForTest(t, "app.apk", zipForTest(t, append(jarMetaForTest(t, members, crypto.SHA256, "", id), members...)))
+	if fileType, err := DetectFileType(filePath); err != nil || fileType != FileTypeAPK {
+		t.Fatalf("Expected FileTypeAPK, got %q, %v", fileType, err)
+	}
+	if block, err := ExtractDigitalSignature(filePath); err != nil || isAPKSigningBlock(block) {
+		t.Errorf("Expected the JAR signature block of a v1 APK, got %v", err)
+	}
+	if err := Verify(filePath, nil); err != nil {
+		t.Errorf("Expected the JAR signature of the APK to verify, got %v", err)
+	}
+	if signers, err := InspectJARSignatures(filePath); err != nil || len(signers) != 1 || signers[0].APKSchemes != nil {
+		t.Errorf("Expected one v1 signer, got %+v, %v", signers, err)
+	}
+
+	// The v2 block of an APK whose signature file names it was stripped
+	stripped := writeScriptForTest(t, "app.apk", zipForTest(t, append(jarMetaForTest(t, members, crypto.SHA256, "X-Android-APK-Signed: 2\r\n", id), members...)))
+	if err := Verify(stripped, nil); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for a stripped v2 signature, got %v", err)
+	}
+	if signers, err := InspectJARSignatures(stripped); err != nil || len(signers) != 1 || len(signers[0].APKSchemes) != 1 || signers[0].APKSchemes[0] != 2 {
+		t.Errorf("Expected the signer to declare v2, got %+v, %v", signers, err)
+	}
+}
+
+func TestParseJARManifest(t *testing.T) {
+	data := []byte("Manifest-Version: 1.0\n\nName: a/very/long/na\n me.class\r\nSHA-256-Digest: AAAA\r\n\r\n\r\nName: b\rSHA1-Digest: BBBB")
+	sections, err := parseJARManifest(data)
+	if err != nil || len(sections) != 3 {
+		t.Fatalf("Expected three sections, got %+v, %v", sections, err)
+	}
+	if name, _ := sections[1].get("name"); name != "a/very/long/name.class" {
+		t.Errorf("Expected the continued name, got %q", name)
+	}
+	if string(sections[0].raw) != "Manifest-Version: 1.0\n\n" || string(sections[1].raw) != "Name: a/very/long/na\n me.class\r\nSHA-256-Digest: AAAA\r\n\r\n" {
+		t.Errorf("Expected the raw sections with their blank lines, got %q and %q", sections[0].raw, sections[1].raw)
+	}
+	if digests, err := sections[2].digests("-Digest"); err != nil || len(digests) != 1 || digests[0].algorithm != crypto.SHA1 {
+		t.Errorf("Expected a SHA-1 digest, got %+v, %v", digests, err)
+	}
+	if sections, err := parseJARManifest([]byte("\r\nName: a\r\n")); err != nil || len(sections) != 2 || len(sections[0].attributes) != 0 {
+		t.Errorf("Expected an empty main section, got %+v, %v", sections, err)
+	}
+
+	for name, data := range map[string]string{
+		"continuation first": " continued\r\n",
+		"no separator":       "Manifest-Version 1.0\r\n",
+		"empty name":         ": value\r\n",
+	} {
+		if _, err := parseJARManifest([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := (&jarSection{attributes: []jarAttribute{{"SHA-256-Digest", "not base64!"}}}).digests("-Digest"); err == nil {
+		t.Error("Expected an error for a malformed digest")
+	}
+}
@@ -0,0 +1,281 @@
+package sigtool
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"strings"
+)
+
+// Kernel-mode driver signing extended key usages
+var (
+	oidEKUWHQL             = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 10, 3, 5}
+	oidEKUAttestation      = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 10, 3, 5, 1}
+	oidEKUSystemComponent  = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 10, 3, 6}
+	codeVerificationRootCN = "Microsoft Code Verification Root"
+)
+
+// KernelSignatureKind is the kind of kernel-mode signature of a driver.
+type KernelSignatureKind string
+
+const (
+	// KernelSignatureWHQL is a Windows Hardware Quality Labs signature
+	KernelSignatureWHQL KernelSignatureKind = "whql"
+	// KernelSignatureAttestation is a Hardware Dev Center attestation
+	// signature
+	KernelSignatureAttestation KernelSignatureKind = "attestation"
+	// KernelSignatureSystemComponent is a Windows inbox component signature
+	KernelSignatureSystemComponent KernelSignatureKind = "system-component"
+	// KernelSignatureCrossSigned is a legacy vendor signature chaining to
+	// the Microsoft Code Verification Root through a cross-certificate
+	KernelSignatureCrossSigned KernelSignatureKind = "cross-signed"
+	// KernelSignatureNone is a signature acceptable for user mode only
+	KernelSignatureNone KernelSignatureKind = "none"
+)
+
+// Kernel-mode policy requirement IDs reported in KernelPolicyCheck
+const (
+	// KernelCheckSignature requires the kernel-mode signature to verify
+	KernelCheckSignature = "signature"
+	// KernelCheckDigest requires a SHA-256 or stronger file digest
+	KernelCheckDigest = "sha256-digest"
+	// KernelCheckMicrosoftSignature requires a signature from the Windows
+	// Hardware Dev Center (WHQL or attestation)
+	KernelCheckMicrosoftSignature = "microsoft-signature"
+	// KernelCheckEKU requires the signer to carry a kernel-mode EKU
+	KernelCheckEKU = "kernel-eku"
+	// KernelCheckCrossCertificate reports whether a vendor signature chains
+	// to the Microsoft Code Verification Root
+	KernelCheckCrossCertificate = "cross-certificate"
+)
+
+// KernelPolicyCheck is the outcome of one kernel-mode policy requirement.
+type KernelPolicyCheck struct {
+	// Requirement is one of the KernelCheck constants
+	Requirement string
+	// Passed reports whether the requirement is met
+	Passed bool
+	// Detail explains the outcome
+	Detail string
+}
+
+// KernelPolicyReport describes whether a driver meets the kernel-mode code
+// signing policy of current Windows releases.
+type KernelPolicyReport struct {
+	// Kind is the strongest kernel-mode signature found
+	Kind KernelSignatureKind
+	// Checks holds the outcome of every requirement
+	Checks []KernelPolicyCheck
+}
+
+// Compliant reports whether every requirement other than the legacy
+// cross-certificate check is met.
+func (r *KernelPolicyReport) Compliant() bool {
+	for _, c := range r.Checks {
+		if !c.Passed && c.Requirement != KernelCheckCrossCertificate {
+			return false
+		}
+	}
+	return true
+}
+
+// Failed returns the requirements that are not met.
+func (r *KernelPolicyReport) Failed() []KernelPolicyCheck {
+	var failed []KernelPolicyCheck
+	for _, c := range r.Checks {
+		if !c.Passed {
+			failed = append(failed, c)
+		}
+	}
+	return failed
+}
+
+// CheckKernelPolicy evaluates a driver against the Windows kernel-mode code
+// signing policy.
+//
+// Since Windows 10 version 1607, new kernel-mode drivers load with Secure
+// Boot on only when signed by the Windows Hardware Dev Center, through WHQL
+// or attestation. The primary and nested signatures are searched for a
+// signer carrying a kernel-mode EKU (1.3.6.1.4.1.311.10.3.5, .5.1 or .6)
+// issued by a Microsoft Windows CA, which must verify under opts and use
+// SHA-256 or stronger. Signers are identified by name, so pass
+// UseMicrosoftRoots or the Microsoft roots in opts to establish trust.
+//
+// Legacy cross-signed drivers are reported with the cross-certificate check
+// and KernelSignatureCrossSigned; they do not satisfy the current policy.
+// The cross-certificates are taken from the signature and
+// opts.CrossCertificates.
+//
+// Parameters:
+//   - filePath: The path to the driver
+//   - opts: Verification options applied to every signature
+//
+// Returns:
+//   - *KernelPolicyReport: The outcome of every requirement
+//   - error: An error if the signatures cannot be extracted or parsed
+//
+// Example usage:
+//
+//	report, err := sigtool.CheckKernelPolicy("driver.sys", sigtool.VerifyOptions{UseMicrosoftRoots: true})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	for _, c := range report.Failed() {
+//	    fmt.Printf("%s: %s\n", c.Requirement, c.Detail)
+//	}
+func CheckKernelPolicy(filePath string, opts VerifyOptions) (*KernelPolicyReport, error) {
+	sigs, err := EnumerateSignatures(filePath, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &KernelPolicyReport{Kind: KernelSignatureNone}
+	// The kernel-mode signature is the Microsoft one when present and the
+	// primary signature otherwise
+	chosen := &sigs[0]
+	for i := range sigs {
+		if sigs[i].Signer == nil {
+			continue
+		}
+		if kind := kernelSignatureKind(sigs[i].Signer.Certificate); kind != KernelSignatureNone {
+			report.Kind, chosen = kind, &sigs[i]
+			break
+		}
+	}
+	add := func(requirement string, passed bool, format string, args ...interface{}) {
+		report.Checks = append(report.Checks, KernelPolicyCheck{Requirement: requirement, Passed: passed, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	if chosen.Err != nil {
+		add(KernelCheckSignature, false, "%v", chosen.Err)
+	} else {
+		add(KernelCheckSignature, true, "%s signature verifies", describeSigner(chosen.Signer))
+	}
+
+	strong := false
+	for _, sig := range sigs {
+		if sig.Err == nil && isStrongDigest(sig.DigestAlgorithm) {
+			strong = true
+		}
+	}
+	if strong {
+		add(KernelCheckDigest, true, "a valid signature uses SHA-256 or stronger")
+	} else {
+		add(KernelCheckDigest, false, "no valid signature uses SHA-256 or stronger")
+	}
+
+	var signer *x509.Certificate
+	if chosen.Signer != nil {
+		signer = chosen.Signer.Certificate
+	}
+	eku := signer != nil && kernelEKU(signer) != nil
+	if eku {
+		add(KernelCheckEKU, true, "signer carries kernel-mode EKU %s", kernelEKU(signer))
+	} else {
+		add(KernelCheckEKU, false, "no signer carries the WHQL, attestation or system component EKU")
+	}
+
+	switch report.Kind {
+	case KernelSignatureNone:
+		add(KernelCheckMicrosoftSignature, false, "no signature from the Windows Hardware Dev Center")
+	default:
+		add(KernelCheckMicrosoftSignature, true, "%s signature by %s", report.Kind, describeSigner(chosen.Signer))
+	}
+
+	if report.Kind != KernelSignatureNone {
+		add(KernelCheckCrossCertificate, true, "not required for a Microsoft signature")
+	} else if signer != nil && chosen.Err == nil && chainsToCodeVerificationRoot(chosen, signer, opts.CrossCertificates) {
+		report.Kind = KernelSignatureCrossSigned
+		add(KernelCheckCrossCertificate, true, "chains to the %s; cross-signed drivers only load without Secure Boot or when signed before July 29, 2015", codeVerificationRootCN)
+	} else {
+		add(KernelCheckCrossCertificate, false, "no chain to the %s", codeVerificationRootCN)
+	}
+
+	return report, nil
+}
+
+// kernelSignatureKind classifies the signer certificate of a signature
+func kernelSignatureKind(signer *x509.Certificate) KernelSignatureKind {
+	if !strings.HasPrefix(signer.Issuer.CommonName, "Microsoft Windows") || !containsString(signer.Issuer.Organization, "Microsoft Corporation") {
+		return KernelSignatureNone
+	}
+	switch eku := kernelEKU(signer); {
+	case eku.Equal(oidEKUAttestation):
+		return KernelSignatureAttestation
+	case eku.Equal(oidEKUWHQL):
+		return KernelSignatureWHQL
+	case eku.Equal(oidEKUSystemComponent):
+		return KernelSignatureSystemComponent
+	}
+	return KernelSignatureNone
+}
+
+// kernelEKU returns the kernel-mode EKU of cert, preferring attestation, or
+// nil
+func kernelEKU(cert *x509.Certificate) asn1.ObjectIdentifier {
+	var found asn1.ObjectIdentifier
+	for _, oid := range cert.UnknownExtKeyUsage {
+		switch {
+		case oid.Equal(oidEKUAttestation):
+			return oid
+		case oid.Equal(oidEKUWHQL), oid.Equal(oidEKUSystemComponent):
+			found = oid
+		}
+	}
+	return found
+}
+
+// chainsToCodeVerificationRoot reports whether signer chains through the
+// certificates of sig and cross to a certificate issued by the Microsoft
+// Code Verification Root
+func chainsToCodeVerificationRoot(sig *EmbeddedSignature, signer *x509.Certificate, cross []*x509.Certificate) bool {
+	p7, err := parsePKCS7(sig.RawSignature)
+	if err != nil {
+		return false
+	}
+	candidates := append(append([]*x509.Certificate(nil), p7.Certificates...), cross...)
+	anchors := x509.NewCertPool()
+	found := false
+	for _, cert := range candidates {
+		if cert.Issuer.CommonName == codeVerificationRootCN {
+			anchors.AddCert(cert)
+			found = true
+		}
+	}
+	if !found {
+		return false
+	}
+	// Cross-certificates expired in 2021, so the chain is checked when the
+	// signer certificate became valid
+	_, err = signer.Verify(x509.VerifyOptions{
+		Roots:         anchors,
+		Intermediates: certificatePool(candidates),
+		CurrentTime:   signer.NotBefore,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return err == nil
+}
+
+// isStrongDigest reports whether h is SHA-256 or stronger
+func isStrongDigest(h crypto.Hash) bool {
+	return h == crypto.SHA256 || h == crypto.SHA384 || h == crypto.SHA512
+}
+
+// describeSigner returns the subject of signer or a placeholder
+func describeSigner(signer *CertificateInfo) string {
+	if signer == nil {
+		return "unknown signer"
+	}
+	return fmt.Sprintf("%q", signer.Subject)
+}
+
+// containsString reports whether values contains s
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
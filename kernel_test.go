@@ -0,0 +1,130 @@
+package sigtool
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+)
+
+// kernelSignerForTest issues a signer named like a Hardware Dev Center
+// certificate carrying eku
+func kernelSignerForTest(t *testing.T, eku asn1.ObjectIdentifier) *testIdentity {
+	t.Helper()
+	caTemplate := testCATemplate("Microsoft Windows Third Party Component CA 2014", 1)
+	caTemplate.Subject.Organization = []string{"Microsoft Corporation"}
+	ca := issueCertificateForTest(t, caTemplate, nil)
+
+	leaf := testLeafTemplate("Microsoft Windows Hardware Compatibility Publisher", 2, x509.ExtKeyUsageCodeSigning)
+	leaf.Subject.Organization = []string{"Microsoft Corporation"}
+	leaf.UnknownExtKeyUsage = []asn1.ObjectIdentifier{eku}
+	return issueCertificateForTest(t, leaf, ca)
+}
+
+func failedRequirements(report *KernelPolicyReport) map[string]bool {
+	failed := make(map[string]bool)
+	for _, c := range report.Failed() {
+		failed[c.Requirement] = true
+	}
+	return failed
+}
+
+func TestCheckKernelPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		eku       asn1.ObjectIdentifier
+		hash      crypto.Hash
+		kind      KernelSignatureKind
+		compliant bool
+		failed    []string
+	}{
+		{name: "WHQL", eku: oidEKUWHQL, hash: crypto.SHA256, kind: KernelSignatureWHQL, compliant: true},
+		{name: "attestation", eku: oidEKUAttestation, hash: crypto.SHA256, kind: KernelSignatureAttestation, compliant: true},
+		{name: "SHA-1 WHQL", eku: oidEKUWHQL, hash: crypto.SHA1, kind: KernelSignatureWHQL, failed: []string{KernelCheckDigest}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := createSignedMockPEAs(t, kernelSignerForTest(t, tt.eku), tt.hash)
+			report, err := CheckKernelPolicy(filePath, VerifyOptions{})
+			if err != nil {
+				t.Fatalf("CheckKernelPolicy failed: %v", err)
+			}
+			if report.Kind != tt.kind {
+				t.Errorf("Kind = %q, want %q", report.Kind, tt.kind)
+			}
+			if report.Compliant() != tt.compliant {
+				t.Errorf("Compliant() = %v, want %v (failed: %+v)", report.Compliant(), tt.compliant, report.Failed())
+			}
+			failed := failedRequirements(report)
+			if len(failed) != len(tt.failed) {
+				t.Errorf("Failed() = %+v, want %v", report.Failed(), tt.failed)
+			}
+			for _, id := range tt.failed {
+				if !failed[id] {
+					t.Errorf("expected requirement %q to fail", id)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckKernelPolicy_VendorSignature(t *testing.T) {
+	ca := issueCertificateForTest(t, testCATemplate("Vendor CA", 1), nil)
+	leaf := testLeafTemplate("Vendor Driver", 2, x509.ExtKeyUsageCodeSigning)
+	// A kernel-mode EKU outside a Microsoft CA is not a WHQL signature
+	leaf.UnknownExtKeyUsage = []asn1.ObjectIdentifier{oidEKUWHQL}
+	filePath := createSignedMockPEAs(t, issueCertificateForTest(t, leaf, ca), crypto.SHA256)
+
+	report, err := CheckKernelPolicy(filePath, VerifyOptions{})
+	if err != nil {
+		t.Fatalf("CheckKernelPolicy failed: %v", err)
+	}
+	if report.Kind != KernelSignatureNone || report.Compliant() {
+		t.Fatalf("expected a non-compliant vendor signature, got %q compliant=%v", report.Kind, report.Compliant())
+	}
+	failed := failedRequirements(report)
+	for _, id := range []string{KernelCheckMicrosoftSignature, KernelCheckCrossCertificate} {
+		if !failed[id] {
+			t.Errorf("expected requirement %q to fail", id)
+		}
+	}
+	if failed[KernelCheckSignature] || failed[KernelCheckDigest] {
+		t.Errorf("unexpected failures: %+v", report.Failed())
+	}
+}
+
+func TestCheckKernelPolicy_CrossSigned(t *testing.T) {
+	rootTemplate := testCATemplate(codeVerificationRootCN, 1)
+	rootTemplate.Subject = pkix.Name{CommonName: codeVerificationRootCN, Organization: []string{"Microsoft Corporation"}}
+	root := issueCertificateForTest(t, rootTemplate, nil)
+	// The vendor CA issued by the Code Verification Root plays the
+	// cross-certificate
+	cross := issueCertificateForTest(t, testCATemplate("Vendor CA", 2), root)
+	signer := issueCertificateForTest(t, testLeafTemplate("Vendor Driver", 3, x509.ExtKeyUsageCodeSigning), cross)
+	signer.Chain = nil
+	filePath := createSignedMockPEAs(t, signer, crypto.SHA256)
+
+	report, err := CheckKernelPolicy(filePath, VerifyOptions{})
+	if err != nil {
+		t.Fatalf("CheckKernelPolicy failed: %v", err)
+	}
+	if report.Kind != KernelSignatureNone || !failedRequirements(report)[KernelCheckCrossCertificate] {
+		t.Errorf("expected no cross-certificate chain without the cross-certificate, got %q", report.Kind)
+	}
+
+	report, err = CheckKernelPolicy(filePath, VerifyOptions{CrossCertificates: []*x509.Certificate{cross.Cert}})
+	if err != nil {
+		t.Fatalf("CheckKernelPolicy failed: %v", err)
+	}
+	if report.Kind != KernelSignatureCrossSigned {
+		t.Errorf("Kind = %q, want %q", report.Kind, KernelSignatureCrossSigned)
+	}
+	failed := failedRequirements(report)
+	if failed[KernelCheckCrossCertificate] {
+		t.Errorf("expected the cross-certificate requirement to pass: %+v", report.Failed())
+	}
+	if !failed[KernelCheckMicrosoftSignature] || report.Compliant() {
+		t.Errorf("cross-signed drivers must not satisfy the current policy: %+v", report.Failed())
+	}
+}
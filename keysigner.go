@@ -0,0 +1,108 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"io"
+)
+
+// Signer is a signing backend for Authenticode. It couples a crypto.Signer,
+// which signs digests with a private key that may never leave its device,
+// with the certificates identifying that key.
+//
+// Software keys are wrapped with NewSigner; TPM, smart card, HSM and cloud
+// KMS backends implement Signer directly so that SignPEWith can drive them
+// without knowing where the key lives. Sign is called once per signature
+// with a digest of the authenticated attributes and the crypto.Hash of the
+// SignOptions as opts, as for a regular crypto.Signer.
+type Signer interface {
+	crypto.Signer
+	// Certificates returns the signer certificate, which must match
+	// Public, followed by any intermediate certificates to embed in the
+	// signature
+	Certificates() ([]*x509.Certificate, error)
+}
+
+// keySigner is a Signer backed by a crypto.Signer and fixed certificates
+type keySigner struct {
+	key   crypto.Signer
+	certs []*x509.Certificate
+}
+
+// NewSigner returns a Signer that signs with key and presents cert followed
+// by chain.
+//
+// Parameters:
+//   - key: The private key, such as an *rsa.PrivateKey or *ecdsa.PrivateKey
+//   - cert: The signer certificate matching key
+//   - chain: Intermediate certificates to embed in signatures
+//
+// Returns:
+//   - Signer: A signer for SignPEWith
+//
+// Example usage:
+//
+//	signer := sigtool.NewSigner(key, cert, issuingCA)
+//	if err := sigtool.SignPEWith("app.exe", signer, nil); err != nil {
+//	    log.Fatal(err)
+//	}
+func NewSigner(key crypto.Signer, cert *x509.Certificate, chain ...*x509.Certificate) Signer {
+	return &keySigner{key: key, certs: append([]*x509.Certificate{cert}, chain...)}
+}
+
+// Public returns the public key of the wrapped key
+func (s *keySigner) Public() crypto.PublicKey {
+	return s.key.Public()
+}
+
+// Sign signs digest with the wrapped key
+func (s *keySigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.key.Sign(rand, digest, opts)
+}
+
+// Certificates returns the signer certificate and chain
+func (s *keySigner) Certificates() ([]*x509.Certificate, error) {
+	return s.certs, nil
+}
+
+// SignPEWith signs a PE file with Authenticode using a signing backend,
+// replacing any existing signature. It behaves like SignPE, with the key
+// and certificates supplied by signer.
+//
+// Parameters:
+//   - filePath: The path to the PE file to sign
+//   - signer: The signing backend
+//   - opts: Signing options, or nil for the defaults
+//
+// Returns:
+//   - error: An error if the signer fails, or the file cannot be parsed,
+//     signed or written
+//
+// Example usage:
+//
+//	var signer sigtool.Signer = hsm.NewSigner(slot, "code-signing")
+//	if err := sigtool.SignPEWith("app.exe", signer, nil); err != nil {
+//	    log.Fatal(err)
+//	}
+func SignPEWith(filePath string, signer Signer, opts *SignOptions) error {
+	if signer == nil {
+		return errors.New("a signer is required")
+	}
+	if opts == nil {
+		opts = &SignOptions{}
+	}
+	h := opts.Hash
+	if h == 0 {
+		h = crypto.SHA256
+	}
+
+	return rewriteCertificateTable(filePath, func(image []byte, layout *peLayout) ([]byte, error) {
+		digest, err := authentihash(bytes.NewReader(image), layout, h)
+		if err != nil {
+			return nil, err
+		}
+		return signAuthenticode(digest, h, signer, opts)
+	})
+}
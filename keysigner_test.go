@@ -0,0 +1,77 @@
+package sigtool
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// countingSigner is a Signer backend that records its use, standing in for
+// a hardware or remote key
+type countingSigner struct {
+	key   crypto.Signer
+	certs []*x509.Certificate
+	err   error
+	signs int
+}
+
+func (s *countingSigner) Public() crypto.PublicKey { return s.key.Public() }
+
+func (s *countingSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s.signs++
+	return s.key.Sign(rand, digest, opts)
+}
+
+func (s *countingSigner) Certificates() ([]*x509.Certificate, error) { return s.certs, s.err }
+
+func TestSignPEWith(t *testing.T) {
+	root := issueCertificateForTest(t, testCATemplate("backend root", 1), nil)
+	intermediate := issueCertificateForTest(t, testCATemplate("backend intermediate", 2), root)
+	leaf := issueCertificateForTest(t, testLeafTemplate("backend signer", 3, x509.ExtKeyUsageCodeSigning), intermediate)
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Cert)
+
+	backend := &countingSigner{key: leaf.Key, certs: append([]*x509.Certificate{leaf.Cert}, leaf.Chain...)}
+	filePath := writeUnsignedPEForTest(t, []byte("backend payload"))
+	if err := SignPEWith(filePath, backend, nil); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if backend.signs != 1 {
+		t.Errorf("Expected the backend to sign once, got %d", backend.signs)
+	}
+	if err := Verify(filePath, &VerifyOptions{Roots: roots}); err != nil {
+		t.Errorf("Expected the embedded chain to verify, got: %v", err)
+	}
+
+	// Intermediates from the options are not embedded twice
+	filePath = writeUnsignedPEForTest(t, []byte("backend payload"))
+	if err := SignPEWith(filePath, NewSigner(leaf.Key, leaf.Cert, leaf.Chain...), &SignOptions{Intermediates: leaf.Chain}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	certs, err := ExportCertificates(filePath, FormatDER)
+	if err != nil || len(certs) != 2 {
+		t.Errorf("Expected signer and intermediate certificates, got %d (%v)", len(certs), err)
+	}
+}
+
+func TestSignPEWith_SignerErrors(t *testing.T) {
+	id := issueCertificateForTest(t, testLeafTemplate("backend signer", 1, x509.ExtKeyUsageCodeSigning), nil)
+	filePath := writeUnsignedPEForTest(t, []byte("payload"))
+
+	unavailable := errors.New("token removed")
+	if err := SignPEWith(filePath, &countingSigner{key: id.Key, err: unavailable}, nil); !errors.Is(err, unavailable) {
+		t.Errorf("Expected the backend error, got: %v", err)
+	}
+	if err := SignPEWith(filePath, &countingSigner{key: id.Key}, nil); err == nil || !strings.Contains(err.Error(), "no certificate") {
+		t.Errorf("Expected missing certificate error, got: %v", err)
+	}
+	if err := SignPEWith(filePath, nil, nil); err == nil {
+		t.Error("Expected error for a nil signer, got nil")
+	}
+	if err := SignPE(filePath, nil, id.Key, nil); err == nil {
+		t.Error("Expected error for a nil certificate, got nil")
+	}
+}
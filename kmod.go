@@ -0,0 +1,151 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+)
+
+// Signed Linux kernel modules end with the PKCS#7 signature, a
+// module_signature structure giving its length and this marker
+const (
+	kmodSignatureMagic = "~Module signature appended~\n"
+	// kmodSignatureInfoSize is the size of struct module_signature
+	kmodSignatureInfoSize = 12
+	// kmodIDPKCS7 is the id_type of PKCS#7 module signatures; the older
+	// X.509 key identifier form is no longer produced or accepted
+	kmodIDPKCS7 = 2
+)
+
+// isKernelModule reports whether r is an ELF object ending with the module
+// signature marker
+func isKernelModule(r io.ReaderAt, size int64) bool {
+	if size < int64(len(elf.ELFMAG)+len(kmodSignatureMagic)) {
+		return false
+	}
+	ident := make([]byte, len(elf.ELFMAG))
+	if _, err := r.ReadAt(ident, 0); err != nil || string(ident) != elf.ELFMAG {
+		return false
+	}
+	magic := make([]byte, len(kmodSignatureMagic))
+	if _, err := r.ReadAt(magic, size-int64(len(magic))); err != nil {
+		return false
+	}
+	return string(magic) == kmodSignatureMagic
+}
+
+// readKernelModuleSignature returns the PKCS#7 signature of the kernel
+// module r and the length of the module it signs
+func readKernelModuleSignature(r io.ReaderAt, size int64) ([]byte, int64, error) {
+	trailer := int64(kmodSignatureInfoSize + len(kmodSignatureMagic))
+	if size < trailer {
+		return nil, 0, fmt.Errorf("%w (module has no signature)", ErrNotSigned)
+	}
+	info := make([]byte, kmodSignatureInfoSize)
+	if _, err := r.ReadAt(info, size-trailer); err != nil {
+		return nil, 0, fmt.Errorf("failed to read module signature: %w", err)
+	}
+	if info[2] != kmodIDPKCS7 {
+		return nil, 0, fmt.Errorf("unsupported module signature type %d", info[2])
+	}
+	if !bytes.Equal(info[:2], []byte{0, 0}) || !bytes.Equal(info[3:8], make([]byte, 5)) {
+		return nil, 0, errors.New("malformed PKCS#7 module signature information")
+	}
+	length := int64(binary.BigEndian.Uint32(info[8:]))
+	if length > MaxSignatureSize {
+		return nil, 0, &SignatureSizeError{Size: length, Limit: MaxSignatureSize}
+	}
+	if length == 0 || length > size-trailer {
+		return nil, 0, &SignatureBoundsError{
+			Offset: size - trailer - length, Length: length, FileSize: size,
+			Reason: "module signature exceeds the file",
+		}
+	}
+	moduleSize := size - trailer - length
+	signature := make([]byte, length)
+	if _, err := r.ReadAt(signature, moduleSize); err != nil {
+		return nil, 0, fmt.Errorf("failed to read module signature: %w", err)
+	}
+	return signature, moduleSize, nil
+}
+
+// readKernelModulePKCS7 returns the PKCS#7 signature of the kernel module r
+func readKernelModulePKCS7(r io.ReaderAt, size int64) ([]byte, error) {
+	signature, _, err := readKernelModuleSignature(r, size)
+	return signature, err
+}
+
+// verifyKernelModule verifies the appended signature of the kernel module
+// r as the kernel does: the detached PKCS#7 signature must be over the
+// module by one of opts.ModuleSigningCertificates, or by a certificate it
+// embeds when none is given. The signer is then checked per opts.
+func verifyKernelModule(r io.ReaderAt, size int64, opts VerifyOptions) error {
+	signature, moduleSize, err := readKernelModuleSignature(r, size)
+	if err != nil {
+		return fmt.Errorf("failed to extract signature: %w", err)
+	}
+	opts.logger().Debug("read module signature", "fileSize", size, "moduleSize", moduleSize, "size", len(signature))
+	p7, err := parsePKCS7(signature)
+	if err != nil {
+		return fmt.Errorf("failed to parse PKCS#7 signature: %w", err)
+	}
+	if len(p7.Signers) != 1 {
+		return fmt.Errorf("%w: module signature has %d signers", ErrInvalidSignature, len(p7.Signers))
+	}
+	ias := p7.Signers[0].IssuerAndSerialNumber
+	signer := moduleSigner(opts.ModuleSigningCertificates, ias.IssuerName.FullBytes, ias.SerialNumber)
+	switch {
+	case signer == nil && len(opts.ModuleSigningCertificates) > 0:
+		return fmt.Errorf("%w: module is signed by serial %x, which is none of the module signing certificates", ErrSignerCertificateNotFound, ias.SerialNumber)
+	case signer == nil:
+		if signer = moduleSigner(p7.Certificates, ias.IssuerName.FullBytes, ias.SerialNumber); signer == nil {
+			return fmt.Errorf("%w: module signatures do not embed the kernel signing certificate; supply it in ModuleSigningCertificates", ErrSignerCertificateNotFound)
+		}
+	default:
+		p7.Certificates = append(p7.Certificates, signer)
+	}
+
+	content := make([]byte, moduleSize)
+	if _, err := r.ReadAt(content, 0); err != nil {
+		return fmt.Errorf("failed to read module: %w", err)
+	}
+	// The signature is detached from the module and, as sign-file writes
+	// it, has no signed attributes
+	p7.Content = content
+	if err := p7.Verify(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+
+	algorithm, err := hashForOID(p7.Signers[0].DigestAlgorithm.Algorithm)
+	if err != nil {
+		return fmt.Errorf("unsupported signer digest algorithm: %w", err)
+	}
+	var weak []WeakCryptoFinding
+	if algorithm == crypto.MD5 || algorithm == crypto.SHA1 {
+		weak = append(weak, WeakCryptoFinding{Kind: WeakFileDigest, Detail: algorithm.String()})
+	}
+	weak = append(weak, weakCertificateFindings(p7.Certificates, 0)...)
+	trust, err := resolveTrust(opts)
+	if err != nil {
+		return err
+	}
+	return verifyCertificateTrust(signer, p7.Certificates, weak, opts, trust, time.Time{})
+}
+
+// moduleSigner returns the certificate of certs with the given issuer and
+// serial number
+func moduleSigner(certs []*x509.Certificate, issuer []byte, serial *big.Int) *x509.Certificate {
+	for _, cert := range certs {
+		if bytes.Equal(cert.RawIssuer, issuer) && cert.SerialNumber.Cmp(serial) == 0 {
+			return cert
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package sigtool
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// kernelModuleForTest returns module with a signature appended by id as
+// sign-file writes it: a detached PKCS#7 signature with h, without signed
+// attributes and, unless embed is set, without certificates
+func kernelModuleForTest(t testing.TB, id *testIdentity, module []byte, h crypto.Hash, embed bool) []byte {
+	t.Helper()
+	digestOID := map[crypto.Hash]asn1.ObjectIdentifier{crypto.SHA1: oidDigestSHA1, crypto.SHA256: oidDigestSHA256}[h]
+	algID := pkix.AlgorithmIdentifier{Algorithm: digestOID, Parameters: asn1.NullRawValue}
+	d := h.New()
+	d.Write(module)
+	signature, err := id.Key.Sign(rand.Reader, d.Sum(nil), h)
+	if err != nil {
+		t.Fatalf("Failed to sign module: %v", err)
+	}
+	sd := testSignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{algID},
+		ContentInfo:      testContentInfo{ContentType: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}},
+		SignerInfos: []testSignerInfo{{
+			Version: 1,
+			IssuerAndSerialNumber: testIssuerAndSerial{
+				IssuerName:   asn1.RawValue{FullBytes: id.Cert.RawIssuer},
+				SerialNumber: new(big.Int).Set(id.Cert.SerialNumber),
+			},
+			DigestAlgorithm: algID,
+			DigestEncryptionAlgorithm: pkix.AlgorithmIdentifier{
+				Algorithm:  asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1},
+				Parameters: asn1.NullRawValue,
+			},
+			EncryptedDigest: signature,
+		}},
+	}
+	if embed {
+		sd.Certificates = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: id.Cert.Raw}
+	}
+	inner, err := asn1.Marshal(sd)
+	if err != nil {
+		t.Fatalf("Failed to marshal SignedData: %v", err)
+	}
+	p7, err := asn1.Marshal(testContentInfo{
+		ContentType: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2},
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: inner},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal ContentInfo: %v", err)
+	}
+
+	signed := append(append([]byte(nil), module...), p7...)
+	signed = append(signed, 0, 0, kmodIDPKCS7, 0, 0, 0, 0, 0)
+	signed = binary.BigEndian.AppendUint32(signed, uint32(len(p7)))
+	return append(signed, kmodSignatureMagic...)
+}
+
+// kernelKeyForTest returns a self-signed module signing key, as the kernel
+// build generates
+func kernelKeyForTest(t testing.TB, cn string, serial int64) *testIdentity {
+	t.Helper()
+	template := testCATemplate(cn, serial)
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}
+	return issueCertificateForTest(t, template, nil)
+}
+
+func TestVerify_KernelModule(t *testing.T) {
+	key := kernelKeyForTest(t, "Build time autogenerated kernel key", 9101)
+	module := append([]byte("\x7fELF\x02\x01\x01"), make([]byte, 4096)...)
+	filePath := writeScriptForTest(t, "module.ko", kernelModuleForTest(t, key, module, crypto.SHA256, false))
+	if fileType, err := DetectFileType(filePath); err != nil || fileType != FileTypeKernelModule {
+		t.Fatalf("Expected FileTypeKernelModule, got %q, %v", fileType, err)
+	}
+	if signature, err := ExtractDigitalSignature(filePath); err != nil || len(signature) == 0 {
+		t.Fatalf("Expected the module signature, got %v", err)
+	}
+
+	opts := &VerifyOptions{ModuleSigningCertificates: []*x509.Certificate{key.Cert}}
+	if err := Verify(filePath, opts); err != nil {
+		t.Fatalf("Expected valid module signature, got %v", err)
+	}
+	if err := Verify(filePath, nil); !errors.Is(err, ErrSignerCertificateNotFound) {
+		t.Errorf("Expected ErrSignerCertificateNotFound without the signing certificate, got %v", err)
+	}
+	other := kernelKeyForTest(t, "Other kernel key", 9102)
+	if err := Verify(filePath, &VerifyOptions{ModuleSigningCertificates: []*x509.Certificate{other.Cert}}); !errors.Is(err, ErrSignerCertificateNotFound) {
+		t.Errorf("Expected ErrSignerCertificateNotFound for another kernel's key, got %v", err)
+	}
+
+	tampered := kernelModuleForTest(t, key, module, crypto.SHA256, false)
+	tampered[100] ^= 0xff
+	if err := Verify(writeScriptForTest(t, "module.ko", tampered), opts); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for a modified module, got %v", err)
+	}
+
+	embedded := writeScriptForTest(t, "module.ko", kernelModuleForTest(t, key, module, crypto.SHA1, true))
+	if err := Verify(embedded, nil); err != nil {
+		t.Errorf("Expected a module signature embedding its signer to verify, got %v", err)
+	}
+	if info, err := Inspect(embedded); err != nil || info.Signer == nil || info.Digest != nil {
+		t.Errorf("Expected the embedded signer and no signed digest, got %+v, %v", info, err)
+	}
+	if err := Verify(embedded, &VerifyOptions{RejectWeakCrypto: true}); !errors.Is(err, ErrWeakCrypto) {
+		t.Errorf("Expected ErrWeakCrypto for a SHA-1 module signature, got %v", err)
+	}
+}
+
+func TestReadKernelModuleSignature_Errors(t *testing.T) {
+	key := kernelKeyForTest(t, "Build time autogenerated kernel key", 9103)
+	signed := kernelModuleForTest(t, key, []byte("\x7fELF module"), crypto.SHA256, false)
+	info := len(signed) - len(kmodSignatureMagic) - kmodSignatureInfoSize
+
+	oversized := append([]byte(nil), signed...)
+	binary.BigEndian.PutUint32(oversized[info+8:], uint32(len(signed)))
+	var boundsErr *SignatureBoundsError
+	if err := Verify(writeScriptForTest(t, "module.ko", oversized), nil); !errors.As(err, &boundsErr) {
+		t.Errorf("Expected SignatureBoundsError, got %v", err)
+	}
+
+	legacy := append([]byte(nil), signed...)
+	legacy[info+2] = 1
+	if err := Verify(writeScriptForTest(t, "module.ko", legacy), nil); err == nil || !strings.Contains(err.Error(), "unsupported module signature type") {
+		t.Errorf("Expected an error for a non-PKCS#7 module signature, got %v", err)
+	}
+}
+
+func TestDetectFileType_KernelModuleMarker(t *testing.T) {
+	// A PE whose overlay ends with the marker is still a PE
+	pe := writeScriptForTest(t, "signed.exe", append(signedPEForTest(t, []byte("overlay")), kmodSignatureMagic...))
+	if fileType, err := DetectFileType(pe); err != nil || fileType != FileTypePE {
+		t.Fatalf("Expected FileTypePE, got %q, %v", fileType, err)
+	}
+	if signature, err := ExtractDigitalSignature(pe); err != nil || len(signature) == 0 {
+		t.Errorf("Expected the Authenticode signature, got %v", err)
+	}
+	if err := Verify(pe, nil); err != nil {
+		t.Errorf("Expected the PE to verify, got %v", err)
+	}
+
+	// Only ELF objects are kernel modules
+	key := kernelKeyForTest(t, "Build time autogenerated kernel key", 9104)
+	data := writeScriptForTest(t, "data.bin", kernelModuleForTest(t, key, []byte("not an ELF object"), crypto.SHA256, false))
+	if fileType, err := DetectFileType(data); err != nil || fileType != FileTypeUnknown {
+		t.Errorf("Expected FileTypeUnknown for a non-ELF file with the marker, got %q, %v", fileType, err)
+	}
+}
@@ -0,0 +1,36 @@
+package sigtool
+
+import (
+	"context"
+	"crypto/x509"
+	"log/slog"
+)
+
+// discardHandler is a slog.Handler that drops every record
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// discardLogger is the logger of VerifyOptions without a Logger
+var discardLogger = slog.New(discardHandler{})
+
+// logger returns opts.Logger, or a logger that discards everything
+func (opts VerifyOptions) logger() *slog.Logger {
+	if opts.Logger == nil {
+		return discardLogger
+	}
+	return opts.Logger
+}
+
+// chainSubjects returns the subjects of chain, from the leaf to the root,
+// for logging
+func chainSubjects(chain []*x509.Certificate) []string {
+	subjects := make([]string, 0, len(chain))
+	for _, cert := range chain {
+		subjects = append(subjects, cert.Subject.String())
+	}
+	return subjects
+}
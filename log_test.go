@@ -0,0 +1,45 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestVerify_Logger(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	if err := Verify(filePath, &VerifyOptions{Roots: testRoots(t), Logger: logger}); err != nil {
+		t.Fatalf("Expected verification to succeed, got: %v", err)
+	}
+	for _, msg := range []string{"read certificate table", "computed file digest", "using the configured root certificates", "built certificate chain"} {
+		if !strings.Contains(buf.String(), msg) {
+			t.Errorf("Expected log record %q, got:\n%s", msg, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if result := VerifyDetailed(filePath, &VerifyOptions{Logger: logger}); !result.Valid() {
+		t.Fatalf("Expected detailed verification to succeed, got: %v", result.Err())
+	}
+	if !strings.Contains(buf.String(), "computed file digest") {
+		t.Errorf("Expected detailed verification records, got:\n%s", buf.String())
+	}
+}
+
+func TestVerify_LoggerLevel(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	if err := Verify(filePath, &VerifyOptions{Logger: logger}); err != nil {
+		t.Fatalf("Expected verification to succeed, got: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected no records above debug level, got:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,850 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/subtle"
+	"crypto/x509"
+	"debug/macho"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.mozilla.org/pkcs7"
+)
+
+// Mach-O and universal binary magic numbers, as read big-endian
+const (
+	machoMagic32  = 0xfeedface
+	machoMagic64  = 0xfeedfacf
+	machoCigam32  = 0xcefaedfe
+	machoCigam64  = 0xcffaedfe
+	fatMagic      = 0xcafebabe
+	fatMagic64    = 0xcafebabf
+	fatArchSize   = 20
+	fatArch64Size = 32
+	// maxFatArches tells universal binaries from Java class files, which
+	// share their magic and have a major version of at least 45 where the
+	// architecture count is
+	maxFatArches = 20
+)
+
+// loadCmdCodeSignature is the LC_CODE_SIGNATURE load command, which locates
+// the embedded signature in the __LINKEDIT segment
+const loadCmdCodeSignature = 0x1d
+
+// Code signing blob magic numbers and superblob slots
+const (
+	csMagicEmbeddedSignature = 0xfade0cc0
+	csMagicCodeDirectory     = 0xfade0c02
+	csMagicBlobWrapper       = 0xfade0b01
+
+	csSlotCodeDirectory  = 0
+	csSlotRequirements   = 2
+	csSlotAlternateFirst = 0x1000
+	csSlotAlternateLast  = 0x1004
+	csSlotSignature      = 0x10000
+	csSlotTicket         = 0x10002
+
+	// codeDirectoryHeaderSize is the size of the CodeDirectory fields every
+	// version has, up to pageSize and spare2
+	codeDirectoryHeaderSize = 44
+)
+
+// CodeDirectory hash types
+const (
+	csHashSHA1            = 1
+	csHashSHA256          = 2
+	csHashSHA256Truncated = 3
+	csHashSHA384          = 4
+)
+
+// externalSpecialSlots are the special slots hashing files outside the
+// binary: Info.plist, the resource directory and application specific data
+var externalSpecialSlots = map[uint32]bool{1: true, 3: true, 4: true, 6: true}
+
+// Signed attributes by which Apple CMS signatures list the hashes of every
+// code directory: a property list of truncated hashes and, since macOS
+// 10.15, a set of algorithms and full hashes
+var (
+	oidAttributeCDHashes  = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 9, 1}
+	oidAttributeCDHashes2 = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 9, 2}
+)
+
+// cdHashSize is the length codesign truncates CodeDirectory hashes to
+const cdHashSize = 20
+
+// MachOSignature is the code signature of one architecture of a Mach-O
+// binary.
+type MachOSignature struct {
+	// Arch is the architecture of the slice, such as "x86_64" or "arm64"
+	Arch string
+	// Offset is the file offset of the slice, zero for thin binaries
+	Offset int64
+	// Identifier is the signing identifier of the code directory, usually
+	// the bundle identifier
+	Identifier string
+	// TeamID is the Apple Developer Team ID of the code directory, when set
+	TeamID string `json:",omitempty"`
+	// HashAlgorithm is the page hash algorithm of the primary code directory
+	HashAlgorithm crypto.Hash
+	// CDHash is the hash of the primary code directory, truncated to 20
+	// bytes as codesign reports it
+	CDHash []byte
+	// AdHoc reports a signature without a CMS signature, which binds the
+	// code to its code directory but names no signer
+	AdHoc bool
+	// Signer is the signing certificate, when the CMS signature embeds it
+	Signer *CertificateInfo `json:",omitempty"`
+	// Err is nil when the signature of the slice verified successfully,
+	// otherwise it describes why verification failed
+	Err error `json:"-"`
+}
+
+// Valid reports whether the signature of the slice verified successfully.
+func (s *MachOSignature) Valid() bool {
+	return s.Err == nil
+}
+
+// machoSlice is one architecture of a Mach-O binary
+type machoSlice struct {
+	arch   string
+	offset int64
+	r      *io.SectionReader
+}
+
+// codeSignature is the embedded signature (SuperBlob) of a Mach-O slice
+type codeSignature struct {
+	// directories holds the code directory of slot zero followed by the
+	// alternate code directories
+	directories []*codeDirectory
+	// cms is the CMS signature over the primary code directory, empty for
+	// ad-hoc signatures
+	cms []byte
+	// ticket is the stapled notarization ticket, when there is one
+	ticket []byte
+	// special holds the other blobs by slot, such as the requirements and
+	// entitlements, each covered by the special slot of the same number
+	special map[uint32][]byte
+}
+
+// codeDirectory is a parsed CodeDirectory blob
+type codeDirectory struct {
+	raw           []byte
+	version       uint32
+	flags         uint32
+	hashOffset    uint32
+	nSpecialSlots uint32
+	nCodeSlots    uint32
+	codeLimit     int64
+	hashSize      int
+	hashType      uint8
+	pageSize      uint8
+	platform      uint8
+	identifier    string
+	teamID        string
+}
+
+// VerifyMachO verifies the code signature of every architecture of a
+// Mach-O binary, thin or universal (fat), each independently.
+//
+// For each slice, unless opts.SkipContentDigest is set, every page of the
+// code up to the code limit and every blob of the embedded signature, such
+// as the requirements and entitlements, must match its hash in each code
+// directory. The CMS signature must be over the primary code directory and
+// list the hashes of the alternate ones; its signer and chain are checked
+// per opts. The Team ID of the code directory must be the organizational
+// unit of the signer and opts.RequiredTeamID when set, and the code must
+// satisfy its embedded designated requirement, in which "anchor apple"
+// names the Apple Root CA and Apple Root CA - G3 certificates. Ad-hoc signed
+// slices fail with ErrNotSigned. A failure of one slice is reported in its
+// Err field and does not prevent the others from being checked.
+//
+// Parameters:
+//   - filePath: The path to the Mach-O or universal binary
+//   - opts: Certificate chain verification options applied to every slice
+//
+// Returns:
+//   - []MachOSignature: One entry per architecture, in file order
+//   - error: An error if the file cannot be read or is not a Mach-O binary
+//
+// Example usage:
+//
+//	slices, err := sigtool.VerifyMachO("MyApp.app/Contents/MacOS/MyApp", sigtool.VerifyOptions{})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	for _, s := range slices {
+//	    fmt.Printf("%s %s valid=%v\n", s.Arch, s.TeamID, s.Valid())
+//	}
+func VerifyMachO(filePath string, opts VerifyOptions) ([]MachOSignature, error) {
+	if strings.TrimSpace(filePath) == "" {
+		return nil, errors.New("file path cannot be empty")
+	}
+
+	// #nosec G304 - This tool is designed to read user-specified files
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %q: %w", filePath, err)
+	}
+	defer f.Close()
+
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+	return verifyMachOSlices(f, fileInfo.Size(), opts)
+}
+
+// verifyMachOSlices implements VerifyMachO for r of the given size
+func verifyMachOSlices(r io.ReaderAt, size int64, opts VerifyOptions) ([]MachOSignature, error) {
+	slices, err := machoSlices(r, size)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]MachOSignature, 0, len(slices))
+	for _, slice := range slices {
+		results = append(results, verifyMachOSlice(slice, opts))
+	}
+	return results, nil
+}
+
+// verifyMachO verifies every slice of the Mach-O binary r like VerifyMachO,
+// failing with the error of the first slice that does not verify
+func verifyMachO(r io.ReaderAt, size int64, opts VerifyOptions) error {
+	results, err := verifyMachOSlices(r, size, opts)
+	if err != nil {
+		return fmt.Errorf("failed to extract signature: %w", err)
+	}
+	for _, result := range results {
+		if result.Err != nil {
+			if len(results) == 1 {
+				return result.Err
+			}
+			return fmt.Errorf("%s: %w", result.Arch, result.Err)
+		}
+	}
+	return nil
+}
+
+// verifyMachOSlice verifies the code signature of slice per opts
+func verifyMachOSlice(slice machoSlice, opts VerifyOptions) MachOSignature {
+	result := MachOSignature{Arch: slice.arch, Offset: slice.offset}
+	sig, err := readCodeSignature(slice)
+	if err != nil {
+		result.Err = fmt.Errorf("failed to extract signature: %w", err)
+		return result
+	}
+	cd := sig.directories[0]
+	result.Identifier = cd.identifier
+	result.TeamID = cd.teamID
+	result.HashAlgorithm, _ = cd.hash()
+	result.CDHash = cd.cdhash()
+	result.AdHoc = len(sig.cms) == 0
+	opts.logger().Debug("read Mach-O code signature", "arch", slice.arch, "identifier", cd.identifier, "directories", len(sig.directories), "cms", len(sig.cms))
+	result.Signer, result.Err = verifyCodeSignature(sig, slice.r, slice.arch+" slice", opts)
+	return result
+}
+
+// verifyCodeSignature verifies the embedded signature sig of code, named
+// by what in errors, like VerifyMachO and returns its signer when the CMS
+// signature embeds it
+func verifyCodeSignature(sig *codeSignature, code *io.SectionReader, what string, opts VerifyOptions) (*CertificateInfo, error) {
+	cd := sig.directories[0]
+	if !opts.SkipContentDigest {
+		for _, directory := range sig.directories {
+			if err := directory.verifyPages(code); err != nil {
+				return nil, err
+			}
+			if err := directory.verifySpecialSlots(sig.special); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(sig.cms) == 0 {
+		return nil, fmt.Errorf("%w (%s is ad-hoc signed)", ErrNotSigned, what)
+	}
+
+	p7, err := parsePKCS7(sig.cms)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS#7 signature: %w", err)
+	}
+	signer := p7.GetOnlySigner()
+	var info *CertificateInfo
+	if signer != nil {
+		info = newCertificateInfo(signer)
+	}
+	// The CMS signature is detached from the code directory it signs
+	p7.Content = cd.raw
+	if err := verifySignedData(p7, opts); err != nil {
+		return info, err
+	}
+	if err := verifyCDHashes(p7, sig.directories); err != nil {
+		return info, err
+	}
+	if signer == nil {
+		return info, errors.New("signature must have exactly one signer with an embedded certificate")
+	}
+	if err := checkTeamID(cd, signer, opts.RequiredTeamID); err != nil {
+		return info, err
+	}
+	if requirements, ok := sig.special[csSlotRequirements]; ok {
+		dr, err := designatedRequirement(requirements)
+		if err != nil {
+			return info, fmt.Errorf("failed to read requirements: %w", err)
+		}
+		if dr != nil {
+			ctx := &requirementContext{directories: sig.directories, chain: signerChain(signer, p7.Certificates)}
+			return info, evaluateRequirement(dr, ctx)
+		}
+	}
+	return info, nil
+}
+
+// checkTeamID reports ErrTeamIDMismatch unless the Team ID of cd is the
+// organizational unit of signer, as Apple issues Developer ID and
+// distribution certificates, and is required when required is set
+func checkTeamID(cd *codeDirectory, signer *x509.Certificate, required string) error {
+	if required != "" && cd.teamID != required {
+		return fmt.Errorf("%w: code directory has Team ID %q, expected %q", ErrTeamIDMismatch, cd.teamID, required)
+	}
+	if cd.teamID == "" {
+		return nil
+	}
+	for _, ou := range signer.Subject.OrganizationalUnit {
+		if ou == cd.teamID {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: code directory has Team ID %q, signer %s does not", ErrTeamIDMismatch, cd.teamID, signer.Subject)
+}
+
+// verifyCDHashes checks that the CMS signature p7 lists the hash of every
+// code directory in its hash agility attributes. The CMS signature covers
+// the primary code directory itself, so a signature without alternate code
+// directories needs neither attribute.
+func verifyCDHashes(p7 *pkcs7.PKCS7, directories []*codeDirectory) error {
+	attrs := authenticatedAttributes(p7)
+	plist, hasPlist := findAttribute(attrs, oidAttributeCDHashes)
+	agility, hasAgility := findAttribute(attrs, oidAttributeCDHashes2)
+	if !hasPlist && !hasAgility {
+		if len(directories) > 1 {
+			return errors.New("alternate code directories are not covered by the signature")
+		}
+		return nil
+	}
+
+	var listed [][]byte
+	if hasPlist {
+		var data []byte
+		if _, err := asn1.Unmarshal(plist, &data); err != nil {
+			return fmt.Errorf("failed to parse cdhashes attribute: %w", err)
+		}
+		hashes, err := parseCDHashesPlist(data)
+		if err != nil {
+			return err
+		}
+		listed = append(listed, hashes...)
+	}
+	for rest := agility; len(rest) > 0; {
+		var entry struct {
+			Algorithm asn1.ObjectIdentifier
+			Digest    []byte
+		}
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &entry); err != nil {
+			return fmt.Errorf("failed to parse hash agility attribute: %w", err)
+		}
+		listed = append(listed, entry.Digest)
+	}
+
+	for i, cd := range directories {
+		if !cdHashListed(cd.fullHash(), listed) {
+			return fmt.Errorf("code directory %d is not listed by the signature's CDHashes", i)
+		}
+	}
+	return nil
+}
+
+// cdHashListed reports whether full, a code directory hash, is among the
+// listed hashes, which may be truncated to 20 bytes
+func cdHashListed(full []byte, listed [][]byte) bool {
+	for _, hash := range listed {
+		if n := len(hash); n >= cdHashSize && n <= len(full) && bytes.Equal(hash, full[:n]) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCDHashesPlist returns the hashes of the cdhashes array of the XML
+// property list of a cdhashes attribute
+func parseCDHashesPlist(data []byte) ([][]byte, error) {
+	var plist struct {
+		Dict struct {
+			Keys  []string `xml:"key"`
+			Array struct {
+				Data []string `xml:"data"`
+			} `xml:"array"`
+		} `xml:"dict"`
+	}
+	if err := xml.Unmarshal(data, &plist); err != nil {
+		return nil, fmt.Errorf("failed to parse cdhashes property list: %w", err)
+	}
+	if len(plist.Dict.Keys) != 1 || plist.Dict.Keys[0] != "cdhashes" {
+		return nil, errors.New("cdhashes property list has no cdhashes array")
+	}
+	var hashes [][]byte
+	for _, s := range plist.Dict.Array.Data {
+		hash, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode cdhash: %w", err)
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, nil
+}
+
+// isMachO reports whether r starts with a Mach-O or universal binary magic
+// number
+func isMachO(r io.ReaderAt) bool {
+	var header [8]byte
+	if _, err := r.ReadAt(header[:], 0); err != nil {
+		return false
+	}
+	switch binary.BigEndian.Uint32(header[:]) {
+	case machoMagic32, machoMagic64, machoCigam32, machoCigam64:
+		return true
+	case fatMagic, fatMagic64:
+		n := binary.BigEndian.Uint32(header[4:])
+		return n > 0 && n <= maxFatArches
+	}
+	return false
+}
+
+// machoSlices returns the architectures of the Mach-O binary r: the slices
+// listed by the fat header of a universal binary, or r itself
+func machoSlices(r io.ReaderAt, size int64) ([]machoSlice, error) {
+	if !isMachO(r) {
+		return nil, errors.New("not a Mach-O binary")
+	}
+	var header [8]byte
+	if _, err := r.ReadAt(header[:], 0); err != nil {
+		return nil, fmt.Errorf("failed to read Mach-O header: %w", err)
+	}
+	magic := binary.BigEndian.Uint32(header[:])
+	if magic != fatMagic && magic != fatMagic64 {
+		slice := machoSlice{r: io.NewSectionReader(r, 0, size)}
+		arch, err := machoArch(slice.r)
+		if err != nil {
+			return nil, err
+		}
+		slice.arch = arch
+		return []machoSlice{slice}, nil
+	}
+
+	n := int(binary.BigEndian.Uint32(header[4:]))
+	entrySize := fatArchSize
+	if magic == fatMagic64 {
+		entrySize = fatArch64Size
+	}
+	entries := make([]byte, n*entrySize)
+	if _, err := r.ReadAt(entries, 8); err != nil {
+		return nil, fmt.Errorf("failed to read fat header: %w", err)
+	}
+	slices := make([]machoSlice, 0, n)
+	for i := 0; i < n; i++ {
+		entry := entries[i*entrySize:]
+		var offset, length int64
+		if magic == fatMagic64 {
+			offset = int64(binary.BigEndian.Uint64(entry[8:]))
+			length = int64(binary.BigEndian.Uint64(entry[16:]))
+		} else {
+			offset = int64(binary.BigEndian.Uint32(entry[8:]))
+			length = int64(binary.BigEndian.Uint32(entry[12:]))
+		}
+		if offset < 0 || length < 0 || offset > size || length > size-offset {
+			return nil, fmt.Errorf("fat architecture %d at offset %d of %d bytes exceeds file size %d", i, offset, length, size)
+		}
+		slice := machoSlice{offset: offset, r: io.NewSectionReader(r, offset, length)}
+		arch, err := machoArch(slice.r)
+		if err != nil {
+			return nil, fmt.Errorf("fat architecture %d: %w", i, err)
+		}
+		slice.arch = arch
+		slices = append(slices, slice)
+	}
+	return slices, nil
+}
+
+// machoArch returns the name of the architecture of the thin Mach-O image r
+func machoArch(r io.ReaderAt) (string, error) {
+	f, err := macho.NewFile(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse Mach-O header: %w", err)
+	}
+	defer f.Close()
+	sub := f.SubCpu &^ 0xff000000
+	switch f.Cpu {
+	case macho.Cpu386:
+		return "i386", nil
+	case macho.CpuAmd64:
+		if sub == 8 {
+			return "x86_64h", nil
+		}
+		return "x86_64", nil
+	case macho.CpuArm:
+		return "arm", nil
+	case macho.CpuArm64:
+		if sub == 2 {
+			return "arm64e", nil
+		}
+		return "arm64", nil
+	case macho.CpuPpc:
+		return "ppc", nil
+	case macho.CpuPpc64:
+		return "ppc64", nil
+	}
+	return fmt.Sprintf("cpu%d", uint32(f.Cpu)), nil
+}
+
+// readCodeSignature reads the embedded signature located by the
+// LC_CODE_SIGNATURE load command of slice
+func readCodeSignature(slice machoSlice) (*codeSignature, error) {
+	f, err := macho.NewFile(slice.r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Mach-O header: %w", err)
+	}
+	defer f.Close()
+
+	var offset, length int64 = -1, 0
+	for _, load := range f.Loads {
+		raw := load.Raw()
+		if len(raw) >= 16 && f.ByteOrder.Uint32(raw) == loadCmdCodeSignature {
+			offset = int64(f.ByteOrder.Uint32(raw[8:]))
+			length = int64(f.ByteOrder.Uint32(raw[12:]))
+		}
+	}
+	if offset < 0 {
+		return nil, fmt.Errorf("%w (%s slice has no LC_CODE_SIGNATURE load command)", ErrNotSigned, slice.arch)
+	}
+	if length > maxCodeSignatureSize {
+		return nil, &SignatureSizeError{Size: length, Limit: maxCodeSignatureSize}
+	}
+	if offset+length > slice.r.Size() {
+		return nil, &SignatureBoundsError{
+			Offset: slice.offset + offset, Length: length, FileSize: slice.r.Size(),
+			Reason: fmt.Sprintf("%s code signature at offset %d of %d bytes exceeds the slice", slice.arch, offset, length),
+		}
+	}
+	data := make([]byte, length)
+	if _, err := slice.r.ReadAt(data, offset); err != nil {
+		return nil, fmt.Errorf("failed to read code signature: %w", err)
+	}
+	return parseCodeSignature(data)
+}
+
+// maxCodeSignatureSize bounds the embedded signature of a slice, which
+// holds a hash per code page besides the CMS signature
+const maxCodeSignatureSize = 64 << 20
+
+// parseCodeSignature parses an embedded signature SuperBlob
+func parseCodeSignature(data []byte) (*codeSignature, error) {
+	if len(data) < 12 || binary.BigEndian.Uint32(data) != csMagicEmbeddedSignature {
+		return nil, errors.New("code signature is not an embedded signature blob")
+	}
+	if length := binary.BigEndian.Uint32(data[4:]); int64(length) > int64(len(data)) || length < 12 {
+		return nil, fmt.Errorf("%w: code signature blob of %d bytes in %d", ErrSignatureTruncated, length, len(data))
+	} else {
+		data = data[:length]
+	}
+	count := int64(binary.BigEndian.Uint32(data[8:]))
+	if 12+8*count > int64(len(data)) {
+		return nil, fmt.Errorf("%w: code signature index of %d entries", ErrSignatureTruncated, count)
+	}
+
+	sig := &codeSignature{special: make(map[uint32][]byte)}
+	var primary *codeDirectory
+	for i := int64(0); i < count; i++ {
+		entry := data[12+8*i:]
+		slot := binary.BigEndian.Uint32(entry)
+		if slot == csSlotTicket {
+			ticket, err := ticketBlob(data, count, binary.BigEndian.Uint32(entry[4:]))
+			if err != nil {
+				return nil, fmt.Errorf("code signature slot %#x: %w", slot, err)
+			}
+			sig.ticket = ticket
+			continue
+		}
+		blob, err := codeSigningBlob(data, binary.BigEndian.Uint32(entry[4:]))
+		if err != nil {
+			return nil, fmt.Errorf("code signature slot %#x: %w", slot, err)
+		}
+		switch {
+		case slot == csSlotCodeDirectory, slot >= csSlotAlternateFirst && slot <= csSlotAlternateLast:
+			cd, err := parseCodeDirectory(blob)
+			if err != nil {
+				return nil, fmt.Errorf("code signature slot %#x: %w", slot, err)
+			}
+			if slot == csSlotCodeDirectory {
+				primary = cd
+			} else {
+				sig.directories = append(sig.directories, cd)
+			}
+		case slot == csSlotSignature:
+			if binary.BigEndian.Uint32(blob) != csMagicBlobWrapper {
+				return nil, fmt.Errorf("code signature slot %#x is not a CMS blob wrapper", slot)
+			}
+			sig.cms = blob[8:]
+		case slot < csSlotAlternateFirst:
+			sig.special[slot] = blob
+		}
+	}
+	if primary == nil {
+		return nil, errors.New("code signature has no code directory")
+	}
+	sig.directories = append([]*codeDirectory{primary}, sig.directories...)
+	return sig, nil
+}
+
+// ticketBlob returns the stapled notarization ticket at offset in the
+// superblob data, which holds count blobs. Tickets are stored without a
+// blob header, so the ticket extends to the next blob or the end of data.
+func ticketBlob(data []byte, count int64, offset uint32) ([]byte, error) {
+	if int64(offset) < 12+8*count || int64(offset) >= int64(len(data)) {
+		return nil, fmt.Errorf("%w: ticket at offset %d", ErrSignatureTruncated, offset)
+	}
+	end := uint32(len(data))
+	for i := int64(0); i < count; i++ {
+		if next := binary.BigEndian.Uint32(data[12+8*i+4:]); next > offset && next < end {
+			end = next
+		}
+	}
+	return data[offset:end], nil
+}
+
+// codeSigningBlob returns the blob at offset in the superblob data, which
+// starts with its magic number and length
+func codeSigningBlob(data []byte, offset uint32) ([]byte, error) {
+	if int64(offset)+8 > int64(len(data)) {
+		return nil, fmt.Errorf("%w: blob at offset %d", ErrSignatureTruncated, offset)
+	}
+	length := binary.BigEndian.Uint32(data[offset+4:])
+	if length < 8 || int64(offset)+int64(length) > int64(len(data)) {
+		return nil, fmt.Errorf("%w: blob at offset %d of %d bytes", ErrSignatureTruncated, offset, length)
+	}
+	return data[offset : offset+length], nil
+}
+
+// parseCodeDirectory parses a CodeDirectory blob
+func parseCodeDirectory(blob []byte) (*codeDirectory, error) {
+	if binary.BigEndian.Uint32(blob) != csMagicCodeDirectory || len(blob) < codeDirectoryHeaderSize {
+		return nil, errors.New("not a code directory")
+	}
+	cd := &codeDirectory{
+		raw:           blob,
+		version:       binary.BigEndian.Uint32(blob[8:]),
+		flags:         binary.BigEndian.Uint32(blob[12:]),
+		hashOffset:    binary.BigEndian.Uint32(blob[16:]),
+		nSpecialSlots: binary.BigEndian.Uint32(blob[24:]),
+		nCodeSlots:    binary.BigEndian.Uint32(blob[28:]),
+		codeLimit:     int64(binary.BigEndian.Uint32(blob[32:])),
+		hashSize:      int(blob[36]),
+		hashType:      blob[37],
+		platform:      blob[38],
+		pageSize:      blob[39],
+	}
+	identOffset := binary.BigEndian.Uint32(blob[20:])
+	var err error
+	if cd.identifier, err = codeDirectoryString(blob, identOffset); err != nil {
+		return nil, fmt.Errorf("identifier: %w", err)
+	}
+	// Later versions append fields: the scatter offset (0x20100), the team
+	// identifier offset (0x20200) and the 64-bit code limit (0x20300)
+	if cd.version >= 0x20200 && len(blob) >= 52 {
+		if teamOffset := binary.BigEndian.Uint32(blob[48:]); teamOffset != 0 {
+			if cd.teamID, err = codeDirectoryString(blob, teamOffset); err != nil {
+				return nil, fmt.Errorf("team identifier: %w", err)
+			}
+		}
+	}
+	if cd.version >= 0x20300 && len(blob) >= 64 {
+		if limit := binary.BigEndian.Uint64(blob[56:]); limit != 0 {
+			cd.codeLimit = int64(limit)
+		}
+	}
+
+	algorithm, err := cd.hash()
+	if err != nil {
+		return nil, err
+	}
+	if want := cd.slotSize(algorithm); cd.hashSize != want {
+		return nil, fmt.Errorf("code directory hash size %d, expected %d for %v", cd.hashSize, want, algorithm)
+	}
+	start := int64(cd.hashOffset) - int64(cd.nSpecialSlots)*int64(cd.hashSize)
+	end := int64(cd.hashOffset) + int64(cd.nCodeSlots)*int64(cd.hashSize)
+	if start < codeDirectoryHeaderSize || end > int64(len(blob)) {
+		return nil, fmt.Errorf("%w: code directory hash slots exceed the blob", ErrSignatureTruncated)
+	}
+	return cd, nil
+}
+
+// codeDirectoryString returns the NUL-terminated string at offset in blob
+func codeDirectoryString(blob []byte, offset uint32) (string, error) {
+	if int64(offset) >= int64(len(blob)) {
+		return "", fmt.Errorf("offset %d exceeds the code directory", offset)
+	}
+	s, _, ok := bytes.Cut(blob[offset:], []byte{0})
+	if !ok {
+		return "", errors.New("unterminated string")
+	}
+	return string(s), nil
+}
+
+// hash returns the page hash algorithm of cd
+func (cd *codeDirectory) hash() (crypto.Hash, error) {
+	switch cd.hashType {
+	case csHashSHA1:
+		return crypto.SHA1, nil
+	case csHashSHA256, csHashSHA256Truncated:
+		return crypto.SHA256, nil
+	case csHashSHA384:
+		return crypto.SHA384, nil
+	}
+	return 0, fmt.Errorf("unsupported code directory hash type %d", cd.hashType)
+}
+
+// slotSize returns the size of the hash slots of cd, hashes of algorithm
+// truncated for the truncated SHA-256 hash type
+func (cd *codeDirectory) slotSize(algorithm crypto.Hash) int {
+	if cd.hashType == csHashSHA256Truncated {
+		return cdHashSize
+	}
+	return algorithm.Size()
+}
+
+// cdhash returns the hash of cd with its own algorithm, truncated to 20
+// bytes
+func (cd *codeDirectory) cdhash() []byte {
+	if full := cd.fullHash(); full != nil {
+		return full[:cdHashSize]
+	}
+	return nil
+}
+
+// fullHash returns the hash of cd with its own algorithm
+func (cd *codeDirectory) fullHash() []byte {
+	algorithm, err := cd.hash()
+	if err != nil || !algorithm.Available() {
+		return nil
+	}
+	h := algorithm.New()
+	h.Write(cd.raw)
+	return h.Sum(nil)
+}
+
+// verifySpecialSlots checks the blobs of the embedded signature against the
+// special slots of cd. The Info.plist, resource directory and application
+// slots hash files of the bundle around the binary, which is not read, so
+// they are only checked when the signature embeds their blob.
+func (cd *codeDirectory) verifySpecialSlots(blobs map[uint32][]byte) error {
+	algorithm, err := cd.hash()
+	if err != nil {
+		return err
+	}
+	size := cd.slotSize(algorithm)
+	zero := make([]byte, size)
+	for slot := uint32(1); slot <= cd.nSpecialSlots; slot++ {
+		offset := int64(cd.hashOffset) - int64(slot)*int64(size)
+		signed := cd.raw[offset : offset+int64(size)]
+		blob, ok := blobs[slot]
+		if !ok {
+			if !externalSpecialSlots[slot] && !bytes.Equal(signed, zero) {
+				return fmt.Errorf("special slot %d is signed but the signature has no blob for it", slot)
+			}
+			continue
+		}
+		h := algorithm.New()
+		h.Write(blob)
+		computed := h.Sum(nil)[:size]
+		if subtle.ConstantTimeCompare(computed, signed) != 1 {
+			return fmt.Errorf("special slot %d: %w", slot, &DigestMismatchError{Algorithm: algorithm, Signed: signed, Computed: computed})
+		}
+	}
+	for slot := range blobs {
+		if slot > cd.nSpecialSlots {
+			return fmt.Errorf("code signature blob %d is not covered by a special slot", slot)
+		}
+	}
+	return nil
+}
+
+// verifyPages checks the hash of every code page of the slice r against
+// the code slots of cd
+func (cd *codeDirectory) verifyPages(r *io.SectionReader) error {
+	algorithm, err := cd.hash()
+	if err != nil {
+		return err
+	}
+	if !algorithm.Available() {
+		return fmt.Errorf("hash algorithm %v is not available", algorithm)
+	}
+	if cd.codeLimit > r.Size() {
+		return fmt.Errorf("code limit %d exceeds the %d byte slice", cd.codeLimit, r.Size())
+	}
+	pageSize := cd.codeLimit
+	if cd.pageSize != 0 {
+		if cd.pageSize > 30 {
+			return fmt.Errorf("code directory page size 2^%d is too large", cd.pageSize)
+		}
+		pageSize = int64(1) << cd.pageSize
+	}
+	pages := int64(0)
+	if pageSize > 0 {
+		pages = (cd.codeLimit + pageSize - 1) / pageSize
+	}
+	if pages != int64(cd.nCodeSlots) {
+		return fmt.Errorf("code directory has %d code slots for %d pages", cd.nCodeSlots, pages)
+	}
+
+	size := cd.slotSize(algorithm)
+	page := make([]byte, pageSize)
+	for i := int64(0); i < pages; i++ {
+		n := min(pageSize, cd.codeLimit-i*pageSize)
+		if _, err := r.ReadAt(page[:n], i*pageSize); err != nil {
+			return fmt.Errorf("failed to read code page %d: %w", i, err)
+		}
+		h := algorithm.New()
+		h.Write(page[:n])
+		computed := h.Sum(nil)[:size]
+		slot := int64(cd.hashOffset) + i*int64(size)
+		signed := cd.raw[slot : slot+int64(size)]
+		if subtle.ConstantTimeCompare(computed, signed) != 1 {
+			return fmt.Errorf("code page %d: %w", i, &DigestMismatchError{Algorithm: algorithm, Signed: signed, Computed: computed})
+		}
+	}
+	return nil
+}
+
+// readMachOSignature returns the CMS signature of the first slice of the
+// Mach-O binary r
+func readMachOSignature(r io.ReaderAt, size int64) ([]byte, error) {
+	slices, err := machoSlices(r, size)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := readCodeSignature(slices[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(sig.cms) == 0 {
+		return nil, fmt.Errorf("%w (%s slice is ad-hoc signed)", ErrNotSigned, slices[0].arch)
+	}
+	return sig.cms, nil
+}
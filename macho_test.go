@@ -0,0 +1,511 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"debug/macho"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var (
+	machoIdentityOnce sync.Once
+	machoIdentity     *testIdentity
+	machoRoot         *x509.Certificate
+)
+
+// machoIdentityForTest returns a cached Developer ID style signer for Team
+// ID ABCDE12345, issued through an intermediate carrying the Developer ID
+// CA marker, and its self-signed root
+func machoIdentityForTest(t testing.TB) (*testIdentity, *x509.Certificate) {
+	t.Helper()
+	machoIdentityOnce.Do(func() {
+		root := issueCertificateForTest(t, testCATemplate("sigtool test Apple root", 8801), nil)
+		caTemplate := testCATemplate("sigtool test Developer ID CA", 8802)
+		caTemplate.ExtraExtensions = []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 2, 6}, Value: asn1.NullBytes}}
+		ca := issueCertificateForTest(t, caTemplate, root)
+		leafTemplate := testLeafTemplate("Developer ID Application: sigtool test (ABCDE12345)", 8803, x509.ExtKeyUsageCodeSigning)
+		leafTemplate.Subject.OrganizationalUnit = []string{"ABCDE12345"}
+		leafTemplate.ExtraExtensions = []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 1, 13}, Value: asn1.NullBytes}}
+		machoIdentity = issueCertificateForTest(t, leafTemplate, ca)
+		machoIdentity.Chain = append(machoIdentity.Chain, root.Cert)
+		machoRoot = root.Cert
+	})
+	return machoIdentity, machoRoot
+}
+
+// machoRootsForTest returns a pool holding the root of machoIdentityForTest
+func machoRootsForTest(t testing.TB) *x509.CertPool {
+	_, root := machoIdentityForTest(t)
+	pool := x509.NewCertPool()
+	pool.AddCert(root)
+	return pool
+}
+
+// pinAppleRootForTest makes the root of machoIdentityForTest an Apple root
+// for the rest of the test
+func pinAppleRootForTest(t testing.TB) {
+	_, root := machoIdentityForTest(t)
+	sum := sha256.Sum256(root.Raw)
+	appleRootHashes[sum] = true
+	t.Cleanup(func() { delete(appleRootHashes, sum) })
+}
+
+// signDetachedForTest builds a CMS signature by id over content without
+// embedding it, as codesign signs code directories, with the extra signed
+// attributes
+func signDetachedForTest(t testing.TB, id *testIdentity, content []byte, extra ...testAttribute) []byte {
+	t.Helper()
+	algID := pkix.AlgorithmIdentifier{Algorithm: oidDigestSHA256, Parameters: asn1.NullRawValue}
+	digest := sha256.Sum256(content)
+	attrs := append([]testAttribute{
+		testAttr(t, oidAttributeContentType, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}),
+		testAttr(t, oidAttributeMessageDigest, digest[:]),
+	}, extra...)
+	si := testSignerInfo{
+		Version: 1,
+		IssuerAndSerialNumber: testIssuerAndSerial{
+			IssuerName:   asn1.RawValue{FullBytes: id.Cert.RawIssuer},
+			SerialNumber: new(big.Int).Set(id.Cert.SerialNumber),
+		},
+		DigestAlgorithm:         algID,
+		AuthenticatedAttributes: attrs,
+		DigestEncryptionAlgorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1},
+			Parameters: asn1.NullRawValue,
+		},
+		EncryptedDigest: signAttributesWithKeyForTest(t, attrs, crypto.SHA256, id.Key),
+	}
+	certs := append([]byte(nil), id.Cert.Raw...)
+	for _, c := range id.Chain {
+		certs = append(certs, c.Raw...)
+	}
+	sd, err := asn1.Marshal(testSignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{algID},
+		ContentInfo:      testContentInfo{ContentType: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs},
+		SignerInfos:      []testSignerInfo{si},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal SignedData: %v", err)
+	}
+	p7, err := asn1.Marshal(testContentInfo{
+		ContentType: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2},
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal ContentInfo: %v", err)
+	}
+	return p7
+}
+
+// codeDirectoryForTest returns a version 0x20200 code directory with h
+// hashes of the 4 KiB pages of code and of the special slot blobs
+func codeDirectoryForTest(code []byte, h crypto.Hash, special map[uint32][]byte) []byte {
+	const headerSize, pageShift = 52, 12
+	const identifier, teamID = "com.example.hello", "ABCDE12345"
+	hashType := map[crypto.Hash]byte{crypto.SHA1: csHashSHA1, crypto.SHA256: csHashSHA256, crypto.SHA384: csHashSHA384}[h]
+	nSpecial := uint32(0)
+	for slot := range special {
+		nSpecial = max(nSpecial, slot)
+	}
+	pages := (len(code) + 1<<pageShift - 1) >> pageShift
+	identOffset := headerSize
+	teamOffset := identOffset + len(identifier) + 1
+	hashOffset := teamOffset + len(teamID) + 1 + int(nSpecial)*h.Size()
+
+	cd := make([]byte, hashOffset, hashOffset+pages*h.Size())
+	binary.BigEndian.PutUint32(cd[0:], csMagicCodeDirectory)
+	binary.BigEndian.PutUint32(cd[8:], 0x20200)
+	binary.BigEndian.PutUint32(cd[16:], uint32(hashOffset))
+	binary.BigEndian.PutUint32(cd[20:], uint32(identOffset))
+	binary.BigEndian.PutUint32(cd[24:], nSpecial)
+	binary.BigEndian.PutUint32(cd[28:], uint32(pages))
+	binary.BigEndian.PutUint32(cd[32:], uint32(len(code)))
+	cd[36] = byte(h.Size())
+	cd[37] = hashType
+	cd[39] = pageShift
+	binary.BigEndian.PutUint32(cd[48:], uint32(teamOffset))
+	copy(cd[identOffset:], identifier)
+	copy(cd[teamOffset:], teamID)
+	for slot, blob := range special {
+		d := h.New()
+		d.Write(blob)
+		copy(cd[hashOffset-int(slot)*h.Size():], d.Sum(nil))
+	}
+	for i := 0; i < len(code); i += 1 << pageShift {
+		d := h.New()
+		d.Write(code[i:min(i+1<<pageShift, len(code))])
+		cd = d.Sum(cd)
+	}
+	binary.BigEndian.PutUint32(cd[4:], uint32(len(cd)))
+	return cd
+}
+
+// superBlobForTest returns an embedded signature holding each blob under
+// its slot
+func superBlobForTest(slots []uint32, blobs [][]byte) []byte {
+	offset := 12 + 8*len(slots)
+	data := binary.BigEndian.AppendUint32(nil, csMagicEmbeddedSignature)
+	data = binary.BigEndian.AppendUint32(data, 0)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(slots)))
+	for i, slot := range slots {
+		data = binary.BigEndian.AppendUint32(data, slot)
+		data = binary.BigEndian.AppendUint32(data, uint32(offset))
+		offset += len(blobs[i])
+	}
+	for _, blob := range blobs {
+		data = append(data, blob...)
+	}
+	binary.BigEndian.PutUint32(data[4:], uint32(len(data)))
+	return data
+}
+
+// machoSigningForTest selects how machoSignedForTest signs a binary
+type machoSigningForTest struct {
+	// adHoc leaves out the CMS signature
+	adHoc bool
+	// signer signs the code directory, machoIdentityForTest when nil
+	signer *testIdentity
+	// requirement is a compiled designated requirement expression
+	requirement []byte
+	// alternate adds a SHA-384 alternate code directory, listed in the hash
+	// agility attribute unless unlisted is set
+	alternate, unlisted bool
+	// ticket staples a notarization ticket binding the primary code
+	// directory
+	ticket bool
+}
+
+// machoForTest returns a 64-bit little-endian Mach-O executable for cpu
+// with a code signature over its header and payload by
+// machoIdentityForTest, or an ad-hoc signature when adHoc is set
+func machoForTest(t testing.TB, cpu macho.Cpu, payload []byte, adHoc bool) []byte {
+	t.Helper()
+	return machoSignedForTest(t, cpu, payload, machoSigningForTest{adHoc: adHoc})
+}
+
+// machoSignedForTest is machoForTest with the signing options in signing
+func machoSignedForTest(t testing.TB, cpu macho.Cpu, payload []byte, signing machoSigningForTest) []byte {
+	t.Helper()
+	const headerSize, cmdSize = 32, 16
+	code := make([]byte, headerSize+cmdSize, headerSize+cmdSize+len(payload))
+	code = append(code, payload...)
+	le := binary.LittleEndian
+	le.PutUint32(code[0:], macho.Magic64)
+	le.PutUint32(code[4:], uint32(cpu))
+	le.PutUint32(code[12:], uint32(macho.TypeExec))
+	le.PutUint32(code[16:], 1)
+	le.PutUint32(code[20:], cmdSize)
+	le.PutUint32(code[headerSize:], loadCmdCodeSignature)
+	le.PutUint32(code[headerSize+4:], cmdSize)
+	le.PutUint32(code[headerSize+8:], uint32(len(code)))
+
+	id := signing.signer
+	if id == nil {
+		id, _ = machoIdentityForTest(t)
+	}
+	special := map[uint32][]byte{}
+	if signing.requirement != nil {
+		special[csSlotRequirements] = requirementSetForTest(signing.requirement)
+	}
+
+	// The load command locating the signature is part of the signed code;
+	// the signature size does not depend on the code it covers, so it is
+	// measured with the size field still zero
+	signature := func() []byte {
+		cd := codeDirectoryForTest(code, crypto.SHA256, special)
+		slots := []uint32{csSlotCodeDirectory}
+		blobs := [][]byte{cd}
+		var extra []testAttribute
+		if signing.alternate {
+			alt := codeDirectoryForTest(code, crypto.SHA384, special)
+			slots, blobs = append(slots, csSlotAlternateFirst), append(blobs, alt)
+			if !signing.unlisted {
+				extra = append(extra, cdHashesAttrForTest(t, cd, alt))
+			}
+		}
+		for slot, blob := range special {
+			slots, blobs = append(slots, slot), append(blobs, blob)
+		}
+		var cms []byte
+		if !signing.adHoc {
+			cms = signDetachedForTest(t, id, cd, extra...)
+		}
+		slots, blobs = append(slots, csSlotSignature), append(blobs, blobWrapperForTest(cms))
+		if signing.ticket {
+			slots, blobs = append(slots, csSlotTicket), append(blobs, ticketForTest(cdHashForTest(cd)))
+		}
+		return superBlobForTest(slots, blobs)
+	}
+	le.PutUint32(code[headerSize+12:], uint32(len(signature())))
+	return append(code, signature()...)
+}
+
+// cdHashesAttrForTest returns the hash agility attribute listing the full
+// SHA-256 and SHA-384 hashes of the code directories
+func cdHashesAttrForTest(t testing.TB, sha256CD, sha384CD []byte) testAttribute {
+	t.Helper()
+	type entry struct {
+		Algorithm asn1.ObjectIdentifier
+		Digest    []byte
+	}
+	h256 := sha256.Sum256(sha256CD)
+	h384 := crypto.SHA384.New()
+	h384.Write(sha384CD)
+	var values []byte
+	for _, e := range []entry{{oidDigestSHA256, h256[:]}, {oidDigestSHA384, h384.Sum(nil)}} {
+		der, err := asn1.Marshal(e)
+		if err != nil {
+			t.Fatalf("Failed to marshal hash agility entry: %v", err)
+		}
+		values = append(values, der...)
+	}
+	return testAttribute{Type: oidAttributeCDHashes2, Value: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: values}}
+}
+
+// requirementSetForTest returns a requirement set holding expr as the
+// designated requirement
+func requirementSetForTest(expr []byte) []byte {
+	req := binary.BigEndian.AppendUint32(nil, csMagicRequirement)
+	req = binary.BigEndian.AppendUint32(req, uint32(12+len(expr)))
+	req = binary.BigEndian.AppendUint32(req, csRequirementExpr)
+	req = append(req, expr...)
+
+	set := binary.BigEndian.AppendUint32(nil, csMagicRequirements)
+	set = binary.BigEndian.AppendUint32(set, uint32(20+len(req)))
+	set = binary.BigEndian.AppendUint32(set, 1)
+	set = binary.BigEndian.AppendUint32(set, csDesignatedReq)
+	set = binary.BigEndian.AppendUint32(set, 20)
+	return append(set, req...)
+}
+
+// blobWrapperForTest wraps a CMS signature in a blob wrapper
+func blobWrapperForTest(cms []byte) []byte {
+	blob := binary.BigEndian.AppendUint32(nil, csMagicBlobWrapper)
+	blob = binary.BigEndian.AppendUint32(blob, uint32(8+len(cms)))
+	return append(blob, cms...)
+}
+
+// fatForTest returns a universal binary holding each slice, 4 KiB aligned
+func fatForTest(cpus []macho.Cpu, slices [][]byte) []byte {
+	const align = 1 << 12
+	data := binary.BigEndian.AppendUint32(nil, fatMagic)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(slices)))
+	offset := align
+	for i, slice := range slices {
+		data = binary.BigEndian.AppendUint32(data, uint32(cpus[i]))
+		data = binary.BigEndian.AppendUint32(data, 0)
+		data = binary.BigEndian.AppendUint32(data, uint32(offset))
+		data = binary.BigEndian.AppendUint32(data, uint32(len(slice)))
+		data = binary.BigEndian.AppendUint32(data, 12)
+		offset += (len(slice) + align - 1) / align * align
+	}
+	for _, slice := range slices {
+		data = append(data, make([]byte, (len(data)+align-1)/align*align-len(data))...)
+		data = append(data, slice...)
+	}
+	return data
+}
+
+func TestVerify_MachO(t *testing.T) {
+	payload := bytes.Repeat([]byte("sigtool Mach-O test code "), 400)
+	filePath := writeScriptForTest(t, "hello", machoForTest(t, macho.CpuAmd64, payload, false))
+
+	if fileType, err := DetectFileType(filePath); err != nil || fileType != FileTypeMachO {
+		t.Fatalf("Expected %q, got %q (%v)", FileTypeMachO, fileType, err)
+	}
+	if err := Verify(filePath, &VerifyOptions{Roots: machoRootsForTest(t)}); err != nil {
+		t.Fatalf("Expected valid Mach-O binary, got %v", err)
+	}
+	slices, err := VerifyMachO(filePath, VerifyOptions{Roots: machoRootsForTest(t)})
+	if err != nil {
+		t.Fatalf("VerifyMachO failed: %v", err)
+	}
+	if len(slices) != 1 {
+		t.Fatalf("Expected one architecture, got %d", len(slices))
+	}
+	s := slices[0]
+	if s.Arch != "x86_64" || s.Identifier != "com.example.hello" || s.TeamID != "ABCDE12345" || s.HashAlgorithm != crypto.SHA256 || len(s.CDHash) != cdHashSize {
+		t.Errorf("Unexpected slice %+v", s)
+	}
+	if s.Signer == nil || s.Signer.CommonName != "Developer ID Application: sigtool test (ABCDE12345)" {
+		t.Errorf("Expected the test signer, got %+v", s.Signer)
+	}
+	info, err := Inspect(filePath)
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	if info.Signer.CommonName != s.Signer.CommonName {
+		t.Errorf("Expected the test signer, got %s", info.Signer.Subject)
+	}
+
+	tampered := machoForTest(t, macho.CpuAmd64, payload, false)
+	tampered[5000] ^= 1
+	filePath = writeScriptForTest(t, "hello", tampered)
+	err = Verify(filePath, nil)
+	if !errors.Is(err, ErrDigestMismatch) || !strings.Contains(err.Error(), "code page 1") {
+		t.Errorf("Expected ErrDigestMismatch for page 1, got %v", err)
+	}
+}
+
+func TestVerify_MachOAdHoc(t *testing.T) {
+	filePath := writeScriptForTest(t, "hello", machoForTest(t, macho.CpuArm64, []byte("ad-hoc code"), true))
+	if err := Verify(filePath, nil); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned for an ad-hoc signature, got %v", err)
+	}
+	slices, err := VerifyMachO(filePath, VerifyOptions{})
+	if err != nil {
+		t.Fatalf("VerifyMachO failed: %v", err)
+	}
+	if !slices[0].AdHoc || slices[0].Arch != "arm64" || len(slices[0].CDHash) != cdHashSize {
+		t.Errorf("Unexpected slice %+v", slices[0])
+	}
+}
+
+func TestVerifyMachO_Universal(t *testing.T) {
+	payload := bytes.Repeat([]byte{0x90}, 6000)
+	intel := machoForTest(t, macho.CpuAmd64, payload, false)
+	arm := machoForTest(t, macho.CpuArm64, payload, false)
+	filePath := writeScriptForTest(t, "hello", fatForTest([]macho.Cpu{macho.CpuAmd64, macho.CpuArm64}, [][]byte{intel, arm}))
+
+	if fileType, err := DetectFileType(filePath); err != nil || fileType != FileTypeMachO {
+		t.Fatalf("Expected %q, got %q (%v)", FileTypeMachO, fileType, err)
+	}
+	if err := Verify(filePath, &VerifyOptions{Roots: machoRootsForTest(t)}); err != nil {
+		t.Fatalf("Expected valid universal binary, got %v", err)
+	}
+
+	// A tampered slice fails on its own, leaving the other valid
+	arm[len(arm)/3] ^= 1
+	filePath = writeScriptForTest(t, "hello", fatForTest([]macho.Cpu{macho.CpuAmd64, macho.CpuArm64}, [][]byte{intel, arm}))
+	slices, err := VerifyMachO(filePath, VerifyOptions{Roots: machoRootsForTest(t)})
+	if err != nil {
+		t.Fatalf("VerifyMachO failed: %v", err)
+	}
+	if len(slices) != 2 || slices[0].Arch != "x86_64" || slices[1].Arch != "arm64" {
+		t.Fatalf("Unexpected slices %+v", slices)
+	}
+	if !slices[0].Valid() {
+		t.Errorf("Expected the x86_64 slice to be valid, got %v", slices[0].Err)
+	}
+	if !errors.Is(slices[1].Err, ErrDigestMismatch) || slices[1].Offset != 2*4096+int64(len(intel))/4096*4096 {
+		t.Errorf("Expected ErrDigestMismatch for the arm64 slice, got %v at %d", slices[1].Err, slices[1].Offset)
+	}
+	if err := Verify(filePath, nil); !errors.Is(err, ErrDigestMismatch) || !strings.HasPrefix(err.Error(), "arm64: ") {
+		t.Errorf("Expected the arm64 failure, got %v", err)
+	}
+}
+
+func TestIsMachO_JavaClass(t *testing.T) {
+	// Java class files share the universal binary magic, followed by their
+	// minor and major version
+	class := []byte{0xca, 0xfe, 0xba, 0xbe, 0x00, 0x00, 0x00, 0x41}
+	if isMachO(bytes.NewReader(class)) {
+		t.Error("Expected a Java class file not to be a Mach-O binary")
+	}
+}
+
+// developerIDRequirementForTest is the designated requirement codesign
+// generates for a Developer ID signature of com.example.hello
+func developerIDRequirementForTest() []byte {
+	return reqForTest(reqOpAnd,
+		reqForTest(reqOpIdent, reqDataForTest("com.example.hello")),
+		reqForTest(reqOpAnd,
+			reqForTest(reqOpAppleGenericAnchor),
+			reqForTest(reqOpAnd,
+				reqForTest(reqOpCertField, reqIntForTest(0), reqDataForTest("subject.OU"), reqIntForTest(reqMatchEqual), reqDataForTest("ABCDE12345")),
+				reqForTest(reqOpCertGeneric, reqIntForTest(1), reqDataForTest("\x2a\x86\x48\x86\xf7\x63\x64\x06\x02\x06"), reqIntForTest(reqMatchExists)))))
+}
+
+func TestVerify_MachORequirement(t *testing.T) {
+	binary := machoSignedForTest(t, macho.CpuArm64, []byte("requirement test code"), machoSigningForTest{requirement: developerIDRequirementForTest()})
+	filePath := writeScriptForTest(t, "hello", binary)
+
+	// The test root is not an Apple root, so "anchor apple generic" fails
+	if err := Verify(filePath, &VerifyOptions{Roots: machoRootsForTest(t)}); !errors.Is(err, ErrRequirementNotSatisfied) {
+		t.Errorf("Expected ErrRequirementNotSatisfied, got %v", err)
+	}
+	pinAppleRootForTest(t)
+	if err := Verify(filePath, &VerifyOptions{Roots: machoRootsForTest(t)}); err != nil {
+		t.Fatalf("Expected the designated requirement to be satisfied, got %v", err)
+	}
+
+	// The requirements are covered by their special slot
+	i := bytes.Index(binary, []byte{0xfa, 0xde, 0x0c, 0x00})
+	if i < 0 {
+		t.Fatal("Designated requirement not found")
+	}
+	tampered := append([]byte(nil), binary...)
+	// Turn the outermost and into an or
+	tampered[i+15] ^= 1
+	filePath = writeScriptForTest(t, "hello", tampered)
+	if err := Verify(filePath, nil); !errors.Is(err, ErrDigestMismatch) || !strings.Contains(err.Error(), "special slot 2") {
+		t.Errorf("Expected ErrDigestMismatch for special slot 2, got %v", err)
+	}
+}
+
+func TestVerify_MachOTeamID(t *testing.T) {
+	filePath := writeScriptForTest(t, "hello", machoForTest(t, macho.CpuAmd64, []byte("team code"), false))
+	if err := Verify(filePath, &VerifyOptions{RequiredTeamID: "ABCDE12345"}); err != nil {
+		t.Errorf("Expected the Team ID to match, got %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{RequiredTeamID: "ZYXWV98765"}); !errors.Is(err, ErrTeamIDMismatch) {
+		t.Errorf("Expected ErrTeamIDMismatch for another Team ID, got %v", err)
+	}
+
+	// A signer whose organizational unit is not the Team ID is rejected
+	cert, key := testSigner(t)
+	other := machoSignedForTest(t, macho.CpuAmd64, []byte("team code"), machoSigningForTest{signer: &testIdentity{Cert: cert, Key: key}})
+	filePath = writeScriptForTest(t, "hello", other)
+	if err := Verify(filePath, nil); !errors.Is(err, ErrTeamIDMismatch) {
+		t.Errorf("Expected ErrTeamIDMismatch for a signer of another team, got %v", err)
+	}
+}
+
+func TestVerify_MachOAlternateDirectory(t *testing.T) {
+	payload := bytes.Repeat([]byte("alternate"), 1000)
+	filePath := writeScriptForTest(t, "hello", machoSignedForTest(t, macho.CpuAmd64, payload, machoSigningForTest{alternate: true}))
+	if err := Verify(filePath, &VerifyOptions{Roots: machoRootsForTest(t)}); err != nil {
+		t.Fatalf("Expected valid signature with an alternate code directory, got %v", err)
+	}
+
+	filePath = writeScriptForTest(t, "hello", machoSignedForTest(t, macho.CpuAmd64, payload, machoSigningForTest{alternate: true, unlisted: true}))
+	if err := Verify(filePath, nil); err == nil || !strings.Contains(err.Error(), "alternate code directories") {
+		t.Errorf("Expected an error for an unlisted alternate code directory, got %v", err)
+	}
+}
+
+func TestParseCDHashesPlist(t *testing.T) {
+	plist := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>cdhashes</key>
+	<array>
+		<data>
+		AAECAwQFBgcICQoLDA0ODxAREhM=
+		</data>
+	</array>
+</dict>
+</plist>`)
+	hashes, err := parseCDHashesPlist(plist)
+	if err != nil {
+		t.Fatalf("parseCDHashesPlist failed: %v", err)
+	}
+	if len(hashes) != 1 || len(hashes[0]) != cdHashSize || hashes[0][19] != 19 {
+		t.Errorf("Unexpected hashes %x", hashes)
+	}
+	if _, err := parseCDHashesPlist([]byte("<plist><dict><key>other</key></dict></plist>")); err == nil {
+		t.Error("Expected an error for a property list without cdhashes")
+	}
+}
@@ -0,0 +1,143 @@
+package sigtool
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// knownVendor describes a software vendor commonly impersonated by malware
+type knownVendor struct {
+	// name is the display name of the vendor
+	name string
+	// company lists phrases that claim the vendor in a CompanyName
+	company []string
+	// signers lists phrases of the subjects the vendor signs with
+	signers []string
+}
+
+// knownVendors are the vendors whose names CheckCompanyName recognizes.
+// Signer phrases include the acquirers and subsidiaries that sign the
+// vendor's products.
+var knownVendors = []knownVendor{
+	{name: "Microsoft", company: []string{"microsoft"}, signers: []string{"microsoft"}},
+	{name: "Google", company: []string{"google"}, signers: []string{"google"}},
+	{name: "Apple", company: []string{"apple inc", "apple computer"}, signers: []string{"apple"}},
+	{name: "Adobe", company: []string{"adobe"}, signers: []string{"adobe"}},
+	{name: "Mozilla", company: []string{"mozilla"}, signers: []string{"mozilla"}},
+	{name: "Oracle", company: []string{"oracle", "sun microsystems"}, signers: []string{"oracle", "sun microsystems"}},
+	{name: "Intel", company: []string{"intel"}, signers: []string{"intel"}},
+	{name: "NVIDIA", company: []string{"nvidia"}, signers: []string{"nvidia"}},
+	{name: "AMD", company: []string{"advanced micro devices", "amd"}, signers: []string{"advanced micro devices", "amd"}},
+	{name: "Cisco", company: []string{"cisco"}, signers: []string{"cisco"}},
+	{name: "VMware", company: []string{"vmware"}, signers: []string{"vmware", "broadcom"}},
+	{name: "Symantec", company: []string{"symantec", "norton"}, signers: []string{"symantec", "norton", "nortonlifelock", "gen digital", "broadcom"}},
+	{name: "Kaspersky", company: []string{"kaspersky"}, signers: []string{"kaspersky"}},
+	{name: "ESET", company: []string{"eset"}, signers: []string{"eset"}},
+	{name: "CrowdStrike", company: []string{"crowdstrike"}, signers: []string{"crowdstrike"}},
+	{name: "Realtek", company: []string{"realtek"}, signers: []string{"realtek"}},
+	{name: "Dell", company: []string{"dell"}, signers: []string{"dell"}},
+	{name: "HP", company: []string{"hewlett packard", "hp inc"}, signers: []string{"hewlett packard", "hp inc", "hp"}},
+	{name: "Lenovo", company: []string{"lenovo"}, signers: []string{"lenovo"}},
+	{name: "Zoom", company: []string{"zoom video"}, signers: []string{"zoom video", "zoom communications"}},
+}
+
+// CompanyMismatch reports a binary whose VERSIONINFO claims a well-known
+// vendor that did not sign it.
+type CompanyMismatch struct {
+	// CompanyName is the CompanyName string of the VERSIONINFO resource
+	CompanyName string
+	// Vendor is the well-known vendor the company name claims
+	Vendor string
+	// Signer is the subject of the signer certificate
+	Signer string
+}
+
+func (m *CompanyMismatch) String() string {
+	return fmt.Sprintf("CompanyName %q claims %s but the signer is %q", m.CompanyName, m.Vendor, m.Signer)
+}
+
+// CheckCompanyName flags a PE file whose VERSIONINFO CompanyName claims a
+// well-known vendor while its signer is unrelated to that vendor.
+//
+// Malware commonly copies the version resource of the software it
+// impersonates but cannot sign with the vendor's certificate, so the
+// mismatch is a cheap masquerading indicator for triage. The comparison is
+// by name only: the signature is not verified, and vendors outside a short
+// built-in list are never flagged.
+//
+// Parameters:
+//   - filePath: The path to the signed PE file
+//
+// Returns:
+//   - *CompanyMismatch: The mismatch, or nil when the company name claims
+//     no known vendor, matches the signer or the file has no VERSIONINFO,
+//     as is the case for every format other than PE
+//   - error: An error if the file is not signed or cannot be parsed
+//
+// Example usage:
+//
+//	mismatch, err := sigtool.CheckCompanyName("svchost.exe")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	if mismatch != nil {
+//	    fmt.Println("possible masquerading:", mismatch)
+//	}
+func CheckCompanyName(filePath string) (*CompanyMismatch, error) {
+	if fileType, err := DetectFileType(filePath); err == nil && fileType != FileTypePE && fileType != FileTypeUnknown {
+		return nil, nil
+	}
+	vi, err := ReadVersionInfo(filePath)
+	if errors.Is(err, ErrNoVersionInfo) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	vendor := claimedVendor(vi.CompanyName)
+	if vendor == nil {
+		return nil, nil
+	}
+
+	info, err := Inspect(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if info.Signer == nil {
+		return nil, errors.New("signature has no embedded signer certificate")
+	}
+	subject := info.Signer.Certificate.Subject
+	names := append([]string{subject.CommonName}, subject.Organization...)
+	for _, name := range names {
+		if containsPhrase(name, vendor.signers) {
+			return nil, nil
+		}
+	}
+	return &CompanyMismatch{CompanyName: vi.CompanyName, Vendor: vendor.name, Signer: info.Signer.Subject}, nil
+}
+
+// claimedVendor returns the known vendor company claims, or nil
+func claimedVendor(company string) *knownVendor {
+	for i := range knownVendors {
+		if containsPhrase(company, knownVendors[i].company) {
+			return &knownVendors[i]
+		}
+	}
+	return nil
+}
+
+// containsPhrase reports whether s contains one of phrases as whole words,
+// ignoring case and punctuation
+func containsPhrase(s string, phrases []string) bool {
+	words := " " + strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ") + " "
+	for _, phrase := range phrases {
+		if strings.Contains(words, " "+phrase+" ") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,190 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+)
+
+// Streams of the root storage of a signed Windows Installer package. The
+// \x05 prefix marks streams that are not part of the installer database.
+const (
+	msiSignatureStream   = "\x05DigitalSignature"
+	msiSignatureExStream = "\x05MsiDigitalSignatureEx"
+)
+
+// readMSISignature returns the PKCS#7 signature held in the
+// \x05DigitalSignature stream of the Windows Installer package r
+func readMSISignature(r io.ReaderAt, size int64) ([]byte, error) {
+	cf, err := openCompoundFile(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return msiSignature(cf)
+}
+
+// msiSignature returns the signature stream of cf
+func msiSignature(cf *compoundFile) ([]byte, error) {
+	entry, err := cf.findChild(0, msiSignatureStream)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil || entry.objectType != cfbStream {
+		return nil, fmt.Errorf("%w (Windows Installer package has no DigitalSignature stream)", ErrNotSigned)
+	}
+	if entry.size > MaxSignatureSize {
+		return nil, &SignatureSizeError{Size: int64(entry.size), Limit: MaxSignatureSize}
+	}
+	return cf.readStream(entry)
+}
+
+// verifyMSI performs full Authenticode verification of the Windows
+// Installer package in r: unless disabled, the digest of its streams, and of
+// its directory metadata when it has an MsiDigitalSignatureEx stream, must
+// match the signature; the signer signature and chain are checked per opts.
+func verifyMSI(r io.ReaderAt, size int64, opts VerifyOptions) error {
+	cf, err := openCompoundFile(r, size)
+	if err != nil {
+		return fmt.Errorf("failed to extract signature: %w", err)
+	}
+	signature, err := msiSignature(cf)
+	if err != nil {
+		return fmt.Errorf("failed to extract signature: %w", err)
+	}
+	opts.logger().Debug("read Windows Installer signature", "fileSize", size, "size", len(signature))
+
+	return verifySignatureDigest(signature, opts, func(algorithm crypto.Hash) ([]byte, error) {
+		return msiDigest(cf, algorithm)
+	})
+}
+
+// msiDigest computes the Authenticode digest of a Windows Installer package:
+// the contents of every stream, storage by storage in name order, each
+// storage followed by its CLSID, leaving out the signature streams. When the
+// package has an MsiDigitalSignatureEx stream, which must then match, the
+// digest of the directory metadata is hashed first.
+func msiDigest(cf *compoundFile, algorithm crypto.Hash) ([]byte, error) {
+	if !algorithm.Available() {
+		return nil, fmt.Errorf("hash algorithm %v is not available", algorithm)
+	}
+
+	h := algorithm.New()
+	ex, err := cf.findChild(0, msiSignatureExStream)
+	if err != nil {
+		return nil, err
+	}
+	if ex != nil {
+		stored, err := cf.readStream(ex)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read MsiDigitalSignatureEx: %w", err)
+		}
+		meta := algorithm.New()
+		if err := cf.hashMetadata(&cf.entries[0], meta, true); err != nil {
+			return nil, err
+		}
+		prehash := meta.Sum(nil)
+		if !bytes.Equal(stored, prehash) {
+			return nil, fmt.Errorf("%w: stored %x, computed %x", ErrMSIMetadataMismatch, stored, prehash)
+		}
+		h.Write(prehash)
+	}
+	if err := cf.hashContents(&cf.entries[0], h, true); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// sortedChildren returns the entries of storage in the order the Windows
+// Installer digest visits them: by UTF-16LE name bytes, shorter names first
+// on a tie, leaving out the signature streams of the root storage
+func (cf *compoundFile) sortedChildren(storage *cfbEntry, root bool) ([]*cfbEntry, error) {
+	children, err := cf.children(storage.id)
+	if err != nil {
+		return nil, err
+	}
+	kept := children[:0]
+	for _, e := range children {
+		if root && (e.name == msiSignatureStream || e.name == msiSignatureExStream) {
+			continue
+		}
+		kept = append(kept, e)
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		a, b := kept[i].rawName, kept[j].rawName
+		n := min(len(a), len(b))
+		if c := bytes.Compare(a[:n], b[:n]); c != 0 {
+			return c < 0
+		}
+		return len(a) < len(b)
+	})
+	return kept, nil
+}
+
+// hashContents writes to h the stream contents of storage and its
+// substorages, followed by the CLSID of storage
+func (cf *compoundFile) hashContents(storage *cfbEntry, h hash.Hash, root bool) error {
+	children, err := cf.sortedChildren(storage, root)
+	if err != nil {
+		return err
+	}
+	for _, e := range children {
+		switch e.objectType {
+		case cfbStream:
+			data, err := cf.readStream(e)
+			if err != nil {
+				return fmt.Errorf("failed to hash stream %q: %w", e.name, err)
+			}
+			h.Write(data)
+		case cfbStorage:
+			if err := cf.hashContents(e, h, false); err != nil {
+				return err
+			}
+		}
+	}
+	h.Write(storage.clsid[:])
+	return nil
+}
+
+// hashMetadata writes to h the directory metadata MsiDigitalSignatureEx
+// covers: for storage and then each of its entries in digest order, the
+// name (except for the root), the CLSID of storages or the low 32 bits of
+// the size of streams, the state bits and, except for the root, the
+// creation and modification times
+func (cf *compoundFile) hashMetadata(storage *cfbEntry, h hash.Hash, root bool) error {
+	writeEntryMetadata(storage, h)
+	children, err := cf.sortedChildren(storage, root)
+	if err != nil {
+		return err
+	}
+	for _, e := range children {
+		switch e.objectType {
+		case cfbStream:
+			writeEntryMetadata(e, h)
+		case cfbStorage:
+			if err := cf.hashMetadata(e, h, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeEntryMetadata writes the metadata of one directory entry to h
+func writeEntryMetadata(e *cfbEntry, h hash.Hash) {
+	if e.objectType != cfbRoot && len(e.rawName) >= 2 {
+		h.Write(e.rawName[:len(e.rawName)-2])
+	}
+	if e.objectType == cfbStream {
+		h.Write([]byte{byte(e.size), byte(e.size >> 8), byte(e.size >> 16), byte(e.size >> 24)})
+	} else {
+		h.Write(e.clsid[:])
+	}
+	h.Write(e.stateBits[:])
+	if e.objectType != cfbRoot {
+		h.Write(e.created[:])
+		h.Write(e.modified[:])
+	}
+}
@@ -0,0 +1,311 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+)
+
+// cfbEntryForTest is a directory entry of a compound file built by
+// compoundFileForTest
+type cfbEntryForTest struct {
+	name       string
+	objectType byte
+	data       []byte
+	child      uint32
+	right      uint32
+	clsid      byte
+	timestamp  byte
+}
+
+// compoundFileForTest builds a version 3 compound file with entries, the
+// first of which is the root; streams under 4096 bytes go to the mini stream
+func compoundFileForTest(entries []cfbEntryForTest) []byte {
+	const sectorSize = 512
+	var sectors [][]byte
+	fat := []uint32{0xfffffffd}
+	sectors = append(sectors, nil)
+	alloc := func(data []byte) uint32 {
+		if len(data) == 0 {
+			return cfbEndOfChain
+		}
+		start := uint32(len(sectors))
+		for offset := 0; offset < len(data); offset += sectorSize {
+			sector := make([]byte, sectorSize)
+			copy(sector, data[offset:])
+			sectors = append(sectors, sector)
+			fat = append(fat, uint32(len(sectors)))
+		}
+		fat[len(fat)-1] = cfbEndOfChain
+		return start
+	}
+
+	starts := make([]uint32, len(entries))
+	var mini []byte
+	var miniFAT []byte
+	for i, e := range entries {
+		if i == 0 || e.objectType != cfbStream || len(e.data) >= 4096 {
+			continue
+		}
+		starts[i] = uint32(len(mini) / 64)
+		for offset := 0; offset < len(e.data); offset += 64 {
+			chunk := make([]byte, 64)
+			copy(chunk, e.data[offset:])
+			mini = append(mini, chunk...)
+			next := uint32(len(mini) / 64)
+			if offset+64 >= len(e.data) {
+				next = cfbEndOfChain
+			}
+			miniFAT = binary.LittleEndian.AppendUint32(miniFAT, next)
+		}
+	}
+	starts[0] = alloc(mini)
+	miniFATStart := alloc(miniFAT)
+	for i, e := range entries {
+		if i > 0 && e.objectType == cfbStream && len(e.data) >= 4096 {
+			starts[i] = alloc(e.data)
+		}
+	}
+
+	var dir []byte
+	for i, e := range entries {
+		entry := make([]byte, cfbEntrySize)
+		units := append(utf16.Encode([]rune(e.name)), 0)
+		for j, u := range units {
+			binary.LittleEndian.PutUint16(entry[2*j:], u)
+		}
+		binary.LittleEndian.PutUint16(entry[64:], uint16(2*len(units)))
+		entry[66] = e.objectType
+		entry[67] = 1
+		binary.LittleEndian.PutUint32(entry[68:], cfbNoStream)
+		binary.LittleEndian.PutUint32(entry[72:], e.right)
+		binary.LittleEndian.PutUint32(entry[76:], e.child)
+		if e.objectType != cfbStream {
+			copy(entry[80:96], bytes.Repeat([]byte{e.clsid}, 16))
+		}
+		if e.objectType != cfbRoot {
+			copy(entry[100:116], bytes.Repeat([]byte{e.timestamp}, 16))
+		}
+		size := len(e.data)
+		if i == 0 {
+			size = len(mini)
+		}
+		binary.LittleEndian.PutUint32(entry[116:], starts[i])
+		binary.LittleEndian.PutUint64(entry[120:], uint64(size))
+		dir = append(dir, entry...)
+	}
+	dirStart := alloc(dir)
+
+	fatSector := make([]byte, sectorSize)
+	for i := range fatSector[:sectorSize/4] {
+		value := uint32(cfbFreeSector)
+		if i < len(fat) {
+			value = fat[i]
+		}
+		binary.LittleEndian.PutUint32(fatSector[4*i:], value)
+	}
+	sectors[0] = fatSector
+
+	header := make([]byte, cfbHeaderSize)
+	copy(header, compoundFileMagic)
+	binary.LittleEndian.PutUint16(header[24:], 0x3e)
+	binary.LittleEndian.PutUint16(header[26:], 3)
+	binary.LittleEndian.PutUint16(header[28:], 0xfffe)
+	binary.LittleEndian.PutUint16(header[30:], 9)
+	binary.LittleEndian.PutUint16(header[32:], 6)
+	binary.LittleEndian.PutUint32(header[44:], 1)
+	binary.LittleEndian.PutUint32(header[48:], dirStart)
+	binary.LittleEndian.PutUint32(header[56:], 4096)
+	binary.LittleEndian.PutUint32(header[60:], miniFATStart)
+	binary.LittleEndian.PutUint32(header[64:], 1)
+	binary.LittleEndian.PutUint32(header[68:], cfbEndOfChain)
+	for i := 0; i < cfbHeaderDIFATs; i++ {
+		binary.LittleEndian.PutUint32(header[76+4*i:], cfbFreeSector)
+	}
+	binary.LittleEndian.PutUint32(header[76:], 0)
+
+	out := header
+	for _, sector := range sectors {
+		out = append(out, sector...)
+	}
+	return out
+}
+
+// msiEntriesForTest returns the entries of a test installer package: in
+// tree order Zeta, A, S (a storage holding C) and AB, then the signature
+// streams when signature or ex is set
+func msiEntriesForTest(signature, ex []byte) []cfbEntryForTest {
+	entries := []cfbEntryForTest{
+		{name: "Root Entry", objectType: cfbRoot, child: 1, right: cfbNoStream, clsid: 0xaa},
+		{name: "Zeta", objectType: cfbStream, data: bytes.Repeat([]byte("z"), 100), child: cfbNoStream, right: 2, timestamp: 0x01},
+		{name: "A", objectType: cfbStream, data: bytes.Repeat([]byte("a"), 5000), child: cfbNoStream, right: 3},
+		{name: "S", objectType: cfbStorage, child: 4, right: 5, clsid: 0xbb, timestamp: 0x11},
+		{name: "C", objectType: cfbStream, data: []byte("storage stream"), child: cfbNoStream, right: cfbNoStream},
+		{name: "AB", objectType: cfbStream, data: bytes.Repeat([]byte("b"), 70), child: cfbNoStream, right: cfbNoStream},
+	}
+	if signature != nil {
+		entries[5].right = 6
+		entries = append(entries, cfbEntryForTest{name: msiSignatureStream, objectType: cfbStream, data: signature, child: cfbNoStream, right: cfbNoStream})
+	}
+	if ex != nil {
+		entries[len(entries)-1].right = uint32(len(entries))
+		entries = append(entries, cfbEntryForTest{name: msiSignatureExStream, objectType: cfbStream, data: ex, child: cfbNoStream, right: cfbNoStream})
+	}
+	return entries
+}
+
+// msiContentsForTest returns the stream contents of msiEntriesForTest in
+// digest order: A, AB, the S storage and Zeta, each storage closed by its
+// CLSID
+func msiContentsForTest() []byte {
+	var b []byte
+	b = append(b, bytes.Repeat([]byte("a"), 5000)...)
+	b = append(b, bytes.Repeat([]byte("b"), 70)...)
+	b = append(b, "storage stream"...)
+	b = append(b, bytes.Repeat([]byte{0xbb}, 16)...)
+	b = append(b, bytes.Repeat([]byte("z"), 100)...)
+	return append(b, bytes.Repeat([]byte{0xaa}, 16)...)
+}
+
+// msiMetadataForTest returns the directory metadata of msiEntriesForTest
+// that MsiDigitalSignatureEx covers
+func msiMetadataForTest() []byte {
+	stream := func(name string, size uint32, timestamp byte) []byte {
+		var b []byte
+		for _, u := range utf16.Encode([]rune(name)) {
+			b = binary.LittleEndian.AppendUint16(b, u)
+		}
+		b = binary.LittleEndian.AppendUint32(b, size)
+		b = append(b, 0, 0, 0, 0)
+		return append(b, bytes.Repeat([]byte{timestamp}, 16)...)
+	}
+	b := append(bytes.Repeat([]byte{0xaa}, 16), 0, 0, 0, 0)
+	b = append(b, stream("A", 5000, 0)...)
+	b = append(b, stream("AB", 70, 0)...)
+	b = append(b, 'S', 0)
+	b = append(b, bytes.Repeat([]byte{0xbb}, 16)...)
+	b = append(b, 0, 0, 0, 0)
+	b = append(b, bytes.Repeat([]byte{0x11}, 16)...)
+	b = append(b, stream("C", 14, 0)...)
+	return append(b, stream("Zeta", 100, 0x01)...)
+}
+
+// writeSignedMSIForTest writes a signed test installer package, with an
+// MsiDigitalSignatureEx stream when withEx is set
+func writeSignedMSIForTest(t *testing.T, withEx bool) string {
+	t.Helper()
+	h := crypto.SHA256.New()
+	var ex []byte
+	if withEx {
+		ex = digestForTest(crypto.SHA256, msiMetadataForTest())
+		h.Write(ex)
+	}
+	h.Write(msiContentsForTest())
+	signature := signAuthenticodeForTest(t, h.Sum(nil), crypto.SHA256)
+
+	filePath := filepath.Join(t.TempDir(), "setup.msi")
+	if err := os.WriteFile(filePath, compoundFileForTest(msiEntriesForTest(signature, ex)), 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	return filePath
+}
+
+// digestForTest returns the digest of data
+func digestForTest(algorithm crypto.Hash, data []byte) []byte {
+	h := algorithm.New()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func TestVerify_MSI(t *testing.T) {
+	for _, withEx := range []bool{false, true} {
+		filePath := writeSignedMSIForTest(t, withEx)
+
+		if fileType, err := DetectFileType(filePath); err != nil || fileType != FileTypeMSI {
+			t.Errorf("Expected FileTypeMSI, got %q (error %v)", fileType, err)
+		}
+		if err := Verify(filePath, nil); err != nil {
+			t.Errorf("Ex %v: expected a valid signature, got: %v", withEx, err)
+		}
+		signature, err := ExtractDigitalSignature(filePath)
+		if err != nil || len(signature) == 0 {
+			t.Errorf("Ex %v: expected the DigitalSignature stream, got %d bytes (error %v)", withEx, len(signature), err)
+		}
+		info, err := Inspect(filePath)
+		if err != nil || info.Signer == nil {
+			t.Errorf("Ex %v: expected the signer to be inspected, got %+v (error %v)", withEx, info, err)
+		}
+	}
+}
+
+func TestVerify_MSITampered(t *testing.T) {
+	filePath := writeSignedMSIForTest(t, false)
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	// Change one byte of the large stream A
+	i := bytes.Index(content, bytes.Repeat([]byte("a"), 512))
+	content[i] = 'x'
+	if err := os.WriteFile(filePath, content, 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	var mismatch *DigestMismatchError
+	if err := Verify(filePath, nil); !errors.Is(err, ErrDigestMismatch) || !errors.As(err, &mismatch) {
+		t.Errorf("Expected ErrDigestMismatch, got: %v", err)
+	}
+}
+
+func TestVerify_MSIMetadataMismatch(t *testing.T) {
+	// A signature whose MsiDigitalSignatureEx stream covers other metadata
+	h := crypto.SHA256.New()
+	ex := digestForTest(crypto.SHA256, []byte("other metadata"))
+	h.Write(ex)
+	h.Write(msiContentsForTest())
+	signature := signAuthenticodeForTest(t, h.Sum(nil), crypto.SHA256)
+	filePath := filepath.Join(t.TempDir(), "setup.msi")
+	if err := os.WriteFile(filePath, compoundFileForTest(msiEntriesForTest(signature, ex)), 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	if err := Verify(filePath, nil); !errors.Is(err, ErrMSIMetadataMismatch) {
+		t.Errorf("Expected ErrMSIMetadataMismatch, got: %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{SkipContentDigest: true}); err != nil {
+		t.Errorf("Expected the signature itself to verify, got: %v", err)
+	}
+}
+
+func TestVerify_MSIUnsigned(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "setup.msi")
+	if err := os.WriteFile(filePath, compoundFileForTest(msiEntriesForTest(nil, nil)), 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	if err := Verify(filePath, nil); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned, got: %v", err)
+	}
+	if _, err := ExtractDigitalSignature(filePath); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned from extraction, got: %v", err)
+	}
+}
+
+func TestVerify_MSIMalformed(t *testing.T) {
+	content := compoundFileForTest(msiEntriesForTest(nil, nil))
+	// Point the directory outside the file
+	binary.LittleEndian.PutUint32(content[48:], 0x1000)
+	filePath := filepath.Join(t.TempDir(), "broken.msi")
+	if err := os.WriteFile(filePath, content, 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	if err := Verify(filePath, nil); !errors.Is(err, ErrNotCompoundFile) {
+		t.Errorf("Expected ErrNotCompoundFile, got: %v", err)
+	}
+}
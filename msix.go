@@ -0,0 +1,402 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+// Members of an MSIX or APPX package that the package signature covers
+// apart from the block map
+const (
+	msixSignatureFile      = "AppxSignature.p7x"
+	msixBlockMapFile       = "AppxBlockMap.xml"
+	msixContentTypesFile   = "[Content_Types].xml"
+	msixCodeIntegrityFile  = "AppxMetadata/CodeIntegrity.cat"
+	msixManifestFile       = "AppxManifest.xml"
+	msixBundleManifestFile = "AppxMetadata/AppxBundleManifest.xml"
+	// msixBlockSize is the size of the blocks of uncompressed data the
+	// block map hashes
+	msixBlockSize = 64 << 10
+)
+
+var (
+	// msixSignatureMagic precedes the PKCS#7 signature in AppxSignature.p7x
+	msixSignatureMagic = []byte("PKCX")
+	// msixDigestMagic starts the signed digest of a package, which is a
+	// sequence of tagged digests of its parts
+	msixDigestMagic = []byte("APPX")
+)
+
+// blockMapHashes maps the HashMethod URIs of block maps to hash algorithms
+var blockMapHashes = map[string]crypto.Hash{
+	"http://www.w3.org/2001/04/xmlenc#sha256":       crypto.SHA256,
+	"http://www.w3.org/2001/04/xmldsig-more#sha384": crypto.SHA384,
+	"http://www.w3.org/2001/04/xmlenc#sha512":       crypto.SHA512,
+}
+
+// publisherIDAlphabet is the base32 alphabet of package publisher IDs,
+// without the letters i, l, o and u
+const publisherIDAlphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+
+// PackageIdentity is the identity an MSIX or APPX package or bundle
+// declares in its manifest. Windows installs a package only when Publisher
+// matches the subject of its signer certificate.
+type PackageIdentity struct {
+	// Name is the package name, such as Microsoft.WindowsCalculator
+	Name string
+	// Publisher is the distinguished name of the publisher
+	Publisher string
+	// Version is the four-part package version
+	Version string
+	// ProcessorArchitecture is x86, x64, arm, arm64 or neutral; it is empty
+	// for bundles
+	ProcessorArchitecture string `json:",omitempty"`
+	// PublisherID is the 13-character hash of Publisher that names the
+	// package family and its data folders
+	PublisherID string
+	// FamilyName is the package family name, Name_PublisherID, that
+	// Windows tracks installations and app data by
+	FamilyName string
+	// Bundle reports an MSIX or APPX bundle of packages
+	Bundle bool
+}
+
+// appxManifest is the part of a package or bundle manifest that
+// ReadPackageIdentity reads
+type appxManifest struct {
+	Identity struct {
+		Name                  string `xml:"Name,attr"`
+		Publisher             string `xml:"Publisher,attr"`
+		Version               string `xml:"Version,attr"`
+		ProcessorArchitecture string `xml:"ProcessorArchitecture,attr"`
+	} `xml:"Identity"`
+}
+
+// appxBlockMap is a package block map, which lists the digest of each
+// 64 KiB block of every payload file
+type appxBlockMap struct {
+	HashMethod string `xml:"HashMethod,attr"`
+	Files      []struct {
+		Name   string `xml:"Name,attr"`
+		Size   uint64 `xml:"Size,attr"`
+		Blocks []struct {
+			Hash string `xml:"Hash,attr"`
+		} `xml:"Block"`
+	} `xml:"File"`
+}
+
+// ReadPackageIdentity reads the identity of an MSIX or APPX package or
+// bundle from its manifest and derives the publisher ID and package family
+// name Windows would register it under. The signature is not verified; use
+// Verify, which also checks the publisher against the signer.
+//
+// Parameters:
+//   - filePath: The path to the .msix, .appx, .msixbundle or .appxbundle file
+//
+// Returns:
+//   - *PackageIdentity: The identity from the manifest
+//   - error: ErrNotZipArchive if the file is not a ZIP archive, or an error
+//     if it has no manifest or the manifest cannot be parsed
+//
+// Example usage:
+//
+//	identity, err := sigtool.ReadPackageIdentity("app.msix")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	fmt.Println(identity.FamilyName, identity.Publisher)
+func ReadPackageIdentity(filePath string) (*PackageIdentity, error) {
+	if strings.TrimSpace(filePath) == "" {
+		return nil, errors.New("file path cannot be empty")
+	}
+
+	// #nosec G304 - This tool is designed to read user-specified files
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %q: %w", filePath, err)
+	}
+	defer f.Close()
+
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+	a, err := openZipArchive(f, fileInfo.Size())
+	if err != nil {
+		return nil, err
+	}
+	return readPackageIdentity(a)
+}
+
+// readPackageIdentity parses the package or bundle manifest of a
+func readPackageIdentity(a *zipArchive) (*PackageIdentity, error) {
+	identity := &PackageIdentity{}
+	data, err := a.readFile(msixManifestFile)
+	if err == nil && data == nil {
+		identity.Bundle = true
+		data, err = a.readFile(msixBundleManifestFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("package has no %s or %s", msixManifestFile, msixBundleManifestFile)
+	}
+	var manifest appxManifest
+	if err := xml.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse package manifest: %w", err)
+	}
+	if manifest.Identity.Name == "" || manifest.Identity.Publisher == "" {
+		return nil, errors.New("package manifest has no Identity name and publisher")
+	}
+	identity.Name = manifest.Identity.Name
+	identity.Publisher = manifest.Identity.Publisher
+	identity.Version = manifest.Identity.Version
+	identity.ProcessorArchitecture = manifest.Identity.ProcessorArchitecture
+	identity.PublisherID = publisherID(identity.Publisher)
+	identity.FamilyName = identity.Name + "_" + identity.PublisherID
+	return identity, nil
+}
+
+// publisherID returns the publisher ID of publisher: the first 64 bits of
+// the SHA-256 digest of its UTF-16LE encoding, padded with a zero bit and
+// written as 13 base32 characters
+func publisherID(publisher string) string {
+	units := utf16.Encode([]rune(publisher))
+	encoded := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(encoded[2*i:], u)
+	}
+	sum := sha256.Sum256(encoded)
+	bits := binary.BigEndian.Uint64(sum[:8])
+
+	id := make([]byte, 13)
+	for i := 0; i < 12; i++ {
+		id[i] = publisherIDAlphabet[bits>>(59-5*i)&31]
+	}
+	id[12] = publisherIDAlphabet[bits&15<<1]
+	return string(id)
+}
+
+// isMSIXPackage reports whether the ZIP archive a is an MSIX or APPX package
+// or bundle, which always has a block map
+func isMSIXPackage(a *zipArchive) bool {
+	return a.entry(msixBlockMapFile) != nil
+}
+
+// readMSIXSignature returns the PKCS#7 signature of the MSIX or APPX
+// package r
+func readMSIXSignature(r io.ReaderAt, size int64) ([]byte, error) {
+	a, err := openZipArchive(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return msixSignature(a)
+}
+
+// msixSignature returns the signature of a from AppxSignature.p7x, without
+// its PKCX prefix
+func msixSignature(a *zipArchive) ([]byte, error) {
+	data, err := a.readFile(msixSignatureFile)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("%w (package has no %s)", ErrNotSigned, msixSignatureFile)
+	}
+	if !bytes.HasPrefix(data, msixSignatureMagic) {
+		return nil, fmt.Errorf("%s does not start with the PKCX signature", msixSignatureFile)
+	}
+	if len(data)-len(msixSignatureMagic) > MaxSignatureSize {
+		return nil, &SignatureSizeError{Size: int64(len(data) - len(msixSignatureMagic)), Limit: MaxSignatureSize}
+	}
+	return data[len(msixSignatureMagic):], nil
+}
+
+// verifyMSIX performs full verification of the MSIX or APPX package in r:
+// unless disabled, the digests of its ZIP records, content types, block map
+// and code integrity catalog must match the signature and the payload must
+// match the block map; the signer signature and chain are checked per opts,
+// and the publisher in the manifest must be the signer.
+func verifyMSIX(r io.ReaderAt, size int64, opts VerifyOptions) error {
+	a, err := openZipArchive(r, size)
+	if err != nil {
+		return fmt.Errorf("failed to extract signature: %w", err)
+	}
+	signature, err := msixSignature(a)
+	if err != nil {
+		return fmt.Errorf("failed to extract signature: %w", err)
+	}
+	opts.logger().Debug("read package signature", "fileSize", size, "size", len(signature))
+
+	err = verifySignatureDigest(signature, opts, func(algorithm crypto.Hash) ([]byte, error) {
+		return msixDigest(a, algorithm)
+	})
+	if err != nil {
+		return err
+	}
+	if !opts.SkipContentDigest {
+		if err := verifyBlockMap(a); err != nil {
+			return err
+		}
+	}
+
+	identity, err := readPackageIdentity(a)
+	if err != nil {
+		return err
+	}
+	p7, err := parsePKCS7(signature)
+	if err != nil {
+		return fmt.Errorf("failed to parse PKCS#7 signature: %w", err)
+	}
+	signer, err := signerCertificate(p7)
+	if err != nil {
+		return err
+	}
+	if !MatchSignerName(signer, identity.Publisher) {
+		return fmt.Errorf("%w: manifest publisher %q, signer %q", ErrPublisherMismatch, identity.Publisher, signer.Subject.String())
+	}
+	return nil
+}
+
+// msixDigest computes the signed digest of an MSIX or APPX package: APPX
+// followed by the tagged digests of the ZIP local records (AXPC), of the
+// central directory and end records (AXCD), both as they would be without
+// AppxSignature.p7x, of [Content_Types].xml (AXCT), of the block map (AXBM)
+// and, when present, of the code integrity catalog (AXCI)
+func msixDigest(a *zipArchive, algorithm crypto.Hash) ([]byte, error) {
+	if !algorithm.Available() {
+		return nil, fmt.Errorf("hash algorithm %v is not available", algorithm)
+	}
+
+	digest := append([]byte(nil), msixDigestMagic...)
+	records, directory := algorithm.New(), algorithm.New()
+	if err := a.writeWithout(msixSignatureFile, records, directory); err != nil {
+		return nil, err
+	}
+	digest = records.Sum(append(digest, "AXPC"...))
+	digest = directory.Sum(append(digest, "AXCD"...))
+
+	for _, part := range []struct {
+		tag, name string
+		optional  bool
+	}{
+		{"AXCT", msixContentTypesFile, false},
+		{"AXBM", msixBlockMapFile, false},
+		{"AXCI", msixCodeIntegrityFile, true},
+	} {
+		data, err := a.readFile(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			if part.optional {
+				continue
+			}
+			return nil, fmt.Errorf("%w: package has no %s", ErrNotZipArchive, part.name)
+		}
+		h := algorithm.New()
+		h.Write(data)
+		digest = h.Sum(append(digest, part.tag...))
+	}
+	return digest, nil
+}
+
+// verifyBlockMap checks every payload file of a against the block map: its
+// size and the digest of each 64 KiB block of its uncompressed data must
+// match, and every member other than the signature, block map, content
+// types and code integrity catalog must be listed
+func verifyBlockMap(a *zipArchive) error {
+	data, err := a.readFile(msixBlockMapFile)
+	if err != nil {
+		return err
+	}
+	var blockMap appxBlockMap
+	if err := xml.Unmarshal(data, &blockMap); err != nil {
+		return fmt.Errorf("failed to parse block map: %w", err)
+	}
+	algorithm, ok := blockMapHashes[blockMap.HashMethod]
+	if !ok {
+		return fmt.Errorf("%w: unsupported hash method %q", ErrBlockMapMismatch, blockMap.HashMethod)
+	}
+
+	// Member names are percent-encoded part names; the block map uses
+	// backslash-separated file names
+	members := make(map[string]int, len(a.reader.File))
+	for i, f := range a.reader.File {
+		name, err := url.PathUnescape(f.Name)
+		if err != nil {
+			name = f.Name
+		}
+		members[name] = i
+	}
+	listed := map[string]bool{
+		msixSignatureFile:     true,
+		msixBlockMapFile:      true,
+		msixContentTypesFile:  true,
+		msixCodeIntegrityFile: true,
+	}
+	for _, file := range blockMap.Files {
+		name := strings.ReplaceAll(file.Name, `\`, "/")
+		i, ok := members[name]
+		if !ok {
+			return fmt.Errorf("%w: %s is not in the package", ErrBlockMapMismatch, file.Name)
+		}
+		listed[name] = true
+		f := a.reader.File[i]
+		if f.UncompressedSize64 != file.Size {
+			return fmt.Errorf("%w: %s is %d bytes, the block map lists %d", ErrBlockMapMismatch, file.Name, f.UncompressedSize64, file.Size)
+		}
+		if want := (file.Size + msixBlockSize - 1) / msixBlockSize; uint64(len(file.Blocks)) != want {
+			return fmt.Errorf("%w: %s has %d blocks, the block map lists %d", ErrBlockMapMismatch, file.Name, want, len(file.Blocks))
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", f.Name, err)
+		}
+		block := make([]byte, msixBlockSize)
+		for j, b := range file.Blocks {
+			n, err := io.ReadFull(rc, block)
+			if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+				rc.Close()
+				return fmt.Errorf("failed to read %s: %w", f.Name, err)
+			}
+			want, err := base64.StdEncoding.DecodeString(b.Hash)
+			if err != nil {
+				rc.Close()
+				return fmt.Errorf("%w: bad hash of block %d of %s", ErrBlockMapMismatch, j, file.Name)
+			}
+			h := algorithm.New()
+			h.Write(block[:n])
+			if subtle.ConstantTimeCompare(h.Sum(nil), want) != 1 {
+				rc.Close()
+				return fmt.Errorf("%w: block %d of %s does not match", ErrBlockMapMismatch, j, file.Name)
+			}
+		}
+		rc.Close()
+	}
+
+	for _, f := range a.reader.File {
+		name, err := url.PathUnescape(f.Name)
+		if err != nil {
+			name = f.Name
+		}
+		if !listed[name] && !strings.HasSuffix(name, "/") {
+			return fmt.Errorf("%w: %s is not in the block map", ErrBlockMapMismatch, name)
+		}
+	}
+	return nil
+}
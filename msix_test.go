@@ -0,0 +1,270 @@
+package sigtool
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// zipMemberForTest is a member of an archive built by zipForTest
+type zipMemberForTest struct {
+	name string
+	data []byte
+}
+
+// zipForTest builds a ZIP archive of members, deflating each, with fixed
+// timestamps so that the same members always give the same bytes
+func zipForTest(t *testing.T, members []zipMemberForTest) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, m := range members {
+		f, err := w.CreateHeader(&zip.FileHeader{Name: m.name, Method: zip.Deflate, Modified: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)})
+		if err != nil {
+			t.Fatalf("Failed to create %s: %v", m.name, err)
+		}
+		if _, err := f.Write(m.data); err != nil {
+			t.Fatalf("Failed to write %s: %v", m.name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to write archive: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// blockMapForTest returns the block map of the payload members
+func blockMapForTest(members []zipMemberForTest) []byte {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<BlockMap xmlns="http://schemas.microsoft.com/appx/2010/blockmap" HashMethod="http://www.w3.org/2001/04/xmlenc#sha256">`)
+	for _, m := range members {
+		fmt.Fprintf(&b, `<File Name="%s" Size="%d" LfhSize="30">`, strings.ReplaceAll(m.name, "/", `\`), len(m.data))
+		for offset := 0; offset < len(m.data); offset += msixBlockSize {
+			sum := sha256.Sum256(m.data[offset:min(offset+msixBlockSize, len(m.data))])
+			fmt.Fprintf(&b, `<Block Hash="%s"/>`, base64.StdEncoding.EncodeToString(sum[:]))
+		}
+		b.WriteString(`</File>`)
+	}
+	b.WriteString(`</BlockMap>`)
+	return []byte(b.String())
+}
+
+// msixPayloadForTest returns the manifest, declaring publisher, and a
+// payload file spanning two blocks
+func msixPayloadForTest(publisher string) []zipMemberForTest {
+	manifest := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<Package xmlns="http://schemas.microsoft.com/appx/manifest/foundation/windows10">
+  <Identity Name="Sigtool.TestApp" Publisher="%s" Version="1.2.3.0" ProcessorArchitecture="x64"/>
+</Package>`, publisher)
+	return []zipMemberForTest{
+		{"AppxManifest.xml", []byte(manifest)},
+		{"app/sigtool%20test.exe", bytes.Repeat([]byte("sigtool payload "), 5000)},
+	}
+}
+
+// msixContentTypes is the [Content_Types].xml of test packages
+var msixContentTypes = []byte(`<?xml version="1.0" encoding="UTF-8"?><Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="exe" ContentType="application/x-msdownload"/></Types>`)
+
+// writeSignedMSIXForTest writes a package of payload and blockMap, signed
+// over its digest as computed from the unsigned archive, and returns its
+// path. A nil blockMap is computed from payload.
+func writeSignedMSIXForTest(t *testing.T, payload []zipMemberForTest, blockMap []byte) string {
+	t.Helper()
+	if blockMap == nil {
+		// The block map lists the payload file by its part name
+		decoded := append([]zipMemberForTest(nil), payload...)
+		for i := range decoded {
+			decoded[i].name = strings.ReplaceAll(decoded[i].name, "%20", " ")
+		}
+		blockMap = blockMapForTest(decoded)
+	}
+	members := append(append([]zipMemberForTest(nil), payload...),
+		zipMemberForTest{msixBlockMapFile, blockMap},
+		zipMemberForTest{msixContentTypesFile, msixContentTypes})
+
+	// Without the signature, the local records end at the central directory
+	unsigned := zipForTest(t, members)
+	eocd := unsigned[len(unsigned)-zipEOCDSize:]
+	directoryOffset := binary.LittleEndian.Uint32(eocd[16:])
+	digest := append([]byte(nil), "APPX"...)
+	for _, part := range []struct {
+		tag  string
+		data []byte
+	}{
+		{"AXPC", unsigned[:directoryOffset]},
+		{"AXCD", unsigned[directoryOffset:]},
+		{"AXCT", msixContentTypes},
+		{"AXBM", blockMap},
+	} {
+		sum := sha256.Sum256(part.data)
+		digest = append(append(digest, part.tag...), sum[:]...)
+	}
+	signature := signAuthenticodeForTest(t, digest, crypto.SHA256)
+
+	signed := zipForTest(t, append(members, zipMemberForTest{msixSignatureFile, append([]byte("PKCX"), signature...)}))
+	filePath := filepath.Join(t.TempDir(), "app.msix")
+	if err := os.WriteFile(filePath, signed, 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	return filePath
+}
+
+// testSignerPublisher is the subject of the test signer certificate as a
+// package manifest writes it
+const testSignerPublisher = "CN=sigtool test signer, O=sigtool"
+
+func TestVerify_MSIX(t *testing.T) {
+	filePath := writeSignedMSIXForTest(t, msixPayloadForTest(testSignerPublisher), nil)
+
+	if fileType, err := DetectFileType(filePath); err != nil || fileType != FileTypeMSIX {
+		t.Errorf("Expected FileTypeMSIX, got %q (error %v)", fileType, err)
+	}
+	if err := Verify(filePath, nil); err != nil {
+		t.Errorf("Expected a valid signature, got: %v", err)
+	}
+	signature, err := ExtractDigitalSignature(filePath)
+	if err != nil || bytes.HasPrefix(signature, []byte("PKCX")) {
+		t.Errorf("Expected the signature without its PKCX prefix, got %d bytes (error %v)", len(signature), err)
+	}
+	info, err := Inspect(filePath)
+	if err != nil || info.Signer == nil {
+		t.Errorf("Expected signer details, got %+v (error %v)", info, err)
+	}
+
+	identity, err := ReadPackageIdentity(filePath)
+	if err != nil {
+		t.Fatalf("ReadPackageIdentity failed: %v", err)
+	}
+	want := PackageIdentity{
+		Name:                  "Sigtool.TestApp",
+		Publisher:             testSignerPublisher,
+		Version:               "1.2.3.0",
+		ProcessorArchitecture: "x64",
+		PublisherID:           publisherID(testSignerPublisher),
+		FamilyName:            "Sigtool.TestApp_" + publisherID(testSignerPublisher),
+	}
+	if *identity != want {
+		t.Errorf("Expected %+v, got %+v", want, *identity)
+	}
+}
+
+func TestPublisherID(t *testing.T) {
+	// The publisher ID of Microsoft's inbox apps, as in
+	// Microsoft.WindowsCalculator_8wekyb3d8bbwe
+	got := publisherID("CN=Microsoft Corporation, O=Microsoft Corporation, L=Redmond, S=Washington, C=US")
+	if got != "8wekyb3d8bbwe" {
+		t.Errorf("Expected 8wekyb3d8bbwe, got %s", got)
+	}
+}
+
+func TestVerify_MSIXTampered(t *testing.T) {
+	payload := msixPayloadForTest(testSignerPublisher)
+	signed, err := os.ReadFile(writeSignedMSIXForTest(t, payload, nil))
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	// A payload file replaced after signing changes the local records
+	payload[1].data = bytes.Repeat([]byte("malicious payload"), 10)
+	tampered := filepath.Join(t.TempDir(), "app.msix")
+	if err := os.WriteFile(tampered, zipForTest(t, append(payload,
+		zipMemberForTest{msixBlockMapFile, blockMapForTest(payload)},
+		zipMemberForTest{msixContentTypesFile, msixContentTypes},
+		zipMemberForTest{msixSignatureFile, signatureMemberForTest(t, signed)})), 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	var mismatch *DigestMismatchError
+	if err := Verify(tampered, nil); !errors.Is(err, ErrDigestMismatch) || !errors.As(err, &mismatch) {
+		t.Errorf("Expected ErrDigestMismatch, got: %v", err)
+	}
+}
+
+// signatureMemberForTest returns the AppxSignature.p7x of the package
+func signatureMemberForTest(t *testing.T, pkg []byte) []byte {
+	t.Helper()
+	r, err := zip.NewReader(bytes.NewReader(pkg), int64(len(pkg)))
+	if err != nil {
+		t.Fatalf("Failed to read package: %v", err)
+	}
+	for _, f := range r.File {
+		if f.Name == msixSignatureFile {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatalf("Failed to open signature: %v", err)
+			}
+			defer rc.Close()
+			var buf bytes.Buffer
+			if _, err := buf.ReadFrom(rc); err != nil {
+				t.Fatalf("Failed to read signature: %v", err)
+			}
+			return buf.Bytes()
+		}
+	}
+	t.Fatal("Package has no signature")
+	return nil
+}
+
+func TestVerify_MSIXBlockMapMismatch(t *testing.T) {
+	payload := msixPayloadForTest(testSignerPublisher)
+	tests := []struct {
+		name     string
+		blockMap []byte
+	}{
+		// Signed block maps that do not describe the payload
+		{"wrong block", blockMapForTest([]zipMemberForTest{payload[0], {"app/sigtool test.exe", bytes.Repeat([]byte("sigtool PAYLOAD "), 5000)}})},
+		{"unlisted file", blockMapForTest(payload[:1])},
+		{"missing file", blockMapForTest(append(payload[:1:1], zipMemberForTest{"app/missing.dll", []byte("gone")}))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := writeSignedMSIXForTest(t, payload, tt.blockMap)
+			if err := Verify(filePath, nil); !errors.Is(err, ErrBlockMapMismatch) {
+				t.Errorf("Expected ErrBlockMapMismatch, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerify_MSIXPublisherMismatch(t *testing.T) {
+	filePath := writeSignedMSIXForTest(t, msixPayloadForTest("CN=Contoso, O=Contoso, C=US"), nil)
+	if err := Verify(filePath, nil); !errors.Is(err, ErrPublisherMismatch) {
+		t.Errorf("Expected ErrPublisherMismatch, got: %v", err)
+	}
+}
+
+func TestVerify_MSIXUnsigned(t *testing.T) {
+	payload := msixPayloadForTest(testSignerPublisher)
+	filePath := filepath.Join(t.TempDir(), "unsigned.msix")
+	if err := os.WriteFile(filePath, zipForTest(t, append(payload,
+		zipMemberForTest{msixBlockMapFile, blockMapForTest(payload)},
+		zipMemberForTest{msixContentTypesFile, msixContentTypes})), 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if _, err := ExtractDigitalSignature(filePath); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned, got: %v", err)
+	}
+	if err := Verify(filePath, nil); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned from Verify, got: %v", err)
+	}
+}
+
+func TestDetectFileType_PlainZip(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "archive.zip")
+	if err := os.WriteFile(filePath, zipForTest(t, []zipMemberForTest{{"readme.txt", []byte("hello")}}), 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if fileType, err := DetectFileType(filePath); err != nil || fileType != FileTypeUnknown {
+		t.Errorf("Expected FileTypeUnknown, got %q (error %v)", fileType, err)
+	}
+}
@@ -0,0 +1,34 @@
+//go:build sigtool_msroots
+
+package sigtool
+
+import (
+	"crypto/x509"
+	_ "embed"
+	"errors"
+	"sync"
+)
+
+//go:embed roots/microsoft_codesigning_roots.pem
+var microsoftRootsPEM []byte
+
+var (
+	microsoftRootsOnce sync.Once
+	microsoftRootsPool *x509.CertPool
+)
+
+// MicrosoftRoots returns the embedded Microsoft Trusted Root Program
+// code-signing roots. It is only available when the package is built with
+// the sigtool_msroots build tag.
+func MicrosoftRoots() (*x509.CertPool, error) {
+	microsoftRootsOnce.Do(func() {
+		pool := x509.NewCertPool()
+		if pool.AppendCertsFromPEM(microsoftRootsPEM) {
+			microsoftRootsPool = pool
+		}
+	})
+	if microsoftRootsPool == nil {
+		return nil, errors.New("embedded Microsoft root bundle holds no certificates")
+	}
+	return microsoftRootsPool, nil
+}
@@ -0,0 +1,12 @@
+//go:build !sigtool_msroots
+
+package sigtool
+
+import "crypto/x509"
+
+// MicrosoftRoots returns the embedded Microsoft Trusted Root Program
+// code-signing roots. This build does not include them; rebuild with
+// -tags sigtool_msroots to embed the bundle.
+func MicrosoftRoots() (*x509.CertPool, error) {
+	return nil, ErrMicrosoftRootsUnavailable
+}
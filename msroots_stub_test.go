@@ -0,0 +1,20 @@
+//go:build !sigtool_msroots
+
+package sigtool
+
+import (
+	"crypto"
+	"errors"
+	"testing"
+)
+
+func TestMicrosoftRoots_Unavailable(t *testing.T) {
+	if _, err := MicrosoftRoots(); !errors.Is(err, ErrMicrosoftRootsUnavailable) {
+		t.Errorf("Expected ErrMicrosoftRootsUnavailable, got: %v", err)
+	}
+
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+	if err := Verify(filePath, &VerifyOptions{UseMicrosoftRoots: true}); !errors.Is(err, ErrMicrosoftRootsUnavailable) {
+		t.Errorf("Expected ErrMicrosoftRootsUnavailable, got: %v", err)
+	}
+}
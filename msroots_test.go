@@ -0,0 +1,25 @@
+//go:build sigtool_msroots
+
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"testing"
+)
+
+func TestMicrosoftRoots_Embedded(t *testing.T) {
+	if _, err := MicrosoftRoots(); err != nil {
+		t.Fatalf("Expected embedded roots, got: %v", err)
+	}
+	if !bytes.Contains(microsoftRootsPEM, []byte("Microsoft RSA Root Certificate Authority 2017")) {
+		t.Error("Expected the bundle to include the Microsoft RSA root")
+	}
+
+	// The test signer does not chain to any Microsoft program root
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+	if err := Verify(filePath, &VerifyOptions{UseMicrosoftRoots: true}); !errors.Is(err, ErrChainVerification) {
+		t.Errorf("Expected ErrChainVerification, got: %v", err)
+	}
+}
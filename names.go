@@ -0,0 +1,379 @@
+package sigtool
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// nameAttribute is one attribute of a distinguished name with a canonical
+// key and value
+type nameAttribute struct {
+	key   string
+	value string
+}
+
+// nameAttributeKeys maps the attribute names and OIDs used by Windows,
+// OpenSSL and RFC 4514 renderings to canonical keys
+var nameAttributeKeys = map[string]string{
+	"cn": "cn", "commonname": "cn", "2.5.4.3": "cn",
+	"o": "o", "organization": "o", "organizationname": "o", "2.5.4.10": "o",
+	"ou": "ou", "organizationalunit": "ou", "organizationalunitname": "ou", "2.5.4.11": "ou",
+	"c": "c", "country": "c", "countryname": "c", "2.5.4.6": "c",
+	"l": "l", "locality": "l", "localityname": "l", "2.5.4.7": "l",
+	"s": "st", "st": "st", "state": "st", "stateorprovincename": "st", "2.5.4.8": "st",
+	"street": "street", "streetaddress": "street", "2.5.4.9": "street",
+	"postalcode": "postalcode", "2.5.4.17": "postalcode",
+	"serialnumber": "serialnumber", "2.5.4.5": "serialnumber",
+	"e": "emailaddress", "email": "emailaddress", "emailaddress": "emailaddress", "1.2.840.113549.1.9.1": "emailaddress",
+	"dc": "dc", "domaincomponent": "dc", "0.9.2342.19200300.100.1.25": "dc",
+	"uid": "uid", "userid": "uid", "0.9.2342.19200300.100.1.1": "uid",
+	"businesscategory": "businesscategory", "2.5.4.15": "businesscategory",
+	"jurisdictionc": "jurisdictionc", "1.3.6.1.4.1.311.60.2.1.3": "jurisdictionc",
+	"jurisdictionst": "jurisdictionst", "1.3.6.1.4.1.311.60.2.1.2": "jurisdictionst",
+	"jurisdictionl": "jurisdictionl", "1.3.6.1.4.1.311.60.2.1.1": "jurisdictionl",
+}
+
+// NormalizeName returns the canonical form of a signer name, either a
+// distinguished name in any common rendering or a plain name such as
+// "Microsoft Corporation".
+//
+// Attribute names are mapped to canonical keys (S and ST, E and
+// emailAddress, OID forms), attributes are sorted, values are lowercased
+// with whitespace collapsed and quotes and escapes removed, and punycode
+// labels ("xn--") are decoded. Two renderings of the same name normalize to
+// the same string, e.g. "CN=Contoso, O=Contoso Ltd, S=WA" and
+// "st=wa,o=Contoso  Ltd,cn=contoso".
+//
+// Parameters:
+//   - name: The distinguished name or plain name
+//
+// Returns:
+//   - string: The canonical form
+//
+// Example usage:
+//
+//	if sigtool.NormalizeName(a) == sigtool.NormalizeName(b) {
+//	    fmt.Println("same signer")
+//	}
+func NormalizeName(name string) string {
+	attrs, isDN := parseNameAttributes(name)
+	if !isDN {
+		return normalizeNameValue(name)
+	}
+	return formatNameAttributes(attrs)
+}
+
+// CanonicalName returns the canonical form of a certificate name, as
+// NormalizeName returns for any rendering of it.
+func CanonicalName(name pkix.Name) string {
+	return formatNameAttributes(attributesOfName(name))
+}
+
+// NamesMatch reports whether a and b name the same signer. Distinguished
+// names match when they hold the same attributes regardless of order and
+// formatting; a plain name matches a distinguished name whose common name
+// equals it.
+//
+// Parameters:
+//   - a, b: Distinguished names or plain names
+//
+// Returns:
+//   - bool: Whether the names match after normalization
+//
+// Example usage:
+//
+//	sigtool.NamesMatch("Microsoft Corporation", "C=US, S=Washington, L=Redmond, O=Microsoft Corporation, CN=Microsoft Corporation") // true
+func NamesMatch(a, b string) bool {
+	attrsA, dnA := parseNameAttributes(a)
+	attrsB, dnB := parseNameAttributes(b)
+	return matchNameAttributes(attrsA, dnA, normalizeNameValue(a), attrsB, dnB, normalizeNameValue(b))
+}
+
+// MatchSignerName reports whether pattern, a distinguished name or plain
+// name, matches the subject of cert as NamesMatch does.
+func MatchSignerName(cert *x509.Certificate, pattern string) bool {
+	return matchName(cert.Subject, pattern)
+}
+
+// matchName reports whether pattern matches name as NamesMatch does
+func matchName(name pkix.Name, pattern string) bool {
+	attrs, isDN := parseNameAttributes(pattern)
+	return matchNameAttributes(attrs, isDN, normalizeNameValue(pattern), attributesOfName(name), true, "")
+}
+
+func matchNameAttributes(attrsA []nameAttribute, dnA bool, plainA string, attrsB []nameAttribute, dnB bool, plainB string) bool {
+	switch {
+	case dnA && dnB:
+		return formatNameAttributes(attrsA) == formatNameAttributes(attrsB)
+	case dnA:
+		return plainMatchesAttributes(plainB, attrsA)
+	case dnB:
+		return plainMatchesAttributes(plainA, attrsB)
+	}
+	return plainA != "" && plainA == plainB
+}
+
+// plainMatchesAttributes reports whether plain equals a common name of
+// attrs
+func plainMatchesAttributes(plain string, attrs []nameAttribute) bool {
+	if plain == "" {
+		return false
+	}
+	for _, a := range attrs {
+		if a.key == "cn" && a.value == plain {
+			return true
+		}
+	}
+	return false
+}
+
+// attributesOfName returns the canonical attributes of name
+func attributesOfName(name pkix.Name) []nameAttribute {
+	names := name.Names
+	if len(names) == 0 {
+		for _, rdn := range name.ToRDNSequence() {
+			names = append(names, rdn...)
+		}
+	}
+	attrs := make([]nameAttribute, 0, len(names))
+	for _, atv := range names {
+		attrs = append(attrs, nameAttribute{key: canonicalAttributeKey(atv.Type.String()), value: normalizeNameValue(fmt.Sprint(atv.Value))})
+	}
+	return attrs
+}
+
+// parseNameAttributes splits a distinguished name rendering into canonical
+// attributes. isDN is false when s is a plain name. Separators are commas,
+// semicolons and plus signs outside quotes and escapes; a component
+// without "=" continues the previous value, as in the unescaped
+// "O=Contoso, Inc." that some tools print.
+func parseNameAttributes(s string) (attrs []nameAttribute, isDN bool) {
+	// seps[i] is the separator before parts[i]
+	var parts, seps []string
+	var current strings.Builder
+	sep := ""
+	quoted, escaped := false, false
+	for _, r := range s {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+			continue
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case !quoted && (r == ',' || r == ';' || r == '+'):
+			parts, seps = append(parts, current.String()), append(seps, sep)
+			current.Reset()
+			sep = string(r)
+			continue
+		}
+		current.WriteRune(r)
+	}
+	parts, seps = append(parts, current.String()), append(seps, sep)
+
+	var raw []nameAttribute
+	for i, part := range parts {
+		key, value, ok := strings.Cut(part, "=")
+		key = strings.TrimSpace(key)
+		if ok && isAttributeKey(key) {
+			raw = append(raw, nameAttribute{key: canonicalAttributeKey(key), value: value})
+			continue
+		}
+		if len(raw) == 0 {
+			return nil, false
+		}
+		raw[len(raw)-1].value += seps[i] + part
+	}
+	for i := range raw {
+		raw[i].value = normalizeNameValue(raw[i].value)
+	}
+	return raw, true
+}
+
+// isAttributeKey reports whether key looks like an attribute type: a
+// known name, an OID or a short alphanumeric identifier
+func isAttributeKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, r := range key {
+		if !(r == '.' || r == '-' || unicode.IsLetter(r) || unicode.IsDigit(r)) || r > unicode.MaxASCII {
+			return false
+		}
+	}
+	return true
+}
+
+// canonicalAttributeKey maps an attribute name or OID, optionally with the
+// "OID." prefix used by Windows, to its canonical key
+func canonicalAttributeKey(key string) string {
+	key = strings.ToLower(strings.TrimSpace(key))
+	key = strings.TrimPrefix(key, "oid.")
+	if canonical, ok := nameAttributeKeys[key]; ok {
+		return canonical
+	}
+	return key
+}
+
+// normalizeNameValue lowercases value, removes surrounding quotes and
+// escapes, collapses whitespace and decodes punycode labels
+func normalizeNameValue(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = value[1 : len(value)-1]
+	}
+	var b strings.Builder
+	escaped := false
+	for _, r := range value {
+		if !escaped && r == '\\' {
+			escaped = true
+			continue
+		}
+		escaped = false
+		b.WriteRune(r)
+	}
+	value = strings.ToLower(strings.Join(strings.Fields(b.String()), " "))
+	return decodePunycodeLabels(value)
+}
+
+// formatNameAttributes renders attrs sorted, one key=value per attribute
+func formatNameAttributes(attrs []nameAttribute) string {
+	sorted := append([]nameAttribute(nil), attrs...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].key != sorted[j].key {
+			return sorted[i].key < sorted[j].key
+		}
+		return sorted[i].value < sorted[j].value
+	})
+	escaper := strings.NewReplacer(`\`, `\\`, ",", `\,`, "+", `\+`, ";", `\;`, `"`, `\"`)
+	rendered := make([]string, len(sorted))
+	for i, a := range sorted {
+		rendered[i] = a.key + "=" + escaper.Replace(a.value)
+	}
+	return strings.Join(rendered, ",")
+}
+
+// decodePunycodeLabels decodes every "xn--" label of s, labels being
+// separated by dots and spaces. Labels that do not decode are kept.
+func decodePunycodeLabels(s string) string {
+	if !strings.Contains(s, "xn--") {
+		return s
+	}
+	var b strings.Builder
+	start := 0
+	flush := func(end int) {
+		label := s[start:end]
+		if strings.HasPrefix(label, "xn--") {
+			if decoded, ok := decodePunycode(label[len("xn--"):]); ok {
+				label = decoded
+			}
+		}
+		b.WriteString(label)
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] == '.' || s[i] == ' ' {
+			flush(i)
+			b.WriteByte(s[i])
+			start = i + 1
+		}
+	}
+	flush(len(s))
+	return b.String()
+}
+
+// decodePunycode decodes a punycode string as specified by RFC 3492
+func decodePunycode(s string) (string, bool) {
+	const (
+		base        = 36
+		tmin        = 1
+		tmax        = 26
+		skew        = 38
+		damp        = 700
+		initialBias = 72
+		initialN    = 128
+		maxInt      = 1<<31 - 1
+	)
+	adapt := func(delta, points int, first bool) int {
+		if first {
+			delta /= damp
+		} else {
+			delta /= 2
+		}
+		delta += delta / points
+		k := 0
+		for delta > ((base-tmin)*tmax)/2 {
+			delta /= base - tmin
+			k += base
+		}
+		return k + (base-tmin+1)*delta/(delta+skew)
+	}
+
+	var output []rune
+	if b := strings.LastIndexByte(s, '-'); b >= 0 {
+		for _, r := range s[:b] {
+			if r >= 0x80 {
+				return "", false
+			}
+			output = append(output, r)
+		}
+		s = s[b+1:]
+	}
+
+	n, bias, i := initialN, initialBias, 0
+	for pos := 0; pos < len(s); {
+		oldi, w := i, 1
+		for k := base; ; k += base {
+			if pos >= len(s) {
+				return "", false
+			}
+			c := s[pos]
+			pos++
+			var digit int
+			switch {
+			case c >= '0' && c <= '9':
+				digit = int(c-'0') + 26
+			case c >= 'a' && c <= 'z':
+				digit = int(c - 'a')
+			case c >= 'A' && c <= 'Z':
+				digit = int(c - 'A')
+			default:
+				return "", false
+			}
+			if digit > (maxInt-i)/w {
+				return "", false
+			}
+			i += digit * w
+			t := k - bias
+			if t < tmin {
+				t = tmin
+			} else if t > tmax {
+				t = tmax
+			}
+			if digit < t {
+				break
+			}
+			w *= base - t
+		}
+		points := len(output) + 1
+		bias = adapt(i-oldi, points, oldi == 0)
+		if i/points > maxInt-n {
+			return "", false
+		}
+		n += i / points
+		i %= points
+		if n > unicode.MaxRune {
+			return "", false
+		}
+		output = append(output, 0)
+		copy(output[i+1:], output[i:])
+		output[i] = rune(n)
+		i++
+	}
+	return string(output), true
+}
@@ -0,0 +1,95 @@
+package sigtool
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+)
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{"RDN order and case", "CN=Contoso, O=Contoso Ltd, C=US", "c=us,o=CONTOSO LTD,cn=contoso"},
+		{"whitespace", "CN=Contoso  Ltd ,O= Contoso", "CN=Contoso Ltd,O=Contoso"},
+		{"attribute aliases", "CN=Contoso, S=Washington, E=it@contoso.com", "emailAddress=it@contoso.com, ST=Washington, CN=Contoso"},
+		{"OID attributes", "OID.2.5.4.3=Contoso, OID.1.3.6.1.4.1.311.60.2.1.3=US", "CN=Contoso, jurisdictionC=US"},
+		{"quotes and escapes", `CN="Contoso, Inc.", O=Contoso`, `CN=Contoso\, Inc.,O=Contoso`},
+		{"unescaped comma", "CN=Contoso, Inc., O=Contoso", `CN=Contoso\, Inc.,O=Contoso`},
+		{"punycode", "CN=xn--bcher-kva.example", "CN=Bücher.example"},
+		{"plain names", "  Microsoft   Corporation ", "microsoft corporation"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if a, b := NormalizeName(tt.a), NormalizeName(tt.b); a != b {
+				t.Errorf("NormalizeName(%q) = %q, NormalizeName(%q) = %q", tt.a, a, tt.b, b)
+			}
+		})
+	}
+
+	if a, b := NormalizeName("CN=Contoso, O=A"), NormalizeName("CN=Contoso, O=B"); a == b {
+		t.Errorf("Expected different names to differ, both normalized to %q", a)
+	}
+}
+
+func TestNamesMatch(t *testing.T) {
+	microsoft := "C=US, S=Washington, L=Redmond, O=Microsoft Corporation, CN=Microsoft Corporation"
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"Microsoft Corporation", microsoft, true},
+		{microsoft, "microsoft corporation", true},
+		{"CN=Microsoft Corporation, O=Microsoft Corporation, L=Redmond, ST=Washington, C=US", microsoft, true},
+		{"CN=Microsoft Corporation", microsoft, false},
+		{"Microsoft", microsoft, false},
+		{"Contoso", "contoso", true},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		if got := NamesMatch(tt.a, tt.b); got != tt.want {
+			t.Errorf("NamesMatch(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestMatchSignerName(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{
+		CommonName:   "Microsoft Corporation",
+		Organization: []string{"Microsoft Corporation"},
+		Locality:     []string{"Redmond"},
+		Province:     []string{"Washington"},
+		Country:      []string{"US"},
+	}}
+	for _, pattern := range []string{
+		"Microsoft Corporation",
+		"CN=Microsoft Corporation, O=Microsoft Corporation, L=Redmond, S=Washington, C=US",
+		cert.Subject.String(),
+	} {
+		if !MatchSignerName(cert, pattern) {
+			t.Errorf("Expected %q to match %q", pattern, cert.Subject)
+		}
+	}
+	if MatchSignerName(cert, "CN=Microsoft Corporation, O=Microsoft Corporation") {
+		t.Error("Expected a partial distinguished name not to match")
+	}
+	if got, want := CanonicalName(cert.Subject), NormalizeName(cert.Subject.String()); got != want {
+		t.Errorf("CanonicalName = %q, want %q", got, want)
+	}
+}
+
+func TestDecodePunycode(t *testing.T) {
+	for encoded, want := range map[string]string{
+		"bcher-kva":  "bücher",
+		"mnchen-3ya": "münchen",
+		"wgv71a119e": "日本語",
+	} {
+		if got, ok := decodePunycode(encoded); !ok || got != want {
+			t.Errorf("decodePunycode(%q) = %q, %v, want %q", encoded, got, ok, want)
+		}
+	}
+	if _, ok := decodePunycode("invalid!"); ok {
+		t.Error("Expected invalid punycode to fail")
+	}
+}
@@ -0,0 +1,196 @@
+package sigtool
+
+import (
+	"crypto"
+	"crypto/subtle"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.mozilla.org/pkcs7"
+)
+
+// Unsigned attribute holding additional (nested) Authenticode signatures of
+// dual-signed binaries
+var oidNestedSignature = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 4, 1}
+
+// EmbeddedSignature is one of the Authenticode signatures carried by a PE
+// file, either the primary signature or one nested inside it.
+type EmbeddedSignature struct {
+	// Nested is false for the primary signature and true for signatures
+	// stored in the nested-signature attribute
+	Nested bool
+	// RawSignature is the PKCS#7 ContentInfo of this signature
+	RawSignature []byte `json:"-"`
+	// DigestAlgorithm is the hash algorithm of the Authenticode file digest
+	DigestAlgorithm crypto.Hash
+	// StoredDigest is the file digest recorded in this signature
+	StoredDigest []byte
+	// ComputedDigest is the file digest recomputed with DigestAlgorithm
+	ComputedDigest []byte
+	// Signer is the signing certificate, when it is embedded
+	Signer *CertificateInfo `json:",omitempty"`
+	// Err is nil when this signature verified successfully, otherwise it
+	// describes why verification failed
+	Err error `json:"-"`
+}
+
+// Valid reports whether the signature verified successfully.
+func (s *EmbeddedSignature) Valid() bool {
+	return s.Err == nil
+}
+
+// EnumerateSignatures returns every Authenticode signature of a PE file,
+// the primary signature followed by any nested signatures, and verifies each
+// of them independently.
+//
+// Dual-signed binaries typically carry a SHA-1 primary signature and a
+// SHA-256 nested signature in the 1.3.6.1.4.1.311.2.4.1 unsigned attribute.
+// Each signature's file digest is recomputed with its own algorithm and the
+// signer is verified per opts. A failure of one signature is reported in its
+// Err field and does not prevent the others from being checked.
+//
+// Parameters:
+//   - filePath: The path to the signed PE file
+//   - opts: Certificate chain verification options applied to every signature
+//
+// Returns:
+//   - []EmbeddedSignature: The primary signature first, then nested signatures
+//   - error: An error if the primary signature cannot be extracted or parsed
+//
+// Example usage:
+//
+//	sigs, err := sigtool.EnumerateSignatures("signed.exe", sigtool.VerifyOptions{})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	for _, sig := range sigs {
+//	    fmt.Printf("%v valid=%v\n", sig.DigestAlgorithm, sig.Valid())
+//	}
+func EnumerateSignatures(filePath string, opts VerifyOptions) ([]EmbeddedSignature, error) {
+	if strings.TrimSpace(filePath) == "" {
+		return nil, errors.New("file path cannot be empty")
+	}
+
+	// #nosec G304 - This tool is designed to read user-specified PE files
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %q: %w", filePath, err)
+	}
+	defer f.Close()
+
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	return enumerateSignatures(f, fileInfo.Size(), opts)
+}
+
+func enumerateSignatures(r io.ReaderAt, size int64, opts VerifyOptions) ([]EmbeddedSignature, error) {
+	layout, err := readLayout(r, size)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := readSignature(r, layout)
+	if err != nil {
+		return nil, err
+	}
+
+	primary, err := parsePKCS7(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS#7 signature: %w", err)
+	}
+
+	nested, err := nestedSignatures(primary)
+	if err != nil {
+		return nil, err
+	}
+
+	// Authentihashes are shared between signatures using the same algorithm
+	digests := make(map[crypto.Hash][]byte)
+	computeDigest := func(h crypto.Hash) ([]byte, error) {
+		if d, ok := digests[h]; ok {
+			return d, nil
+		}
+		d, err := authentihash(r, layout, h)
+		if err != nil {
+			return nil, err
+		}
+		digests[h] = d
+		return d, nil
+	}
+
+	sigs := make([]EmbeddedSignature, 0, 1+len(nested))
+	sigs = append(sigs, checkEmbeddedSignature(primary, raw, false, computeDigest, opts))
+	for _, der := range nested {
+		p7, err := parsePKCS7(der)
+		if err != nil {
+			sigs = append(sigs, EmbeddedSignature{
+				Nested:       true,
+				RawSignature: der,
+				Err:          fmt.Errorf("failed to parse nested PKCS#7 signature: %w", err),
+			})
+			continue
+		}
+		sigs = append(sigs, checkEmbeddedSignature(p7, der, true, computeDigest, opts))
+	}
+
+	return sigs, nil
+}
+
+// checkEmbeddedSignature verifies a single signature against the file digest
+func checkEmbeddedSignature(p7 *pkcs7.PKCS7, raw []byte, nested bool, computeDigest func(crypto.Hash) ([]byte, error), opts VerifyOptions) EmbeddedSignature {
+	sig := EmbeddedSignature{Nested: nested, RawSignature: raw}
+	if signer := p7.GetOnlySigner(); signer != nil {
+		sig.Signer = newCertificateInfo(signer)
+	}
+
+	algorithm, stored, err := storedDigest(p7)
+	if err != nil {
+		sig.Err = err
+		return sig
+	}
+	sig.DigestAlgorithm = algorithm
+	sig.StoredDigest = stored
+
+	computed, err := computeDigest(algorithm)
+	if err != nil {
+		sig.Err = err
+		return sig
+	}
+	sig.ComputedDigest = computed
+
+	if subtle.ConstantTimeCompare(stored, computed) != 1 {
+		sig.Err = &DigestMismatchError{Algorithm: algorithm, Signed: stored, Computed: computed}
+		return sig
+	}
+
+	sig.Err = verifySignedData(p7, opts)
+	return sig
+}
+
+// nestedSignatures returns the DER ContentInfo of every signature stored in
+// the nested-signature attribute of the primary signer of p7
+func nestedSignatures(p7 *pkcs7.PKCS7) ([][]byte, error) {
+	var nested [][]byte
+	for _, attr := range unauthenticatedAttributes(p7) {
+		if !attr.Type.Equal(oidNestedSignature) {
+			continue
+		}
+		rest := attr.Value.Bytes
+		for len(rest) > 0 {
+			var value asn1.RawValue
+			var err error
+			rest, err = asn1.Unmarshal(rest, &value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse nested signature attribute: %w", err)
+			}
+			nested = append(nested, value.FullBytes)
+		}
+	}
+	return nested, nil
+}
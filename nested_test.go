@@ -0,0 +1,90 @@
+package sigtool
+
+import (
+	"crypto"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// createDualSignedMockPE writes a mock PE with a SHA-1 primary signature and
+// a SHA-256 nested signature over the same image
+func createDualSignedMockPE(t *testing.T, nestedDigest []byte) string {
+	t.Helper()
+
+	image := mockPEImage([]byte("dual-signed-payload"))
+	if nestedDigest == nil {
+		nestedDigest = mockAuthentihash(image, crypto.SHA256)
+	}
+	nested := signAuthenticodeForTest(t, nestedDigest, crypto.SHA256)
+	primary := signAuthenticodeForTest(t, mockAuthentihash(image, crypto.SHA1), crypto.SHA1, withNestedSignature(t, nested))
+
+	filePath := filepath.Join(t.TempDir(), "dual.exe")
+	if err := os.WriteFile(filePath, embedSignatureForTest(image, primary), 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	return filePath
+}
+
+func TestEnumerateSignatures_DualSigned(t *testing.T) {
+	sigs, err := EnumerateSignatures(createDualSignedMockPE(t, nil), VerifyOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(sigs) != 2 {
+		t.Fatalf("Expected 2 signatures, got %d", len(sigs))
+	}
+
+	if sigs[0].Nested || sigs[0].DigestAlgorithm != crypto.SHA1 {
+		t.Errorf("Expected primary SHA-1 signature, got nested=%v %v", sigs[0].Nested, sigs[0].DigestAlgorithm)
+	}
+	if !sigs[1].Nested || sigs[1].DigestAlgorithm != crypto.SHA256 {
+		t.Errorf("Expected nested SHA-256 signature, got nested=%v %v", sigs[1].Nested, sigs[1].DigestAlgorithm)
+	}
+	for i, sig := range sigs {
+		if !sig.Valid() {
+			t.Errorf("Signature %d: expected valid, got: %v", i, sig.Err)
+		}
+		if sig.Signer == nil {
+			t.Errorf("Signature %d: expected signer info", i)
+		}
+	}
+}
+
+func TestEnumerateSignatures_NestedVerifiedIndependently(t *testing.T) {
+	bogus := make([]byte, 32)
+	sigs, err := EnumerateSignatures(createDualSignedMockPE(t, bogus), VerifyOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(sigs) != 2 {
+		t.Fatalf("Expected 2 signatures, got %d", len(sigs))
+	}
+
+	if !sigs[0].Valid() {
+		t.Errorf("Expected primary signature to be valid, got: %v", sigs[0].Err)
+	}
+	if !errors.Is(sigs[1].Err, ErrDigestMismatch) {
+		t.Errorf("Expected nested signature digest mismatch, got: %v", sigs[1].Err)
+	}
+}
+
+func TestEnumerateSignatures_SingleSignature(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+
+	sigs, err := EnumerateSignatures(filePath, VerifyOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(sigs) != 1 || sigs[0].Nested || !sigs[0].Valid() {
+		t.Errorf("Expected a single valid primary signature, got %+v", sigs)
+	}
+}
+
+func TestEnumerateSignatures_Unsigned(t *testing.T) {
+	_, err := EnumerateSignatures(createMockPEFile(t, false, nil), VerifyOptions{})
+	if !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned, got: %v", err)
+	}
+}
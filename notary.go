@@ -0,0 +1,343 @@
+package sigtool
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultNotaryLookupURL is Apple's CloudKit endpoint that serves the
+	// notarization tickets Gatekeeper downloads for code without a stapled
+	// ticket
+	DefaultNotaryLookupURL = "https://api.apple-cloudkit.com/database/1/com.apple.gk.ticket-delivery/production/public/records/lookup"
+	// DefaultNotaryLookupTimeout bounds each ticket lookup
+	DefaultNotaryLookupTimeout = 10 * time.Second
+	// maxNotaryResponseSize bounds the size of a ticket lookup response
+	maxNotaryResponseSize = 1 << 20
+)
+
+// notaryTicketMagic starts every notarization ticket
+var notaryTicketMagic = []byte("s8ch")
+
+// NotarizationInfo is the notarization status of a Mach-O binary or a disk
+// image.
+type NotarizationInfo struct {
+	// Code holds each code signature: one per architecture of a Mach-O
+	// binary, or the signature of the disk image
+	Code []NotarizedCode
+}
+
+// Notarized reports whether every code signature of the file is bound by a
+// notarization ticket, stapled or found by the lookup.
+func (n *NotarizationInfo) Notarized() bool {
+	for i := range n.Code {
+		if !n.Code[i].Notarized() {
+			return false
+		}
+	}
+	return len(n.Code) > 0
+}
+
+// NotarizedCode is the notarization status of one code signature.
+type NotarizedCode struct {
+	// Arch is the architecture of a Mach-O slice, empty for a disk image
+	Arch string `json:",omitempty"`
+	// CDHashes are the CDHashes of the code directories of the signature,
+	// truncated to 20 bytes; unsigned code has none
+	CDHashes [][]byte
+	// Stapled reports whether a notarization ticket is stapled to the code
+	Stapled bool
+	// TicketSize is the size of the stapled ticket
+	TicketSize int `json:",omitempty"`
+	// Bound lists the CDHashes the stapled ticket binds
+	Bound [][]byte `json:",omitempty"`
+	// Online reports whether the lookup found a ticket for a CDHash
+	Online bool `json:",omitempty"`
+	// LookupErr is the error of the ticket lookup, if any
+	LookupErr error `json:"-"`
+}
+
+// Notarized reports whether a stapled ticket binds the code or the lookup
+// found one.
+func (c *NotarizedCode) Notarized() bool {
+	return len(c.Bound) > 0 || c.Online
+}
+
+// NotaryLookup queries Apple's ticket delivery service for notarization
+// tickets by CDHash, as Gatekeeper does for code without a stapled ticket.
+type NotaryLookup struct {
+	// Client performs the lookups. When nil, a client with Timeout is used.
+	Client *http.Client
+	// Timeout bounds each lookup when Client is nil. Zero means
+	// DefaultNotaryLookupTimeout.
+	Timeout time.Duration
+	// URL is the records lookup endpoint. Empty means
+	// DefaultNotaryLookupURL.
+	URL string
+}
+
+// InspectNotarization reports whether a Mach-O binary or a disk image is
+// notarized: for each code signature, whether a notarization ticket is
+// stapled to it and which of its CDHashes the ticket binds, and, when
+// lookup is not nil, whether Apple's ticket service has a ticket for it.
+// A ticket binds a code directory when it lists its CDHash; the Apple
+// signature of the ticket itself is not verified.
+//
+// Parameters:
+//   - filePath: The path to the Mach-O binary or UDIF disk image
+//   - lookup: The online ticket lookup, or nil to read stapled tickets only
+//
+// Returns:
+//   - *NotarizationInfo: The status of each code signature
+//   - error: An error if the file cannot be read, is neither a Mach-O
+//     binary nor a disk image, or its code signature is malformed
+//
+// Example usage:
+//
+//	info, err := sigtool.InspectNotarization("MyApp.dmg", &sigtool.NotaryLookup{})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	fmt.Printf("notarized: %v\n", info.Notarized())
+func InspectNotarization(filePath string, lookup *NotaryLookup) (*NotarizationInfo, error) {
+	if strings.TrimSpace(filePath) == "" {
+		return nil, errors.New("file path cannot be empty")
+	}
+
+	// #nosec G304 - This tool is designed to read user-specified files
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %q: %w", filePath, err)
+	}
+	defer f.Close()
+
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+	return inspectNotarization(context.Background(), f, fileInfo.Size(), lookup)
+}
+
+// InspectNotarizationContext is InspectNotarization with support for
+// cancellation and deadlines: the context is checked before every read from
+// the file and bounds the lookups in Apple's ticket service. When the
+// context ends the returned error wraps ctx.Err().
+//
+// Parameters:
+//   - ctx: The context controlling cancellation
+//   - filePath: The path to the Mach-O binary or UDIF disk image
+//   - lookup: The online ticket lookup, or nil to read stapled tickets only
+//
+// Returns:
+//   - *NotarizationInfo: The status of each code signature
+//   - error: An error if inspection fails or the context is done
+func InspectNotarizationContext(ctx context.Context, filePath string, lookup *NotaryLookup) (*NotarizationInfo, error) {
+	var info *NotarizationInfo
+	err := withContextFile(ctx, filePath, func(r io.ReaderAt, size int64) error {
+		var err error
+		info, err = inspectNotarization(ctx, r, size, lookup)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// inspectNotarization implements InspectNotarization for r of the given
+// size, with ctx bounding the ticket lookups
+func inspectNotarization(ctx context.Context, r io.ReaderAt, size int64, lookup *NotaryLookup) (*NotarizationInfo, error) {
+	info := &NotarizationInfo{}
+	if isMachO(r) {
+		slices, err := machoSlices(r, size)
+		if err != nil {
+			return nil, err
+		}
+		for _, slice := range slices {
+			sig, err := readCodeSignature(slice)
+			if err != nil && !errors.Is(err, ErrNotSigned) {
+				return nil, fmt.Errorf("%s: %w", slice.arch, err)
+			}
+			code, err := notarizedCode(ctx, sig, lookup)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", slice.arch, err)
+			}
+			code.Arch = slice.arch
+			info.Code = append(info.Code, code)
+		}
+		return info, nil
+	}
+
+	if !isDiskImage(r, size) {
+		return nil, errors.New("not a Mach-O binary or UDIF disk image")
+	}
+	sig, _, err := readDMGCodeSignature(r, size)
+	if err != nil && !errors.Is(err, ErrNotSigned) {
+		return nil, err
+	}
+	code, err := notarizedCode(ctx, sig, lookup)
+	if err != nil {
+		return nil, err
+	}
+	info.Code = append(info.Code, code)
+	return info, nil
+}
+
+// notarizedCode returns the notarization status of the code signature sig,
+// which is nil for unsigned code. A lookup cut short by ctx fails instead
+// of being recorded in LookupErr.
+func notarizedCode(ctx context.Context, sig *codeSignature, lookup *NotaryLookup) (NotarizedCode, error) {
+	var code NotarizedCode
+	if sig == nil {
+		return code, nil
+	}
+	for _, cd := range sig.directories {
+		if cdhash := cd.cdhash(); cdhash != nil {
+			code.CDHashes = append(code.CDHashes, cdhash)
+		}
+	}
+	if len(sig.ticket) > 0 {
+		if !bytes.HasPrefix(sig.ticket, notaryTicketMagic) {
+			return code, errors.New("stapled ticket is not a notarization ticket")
+		}
+		code.Stapled = true
+		code.TicketSize = len(sig.ticket)
+		for _, cdhash := range code.CDHashes {
+			if bytes.Contains(sig.ticket, cdhash) {
+				code.Bound = append(code.Bound, cdhash)
+			}
+		}
+	}
+	if lookup != nil {
+		for _, cd := range sig.directories {
+			cdhash := cd.cdhash()
+			if cdhash == nil {
+				continue
+			}
+			ticket, err := lookup.LookupContext(ctx, cdhash, cd.hashType)
+			if err != nil && ctx.Err() != nil {
+				return code, ctx.Err()
+			}
+			if err != nil {
+				code.LookupErr = err
+				continue
+			}
+			if ticket != nil {
+				code.Online, code.LookupErr = true, nil
+				break
+			}
+		}
+	}
+	return code, nil
+}
+
+// Lookup returns the notarization ticket Apple's ticket service holds for
+// a CDHash, or nil when there is none.
+//
+// Parameters:
+//   - cdhash: The CDHash of a code directory, truncated to 20 bytes
+//   - hashType: The code directory hash type: 1 for SHA-1, 2 for SHA-256
+//
+// Returns:
+//   - []byte: The ticket, or nil when the service has no ticket for cdhash
+//   - error: An error if the lookup fails
+func (l *NotaryLookup) Lookup(cdhash []byte, hashType uint8) ([]byte, error) {
+	return l.LookupContext(context.Background(), cdhash, hashType)
+}
+
+// LookupContext is Lookup with ctx bounding the request.
+//
+// Parameters:
+//   - ctx: The context controlling cancellation
+//   - cdhash: The CDHash of a code directory, truncated to 20 bytes
+//   - hashType: The code directory hash type: 1 for SHA-1, 2 for SHA-256
+//
+// Returns:
+//   - []byte: The ticket, or nil when the service has no ticket for cdhash
+//   - error: An error if the lookup fails or the context is done
+func (l *NotaryLookup) LookupContext(ctx context.Context, cdhash []byte, hashType uint8) ([]byte, error) {
+	client := l.Client
+	if client == nil {
+		timeout := l.Timeout
+		if timeout <= 0 {
+			timeout = DefaultNotaryLookupTimeout
+		}
+		client = &http.Client{Timeout: timeout}
+	}
+	url := l.URL
+	if url == "" {
+		url = DefaultNotaryLookupURL
+	}
+
+	type record struct {
+		RecordName string `json:"recordName"`
+	}
+	body, err := json.Marshal(struct {
+		Records []record `json:"records"`
+	}{[]record{{RecordName: fmt.Sprintf("2/%d/%x", hashType, cdhash)}}})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid notarization lookup URL %q: %w", url, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up notarization ticket: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to look up notarization ticket: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxNotaryResponseSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up notarization ticket: %w", err)
+	}
+	if len(data) > maxNotaryResponseSize {
+		return nil, fmt.Errorf("notarization lookup response exceeds %d bytes", maxNotaryResponseSize)
+	}
+
+	var result struct {
+		Records []struct {
+			ServerErrorCode string `json:"serverErrorCode"`
+			Reason          string `json:"reason"`
+			Fields          struct {
+				SignedTicket struct {
+					Value string `json:"value"`
+				} `json:"signedTicket"`
+			} `json:"fields"`
+		} `json:"records"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse notarization lookup response: %w", err)
+	}
+	if len(result.Records) == 0 {
+		return nil, errors.New("notarization lookup response has no record")
+	}
+	rec := result.Records[0]
+	switch {
+	case rec.ServerErrorCode == "NOT_FOUND":
+		return nil, nil
+	case rec.ServerErrorCode != "":
+		return nil, fmt.Errorf("notarization lookup failed: %s %s", rec.ServerErrorCode, rec.Reason)
+	}
+	ticket, err := base64.StdEncoding.DecodeString(rec.Fields.SignedTicket.Value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode notarization ticket: %w", err)
+	}
+	if !bytes.HasPrefix(ticket, notaryTicketMagic) {
+		return nil, errors.New("looked up ticket is not a notarization ticket")
+	}
+	return ticket, nil
+}
@@ -0,0 +1,209 @@
+package sigtool
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"debug/macho"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ticketForTest returns a notarization ticket listing cdhashes
+func ticketForTest(cdhashes ...[]byte) []byte {
+	ticket := append([]byte(nil), notaryTicketMagic...)
+	ticket = binary.LittleEndian.AppendUint32(ticket, 1)
+	for _, cdhash := range cdhashes {
+		ticket = append(ticket, 2)
+		ticket = append(ticket, cdhash...)
+	}
+	return append(ticket, bytes.Repeat([]byte{0x5a}, 64)...)
+}
+
+// cdHashForTest returns the CDHash of the SHA-256 code directory cd
+func cdHashForTest(cd []byte) []byte {
+	sum := sha256.Sum256(cd)
+	return sum[:cdHashSize]
+}
+
+// notaryServerForTest serves tickets for the CDHashes in known and counts
+// the lookups
+func notaryServerForTest(t *testing.T, known map[string][]byte, lookups *int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*lookups++
+		var req struct {
+			Records []struct {
+				RecordName string `json:"recordName"`
+			} `json:"records"`
+		}
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || json.Unmarshal(body, &req) != nil || len(req.Records) != 1 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		name := req.Records[0].RecordName
+		if ticket, ok := known[name]; ok {
+			fmt.Fprintf(w, `{"records":[{"recordName":%q,"fields":{"signedTicket":{"type":"BYTES","value":%q}}}]}`,
+				name, base64.StdEncoding.EncodeToString(ticket))
+			return
+		}
+		fmt.Fprintf(w, `{"records":[{"recordName":%q,"reason":"Record not found","serverErrorCode":"NOT_FOUND"}]}`, name)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestInspectNotarization_MachO(t *testing.T) {
+	stapled := machoSignedForTest(t, macho.CpuArm64, []byte("notarized code"), machoSigningForTest{ticket: true})
+	unstapled := machoForTest(t, macho.CpuAmd64, []byte("code"), false)
+	filePath := writeScriptForTest(t, "hello", fatForTest([]macho.Cpu{macho.CpuArm64, macho.CpuAmd64}, [][]byte{stapled, unstapled}))
+
+	info, err := InspectNotarization(filePath, nil)
+	if err != nil {
+		t.Fatalf("InspectNotarization failed: %v", err)
+	}
+	if len(info.Code) != 2 {
+		t.Fatalf("Expected 2 slices, got %d", len(info.Code))
+	}
+	arm, amd := info.Code[0], info.Code[1]
+	if arm.Arch != "arm64" || !arm.Stapled || !arm.Notarized() || len(arm.Bound) != 1 || !bytes.Equal(arm.Bound[0], arm.CDHashes[0]) {
+		t.Errorf("Expected a stapled ticket bound to the arm64 slice, got %+v", arm)
+	}
+	if amd.Stapled || amd.Notarized() || len(amd.CDHashes) != 1 {
+		t.Errorf("Expected the x86_64 slice without a ticket, got %+v", amd)
+	}
+	if info.Notarized() {
+		t.Error("Expected the binary not to be notarized while a slice has no ticket")
+	}
+
+	// Verification ignores a stapled ticket
+	if err := Verify(writeScriptForTest(t, "hello", stapled), &VerifyOptions{Roots: machoRootsForTest(t)}); err != nil {
+		t.Errorf("Expected a valid signature with a stapled ticket, got %v", err)
+	}
+}
+
+func TestInspectNotarization_DiskImage(t *testing.T) {
+	image, cdhash := dmgForTest(t, bytes.Repeat([]byte("disk image data "), 512), false, true)
+	info, err := InspectNotarization(writeScriptForTest(t, "image.dmg", image), nil)
+	if err != nil {
+		t.Fatalf("InspectNotarization failed: %v", err)
+	}
+	if !info.Notarized() || len(info.Code) != 1 || info.Code[0].TicketSize == 0 || !bytes.Equal(info.Code[0].Bound[0], cdhash) {
+		t.Errorf("Expected a stapled ticket bound to the disk image, got %+v", info.Code)
+	}
+
+	// A ticket listing other code does not bind the image
+	i := bytes.Index(image, cdhash)
+	image[i] ^= 0xff
+	info, err = InspectNotarization(writeScriptForTest(t, "image.dmg", image), nil)
+	if err != nil || info.Notarized() || !info.Code[0].Stapled || len(info.Code[0].Bound) != 0 {
+		t.Errorf("Expected a stapled ticket for other code not to bind the image, got %+v, %v", info, err)
+	}
+
+	unsigned := make([]byte, udifTrailerSize)
+	copy(unsigned, udifTrailerMagic)
+	binary.BigEndian.PutUint32(unsigned[4:], udifTrailerVersion)
+	binary.BigEndian.PutUint32(unsigned[8:], udifTrailerSize)
+	info, err = InspectNotarization(writeScriptForTest(t, "unsigned.dmg", unsigned), nil)
+	if err != nil || info.Notarized() || len(info.Code) != 1 || info.Code[0].CDHashes != nil {
+		t.Errorf("Expected an unsigned disk image to be reported as not notarized, got %+v, %v", info, err)
+	}
+
+	if _, err := InspectNotarization(writeScriptForTest(t, "file.txt", []byte("not an image")), nil); err == nil {
+		t.Error("Expected an error for a file that is neither Mach-O nor a disk image")
+	}
+}
+
+func TestInspectNotarization_Lookup(t *testing.T) {
+	image, cdhash := dmgForTest(t, []byte("disk image data"), false, false)
+	filePath := writeScriptForTest(t, "image.dmg", image)
+	var lookups int
+	server := notaryServerForTest(t, map[string][]byte{
+		fmt.Sprintf("2/%d/%x", csHashSHA256, cdhash): ticketForTest(cdhash),
+	}, &lookups)
+
+	info, err := InspectNotarization(filePath, nil)
+	if err != nil || info.Notarized() || lookups != 0 {
+		t.Fatalf("Expected no lookup and no ticket without a NotaryLookup, got %+v, %v", info, err)
+	}
+	info, err = InspectNotarization(filePath, &NotaryLookup{URL: server.URL})
+	if err != nil {
+		t.Fatalf("InspectNotarization failed: %v", err)
+	}
+	if code := info.Code[0]; !code.Online || code.Stapled || code.LookupErr != nil || !info.Notarized() {
+		t.Errorf("Expected the lookup to find a ticket, got %+v", code)
+	}
+
+	other, _ := dmgForTest(t, []byte("other data"), false, false)
+	info, err = InspectNotarization(writeScriptForTest(t, "other.dmg", other), &NotaryLookup{URL: server.URL})
+	if err != nil || info.Notarized() || info.Code[0].LookupErr != nil {
+		t.Errorf("Expected no ticket for unknown code, got %+v, %v", info, err)
+	}
+}
+
+func TestInspectNotarizationContext_Cancelled(t *testing.T) {
+	image, _ := dmgForTest(t, []byte("disk image data"), false, false)
+	filePath := writeScriptForTest(t, "image.dmg", image)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	info, err := InspectNotarizationContext(context.Background(), filePath, nil)
+	if err != nil || len(info.Code) != 1 || info.Notarized() {
+		t.Fatalf("Expected an unnotarized disk image, got %+v, %v", info, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := InspectNotarizationContext(ctx, filePath, &NotaryLookup{URL: server.URL, Timeout: time.Minute}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline to abort the ticket lookup, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the ticket lookup to stop at the deadline, took %v", elapsed)
+	}
+}
+
+func TestNotaryLookup_Errors(t *testing.T) {
+	cdhash := bytes.Repeat([]byte{1}, cdHashSize)
+	tests := []struct {
+		name     string
+		status   int
+		response string
+		wantErr  string
+	}{
+		{"status", http.StatusServiceUnavailable, "", "503"},
+		{"malformed", http.StatusOK, "{", "failed to parse"},
+		{"no record", http.StatusOK, `{"records":[]}`, "no record"},
+		{"server error", http.StatusOK, `{"records":[{"serverErrorCode":"ACCESS_DENIED","reason":"denied"}]}`, "ACCESS_DENIED"},
+		{"not a ticket", http.StatusOK, `{"records":[{"fields":{"signedTicket":{"value":"` + base64.StdEncoding.EncodeToString([]byte("xxxx")) + `"}}}]}`, "not a notarization ticket"},
+		{"too large", http.StatusOK, strings.Repeat(" ", maxNotaryResponseSize+1), "exceeds"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.response)
+			}))
+			defer server.Close()
+			_, err := (&NotaryLookup{URL: server.URL}).Lookup(cdhash, csHashSHA256)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
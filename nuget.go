@@ -0,0 +1,484 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.mozilla.org/pkcs7"
+)
+
+// nugetSignatureFile is the package member holding the signature of a
+// NuGet package, which must be stored uncompressed as its last member
+const nugetSignatureFile = ".signature.p7s"
+
+var (
+	// oidCommitmentTypeIndication is the CAdES commitment-type-indication
+	// attribute, which says whether a NuGet signature is an author or a
+	// repository signature
+	oidCommitmentTypeIndication = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 16}
+	// oidProofOfOrigin and oidProofOfReceipt are the commitment types of
+	// author and repository signatures
+	oidProofOfOrigin  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 6, 1}
+	oidProofOfReceipt = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 6, 2}
+	// oidNuGetServiceIndex and oidNuGetPackageOwners are the authenticated
+	// attributes of a repository signature naming the repository and the
+	// package owners it lists
+	oidNuGetServiceIndex  = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 84, 2, 1, 1, 1}
+	oidNuGetPackageOwners = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 84, 2, 1, 1, 2}
+)
+
+// NuGetSignatureType identifies who signed a NuGet package.
+type NuGetSignatureType string
+
+const (
+	// NuGetAuthorSignature is the signature of the package author
+	NuGetAuthorSignature NuGetSignatureType = "Author"
+	// NuGetRepositorySignature is the signature of the repository that
+	// published the package, either as the primary signature or as a
+	// countersignature of the author signature
+	NuGetRepositorySignature NuGetSignatureType = "Repository"
+)
+
+// NuGetSignature describes one signature of a NuGet package.
+type NuGetSignature struct {
+	// Type is whether the package author or a repository signed
+	Type NuGetSignatureType
+	// Signer is the certificate that produced the signature
+	Signer *CertificateInfo
+	// Timestamp describes the RFC 3161 timestamp of the signature, when
+	// present
+	Timestamp *TimestampInfo `json:",omitempty"`
+	// ServiceIndex is the NuGet V3 service index URL of a repository
+	ServiceIndex string `json:",omitempty"`
+	// Owners lists the package owners a repository signature records
+	Owners []string `json:",omitempty"`
+}
+
+// NuGetPackageInfo describes a NuGet package and its signatures.
+type NuGetPackageInfo struct {
+	// ID and Version are the package id and version from its .nuspec
+	ID      string
+	Version string
+	// ContentHashAlgorithm and ContentHash are the package content hash
+	// recorded in the signature
+	ContentHashAlgorithm crypto.Hash `json:",omitempty"`
+	ContentHash          []byte      `json:",omitempty"`
+	// Signatures lists the primary signature followed by its repository
+	// countersignature, when present; it is empty for unsigned packages
+	Signatures []NuGetSignature `json:",omitempty"`
+}
+
+// nuspec is the part of a package manifest that InspectNuGet reads
+type nuspec struct {
+	Metadata struct {
+		ID      string `xml:"id"`
+		Version string `xml:"version"`
+	} `xml:"metadata"`
+}
+
+// InspectNuGet reads the id and version of a NuGet package and decodes its
+// author and repository signatures, with their timestamps and the package
+// content hash they record.
+//
+// InspectNuGet does not verify the signatures; use Verify, which also
+// checks the content hash against the package.
+//
+// Parameters:
+//   - filePath: The path to the .nupkg or .snupkg file
+//
+// Returns:
+//   - *NuGetPackageInfo: The package identity and signatures
+//   - error: ErrNotZipArchive if the file is not a ZIP archive, or an error
+//     if it has no .nuspec manifest or its signature cannot be parsed
+//
+// Example usage:
+//
+//	info, err := sigtool.InspectNuGet("newtonsoft.json.13.0.3.nupkg")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	for _, sig := range info.Signatures {
+//	    fmt.Println(sig.Type, sig.Signer.Subject)
+//	}
+func InspectNuGet(filePath string) (*NuGetPackageInfo, error) {
+	if strings.TrimSpace(filePath) == "" {
+		return nil, errors.New("file path cannot be empty")
+	}
+
+	// #nosec G304 - This tool is designed to read user-specified files
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %q: %w", filePath, err)
+	}
+	defer f.Close()
+
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+	a, err := openZipArchive(f, fileInfo.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	info := &NuGetPackageInfo{}
+	manifest := nuspecEntry(a)
+	if manifest == nil {
+		return nil, errors.New("package has no .nuspec manifest")
+	}
+	data, err := a.readFile(manifest.name)
+	if err != nil {
+		return nil, err
+	}
+	var spec nuspec
+	if err := xml.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("failed to parse package manifest: %w", err)
+	}
+	info.ID, info.Version = spec.Metadata.ID, spec.Metadata.Version
+
+	signature, err := nugetSignature(a)
+	if errors.Is(err, ErrNotSigned) {
+		return info, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	p7, err := parsePKCS7(signature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS#7 signature: %w", err)
+	}
+	if info.ContentHashAlgorithm, info.ContentHash, err = storedDigest(p7); err != nil {
+		return nil, err
+	}
+
+	signer, err := signerCertificate(p7)
+	if err != nil {
+		return nil, err
+	}
+	primary, err := newNuGetSignature(signer, authenticatedAttributes(p7), unauthenticatedAttributes(p7))
+	if err != nil {
+		return nil, err
+	}
+	info.Signatures = append(info.Signatures, *primary)
+
+	if primary.Type != NuGetAuthorSignature {
+		return info, nil
+	}
+	cs, err := repositoryCounterSignature(p7)
+	if err != nil || cs == nil {
+		return info, err
+	}
+	repository := findCertificate(p7, cs.IssuerAndSerialNumber)
+	if repository == nil {
+		return nil, fmt.Errorf("%w: repository countersignature serial %x", ErrSignerCertificateNotFound, cs.IssuerAndSerialNumber.SerialNumber)
+	}
+	countersignature, err := newNuGetSignature(repository, cs.AuthenticatedAttributes, cs.UnauthenticatedAttributes)
+	if err != nil {
+		return nil, err
+	}
+	info.Signatures = append(info.Signatures, *countersignature)
+	return info, nil
+}
+
+// newNuGetSignature describes the signature of signer with the
+// authenticated attributes signed and the unauthenticated attributes
+// unsigned
+func newNuGetSignature(signer *x509.Certificate, signed, unsigned []attribute) (*NuGetSignature, error) {
+	signatureType, err := nugetCommitmentType(signed)
+	if err != nil {
+		return nil, err
+	}
+	sig := &NuGetSignature{Type: signatureType, Signer: newCertificateInfo(signer)}
+	if value, ok := findAttribute(unsigned, oidTimestampToken); ok {
+		token, info, err := parseTimestampToken(value)
+		if err != nil {
+			return nil, err
+		}
+		sig.Timestamp = &TimestampInfo{Type: TimestampRFC3161, Time: info.GenTime}
+		if tsa := token.GetOnlySigner(); tsa != nil {
+			sig.Timestamp.Signer = newCertificateInfo(tsa)
+		}
+	}
+	if value, ok := findAttribute(signed, oidNuGetServiceIndex); ok {
+		if _, err := asn1.Unmarshal(value, &sig.ServiceIndex); err != nil {
+			return nil, fmt.Errorf("failed to parse NuGet service index attribute: %w", err)
+		}
+	}
+	if value, ok := findAttribute(signed, oidNuGetPackageOwners); ok {
+		if _, err := asn1.Unmarshal(value, &sig.Owners); err != nil {
+			return nil, fmt.Errorf("failed to parse NuGet package owners attribute: %w", err)
+		}
+	}
+	return sig, nil
+}
+
+// nugetCommitmentType returns the signature type the commitment-type
+// indication among the authenticated attributes attrs declares
+func nugetCommitmentType(attrs []attribute) (NuGetSignatureType, error) {
+	value, ok := findAttribute(attrs, oidCommitmentTypeIndication)
+	if !ok {
+		return "", errors.New("NuGet signature has no commitment-type-indication attribute")
+	}
+	var indication struct {
+		ID         asn1.ObjectIdentifier
+		Qualifiers asn1.RawValue `asn1:"optional"`
+	}
+	if _, err := asn1.Unmarshal(value, &indication); err != nil {
+		return "", fmt.Errorf("failed to parse commitment-type-indication attribute: %w", err)
+	}
+	switch {
+	case indication.ID.Equal(oidProofOfOrigin):
+		return NuGetAuthorSignature, nil
+	case indication.ID.Equal(oidProofOfReceipt):
+		return NuGetRepositorySignature, nil
+	}
+	return "", fmt.Errorf("unsupported NuGet commitment type %s", indication.ID)
+}
+
+// repositoryCounterSignature returns the repository countersignature of the
+// author signature p7, or nil when it has none
+func repositoryCounterSignature(p7 *pkcs7.PKCS7) (*signerInfo, error) {
+	for _, attr := range unauthenticatedAttributes(p7) {
+		if !attr.Type.Equal(oidCounterSignature) {
+			continue
+		}
+		var cs signerInfo
+		if _, err := asn1.Unmarshal(attr.Value.Bytes, &cs); err != nil {
+			return nil, fmt.Errorf("failed to parse countersignature: %w", err)
+		}
+		if _, ok := findAttribute(cs.AuthenticatedAttributes, oidCommitmentTypeIndication); ok {
+			return &cs, nil
+		}
+	}
+	return nil, nil
+}
+
+// nuspecEntry returns the package manifest of a, the .nuspec member at the
+// root of the archive, or nil when it has none
+func nuspecEntry(a *zipArchive) *zipEntry {
+	for i, e := range a.entries {
+		if !strings.Contains(e.name, "/") && strings.HasSuffix(strings.ToLower(e.name), ".nuspec") {
+			return &a.entries[i]
+		}
+	}
+	return nil
+}
+
+// isNuGetPackage reports whether the ZIP archive a is a NuGet package, which
+// always has a .nuspec manifest at its root
+func isNuGetPackage(a *zipArchive) bool {
+	return nuspecEntry(a) != nil
+}
+
+// readNuGetSignature returns the PKCS#7 signature of the NuGet package r
+func readNuGetSignature(r io.ReaderAt, size int64) ([]byte, error) {
+	a, err := openZipArchive(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return nugetSignature(a)
+}
+
+// nugetSignature returns the signature of a from .signature.p7s
+func nugetSignature(a *zipArchive) ([]byte, error) {
+	e := a.entry(nugetSignatureFile)
+	if e == nil {
+		return nil, fmt.Errorf("%w (package has no %s)", ErrNotSigned, nugetSignatureFile)
+	}
+	// The method of a central directory record is at offset 10
+	if method := binary.LittleEndian.Uint16(e.header[10:]); method != 0 {
+		return nil, fmt.Errorf("%s must be stored uncompressed, not with method %d", nugetSignatureFile, method)
+	}
+	data, err := a.readFile(nugetSignatureFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxSignatureSize {
+		return nil, &SignatureSizeError{Size: int64(len(data)), Limit: MaxSignatureSize}
+	}
+	return data, nil
+}
+
+// isNuGetSignatureContent reports whether content, the signed content of a
+// PKCS#7 signature, is the header block of a NuGet package signature
+func isNuGetSignatureContent(content []byte) bool {
+	return bytes.HasPrefix(content, []byte("Version:"))
+}
+
+// parseNuGetSignatureContent decodes the package content hash from the
+// signed content of a NuGet package signature: a Version:1 header followed
+// by a <digest algorithm OID>-Hash header with the base64 hash, each header
+// block ending with an empty line
+func parseNuGetSignatureContent(content []byte) (crypto.Hash, []byte, error) {
+	var version string
+	for _, line := range strings.Split(string(content), "\r\n") {
+		if line == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return 0, nil, fmt.Errorf("malformed NuGet signature content line %q", line)
+		}
+		if name == "Version" {
+			version = value
+			continue
+		}
+		oid, ok := strings.CutSuffix(name, "-Hash")
+		if !ok || version != "1" {
+			continue
+		}
+		algorithm, err := hashForOID(parseOIDString(oid))
+		if err != nil {
+			return 0, nil, err
+		}
+		hash, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to decode NuGet package hash: %w", err)
+		}
+		return algorithm, hash, nil
+	}
+	if version != "1" {
+		return 0, nil, fmt.Errorf("unsupported NuGet signature content version %q", version)
+	}
+	return 0, nil, errors.New("NuGet signature content has no package hash")
+}
+
+// parseOIDString parses the dotted decimal form of an object identifier,
+// returning nil when it is malformed
+func parseOIDString(s string) asn1.ObjectIdentifier {
+	var oid asn1.ObjectIdentifier
+	for _, arc := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(arc)
+		if err != nil || n < 0 {
+			return nil
+		}
+		oid = append(oid, n)
+	}
+	return oid
+}
+
+// verifyNuGet performs full verification of the NuGet package in r: unless
+// disabled, the hash of the package without its signature must match the
+// signed content hash; the primary signature, its timestamp and chain, and
+// the repository countersignature of an author signature are checked per
+// opts.
+func verifyNuGet(r io.ReaderAt, size int64, opts VerifyOptions) error {
+	a, err := openZipArchive(r, size)
+	if err != nil {
+		return fmt.Errorf("failed to extract signature: %w", err)
+	}
+	signature, err := nugetSignature(a)
+	if err != nil {
+		return fmt.Errorf("failed to extract signature: %w", err)
+	}
+	opts.logger().Debug("read package signature", "fileSize", size, "size", len(signature))
+
+	p7, err := parsePKCS7(signature)
+	if err != nil {
+		return fmt.Errorf("failed to parse PKCS#7 signature: %w", err)
+	}
+	if !isNuGetSignatureContent(p7.Content) {
+		return fmt.Errorf("%w: signature content is not a NuGet package hash", ErrInvalidSignature)
+	}
+	if !opts.SkipContentDigest {
+		algorithm, stored, err := storedDigest(p7)
+		if err != nil {
+			return err
+		}
+		if !algorithm.Available() {
+			return fmt.Errorf("hash algorithm %v is not available", algorithm)
+		}
+		h := algorithm.New()
+		if err := a.writeWithout(nugetSignatureFile, h, h); err != nil {
+			return err
+		}
+		if computed := h.Sum(nil); subtle.ConstantTimeCompare(stored, computed) != 1 {
+			return &DigestMismatchError{Algorithm: algorithm, Signed: stored, Computed: computed}
+		}
+	}
+	return verifyNuGetSignature(p7, opts)
+}
+
+// verifyNuGetSignature checks the primary signature of a NuGet package and
+// its timestamp, then the certificates of its signer per opts, and then the
+// repository countersignature of an author signature
+func verifyNuGetSignature(p7 *pkcs7.PKCS7, opts VerifyOptions) error {
+	if err := verifySignerSignature(p7); err != nil {
+		return err
+	}
+	signer, err := signerCertificate(p7)
+	if err != nil {
+		return err
+	}
+	signatureType, err := nugetCommitmentType(authenticatedAttributes(p7))
+	if err != nil {
+		return err
+	}
+
+	trust, err := resolveTrust(opts)
+	if err != nil {
+		return err
+	}
+	signed := p7.Signers[0].EncryptedDigest
+	signingTime, err := verifyTimestampAttribute(unauthenticatedAttributes(p7), signed, trust)
+	if err != nil {
+		return err
+	}
+	weak, err := weakSignatureFindings(p7, 0)
+	if err != nil {
+		return err
+	}
+	if err := verifyCertificateTrust(signer, p7.Certificates, weak, opts, trust, signingTime); err != nil {
+		return err
+	}
+
+	cs, err := repositoryCounterSignature(p7)
+	if err != nil || cs == nil {
+		return err
+	}
+	if signatureType != NuGetAuthorSignature {
+		return fmt.Errorf("%w: a repository signature cannot have a repository countersignature", ErrInvalidSignature)
+	}
+	return verifyRepositoryCounterSignature(p7, cs, signed, opts, trust)
+}
+
+// verifyRepositoryCounterSignature checks the repository countersignature cs
+// over signed, the signature of the author signature p7, and its timestamp
+// and certificates. The signer pins and trusted publishers of opts select
+// the author, so they do not apply to the repository.
+func verifyRepositoryCounterSignature(p7 *pkcs7.PKCS7, cs *signerInfo, signed []byte, opts VerifyOptions, trust *trustConfig) error {
+	if signatureType, err := nugetCommitmentType(cs.AuthenticatedAttributes); err != nil {
+		return err
+	} else if signatureType != NuGetRepositorySignature {
+		return fmt.Errorf("%w: countersignature is not a repository signature", ErrInvalidSignature)
+	}
+	repository, err := verifyCounterSigner(p7, cs, signed)
+	if err != nil {
+		return fmt.Errorf("%w: repository %w", ErrInvalidSignature, err)
+	}
+	signingTime, err := verifyTimestampAttribute(cs.UnauthenticatedAttributes, cs.EncryptedDigest, trust)
+	if err != nil {
+		return fmt.Errorf("repository countersignature: %w", err)
+	}
+
+	opts.RequiredThumbprints, opts.RequiredSubjects = nil, nil
+	repositoryTrust := *trust
+	repositoryTrust.publishers = nil
+	weak := weakCertificateFindings(p7.Certificates, 0)
+	if err := verifyCertificateTrust(repository, p7.Certificates, weak, opts, &repositoryTrust, signingTime); err != nil {
+		return fmt.Errorf("repository countersignature: %w", err)
+	}
+	return nil
+}
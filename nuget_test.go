@@ -0,0 +1,303 @@
+package sigtool
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// nugetServiceIndexForTest is the repository a test repository signature
+// names
+const nugetServiceIndexForTest = "https://api.nuget.org/v3/index.json"
+
+// nugetMembersForTest are the members of test packages
+var nugetMembersForTest = []zipMemberForTest{
+	{"Sigtool.Test.nuspec", []byte(`<?xml version="1.0" encoding="utf-8"?><package xmlns="http://schemas.microsoft.com/packaging/2013/05/nuspec.xsd"><metadata><id>Sigtool.Test</id><version>1.2.3</version><authors>sigtool</authors></metadata></package>`)},
+	{"lib/net8.0/Sigtool.Test.dll", bytes.Repeat([]byte("sigtool library "), 1000)},
+	{"[Content_Types].xml", []byte(`<?xml version="1.0" encoding="utf-8"?><Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="dll" ContentType="application/octet"/></Types>`)},
+}
+
+// nupkgForTest builds a package of members, deflating each as zipForTest
+// does, followed by signature as a stored .signature.p7s when it is not nil
+func nupkgForTest(t *testing.T, members []zipMemberForTest, signature []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	modified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	write := func(header *zip.FileHeader, data []byte) {
+		f, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatalf("Failed to create %s: %v", header.Name, err)
+		}
+		if _, err := f.Write(data); err != nil {
+			t.Fatalf("Failed to write %s: %v", header.Name, err)
+		}
+	}
+	for _, m := range members {
+		write(&zip.FileHeader{Name: m.name, Method: zip.Deflate, Modified: modified}, m.data)
+	}
+	if signature != nil {
+		write(&zip.FileHeader{Name: nugetSignatureFile, Method: zip.Store, Modified: modified}, signature)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to write archive: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// nugetContentForTest returns the signed content of a NuGet signature of
+// the unsigned package pkg
+func nugetContentForTest(pkg []byte) []byte {
+	sum := sha256.Sum256(pkg)
+	return []byte("Version:1\r\n\r\n2.16.840.1.101.3.4.2.1-Hash:" + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+}
+
+// commitmentTypeForTest returns the commitment-type-indication attribute
+// of a signature of commitment type oid
+func commitmentTypeForTest(t testing.TB, oid asn1.ObjectIdentifier) testAttribute {
+	return testAttr(t, oidCommitmentTypeIndication, struct{ ID asn1.ObjectIdentifier }{oid})
+}
+
+// signNuGetForTest returns a CMS signature by id over content, an id-data
+// content, with the authenticated attributes attrs after the content type,
+// signing time and message digest, and timestamped by the test TSA
+func signNuGetForTest(t *testing.T, id *testIdentity, content []byte, attrs []testAttribute, mutators ...func(*testSignerInfo)) []byte {
+	t.Helper()
+
+	algID := pkix.AlgorithmIdentifier{Algorithm: oidDigestSHA256, Parameters: asn1.NullRawValue}
+	oidData := asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	now := time.Now().UTC().Truncate(time.Second)
+	digest := sha256.Sum256(content)
+	attrs = append([]testAttribute{
+		testAttr(t, oidAttributeContentType, oidData),
+		testAttr(t, oidAttributeSigningTime, now),
+		testAttr(t, oidAttributeMessageDigest, digest[:]),
+	}, attrs...)
+
+	si := testSignerInfo{
+		Version: 1,
+		IssuerAndSerialNumber: testIssuerAndSerial{
+			IssuerName:   asn1.RawValue{FullBytes: id.Cert.RawIssuer},
+			SerialNumber: id.Cert.SerialNumber,
+		},
+		DigestAlgorithm:         algID,
+		AuthenticatedAttributes: attrs,
+		DigestEncryptionAlgorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1},
+			Parameters: asn1.NullRawValue,
+		},
+		EncryptedDigest: signAttributesWithKeyForTest(t, attrs, crypto.SHA256, id.Key),
+	}
+	imprint := sha256.Sum256(si.EncryptedDigest)
+	si.UnauthenticatedAttributes = append(si.UnauthenticatedAttributes,
+		testAttr(t, oidTimestampToken, asn1.RawValue{FullBytes: timestampTokenForTest(t, imprint[:], now)}))
+	for _, mutate := range mutators {
+		mutate(&si)
+	}
+
+	octets, err := asn1.Marshal(content)
+	if err != nil {
+		t.Fatalf("Failed to marshal content: %v", err)
+	}
+	certs := append([]byte(nil), id.Cert.Raw...)
+	for _, c := range id.Chain {
+		certs = append(certs, c.Raw...)
+	}
+	sd, err := asn1.Marshal(testSignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{algID},
+		ContentInfo: testContentInfo{
+			ContentType: oidData,
+			Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: octets},
+		},
+		Certificates: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs},
+		SignerInfos:  []testSignerInfo{si},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal SignedData: %v", err)
+	}
+	p7, err := asn1.Marshal(testContentInfo{
+		ContentType: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2},
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal ContentInfo: %v", err)
+	}
+	return p7
+}
+
+// withRepositoryCounterSignature adds a repository countersignature by
+// repository, timestamped by the test TSA, whose certificate the author
+// signature must embed
+func withRepositoryCounterSignature(t *testing.T, repository *testIdentity) func(*testSignerInfo) {
+	return func(si *testSignerInfo) {
+		t.Helper()
+
+		now := time.Now().UTC().Truncate(time.Second)
+		digest := sha256.Sum256(si.EncryptedDigest)
+		attrs := []testAttribute{
+			testAttr(t, oidAttributeContentType, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}),
+			testAttr(t, oidAttributeSigningTime, now),
+			testAttr(t, oidAttributeMessageDigest, digest[:]),
+			commitmentTypeForTest(t, oidProofOfReceipt),
+			testAttr(t, oidNuGetServiceIndex, asn1.RawValue{Tag: asn1.TagIA5String, Bytes: []byte(nugetServiceIndexForTest)}),
+			testAttr(t, oidNuGetPackageOwners, []string{"sigtool", "konidev20"}),
+		}
+		cs := testSignerInfo{
+			Version: 1,
+			IssuerAndSerialNumber: testIssuerAndSerial{
+				IssuerName:   asn1.RawValue{FullBytes: repository.Cert.RawIssuer},
+				SerialNumber: repository.Cert.SerialNumber,
+			},
+			DigestAlgorithm:         pkix.AlgorithmIdentifier{Algorithm: oidDigestSHA256, Parameters: asn1.NullRawValue},
+			AuthenticatedAttributes: attrs,
+			DigestEncryptionAlgorithm: pkix.AlgorithmIdentifier{
+				Algorithm:  asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1},
+				Parameters: asn1.NullRawValue,
+			},
+			EncryptedDigest: signAttributesWithKeyForTest(t, attrs, crypto.SHA256, repository.Key),
+		}
+		imprint := sha256.Sum256(cs.EncryptedDigest)
+		cs.UnauthenticatedAttributes = []testAttribute{
+			testAttr(t, oidTimestampToken, asn1.RawValue{FullBytes: timestampTokenForTest(t, imprint[:], now)}),
+		}
+		si.UnauthenticatedAttributes = append(si.UnauthenticatedAttributes, testAttr(t, oidCounterSignature, cs))
+	}
+}
+
+// writeNuGetForTest writes a package of members with signature and returns
+// its path
+func writeNuGetForTest(t *testing.T, members []zipMemberForTest, signature []byte) string {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), "sigtool.test.1.2.3.nupkg")
+	if err := os.WriteFile(filePath, nupkgForTest(t, members, signature), 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	return filePath
+}
+
+// testAuthorForTest returns the test signer identity, embedding extra
+// alongside it
+func testAuthorForTest(t *testing.T, extra ...*x509.Certificate) *testIdentity {
+	cert, key := testSigner(t)
+	return &testIdentity{Cert: cert, Key: key, Chain: extra}
+}
+
+func TestVerify_NuGet(t *testing.T) {
+	content := nugetContentForTest(nupkgForTest(t, nugetMembersForTest, nil))
+	signature := signNuGetForTest(t, testAuthorForTest(t), content, []testAttribute{commitmentTypeForTest(t, oidProofOfOrigin)})
+	filePath := writeNuGetForTest(t, nugetMembersForTest, signature)
+
+	if fileType, err := DetectFileType(filePath); err != nil || fileType != FileTypeNuGet {
+		t.Fatalf("Expected FileTypeNuGet, got %q (%v)", fileType, err)
+	}
+	if err := Verify(filePath, &VerifyOptions{Roots: testRootsWithTSA(t)}); err != nil {
+		t.Fatalf("Expected valid package, got %v", err)
+	}
+
+	info, err := Inspect(filePath)
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	if info.DigestAlgorithm != crypto.SHA256 || info.Timestamp == nil || info.Timestamp.Type != TimestampRFC3161 {
+		t.Errorf("Expected a SHA-256 content hash and RFC 3161 timestamp, got %v and %+v", info.DigestAlgorithm, info.Timestamp)
+	}
+
+	pkg, err := InspectNuGet(filePath)
+	if err != nil {
+		t.Fatalf("InspectNuGet failed: %v", err)
+	}
+	if pkg.ID != "Sigtool.Test" || pkg.Version != "1.2.3" {
+		t.Errorf("Expected Sigtool.Test 1.2.3, got %s %s", pkg.ID, pkg.Version)
+	}
+	if len(pkg.Signatures) != 1 || pkg.Signatures[0].Type != NuGetAuthorSignature || pkg.Signatures[0].Timestamp == nil {
+		t.Fatalf("Expected one timestamped author signature, got %+v", pkg.Signatures)
+	}
+	if pkg.Signatures[0].Signer.CommonName != "sigtool test signer" {
+		t.Errorf("Expected the test signer, got %s", pkg.Signatures[0].Signer.Subject)
+	}
+}
+
+func TestVerify_NuGetRepositoryCounterSignature(t *testing.T) {
+	repository := issueCertificateForTest(t, testLeafTemplate("sigtool test repository", 3001, x509.ExtKeyUsageCodeSigning), nil)
+	content := nugetContentForTest(nupkgForTest(t, nugetMembersForTest, nil))
+	signature := signNuGetForTest(t, testAuthorForTest(t, repository.Cert), content,
+		[]testAttribute{commitmentTypeForTest(t, oidProofOfOrigin)}, withRepositoryCounterSignature(t, repository))
+	filePath := writeNuGetForTest(t, nugetMembersForTest, signature)
+
+	roots := testRootsWithTSA(t)
+	roots.AddCert(repository.Cert)
+	author, _ := testSigner(t)
+	opts := &VerifyOptions{Roots: roots, RequiredThumbprints: []string{newCertificateInfo(author).SHA256Thumbprint}}
+	if err := Verify(filePath, opts); err != nil {
+		t.Fatalf("Expected valid package, got %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{Roots: testRootsWithTSA(t)}); !errors.Is(err, ErrChainVerification) {
+		t.Errorf("Expected ErrChainVerification for an untrusted repository, got %v", err)
+	}
+
+	pkg, err := InspectNuGet(filePath)
+	if err != nil {
+		t.Fatalf("InspectNuGet failed: %v", err)
+	}
+	if len(pkg.Signatures) != 2 {
+		t.Fatalf("Expected author and repository signatures, got %+v", pkg.Signatures)
+	}
+	repo := pkg.Signatures[1]
+	if repo.Type != NuGetRepositorySignature || repo.ServiceIndex != nugetServiceIndexForTest || len(repo.Owners) != 2 || repo.Timestamp == nil {
+		t.Errorf("Unexpected repository signature %+v", repo)
+	}
+	if repo.Signer.CommonName != "sigtool test repository" {
+		t.Errorf("Expected the test repository, got %s", repo.Signer.Subject)
+	}
+
+	// The timestamp of an author signature is not its countersignature
+	info, err := Inspect(filePath)
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	if info.Timestamp == nil || info.Timestamp.Type != TimestampRFC3161 {
+		t.Errorf("Expected the RFC 3161 timestamp, got %+v", info.Timestamp)
+	}
+}
+
+func TestVerify_NuGetTampered(t *testing.T) {
+	content := nugetContentForTest(nupkgForTest(t, nugetMembersForTest, nil))
+	signature := signNuGetForTest(t, testAuthorForTest(t), content, []testAttribute{commitmentTypeForTest(t, oidProofOfOrigin)})
+
+	tampered := append([]zipMemberForTest(nil), nugetMembersForTest...)
+	tampered[1] = zipMemberForTest{tampered[1].name, bytes.Repeat([]byte("sigtool malware "), 1000)}
+	filePath := writeNuGetForTest(t, tampered, signature)
+
+	if err := Verify(filePath, nil); !errors.Is(err, ErrDigestMismatch) {
+		t.Fatalf("Expected ErrDigestMismatch, got %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{SkipContentDigest: true}); err != nil {
+		t.Errorf("Expected the signature alone to verify, got %v", err)
+	}
+}
+
+func TestVerify_NuGetUnsigned(t *testing.T) {
+	filePath := writeNuGetForTest(t, nugetMembersForTest, nil)
+
+	if err := Verify(filePath, nil); !errors.Is(err, ErrNotSigned) {
+		t.Fatalf("Expected ErrNotSigned, got %v", err)
+	}
+	pkg, err := InspectNuGet(filePath)
+	if err != nil {
+		t.Fatalf("InspectNuGet failed: %v", err)
+	}
+	if pkg.ID != "Sigtool.Test" || len(pkg.Signatures) != 0 {
+		t.Errorf("Expected an unsigned Sigtool.Test, got %+v", pkg)
+	}
+}
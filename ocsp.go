@@ -0,0 +1,227 @@
+package sigtool
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	// DefaultOCSPTimeout bounds each OCSP request
+	DefaultOCSPTimeout = 10 * time.Second
+	// maxOCSPResponseSize bounds the size of an OCSP response
+	maxOCSPResponseSize = 1 << 20
+)
+
+// OCSPChecker checks certificates against the OCSP responders named in
+// their Authority Information Access extension. Responses are cached until
+// their nextUpdate time, so a checker can be shared across verifications; it
+// is safe for concurrent use.
+//
+// A certificate is rejected when the responder reports it revoked at or
+// before the verification time, which for timestamped signatures is the
+// timestamp time: signatures made before a key compromise stay valid while
+// signatures made with a stolen certificate afterwards do not.
+//
+// By default checking soft-fails: when no responder is named, the responder
+// cannot be reached or it answers "unknown", the certificate is accepted.
+// With HardFail set such certificates fail with ErrRevocationUnknown.
+type OCSPChecker struct {
+	// Client performs the requests. When nil, a client with Timeout is used.
+	Client *http.Client
+	// Timeout bounds each request when Client is nil. Zero means
+	// DefaultOCSPTimeout.
+	Timeout time.Duration
+	// HardFail rejects certificates whose revocation status cannot be
+	// determined
+	HardFail bool
+
+	mu    sync.Mutex
+	cache map[string]*ocsp.Response
+}
+
+// NewOCSPChecker returns an OCSPChecker that bounds each request by timeout.
+//
+// Parameters:
+//   - timeout: The per-request timeout, or 0 for DefaultOCSPTimeout
+//   - hardFail: Whether an undeterminable status fails verification
+//
+// Returns:
+//   - *OCSPChecker: A checker with an empty cache
+//
+// Example usage:
+//
+//	err := sigtool.Verify("signed.exe", &sigtool.VerifyOptions{
+//	    UseSystemRoots: true,
+//	    OCSP:           sigtool.NewOCSPChecker(5*time.Second, true),
+//	})
+//	if errors.Is(err, sigtool.ErrCertificateRevoked) {
+//	    fmt.Println("Signed with a revoked certificate")
+//	}
+func NewOCSPChecker(timeout time.Duration, hardFail bool) *OCSPChecker {
+	return &OCSPChecker{Timeout: timeout, HardFail: hardFail}
+}
+
+// CheckChain checks every certificate of chain except the last against its
+// issuer, the next certificate in chain. The last certificate is the trust
+// anchor and is not checked.
+//
+// Parameters:
+//   - chain: A validated chain ordered from leaf to root
+//   - at: The verification time revocations are compared with
+//
+// Returns:
+//   - error: A *RevocationError for a revoked certificate, an error matching
+//     ErrRevocationUnknown in hard-fail mode, or nil
+func (c *OCSPChecker) CheckChain(chain []*x509.Certificate, at time.Time) error {
+	return checkChainRevocation(context.Background(), chain, at, c.HardFail, c)
+}
+
+// revocationStatus returns the OCSP status of cert issued by issuer
+func (c *OCSPChecker) revocationStatus(ctx context.Context, cert, issuer *x509.Certificate) (*certificateStatus, error) {
+	resp, err := c.status(ctx, cert, issuer)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.Status {
+	case ocsp.Good:
+		return &certificateStatus{}, nil
+	case ocsp.Revoked:
+		return &certificateStatus{revoked: true, revokedAt: resp.RevokedAt, reason: resp.RevocationReason}, nil
+	default:
+		return nil, errors.New("OCSP responder does not know the certificate")
+	}
+}
+
+// status returns a current OCSP response for cert from the cache or the
+// responders named by cert
+func (c *OCSPChecker) status(ctx context.Context, cert, issuer *x509.Certificate) (*ocsp.Response, error) {
+	key := ocspCacheKey(cert, issuer)
+	c.mu.Lock()
+	cached, ok := c.cache[key]
+	c.mu.Unlock()
+	if ok && checkOCSPFreshness(cached, time.Now()) == nil {
+		return cached, nil
+	}
+
+	if len(cert.OCSPServer) == 0 {
+		return nil, errors.New("certificate names no OCSP responder")
+	}
+	request, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OCSP request: %w", err)
+	}
+
+	var lastErr error
+	for _, url := range cert.OCSPServer {
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			continue
+		}
+		resp, err := c.query(ctx, url, request, cert, issuer)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if !resp.NextUpdate.IsZero() {
+			c.mu.Lock()
+			if c.cache == nil {
+				c.cache = make(map[string]*ocsp.Response)
+			}
+			c.cache[key] = resp
+			c.mu.Unlock()
+		}
+		return resp, nil
+	}
+	if lastErr == nil {
+		lastErr = errors.New("certificate names no HTTP OCSP responder")
+	}
+	return nil, lastErr
+}
+
+// query sends request to the responder at url and validates the response
+func (c *OCSPChecker) query(ctx context.Context, url string, request []byte, cert, issuer *x509.Certificate) (*ocsp.Response, error) {
+	client := c.Client
+	if client == nil {
+		timeout := c.Timeout
+		if timeout <= 0 {
+			timeout = DefaultOCSPTimeout
+		}
+		client = &http.Client{Timeout: timeout}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(request))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OCSP URL %q: %w", url, err)
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	req.Header.Set("Accept", "application/ocsp-response")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("OCSP request to %q failed: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OCSP request to %q failed: %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxOCSPResponseSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("OCSP request to %q failed: %w", url, err)
+	}
+	if len(body) > maxOCSPResponseSize {
+		return nil, fmt.Errorf("OCSP response from %q exceeds %d bytes", url, maxOCSPResponseSize)
+	}
+
+	parsed, err := ocsp.ParseResponseForCert(body, cert, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OCSP response from %q: %w", url, err)
+	}
+	if err := checkOCSPResponder(parsed, issuer); err != nil {
+		return nil, fmt.Errorf("invalid OCSP response from %q: %w", url, err)
+	}
+	if err := checkOCSPFreshness(parsed, time.Now()); err != nil {
+		return nil, fmt.Errorf("invalid OCSP response from %q: %w", url, err)
+	}
+	return parsed, nil
+}
+
+// checkOCSPResponder requires a delegated responder certificate, one other
+// than issuer, to carry the OCSP Signing extended key usage. The signatures
+// themselves are checked by ocsp.ParseResponseForCert.
+func checkOCSPResponder(resp *ocsp.Response, issuer *x509.Certificate) error {
+	if resp.Certificate == nil || resp.Certificate.Equal(issuer) {
+		return nil
+	}
+	for _, usage := range resp.Certificate.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageOCSPSigning {
+			return nil
+		}
+	}
+	return errors.New("delegated responder certificate is not valid for OCSP signing")
+}
+
+// checkOCSPFreshness rejects responses that are not valid at now
+func checkOCSPFreshness(resp *ocsp.Response, now time.Time) error {
+	if resp.ThisUpdate.After(now.Add(revocationClockSkew)) {
+		return errors.New("response is not yet valid")
+	}
+	if !resp.NextUpdate.IsZero() && resp.NextUpdate.Before(now.Add(-revocationClockSkew)) {
+		return errors.New("response is stale")
+	}
+	return nil
+}
+
+// ocspCacheKey identifies cert by its issuer and serial number
+func ocspCacheKey(cert, issuer *x509.Certificate) string {
+	sum := sha256.Sum256(issuer.Raw)
+	return fmt.Sprintf("%x/%x", sum, cert.SerialNumber)
+}
@@ -0,0 +1,244 @@
+package sigtool
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// testOCSPResponder answers OCSP requests for certificates issued by issuer
+// with the statuses registered by serial number; other serials are unknown
+type testOCSPResponder struct {
+	t         *testing.T
+	issuer    *testIdentity
+	responder *testIdentity
+	requests  int32
+	fail      bool
+	// block holds requests until the client gives up
+	block bool
+
+	mu       sync.Mutex
+	statuses map[string]ocsp.Response
+}
+
+func newTestOCSPResponder(t *testing.T, issuer *testIdentity) (*testOCSPResponder, *httptest.Server) {
+	r := &testOCSPResponder{t: t, issuer: issuer, statuses: make(map[string]ocsp.Response)}
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return r, server
+}
+
+func (r *testOCSPResponder) set(serial *big.Int, status int, revokedAt time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statuses[serial.String()] = ocsp.Response{Status: status, RevokedAt: revokedAt}
+}
+
+func (r *testOCSPResponder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	atomic.AddInt32(&r.requests, 1)
+	if r.block {
+		_, _ = io.ReadAll(req.Body)
+		select {
+		case <-req.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+		return
+	}
+	if r.fail {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	request, err := ocsp.ParseRequest(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.mu.Lock()
+	template, ok := r.statuses[request.SerialNumber.String()]
+	r.mu.Unlock()
+	if !ok {
+		template.Status = ocsp.Unknown
+	}
+	template.SerialNumber = request.SerialNumber
+	template.ThisUpdate = time.Now().Add(-time.Minute)
+	template.NextUpdate = time.Now().Add(time.Hour)
+
+	signer := r.issuer
+	if r.responder != nil {
+		signer = r.responder
+		template.Certificate = r.responder.Cert
+	}
+	der, err := ocsp.CreateResponse(r.issuer.Cert, signer.Cert, template, signer.Key)
+	if err != nil {
+		r.t.Errorf("Failed to create OCSP response: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	_, _ = w.Write(der)
+}
+
+// ocspChainForTest returns a root pool, a signer and the OCSP responder of
+// the intermediate issuing it. The intermediate itself has a good status.
+func ocspChainForTest(t *testing.T) (*x509.CertPool, *testIdentity, *testOCSPResponder) {
+	t.Helper()
+
+	root := issueCertificateForTest(t, testCATemplate("ocsp root", 1), nil)
+	rootResponder, rootServer := newTestOCSPResponder(t, root)
+	caTemplate := testCATemplate("ocsp intermediate", 2)
+	caTemplate.OCSPServer = []string{rootServer.URL}
+	intermediate := issueCertificateForTest(t, caTemplate, root)
+	rootResponder.set(intermediate.Cert.SerialNumber, ocsp.Good, time.Time{})
+	responder, server := newTestOCSPResponder(t, intermediate)
+
+	template := testLeafTemplate("ocsp signer", 3, x509.ExtKeyUsageCodeSigning)
+	template.OCSPServer = []string{"ldap://ignored.example", server.URL}
+	leaf := issueCertificateForTest(t, template, intermediate)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Cert)
+	return roots, leaf, responder
+}
+
+func TestVerify_OCSPGoodAndRevoked(t *testing.T) {
+	roots, leaf, responder := ocspChainForTest(t)
+	filePath := createSignedMockPEAs(t, leaf, crypto.SHA256)
+
+	responder.set(leaf.Cert.SerialNumber, ocsp.Good, time.Time{})
+	checker := NewOCSPChecker(time.Second, true)
+	if err := Verify(filePath, &VerifyOptions{Roots: roots, OCSP: checker}); err != nil {
+		t.Fatalf("Expected good OCSP status to verify, got: %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{Roots: roots, OCSP: checker}); err != nil {
+		t.Fatalf("Expected cached OCSP status to verify, got: %v", err)
+	}
+	if got := atomic.LoadInt32(&responder.requests); got != 1 {
+		t.Errorf("Expected 1 OCSP request thanks to the cache, got %d", got)
+	}
+
+	revokedAt := time.Now().Add(-10 * time.Minute)
+	responder.set(leaf.Cert.SerialNumber, ocsp.Revoked, revokedAt)
+	err := Verify(filePath, &VerifyOptions{Roots: roots, OCSP: NewOCSPChecker(time.Second, false)})
+	if !errors.Is(err, ErrCertificateRevoked) {
+		t.Fatalf("Expected ErrCertificateRevoked, got: %v", err)
+	}
+	var revocation *RevocationError
+	if !errors.As(err, &revocation) || !revocation.Certificate.Equal(leaf.Cert) {
+		t.Errorf("Expected *RevocationError for the signer, got: %v", err)
+	}
+
+	if err := Verify(filePath, &VerifyOptions{Roots: roots}); err != nil {
+		t.Errorf("Expected revocation to be ignored without OCSP, got: %v", err)
+	}
+}
+
+func TestVerify_OCSPRevokedAfterTimestamp(t *testing.T) {
+	roots, leaf, responder := ocspChainForTest(t)
+	tsa, _ := testTSA(t)
+	roots.AddCert(tsa)
+	responder.set(leaf.Cert.SerialNumber, ocsp.Revoked, time.Now().Add(-10*time.Minute))
+
+	before := createSignedMockPEAs(t, leaf, crypto.SHA256, withRFC3161Timestamp(t, time.Now().Add(-30*time.Minute)))
+	if err := Verify(before, &VerifyOptions{Roots: roots, OCSP: NewOCSPChecker(time.Second, true)}); err != nil {
+		t.Errorf("Expected signature timestamped before the revocation to verify, got: %v", err)
+	}
+
+	after := createSignedMockPEAs(t, leaf, crypto.SHA256, withRFC3161Timestamp(t, time.Now().Add(-time.Minute)))
+	if err := Verify(after, &VerifyOptions{Roots: roots, OCSP: NewOCSPChecker(time.Second, true)}); !errors.Is(err, ErrCertificateRevoked) {
+		t.Errorf("Expected ErrCertificateRevoked after the revocation, got: %v", err)
+	}
+}
+
+func TestVerify_OCSPSoftAndHardFail(t *testing.T) {
+	roots, leaf, responder := ocspChainForTest(t)
+	filePath := createSignedMockPEAs(t, leaf, crypto.SHA256)
+
+	// The responder does not know the signer
+	if err := Verify(filePath, &VerifyOptions{Roots: roots, OCSP: NewOCSPChecker(time.Second, false)}); err != nil {
+		t.Errorf("Expected soft-fail to accept unknown status, got: %v", err)
+	}
+	err := Verify(filePath, &VerifyOptions{Roots: roots, OCSP: NewOCSPChecker(time.Second, true)})
+	if !errors.Is(err, ErrRevocationUnknown) {
+		t.Errorf("Expected ErrRevocationUnknown in hard-fail mode, got: %v", err)
+	}
+
+	responder.fail = true
+	if err := Verify(filePath, &VerifyOptions{Roots: roots, OCSP: NewOCSPChecker(time.Second, false)}); err != nil {
+		t.Errorf("Expected soft-fail to accept an unreachable responder, got: %v", err)
+	}
+	err = Verify(filePath, &VerifyOptions{Roots: roots, OCSP: NewOCSPChecker(time.Second, true)})
+	if !errors.Is(err, ErrRevocationUnknown) {
+		t.Errorf("Expected ErrRevocationUnknown for an unreachable responder, got: %v", err)
+	}
+}
+
+func TestVerifyContext_OCSPCancelled(t *testing.T) {
+	roots, leaf, responder := ocspChainForTest(t)
+	filePath := createSignedMockPEAs(t, leaf, crypto.SHA256)
+	responder.block = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := VerifyContext(ctx, filePath, VerifyOptions{Roots: roots, OCSP: NewOCSPChecker(time.Minute, true)})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline to abort the OCSP request, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the OCSP request to stop at the deadline, took %v", elapsed)
+	}
+}
+
+func TestOCSPChecker_DelegatedResponder(t *testing.T) {
+	_, leaf, responder := ocspChainForTest(t)
+	issuer := responder.issuer
+	chain := []*x509.Certificate{leaf.Cert, issuer.Cert}
+	responder.set(leaf.Cert.SerialNumber, ocsp.Good, time.Time{})
+
+	responder.responder = issueCertificateForTest(t, testLeafTemplate("ocsp responder", 10, x509.ExtKeyUsageOCSPSigning), issuer)
+	if err := NewOCSPChecker(time.Second, true).CheckChain(chain, time.Now()); err != nil {
+		t.Errorf("Expected delegated responder to be accepted, got: %v", err)
+	}
+
+	responder.responder = issueCertificateForTest(t, testLeafTemplate("not a responder", 11, x509.ExtKeyUsageCodeSigning), issuer)
+	err := NewOCSPChecker(time.Second, true).CheckChain(chain, time.Now())
+	if !errors.Is(err, ErrRevocationUnknown) {
+		t.Errorf("Expected responder without OCSP Signing EKU to be rejected, got: %v", err)
+	}
+}
+
+func TestVerify_OCSPTimestampAuthority(t *testing.T) {
+	roots, leaf, responder := ocspChainForTest(t)
+	responder.set(leaf.Cert.SerialNumber, ocsp.Good, time.Time{})
+
+	template := testLeafTemplate("ocsp tsa", 20, x509.ExtKeyUsageTimeStamping)
+	template.OCSPServer = leaf.Cert.OCSPServer
+	tsa := issueCertificateForTest(t, template, responder.issuer)
+	responder.set(tsa.Cert.SerialNumber, ocsp.Revoked, time.Now().Add(-time.Hour))
+
+	filePath := createSignedMockPEAs(t, leaf, crypto.SHA256, withRFC3161TimestampAs(t, tsa, time.Now().Add(-time.Minute)))
+	if err := Verify(filePath, &VerifyOptions{Roots: roots}); err != nil {
+		t.Fatalf("Expected timestamped signature to verify without OCSP, got: %v", err)
+	}
+	err := Verify(filePath, &VerifyOptions{Roots: roots, OCSP: NewOCSPChecker(time.Second, false)})
+	if !errors.Is(err, ErrCertificateRevoked) {
+		t.Errorf("Expected revoked TSA to fail, got: %v", err)
+	}
+}
@@ -0,0 +1,433 @@
+package sigtool
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Parts, namespaces and identifiers of Open Packaging Conventions (OPC)
+// package signatures, as defined by ECMA-376 Part 2
+const (
+	opcContentTypesPart          = "[Content_Types].xml"
+	opcRootRelationships         = "_rels/.rels"
+	opcRelationshipsNamespace    = "http://schemas.openxmlformats.org/package/2006/relationships"
+	opcContentTypesNamespace     = "http://schemas.openxmlformats.org/package/2006/content-types"
+	opcDigitalSignatureNamespace = "http://schemas.openxmlformats.org/package/2006/digital-signature"
+	opcOriginRelationship        = "http://schemas.openxmlformats.org/package/2006/relationships/digital-signature/origin"
+	opcSignatureRelationship     = "http://schemas.openxmlformats.org/package/2006/relationships/digital-signature/signature"
+	opcRelationshipTransform     = "http://schemas.openxmlformats.org/package/2006/RelationshipTransform"
+	// opcPackageObjectID is the Id of the Object holding the manifest of
+	// signed parts
+	opcPackageObjectID = "idPackageObject"
+)
+
+// opcSigningTimeLayouts are the formats a SignatureTime value may take
+var opcSigningTimeLayouts = []string{time.RFC3339, "2006-01-02T15:04Z07:00", "2006-01-02"}
+
+// opcRelationship is a Relationship of a relationships part
+type opcRelationship struct {
+	id, relType, target, targetMode string
+}
+
+// opcSignatures locates the signature parts of a package and the parts of
+// the signature infrastructure, which no signature covers
+type opcSignatures struct {
+	parts []string
+	// infrastructure holds the origin part, its relationships part and the
+	// signature parts
+	infrastructure map[string]bool
+}
+
+// isOPCPackage reports whether the ZIP archive a is an OPC package, which
+// always declares the content types of its parts
+func isOPCPackage(a *zipArchive) bool {
+	return a.entry(opcContentTypesPart) != nil
+}
+
+// readOPCSignature returns the first XML signature part of the OPC package r
+func readOPCSignature(r io.ReaderAt, size int64) ([]byte, error) {
+	a, err := openZipArchive(r, size)
+	if err != nil {
+		return nil, err
+	}
+	signatures, err := findOPCSignatures(a)
+	if err != nil {
+		return nil, err
+	}
+	return readOPCSignaturePart(a, signatures.parts[0])
+}
+
+// readOPCSignaturePart returns the signature part name of a
+func readOPCSignaturePart(a *zipArchive, name string) ([]byte, error) {
+	data, err := a.readFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("%w: signature part %s is missing", ErrNotZipArchive, name)
+	}
+	if len(data) > MaxSignatureSize {
+		return nil, &SignatureSizeError{Size: int64(len(data)), Limit: MaxSignatureSize}
+	}
+	return data, nil
+}
+
+// findOPCSignatures follows the digital signature origin relationship of
+// the package a to the signature parts
+func findOPCSignatures(a *zipArchive) (*opcSignatures, error) {
+	rels, err := readOPCRelationships(a, opcRootRelationships)
+	if err != nil {
+		return nil, err
+	}
+	origin := ""
+	for _, rel := range rels {
+		if rel.relType == opcOriginRelationship {
+			origin = resolvePartName("", rel.target)
+			break
+		}
+	}
+	if origin == "" {
+		return nil, fmt.Errorf("%w (package has no digital signature origin)", ErrNotSigned)
+	}
+
+	signatures := &opcSignatures{infrastructure: map[string]bool{origin: true}}
+	originRels := relationshipsPartName(origin)
+	signatures.infrastructure[originRels] = true
+	rels, err = readOPCRelationships(a, originRels)
+	if err != nil {
+		return nil, err
+	}
+	for _, rel := range rels {
+		if rel.relType == opcSignatureRelationship {
+			part := resolvePartName(path.Dir(origin), rel.target)
+			signatures.parts = append(signatures.parts, part)
+			signatures.infrastructure[part] = true
+		}
+	}
+	if len(signatures.parts) == 0 {
+		return nil, fmt.Errorf("%w (package signature origin lists no signatures)", ErrNotSigned)
+	}
+	return signatures, nil
+}
+
+// readOPCRelationships parses the relationships part name of a; a missing
+// part has no relationships
+func readOPCRelationships(a *zipArchive, name string) ([]opcRelationship, error) {
+	data, err := a.readFile(name)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	root, err := parseXML(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	if !root.is(opcRelationshipsNamespace, "Relationships") {
+		return nil, fmt.Errorf("failed to parse %s: document element is %s, not Relationships", name, root.name.Local)
+	}
+	var rels []opcRelationship
+	for _, r := range root.elements(opcRelationshipsNamespace, "Relationship") {
+		rels = append(rels, opcRelationship{
+			id:         r.attr("Id"),
+			relType:    r.attr("Type"),
+			target:     r.attr("Target"),
+			targetMode: r.attr("TargetMode"),
+		})
+	}
+	return rels, nil
+}
+
+// resolvePartName returns the part name of target, relative to the folder
+// dir of its source part unless absolute, without its leading slash
+func resolvePartName(dir, target string) string {
+	if !strings.HasPrefix(target, "/") {
+		target = path.Join("/", dir, target)
+	}
+	return strings.TrimPrefix(path.Clean(target), "/")
+}
+
+// relationshipsPartName returns the name of the relationships part of part
+func relationshipsPartName(part string) string {
+	return path.Join(path.Dir(part), "_rels", path.Base(part)+".rels")
+}
+
+// opcContentTypes is the [Content_Types].xml of a package
+type opcContentTypes struct {
+	// defaults are by lowercase extension, overrides by lowercase part name
+	defaults  map[string]string
+	overrides map[string]string
+}
+
+// readOPCContentTypes parses the [Content_Types].xml part of a
+func readOPCContentTypes(a *zipArchive) (*opcContentTypes, error) {
+	data, err := a.readFile(opcContentTypesPart)
+	if err != nil {
+		return nil, err
+	}
+	root, err := parseXML(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", opcContentTypesPart, err)
+	}
+	types := &opcContentTypes{defaults: map[string]string{}, overrides: map[string]string{}}
+	for _, d := range root.elements(opcContentTypesNamespace, "Default") {
+		types.defaults[strings.ToLower(d.attr("Extension"))] = d.attr("ContentType")
+	}
+	for _, o := range root.elements(opcContentTypesNamespace, "Override") {
+		types.overrides[strings.ToLower(strings.TrimPrefix(o.attr("PartName"), "/"))] = o.attr("ContentType")
+	}
+	return types, nil
+}
+
+// contentType returns the content type of part; part names compare
+// case-insensitively
+func (t *opcContentTypes) contentType(part string) string {
+	if contentType, ok := t.overrides[strings.ToLower(part)]; ok {
+		return contentType
+	}
+	return t.defaults[strings.ToLower(strings.TrimPrefix(path.Ext(part), "."))]
+}
+
+// verifyOPC performs full verification of the OPC package in r, such as a
+// VSIX extension: every signature part must verify, the digests of the
+// parts in its manifest must match unless disabled, every part outside the
+// signature infrastructure must be signed, and the signer chain is checked
+// per opts.
+func verifyOPC(r io.ReaderAt, size int64, opts VerifyOptions) error {
+	a, err := openZipArchive(r, size)
+	if err != nil {
+		return fmt.Errorf("failed to extract signature: %w", err)
+	}
+	signatures, err := findOPCSignatures(a)
+	if err != nil {
+		return fmt.Errorf("failed to extract signature: %w", err)
+	}
+	types, err := readOPCContentTypes(a)
+	if err != nil {
+		return err
+	}
+
+	signed := make(map[string]bool)
+	for _, part := range signatures.parts {
+		data, err := readOPCSignaturePart(a, part)
+		if err != nil {
+			return fmt.Errorf("failed to extract signature: %w", err)
+		}
+		opts.logger().Debug("read package signature", "fileSize", size, "part", part, "size", len(data))
+		if err := verifyOPCSignature(a, data, types, signed, opts); err != nil {
+			return err
+		}
+	}
+	if opts.SkipContentDigest {
+		return nil
+	}
+
+	for _, f := range a.reader.File {
+		if strings.HasSuffix(f.Name, "/") || f.Name == opcContentTypesPart || signatures.infrastructure[f.Name] || signed[f.Name] {
+			continue
+		}
+		// A relationships part holding only the origin relationship
+		// belongs to the signature infrastructure
+		if f.Name == opcRootRelationships {
+			rels, err := readOPCRelationships(a, f.Name)
+			if err != nil {
+				return err
+			}
+			if len(rels) == 1 && rels[0].relType == opcOriginRelationship {
+				continue
+			}
+		}
+		return fmt.Errorf("%w: %s", ErrUnsignedPart, f.Name)
+	}
+	return nil
+}
+
+// verifyOPCSignature verifies the package signature data of a: the
+// signature over its SignedInfo, the package object it references and,
+// unless disabled, the parts of the manifest, which it adds to signed. The
+// signer is then checked per opts.
+func verifyOPCSignature(a *zipArchive, data []byte, types *opcContentTypes, signed map[string]bool, opts VerifyOptions) error {
+	sig, err := parseXMLSignature(data)
+	if err != nil {
+		return err
+	}
+	if err := sig.verify(); err != nil {
+		return err
+	}
+	object, err := opcPackageObject(sig)
+	if err != nil {
+		return err
+	}
+	manifest := object.element(xmldsigNamespace, "Manifest")
+	if manifest == nil {
+		return fmt.Errorf("failed to parse XML signature: package object has no Manifest")
+	}
+	references, err := parseXMLReferences(manifest)
+	if err != nil {
+		return err
+	}
+
+	if !opts.SkipContentDigest {
+		for _, ref := range references {
+			part, err := verifyOPCPartReference(a, ref, types)
+			if err != nil {
+				return err
+			}
+			signed[part] = true
+		}
+	}
+
+	signer, err := sig.signer()
+	if err != nil {
+		return err
+	}
+	trust, err := resolveTrust(opts)
+	if err != nil {
+		return err
+	}
+	return verifyCertificateTrust(signer, sig.certificates, sig.weakFindings(), opts, trust, time.Time{})
+}
+
+// opcPackageObject returns the package object of sig, which SignedInfo
+// must reference so that the manifest is signed
+func opcPackageObject(sig *xmlSignature) (*xmlNode, error) {
+	for _, ref := range sig.references {
+		if ref.uri == "#"+opcPackageObjectID {
+			for _, object := range sig.element.elements(xmldsigNamespace, "Object") {
+				if object.attr("Id") == opcPackageObjectID {
+					return object, nil
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("failed to parse XML signature: SignedInfo does not reference the %s object", opcPackageObjectID)
+}
+
+// verifyOPCPartReference checks ref, a manifest reference to a part of a
+// with its content type, against the part and returns the part name
+func verifyOPCPartReference(a *zipArchive, ref xmlReference, types *opcContentTypes) (string, error) {
+	uri, query, _ := strings.Cut(ref.uri, "?")
+	part := resolvePartName("", uri)
+	// Content types contain '+', so the query is not form-decoded
+	signedType, ok := strings.CutPrefix(query, "ContentType=")
+	if !ok {
+		return "", fmt.Errorf("failed to parse XML signature: reference %q has no content type", ref.uri)
+	}
+	if unescaped, err := url.PathUnescape(signedType); err == nil {
+		signedType = unescaped
+	}
+	if contentType := types.contentType(part); contentType != signedType {
+		return "", fmt.Errorf("%w: %s has content type %q, signed as %q", ErrDigestMismatch, part, contentType, signedType)
+	}
+
+	data, err := a.readFile(part)
+	if err != nil {
+		return "", err
+	}
+	if data == nil {
+		return "", fmt.Errorf("%w: signed part %s is missing", ErrDigestMismatch, part)
+	}
+	for i, t := range ref.transforms {
+		switch t.algorithm {
+		case opcRelationshipTransform:
+			if data, err = transformRelationships(data, t.element); err != nil {
+				return "", fmt.Errorf("failed to transform %s: %w", part, err)
+			}
+		case c14nInclusive, c14nInclusiveComments, c14nExclusive, c14nExclusiveComments:
+			// The relationship transform already yields canonical XML
+			if i > 0 && ref.transforms[i-1].algorithm == opcRelationshipTransform {
+				continue
+			}
+			root, err := parseXML(data)
+			if err != nil {
+				return "", fmt.Errorf("failed to parse %s: %w", part, err)
+			}
+			if data, err = canonicalize(root, t.algorithm, inclusivePrefixes(t.element)); err != nil {
+				return "", err
+			}
+		default:
+			return "", fmt.Errorf("unsupported transform %q of reference %q", t.algorithm, ref.uri)
+		}
+	}
+	if err := ref.check(data); err != nil {
+		return "", fmt.Errorf("%s: %w", part, err)
+	}
+	return part, nil
+}
+
+// transformRelationships applies the relationship transform t to the
+// relationships part data: the relationships selected by Id or type, sorted
+// by Id, with the default target mode made explicit, in canonical form
+func transformRelationships(data []byte, t *xmlNode) ([]byte, error) {
+	root, err := parseXML(data)
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string]bool)
+	relTypes := make(map[string]bool)
+	for _, s := range t.elements(opcDigitalSignatureNamespace, "RelationshipReference") {
+		ids[s.attr("SourceId")] = true
+	}
+	for _, s := range t.elements(opcDigitalSignatureNamespace, "RelationshipsGroupReference") {
+		relTypes[s.attr("SourceType")] = true
+	}
+
+	var rels []opcRelationship
+	for _, r := range root.elements(opcRelationshipsNamespace, "Relationship") {
+		rel := opcRelationship{id: r.attr("Id"), relType: r.attr("Type"), target: r.attr("Target"), targetMode: r.attr("TargetMode")}
+		if ids[rel.id] || relTypes[rel.relType] {
+			if rel.targetMode == "" {
+				rel.targetMode = "Internal"
+			}
+			rels = append(rels, rel)
+		}
+	}
+	sort.Slice(rels, func(i, j int) bool { return rels[i].id < rels[j].id })
+
+	var buf bytes.Buffer
+	buf.WriteString(`<Relationships xmlns="` + opcRelationshipsNamespace + `">`)
+	for _, rel := range rels {
+		buf.WriteString(`<Relationship Id="`)
+		escapeAttr(&buf, rel.id)
+		buf.WriteString(`" Target="`)
+		escapeAttr(&buf, rel.target)
+		buf.WriteString(`" TargetMode="`)
+		escapeAttr(&buf, rel.targetMode)
+		buf.WriteString(`" Type="`)
+		escapeAttr(&buf, rel.relType)
+		buf.WriteString(`"></Relationship>`)
+	}
+	buf.WriteString(`</Relationships>`)
+	return buf.Bytes(), nil
+}
+
+// opcSigningTime returns the SignatureTime property of a package signature,
+// which the signer asserts, or the zero time
+func opcSigningTime(sig *xmlSignature) time.Time {
+	object, err := opcPackageObject(sig)
+	if err != nil {
+		return time.Time{}
+	}
+	for _, props := range object.elements(xmldsigNamespace, "SignatureProperties") {
+		for _, prop := range props.elements(xmldsigNamespace, "SignatureProperty") {
+			signatureTime := prop.element(opcDigitalSignatureNamespace, "SignatureTime")
+			if signatureTime == nil {
+				continue
+			}
+			value := signatureTime.element(opcDigitalSignatureNamespace, "Value")
+			if value == nil {
+				continue
+			}
+			for _, layout := range opcSigningTimeLayouts {
+				if t, err := time.Parse(layout, strings.TrimSpace(value.text())); err == nil {
+					return t
+				}
+			}
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,208 @@
+package sigtool
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Parts of the test package signed by signedOPCForTest
+const (
+	opcManifestForTest  = `<?xml version="1.0" encoding="utf-8"?><PackageManifest Version="2.0.0"><Metadata><Identity Id="sigtool.test" Version="1.0" Publisher="sigtool"/></Metadata></PackageManifest>`
+	opcOriginForTest    = "package/services/digital-signature/origin.psdsor"
+	opcSignatureForTest = "package/services/digital-signature/xml-signature/sig.psdsxs"
+	opcManifestRelType  = "http://schemas.microsoft.com/developer/vsx-schema/2011/manifest"
+)
+
+// opcContentTypesForTest is the [Content_Types].xml of test packages
+var opcContentTypesForTest = []byte(`<?xml version="1.0" encoding="utf-8"?><Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="vsixmanifest" ContentType="text/xml"/>` +
+	`<Default Extension="dll" ContentType="application/octet-stream"/>` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="psdsor" ContentType="application/vnd.openxmlformats-package.digital-signature-origin"/>` +
+	`<Default Extension="psdsxs" ContentType="application/vnd.openxmlformats-package.digital-signature-xmlsignature+xml"/>` +
+	`</Types>`)
+
+// opcReferenceForTest returns the canonical manifest reference to part
+// with its SHA-256 digest over data
+func opcReferenceForTest(part, contentType, transforms string, data []byte) string {
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf(`<Reference URI="/%s?ContentType=%s">%s<DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"></DigestMethod><DigestValue>%s</DigestValue></Reference>`,
+		part, contentType, transforms, base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+// signedOPCForTest returns the members of a VSIX-like package whose parts
+// are signed by the test signer. The signed elements are written in
+// canonical form and the relationship transform output is spelled out, so
+// the digests do not depend on the canonicalization under test.
+func signedOPCForTest(t *testing.T) []zipMemberForTest {
+	t.Helper()
+	cert, key := testSigner(t)
+
+	payload := []byte(strings.Repeat("sigtool extension payload ", 100))
+	rootRels := []byte(`<?xml version="1.0" encoding="utf-8"?>` + "\n" +
+		`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` + "\n" +
+		`  <Relationship Type="` + opcOriginRelationship + `" Target="/` + opcOriginForTest + `" Id="R2" />` + "\n" +
+		`  <Relationship Type="` + opcManifestRelType + `" Target="/extension.vsixmanifest" Id="R1" />` + "\n" +
+		`</Relationships>`)
+	transformedRels := []byte(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="R1" Target="/extension.vsixmanifest" TargetMode="Internal" Type="` + opcManifestRelType + `"></Relationship>` +
+		`</Relationships>`)
+	relsTransforms := `<Transforms><Transform Algorithm="` + opcRelationshipTransform + `">` +
+		`<mdssi:RelationshipReference xmlns:mdssi="` + opcDigitalSignatureNamespace + `" SourceId="R1"></mdssi:RelationshipReference>` +
+		`</Transform><Transform Algorithm="` + c14nInclusive + `"></Transform></Transforms>`
+
+	object := `<Object xmlns="` + xmldsigNamespace + `" Id="idPackageObject"><Manifest>` +
+		opcReferenceForTest("_rels/.rels", "application/vnd.openxmlformats-package.relationships+xml", relsTransforms, transformedRels) +
+		opcReferenceForTest("extension.vsixmanifest", "text/xml", "", []byte(opcManifestForTest)) +
+		opcReferenceForTest("extension/payload.dll", "application/octet-stream", "", payload) +
+		`</Manifest><SignatureProperties><SignatureProperty Id="idSignatureTime" Target="#idPackageSignature">` +
+		`<mdssi:SignatureTime xmlns:mdssi="` + opcDigitalSignatureNamespace + `"><mdssi:Format>YYYY-MM-DDThh:mm:ssTZD</mdssi:Format><mdssi:Value>2024-01-01T00:00:00Z</mdssi:Value></mdssi:SignatureTime>` +
+		`</SignatureProperty></SignatureProperties></Object>`
+	objectSum := sha256.Sum256([]byte(object))
+	signedInfo := `<SignedInfo xmlns="` + xmldsigNamespace + `">` +
+		`<CanonicalizationMethod Algorithm="` + c14nInclusive + `"></CanonicalizationMethod>` +
+		`<SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"></SignatureMethod>` +
+		`<Reference Type="` + xmldsigObjectType + `" URI="#idPackageObject"><DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"></DigestMethod>` +
+		`<DigestValue>` + base64.StdEncoding.EncodeToString(objectSum[:]) + `</DigestValue></Reference></SignedInfo>`
+	signedInfoSum := sha256.Sum256([]byte(signedInfo))
+	value, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, signedInfoSum[:])
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	signature := `<Signature xmlns="` + xmldsigNamespace + `" Id="idPackageSignature">` + signedInfo +
+		"\n  <SignatureValue>" + base64.StdEncoding.EncodeToString(value) + "</SignatureValue>\n" +
+		`  <KeyInfo><X509Data><X509Certificate>` + base64.StdEncoding.EncodeToString(cert.Raw) + `</X509Certificate></X509Data></KeyInfo>` +
+		object + `</Signature>`
+
+	return []zipMemberForTest{
+		{opcContentTypesPart, opcContentTypesForTest},
+		{opcRootRelationships, rootRels},
+		{"extension.vsixmanifest", []byte(opcManifestForTest)},
+		{"extension/payload.dll", payload},
+		{opcOriginForTest, nil},
+		{"package/services/digital-signature/_rels/origin.psdsor.rels", []byte(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Type="` + opcSignatureRelationship + `" Target="xml-signature/sig.psdsxs" Id="S1"/></Relationships>`)},
+		{opcSignatureForTest, []byte(signature)},
+	}
+}
+
+// writeOPCForTest writes a package of members and returns its path
+func writeOPCForTest(t *testing.T, members []zipMemberForTest) string {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), "extension.vsix")
+	if err := os.WriteFile(filePath, zipForTest(t, members), 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	return filePath
+}
+
+// replaceMemberForTest returns members with the data of name replaced
+func replaceMemberForTest(members []zipMemberForTest, name string, data []byte) []zipMemberForTest {
+	out := append([]zipMemberForTest(nil), members...)
+	for i := range out {
+		if out[i].name == name {
+			out[i].data = data
+		}
+	}
+	return out
+}
+
+func TestVerify_OPC(t *testing.T) {
+	filePath := writeOPCForTest(t, signedOPCForTest(t))
+
+	if fileType, err := DetectFileType(filePath); err != nil || fileType != FileTypeOPC {
+		t.Errorf("Expected FileTypeOPC, got %q (error %v)", fileType, err)
+	}
+	if err := Verify(filePath, nil); err != nil {
+		t.Errorf("Expected a valid signature, got: %v", err)
+	}
+	cert, _ := testSigner(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	if err := Verify(filePath, &VerifyOptions{Roots: roots, RequireCodeSigning: true}); err != nil {
+		t.Errorf("Expected a valid chain, got: %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{Roots: x509.NewCertPool()}); !errors.Is(err, ErrChainVerification) {
+		t.Errorf("Expected ErrChainVerification without the root, got: %v", err)
+	}
+
+	info, err := Inspect(filePath)
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	if info.Signer == nil || info.Signer.Subject != cert.Subject.String() {
+		t.Errorf("Expected the test signer, got %+v", info.Signer)
+	}
+	if info.DigestAlgorithm != crypto.SHA256 || len(info.Certificates) != 1 {
+		t.Errorf("Expected a SHA-256 digest and one certificate, got %v and %d", info.DigestAlgorithm, len(info.Certificates))
+	}
+	if want := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC); !info.SigningTime.Equal(want) {
+		t.Errorf("Expected signing time %v, got %v", want, info.SigningTime)
+	}
+	if signer, err := SignerCertificate(filePath); err != nil || !signer.Equal(cert) {
+		t.Errorf("Expected the test signer certificate, got error %v", err)
+	}
+}
+
+func TestVerify_OPCTampered(t *testing.T) {
+	members := signedOPCForTest(t)
+	signature := string(members[len(members)-1].data)
+	tests := []struct {
+		name    string
+		members []zipMemberForTest
+		want    error
+	}{
+		{"payload", replaceMemberForTest(members, "extension/payload.dll", []byte("malicious payload")), ErrDigestMismatch},
+		{"relationship", replaceMemberForTest(members, opcRootRelationships, []byte(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`+
+			`<Relationship Type="`+opcOriginRelationship+`" Target="/`+opcOriginForTest+`" Id="R2"/>`+
+			`<Relationship Type="`+opcManifestRelType+`" Target="/evil.vsixmanifest" Id="R1"/></Relationships>`)), ErrDigestMismatch},
+		{"content type", replaceMemberForTest(members, opcContentTypesPart, []byte(strings.Replace(string(opcContentTypesForTest), "application/octet-stream", "text/plain", 1))), ErrDigestMismatch},
+		{"manifest", replaceMemberForTest(members, opcSignatureForTest, []byte(strings.Replace(signature, "extension/payload.dll", "extension/other.dll", 1))), ErrDigestMismatch},
+		{"signature value", replaceMemberForTest(members, opcSignatureForTest, []byte(strings.Replace(signature, "<SignatureValue>", "<SignatureValue>AAAA", 1))), ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify(writeOPCForTest(t, tt.members), nil); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got: %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestVerify_OPCUnsignedPart(t *testing.T) {
+	members := append(signedOPCForTest(t), zipMemberForTest{"extension/added.dll", []byte("added after signing")})
+	filePath := writeOPCForTest(t, members)
+	if err := Verify(filePath, nil); !errors.Is(err, ErrUnsignedPart) {
+		t.Errorf("Expected ErrUnsignedPart, got: %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{SkipContentDigest: true}); err != nil {
+		t.Errorf("Expected no error without content digests, got: %v", err)
+	}
+}
+
+func TestVerify_OPCUnsigned(t *testing.T) {
+	filePath := writeOPCForTest(t, []zipMemberForTest{
+		{opcContentTypesPart, opcContentTypesForTest},
+		{"extension.vsixmanifest", []byte(opcManifestForTest)},
+	})
+	if fileType, err := DetectFileType(filePath); err != nil || fileType != FileTypeOPC {
+		t.Errorf("Expected FileTypeOPC, got %q (error %v)", fileType, err)
+	}
+	if _, err := ExtractDigitalSignature(filePath); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned, got: %v", err)
+	}
+	if err := Verify(filePath, nil); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned from Verify, got: %v", err)
+	}
+}
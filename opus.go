@@ -0,0 +1,88 @@
+package sigtool
+
+import (
+	"encoding/asn1"
+	"fmt"
+	"unicode/utf16"
+)
+
+// Authenticated attribute describing the signed program
+var oidSpcSpOpusInfo = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 12}
+
+// parseSpcSpOpusInfo decodes the SpcSpOpusInfo authenticated attribute
+// and returns its program name and more-info link:
+//
+//	SpcSpOpusInfo ::= SEQUENCE {
+//	    programName [0] EXPLICIT SpcString OPTIONAL,
+//	    moreInfo    [1] EXPLICIT SpcLink OPTIONAL }
+//
+// The fields are walked by hand because encoding/asn1 does not apply
+// explicit tags to RawValue fields.
+func parseSpcSpOpusInfo(der []byte) (programName, moreInfo string, err error) {
+	var seq asn1.RawValue
+	if _, err := asn1.Unmarshal(der, &seq); err != nil {
+		return "", "", fmt.Errorf("failed to parse SpcSpOpusInfo: %w", err)
+	}
+	rest := seq.Bytes
+	for len(rest) > 0 {
+		var field asn1.RawValue
+		if rest, err = asn1.Unmarshal(rest, &field); err != nil {
+			return "", "", fmt.Errorf("failed to parse SpcSpOpusInfo: %w", err)
+		}
+		if field.Class != asn1.ClassContextSpecific {
+			continue
+		}
+		var inner asn1.RawValue
+		if _, err := asn1.Unmarshal(field.Bytes, &inner); err != nil {
+			return "", "", fmt.Errorf("failed to parse SpcSpOpusInfo: %w", err)
+		}
+		switch field.Tag {
+		case 0:
+			programName = decodeSpcString(inner)
+		case 1:
+			moreInfo = decodeSpcLink(inner)
+		}
+	}
+	return programName, moreInfo, nil
+}
+
+// decodeSpcString decodes an SpcString CHOICE of a [0] IMPLICIT BMPString or
+// a [1] IMPLICIT IA5String. It returns "" for absent or unknown values.
+func decodeSpcString(v asn1.RawValue) string {
+	if v.Class != asn1.ClassContextSpecific {
+		return ""
+	}
+	switch v.Tag {
+	case 0:
+		units := make([]uint16, 0, len(v.Bytes)/2)
+		for i := 0; i+1 < len(v.Bytes); i += 2 {
+			units = append(units, uint16(v.Bytes[i])<<8|uint16(v.Bytes[i+1]))
+		}
+		return string(utf16.Decode(units))
+	case 1:
+		return string(v.Bytes)
+	default:
+		return ""
+	}
+}
+
+// decodeSpcLink decodes an SpcLink CHOICE. URLs ([0] IMPLICIT IA5String) and
+// file names ([2] EXPLICIT SpcString) are returned as text; serialized
+// monikers and absent values yield "".
+func decodeSpcLink(v asn1.RawValue) string {
+	if v.Class != asn1.ClassContextSpecific {
+		return ""
+	}
+	switch v.Tag {
+	case 0:
+		return string(v.Bytes)
+	case 2:
+		var file asn1.RawValue
+		if _, err := asn1.Unmarshal(v.Bytes, &file); err != nil {
+			return ""
+		}
+		return decodeSpcString(file)
+	default:
+		return ""
+	}
+}
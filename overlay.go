@@ -0,0 +1,206 @@
+package sigtool
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// DataRegionKind identifies where extra data lies in a PE file.
+type DataRegionKind string
+
+const (
+	// RegionOverlay is data after the last section and before the
+	// certificate table, or at the end of an unsigned file. Authenticode
+	// covers it in signed files, but the loader never maps it.
+	RegionOverlay DataRegionKind = "Overlay"
+	// RegionCertificateSlack is data inside the certificate table beyond the
+	// DER encoding of a PKCS#7 signature (the MS13-098 padding abuse), which
+	// no Authenticode digest covers
+	RegionCertificateSlack DataRegionKind = "CertificateSlack"
+	// RegionAfterCertificateTable is data after the certificate table, which
+	// no Authenticode digest covers
+	RegionAfterCertificateTable DataRegionKind = "AfterCertificateTable"
+)
+
+// DataRegion is a range of a PE file outside its headers, sections and
+// certificate table.
+type DataRegion struct {
+	// Kind is where the data lies
+	Kind DataRegionKind
+	// Offset is the file offset of the first byte
+	Offset int64
+	// Size is the length in bytes
+	Size int64
+	// Authenticated reports whether the signature of the file covers the
+	// data, so that changing it would invalidate the signature
+	Authenticated bool
+}
+
+// FindExtraData reports the data of a PE file that lies outside its
+// headers, sections and certificate table.
+//
+// Installers and self-extracting archives legitimately store payloads in an
+// overlay after the last section, which signed files include in the
+// Authenticode digest. Data after the certificate table, however, is not
+// covered by any signature and is a known way of smuggling content into a
+// "signed" binary, as is data hidden in a WIN_CERTIFICATE entry after the
+// PKCS#7 signature it holds. Up to seven zero bytes aligning the certificate
+// table or its entries are not reported.
+//
+// Parameters:
+//   - filePath: The path to the PE file
+//
+// Returns:
+//   - []DataRegion: The extra regions in file order, empty when there are none
+//   - error: An error if the file cannot be read or is not a PE image
+//
+// Example usage:
+//
+//	regions, err := sigtool.FindExtraData("signed.exe")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	for _, r := range regions {
+//	    if !r.Authenticated {
+//	        fmt.Printf("%d unsigned bytes at %#x\n", r.Size, r.Offset)
+//	    }
+//	}
+func FindExtraData(filePath string) ([]DataRegion, error) {
+	// #nosec G304
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+	return findExtraData(f, info.Size())
+}
+
+// findExtraData implements FindExtraData for r of the given size
+func findExtraData(r io.ReaderAt, size int64) ([]DataRegion, error) {
+	layout, err := readLayout(r, size)
+	if err != nil {
+		return nil, err
+	}
+	end, err := imageEnd(r)
+	if err != nil {
+		return nil, err
+	}
+
+	signed := layout.certTableSize > 0
+	if !signed {
+		if end < size {
+			return []DataRegion{{Kind: RegionOverlay, Offset: end, Size: size - end}}, nil
+		}
+		return []DataRegion{}, nil
+	}
+
+	tableEnd := layout.certTableOffset + layout.certTableSize
+	if tableEnd > size {
+		return nil, &SignatureBoundsError{
+			Offset:   layout.certTableOffset,
+			Length:   layout.certTableSize,
+			FileSize: size,
+			Reason:   "certificate table extends beyond file bounds",
+		}
+	}
+	regions := []DataRegion{}
+	if gap := layout.certTableOffset - end; gap > 0 && !isTablePadding(r, end, gap) {
+		regions = append(regions, DataRegion{Kind: RegionOverlay, Offset: end, Size: gap, Authenticated: true})
+	}
+	slack, err := certificateSlack(r, layout)
+	if err != nil {
+		return nil, err
+	}
+	regions = append(regions, slack...)
+	if tableEnd < size {
+		regions = append(regions, DataRegion{Kind: RegionAfterCertificateTable, Offset: tableEnd, Size: size - tableEnd})
+	}
+	return regions, nil
+}
+
+// imageEnd returns the file offset just past the headers and the raw data of
+// the last section
+func imageEnd(r io.ReaderAt) (int64, error) {
+	pefile, err := pe.NewFile(r)
+	if err != nil {
+		return 0, &PEFormatError{Err: err}
+	}
+	defer pefile.Close()
+
+	var lfanew [4]byte
+	if _, err := r.ReadAt(lfanew[:], 0x3c); err != nil {
+		return 0, fmt.Errorf("failed to read PE header offset: %w", err)
+	}
+	end := int64(binary.LittleEndian.Uint32(lfanew[:])) + 4 + 20 +
+		int64(pefile.FileHeader.SizeOfOptionalHeader) + 40*int64(len(pefile.Sections))
+	switch t := pefile.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		end = max(end, int64(t.SizeOfHeaders))
+	case *pe.OptionalHeader64:
+		end = max(end, int64(t.SizeOfHeaders))
+	default:
+		return 0, &PEFormatError{Err: errors.New("unsupported PE optional header type")}
+	}
+	for _, s := range pefile.Sections {
+		if s.Size > 0 {
+			end = max(end, int64(s.Offset)+int64(s.Size))
+		}
+	}
+	return end, nil
+}
+
+// isTablePadding reports whether the n bytes at offset are the zero padding
+// that aligns a certificate table
+func isTablePadding(r io.ReaderAt, offset, n int64) bool {
+	if n >= certificateTableAlignment {
+		return false
+	}
+	buf := make([]byte, n)
+	if _, err := r.ReadAt(buf, offset); err != nil {
+		return false
+	}
+	return bytes.Count(buf, []byte{0}) == len(buf)
+}
+
+// certificateSlack returns the regions of the certificate table described
+// by layout that hold neither a WIN_CERTIFICATE header, the DER encoding of
+// a PKCS#7 entry, a non-PKCS#7 entry nor zero alignment padding
+func certificateSlack(r io.ReaderAt, layout *peLayout) ([]DataRegion, error) {
+	certs, err := readCertificateTable(r, layout)
+	if err != nil {
+		return nil, err
+	}
+	tableEnd := layout.certTableOffset + layout.certTableSize
+
+	var regions []DataRegion
+	used := layout.certTableOffset
+	for _, cert := range certs {
+		used = cert.Offset + int64(cert.Length)
+		if cert.CertificateType == WinCertTypePKCSSignedData {
+			var value asn1.RawValue
+			if _, err := asn1.Unmarshal(cert.Data, &value); err == nil {
+				used = cert.Offset + winCertificateHeaderLength + int64(len(value.FullBytes))
+			}
+		}
+		next := min(cert.Offset+alignCertificateTable(int64(cert.Length)), tableEnd)
+		if n := next - used; n > 0 && !isTablePadding(r, used, n) {
+			regions = append(regions, DataRegion{Kind: RegionCertificateSlack, Offset: used, Size: n})
+		}
+		used = next
+	}
+	if n := tableEnd - used; n > 0 && !isTablePadding(r, used, n) {
+		regions = append(regions, DataRegion{Kind: RegionCertificateSlack, Offset: used, Size: n})
+	}
+	return regions, nil
+}
@@ -0,0 +1,123 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindExtraData_Unsigned(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "unsigned.exe")
+	if err := os.WriteFile(filePath, mockPEImage([]byte("installer payload")), 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	regions, err := FindExtraData(filePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	want := []DataRegion{{Kind: RegionOverlay, Offset: mockHeaderSize, Size: int64(len("installer payload"))}}
+	if !reflect.DeepEqual(regions, want) {
+		t.Errorf("Expected %+v, got %+v", want, regions)
+	}
+
+	if err := os.WriteFile(filePath, mockPEImage(nil), 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if regions, err := FindExtraData(filePath); err != nil || len(regions) != 0 {
+		t.Errorf("Expected no extra data, got %+v (%v)", regions, err)
+	}
+}
+
+func TestFindExtraData_Signed(t *testing.T) {
+	filePath, _ := createSignedMockPEWithPayload(t, crypto.SHA256, []byte("overlay!"))
+	regions, err := FindExtraData(filePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	want := []DataRegion{{Kind: RegionOverlay, Offset: mockHeaderSize, Size: 8, Authenticated: true}}
+	if !reflect.DeepEqual(regions, want) {
+		t.Errorf("Expected %+v, got %+v", want, regions)
+	}
+
+	// Data appended after the certificate table is reported as unsigned
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	size := int64(len(data))
+	if err := os.WriteFile(filePath, append(data, "smuggled"...), 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	regions, err = FindExtraData(filePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	want = append(want, DataRegion{Kind: RegionAfterCertificateTable, Offset: size, Size: 8})
+	if !reflect.DeepEqual(regions, want) {
+		t.Errorf("Expected %+v, got %+v", want, regions)
+	}
+}
+
+func TestIsTablePadding(t *testing.T) {
+	data := []byte{1, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	tests := []struct {
+		offset, n int64
+		want      bool
+	}{
+		{1, 7, true},
+		{1, 8, false},
+		{0, 3, false},
+	}
+	for _, tt := range tests {
+		if got := isTablePadding(bytes.NewReader(data), tt.offset, tt.n); got != tt.want {
+			t.Errorf("isTablePadding(%d, %d): expected %v, got %v", tt.offset, tt.n, tt.want, got)
+		}
+	}
+}
+
+func TestFindExtraData_Invalid(t *testing.T) {
+	if _, err := FindExtraData(filepath.Join(t.TempDir(), "missing.exe")); err == nil {
+		t.Error("Expected error for a missing file, got nil")
+	}
+}
+
+func TestFindExtraData_CertificateSlack(t *testing.T) {
+	image := mockPEImage([]byte("payload!"))
+	signature := signAuthenticodeForTest(t, mockAuthentihash(image, crypto.SHA256), crypto.SHA256)
+	filePath := filepath.Join(t.TempDir(), "slack.exe")
+	smuggled := append(append([]byte(nil), signature...), "smuggled payload"...)
+	if err := os.WriteFile(filePath, embedSignatureForTest(image, smuggled), 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	regions, err := FindExtraData(filePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	slackOffset := int64(len(image)) + 8 + int64(len(signature))
+	want := []DataRegion{
+		{Kind: RegionOverlay, Offset: mockHeaderSize, Size: 8, Authenticated: true},
+		{Kind: RegionCertificateSlack, Offset: slackOffset, Size: alignCertificateTable(slackOffset+16) - slackOffset},
+	}
+	if !reflect.DeepEqual(regions, want) {
+		t.Errorf("Expected %+v, got %+v", want, regions)
+	}
+
+	if err := Verify(filePath, nil); err != nil {
+		t.Errorf("Expected slack to be tolerated by default, got: %v", err)
+	}
+	err = Verify(filePath, &VerifyOptions{RejectCertificateSlack: true})
+	if !errors.Is(err, ErrCertificateSlack) {
+		t.Errorf("Expected ErrCertificateSlack, got: %v", err)
+	}
+
+	// Alignment padding alone is not slack
+	clean, _ := createSignedMockPE(t, crypto.SHA256)
+	if err := Verify(clean, &VerifyOptions{RejectCertificateSlack: true}); err != nil {
+		t.Errorf("Expected a padded signature to pass the strict check, got: %v", err)
+	}
+}
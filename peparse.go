@@ -0,0 +1,176 @@
+package sigtool
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Optional header magic numbers
+const (
+	optionalHeaderMagicPE32     = 0x10b
+	optionalHeaderMagicPE32Plus = 0x20b
+)
+
+// readLayoutLenient locates the checksum field, the security directory entry
+// and the certificate table by reading only the headers on the way to them.
+// Unlike debug/pe it ignores the section table, the COFF symbol table and
+// SizeOfOptionalHeader, so it recovers the signature of images that are
+// truncated or malformed elsewhere.
+func readLayoutLenient(r io.ReaderAt, fileSize int64) (*peLayout, error) {
+	var lfanew [4]byte
+	if _, err := r.ReadAt(lfanew[:], 0x3c); err != nil {
+		return nil, &PEFormatError{Err: fmt.Errorf("failed to read PE header offset: %w", err)}
+	}
+	peOffset := int64(binary.LittleEndian.Uint32(lfanew[:]))
+	optHeaderOffset := peOffset + 4 + 20
+
+	var signature [4]byte
+	if _, err := r.ReadAt(signature[:], peOffset); err != nil || string(signature[:]) != "PE\x00\x00" {
+		return nil, &PEFormatError{Err: errors.New("invalid PE signature")}
+	}
+	var magic [2]byte
+	if _, err := r.ReadAt(magic[:], optHeaderOffset); err != nil {
+		return nil, &PEFormatError{Err: fmt.Errorf("failed to read optional header: %w", err)}
+	}
+
+	var countOffset, dataDirOffset int64
+	switch binary.LittleEndian.Uint16(magic[:]) {
+	case optionalHeaderMagicPE32:
+		countOffset, dataDirOffset = optHeaderOffset+92, optHeaderOffset+96
+	case optionalHeaderMagicPE32Plus:
+		countOffset, dataDirOffset = optHeaderOffset+108, optHeaderOffset+112
+	default:
+		return nil, &PEFormatError{Err: errors.New("unsupported PE optional header type")}
+	}
+
+	layout := &peLayout{
+		size:              fileSize,
+		checksumOffset:    optHeaderOffset + 64,
+		securityDirOffset: dataDirOffset + pe.IMAGE_DIRECTORY_ENTRY_SECURITY*8,
+	}
+	// Images with fewer than five data directories have no security entry
+	var count [4]byte
+	if _, err := r.ReadAt(count[:], countOffset); err != nil {
+		return nil, &PEFormatError{Err: fmt.Errorf("failed to read optional header: %w", err)}
+	}
+	if binary.LittleEndian.Uint32(count[:]) <= pe.IMAGE_DIRECTORY_ENTRY_SECURITY {
+		layout.noSecurityDir = true
+		return layout, nil
+	}
+	if layout.securityDirOffset+8 > fileSize {
+		return nil, &PEFormatError{Err: errors.New("optional header is truncated before the security directory")}
+	}
+	var entry [8]byte
+	if _, err := r.ReadAt(entry[:], layout.securityDirOffset); err != nil {
+		return nil, &PEFormatError{Err: fmt.Errorf("failed to read security directory: %w", err)}
+	}
+	vAddr := binary.LittleEndian.Uint32(entry[:4])
+	size := binary.LittleEndian.Uint32(entry[4:])
+	if vAddr == 0 || size == 0 {
+		return layout, nil
+	}
+	layout.certTableOffset = int64(vAddr)
+	layout.certTableSize = int64(size)
+	return layout, nil
+}
+
+// ValidatePEHeaders reports whether the headers of a PE file are well formed
+// enough for debug/pe to parse them.
+//
+// Extraction and verification fall back to a lenient parser that only reads
+// the headers leading to the security directory, so signatures can be
+// recovered from truncated or malformed samples. Call ValidatePEHeaders
+// first, or set VerifyOptions.StrictPEParsing, to reject such files instead.
+//
+// Parameters:
+//   - filePath: The path to the PE file
+//
+// Returns:
+//   - error: nil for well-formed headers, otherwise a PEFormatError
+//
+// Example usage:
+//
+//	if err := sigtool.ValidatePEHeaders("sample.exe"); errors.Is(err, sigtool.ErrNotPE) {
+//	    fmt.Println("Malformed PE headers")
+//	}
+func ValidatePEHeaders(filePath string) error {
+	// #nosec G304
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file %q: %w", filePath, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to get file info: %w", err)
+	}
+	_, err = readLayoutStrict(f, info.Size())
+	return err
+}
+
+// IsPEFile reports whether a file is a PE image, judging by its MZ and
+// PE\0\0 signatures rather than its extension.
+//
+// Only the DOS header and the PE signature are read, so IsPEFile is cheap
+// enough to classify every file of a directory tree; the rest of the
+// headers may still be malformed.
+//
+// Parameters:
+//   - filePath: The path to the file
+//
+// Returns:
+//   - bool: true if the file starts with a DOS header pointing to a PE
+//     signature
+//   - error: An error if the file cannot be opened or read
+//
+// Example usage:
+//
+//	ok, err := sigtool.IsPEFile("download.bin")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	if ok {
+//	    fmt.Println("PE image")
+//	}
+func IsPEFile(filePath string) (bool, error) {
+	// #nosec G304
+	f, err := os.Open(filePath)
+	if err != nil {
+		return false, fmt.Errorf("failed to open file %q: %w", filePath, err)
+	}
+	defer f.Close()
+
+	ok, err := isPEImage(f)
+	if err != nil {
+		return false, fmt.Errorf("failed to read file %q: %w", filePath, err)
+	}
+	return ok, nil
+}
+
+// isPEImage reports whether r starts with a DOS header pointing to a PE
+// signature
+func isPEImage(r io.ReaderAt) (bool, error) {
+	var header [0x40]byte
+	if _, err := r.ReadAt(header[:], 0); err != nil {
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		return false, err
+	}
+	if string(header[:2]) != "MZ" {
+		return false, nil
+	}
+	var signature [4]byte
+	if _, err := r.ReadAt(signature[:], int64(binary.LittleEndian.Uint32(header[0x3c:]))); err != nil {
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		return false, err
+	}
+	return string(signature[:]) == "PE\x00\x00", nil
+}
@@ -0,0 +1,127 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// createMalformedSignedPE writes a signed mock PE whose COFF symbol table
+// points past the end of the file, which debug/pe rejects
+func createMalformedSignedPE(t *testing.T) string {
+	t.Helper()
+
+	image := mockPEImage([]byte("payload!"))
+	binary.LittleEndian.PutUint32(image[64+4+8:], 0x7fffff00)
+	binary.LittleEndian.PutUint32(image[64+4+12:], 1)
+	signed := embedSignatureForTest(image, signAuthenticodeForTest(t, mockAuthentihash(image, crypto.SHA256), crypto.SHA256))
+
+	filePath := filepath.Join(t.TempDir(), "malformed.exe")
+	if err := os.WriteFile(filePath, signed, 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	return filePath
+}
+
+func TestLenientParser_Fallback(t *testing.T) {
+	filePath := createMalformedSignedPE(t)
+
+	if err := ValidatePEHeaders(filePath); !errors.Is(err, ErrNotPE) {
+		t.Fatalf("Expected debug/pe to reject the sample, got: %v", err)
+	}
+	if _, err := ExtractDigitalSignature(filePath); err != nil {
+		t.Errorf("Expected extraction to fall back to the lenient parser, got: %v", err)
+	}
+	if err := Verify(filePath, nil); err != nil {
+		t.Errorf("Expected verification to fall back to the lenient parser, got: %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{StrictPEParsing: true}); !errors.Is(err, ErrNotPE) {
+		t.Errorf("Expected ErrNotPE with strict parsing, got: %v", err)
+	}
+}
+
+func TestLenientParser_MatchesStrict(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	if err := ValidatePEHeaders(filePath); err != nil {
+		t.Errorf("Expected well-formed headers, got: %v", err)
+	}
+
+	strict, err := readLayoutStrict(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	lenient, err := readLayoutLenient(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !reflect.DeepEqual(strict, lenient) {
+		t.Errorf("Expected %+v, got %+v", strict, lenient)
+	}
+}
+
+func TestLenientParser_Invalid(t *testing.T) {
+	image := mockPEImage(nil)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"no PE signature", append([]byte(nil), image[:64]...)},
+		{"truncated optional header", append([]byte(nil), image[:mockSecDirOffset]...)},
+		{"unknown magic", func() []byte {
+			data := append([]byte(nil), image...)
+			binary.LittleEndian.PutUint16(data[mockOptHeaderOffset:], 0x0107)
+			return data
+		}()},
+	}
+	for _, tt := range tests {
+		if _, err := readLayoutLenient(bytes.NewReader(tt.data), int64(len(tt.data))); !errors.Is(err, ErrNotPE) {
+			t.Errorf("%s: expected ErrNotPE, got: %v", tt.name, err)
+		}
+	}
+}
+
+func TestIsPEFile(t *testing.T) {
+	image := mockPEImage(nil)
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"PE image", image, true},
+		{"empty", nil, false},
+		{"text", []byte("MZ is not enough on its own"), false},
+		{"DOS header only", append([]byte(nil), image[:64]...), false},
+		{"bad PE signature", func() []byte {
+			data := append([]byte(nil), image...)
+			copy(data[binary.LittleEndian.Uint32(data[0x3c:]):], "NE")
+			return data
+		}(), false},
+	}
+	for _, tt := range tests {
+		filePath := filepath.Join(dir, strings.ReplaceAll(tt.name, " ", "_")+".bin")
+		if err := os.WriteFile(filePath, tt.data, 0600); err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+		got, err := IsPEFile(filePath)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: IsPEFile = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if _, err := IsPEFile(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
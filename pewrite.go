@@ -0,0 +1,219 @@
+package sigtool
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// certificateTableAlignment is the alignment of WIN_CERTIFICATE entries and
+// of the certificate table itself
+const certificateTableAlignment = 8
+
+// alignCertificateTable rounds n up to the certificate table alignment
+func alignCertificateTable(n int64) int64 {
+	return (n + certificateTableAlignment - 1) &^ (certificateTableAlignment - 1)
+}
+
+// unsignedImage returns a copy of the PE image in data without its
+// certificate table and with the security directory cleared, together with
+// the layout of the result. The certificate table must be the last thing in
+// the file, as it is in every image produced by a linker or signing tool.
+func unsignedImage(data []byte) ([]byte, *peLayout, error) {
+	layout, err := readLayout(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	end := int64(len(data))
+	if layout.certTableSize > 0 {
+		if layout.certTableOffset+layout.certTableSize > end {
+			return nil, nil, &SignatureBoundsError{
+				Offset:   layout.certTableOffset,
+				Length:   layout.certTableSize,
+				FileSize: end,
+				Reason:   "certificate table extends beyond file bounds",
+			}
+		}
+		if layout.certTableOffset+layout.certTableSize != end {
+			return nil, nil, errors.New("certificate table is not at the end of the file")
+		}
+		end = layout.certTableOffset
+	}
+	if layout.noSecurityDir {
+		return nil, nil, &PEFormatError{Err: errors.New("image has fewer than five data directories and no security directory")}
+	}
+	if layout.securityDirOffset+8 > end {
+		return nil, nil, &PEFormatError{Err: errors.New("security directory lies outside the image")}
+	}
+
+	image := append([]byte(nil), data[:end]...)
+	binary.LittleEndian.PutUint64(image[layout.securityDirOffset:], 0)
+
+	layout.size = int64(len(image))
+	layout.certTableOffset = 0
+	layout.certTableSize = 0
+	return image, layout, nil
+}
+
+// alignImage pads an unsigned image with zeros to the certificate table
+// alignment and updates layout to match
+func alignImage(image []byte, layout *peLayout) []byte {
+	padded := alignCertificateTable(int64(len(image)))
+	image = append(image, make([]byte, padded-int64(len(image)))...)
+	layout.size = padded
+	return image
+}
+
+// appendCertificateTable appends a certificate table holding signature as a
+// single PKCS#7 WIN_CERTIFICATE entry to image, which must be an aligned
+// unsigned image, points the security directory at it and updates the image
+// checksum.
+func appendCertificateTable(image []byte, layout *peLayout, signature []byte) ([]byte, error) {
+	length := int64(winCertificateHeaderLength + len(signature))
+	entry := make([]byte, alignCertificateTable(length))
+	binary.LittleEndian.PutUint32(entry, uint32(length))
+	binary.LittleEndian.PutUint16(entry[4:], WinCertRevision2_0)
+	binary.LittleEndian.PutUint16(entry[6:], WinCertTypePKCSSignedData)
+	copy(entry[winCertificateHeaderLength:], signature)
+	return appendRawCertificateTable(image, layout, entry)
+}
+
+// appendRawCertificateTable appends an encoded certificate table to image,
+// which must be an aligned unsigned image, points the security directory at
+// it and updates the image checksum.
+func appendRawCertificateTable(image []byte, layout *peLayout, table []byte) ([]byte, error) {
+	size := int64(len(table))
+	if size > MaxSignatureSize {
+		return nil, &SignatureSizeError{Size: size, Limit: MaxSignatureSize}
+	}
+	if int64(len(image))+size > 1<<32-1 {
+		return nil, errors.New("signed image would exceed 4 GiB")
+	}
+
+	out := make([]byte, 0, int64(len(image))+size)
+	out = append(append(out, image...), table...)
+	binary.LittleEndian.PutUint32(out[layout.securityDirOffset:], uint32(len(image)))
+	binary.LittleEndian.PutUint32(out[layout.securityDirOffset+4:], uint32(size))
+	updateChecksum(out, layout)
+	return out, nil
+}
+
+// updateChecksum stores the checksum of image in its optional header
+func updateChecksum(image []byte, layout *peLayout) {
+	binary.LittleEndian.PutUint32(image[layout.checksumOffset:], peChecksum(image, layout.checksumOffset))
+}
+
+// peChecksum computes the PE image checksum of data as CheckSumMappedFile
+// does: the 16-bit one's complement sum of the file, with the checksum
+// field at checksumOffset read as zero, plus the file length.
+func peChecksum(data []byte, checksumOffset int64) uint32 {
+	var sum uint64
+	word := func(i int64) uint64 {
+		if i >= checksumOffset && i < checksumOffset+4 {
+			return 0
+		}
+		return uint64(data[i])
+	}
+	n := int64(len(data))
+	for i := int64(0); i < n; i += 2 {
+		w := word(i)
+		if i+1 < n {
+			w |= word(i+1) << 8
+		}
+		sum += w
+		sum = (sum & 0xffff) + (sum >> 16)
+	}
+	sum = (sum & 0xffff) + (sum >> 16)
+	return uint32(sum) + uint32(n)
+}
+
+// rewriteCertificateTable replaces the certificate table of the PE file at
+// filePath with the signature returned by sign for the unsigned image
+func rewriteCertificateTable(filePath string, sign func(image []byte, layout *peLayout) ([]byte, error)) error {
+	// #nosec G304
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	image, layout, err := unsignedImage(data)
+	if err != nil {
+		return err
+	}
+	image = alignImage(image, layout)
+
+	signature, err := sign(image, layout)
+	if err != nil {
+		return err
+	}
+	signed, err := appendCertificateTable(image, layout, signature)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filePath, signed)
+}
+
+// writeFileAtomic replaces filePath with data, keeping its permissions. The
+// data is written to a temporary file in the same directory that is then
+// renamed over filePath, so readers never observe a partial image.
+func writeFileAtomic(filePath string, data []byte) error {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set file mode: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filePath); err != nil {
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+	return nil
+}
+
+// updateSignature replaces the signature of the signed PE file at filePath
+// with the one update derives from it and the unsigned image. The image
+// itself is left as it is, so the new signature must cover the same
+// Authenticode digest.
+func updateSignature(filePath string, update func(signature, image []byte, layout *peLayout) ([]byte, error)) error {
+	// #nosec G304
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	signature, err := ExtractDigitalSignatureFromBytes(data)
+	if err != nil {
+		return err
+	}
+	image, layout, err := unsignedImage(data)
+	if err != nil {
+		return err
+	}
+
+	updated, err := update(signature, image, layout)
+	if err != nil {
+		return err
+	}
+	signed, err := appendCertificateTable(image, layout, updated)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filePath, signed)
+}
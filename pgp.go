@@ -0,0 +1,502 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	// The frozen x/crypto OpenPGP implementation is enough to verify
+	// package signatures, which only need RSA, DSA and ECDSA
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/clearsign"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// PGPKeyring is a set of OpenPGP public keys trusted to sign Linux
+// packages, as read with LoadPGPKeyring.
+type PGPKeyring struct {
+	entities openpgp.EntityList
+}
+
+// ParsePGPKeyring parses OpenPGP public keys, ASCII-armored or binary.
+//
+// Parameters:
+//   - data: The keys, such as the contents of an RPM-GPG-KEY file
+//
+// Returns:
+//   - *PGPKeyring: The keys
+//   - error: An error if data holds no usable key
+//
+// Example usage:
+//
+//	data, _ := os.ReadFile("RPM-GPG-KEY-fedora")
+//	keyring, err := sigtool.ParsePGPKeyring(data)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+func ParsePGPKeyring(data []byte) (*PGPKeyring, error) {
+	var entities openpgp.EntityList
+	var err error
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN PGP")) {
+		entities, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	} else {
+		entities, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse OpenPGP keys: %w", err)
+	}
+	if len(entities) == 0 {
+		return nil, errors.New("no OpenPGP public key found")
+	}
+	return &PGPKeyring{entities: entities}, nil
+}
+
+// LoadPGPKeyring reads OpenPGP public keys from each of filePaths into one
+// keyring: exported keys such as /etc/pki/rpm-gpg/RPM-GPG-KEY-* or
+// keyrings such as /etc/apt/trusted.gpg.d/*.gpg.
+//
+// Parameters:
+//   - filePaths: The paths to the key files
+//
+// Returns:
+//   - *PGPKeyring: The keys of every file
+//   - error: An error if a file cannot be read or holds no usable key
+//
+// Example usage:
+//
+//	keyring, err := sigtool.LoadPGPKeyring("/etc/pki/rpm-gpg/RPM-GPG-KEY-redhat-release")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	err = sigtool.Verify("package.rpm", &sigtool.VerifyOptions{PGPKeyring: keyring})
+func LoadPGPKeyring(filePaths ...string) (*PGPKeyring, error) {
+	if len(filePaths) == 0 {
+		return nil, errors.New("no OpenPGP key file given")
+	}
+	keyring := &PGPKeyring{}
+	for _, filePath := range filePaths {
+		if strings.TrimSpace(filePath) == "" {
+			return nil, errors.New("file path cannot be empty")
+		}
+		// #nosec G304 - This tool is designed to read user-specified key files
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read OpenPGP keys %q: %w", filePath, err)
+		}
+		keys, err := ParsePGPKeyring(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filePath, err)
+		}
+		keyring.entities = append(keyring.entities, keys.entities...)
+	}
+	return keyring, nil
+}
+
+// PGPSignatureInfo describes an OpenPGP signature of a package.
+type PGPSignatureInfo struct {
+	// Kind names the signature within the file, such as "RSAHEADER" for
+	// the header signature of an RPM package
+	Kind string
+	// Version is the signature packet version, 3 or 4
+	Version int
+	// KeyID is the 64-bit ID of the signing key in hexadecimal, or empty
+	// when the signature does not name it
+	KeyID string `json:",omitempty"`
+	// PublicKeyAlgorithm is the signature algorithm: "RSA", "DSA" or "ECDSA"
+	PublicKeyAlgorithm string
+	// HashAlgorithm is the digest algorithm of the signature
+	HashAlgorithm crypto.Hash
+	// CreationTime is the time the signature was made
+	CreationTime time.Time
+	// Fingerprint and UserID describe the signing key when it is in the
+	// keyring or, for an AppImage, is the key it embeds, and are empty
+	// otherwise
+	Fingerprint string `json:",omitempty"`
+	UserID      string `json:",omitempty"`
+}
+
+// InspectPGPSignatures parses the OpenPGP signatures of an RPM or Debian
+// package, an AppImage, a cleartext signed file such as an APT InRelease
+// file, or a detached signature such as Release.gpg, and reports the
+// signing keys. The signer of an AppImage is also named from the public key
+// it embeds.
+//
+// InspectPGPSignatures does not verify the signatures; use Verify with a
+// PGPKeyring to establish trust in the reported values.
+//
+// Parameters:
+//   - filePath: The path to the signed package
+//   - keyring: Keys to name the signers by, or nil
+//
+// Returns:
+//   - []PGPSignatureInfo: The signatures in file order
+//   - error: An error if the file is not signed with OpenPGP or a signature
+//     cannot be parsed
+//
+// Example usage:
+//
+//	signatures, err := sigtool.InspectPGPSignatures("package.rpm", nil)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	for _, s := range signatures {
+//	    fmt.Printf("%s: key %s, %s\n", s.Kind, s.KeyID, s.HashAlgorithm)
+//	}
+func InspectPGPSignatures(filePath string, keyring *PGPKeyring) ([]PGPSignatureInfo, error) {
+	signatures, err := readPGPSignatures(filePath)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]PGPSignatureInfo, len(signatures))
+	for i, s := range signatures {
+		infos[i] = s.info(keyring)
+	}
+	return infos, nil
+}
+
+// readPGPSignatures returns the OpenPGP signatures of the file at filePath
+func readPGPSignatures(filePath string) ([]*pgpSignature, error) {
+	if strings.TrimSpace(filePath) == "" {
+		return nil, errors.New("file path cannot be empty")
+	}
+	// #nosec G304 - This tool is designed to read user-specified files
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %q: %w", filePath, err)
+	}
+	defer f.Close()
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+	switch fileType, err := detectFileType(f, fileInfo.Size()); {
+	case err != nil:
+		return nil, fmt.Errorf("failed to read file %q: %w", filePath, err)
+	case fileType == FileTypeRPM:
+		pkg, err := openRPMPackage(f, fileInfo.Size())
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract signature: %w", err)
+		}
+		return pkg.pgpSignatures()
+	case fileType == FileTypeDeb:
+		pkg, err := openDebianPackage(f, fileInfo.Size())
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract signature: %w", err)
+		}
+		return pkg.pgpSignatures()
+	case fileType == FileTypeAppImage:
+		a, err := openAppImage(f, fileInfo.Size())
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract signature: %w", err)
+		}
+		return a.pgpSignatures()
+	case fileType == FileTypeUnknown && fileInfo.Size() <= MaxSignatureSize:
+		// A cleartext signed file such as InRelease, or a detached signature
+		// such as Release.gpg
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file %q: %w", filePath, err)
+		}
+		if isClearsigned(data) {
+			signatures, _, _, err := parseClearsigned("cleartext", data)
+			return signatures, err
+		}
+		if isPGPSignature(data) || bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN PGP SIGNATURE")) {
+			return parsePGPSignatures("detached", data)
+		}
+	}
+	return nil, fmt.Errorf("%w: %q has no OpenPGP signature", ErrNotSigned, filePath)
+}
+
+// pgpSignature is a parsed OpenPGP signature packet, version 3 or 4
+type pgpSignature struct {
+	kind string
+	v3   *packet.SignatureV3
+	v4   *packet.Signature
+	// embedded is the public key an AppImage embeds, which names the
+	// signer but is not trusted
+	embedded *PGPKeyring
+}
+
+// isPGPSignature reports whether data starts with an OpenPGP signature
+// packet, as extracted from RPM packages, rather than a DER signature
+func isPGPSignature(data []byte) bool {
+	if len(data) == 0 || data[0]&0x80 == 0 {
+		return false
+	}
+	// Old and new format packet tags of signature packets
+	return data[0]&0xc0 == 0xc0 && data[0]&0x3f == 2 || data[0]&0xc0 == 0x80 && data[0]>>2&0x0f == 2
+}
+
+// parsePGPSignature parses the binary or ASCII-armored OpenPGP signature
+// packet data, naming it kind
+func parsePGPSignature(kind string, data []byte) (*pgpSignature, error) {
+	signatures, err := parsePGPSignatures(kind, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(signatures) != 1 {
+		return nil, fmt.Errorf("%s signature holds %d signature packets", kind, len(signatures))
+	}
+	return signatures[0], nil
+}
+
+// parsePGPSignatures parses the binary or ASCII-armored OpenPGP signature
+// packets of data, such as a Release.gpg file signed by several keys,
+// naming them kind
+func parsePGPSignatures(kind string, data []byte) ([]*pgpSignature, error) {
+	var r io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN PGP SIGNATURE")) {
+		block, err := armor.Decode(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s signature: %w", kind, err)
+		}
+		r = block.Body
+	}
+	var signatures []*pgpSignature
+	packets := packet.NewReader(r)
+	for {
+		p, err := packets.Next()
+		if err == io.EOF && len(signatures) > 0 {
+			return signatures, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s signature: %w", kind, err)
+		}
+		s := &pgpSignature{kind: kind}
+		switch sig := p.(type) {
+		case *packet.Signature:
+			s.v4 = sig
+		case *packet.SignatureV3:
+			s.v3 = sig
+		default:
+			return nil, fmt.Errorf("%s signature is not an OpenPGP signature packet", kind)
+		}
+		if t := s.sigType(); t != packet.SigTypeBinary && t != packet.SigTypeText {
+			return nil, fmt.Errorf("%s signature is not a document signature (type %#x)", kind, t)
+		}
+		if !s.hash().Available() {
+			return nil, fmt.Errorf("%s signature has unsupported hash algorithm %v", kind, s.hash())
+		}
+		signatures = append(signatures, s)
+	}
+}
+
+// isClearsigned reports whether data is an OpenPGP cleartext signed
+// message, such as an InRelease file
+func isClearsigned(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("-----BEGIN PGP SIGNED MESSAGE-----"))
+}
+
+// parseClearsigned parses the cleartext signed message data, returning its
+// signatures, named kind, the text they sign and the text as written
+func parseClearsigned(kind string, data []byte) ([]*pgpSignature, []byte, []byte, error) {
+	block, _ := clearsign.Decode(data)
+	if block == nil {
+		return nil, nil, nil, fmt.Errorf("%s is not a cleartext signed message", kind)
+	}
+	signature, err := io.ReadAll(block.ArmoredSignature.Body)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to decode %s signature: %w", kind, err)
+	}
+	signatures, err := parsePGPSignatures(kind, signature)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return signatures, block.Bytes, block.Plaintext, nil
+}
+
+// hash returns the digest algorithm of s
+func (s *pgpSignature) hash() crypto.Hash {
+	if s.v3 != nil {
+		return s.v3.Hash
+	}
+	return s.v4.Hash
+}
+
+// sigType returns the signature type of s, binary or text
+func (s *pgpSignature) sigType() packet.SignatureType {
+	if s.v3 != nil {
+		return s.v3.SigType
+	}
+	return s.v4.SigType
+}
+
+// keyID returns the ID of the signing key and whether s names it
+func (s *pgpSignature) keyID() (uint64, bool) {
+	if s.v3 != nil {
+		return s.v3.IssuerKeyId, true
+	}
+	if s.v4.IssuerKeyId == nil {
+		return 0, false
+	}
+	return *s.v4.IssuerKeyId, true
+}
+
+// info describes s, naming its signer from keyring when it holds the key,
+// or else from the key embedded with s
+func (s *pgpSignature) info(keyring *PGPKeyring) PGPSignatureInfo {
+	info := PGPSignatureInfo{Kind: s.kind, HashAlgorithm: s.hash()}
+	if s.v3 != nil {
+		info.Version, info.CreationTime = 3, s.v3.CreationTime
+		info.PublicKeyAlgorithm = pgpAlgorithmName(s.v3.PubKeyAlgo)
+	} else {
+		info.Version, info.CreationTime = 4, s.v4.CreationTime
+		info.PublicKeyAlgorithm = pgpAlgorithmName(s.v4.PubKeyAlgo)
+	}
+	if id, ok := s.keyID(); ok {
+		info.KeyID = fmt.Sprintf("%016X", id)
+		for _, k := range []*PGPKeyring{keyring, s.embedded} {
+			if k == nil {
+				continue
+			}
+			if keys := k.entities.KeysById(id); len(keys) > 0 {
+				info.Fingerprint = fmt.Sprintf("%X", keys[0].PublicKey.Fingerprint)
+				info.UserID = pgpUserID(keys[0].Entity)
+				break
+			}
+		}
+	}
+	return info
+}
+
+// verify checks that s is a signature by a key of keyring over the
+// content returned by signed, and returns the key and the weak
+// cryptography s relies on
+func (s *pgpSignature) verify(keyring *PGPKeyring, signed func() io.Reader) (*openpgp.Key, []WeakCryptoFinding, error) {
+	id, named := s.keyID()
+	if keyring == nil || len(keyring.entities) == 0 {
+		if named {
+			return nil, nil, fmt.Errorf("%w: signed by OpenPGP key %016X; supply it in PGPKeyring", ErrSignerCertificateNotFound, id)
+		}
+		return nil, nil, fmt.Errorf("%w: supply the OpenPGP signing key in PGPKeyring", ErrSignerCertificateNotFound)
+	}
+	var keys []openpgp.Key
+	if named {
+		keys = keyring.entities.KeysById(id)
+	} else {
+		for _, e := range keyring.entities {
+			keys = append(keys, openpgp.Key{Entity: e, PublicKey: e.PrimaryKey})
+			for _, sub := range e.Subkeys {
+				keys = append(keys, openpgp.Key{Entity: e, PublicKey: sub.PublicKey, SelfSignature: sub.Sig})
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, nil, fmt.Errorf("%w: signed by OpenPGP key %016X, which is not in the keyring", ErrSignerCertificateNotFound, id)
+	}
+
+	var verifyErr error
+	for i := range keys {
+		key := &keys[i]
+		if s.v3 != nil && key.PublicKey.PubKeyAlgo == packet.PubKeyAlgoECDSA {
+			verifyErr = errors.New("version 3 signatures cannot be made with ECDSA keys")
+			continue
+		}
+		// Text signatures are over the content with CRLF line endings
+		h := s.hash().New()
+		var w io.Writer = h
+		if s.sigType() == packet.SigTypeText {
+			w = openpgp.NewCanonicalTextHash(h)
+		}
+		if _, err := io.Copy(w, signed()); err != nil {
+			return nil, nil, fmt.Errorf("failed to read signed content: %w", err)
+		}
+		switch {
+		case s.v3 != nil:
+			verifyErr = key.PublicKey.VerifySignatureV3(h, s.v3)
+		default:
+			verifyErr = key.PublicKey.VerifySignature(h, s.v4)
+		}
+		if verifyErr != nil {
+			continue
+		}
+		if len(key.Entity.Revocations) > 0 || key.SelfSignature != nil && key.SelfSignature.SigType == packet.SigTypeSubkeyRevocation {
+			return nil, nil, fmt.Errorf("%w: OpenPGP key %s", ErrCertificateRevoked, key.PublicKey.KeyIdString())
+		}
+		return key, pgpWeakFindings(s, key), nil
+	}
+	return nil, nil, fmt.Errorf("%w: %w", ErrInvalidSignature, verifyErr)
+}
+
+// verifyPGPSignatures checks that at least one of signatures is by a key
+// of keyring over the content returned by signed, as gpgv does for
+// documents signed by several keys: signatures by other keys are ignored,
+// but a bad signature by a key of keyring fails
+func verifyPGPSignatures(signatures []*pgpSignature, keyring *PGPKeyring, signed func() io.Reader) (*openpgp.Key, []WeakCryptoFinding, error) {
+	var good *openpgp.Key
+	var weak []WeakCryptoFinding
+	var firstErr error
+	for _, s := range signatures {
+		key, findings, err := s.verify(keyring, signed)
+		switch {
+		case err == nil && good == nil:
+			good, weak = key, findings
+		case err == nil:
+		case !errors.Is(err, ErrSignerCertificateNotFound):
+			return nil, nil, err
+		case firstErr == nil:
+			firstErr = err
+		}
+	}
+	if good == nil {
+		return nil, nil, firstErr
+	}
+	return good, weak, nil
+}
+
+// pgpWeakFindings returns the weak digest of s and the weak key it is made
+// with
+func pgpWeakFindings(s *pgpSignature, key *openpgp.Key) []WeakCryptoFinding {
+	var weak []WeakCryptoFinding
+	if h := s.hash(); h == crypto.MD5 || h == crypto.SHA1 {
+		weak = append(weak, WeakCryptoFinding{Kind: WeakFileDigest, Detail: h.String()})
+	}
+	bits, _ := key.PublicKey.BitLength()
+	switch key.PublicKey.PubKeyAlgo {
+	case packet.PubKeyAlgoRSA, packet.PubKeyAlgoRSASignOnly:
+		if int(bits) < MinRSAKeyBits {
+			weak = append(weak, WeakCryptoFinding{Kind: WeakRSAKey, Subject: pgpUserID(key.Entity), Detail: fmt.Sprintf("RSA %d-bit", bits)})
+		}
+	case packet.PubKeyAlgoDSA:
+		weak = append(weak, WeakCryptoFinding{Kind: WeakDSAKey, Subject: pgpUserID(key.Entity), Detail: fmt.Sprintf("DSA %d-bit", bits)})
+	}
+	return weak
+}
+
+// pgpUserID returns the primary user ID of e, or the first in name order,
+// or empty when e is nil or has none
+func pgpUserID(e *openpgp.Entity) string {
+	if e == nil || len(e.Identities) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(e.Identities))
+	for name, id := range e.Identities {
+		if id.SelfSignature != nil && id.SelfSignature.IsPrimaryId != nil && *id.SelfSignature.IsPrimaryId {
+			return name
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+// pgpAlgorithmName names an OpenPGP public key algorithm
+func pgpAlgorithmName(algorithm packet.PublicKeyAlgorithm) string {
+	switch algorithm {
+	case packet.PubKeyAlgoRSA, packet.PubKeyAlgoRSASignOnly:
+		return "RSA"
+	case packet.PubKeyAlgoDSA:
+		return "DSA"
+	case packet.PubKeyAlgoECDSA:
+		return "ECDSA"
+	}
+	return fmt.Sprintf("algorithm %d", algorithm)
+}
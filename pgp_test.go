@@ -0,0 +1,71 @@
+package sigtool
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+func TestLoadPGPKeyring(t *testing.T) {
+	first := pgpEntityForTest(t, "First", 2048)
+	second := pgpEntityForTest(t, "Second", 2048)
+
+	var binaryKey bytes.Buffer
+	if err := first.Serialize(&binaryKey); err != nil {
+		t.Fatalf("Failed to export key: %v", err)
+	}
+	var armored bytes.Buffer
+	w, err := armor.Encode(&armored, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatalf("Failed to armor key: %v", err)
+	}
+	if err := second.Serialize(w); err != nil {
+		t.Fatalf("Failed to export key: %v", err)
+	}
+	w.Close()
+
+	keyring, err := LoadPGPKeyring(writeScriptForTest(t, "first.gpg", binaryKey.Bytes()), writeScriptForTest(t, "second.asc", armored.Bytes()))
+	if err != nil {
+		t.Fatalf("LoadPGPKeyring failed: %v", err)
+	}
+	if len(keyring.entities) != 2 {
+		t.Fatalf("Expected two keys, got %d", len(keyring.entities))
+	}
+	for _, e := range []*openpgp.Entity{first, second} {
+		if keys := keyring.entities.KeysById(e.PrimaryKey.KeyId); len(keys) == 0 {
+			t.Errorf("Expected key %s in the keyring", e.PrimaryKey.KeyIdString())
+		}
+	}
+
+	if _, err := LoadPGPKeyring(); err == nil {
+		t.Error("Expected an error without key files")
+	}
+	if _, err := LoadPGPKeyring(writeScriptForTest(t, "junk.asc", []byte("not a key"))); err == nil {
+		t.Error("Expected an error for a file without keys")
+	}
+}
+
+func TestParsePGPSignature(t *testing.T) {
+	signer := pgpEntityForTest(t, "Signer", 2048)
+	var armored bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&armored, signer, bytes.NewReader([]byte("content")), nil); err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	s, err := parsePGPSignature("detached", armored.Bytes())
+	if err != nil {
+		t.Fatalf("parsePGPSignature failed: %v", err)
+	}
+	keyring := pgpKeyringForTest(t, signer)
+	if _, _, err := s.verify(keyring, func() io.Reader { return bytes.NewReader([]byte("content")) }); err != nil {
+		t.Errorf("Expected an armored signature to verify, got %v", err)
+	}
+	if _, _, err := s.verify(keyring, func() io.Reader { return bytes.NewReader([]byte("other content")) }); err == nil {
+		t.Error("Expected an error for other content")
+	}
+	if _, err := parsePGPSignature("junk", []byte{0x30, 0x03, 0x02, 0x01, 0x00}); err == nil {
+		t.Error("Expected an error for a DER structure")
+	}
+}
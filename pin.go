@@ -0,0 +1,52 @@
+package sigtool
+
+import (
+	"crypto/sha1" // #nosec G505 - SHA-1 thumbprints identify certificates, they are not used for security
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// checkSignerPins fails with ErrSignerNotPinned unless signer matches the
+// RequiredThumbprints and RequiredSubjects of opts
+func checkSignerPins(signer *x509.Certificate, opts VerifyOptions) error {
+	if len(opts.RequiredThumbprints) > 0 {
+		sha1Sum := sha1.Sum(signer.Raw) // #nosec G401 - certificate fingerprint
+		sha256Sum := sha256.Sum256(signer.Raw)
+		matched := false
+		for _, thumbprint := range opts.RequiredThumbprints {
+			switch normalizeHex(thumbprint) {
+			case hex.EncodeToString(sha1Sum[:]), hex.EncodeToString(sha256Sum[:]):
+				matched = true
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%w: thumbprint %x is not one of the required thumbprints", ErrSignerNotPinned, sha256Sum)
+		}
+	}
+
+	if len(opts.RequiredSubjects) > 0 {
+		subject := signer.Subject.String()
+		matched := false
+		for _, required := range opts.RequiredSubjects {
+			if matchName(signer.Subject, required) {
+				matched = true
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%w: subject %q is not one of %s", ErrSignerNotPinned, subject, strings.Join(quoteAll(opts.RequiredSubjects), ", "))
+		}
+	}
+	return nil
+}
+
+// quoteAll returns values quoted with %q
+func quoteAll(values []string) []string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = fmt.Sprintf("%q", v)
+	}
+	return quoted
+}
@@ -0,0 +1,49 @@
+package sigtool
+
+import (
+	"crypto"
+	"crypto/sha1" // #nosec G505 - test fingerprints
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestVerify_SignerPinning(t *testing.T) {
+	ca := issueCertificateForTest(t, testCATemplate("pinning root", 90), nil)
+	leaf := issueCertificateForTest(t, testLeafTemplate("pinned signer", 91, x509.ExtKeyUsageCodeSigning), ca)
+	other := issueCertificateForTest(t, testLeafTemplate("other signer", 92, x509.ExtKeyUsageCodeSigning), ca)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+	filePath := createSignedMockPEAs(t, leaf, crypto.SHA256)
+
+	sha1Sum := sha1.Sum(leaf.Cert.Raw) // #nosec G401
+	sha256Sum := sha256.Sum256(leaf.Cert.Raw)
+	otherSum := sha256.Sum256(other.Cert.Raw)
+	colons := strings.ToUpper(hex.EncodeToString(sha1Sum[:1])) + ":" + hex.EncodeToString(sha1Sum[1:])
+
+	tests := []struct {
+		name string
+		opts VerifyOptions
+		err  error
+	}{
+		{"SHA-256 thumbprint", VerifyOptions{Roots: roots, RequiredThumbprints: []string{hex.EncodeToString(sha256Sum[:])}}, nil},
+		{"SHA-1 thumbprint with colons", VerifyOptions{RequiredThumbprints: []string{hex.EncodeToString(otherSum[:]), colons}}, nil},
+		{"other thumbprint", VerifyOptions{Roots: roots, RequiredThumbprints: []string{hex.EncodeToString(otherSum[:])}}, ErrSignerNotPinned},
+		{"common name", VerifyOptions{RequiredSubjects: []string{"pinned signer"}}, nil},
+		{"distinguished name", VerifyOptions{RequiredSubjects: []string{leaf.Cert.Subject.String()}}, nil},
+		{"other subject", VerifyOptions{RequiredSubjects: []string{"other signer"}}, ErrSignerNotPinned},
+		{"subject matches but thumbprint does not", VerifyOptions{
+			RequiredSubjects:    []string{"pinned signer"},
+			RequiredThumbprints: []string{hex.EncodeToString(otherSum[:])},
+		}, ErrSignerNotPinned},
+	}
+	for _, tt := range tests {
+		err := Verify(filePath, &tt.opts)
+		if tt.err == nil && err != nil || tt.err != nil && !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v, got: %v", tt.name, tt.err, err)
+		}
+	}
+}
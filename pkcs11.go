@@ -0,0 +1,196 @@
+package sigtool
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// PKCS11Config locates a private key on a PKCS#11 token such as an HSM,
+// smart card or YubiKey.
+type PKCS11Config struct {
+	// Module is the path of the vendor PKCS#11 library, e.g.
+	// /usr/lib/softhsm/libsofthsm2.so or opensc-pkcs11.so
+	Module string
+	// Slot is the slot holding the token. It is ignored when TokenLabel is
+	// set.
+	Slot uint
+	// TokenLabel selects the slot by the label of its token
+	TokenLabel string
+	// PIN is the user PIN. When empty no login is performed.
+	PIN string
+	// KeyLabel is the CKA_LABEL of the private key
+	KeyLabel string
+	// KeyID is the CKA_ID of the private key. At least one of KeyLabel and
+	// KeyID must be set.
+	KeyID []byte
+	// Certificate is the signer certificate. When nil, the certificate
+	// object sharing the CKA_ID (or else the label) of the key is read from
+	// the token.
+	Certificate *x509.Certificate
+	// Chain holds intermediate certificates to embed in signatures
+	Chain []*x509.Certificate
+}
+
+// pkcs11Token is an open, logged-in session bound to one private key
+type pkcs11Token interface {
+	// signRSA signs data with CKM_RSA_PKCS
+	signRSA(data []byte) ([]byte, error)
+	// signECDSA signs digest with CKM_ECDSA, returning r || s
+	signECDSA(digest []byte) ([]byte, error)
+	// certificate returns the DER certificate stored alongside the key
+	certificate() ([]byte, error)
+	close() error
+}
+
+// PKCS11Signer is a Signer whose private key stays on a PKCS#11 token. It
+// supports RSA (PKCS #1 v1.5) and ECDSA keys and is safe for concurrent use.
+// Close releases the session.
+type PKCS11Signer struct {
+	token pkcs11Token
+	certs []*x509.Certificate
+}
+
+// OpenPKCS11Signer loads the PKCS#11 module of cfg, logs in to the token and
+// locates the private key and its certificate.
+//
+// PKCS#11 support requires cgo and a build with -tags sigtool_pkcs11; other
+// builds return ErrPKCS11Unavailable.
+//
+// Parameters:
+//   - cfg: The module, token, PIN and key to use
+//
+// Returns:
+//   - *PKCS11Signer: A signer for SignPEWith; Close it when done
+//   - error: An error if the module, token, key or certificate is unusable
+//
+// Example usage:
+//
+//	signer, err := sigtool.OpenPKCS11Signer(sigtool.PKCS11Config{
+//	    Module:   "/usr/lib/x86_64-linux-gnu/opensc-pkcs11.so",
+//	    PIN:      os.Getenv("TOKEN_PIN"),
+//	    KeyLabel: "code-signing",
+//	})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer signer.Close()
+//	err = sigtool.SignPEWith("app.exe", signer, nil)
+func OpenPKCS11Signer(cfg PKCS11Config) (*PKCS11Signer, error) {
+	if cfg.Module == "" {
+		return nil, errors.New("a PKCS#11 module path is required")
+	}
+	if cfg.KeyLabel == "" && len(cfg.KeyID) == 0 {
+		return nil, errors.New("a PKCS#11 key label or ID is required")
+	}
+	token, err := openPKCS11Token(cfg)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := newPKCS11Signer(token, cfg)
+	if err != nil {
+		_ = token.close()
+		return nil, err
+	}
+	return signer, nil
+}
+
+// newPKCS11Signer returns a signer for token, reading the certificate from
+// the token unless cfg supplies it
+func newPKCS11Signer(token pkcs11Token, cfg PKCS11Config) (*PKCS11Signer, error) {
+	cert := cfg.Certificate
+	if cert == nil {
+		der, err := token.certificate()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read PKCS#11 certificate: %w", err)
+		}
+		if cert, err = x509.ParseCertificate(der); err != nil {
+			return nil, fmt.Errorf("failed to parse PKCS#11 certificate: %w", err)
+		}
+	}
+	switch cert.PublicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("unsupported PKCS#11 key type %T", cert.PublicKey)
+	}
+	return &PKCS11Signer{token: token, certs: append([]*x509.Certificate{cert}, cfg.Chain...)}, nil
+}
+
+// Public returns the public key of the signer certificate.
+func (s *PKCS11Signer) Public() crypto.PublicKey {
+	return s.certs[0].PublicKey
+}
+
+// Sign signs digest on the token. RSA keys produce PKCS #1 v1.5 signatures
+// and ECDSA keys ASN.1 encoded signatures, as crypto.Signer requires.
+func (s *PKCS11Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	switch s.Public().(type) {
+	case *rsa.PublicKey:
+		if _, ok := opts.(*rsa.PSSOptions); ok {
+			return nil, errors.New("RSA-PSS is not supported by the PKCS#11 signer")
+		}
+		prefix, err := digestInfoPrefix(opts.HashFunc())
+		if err != nil {
+			return nil, err
+		}
+		return s.token.signRSA(append(prefix, digest...))
+	default:
+		raw, err := s.token.signECDSA(digest)
+		if err != nil {
+			return nil, err
+		}
+		return ecdsaSignatureFromRaw(raw)
+	}
+}
+
+// Certificates returns the signer certificate followed by the configured
+// chain.
+func (s *PKCS11Signer) Certificates() ([]*x509.Certificate, error) {
+	return s.certs, nil
+}
+
+// Close logs out and releases the session and module.
+func (s *PKCS11Signer) Close() error {
+	return s.token.close()
+}
+
+// digestInfoPrefix returns the DER DigestInfo header that precedes a digest
+// of h in a PKCS #1 v1.5 signature
+func digestInfoPrefix(h crypto.Hash) ([]byte, error) {
+	oid, err := oidForHash(h)
+	if err != nil {
+		return nil, err
+	}
+	der, err := asn1.Marshal(digestInfo{
+		DigestAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oid, Parameters: asn1.NullRawValue},
+		Digest:          make([]byte, h.Size()),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode DigestInfo: %w", err)
+	}
+	return der[:len(der)-h.Size()], nil
+}
+
+// ecdsaSignatureFromRaw converts a PKCS#11 r || s ECDSA signature to the
+// ASN.1 form used by Authenticode
+func ecdsaSignatureFromRaw(raw []byte) ([]byte, error) {
+	if len(raw) == 0 || len(raw)%2 != 0 {
+		return nil, fmt.Errorf("invalid ECDSA signature length %d", len(raw))
+	}
+	half := len(raw) / 2
+	der, err := asn1.Marshal(struct{ R, S *big.Int }{
+		R: new(big.Int).SetBytes(raw[:half]),
+		S: new(big.Int).SetBytes(raw[half:]),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode ECDSA signature: %w", err)
+	}
+	return der, nil
+}
@@ -0,0 +1,9 @@
+//go:build !sigtool_pkcs11 || !cgo
+
+package sigtool
+
+// openPKCS11Token reports that this build has no PKCS#11 support; rebuild
+// with cgo and -tags sigtool_pkcs11 to enable it.
+func openPKCS11Token(PKCS11Config) (pkcs11Token, error) {
+	return nil, ErrPKCS11Unavailable
+}
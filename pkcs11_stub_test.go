@@ -0,0 +1,15 @@
+//go:build !sigtool_pkcs11 || !cgo
+
+package sigtool
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOpenPKCS11Signer_Unavailable(t *testing.T) {
+	_, err := OpenPKCS11Signer(PKCS11Config{Module: "module.so", KeyLabel: "key"})
+	if !errors.Is(err, ErrPKCS11Unavailable) {
+		t.Errorf("Expected ErrPKCS11Unavailable, got: %v", err)
+	}
+}
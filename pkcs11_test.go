@@ -0,0 +1,136 @@
+package sigtool
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+// softToken is a pkcs11Token performing the raw token mechanisms in
+// software
+type softToken struct {
+	key    crypto.Signer
+	cert   []byte
+	closed bool
+}
+
+func (t *softToken) signRSA(data []byte) ([]byte, error) {
+	return rsa.SignPKCS1v15(rand.Reader, t.key.(*rsa.PrivateKey), 0, data)
+}
+
+func (t *softToken) signECDSA(digest []byte) ([]byte, error) {
+	key := t.key.(*ecdsa.PrivateKey)
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest)
+	if err != nil {
+		return nil, err
+	}
+	size := (key.Curve.Params().BitSize + 7) / 8
+	raw := make([]byte, 2*size)
+	r.FillBytes(raw[:size])
+	s.FillBytes(raw[size:])
+	return raw, nil
+}
+
+func (t *softToken) certificate() ([]byte, error) { return t.cert, nil }
+
+func (t *softToken) close() error {
+	t.closed = true
+	return nil
+}
+
+func TestPKCS11Signer_RSA(t *testing.T) {
+	root := issueCertificateForTest(t, testCATemplate("token root", 1), nil)
+	leaf := issueCertificateForTest(t, testLeafTemplate("token signer", 2, x509.ExtKeyUsageCodeSigning), root)
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Cert)
+
+	token := &softToken{key: leaf.Key, cert: leaf.Cert.Raw}
+	signer, err := newPKCS11Signer(token, PKCS11Config{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	digest := sha256.Sum256([]byte("message"))
+	signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := rsa.VerifyPKCS1v15(&leaf.Key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("Expected a PKCS #1 v1.5 signature, got: %v", err)
+	}
+	if _, err := signer.Sign(rand.Reader, digest[:], &rsa.PSSOptions{Hash: crypto.SHA256}); err == nil {
+		t.Error("Expected RSA-PSS to be rejected, got nil")
+	}
+
+	filePath := writeUnsignedPEForTest(t, []byte("token payload"))
+	if err := SignPEWith(filePath, signer, nil); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{Roots: roots}); err != nil {
+		t.Errorf("Expected token signature to verify, got: %v", err)
+	}
+	if err := signer.Close(); err != nil || !token.closed {
+		t.Errorf("Expected Close to release the token, got: %v", err)
+	}
+}
+
+func TestPKCS11Signer_ECDSA(t *testing.T) {
+	root := issueCertificateForTest(t, testCATemplate("token root", 1), nil)
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := testLeafTemplate("token signer", 2, x509.ExtKeyUsageCodeSigning)
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, template, root.Cert, &key.PublicKey, root.Key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	signer, err := newPKCS11Signer(&softToken{key: key}, PKCS11Config{Certificate: cert, Chain: []*x509.Certificate{root.Cert}})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	digest := sha256.Sum256([]byte("message"))
+	signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil || !ecdsa.VerifyASN1(&key.PublicKey, digest[:], signature) {
+		t.Errorf("Expected an ASN.1 ECDSA signature, got %x (%v)", signature, err)
+	}
+	certs, _ := signer.Certificates()
+	if len(certs) != 2 || !certs[0].Equal(cert) {
+		t.Errorf("Expected the configured certificate and chain, got %d certificates", len(certs))
+	}
+}
+
+func TestOpenPKCS11Signer_Config(t *testing.T) {
+	if _, err := OpenPKCS11Signer(PKCS11Config{KeyLabel: "key"}); err == nil || !strings.Contains(err.Error(), "module path") {
+		t.Errorf("Expected missing module error, got: %v", err)
+	}
+	if _, err := OpenPKCS11Signer(PKCS11Config{Module: "module.so"}); err == nil || !strings.Contains(err.Error(), "label or ID") {
+		t.Errorf("Expected missing key error, got: %v", err)
+	}
+	if _, err := newPKCS11Signer(&softToken{cert: []byte("junk")}, PKCS11Config{}); err == nil {
+		t.Error("Expected error for an unparseable token certificate, got nil")
+	}
+}
+
+func TestDigestInfoPrefix(t *testing.T) {
+	prefix, err := digestInfoPrefix(crypto.SHA256)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	// RFC 8017 section 9.2, note 1
+	want := "3031300d060960864801650304020105000420"
+	if got := hex.EncodeToString(prefix); got != want {
+		t.Errorf("Expected prefix %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,204 @@
+//go:build sigtool_pkcs11 && cgo
+
+package sigtool
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/miekg/pkcs11"
+)
+
+// moduleToken is a pkcs11Token backed by a loaded PKCS#11 module
+type moduleToken struct {
+	mu      sync.Mutex
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+	key     pkcs11.ObjectHandle
+	keyID   []byte
+	label   string
+	login   bool
+}
+
+// openPKCS11Token loads the module of cfg, opens a session on the selected
+// token, logs in and locates the private key
+func openPKCS11Token(cfg PKCS11Config) (pkcs11Token, error) {
+	ctx := pkcs11.New(cfg.Module)
+	if ctx == nil {
+		return nil, fmt.Errorf("failed to load PKCS#11 module %q", cfg.Module)
+	}
+	if err := ctx.Initialize(); err != nil && !isPKCS11Error(err, pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED) {
+		ctx.Destroy()
+		return nil, fmt.Errorf("failed to initialize PKCS#11 module: %w", err)
+	}
+	t := &moduleToken{ctx: ctx, label: cfg.KeyLabel}
+	if err := t.open(cfg); err != nil {
+		_ = t.close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// open selects the slot, logs in and finds the private key
+func (t *moduleToken) open(cfg PKCS11Config) error {
+	slot, err := findPKCS11Slot(t.ctx, cfg)
+	if err != nil {
+		return err
+	}
+	if t.session, err = t.ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION); err != nil {
+		return fmt.Errorf("failed to open PKCS#11 session: %w", err)
+	}
+	if cfg.PIN != "" {
+		if err := t.ctx.Login(t.session, pkcs11.CKU_USER, cfg.PIN); err != nil && !isPKCS11Error(err, pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+			return fmt.Errorf("failed to log in to PKCS#11 token: %w", err)
+		}
+		t.login = true
+	}
+
+	template := []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY)}
+	if cfg.KeyLabel != "" {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_LABEL, cfg.KeyLabel))
+	}
+	if len(cfg.KeyID) > 0 {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_ID, cfg.KeyID))
+	}
+	if t.key, err = t.findObject(template); err != nil {
+		return fmt.Errorf("failed to find PKCS#11 private key: %w", err)
+	}
+
+	t.keyID = cfg.KeyID
+	if len(t.keyID) == 0 {
+		attrs, err := t.ctx.GetAttributeValue(t.session, t.key, []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_ID, nil)})
+		if err == nil && len(attrs) == 1 {
+			t.keyID = attrs[0].Value
+		}
+	}
+	return nil
+}
+
+// findPKCS11Slot returns the slot of cfg, selected by token label or number
+func findPKCS11Slot(ctx *pkcs11.Ctx, cfg PKCS11Config) (uint, error) {
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list PKCS#11 slots: %w", err)
+	}
+	for _, slot := range slots {
+		if cfg.TokenLabel == "" {
+			if slot == cfg.Slot {
+				return slot, nil
+			}
+			continue
+		}
+		info, err := ctx.GetTokenInfo(slot)
+		if err == nil && strings.TrimRight(info.Label, " \x00") == cfg.TokenLabel {
+			return slot, nil
+		}
+	}
+	if cfg.TokenLabel != "" {
+		return 0, fmt.Errorf("no PKCS#11 token labeled %q", cfg.TokenLabel)
+	}
+	return 0, fmt.Errorf("no PKCS#11 token in slot %d", cfg.Slot)
+}
+
+// findObject returns the single object matching template
+func (t *moduleToken) findObject(template []*pkcs11.Attribute) (pkcs11.ObjectHandle, error) {
+	if err := t.ctx.FindObjectsInit(t.session, template); err != nil {
+		return 0, err
+	}
+	objects, _, err := t.ctx.FindObjects(t.session, 2)
+	if finalErr := t.ctx.FindObjectsFinal(t.session); err == nil {
+		err = finalErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	switch len(objects) {
+	case 0:
+		return 0, errors.New("no matching object")
+	case 1:
+		return objects[0], nil
+	default:
+		return 0, errors.New("more than one matching object")
+	}
+}
+
+// sign signs data with the private key using mechanism
+func (t *moduleToken) sign(mechanism uint, data []byte) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.ctx.SignInit(t.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(mechanism, nil)}, t.key); err != nil {
+		return nil, fmt.Errorf("PKCS#11 signing failed: %w", err)
+	}
+	signature, err := t.ctx.Sign(t.session, data)
+	if err != nil {
+		return nil, fmt.Errorf("PKCS#11 signing failed: %w", err)
+	}
+	return signature, nil
+}
+
+// signRSA signs data with CKM_RSA_PKCS
+func (t *moduleToken) signRSA(data []byte) ([]byte, error) {
+	return t.sign(pkcs11.CKM_RSA_PKCS, data)
+}
+
+// signECDSA signs digest with CKM_ECDSA
+func (t *moduleToken) signECDSA(digest []byte) ([]byte, error) {
+	return t.sign(pkcs11.CKM_ECDSA, digest)
+}
+
+// certificate returns the X.509 certificate object with the CKA_ID of the
+// key, or else its label
+func (t *moduleToken) certificate() ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	template := []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_CERTIFICATE)}
+	switch {
+	case len(t.keyID) > 0:
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_ID, t.keyID))
+	case t.label != "":
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_LABEL, t.label))
+	}
+	handle, err := t.findObject(template)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := t.ctx.GetAttributeValue(t.session, handle, []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_VALUE, nil)})
+	if err != nil {
+		return nil, err
+	}
+	if len(attrs) != 1 || len(attrs[0].Value) == 0 {
+		return nil, errors.New("certificate object has no value")
+	}
+	return attrs[0].Value, nil
+}
+
+// close logs out, closes the session and unloads the module
+func (t *moduleToken) close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var err error
+	if t.session != 0 {
+		if t.login {
+			_ = t.ctx.Logout(t.session)
+		}
+		err = t.ctx.CloseSession(t.session)
+		t.session = 0
+	}
+	if t.ctx != nil {
+		_ = t.ctx.Finalize()
+		t.ctx.Destroy()
+		t.ctx = nil
+	}
+	return err
+}
+
+// isPKCS11Error reports whether err is the PKCS#11 return value code
+func isPKCS11Error(err error, code uint) bool {
+	var e pkcs11.Error
+	return errors.As(err, &e) && uint(e) == code
+}
@@ -0,0 +1,16 @@
+//go:build sigtool_pkcs11 && cgo
+
+package sigtool
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpenPKCS11Signer_MissingModule(t *testing.T) {
+	_, err := OpenPKCS11Signer(PKCS11Config{Module: filepath.Join(t.TempDir(), "missing.so"), KeyLabel: "key"})
+	if err == nil || !strings.Contains(err.Error(), "failed to load PKCS#11 module") {
+		t.Errorf("Expected module load error, got: %v", err)
+	}
+}
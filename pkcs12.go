@@ -0,0 +1,69 @@
+package sigtool
+
+import (
+	"errors"
+	"fmt"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// PKCS12Encryption selects the algorithms protecting an exported PKCS#12
+// file.
+type PKCS12Encryption int
+
+const (
+	// PKCS12Modern uses AES-256-CBC with PBKDF2 and a SHA-256 MAC, accepted by
+	// OpenSSL 1.1+, Java 12+ and Windows Server 2019+
+	PKCS12Modern PKCS12Encryption = iota
+	// PKCS12Legacy uses 3DES and a SHA-1 MAC for older importers
+	PKCS12Legacy
+)
+
+// ExportPKCS12 packages the certificates embedded in the signature of a PE
+// file into a password-protected PKCS#12 trust store. No private key is
+// included.
+//
+// The certificates are those reported by ExportCertificates, so the file
+// also holds any timestamp authority certificates.
+//
+// Parameters:
+//   - filePath: The path to the signed PE file
+//   - password: The password protecting the file; it must not be empty
+//   - encryption: PKCS12Modern, or PKCS12Legacy for older tooling
+//
+// Returns:
+//   - []byte: The DER encoded PKCS#12 file
+//   - error: An error if the signature cannot be extracted or encoded
+//
+// Example usage:
+//
+//	pfx, err := sigtool.ExportPKCS12("signed.exe", password, sigtool.PKCS12Modern)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	_ = os.WriteFile("chain.p12", pfx, 0600)
+func ExportPKCS12(filePath, password string, encryption PKCS12Encryption) ([]byte, error) {
+	if password == "" {
+		return nil, errors.New("PKCS#12 password cannot be empty")
+	}
+
+	var encoder *pkcs12.Encoder
+	switch encryption {
+	case PKCS12Modern:
+		encoder = pkcs12.Modern
+	case PKCS12Legacy:
+		encoder = pkcs12.Legacy
+	default:
+		return nil, fmt.Errorf("unsupported PKCS#12 encryption %d", encryption)
+	}
+
+	certs, err := signatureCertificates(filePath)
+	if err != nil {
+		return nil, err
+	}
+	pfx, err := encoder.EncodeTrustStore(certs, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode PKCS#12: %w", err)
+	}
+	return pfx, nil
+}
@@ -0,0 +1,42 @@
+package sigtool
+
+import (
+	"crypto"
+	"strings"
+	"testing"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func TestExportPKCS12(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+	signer, _ := testSigner(t)
+
+	for _, encryption := range []PKCS12Encryption{PKCS12Modern, PKCS12Legacy} {
+		pfx, err := ExportPKCS12(filePath, "s3cret", encryption)
+		if err != nil {
+			t.Fatalf("Encryption %d: expected no error, got: %v", encryption, err)
+		}
+		certs, err := pkcs12.DecodeTrustStore(pfx, "s3cret")
+		if err != nil || len(certs) != 1 || !certs[0].Equal(signer) {
+			t.Errorf("Encryption %d: expected trust store with the signer, got %d certificates (%v)", encryption, len(certs), err)
+		}
+		if _, err := pkcs12.DecodeTrustStore(pfx, "wrong"); err == nil {
+			t.Errorf("Encryption %d: expected wrong password to fail", encryption)
+		}
+	}
+}
+
+func TestExportPKCS12_InvalidInput(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+
+	if _, err := ExportPKCS12(filePath, "", PKCS12Modern); err == nil || !strings.Contains(err.Error(), "password cannot be empty") {
+		t.Errorf("Expected empty password error, got: %v", err)
+	}
+	if _, err := ExportPKCS12(filePath, "pw", PKCS12Encryption(9)); err == nil || !strings.Contains(err.Error(), "unsupported PKCS#12 encryption") {
+		t.Errorf("Expected unsupported encryption error, got: %v", err)
+	}
+	if _, err := ExportPKCS12(createMockPEFile(t, false, nil), "pw", PKCS12Modern); err == nil {
+		t.Error("Expected error for unsigned file, got nil")
+	}
+}
@@ -0,0 +1,343 @@
+package sigtool
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// macOS installer packages (.pkg) are xar archives: a header, a zlib
+// compressed XML table of contents (TOC) and the heap holding the file
+// data, the TOC checksum and the signatures over that checksum
+const (
+	xarMagic      = 0x78617221 // "xar!"
+	xarHeaderSize = 28
+	// maxXarTOCSize bounds the compressed and uncompressed TOC
+	maxXarTOCSize = 64 << 20
+)
+
+// xarChecksumAlgorithms are the TOC checksum and file checksum styles
+var xarChecksumAlgorithms = map[string]crypto.Hash{
+	"md5":    crypto.MD5,
+	"sha1":   crypto.SHA1,
+	"sha224": crypto.SHA224,
+	"sha256": crypto.SHA256,
+	"sha384": crypto.SHA384,
+	"sha512": crypto.SHA512,
+}
+
+// xarArchive is a parsed xar archive
+type xarArchive struct {
+	r          io.ReaderAt
+	size       int64
+	heapOffset int64
+	// rawTOC is the compressed TOC the checksum covers
+	rawTOC []byte
+	toc    xarTOC
+}
+
+// xarTOC is the part of the xar table of contents sigtool reads
+type xarTOC struct {
+	Checksum   xarHeapRange  `xml:"toc>checksum"`
+	Signature  *xarSignature `xml:"toc>signature"`
+	XSignature *xarSignature `xml:"toc>x-signature"`
+	Files      []xarFile     `xml:"toc>file"`
+}
+
+// xarHeapRange locates data in the heap; Style names its algorithm
+type xarHeapRange struct {
+	Style  string `xml:"style,attr"`
+	Offset int64  `xml:"offset"`
+	Size   int64  `xml:"size"`
+}
+
+// xarSignature is a signature over the TOC checksum: an RSA signature or,
+// as an x-signature, a CMS signature, with the certificates of its signer
+type xarSignature struct {
+	xarHeapRange
+	Certificates []string `xml:"KeyInfo>X509Data>X509Certificate"`
+}
+
+// xarFile is a file or directory entry of the TOC
+type xarFile struct {
+	Name  string    `xml:"name"`
+	Data  *xarData  `xml:"data"`
+	Files []xarFile `xml:"file"`
+}
+
+// xarData locates the archived data of a file in the heap
+type xarData struct {
+	Offset           int64 `xml:"offset"`
+	Length           int64 `xml:"length"`
+	ArchivedChecksum struct {
+		Style string `xml:"style,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"archived-checksum"`
+}
+
+// isXarArchive reports whether r starts with the xar magic number
+func isXarArchive(r io.ReaderAt) bool {
+	var magic [4]byte
+	if _, err := r.ReadAt(magic[:], 0); err != nil {
+		return false
+	}
+	return binary.BigEndian.Uint32(magic[:]) == xarMagic
+}
+
+// openXarArchive reads the header and table of contents of the xar
+// archive r
+func openXarArchive(r io.ReaderAt, size int64) (*xarArchive, error) {
+	header := make([]byte, xarHeaderSize)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("failed to read xar header: %w", err)
+	}
+	if binary.BigEndian.Uint32(header) != xarMagic {
+		return nil, errors.New("not a xar archive")
+	}
+	headerSize := int64(binary.BigEndian.Uint16(header[4:]))
+	compressed := binary.BigEndian.Uint64(header[8:])
+	uncompressed := binary.BigEndian.Uint64(header[16:])
+	if headerSize < xarHeaderSize {
+		return nil, fmt.Errorf("xar header size %d is too small", headerSize)
+	}
+	if compressed > maxXarTOCSize || uncompressed > maxXarTOCSize {
+		return nil, &SignatureSizeError{Size: int64(max(compressed, uncompressed)), Limit: maxXarTOCSize}
+	}
+	if headerSize+int64(compressed) > size {
+		return nil, &SignatureBoundsError{
+			Offset: headerSize, Length: int64(compressed), FileSize: size,
+			Reason: "xar table of contents exceeds the file",
+		}
+	}
+
+	x := &xarArchive{r: r, size: size, heapOffset: headerSize + int64(compressed), rawTOC: make([]byte, compressed)}
+	if _, err := r.ReadAt(x.rawTOC, headerSize); err != nil {
+		return nil, fmt.Errorf("failed to read xar table of contents: %w", err)
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(x.rawTOC))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress xar table of contents: %w", err)
+	}
+	defer zr.Close()
+	toc, err := io.ReadAll(io.LimitReader(zr, int64(uncompressed)+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress xar table of contents: %w", err)
+	}
+	if uint64(len(toc)) != uncompressed {
+		return nil, fmt.Errorf("xar table of contents is %d bytes, header says %d", len(toc), uncompressed)
+	}
+	if err := xml.Unmarshal(toc, &x.toc); err != nil {
+		return nil, fmt.Errorf("failed to parse xar table of contents: %w", err)
+	}
+	return x, nil
+}
+
+// heap reads the heap data at rng
+func (x *xarArchive) heap(rng xarHeapRange, what string) ([]byte, error) {
+	if rng.Offset < 0 || rng.Size < 0 || rng.Size > x.size || x.heapOffset+rng.Offset > x.size-rng.Size {
+		return nil, &SignatureBoundsError{
+			Offset: x.heapOffset + rng.Offset, Length: rng.Size, FileSize: x.size,
+			Reason: what + " exceeds the xar heap",
+		}
+	}
+	data := make([]byte, rng.Size)
+	if _, err := x.r.ReadAt(data, x.heapOffset+rng.Offset); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", what, err)
+	}
+	return data, nil
+}
+
+// checksum returns the TOC checksum algorithm and the checksum stored in
+// the heap, which the signatures sign
+func (x *xarArchive) checksum() (crypto.Hash, []byte, error) {
+	algorithm, ok := xarChecksumAlgorithms[x.toc.Checksum.Style]
+	if !ok || !algorithm.Available() {
+		return 0, nil, fmt.Errorf("unsupported xar checksum %q", x.toc.Checksum.Style)
+	}
+	if x.toc.Checksum.Size != int64(algorithm.Size()) {
+		return 0, nil, fmt.Errorf("xar %s checksum is %d bytes", x.toc.Checksum.Style, x.toc.Checksum.Size)
+	}
+	stored, err := x.heap(x.toc.Checksum, "TOC checksum")
+	if err != nil {
+		return 0, nil, err
+	}
+	return algorithm, stored, nil
+}
+
+// verifyFiles checks the archived data of every file against its
+// archived checksum
+func (x *xarArchive) verifyFiles(files []xarFile, dir string) error {
+	for _, f := range files {
+		name := dir + f.Name
+		if f.Data != nil {
+			algorithm, ok := xarChecksumAlgorithms[f.Data.ArchivedChecksum.Style]
+			if !ok || !algorithm.Available() {
+				return fmt.Errorf("%s: unsupported xar checksum %q", name, f.Data.ArchivedChecksum.Style)
+			}
+			signed, err := hex.DecodeString(strings.TrimSpace(f.Data.ArchivedChecksum.Value))
+			if err != nil {
+				return fmt.Errorf("%s: malformed archived checksum: %w", name, err)
+			}
+			if f.Data.Length < 0 || x.heapOffset+f.Data.Offset > x.size-f.Data.Length || f.Data.Offset < 0 {
+				return &SignatureBoundsError{
+					Offset: x.heapOffset + f.Data.Offset, Length: f.Data.Length, FileSize: x.size,
+					Reason: name + " exceeds the xar heap",
+				}
+			}
+			h := algorithm.New()
+			if _, err := io.Copy(h, io.NewSectionReader(x.r, x.heapOffset+f.Data.Offset, f.Data.Length)); err != nil {
+				return fmt.Errorf("failed to read %s: %w", name, err)
+			}
+			if computed := h.Sum(nil); subtle.ConstantTimeCompare(computed, signed) != 1 {
+				return fmt.Errorf("%s: %w", name, &DigestMismatchError{Algorithm: algorithm, Signed: signed, Computed: computed})
+			}
+		}
+		if err := x.verifyFiles(f.Files, name+"/"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// certificates parses the certificates of sig, its signer first
+func (sig *xarSignature) certificates() ([]*x509.Certificate, error) {
+	certs := make([]*x509.Certificate, 0, len(sig.Certificates))
+	for _, encoded := range sig.Certificates {
+		der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode xar signature certificate: %w", err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse xar signature certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("xar signature has no signer certificate")
+	}
+	return certs, nil
+}
+
+// readPKGSignature returns the CMS signature of the installer package r.
+// Packages signed before macOS 10.5 carry an RSA signature only, which has
+// no PKCS#7 form.
+func readPKGSignature(r io.ReaderAt, size int64) ([]byte, error) {
+	x, err := openXarArchive(r, size)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case x.toc.XSignature != nil:
+		return x.heap(x.toc.XSignature.xarHeapRange, "CMS signature")
+	case x.toc.Signature != nil:
+		return nil, errors.New("package has an RSA signature but no CMS signature")
+	}
+	return nil, fmt.Errorf("%w (package has no signature)", ErrNotSigned)
+}
+
+// verifyPKG verifies the installer package r as pkgutil --check-signature
+// does. Unless disabled, the TOC must match its checksum and every file its
+// archived checksum. The RSA signature must be over the checksum with the
+// key of its first certificate, and the CMS signature, when present, must
+// be over the checksum by the same signer; the signer is then checked per
+// opts.
+func verifyPKG(r io.ReaderAt, size int64, opts VerifyOptions) error {
+	x, err := openXarArchive(r, size)
+	if err != nil {
+		return fmt.Errorf("failed to extract signature: %w", err)
+	}
+	if x.toc.Signature == nil && x.toc.XSignature == nil {
+		return fmt.Errorf("%w (package has no signature)", ErrNotSigned)
+	}
+	algorithm, checksum, err := x.checksum()
+	if err != nil {
+		return fmt.Errorf("failed to extract signature: %w", err)
+	}
+	opts.logger().Debug("read package signature", "fileSize", size, "checksum", x.toc.Checksum.Style, "rsa", x.toc.Signature != nil, "cms", x.toc.XSignature != nil)
+
+	if !opts.SkipContentDigest {
+		h := algorithm.New()
+		h.Write(x.rawTOC)
+		if computed := h.Sum(nil); subtle.ConstantTimeCompare(computed, checksum) != 1 {
+			return fmt.Errorf("table of contents: %w", &DigestMismatchError{Algorithm: algorithm, Signed: checksum, Computed: computed})
+		}
+		if err := x.verifyFiles(x.toc.Files, ""); err != nil {
+			return err
+		}
+	}
+	var weak []WeakCryptoFinding
+	if algorithm == crypto.MD5 || algorithm == crypto.SHA1 {
+		weak = append(weak, WeakCryptoFinding{Kind: WeakFileDigest, Detail: algorithm.String()})
+	}
+
+	var signer *x509.Certificate
+	var certs []*x509.Certificate
+	if sig := x.toc.Signature; sig != nil {
+		if sig.Style != "RSA" {
+			return fmt.Errorf("unsupported xar signature style %q", sig.Style)
+		}
+		signature, err := x.heap(sig.xarHeapRange, "RSA signature")
+		if err != nil {
+			return fmt.Errorf("failed to extract signature: %w", err)
+		}
+		if certs, err = sig.certificates(); err != nil {
+			return err
+		}
+		signer = certs[0]
+		key, ok := signer.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("xar RSA signature certificate has no RSA key")
+		}
+		if err := rsa.VerifyPKCS1v15(key, algorithm, checksum, signature); err != nil {
+			return fmt.Errorf("signer signature verification failed: %w", err)
+		}
+	}
+
+	if sig := x.toc.XSignature; sig != nil {
+		if sig.Style != "CMS" {
+			return fmt.Errorf("unsupported xar x-signature style %q", sig.Style)
+		}
+		data, err := x.heap(sig.xarHeapRange, "CMS signature")
+		if err != nil {
+			return fmt.Errorf("failed to extract signature: %w", err)
+		}
+		p7, err := parsePKCS7(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse PKCS#7 signature: %w", err)
+		}
+		if signer != nil {
+			if cms := p7.GetOnlySigner(); cms == nil || !cms.Equal(signer) {
+				return errors.New("xar RSA and CMS signatures are by different signers")
+			}
+		}
+		// The CMS signature is detached from the checksum it signs
+		p7.Content = checksum
+		if err := verifySignedData(p7, opts); err != nil {
+			return err
+		}
+		if opts.RejectWeakCrypto && len(weak) > 0 {
+			return &WeakCryptoError{Findings: weak}
+		}
+		return nil
+	}
+
+	trust, err := resolveTrust(opts)
+	if err != nil {
+		return err
+	}
+	weak = append(weak, weakCertificateFindings(certs, 0)...)
+	return verifyCertificateTrust(signer, certs, weak, opts, trust, time.Time{})
+}
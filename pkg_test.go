@@ -0,0 +1,187 @@
+package sigtool
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// xarSigningForTest selects how xarForTest signs a package
+type xarSigningForTest struct {
+	// rsa and cms add the RSA signature and the CMS x-signature
+	rsa, cms bool
+	// checksum is the TOC checksum style, sha256 when empty
+	checksum string
+	// cmsSigner signs the CMS signature, machoIdentityForTest when nil
+	cmsSigner *testIdentity
+}
+
+// xarPayloadForTest is the payload file of xarForTest
+var xarPayloadForTest = bytes.Repeat([]byte("payload "), 256)
+
+// xarForTest returns an installer package holding a Distribution file and
+// a Payload file in a Scripts directory, signed by machoIdentityForTest per
+// signing
+func xarForTest(t testing.TB, signing xarSigningForTest) []byte {
+	t.Helper()
+	id, _ := machoIdentityForTest(t)
+	style := signing.checksum
+	if style == "" {
+		style = "sha256"
+	}
+	algorithm := xarChecksumAlgorithms[style]
+	cmsSigner := signing.cmsSigner
+	if cmsSigner == nil {
+		cmsSigner = id
+	}
+
+	var keyInfo strings.Builder
+	keyInfo.WriteString(`<KeyInfo xmlns="http://www.w3.org/2000/09/xmldsig#"><X509Data>`)
+	for _, c := range append([]*x509.Certificate{id.Cert}, id.Chain...) {
+		fmt.Fprintf(&keyInfo, "<X509Certificate>%s</X509Certificate>", base64.StdEncoding.EncodeToString(c.Raw))
+	}
+	keyInfo.WriteString(`</X509Data></KeyInfo>`)
+	var cmsKeyInfo strings.Builder
+	fmt.Fprintf(&cmsKeyInfo, `<KeyInfo xmlns="http://www.w3.org/2000/09/xmldsig#"><X509Data><X509Certificate>%s</X509Certificate></X509Data></KeyInfo>`, base64.StdEncoding.EncodeToString(cmsSigner.Cert.Raw))
+
+	distribution := []byte(`<?xml version="1.0"?><installer-gui-script minSpecVersion="1"/>`)
+	fileData := func(data []byte, offset int) string {
+		h := algorithm.New()
+		h.Write(data)
+		sum := hex.EncodeToString(h.Sum(nil))
+		return fmt.Sprintf(`<data><length>%d</length><offset>%d</offset><size>%d</size><encoding style="application/octet-stream"/><extracted-checksum style="%s">%s</extracted-checksum><archived-checksum style="%s">%s</archived-checksum></data>`,
+			len(data), offset, len(data), style, sum, style, sum)
+	}
+
+	const rsaSize = 256
+	offset := algorithm.Size()
+	var sigs strings.Builder
+	if signing.rsa {
+		fmt.Fprintf(&sigs, `<signature style="RSA"><offset>%d</offset><size>%d</size>%s</signature>`, offset, rsaSize, keyInfo.String())
+		offset += rsaSize
+	}
+	distributionAt, payloadAt := offset, offset+len(distribution)
+	heapCMS := payloadAt + len(xarPayloadForTest)
+	cmsSize := len(signDetachedForTest(t, cmsSigner, make([]byte, algorithm.Size())))
+	if signing.cms {
+		fmt.Fprintf(&sigs, `<x-signature style="CMS"><offset>%d</offset><size>%d</size>%s</x-signature>`, heapCMS, cmsSize, cmsKeyInfo.String())
+	}
+	toc := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?><xar><toc><creation-time>2026-01-01T00:00:00</creation-time><checksum style="%s"><offset>0</offset><size>%d</size></checksum>%s`+
+		`<file id="1"><name>Distribution</name><type>file</type>%s</file>`+
+		`<file id="2"><name>Scripts</name><type>directory</type><file id="3"><name>Payload</name><type>file</type>%s</file></file></toc></xar>`,
+		style, algorithm.Size(), sigs.String(), fileData(distribution, distributionAt), fileData(xarPayloadForTest, payloadAt))
+
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write([]byte(toc))
+	zw.Close()
+	h := algorithm.New()
+	h.Write(compressed.Bytes())
+	checksum := h.Sum(nil)
+
+	header := make([]byte, xarHeaderSize)
+	binary.BigEndian.PutUint32(header, xarMagic)
+	binary.BigEndian.PutUint16(header[4:], xarHeaderSize)
+	binary.BigEndian.PutUint16(header[6:], 1)
+	binary.BigEndian.PutUint64(header[8:], uint64(compressed.Len()))
+	binary.BigEndian.PutUint64(header[16:], uint64(len(toc)))
+	binary.BigEndian.PutUint32(header[24:], 3)
+
+	pkg := append(append(header, compressed.Bytes()...), checksum...)
+	if signing.rsa {
+		signature, err := rsa.SignPKCS1v15(rand.Reader, id.Key, algorithm, checksum)
+		if err != nil {
+			t.Fatalf("Failed to sign the TOC checksum: %v", err)
+		}
+		pkg = append(pkg, signature...)
+	}
+	pkg = append(append(pkg, distribution...), xarPayloadForTest...)
+	if signing.cms {
+		pkg = append(pkg, signDetachedForTest(t, cmsSigner, checksum)...)
+	}
+	return pkg
+}
+
+func TestVerify_PKG(t *testing.T) {
+	pkg := xarForTest(t, xarSigningForTest{rsa: true, cms: true})
+	filePath := writeScriptForTest(t, "installer.pkg", pkg)
+	if fileType, err := DetectFileType(filePath); err != nil || fileType != FileTypePKG {
+		t.Fatalf("Expected FileTypePKG, got %q, %v", fileType, err)
+	}
+	opts := &VerifyOptions{Roots: machoRootsForTest(t)}
+	if err := Verify(filePath, opts); err != nil {
+		t.Fatalf("Expected valid package signature, got %v", err)
+	}
+	info, err := Inspect(filePath)
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	if info.Signer == nil || !strings.Contains(info.Signer.Subject, "Developer ID Application") {
+		t.Errorf("Expected the Developer ID signer, got %+v", info.Signer)
+	}
+
+	tampered := append([]byte(nil), pkg...)
+	i := bytes.Index(tampered, xarPayloadForTest)
+	tampered[i+100] ^= 0xff
+	if err := Verify(writeScriptForTest(t, "installer.pkg", tampered), opts); !errors.Is(err, ErrDigestMismatch) || !strings.Contains(err.Error(), "Scripts/Payload") {
+		t.Errorf("Expected ErrDigestMismatch for a modified payload, got %v", err)
+	}
+	if err := Verify(writeScriptForTest(t, "installer.pkg", tampered), &VerifyOptions{Roots: machoRootsForTest(t), SkipContentDigest: true}); err != nil {
+		t.Errorf("Expected a modified payload to pass with SkipContentDigest, got %v", err)
+	}
+
+	// The TOC checksum starts the heap
+	tampered = append([]byte(nil), pkg...)
+	heap := xarHeaderSize + int(binary.BigEndian.Uint64(pkg[8:]))
+	tampered[heap] ^= 0xff
+	if err := Verify(writeScriptForTest(t, "installer.pkg", tampered), opts); !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("Expected ErrDigestMismatch for a modified TOC checksum, got %v", err)
+	}
+}
+
+func TestVerify_PKGRSAOnly(t *testing.T) {
+	filePath := writeScriptForTest(t, "installer.pkg", xarForTest(t, xarSigningForTest{rsa: true, checksum: "sha1"}))
+	if err := Verify(filePath, &VerifyOptions{Roots: machoRootsForTest(t)}); err != nil {
+		t.Fatalf("Expected valid RSA package signature, got %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{Roots: machoRootsForTest(t), RejectWeakCrypto: true}); !errors.Is(err, ErrWeakCrypto) {
+		t.Errorf("Expected ErrWeakCrypto for a SHA-1 TOC checksum, got %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{Roots: testRoots(t)}); err == nil {
+		t.Error("Expected an untrusted RSA signer to fail")
+	}
+	if _, err := ExtractDigitalSignature(filePath); err == nil || !strings.Contains(err.Error(), "no CMS signature") {
+		t.Errorf("Expected an error extracting a package without a CMS signature, got %v", err)
+	}
+}
+
+func TestVerify_PKGErrors(t *testing.T) {
+	unsigned := writeScriptForTest(t, "installer.pkg", xarForTest(t, xarSigningForTest{}))
+	if err := Verify(unsigned, nil); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned for an unsigned package, got %v", err)
+	}
+	if _, err := ExtractDigitalSignature(unsigned); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned extracting an unsigned package, got %v", err)
+	}
+
+	cert, key := testSigner(t)
+	mixed := writeScriptForTest(t, "installer.pkg", xarForTest(t, xarSigningForTest{rsa: true, cms: true, cmsSigner: &testIdentity{Cert: cert, Key: key}}))
+	if err := Verify(mixed, nil); err == nil || !strings.Contains(err.Error(), "different signers") {
+		t.Errorf("Expected an error for RSA and CMS signatures by different signers, got %v", err)
+	}
+
+	truncated := xarForTest(t, xarSigningForTest{rsa: true})
+	var boundsErr *SignatureBoundsError
+	if err := Verify(writeScriptForTest(t, "installer.pkg", truncated[:xarHeaderSize+10]), nil); !errors.As(err, &boundsErr) {
+		t.Errorf("Expected SignatureBoundsError for a truncated package, got %v", err)
+	}
+}
@@ -0,0 +1,381 @@
+package sigtool
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/konidev20/sigtool/internal/yamlsubset"
+)
+
+// Policy rule IDs reported in PolicyViolation.RuleID
+const (
+	// RuleSigned requires the file to carry a signature
+	RuleSigned = "signed"
+	// RuleSignature requires the signature and, when trust is configured,
+	// its chain to verify
+	RuleSignature = "signature"
+	// RuleAllowedSigner requires the signer to be one of AllowedSigners
+	RuleAllowedSigner = "allowed-signer"
+	// RuleDigestAlgorithm requires the file digest to use one of
+	// DigestAlgorithms
+	RuleDigestAlgorithm = "digest-algorithm"
+	// RuleTimestamp requires a timestamp countersignature
+	RuleTimestamp = "timestamp"
+	// RuleRevocation requires the chain not to be revoked
+	RuleRevocation = "revocation"
+	// RuleWeakCrypto forbids weak cryptography
+	RuleWeakCrypto = "weak-crypto"
+)
+
+// Revocation modes of PolicyRules.Revocation
+const (
+	RevocationNone = "none"
+	RevocationSoft = "soft"
+	RevocationHard = "hard"
+)
+
+// Policy describes the signatures a set of PE files must carry. It is
+// loaded from JSON or YAML with LoadPolicy.
+//
+// Rules apply to every file. Each override whose Path matches a file
+// replaces the rules it sets, in order, so later overrides win.
+type Policy struct {
+	// Rules are the default requirements
+	Rules PolicyRules `json:"rules"`
+	// Overrides adjust the rules for matching paths
+	Overrides []PolicyOverride `json:"overrides,omitempty"`
+}
+
+// PolicyOverride replaces the rules it sets for files matching Path.
+type PolicyOverride struct {
+	// Path is a path.Match pattern over slash-separated paths. A pattern
+	// without a slash matches the base name of the file.
+	Path string `json:"path"`
+	// Rules hold the replaced requirements; unset fields are inherited
+	Rules PolicyRules `json:"rules"`
+}
+
+// PolicyRules are the requirements of a policy. Unset fields impose no
+// requirement.
+type PolicyRules struct {
+	// AllowedSigners lists the acceptable signers; a signer is accepted
+	// when it matches every field set in one of them
+	AllowedSigners []PolicySigner `json:"allowedSigners,omitempty"`
+	// DigestAlgorithms lists the acceptable file digest algorithms, e.g.
+	// "SHA-256"; dashes and case are ignored
+	DigestAlgorithms []string `json:"digestAlgorithms,omitempty"`
+	// RequireTimestamp requires a timestamp countersignature
+	RequireTimestamp *bool `json:"requireTimestamp,omitempty"`
+	// Revocation is RevocationNone, RevocationSoft or RevocationHard. Soft
+	// and hard check the chain with OCSP and CRLs; hard fails when the
+	// status cannot be determined. Revocation needs chain validation.
+	Revocation string `json:"revocation,omitempty"`
+	// RejectWeakCrypto forbids the findings of FindWeakCrypto
+	RejectWeakCrypto *bool `json:"rejectWeakCrypto,omitempty"`
+	// AllowUnsigned accepts files without a signature
+	AllowUnsigned *bool `json:"allowUnsigned,omitempty"`
+}
+
+// PolicySigner identifies an allowed signer by any combination of
+// thumbprint, subject and issuer.
+type PolicySigner struct {
+	// Thumbprint is the SHA-1 or SHA-256 fingerprint of the signer
+	Thumbprint string `json:"thumbprint,omitempty"`
+	// Subject is the distinguished name or common name of the signer,
+	// compared with NamesMatch
+	Subject string `json:"subject,omitempty"`
+	// Issuer is the distinguished name or common name of the signer's
+	// issuer
+	Issuer string `json:"issuer,omitempty"`
+}
+
+// PolicyResult is the outcome of evaluating a file against a policy.
+type PolicyResult struct {
+	// Path is the evaluated file
+	Path string `json:"path"`
+	// Violations lists every failed rule; it is empty when the file passes
+	Violations []PolicyViolation `json:"violations,omitempty"`
+}
+
+// Pass reports whether the file satisfies the policy.
+func (r *PolicyResult) Pass() bool {
+	return len(r.Violations) == 0
+}
+
+// MarshalJSON adds the pass field to the encoded result.
+func (r PolicyResult) MarshalJSON() ([]byte, error) {
+	type result PolicyResult
+	return json.Marshal(struct {
+		result
+		Pass bool `json:"pass"`
+	}{result(r), r.Pass()})
+}
+
+// PolicyViolation is a failed policy rule.
+type PolicyViolation struct {
+	// RuleID is one of the Rule constants
+	RuleID string `json:"rule"`
+	// Message describes the failure
+	Message string `json:"message"`
+}
+
+// LoadPolicy reads a JSON or YAML policy from the file at path, as
+// ParsePolicy does.
+//
+// Parameters:
+//   - path: The policy file
+//
+// Returns:
+//   - *Policy: The parsed policy
+//   - error: An error if the file cannot be read or is not a valid policy
+//
+// Example policy:
+//
+//	{
+//	  "rules": {
+//	    "allowedSigners": [{"subject": "Contoso Ltd"}],
+//	    "digestAlgorithms": ["SHA-256", "SHA-384"],
+//	    "requireTimestamp": true,
+//	    "revocation": "soft"
+//	  },
+//	  "overrides": [
+//	    {"path": "legacy/*", "rules": {"digestAlgorithms": ["SHA-1", "SHA-256"]}}
+//	  ]
+//	}
+//
+// or in YAML:
+//
+//	rules:
+//	  allowedSigners:
+//	    - subject: Contoso Ltd
+//	  digestAlgorithms: [SHA-256, SHA-384]
+//	  requireTimestamp: true
+//	  revocation: soft
+//	overrides:
+//	  - path: legacy/*
+//	    rules:
+//	      digestAlgorithms: [SHA-1, SHA-256]
+func LoadPolicy(path string) (*Policy, error) {
+	// #nosec G304 - policies are user-specified files
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy %q: %w", path, err)
+	}
+	policy, err := ParsePolicy(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy %q: %w", path, err)
+	}
+	return policy, nil
+}
+
+// ParsePolicy reads a JSON or YAML policy from r; a document starting with
+// { is JSON. YAML policies use the same keys and the YAML subset of the
+// configuration file. Unknown fields are rejected so that misspelled rules
+// do not silently weaken the policy.
+func ParsePolicy(r io.Reader) (*Policy, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] != '{' {
+		doc, err := yamlsubset.Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse YAML policy: %w", err)
+		}
+		if _, ok := doc.(map[string]interface{}); !ok {
+			return nil, errors.New("failed to parse YAML policy: expected a mapping")
+		}
+		if data, err = json.Marshal(yamlsubset.JSON(doc)); err != nil {
+			return nil, fmt.Errorf("failed to parse YAML policy: %w", err)
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var policy Policy
+	if err := dec.Decode(&policy); err != nil {
+		return nil, err
+	}
+	rules := []PolicyRules{policy.Rules}
+	for _, o := range policy.Overrides {
+		if _, err := path.Match(o.Path, ""); err != nil {
+			return nil, fmt.Errorf("invalid override path %q: %w", o.Path, err)
+		}
+		rules = append(rules, o.Rules)
+	}
+	for _, r := range rules {
+		switch r.Revocation {
+		case "", RevocationNone, RevocationSoft, RevocationHard:
+		default:
+			return nil, fmt.Errorf("invalid revocation mode %q", r.Revocation)
+		}
+	}
+	return &policy, nil
+}
+
+// RulesFor returns the rules that apply to filePath after overrides.
+func (p *Policy) RulesFor(filePath string) PolicyRules {
+	rules := p.Rules
+	slashed := filepath.ToSlash(filePath)
+	for _, o := range p.Overrides {
+		name := slashed
+		if !strings.Contains(o.Path, "/") {
+			name = path.Base(slashed)
+		}
+		if ok, _ := path.Match(o.Path, name); !ok {
+			continue
+		}
+		if o.Rules.AllowedSigners != nil {
+			rules.AllowedSigners = o.Rules.AllowedSigners
+		}
+		if o.Rules.DigestAlgorithms != nil {
+			rules.DigestAlgorithms = o.Rules.DigestAlgorithms
+		}
+		if o.Rules.RequireTimestamp != nil {
+			rules.RequireTimestamp = o.Rules.RequireTimestamp
+		}
+		if o.Rules.Revocation != "" {
+			rules.Revocation = o.Rules.Revocation
+		}
+		if o.Rules.RejectWeakCrypto != nil {
+			rules.RejectWeakCrypto = o.Rules.RejectWeakCrypto
+		}
+		if o.Rules.AllowUnsigned != nil {
+			rules.AllowUnsigned = o.Rules.AllowUnsigned
+		}
+	}
+	return rules
+}
+
+// Evaluate checks a PE file against the policy and reports every violated
+// rule.
+//
+// opts supplies the trust configuration; with the zero VerifyOptions the
+// signature and file digest are verified but the chain is not validated,
+// and revocation rules have no effect. The revocation checkers of opts are
+// replaced according to the rules.
+//
+// Parameters:
+//   - filePath: The PE file to evaluate
+//   - opts: Trust configuration for signature verification
+//
+// Returns:
+//   - *PolicyResult: The violations; Pass reports the verdict
+//
+// Example usage:
+//
+//	policy, err := sigtool.LoadPolicy("policy.json")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	result := policy.Evaluate("app.exe", sigtool.VerifyOptions{UseSystemRoots: true})
+//	for _, v := range result.Violations {
+//	    fmt.Printf("%s: [%s] %s\n", result.Path, v.RuleID, v.Message)
+//	}
+func (p *Policy) Evaluate(filePath string, opts VerifyOptions) *PolicyResult {
+	result := &PolicyResult{Path: filePath}
+	fail := func(rule, format string, args ...interface{}) {
+		result.Violations = append(result.Violations, PolicyViolation{RuleID: rule, Message: fmt.Sprintf(format, args...)})
+	}
+	rules := p.RulesFor(filePath)
+
+	info, err := Inspect(filePath)
+	if errors.Is(err, ErrNotSigned) {
+		if rules.AllowUnsigned == nil || !*rules.AllowUnsigned {
+			fail(RuleSigned, "file is not signed")
+		}
+		return result
+	}
+	if err != nil {
+		fail(RuleSignature, "%v", err)
+		return result
+	}
+
+	switch rules.Revocation {
+	case RevocationSoft, RevocationHard:
+		hard := rules.Revocation == RevocationHard
+		opts.OCSP = NewOCSPChecker(DefaultOCSPTimeout, hard)
+		opts.CRL = NewCRLChecker(0, hard)
+	case RevocationNone:
+		opts.OCSP, opts.CRL = nil, nil
+	}
+	if err := Verify(filePath, &opts); err != nil {
+		rule := RuleSignature
+		if errors.Is(err, ErrCertificateRevoked) || errors.Is(err, ErrRevocationUnknown) {
+			rule = RuleRevocation
+		}
+		fail(rule, "%v", err)
+	}
+
+	if len(rules.AllowedSigners) > 0 && !policySignerAllowed(info.Signer, rules.AllowedSigners) {
+		subject := "unknown signer"
+		if info.Signer != nil {
+			subject = info.Signer.Subject
+		}
+		fail(RuleAllowedSigner, "signer %q is not an allowed signer", subject)
+	}
+
+	if len(rules.DigestAlgorithms) > 0 {
+		allowed := false
+		for _, name := range rules.DigestAlgorithms {
+			if normalizeAlgorithmName(name) == normalizeAlgorithmName(info.DigestAlgorithm.String()) {
+				allowed = true
+			}
+		}
+		if !allowed {
+			fail(RuleDigestAlgorithm, "digest algorithm %s is not one of %s", info.DigestAlgorithm, strings.Join(rules.DigestAlgorithms, ", "))
+		}
+	}
+
+	if rules.RequireTimestamp != nil && *rules.RequireTimestamp && info.Timestamp == nil {
+		fail(RuleTimestamp, "signature is not timestamped")
+	}
+
+	if rules.RejectWeakCrypto != nil && *rules.RejectWeakCrypto {
+		findings, err := FindWeakCrypto(filePath)
+		if err != nil {
+			fail(RuleWeakCrypto, "%v", err)
+		}
+		for _, f := range findings {
+			fail(RuleWeakCrypto, "signature %d: %s", f.Signature, f)
+		}
+	}
+
+	return result
+}
+
+// policySignerAllowed reports whether signer matches one of allowed
+func policySignerAllowed(signer *CertificateInfo, allowed []PolicySigner) bool {
+	if signer == nil {
+		return false
+	}
+	for _, a := range allowed {
+		if a.Thumbprint == "" && a.Subject == "" && a.Issuer == "" {
+			continue
+		}
+		if t := normalizeHex(a.Thumbprint); t != "" && t != signer.SHA1Thumbprint && t != signer.SHA256Thumbprint {
+			continue
+		}
+		if a.Subject != "" && !matchName(signer.Certificate.Subject, a.Subject) {
+			continue
+		}
+		if a.Issuer != "" && !matchName(signer.Certificate.Issuer, a.Issuer) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// normalizeAlgorithmName uppercases name and removes dashes, so "sha256"
+// matches "SHA-256"
+func normalizeAlgorithmName(name string) string {
+	return strings.ToUpper(strings.ReplaceAll(name, "-", ""))
+}
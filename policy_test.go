@@ -0,0 +1,143 @@
+package sigtool
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy(strings.NewReader(`{
+		"rules": {"digestAlgorithms": ["SHA-256"], "requireTimestamp": true},
+		"overrides": [
+			{"path": "*.sys", "rules": {"revocation": "hard"}},
+			{"path": "legacy/*", "rules": {"digestAlgorithms": ["SHA-1", "SHA-256"], "requireTimestamp": false}}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	rules := policy.RulesFor("drivers/net.sys")
+	if rules.Revocation != RevocationHard || len(rules.DigestAlgorithms) != 1 || !*rules.RequireTimestamp {
+		t.Errorf("Expected the base name override only, got %+v", rules)
+	}
+	rules = policy.RulesFor("legacy/old.exe")
+	if rules.Revocation != "" || len(rules.DigestAlgorithms) != 2 || *rules.RequireTimestamp {
+		t.Errorf("Expected the path override only, got %+v", rules)
+	}
+
+	for _, bad := range []string{
+		`{"rules": {"digestAlgorithm": ["SHA-256"]}}`,
+		`{"rules": {"revocation": "sometimes"}}`,
+		`{"overrides": [{"path": "[", "rules": {}}]}`,
+	} {
+		if _, err := ParsePolicy(strings.NewReader(bad)); err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestParsePolicy_YAML(t *testing.T) {
+	policy, err := ParsePolicy(strings.NewReader(`# release policy
+rules:
+  allowedSigners:
+    - subject: "Contoso, Ltd" # quoted for the comma
+      issuer: Contoso CA
+    - thumbprint: 0123456789
+  digestAlgorithms: [SHA-256]
+  requireTimestamp: true
+overrides:
+  - path: '*.sys'
+    rules:
+      revocation: hard
+  - path: legacy/*
+    rules:
+      digestAlgorithms:
+        - SHA-1
+        - SHA-256
+      requireTimestamp: false
+`))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	signers := policy.Rules.AllowedSigners
+	if len(signers) != 2 || signers[0].Subject != "Contoso, Ltd" || signers[0].Issuer != "Contoso CA" || signers[1].Thumbprint != "0123456789" {
+		t.Errorf("Expected both allowed signers, got %+v", signers)
+	}
+	rules := policy.RulesFor("drivers/net.sys")
+	if rules.Revocation != RevocationHard || len(rules.DigestAlgorithms) != 1 || !*rules.RequireTimestamp {
+		t.Errorf("Expected the base name override only, got %+v", rules)
+	}
+	rules = policy.RulesFor("legacy/old.exe")
+	if rules.Revocation != "" || len(rules.DigestAlgorithms) != 2 || *rules.RequireTimestamp {
+		t.Errorf("Expected the path override only, got %+v", rules)
+	}
+
+	for _, bad := range []string{
+		"rules:\n  digestAlgorithm: [SHA-256]\n",
+		"rules:\n  revocation: sometimes\n",
+		"rules:\n  requireTimestamp: maybe\n",
+		"overrides:\n  - path: '['\n",
+		"rules:\n\trevocation: hard\n",
+		"- rules\n",
+	} {
+		if _, err := ParsePolicy(strings.NewReader(bad)); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+
+	path := writeScriptForTest(t, "policy.yaml", []byte("rules:\n  allowUnsigned: true\n"))
+	if policy, err := LoadPolicy(path); err != nil || policy.Rules.AllowUnsigned == nil || !*policy.Rules.AllowUnsigned {
+		t.Errorf("Expected LoadPolicy to read a YAML file, got %+v, %v", policy, err)
+	}
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	ca := issueCertificateForTest(t, testCATemplate("policy root", 100), nil)
+	leaf := issueCertificateForTest(t, testLeafTemplate("policy signer", 101, x509.ExtKeyUsageCodeSigning), ca)
+	sha256File := createSignedMockPEAs(t, leaf, crypto.SHA256)
+	sha1File := createSignedMockPEAs(t, leaf, crypto.SHA1)
+	unsigned := writeUnsignedPEForTest(t, []byte("policy-unsigned"))
+	yes := true
+
+	tests := []struct {
+		name   string
+		rules  PolicyRules
+		file   string
+		ruleID string
+	}{
+		{"allowed signer", PolicyRules{AllowedSigners: []PolicySigner{{Subject: "other"}, {Subject: "policy signer", Issuer: ca.Cert.Subject.String()}}}, sha256File, ""},
+		{"unknown signer", PolicyRules{AllowedSigners: []PolicySigner{{Subject: "other"}}}, sha256File, RuleAllowedSigner},
+		{"allowed digest", PolicyRules{DigestAlgorithms: []string{"sha256"}}, sha256File, ""},
+		{"disallowed digest", PolicyRules{DigestAlgorithms: []string{"SHA-256"}}, sha1File, RuleDigestAlgorithm},
+		{"missing timestamp", PolicyRules{RequireTimestamp: &yes}, sha256File, RuleTimestamp},
+		{"weak crypto", PolicyRules{RejectWeakCrypto: &yes}, sha1File, RuleWeakCrypto},
+		{"unsigned", PolicyRules{}, unsigned, RuleSigned},
+		{"unsigned allowed", PolicyRules{AllowUnsigned: &yes}, unsigned, ""},
+	}
+	for _, tt := range tests {
+		result := (&Policy{Rules: tt.rules}).Evaluate(tt.file, VerifyOptions{})
+		if tt.ruleID == "" {
+			if !result.Pass() {
+				t.Errorf("%s: expected a pass, got %+v", tt.name, result.Violations)
+			}
+			continue
+		}
+		if result.Pass() || result.Violations[0].RuleID != tt.ruleID {
+			t.Errorf("%s: expected a %s violation, got %+v", tt.name, tt.ruleID, result.Violations)
+		}
+	}
+
+	untrusted := (&Policy{}).Evaluate(sha256File, VerifyOptions{Roots: x509.NewCertPool()})
+	if untrusted.Pass() || untrusted.Violations[0].RuleID != RuleSignature {
+		t.Errorf("Expected a signature violation for an untrusted chain, got %+v", untrusted.Violations)
+	}
+
+	encoded, err := json.Marshal(untrusted)
+	if err != nil || !strings.Contains(string(encoded), `"pass":false`) || !strings.Contains(string(encoded), `"rule":"signature"`) {
+		t.Errorf("Unexpected JSON result %s (%v)", encoded, err)
+	}
+}
@@ -0,0 +1,543 @@
+package sigtool
+
+import (
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.mozilla.org/pkcs7"
+)
+
+// VerificationCheck identifies one check of VerifyDetailed.
+type VerificationCheck string
+
+// Checks reported by VerifyDetailed, in the order they run
+const (
+	// CheckStructure covers reading the PE headers, the certificate table
+	// and the PKCS#7 signature
+	CheckStructure VerificationCheck = "structure"
+	// CheckCertificateSlack rejects data after the signature in the
+	// certificate table (RejectCertificateSlack)
+	CheckCertificateSlack VerificationCheck = "certificate-slack"
+	// CheckDigest compares the recomputed Authenticode file digest with the
+	// signed digest
+	CheckDigest VerificationCheck = "digest"
+	// CheckSignature verifies the signer signature over the authenticated
+	// attributes
+	CheckSignature VerificationCheck = "signature"
+	// CheckSignerPin applies RequiredThumbprints and RequiredSubjects
+	CheckSignerPin VerificationCheck = "signer-pin"
+	// CheckCodeSigning applies RequireCodeSigning
+	CheckCodeSigning VerificationCheck = "code-signing"
+	// CheckTimestamp verifies the timestamp countersignature
+	CheckTimestamp VerificationCheck = "timestamp"
+	// CheckTrustedPublisher applies RequireTrustedPublisher
+	CheckTrustedPublisher VerificationCheck = "trusted-publisher"
+	// CheckChain validates the signer certificate chain
+	CheckChain VerificationCheck = "chain"
+	// CheckDenylist looks up the embedded and chain certificates in the
+	// Denylist
+	CheckDenylist VerificationCheck = "denylist"
+	// CheckWeakCrypto applies RejectWeakCrypto
+	CheckWeakCrypto VerificationCheck = "weak-crypto"
+	// CheckRevocation checks the validated chains with OCSP and CRLs
+	CheckRevocation VerificationCheck = "revocation"
+)
+
+// CheckStatus is the outcome of a check.
+type CheckStatus string
+
+const (
+	// StatusPassed means the check ran and succeeded
+	StatusPassed CheckStatus = "passed"
+	// StatusFailed means the check ran and failed
+	StatusFailed CheckStatus = "failed"
+	// StatusSkipped means the check was not requested by the options or
+	// could not run because a check it depends on failed
+	StatusSkipped CheckStatus = "skipped"
+)
+
+// ReasonCode is a stable, machine-readable cause of a failed check.
+type ReasonCode string
+
+// Reason codes of failed checks
+const (
+	ReasonNotSigned             ReasonCode = "not-signed"
+	ReasonNotPE                 ReasonCode = "not-pe"
+	ReasonMalformedSignature    ReasonCode = "malformed-signature"
+	ReasonCertificateSlack      ReasonCode = "certificate-slack"
+	ReasonDigestMismatch        ReasonCode = "digest-mismatch"
+	ReasonMessageDigestMismatch ReasonCode = "message-digest-mismatch"
+	ReasonInvalidSignature      ReasonCode = "invalid-signature"
+	ReasonDeniedCertificate     ReasonCode = "denied-certificate"
+	ReasonSignerNotPinned       ReasonCode = "signer-not-pinned"
+	ReasonNotCodeSigning        ReasonCode = "not-code-signing"
+	ReasonInvalidTimestamp      ReasonCode = "invalid-timestamp"
+	ReasonUntrustedPublisher    ReasonCode = "untrusted-publisher"
+	ReasonTrustUnavailable      ReasonCode = "trust-unavailable"
+	ReasonUnknownAuthority      ReasonCode = "unknown-authority"
+	ReasonCertificateExpired    ReasonCode = "certificate-expired"
+	ReasonInvalidChain          ReasonCode = "invalid-chain"
+	ReasonWeakCrypto            ReasonCode = "weak-crypto"
+	ReasonCertificateRevoked    ReasonCode = "certificate-revoked"
+	ReasonRevocationUnknown     ReasonCode = "revocation-unknown"
+	ReasonError                 ReasonCode = "error"
+)
+
+// CheckResult is the outcome of one verification check.
+type CheckResult struct {
+	// Check identifies the check
+	Check VerificationCheck `json:"check"`
+	// Status is the outcome
+	Status CheckStatus `json:"status"`
+	// Reason classifies a failure; it is empty unless Status is StatusFailed
+	Reason ReasonCode `json:"reason,omitempty"`
+	// Message describes the failure or why the check was skipped
+	Message string `json:"message,omitempty"`
+	// Err is the failure, matching the sentinel errors of Verify
+	Err error `json:"-"`
+}
+
+// VerificationResult holds the outcome of every check of VerifyDetailed.
+type VerificationResult struct {
+	// Path is the verified file
+	Path string `json:"path"`
+	// Checks lists the checks in the order they ran
+	Checks []CheckResult `json:"checks"`
+}
+
+// Valid reports whether no check failed.
+func (r *VerificationResult) Valid() bool {
+	return len(r.Failed()) == 0
+}
+
+// Failed returns the failed checks.
+func (r *VerificationResult) Failed() []CheckResult {
+	var failed []CheckResult
+	for _, c := range r.Checks {
+		if c.Status == StatusFailed {
+			failed = append(failed, c)
+		}
+	}
+	return failed
+}
+
+// Check returns the result of check, or nil when it was not recorded.
+func (r *VerificationResult) Check(check VerificationCheck) *CheckResult {
+	for i := range r.Checks {
+		if r.Checks[i].Check == check {
+			return &r.Checks[i]
+		}
+	}
+	return nil
+}
+
+// Err joins the errors of the failed checks, or returns nil when the file
+// verified.
+func (r *VerificationResult) Err() error {
+	var errs []error
+	for _, c := range r.Failed() {
+		errs = append(errs, fmt.Errorf("%s: %w", c.Check, c.Err))
+	}
+	return errors.Join(errs...)
+}
+
+// MarshalJSON adds the valid field to the encoded result.
+func (r VerificationResult) MarshalJSON() ([]byte, error) {
+	type result VerificationResult
+	return json.Marshal(struct {
+		result
+		Valid bool `json:"valid"`
+	}{result(r), r.Valid()})
+}
+
+// VerifyDetailed verifies the Authenticode signature of a PE file like
+// Verify, but runs every check instead of stopping at the first failure and
+// reports the status of each one.
+//
+// A check is skipped when opts does not request it or when a check it
+// depends on failed: nothing runs after a CheckStructure failure, and
+// CheckRevocation and the chain part of CheckDenylist and CheckWeakCrypto
+// need a validated chain. Failed checks carry a ReasonCode and the error
+// Verify would have returned for them.
+//
+// Other file types, such as Windows Installer packages, cabinets and
+// Debian packages, are verified as Verify verifies them. Their checks do
+// not run separately: a failure is reported against the check it belongs
+// to, with the other checks skipped, and on success every check the
+// options request passes.
+//
+// Parameters:
+//   - filePath: The path to the file to verify
+//   - opts: Verification options, or nil for the defaults
+//
+// Returns:
+//   - *VerificationResult: The outcome of every check; Valid reports the
+//     verdict
+//
+// Example usage:
+//
+//	result := sigtool.VerifyDetailed("signed.exe", &sigtool.VerifyOptions{UseSystemRoots: true})
+//	for _, c := range result.Failed() {
+//	    fmt.Printf("%s: %s (%s)\n", c.Check, c.Reason, c.Message)
+//	}
+func VerifyDetailed(filePath string, opts *VerifyOptions) *VerificationResult {
+	if opts == nil {
+		opts = &VerifyOptions{}
+	}
+	v := &detailedVerification{result: &VerificationResult{Path: filePath}, opts: *opts}
+	v.run(filePath)
+	return v.result
+}
+
+// detailedVerification accumulates the checks of VerifyDetailed
+type detailedVerification struct {
+	result *VerificationResult
+	opts   VerifyOptions
+}
+
+func (v *detailedVerification) pass(check VerificationCheck) {
+	v.result.Checks = append(v.result.Checks, CheckResult{Check: check, Status: StatusPassed})
+}
+
+func (v *detailedVerification) skip(check VerificationCheck, reason string) {
+	v.result.Checks = append(v.result.Checks, CheckResult{Check: check, Status: StatusSkipped, Message: reason})
+}
+
+func (v *detailedVerification) fail(check VerificationCheck, err error, fallback ReasonCode) {
+	v.result.Checks = append(v.result.Checks, CheckResult{
+		Check:   check,
+		Status:  StatusFailed,
+		Reason:  reasonFor(err, fallback),
+		Message: err.Error(),
+		Err:     err,
+	})
+}
+
+// record passes check when err is nil and fails it otherwise
+func (v *detailedVerification) record(check VerificationCheck, err error, fallback ReasonCode) bool {
+	if err != nil {
+		v.fail(check, err, fallback)
+		return false
+	}
+	v.pass(check)
+	return true
+}
+
+func (v *detailedVerification) run(filePath string) {
+	v.runSignature(v.checkFile(filePath))
+}
+
+// runSignature records the checks of the signature p7 returned by
+// checkFile or checkReader, unless ok is false
+func (v *detailedVerification) runSignature(p7 *pkcs7.PKCS7, ok bool) {
+	opts := v.opts
+	if !ok {
+		return
+	}
+
+	v.record(CheckSignature, verifySignerSignature(p7), ReasonInvalidSignature)
+
+	var denyErr error
+	if opts.Denylist != nil {
+		denyErr = opts.Denylist.check(p7.Certificates)
+	}
+
+	signer := p7.GetOnlySigner()
+	errNoSigner := errors.New("signature must have exactly one signer with an embedded certificate")
+	if len(opts.RequiredThumbprints) > 0 || len(opts.RequiredSubjects) > 0 {
+		if signer == nil {
+			v.fail(CheckSignerPin, errNoSigner, ReasonSignerNotPinned)
+		} else {
+			v.record(CheckSignerPin, checkSignerPins(signer, opts), ReasonSignerNotPinned)
+		}
+	} else {
+		v.skip(CheckSignerPin, "no signer pins configured")
+	}
+
+	if opts.RequireCodeSigning {
+		v.record(CheckCodeSigning, checkCodeSigningEKU(p7), ReasonNotCodeSigning)
+	} else {
+		v.skip(CheckCodeSigning, "code signing usage not required")
+	}
+
+	trust, trustErr := resolveTrust(opts)
+	if trustErr != nil {
+		// The timestamp is still checked without chain validation
+		trust = &trustConfig{}
+	}
+	ts, err := verifyTimestamp(p7, trust)
+	switch {
+	case err != nil:
+		v.fail(CheckTimestamp, fmt.Errorf("timestamp verification failed: %w", err), ReasonInvalidTimestamp)
+	case ts == nil:
+		v.skip(CheckTimestamp, "signature is not timestamped")
+	default:
+		v.pass(CheckTimestamp)
+	}
+
+	var chains [][]*x509.Certificate
+	verificationTime := opts.VerificationTime
+	if verificationTime.IsZero() && ts != nil {
+		verificationTime = ts.Time
+	}
+	switch {
+	case trustErr != nil:
+		v.skip(CheckTrustedPublisher, "no trust store available")
+		v.fail(CheckChain, trustErr, ReasonTrustUnavailable)
+	case opts.FormatOnly:
+		v.skip(CheckTrustedPublisher, "format-only verification")
+		v.skip(CheckChain, "format-only verification")
+	case trust.roots == nil:
+		v.skip(CheckTrustedPublisher, "trusted publishers not required")
+		v.skip(CheckChain, "no roots configured")
+	case signer == nil:
+		v.skip(CheckTrustedPublisher, "no signer certificate")
+		v.fail(CheckChain, errNoSigner, ReasonInvalidChain)
+	default:
+		if trust.publishers != nil {
+			v.record(CheckTrustedPublisher, checkTrustedPublisher(signer, trust.publishers), ReasonUntrustedPublisher)
+		} else {
+			v.skip(CheckTrustedPublisher, "trusted publishers not required")
+		}
+		chains, err = verifySignerChain(p7.Certificates, signer, opts, trust, verificationTime)
+		v.record(CheckChain, err, ReasonInvalidChain)
+	}
+
+	if opts.Denylist != nil {
+		for _, chain := range chains {
+			if denyErr != nil {
+				break
+			}
+			denyErr = opts.Denylist.check(chain)
+		}
+		v.record(CheckDenylist, denyErr, ReasonDeniedCertificate)
+	} else {
+		v.skip(CheckDenylist, "no denylist configured")
+	}
+
+	if opts.RejectWeakCrypto {
+		v.record(CheckWeakCrypto, checkWeakCrypto(p7, chains), ReasonWeakCrypto)
+	} else {
+		v.skip(CheckWeakCrypto, "weak cryptography not rejected")
+	}
+
+	switch {
+	case trust.ocsp == nil && trust.crl == nil:
+		v.skip(CheckRevocation, "no revocation checker configured")
+	case chains == nil:
+		v.skip(CheckRevocation, "no validated chain")
+	default:
+		v.record(CheckRevocation, trust.checkRevocation(chains, verificationTime), ReasonRevocationUnknown)
+	}
+}
+
+// checkFile opens the file and records its checks like checkReader
+func (v *detailedVerification) checkFile(filePath string) (*pkcs7.PKCS7, bool) {
+	if strings.TrimSpace(filePath) == "" {
+		return v.structure(errors.New("file path cannot be empty"))
+	}
+	// #nosec G304 - This tool is designed to read user-specified PE files
+	f, err := os.Open(filePath)
+	if err != nil {
+		return v.structure(fmt.Errorf("failed to open file %q: %w", filePath, err))
+	}
+	defer f.Close()
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return v.structure(fmt.Errorf("failed to get file info: %w", err))
+	}
+	return v.checkReader(f, fileInfo.Size())
+}
+
+// structure records a failed structure check
+func (v *detailedVerification) structure(err error) (*pkcs7.PKCS7, bool) {
+	v.fail(CheckStructure, err, ReasonMalformedSignature)
+	return nil, false
+}
+
+// checkReader records the structure, certificate slack and digest checks
+// of the file r and returns its signature when the structure is sound
+func (v *detailedVerification) checkReader(f io.ReaderAt, size int64) (*pkcs7.PKCS7, bool) {
+	structure := v.structure
+	if fileType, _ := detectFileType(f, size); fileType != FileTypePE && fileType != FileTypeUnknown {
+		v.runWhole(fileType, f, size)
+		return nil, false
+	}
+
+	log := v.opts.logger()
+	layout, err := readPELayout(f, size, v.opts.StrictPEParsing)
+	if err != nil {
+		return structure(fmt.Errorf("failed to extract signature: %w", err))
+	}
+	log.Debug("read certificate table", "fileSize", size, "offset", layout.certTableOffset, "size", layout.certTableSize)
+	signature, err := readSignature(f, layout)
+	if err != nil {
+		return structure(fmt.Errorf("failed to extract signature: %w", err))
+	}
+	p7, err := parsePKCS7(signature)
+	if err != nil {
+		return structure(fmt.Errorf("failed to parse PKCS#7 signature: %w", err))
+	}
+	v.pass(CheckStructure)
+
+	if v.opts.RejectCertificateSlack {
+		slack, err := certificateSlack(f, layout)
+		if err == nil && len(slack) > 0 {
+			err = fmt.Errorf("%w: %d bytes at offset %d", ErrCertificateSlack, slack[0].Size, slack[0].Offset)
+		}
+		v.record(CheckCertificateSlack, err, ReasonCertificateSlack)
+	} else {
+		v.skip(CheckCertificateSlack, "certificate slack not rejected")
+	}
+
+	if v.opts.SkipContentDigest {
+		v.skip(CheckDigest, "content digest disabled")
+		return p7, true
+	}
+	algorithm, stored, err := storedDigest(p7)
+	var computed []byte
+	if err == nil {
+		computed, err = authentihash(f, layout, algorithm)
+	}
+	if err == nil {
+		log.Debug("computed file digest", "algorithm", algorithm.String(), "signed", hex.EncodeToString(stored), "computed", hex.EncodeToString(computed))
+	}
+	if err == nil && subtle.ConstantTimeCompare(stored, computed) != 1 {
+		err = &DigestMismatchError{Algorithm: algorithm, Signed: stored, Computed: computed}
+	}
+	v.record(CheckDigest, err, ReasonDigestMismatch)
+	return p7, true
+}
+
+// detailedChecks lists the checks of VerifyDetailed in the order they run
+var detailedChecks = []VerificationCheck{
+	CheckStructure, CheckCertificateSlack, CheckDigest, CheckSignature, CheckSignerPin, CheckCodeSigning,
+	CheckTimestamp, CheckTrustedPublisher, CheckChain, CheckDenylist, CheckWeakCrypto, CheckRevocation,
+}
+
+// runWhole verifies r, a file of a type other than PE, as Verify does.
+// Verification of these types stops at the first failure, so a failure is
+// reported against the check its reason belongs to and the other checks are
+// skipped; on success every check the options request passes.
+func (v *detailedVerification) runWhole(fileType FileType, r io.ReaderAt, size int64) {
+	opts := v.opts
+	notSeparate := fmt.Sprintf("not checked separately for %s files", fileType)
+	if err := verifyAuthenticode(r, size, opts); err != nil {
+		reason := reasonFor(err, "")
+		failed := checkForReason(reason)
+		for _, check := range detailedChecks {
+			if check == failed {
+				v.fail(check, err, reason)
+			} else {
+				v.skip(check, notSeparate)
+			}
+		}
+		return
+	}
+
+	chained := !opts.FormatOnly && (opts.Roots != nil || opts.UseSystemRoots || opts.UseMicrosoftRoots || opts.UseWindowsStores)
+	for _, check := range detailedChecks {
+		switch {
+		case check == CheckStructure, check == CheckSignature:
+			v.pass(check)
+		case check == CheckDigest && opts.SkipContentDigest:
+			v.skip(check, "content digest disabled")
+		case check == CheckDigest:
+			v.pass(check)
+		case check == CheckSignerPin && (len(opts.RequiredThumbprints) > 0 || len(opts.RequiredSubjects) > 0),
+			check == CheckCodeSigning && opts.RequireCodeSigning,
+			check == CheckChain && chained,
+			check == CheckDenylist && opts.Denylist != nil,
+			check == CheckWeakCrypto && opts.RejectWeakCrypto,
+			check == CheckRevocation && chained && (opts.OCSP != nil || opts.CRL != nil):
+			v.pass(check)
+		case check == CheckCertificateSlack, check == CheckTimestamp, check == CheckTrustedPublisher:
+			v.skip(check, notSeparate)
+		default:
+			v.skip(check, "not requested by the options")
+		}
+	}
+}
+
+// checkForReason returns the check a failure with reason belongs to, for
+// file types whose checks do not run separately
+func checkForReason(reason ReasonCode) VerificationCheck {
+	switch reason {
+	case ReasonDigestMismatch:
+		return CheckDigest
+	case ReasonMessageDigestMismatch, ReasonInvalidSignature:
+		return CheckSignature
+	case ReasonSignerNotPinned:
+		return CheckSignerPin
+	case ReasonNotCodeSigning:
+		return CheckCodeSigning
+	case ReasonUntrustedPublisher:
+		return CheckTrustedPublisher
+	case ReasonTrustUnavailable, ReasonUnknownAuthority, ReasonCertificateExpired, ReasonInvalidChain:
+		return CheckChain
+	case ReasonDeniedCertificate:
+		return CheckDenylist
+	case ReasonWeakCrypto:
+		return CheckWeakCrypto
+	case ReasonCertificateRevoked, ReasonRevocationUnknown:
+		return CheckRevocation
+	}
+	return CheckStructure
+}
+
+// reasonFor classifies err, returning fallback when no specific reason
+// applies
+func reasonFor(err error, fallback ReasonCode) ReasonCode {
+	var invalid x509.CertificateInvalidError
+	var unknown x509.UnknownAuthorityError
+	var panicked *PanicError
+	switch {
+	case errors.Is(err, ErrNotSigned):
+		return ReasonNotSigned
+	case errors.Is(err, ErrNotPE):
+		return ReasonNotPE
+	case errors.Is(err, ErrSignatureTruncated), errors.Is(err, ErrSignatureTooLarge), errors.Is(err, ErrUnsupportedCertificateType), errors.As(err, &panicked):
+		return ReasonMalformedSignature
+	case errors.Is(err, ErrCertificateSlack):
+		return ReasonCertificateSlack
+	case errors.Is(err, ErrDigestMismatch):
+		return ReasonDigestMismatch
+	case errors.Is(err, ErrMessageDigestMismatch):
+		return ReasonMessageDigestMismatch
+	case errors.Is(err, ErrInvalidSignature):
+		return ReasonInvalidSignature
+	case errors.Is(err, ErrDeniedCertificate):
+		return ReasonDeniedCertificate
+	case errors.Is(err, ErrSignerNotPinned):
+		return ReasonSignerNotPinned
+	case errors.Is(err, ErrNotCodeSigning):
+		return ReasonNotCodeSigning
+	case errors.Is(err, ErrUntrustedPublisher):
+		return ReasonUntrustedPublisher
+	case errors.Is(err, ErrCertificateRevoked):
+		return ReasonCertificateRevoked
+	case errors.Is(err, ErrRevocationUnknown):
+		return ReasonRevocationUnknown
+	case errors.Is(err, ErrWeakCrypto):
+		return ReasonWeakCrypto
+	case errors.Is(err, ErrMicrosoftRootsUnavailable), errors.Is(err, ErrWindowsStoresUnavailable):
+		return ReasonTrustUnavailable
+	case errors.As(err, &invalid) && invalid.Reason == x509.Expired:
+		return ReasonCertificateExpired
+	case errors.As(err, &unknown):
+		return ReasonUnknownAuthority
+	case errors.Is(err, ErrChainVerification):
+		return ReasonInvalidChain
+	}
+	if fallback == "" {
+		return ReasonError
+	}
+	return fallback
+}
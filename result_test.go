@@ -0,0 +1,143 @@
+package sigtool
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyDetailed_Valid(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+
+	result := VerifyDetailed(filePath, &VerifyOptions{Roots: testRoots(t)})
+	if !result.Valid() {
+		t.Fatalf("Expected a valid result, got failures: %+v", result.Failed())
+	}
+	if err := result.Err(); err != nil {
+		t.Errorf("Expected nil Err, got: %v", err)
+	}
+	for check, status := range map[VerificationCheck]CheckStatus{
+		CheckStructure:  StatusPassed,
+		CheckDigest:     StatusPassed,
+		CheckSignature:  StatusPassed,
+		CheckChain:      StatusPassed,
+		CheckSignerPin:  StatusSkipped,
+		CheckRevocation: StatusSkipped,
+	} {
+		c := result.Check(check)
+		if c == nil {
+			t.Errorf("Check %q not recorded", check)
+			continue
+		}
+		if c.Status != status {
+			t.Errorf("Check %q status = %q, want %q", check, c.Status, status)
+		}
+	}
+}
+
+func TestVerifyDetailed_ReportsEveryFailure(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	content[mockHeaderSize] ^= 0xff
+	if err := os.WriteFile(filePath, content, 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	result := VerifyDetailed(filePath, &VerifyOptions{
+		Roots:               x509.NewCertPool(),
+		RequiredThumbprints: []string{strings.Repeat("00", 32)},
+	})
+	if result.Valid() {
+		t.Fatal("Expected verification to fail")
+	}
+	want := map[VerificationCheck]ReasonCode{
+		CheckDigest:    ReasonDigestMismatch,
+		CheckSignerPin: ReasonSignerNotPinned,
+		CheckChain:     ReasonUnknownAuthority,
+	}
+	failed := result.Failed()
+	if len(failed) != len(want) {
+		t.Errorf("Expected %d failures, got: %+v", len(want), failed)
+	}
+	for _, c := range failed {
+		if want[c.Check] != c.Reason {
+			t.Errorf("Check %q reason = %q, want %q", c.Check, c.Reason, want[c.Check])
+		}
+	}
+	if c := result.Check(CheckSignature); c == nil || c.Status != StatusPassed {
+		t.Errorf("Expected the signer signature to pass, got: %+v", c)
+	}
+
+	err = result.Err()
+	for _, sentinel := range []error{ErrDigestMismatch, ErrSignerNotPinned, ErrChainVerification} {
+		if !errors.Is(err, sentinel) {
+			t.Errorf("Expected Err to match %v, got: %v", sentinel, err)
+		}
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("Failed to encode result: %v", err)
+	}
+	if !strings.Contains(string(data), `"valid":false`) || !strings.Contains(string(data), `"reason":"digest-mismatch"`) {
+		t.Errorf("Unexpected JSON: %s", data)
+	}
+}
+
+func TestVerifyDetailed_Structure(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "unsigned.exe")
+	if err := os.WriteFile(filePath, mockPEImage([]byte("payload")), 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	result := VerifyDetailed(filePath, nil)
+	if len(result.Checks) != 1 {
+		t.Fatalf("Expected only the structure check, got: %+v", result.Checks)
+	}
+	if c := result.Checks[0]; c.Check != CheckStructure || c.Reason != ReasonNotSigned || !errors.Is(c.Err, ErrNotSigned) {
+		t.Errorf("Unexpected structure result: %+v", c)
+	}
+}
+
+func TestVerifyDetailed_OtherFileTypes(t *testing.T) {
+	result := VerifyDetailed(writeSignedMSIForTest(t, false), nil)
+	if !result.Valid() || len(result.Checks) != len(detailedChecks) {
+		t.Fatalf("Expected a valid MSI result with every check, got %+v", result.Checks)
+	}
+	for check, status := range map[VerificationCheck]CheckStatus{
+		CheckStructure: StatusPassed,
+		CheckDigest:    StatusPassed,
+		CheckSignature: StatusPassed,
+		CheckSignerPin: StatusSkipped,
+		CheckChain:     StatusSkipped,
+	} {
+		if c := result.Check(check); c == nil || c.Status != status {
+			t.Errorf("Check %q = %+v, want %q", check, c, status)
+		}
+	}
+
+	pinned := VerifyDetailed(writeSignedMSIForTest(t, false), &VerifyOptions{RequiredThumbprints: []string{"00"}})
+	if c := pinned.Check(CheckSignerPin); c == nil || c.Status != StatusFailed || c.Reason != ReasonSignerNotPinned {
+		t.Errorf("Expected the signer pin to fail, got %+v", c)
+	}
+	if c := pinned.Check(CheckDigest); c == nil || c.Status != StatusSkipped {
+		t.Errorf("Expected the other checks to be skipped, got %+v", c)
+	}
+
+	key := kernelKeyForTest(t, "Build time autogenerated kernel key", 9101)
+	module := append([]byte("\x7fELF\x02\x01\x01"), make([]byte, 4096)...)
+	tampered := kernelModuleForTest(t, key, module, crypto.SHA256, true)
+	tampered[100] ^= 0xff
+	detailed := VerifyDetailed(writeScriptForTest(t, "module.ko", tampered), nil)
+	if c := detailed.Check(CheckSignature); c == nil || c.Status != StatusFailed || !errors.Is(detailed.Err(), ErrInvalidSignature) {
+		t.Errorf("Expected the signature check to fail for a modified module, got %+v", detailed.Checks)
+	}
+}
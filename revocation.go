@@ -0,0 +1,57 @@
+package sigtool
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// revocationClockSkew is the tolerance applied to the validity window of
+// OCSP responses and CRLs
+const revocationClockSkew = 5 * time.Minute
+
+// certificateStatus is the revocation status of a certificate reported by a
+// revocation source
+type certificateStatus struct {
+	revoked   bool
+	revokedAt time.Time
+	reason    int
+}
+
+// revocationSource reports the revocation status of a certificate, with ctx
+// bounding any request it makes. It returns an error when the status cannot
+// be determined.
+type revocationSource interface {
+	revocationStatus(ctx context.Context, cert, issuer *x509.Certificate) (*certificateStatus, error)
+}
+
+// checkChainRevocation checks every certificate of chain except the trust
+// anchor. The sources are consulted in order until one determines the
+// status; when none does, the certificate is accepted unless hardFail is set.
+func checkChainRevocation(ctx context.Context, chain []*x509.Certificate, at time.Time, hardFail bool, sources ...revocationSource) error {
+	for i := 0; i+1 < len(chain); i++ {
+		cert, issuer := chain[i], chain[i+1]
+		var status *certificateStatus
+		var errs []error
+		for _, source := range sources {
+			s, err := source.revocationStatus(ctx, cert, issuer)
+			if err == nil {
+				status = s
+				break
+			}
+			errs = append(errs, err)
+		}
+
+		switch {
+		case status == nil:
+			if hardFail {
+				return fmt.Errorf("%w: %s: %w", ErrRevocationUnknown, cert.Subject, errors.Join(errs...))
+			}
+		case status.revoked && !status.revokedAt.After(at):
+			return &RevocationError{Certificate: cert, RevokedAt: status.revokedAt, Reason: status.reason}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,388 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// RPM packages start with a lead, followed by the signature header, padded
+// to 8 bytes, the main header and the compressed payload
+const (
+	rpmLeadMagic = "\xed\xab\xee\xdb"
+	rpmLeadSize  = 96
+	// rpmHeaderMagic starts each header, followed by four reserved bytes,
+	// the index entry count and the data store size
+	rpmHeaderMagic        = "\x8e\xad\xe8\x01"
+	rpmHeaderPreambleSize = 16
+	rpmIndexEntrySize     = 16
+	// rpmMaxIndexEntries and rpmMaxDataSize are the header limits rpm
+	// itself enforces
+	rpmMaxIndexEntries = 0xffff
+	rpmMaxDataSize     = 0x0fffffff
+)
+
+// Tags of the signature header and, from 5092, the main header
+const (
+	rpmSigTagDSA            = 267
+	rpmSigTagRSA            = 268
+	rpmSigTagSHA1           = 269
+	rpmSigTagSHA256         = 273
+	rpmSigTagPGP            = 1002
+	rpmSigTagMD5            = 1004
+	rpmSigTagGPG            = 1005
+	rpmTagPayloadDigest     = 5092
+	rpmTagPayloadDigestAlgo = 5093
+)
+
+// Types of header index entries
+const (
+	rpmTypeInt32       = 4
+	rpmTypeString      = 6
+	rpmTypeBin         = 7
+	rpmTypeStringArray = 8
+)
+
+// rpmSignatureTags are the OpenPGP signatures of the signature header, by
+// their rpm query names, and whether they cover the payload besides the
+// main header
+var rpmSignatureTags = []struct {
+	tag     uint32
+	kind    string
+	payload bool
+}{
+	{rpmSigTagRSA, "RSAHEADER", false},
+	{rpmSigTagDSA, "DSAHEADER", false},
+	{rpmSigTagPGP, "SIGPGP", true},
+	{rpmSigTagGPG, "SIGGPG", true},
+}
+
+// pgpHashAlgorithms maps the OpenPGP hash algorithm IDs rpm records digest
+// algorithms with
+var pgpHashAlgorithms = map[uint32]crypto.Hash{
+	1:  crypto.MD5,
+	2:  crypto.SHA1,
+	8:  crypto.SHA256,
+	9:  crypto.SHA384,
+	10: crypto.SHA512,
+	11: crypto.SHA224,
+}
+
+// rpmHeader is a header structure of an RPM package
+type rpmHeader struct {
+	// offset and size locate the header, from its magic to the end of its
+	// data store
+	offset, size int64
+	// data is the whole header
+	data    []byte
+	entries map[uint32]rpmIndexEntry
+}
+
+// rpmIndexEntry is a tag of a header
+type rpmIndexEntry struct {
+	typ    uint32
+	offset uint32
+	count  uint32
+}
+
+// rpmPackage locates the headers and payload of an RPM package
+type rpmPackage struct {
+	signature *rpmHeader
+	header    *rpmHeader
+	// payloadOffset is the offset of the payload, which runs to the end of
+	// the file
+	payloadOffset int64
+	size          int64
+}
+
+// isRPMPackage reports whether r starts with the RPM lead magic
+func isRPMPackage(r io.ReaderAt, size int64) bool {
+	if size < rpmLeadSize {
+		return false
+	}
+	magic := make([]byte, len(rpmLeadMagic))
+	if _, err := r.ReadAt(magic, 0); err != nil {
+		return false
+	}
+	return string(magic) == rpmLeadMagic
+}
+
+// openRPMPackage parses the lead and headers of the RPM package r
+func openRPMPackage(r io.ReaderAt, size int64) (*rpmPackage, error) {
+	if !isRPMPackage(r, size) {
+		return nil, errors.New("not an RPM package")
+	}
+	signature, err := readRPMHeader(r, rpmLeadSize, size)
+	if err != nil {
+		return nil, fmt.Errorf("signature header: %w", err)
+	}
+	// The signature header is padded to a multiple of 8 bytes
+	offset := signature.offset + signature.size
+	offset += (8 - offset%8) % 8
+	header, err := readRPMHeader(r, offset, size)
+	if err != nil {
+		return nil, fmt.Errorf("main header: %w", err)
+	}
+	return &rpmPackage{
+		signature:     signature,
+		header:        header,
+		payloadOffset: header.offset + header.size,
+		size:          size,
+	}, nil
+}
+
+// readRPMHeader reads the header at offset of r
+func readRPMHeader(r io.ReaderAt, offset, size int64) (*rpmHeader, error) {
+	if size-offset < rpmHeaderPreambleSize {
+		return nil, fmt.Errorf("%w: header at offset %d is truncated", ErrSignatureTruncated, offset)
+	}
+	preamble := make([]byte, rpmHeaderPreambleSize)
+	if _, err := r.ReadAt(preamble, offset); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if string(preamble[:4]) != rpmHeaderMagic {
+		return nil, fmt.Errorf("bad header magic at offset %d", offset)
+	}
+	count := binary.BigEndian.Uint32(preamble[8:])
+	dataSize := binary.BigEndian.Uint32(preamble[12:])
+	if count == 0 || count > rpmMaxIndexEntries || dataSize > rpmMaxDataSize {
+		return nil, fmt.Errorf("header at offset %d has invalid size: %d entries, %d bytes", offset, count, dataSize)
+	}
+	length := int64(rpmHeaderPreambleSize) + int64(count)*rpmIndexEntrySize + int64(dataSize)
+	if length > size-offset {
+		return nil, &SignatureBoundsError{Offset: offset, Length: length, FileSize: size, Reason: "RPM header exceeds the file"}
+	}
+	h := &rpmHeader{offset: offset, size: length, data: make([]byte, length), entries: make(map[uint32]rpmIndexEntry, count)}
+	if _, err := r.ReadAt(h.data, offset); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	for i := uint32(0); i < count; i++ {
+		entry := h.data[rpmHeaderPreambleSize+i*rpmIndexEntrySize:]
+		tag := binary.BigEndian.Uint32(entry)
+		e := rpmIndexEntry{typ: binary.BigEndian.Uint32(entry[4:]), offset: binary.BigEndian.Uint32(entry[8:]), count: binary.BigEndian.Uint32(entry[12:])}
+		if e.offset > dataSize {
+			return nil, fmt.Errorf("tag %d of header at offset %d points outside its data", tag, offset)
+		}
+		h.entries[tag] = e
+	}
+	return h, nil
+}
+
+// store returns the data store of h from the value of e
+func (h *rpmHeader) store(e rpmIndexEntry) []byte {
+	count := binary.BigEndian.Uint32(h.data[8:])
+	return h.data[rpmHeaderPreambleSize+int64(count)*rpmIndexEntrySize+int64(e.offset):]
+}
+
+// binaryValue returns the BIN value of tag, or nil when h has no such tag
+func (h *rpmHeader) binaryValue(tag uint32) ([]byte, error) {
+	e, ok := h.entries[tag]
+	if !ok {
+		return nil, nil
+	}
+	value := h.store(e)
+	if e.typ != rpmTypeBin || int64(e.count) > int64(len(value)) {
+		return nil, fmt.Errorf("malformed binary tag %d", tag)
+	}
+	return value[:e.count], nil
+}
+
+// stringValues returns the STRING or STRING_ARRAY value of tag, or nil when h
+// has no such tag
+func (h *rpmHeader) stringValues(tag uint32) ([]string, error) {
+	e, ok := h.entries[tag]
+	if !ok {
+		return nil, nil
+	}
+	if e.typ != rpmTypeString && e.typ != rpmTypeStringArray || e.typ == rpmTypeString && e.count != 1 {
+		return nil, fmt.Errorf("malformed string tag %d", tag)
+	}
+	value := h.store(e)
+	var values []string
+	for i := uint32(0); i < e.count; i++ {
+		end := bytes.IndexByte(value, 0)
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated string in tag %d", tag)
+		}
+		values = append(values, string(value[:end]))
+		value = value[end+1:]
+	}
+	return values, nil
+}
+
+// int32Value returns the first INT32 value of tag and whether h has it
+func (h *rpmHeader) int32Value(tag uint32) (uint32, bool, error) {
+	e, ok := h.entries[tag]
+	if !ok {
+		return 0, false, nil
+	}
+	value := h.store(e)
+	if e.typ != rpmTypeInt32 || e.count == 0 || len(value) < 4 {
+		return 0, false, fmt.Errorf("malformed integer tag %d", tag)
+	}
+	return binary.BigEndian.Uint32(value), true, nil
+}
+
+// pgpSignatures returns the OpenPGP signatures of the signature header
+func (p *rpmPackage) pgpSignatures() ([]*pgpSignature, error) {
+	var signatures []*pgpSignature
+	for _, t := range rpmSignatureTags {
+		data, err := p.signature.binaryValue(t.tag)
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			continue
+		}
+		s, err := parsePGPSignature(t.kind, data)
+		if err != nil {
+			return nil, err
+		}
+		signatures = append(signatures, s)
+	}
+	if len(signatures) == 0 {
+		return nil, fmt.Errorf("%w (package has no OpenPGP signature)", ErrNotSigned)
+	}
+	return signatures, nil
+}
+
+// signed returns the content a signature covers: the main header and,
+// for header and payload signatures, the payload
+func (p *rpmPackage) signed(r io.ReaderAt, kind string) func() io.Reader {
+	length := p.header.size
+	for _, t := range rpmSignatureTags {
+		if t.kind == kind && t.payload {
+			length = p.size - p.header.offset
+		}
+	}
+	return func() io.Reader { return io.NewSectionReader(r, p.header.offset, length) }
+}
+
+// verifyDigests recomputes the header digests of the signature header and
+// the payload digest of the main header and compares them
+func (p *rpmPackage) verifyDigests(r io.ReaderAt, opts VerifyOptions) error {
+	type digest struct {
+		name      string
+		algorithm crypto.Hash
+		signed    []byte
+		content   *io.SectionReader
+	}
+	var digests []digest
+	header := io.NewSectionReader(r, p.header.offset, p.header.size)
+	for _, d := range []struct {
+		tag       uint32
+		algorithm crypto.Hash
+	}{{rpmSigTagSHA256, crypto.SHA256}, {rpmSigTagSHA1, crypto.SHA1}} {
+		values, err := p.signature.stringValues(d.tag)
+		if err != nil {
+			return err
+		}
+		if len(values) == 0 {
+			continue
+		}
+		signed, err := hex.DecodeString(values[0])
+		if err != nil {
+			return fmt.Errorf("malformed %v header digest: %w", d.algorithm, err)
+		}
+		digests = append(digests, digest{"header", d.algorithm, signed, header})
+	}
+	md5, err := p.signature.binaryValue(rpmSigTagMD5)
+	if err != nil {
+		return err
+	}
+	if md5 != nil {
+		digests = append(digests, digest{"header and payload", crypto.MD5, md5, io.NewSectionReader(r, p.header.offset, p.size-p.header.offset)})
+	}
+	payloadDigests, err := p.header.stringValues(rpmTagPayloadDigest)
+	if err != nil {
+		return err
+	}
+	if len(payloadDigests) > 0 {
+		id, ok, err := p.header.int32Value(rpmTagPayloadDigestAlgo)
+		if err != nil {
+			return err
+		}
+		algorithm, known := pgpHashAlgorithms[id]
+		if !ok || !known {
+			return fmt.Errorf("unsupported payload digest algorithm %d", id)
+		}
+		signed, err := hex.DecodeString(payloadDigests[0])
+		if err != nil {
+			return fmt.Errorf("malformed payload digest: %w", err)
+		}
+		digests = append(digests, digest{"payload", algorithm, signed, io.NewSectionReader(r, p.payloadOffset, p.size-p.payloadOffset)})
+	}
+
+	for _, d := range digests {
+		h := d.algorithm.New()
+		if _, err := io.Copy(h, d.content); err != nil {
+			return fmt.Errorf("failed to hash %s: %w", d.name, err)
+		}
+		computed := h.Sum(nil)
+		opts.logger().Debug("computed package digest", "content", d.name, "algorithm", d.algorithm.String(), "signed", hex.EncodeToString(d.signed), "computed", hex.EncodeToString(computed))
+		if subtle.ConstantTimeCompare(d.signed, computed) != 1 {
+			return fmt.Errorf("%s digest: %w", d.name, &DigestMismatchError{Algorithm: d.algorithm, Signed: d.signed, Computed: computed})
+		}
+	}
+	return nil
+}
+
+// readRPMSignature returns the first OpenPGP signature packet of the RPM
+// package r, preferring the header signatures current rpm versions check
+func readRPMSignature(r io.ReaderAt, size int64) ([]byte, error) {
+	pkg, err := openRPMPackage(r, size)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range rpmSignatureTags {
+		data, err := pkg.signature.binaryValue(t.tag)
+		if err != nil {
+			return nil, err
+		}
+		if data != nil {
+			return data, nil
+		}
+	}
+	return nil, fmt.Errorf("%w (package has no OpenPGP signature)", ErrNotSigned)
+}
+
+// verifyRPM verifies the RPM package r as rpm -K does: unless disabled,
+// the header digests of the signature header and the payload digest must
+// match, and every OpenPGP signature must be by a key of opts.PGPKeyring.
+// The X.509 trust, pinning and revocation options do not apply.
+func verifyRPM(r io.ReaderAt, size int64, opts VerifyOptions) error {
+	pkg, err := openRPMPackage(r, size)
+	if err != nil {
+		return fmt.Errorf("failed to extract signature: %w", err)
+	}
+	log := opts.logger()
+	log.Debug("read RPM headers", "signatureHeader", pkg.signature.size, "header", pkg.header.size, "payloadOffset", pkg.payloadOffset)
+	if !opts.SkipContentDigest {
+		if err := pkg.verifyDigests(r, opts); err != nil {
+			return err
+		}
+	}
+	signatures, err := pkg.pgpSignatures()
+	if err != nil {
+		return err
+	}
+	var weak []WeakCryptoFinding
+	for _, s := range signatures {
+		key, findings, err := s.verify(opts.PGPKeyring, pkg.signed(r, s.kind))
+		if err != nil {
+			return fmt.Errorf("%s signature: %w", strings.ToLower(s.kind), err)
+		}
+		log.Debug("verified OpenPGP signature", "kind", s.kind, "key", key.PublicKey.KeyIdString(), "userID", pgpUserID(key.Entity))
+		weak = append(weak, findings...)
+	}
+	if opts.RejectWeakCrypto && len(weak) > 0 {
+		return &WeakCryptoError{Findings: weak}
+	}
+	return nil
+}
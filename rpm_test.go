@@ -0,0 +1,202 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// rpmTagForTest is an index entry of a header built by rpmHeaderForTest
+type rpmTagForTest struct {
+	tag, typ uint32
+	count    uint32
+	value    []byte
+}
+
+// rpmHeaderForTest returns a header structure holding tags
+func rpmHeaderForTest(tags ...rpmTagForTest) []byte {
+	sort.Slice(tags, func(i, j int) bool { return tags[i].tag < tags[j].tag })
+	var index, store []byte
+	for _, t := range tags {
+		index = binary.BigEndian.AppendUint32(index, t.tag)
+		index = binary.BigEndian.AppendUint32(index, t.typ)
+		index = binary.BigEndian.AppendUint32(index, uint32(len(store)))
+		index = binary.BigEndian.AppendUint32(index, t.count)
+		store = append(store, t.value...)
+	}
+	header := append([]byte(rpmHeaderMagic), 0, 0, 0, 0)
+	header = binary.BigEndian.AppendUint32(header, uint32(len(tags)))
+	header = binary.BigEndian.AppendUint32(header, uint32(len(store)))
+	return append(append(header, index...), store...)
+}
+
+// rpmStringForTest returns a STRING tag
+func rpmStringForTest(tag uint32, s string) rpmTagForTest {
+	return rpmTagForTest{tag: tag, typ: rpmTypeString, count: 1, value: append([]byte(s), 0)}
+}
+
+// pgpEntityForTest returns a new OpenPGP key with an RSA key of bits
+func pgpEntityForTest(t testing.TB, name string, bits int) *openpgp.Entity {
+	t.Helper()
+	e, err := openpgp.NewEntity(name, "", strings.ToLower(name)+"@example.com", &packet.Config{RSABits: bits})
+	if err != nil {
+		t.Fatalf("Failed to create OpenPGP key: %v", err)
+	}
+	return e
+}
+
+// pgpKeyringForTest returns a keyring holding the public keys of entities
+func pgpKeyringForTest(t testing.TB, entities ...*openpgp.Entity) *PGPKeyring {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, e := range entities {
+		if err := e.Serialize(&buf); err != nil {
+			t.Fatalf("Failed to export OpenPGP key: %v", err)
+		}
+	}
+	keyring, err := ParsePGPKeyring(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to parse OpenPGP keys: %v", err)
+	}
+	return keyring
+}
+
+// pgpSignForTest returns a detached OpenPGP signature of data by signer
+func pgpSignForTest(t testing.TB, signer *openpgp.Entity, data []byte, h crypto.Hash) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := openpgp.DetachSign(&buf, signer, bytes.NewReader(data), &packet.Config{DefaultHash: h}); err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// rpmPackageForTest returns an RPM package of payload with the digests
+// rpmbuild records and, unless signer is nil, the header and header and
+// payload signatures rpmsign adds
+func rpmPackageForTest(t testing.TB, signer *openpgp.Entity, payload []byte, h crypto.Hash) []byte {
+	t.Helper()
+	payloadDigest := sha256.Sum256(payload)
+	header := rpmHeaderForTest(
+		rpmStringForTest(1000, "demo"),
+		rpmTagForTest{tag: rpmTagPayloadDigest, typ: rpmTypeStringArray, count: 1, value: append([]byte(hex.EncodeToString(payloadDigest[:])), 0)},
+		rpmTagForTest{tag: rpmTagPayloadDigestAlgo, typ: rpmTypeInt32, count: 1, value: []byte{0, 0, 0, 8}},
+	)
+	headerDigest := sha256.Sum256(header)
+	signed := append(append([]byte(nil), header...), payload...)
+	md5Digest := md5.Sum(signed)
+	tags := []rpmTagForTest{
+		rpmStringForTest(rpmSigTagSHA256, hex.EncodeToString(headerDigest[:])),
+		{tag: rpmSigTagMD5, typ: rpmTypeBin, count: 16, value: md5Digest[:]},
+	}
+	if signer != nil {
+		rsa := pgpSignForTest(t, signer, header, h)
+		pgp := pgpSignForTest(t, signer, signed, h)
+		tags = append(tags,
+			rpmTagForTest{tag: rpmSigTagRSA, typ: rpmTypeBin, count: uint32(len(rsa)), value: rsa},
+			rpmTagForTest{tag: rpmSigTagPGP, typ: rpmTypeBin, count: uint32(len(pgp)), value: pgp},
+		)
+	}
+	signature := rpmHeaderForTest(tags...)
+	signature = append(signature, make([]byte, (8-len(signature)%8)%8)...)
+
+	lead := make([]byte, rpmLeadSize)
+	copy(lead, rpmLeadMagic)
+	copy(lead[10:], "demo-1.0-1")
+	return append(append(lead, signature...), signed...)
+}
+
+func TestVerify_RPM(t *testing.T) {
+	signer := pgpEntityForTest(t, "Packager", 2048)
+	keyring := pgpKeyringForTest(t, signer)
+	payload := bytes.Repeat([]byte("payload"), 512)
+	filePath := writeScriptForTest(t, "demo.rpm", rpmPackageForTest(t, signer, payload, crypto.SHA256))
+	if fileType, err := DetectFileType(filePath); err != nil || fileType != FileTypeRPM {
+		t.Fatalf("Expected FileTypeRPM, got %q, %v", fileType, err)
+	}
+	if signature, err := ExtractDigitalSignature(filePath); err != nil || !isPGPSignature(signature) {
+		t.Fatalf("Expected the OpenPGP header signature, got %v", err)
+	}
+
+	if err := Verify(filePath, &VerifyOptions{PGPKeyring: keyring}); err != nil {
+		t.Fatalf("Expected valid package signatures, got %v", err)
+	}
+	if err := Verify(filePath, nil); !errors.Is(err, ErrSignerCertificateNotFound) {
+		t.Errorf("Expected ErrSignerCertificateNotFound without a keyring, got %v", err)
+	}
+	other := pgpKeyringForTest(t, pgpEntityForTest(t, "Other", 2048))
+	if err := Verify(filePath, &VerifyOptions{PGPKeyring: other}); !errors.Is(err, ErrSignerCertificateNotFound) {
+		t.Errorf("Expected ErrSignerCertificateNotFound for another key, got %v", err)
+	}
+
+	signatures, err := InspectPGPSignatures(filePath, keyring)
+	if err != nil || len(signatures) != 2 {
+		t.Fatalf("Expected two signatures, got %+v, %v", signatures, err)
+	}
+	if s := signatures[0]; s.Kind != "RSAHEADER" || s.KeyID != signer.PrimaryKey.KeyIdString() || s.HashAlgorithm != crypto.SHA256 || s.UserID != "Packager <packager@example.com>" {
+		t.Errorf("Unexpected header signature %+v", s)
+	}
+	if _, err := Inspect(filePath); err == nil || !strings.Contains(err.Error(), "InspectPGPSignatures") {
+		t.Errorf("Expected Inspect to refer to InspectPGPSignatures, got %v", err)
+	}
+
+	tampered := rpmPackageForTest(t, signer, payload, crypto.SHA256)
+	tampered[len(tampered)-1] ^= 0xff
+	tamperedPath := writeScriptForTest(t, "demo.rpm", tampered)
+	var mismatch *DigestMismatchError
+	if err := Verify(tamperedPath, &VerifyOptions{PGPKeyring: keyring}); !errors.As(err, &mismatch) {
+		t.Errorf("Expected DigestMismatchError for a modified payload, got %v", err)
+	}
+	if err := Verify(tamperedPath, &VerifyOptions{PGPKeyring: keyring, SkipContentDigest: true}); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for a modified payload without digests, got %v", err)
+	}
+
+	weak := writeScriptForTest(t, "demo.rpm", rpmPackageForTest(t, signer, payload, crypto.SHA1))
+	if err := Verify(weak, &VerifyOptions{PGPKeyring: keyring}); err != nil {
+		t.Errorf("Expected a SHA-1 signature to verify, got %v", err)
+	}
+	if err := Verify(weak, &VerifyOptions{PGPKeyring: keyring, RejectWeakCrypto: true}); !errors.Is(err, ErrWeakCrypto) {
+		t.Errorf("Expected ErrWeakCrypto for a SHA-1 signature, got %v", err)
+	}
+}
+
+func TestVerify_RPMUnsigned(t *testing.T) {
+	filePath := writeScriptForTest(t, "demo.rpm", rpmPackageForTest(t, nil, []byte("payload"), crypto.SHA256))
+	if err := Verify(filePath, nil); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned, got %v", err)
+	}
+	if _, err := InspectPGPSignatures(filePath, nil); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned from InspectPGPSignatures, got %v", err)
+	}
+}
+
+func TestOpenRPMPackage_Malformed(t *testing.T) {
+	valid := rpmPackageForTest(t, nil, []byte("payload"), crypto.SHA256)
+	tests := []struct {
+		name   string
+		mutate func([]byte) []byte
+	}{
+		{"truncated", func(b []byte) []byte { return b[:rpmLeadSize+8] }},
+		{"header magic", func(b []byte) []byte { b[rpmLeadSize] = 0; return b }},
+		{"data size", func(b []byte) []byte { binary.BigEndian.PutUint32(b[rpmLeadSize+12:], 1<<20); return b }},
+		{"tag offset", func(b []byte) []byte { binary.BigEndian.PutUint32(b[rpmLeadSize+16+8:], 1<<16); return b }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.mutate(append([]byte(nil), valid...))
+			if _, err := openRPMPackage(bytes.NewReader(data), int64(len(data))); err == nil {
+				t.Error("Expected an error for a malformed package")
+			}
+		})
+	}
+}
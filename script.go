@@ -0,0 +1,201 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// maxScriptSize bounds the scripts read into memory to compute their digest
+const maxScriptSize = 64 << 20
+
+// scriptTailSize is how much of the end of a file is searched for the
+// signature block of a script
+const scriptTailSize = 4 << 10
+
+// scriptStyle is how a Windows Script Host script embeds its signature: a
+// block of base64 lines, each starting with prefix, between the begin and
+// end markers
+type scriptStyle struct {
+	fileType   FileType
+	prefix     string
+	begin, end string
+}
+
+// scriptStyles are the signature blocks of VBScript, JScript and Windows
+// Script Files
+var scriptStyles = []scriptStyle{
+	{FileTypeVBScript, "'' SIG '' ", "'' SIG '' Begin signature block", "'' SIG '' End signature block"},
+	{FileTypeJScript, "// SIG // ", "// SIG // Begin signature block", "// SIG // End signature block"},
+	{FileTypeWSF, "** SIG ** ", "<signature>", "</signature>"},
+}
+
+// scriptLayout is a signed script split into the text its signature covers
+// and the signature
+type scriptLayout struct {
+	style *scriptStyle
+	// content is the script without its signature block
+	content   string
+	signature []byte
+}
+
+// scriptFileType returns the file type of the signed script r, identified
+// by the end of its signature block, or FileTypeUnknown
+func scriptFileType(r io.ReaderAt, size int64) FileType {
+	var bom [2]byte
+	if _, err := r.ReadAt(bom[:], 0); err != nil {
+		return FileTypeUnknown
+	}
+	offset := max(size-scriptTailSize, 0)
+	wide := bom == [2]byte{0xff, 0xfe}
+	if wide {
+		// Keep the UTF-16 code units aligned
+		offset = max(offset&^1, 2)
+	}
+	tail := make([]byte, size-offset)
+	if _, err := r.ReadAt(tail, offset); err != nil {
+		return FileTypeUnknown
+	}
+	text := decodeScriptText(tail, wide)
+	for _, style := range scriptStyles {
+		if strings.Contains(text, style.end) && strings.Contains(text, style.prefix) {
+			return style.fileType
+		}
+	}
+	return FileTypeUnknown
+}
+
+// readScriptLayout reads the signed script r and splits off its signature
+// block
+func readScriptLayout(r io.ReaderAt, size int64) (*scriptLayout, error) {
+	if size > maxScriptSize {
+		return nil, fmt.Errorf("script of %d bytes exceeds the %d byte limit", size, maxScriptSize)
+	}
+	data := make([]byte, size)
+	if _, err := r.ReadAt(data, 0); err != nil {
+		return nil, fmt.Errorf("failed to read script: %w", err)
+	}
+	return parseScript(data)
+}
+
+// parseScript splits the script data into the text before and after its
+// signature block, without the line break preceding the block, and the
+// signature the block holds
+func parseScript(data []byte) (*scriptLayout, error) {
+	wide := bytes.HasPrefix(data, []byte{0xff, 0xfe})
+	if wide {
+		data = data[2:]
+	}
+	text := decodeScriptText(data, wide)
+
+	for i := range scriptStyles {
+		style := &scriptStyles[i]
+		end := strings.LastIndex(text, style.end)
+		if end < 0 {
+			continue
+		}
+		begin := strings.LastIndex(text[:end], style.begin)
+		if begin < 0 {
+			return nil, fmt.Errorf("script signature block has no %q line", style.begin)
+		}
+
+		var encoded strings.Builder
+		for _, line := range strings.Split(text[begin+len(style.begin):end], "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			chunk, ok := strings.CutPrefix(line, strings.TrimSpace(style.prefix))
+			if !ok {
+				return nil, fmt.Errorf("script signature block line %q does not start with %q", line, style.prefix)
+			}
+			encoded.WriteString(strings.TrimSpace(chunk))
+		}
+		if encoded.Len() > base64.StdEncoding.EncodedLen(MaxSignatureSize) {
+			return nil, &SignatureSizeError{Size: int64(base64.StdEncoding.DecodedLen(encoded.Len())), Limit: MaxSignatureSize}
+		}
+		signature, err := base64.StdEncoding.DecodeString(encoded.String())
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode script signature block: %w", err)
+		}
+
+		start := begin
+		if strings.HasSuffix(text[:start], "\r\n") {
+			start -= 2
+		} else if strings.HasSuffix(text[:start], "\n") {
+			start--
+		}
+		content := text[:start] + text[end+len(style.end):]
+		return &scriptLayout{style: style, content: content, signature: signature}, nil
+	}
+	return nil, fmt.Errorf("%w (script has no signature block)", ErrNotSigned)
+}
+
+// decodeScriptText decodes a script as the Windows Script Host reads it:
+// UTF-16LE when wide, which the byte order mark selects, otherwise UTF-8
+// when it is valid, with any byte order mark removed, and Latin-1
+// otherwise
+func decodeScriptText(data []byte, wide bool) string {
+	if wide {
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			units[i] = binary.LittleEndian.Uint16(data[2*i:])
+		}
+		return string(utf16.Decode(units))
+	}
+	if utf8.Valid(data) {
+		return strings.TrimPrefix(string(data), "\ufeff")
+	}
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// readScriptSignature returns the PKCS#7 signature of the signed script r
+func readScriptSignature(r io.ReaderAt, size int64) ([]byte, error) {
+	layout, err := readScriptLayout(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return layout.signature, nil
+}
+
+// verifyScript performs full Authenticode verification of the signed script
+// in r: unless disabled, the digest of the script without its signature
+// block must match the signature; the signer signature and chain are
+// checked per opts.
+func verifyScript(r io.ReaderAt, size int64, opts VerifyOptions) error {
+	layout, err := readScriptLayout(r, size)
+	if err != nil {
+		return fmt.Errorf("failed to extract signature: %w", err)
+	}
+	opts.logger().Debug("read script signature", "fileSize", size, "type", layout.style.fileType, "size", len(layout.signature))
+
+	return verifySignatureDigest(layout.signature, opts, func(algorithm crypto.Hash) ([]byte, error) {
+		return scriptDigest(layout.content, algorithm)
+	})
+}
+
+// scriptDigest computes the Authenticode digest of a script: the hash of
+// content, the script without its signature block, as UTF-16LE text
+// without a byte order mark
+func scriptDigest(content string, algorithm crypto.Hash) ([]byte, error) {
+	if !algorithm.Available() {
+		return nil, fmt.Errorf("hash algorithm %v is not available", algorithm)
+	}
+	h := algorithm.New()
+	var unit [2]byte
+	for _, u := range utf16.Encode([]rune(content)) {
+		binary.LittleEndian.PutUint16(unit[:], u)
+		h.Write(unit[:])
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,144 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// signedScriptForTest returns script with a signature block in the style
+// of fileType by the test signer over its UTF-16LE text
+func signedScriptForTest(t *testing.T, fileType FileType, script string) string {
+	t.Helper()
+	var style *scriptStyle
+	for i := range scriptStyles {
+		if scriptStyles[i].fileType == fileType {
+			style = &scriptStyles[i]
+		}
+	}
+	digest, err := scriptDigest(script, crypto.SHA256)
+	if err != nil {
+		t.Fatalf("scriptDigest failed: %v", err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(signAuthenticodeForTest(t, digest, crypto.SHA256))
+
+	var block strings.Builder
+	block.WriteString(style.begin + "\r\n")
+	for len(encoded) > 0 {
+		n := min(len(encoded), 64)
+		block.WriteString(style.prefix + encoded[:n] + "\r\n")
+		encoded = encoded[n:]
+	}
+	block.WriteString(style.end)
+
+	// Windows Script Files carry the block on its own lines inside the job;
+	// the other scripts end with it
+	if fileType == FileTypeWSF {
+		i := strings.LastIndex(script, "\r\n</job>")
+		return script[:i] + "\r\n" + block.String() + script[i:]
+	}
+	return script + block.String() + "\r\n"
+}
+
+// writeScriptForTest writes data to a file named name and returns its path
+func writeScriptForTest(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(filePath, data, 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	return filePath
+}
+
+func TestVerify_Script(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileType FileType
+		script   string
+	}{
+		{"hello.vbs", FileTypeVBScript, "WScript.Echo \"Hello from sigtool\"\r\n"},
+		{"hello.js", FileTypeJScript, "WScript.Echo(\"Hello from sigtool\");\r\n"},
+		{"hello.wsf", FileTypeWSF, "<package>\r\n<job id=\"hello\">\r\n<script language=\"VBScript\">WScript.Echo \"Hello\"</script>\r\n</job>\r\n</package>\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signed := signedScriptForTest(t, tt.fileType, tt.script)
+			filePath := writeScriptForTest(t, tt.name, []byte(signed))
+
+			if fileType, err := DetectFileType(filePath); err != nil || fileType != tt.fileType {
+				t.Fatalf("Expected %q, got %q (%v)", tt.fileType, fileType, err)
+			}
+			if err := Verify(filePath, &VerifyOptions{Roots: testRoots(t)}); err != nil {
+				t.Fatalf("Expected valid script, got %v", err)
+			}
+			info, err := Inspect(filePath)
+			if err != nil {
+				t.Fatalf("Inspect failed: %v", err)
+			}
+			if info.Signer.CommonName != "sigtool test signer" {
+				t.Errorf("Expected the test signer, got %s", info.Signer.Subject)
+			}
+
+			tampered := strings.Replace(signed, "Hello", "Hullo", 1)
+			filePath = writeScriptForTest(t, tt.name, []byte(tampered))
+			if err := Verify(filePath, nil); !errors.Is(err, ErrDigestMismatch) {
+				t.Errorf("Expected ErrDigestMismatch for a modified script, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVerify_ScriptUTF16(t *testing.T) {
+	signed := signedScriptForTest(t, FileTypeVBScript, "WScript.Echo \"Grüße\"\r\n")
+	units := utf16.Encode([]rune(signed))
+	data := []byte{0xff, 0xfe}
+	for _, u := range units {
+		data = binary.LittleEndian.AppendUint16(data, u)
+	}
+	filePath := writeScriptForTest(t, "hello.vbs", data)
+
+	if err := Verify(filePath, nil); err != nil {
+		t.Fatalf("Expected valid UTF-16 script, got %v", err)
+	}
+	signature, err := ExtractDigitalSignature(filePath)
+	if err != nil {
+		t.Fatalf("ExtractDigitalSignature failed: %v", err)
+	}
+	layout, err := parseScript([]byte(signed))
+	if err != nil {
+		t.Fatalf("parseScript failed: %v", err)
+	}
+	if !bytes.Equal(signature, layout.signature) {
+		t.Error("Expected the same signature from the UTF-16 and UTF-8 scripts")
+	}
+}
+
+func TestParseScript_Errors(t *testing.T) {
+	tests := []struct {
+		name, script string
+		notSigned    bool
+	}{
+		{"unsigned", "WScript.Echo 1\r\n", true},
+		{"no begin", "WScript.Echo 1\r\n'' SIG '' MIIB\r\n'' SIG '' End signature block\r\n", false},
+		{"foreign line", "WScript.Echo 1\r\n'' SIG '' Begin signature block\r\nMIIB\r\n'' SIG '' End signature block\r\n", false},
+		{"bad base64", "WScript.Echo 1\r\n'' SIG '' Begin signature block\r\n'' SIG '' M!IB\r\n'' SIG '' End signature block\r\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseScript([]byte(tt.script))
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			if errors.Is(err, ErrNotSigned) != tt.notSigned {
+				t.Errorf("Expected ErrNotSigned %v, got %v", tt.notSigned, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+#!/bin/bash
+
+# Script to regenerate the embedded Microsoft Trusted Root Program bundle
+# used by the sigtool_msroots build tag.
+#
+# The bundle holds the code-signing roots of the Microsoft Trusted Root
+# Program that are also distributed by public CA stores. Usage:
+#
+#   ./scripts/update-microsoft-roots.sh [certificate-directory]
+#
+# The directory defaults to /etc/ssl/certs and must contain the roots below
+# as individual PEM files.
+
+set -e
+
+CERT_DIR="${1:-/etc/ssl/certs}"
+OUTPUT="$(dirname "$0")/../roots/microsoft_codesigning_roots.pem"
+
+ROOTS=(
+    Comodo_AAA_Services_root
+    COMODO_RSA_Certification_Authority
+    Certum_Trusted_Network_CA
+    DigiCert_Assured_ID_Root_CA
+    DigiCert_Global_Root_CA
+    DigiCert_Global_Root_G2
+    DigiCert_High_Assurance_EV_Root_CA
+    DigiCert_Trusted_Root_G4
+    Entrust_Root_Certification_Authority
+    Entrust_Root_Certification_Authority_-_G2
+    GlobalSign_Root_CA
+    GlobalSign_Root_CA_-_R3
+    Go_Daddy_Root_Certificate_Authority_-_G2
+    IdenTrust_Commercial_Root_CA_1
+    Microsoft_ECC_Root_Certificate_Authority_2017
+    Microsoft_RSA_Root_Certificate_Authority_2017
+    SSL.com_EV_Root_Certification_Authority_RSA_R2
+    SSL.com_Root_Certification_Authority_RSA
+    Starfield_Root_Certificate_Authority_-_G2
+    USERTrust_ECC_Certification_Authority
+    USERTrust_RSA_Certification_Authority
+)
+
+mkdir -p "$(dirname "$OUTPUT")"
+{
+    echo "# Microsoft Trusted Root Program code-signing roots"
+    echo "# Generated by scripts/update-microsoft-roots.sh; do not edit."
+    for root in "${ROOTS[@]}"; do
+        file="$CERT_DIR/$root.pem"
+        if [[ ! -f "$file" ]]; then
+            echo "❌ Missing root certificate: $file" >&2
+            exit 1
+        fi
+        echo
+        echo "# $(openssl x509 -in "$file" -noout -subject -nameopt RFC2253)"
+        echo "# SHA256 $(openssl x509 -in "$file" -noout -fingerprint -sha256 | cut -d= -f2)"
+        openssl x509 -in "$file" -outform PEM
+    done
+} > "$OUTPUT"
+
+echo "✅ Wrote ${#ROOTS[@]} roots to $OUTPUT"
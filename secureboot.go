@@ -0,0 +1,210 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// SecureBootPolicy holds the UEFI Secure Boot signature databases EFI
+// images are checked against, as read with LoadSignatureLists.
+type SecureBootPolicy struct {
+	// DB is the authorized signature database: the certificates images
+	// must be signed under and the authentihashes of images allowed
+	// unsigned
+	DB []EFISignatureList
+	// DBX is the forbidden signature database: the authentihashes of
+	// revoked images and the certificates and TBS hashes of revoked signers
+	DBX []EFISignatureList
+}
+
+// verifySecureBoot verifies the EFI image r described by layout as UEFI
+// firmware does with Secure Boot enabled. The image is rejected with
+// ErrForbiddenByDBX when its authentihash is in the dbx or any of its
+// signatures chains to a dbx certificate, and otherwise accepted when a
+// signature chains to a db certificate or its authentihash is in the db.
+//
+// Firmware has no trusted clock, so chains are validated at the issuance
+// of the signer and for any usage. A certificate TBS hash in the dbx
+// revokes signatures timestamped after its revocation time, or all of
+// them when the time is zero; the timestamp authority must chain to the
+// db.
+func verifySecureBoot(r io.ReaderAt, layout *peLayout, policy *SecureBootPolicy, opts VerifyOptions) error {
+	log := opts.logger()
+	hashes := make(map[crypto.Hash][]byte)
+	imageHash := func(algorithm crypto.Hash) ([]byte, error) {
+		if digest, ok := hashes[algorithm]; ok {
+			return digest, nil
+		}
+		digest, err := authentihash(r, layout, algorithm)
+		if err != nil {
+			return nil, err
+		}
+		hashes[algorithm] = digest
+		return digest, nil
+	}
+	if entry, err := imageHashEntry(policy.DBX, imageHash); err != nil {
+		return err
+	} else if entry != nil {
+		return fmt.Errorf("%w: authentihash %x is revoked", ErrForbiddenByDBX, entry.Data)
+	}
+
+	db, err := signatureListCertificates(policy.DB)
+	if err != nil {
+		return fmt.Errorf("db: %w", err)
+	}
+	dbx, err := signatureListCertificates(policy.DBX)
+	if err != nil {
+		return fmt.Errorf("dbx: %w", err)
+	}
+
+	var entries []WinCertificate
+	if layout.certTableSize > 0 {
+		if entries, err = readCertificateTable(r, layout); err != nil {
+			return fmt.Errorf("failed to extract signature: %w", err)
+		}
+	}
+	var verified bool
+	var firstErr error
+	// Every signature is checked against the dbx, so an image is rejected
+	// when any of its signers is revoked
+	for _, entry := range entries {
+		if entry.CertificateType != WinCertTypePKCSSignedData {
+			continue
+		}
+		err := verifySecureBootSignature(entry.Data, imageHash, db, dbx, policy.DBX)
+		log.Debug("checked Secure Boot signature", "offset", entry.Offset, "error", err)
+		switch {
+		case errors.Is(err, ErrForbiddenByDBX):
+			return err
+		case err == nil:
+			verified = true
+		case firstErr == nil:
+			firstErr = err
+		}
+	}
+	if verified {
+		return nil
+	}
+
+	if entry, err := imageHashEntry(policy.DB, imageHash); err != nil {
+		return err
+	} else if entry != nil {
+		log.Debug("authentihash is authorized by the db", "authentihash", fmt.Sprintf("%x", entry.Data))
+		return nil
+	}
+	if firstErr != nil {
+		return fmt.Errorf("%w: %w", ErrNotAuthorizedByDB, firstErr)
+	}
+	return fmt.Errorf("%w: image is not signed and its authentihash is not in the db", ErrNotAuthorizedByDB)
+}
+
+// verifySecureBootSignature verifies one Authenticode signature of an EFI
+// image whose authentihash is computed by imageHash against the db
+// certificates and the dbx certificates and lists
+func verifySecureBootSignature(signature []byte, imageHash func(crypto.Hash) ([]byte, error), db, dbx []*x509.Certificate, dbxLists []EFISignatureList) error {
+	p7, err := parsePKCS7(signature)
+	if err != nil {
+		return fmt.Errorf("failed to parse PKCS#7 signature: %w", err)
+	}
+	algorithm, stored, err := storedDigest(p7)
+	if err != nil {
+		return err
+	}
+	computed, err := imageHash(algorithm)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(stored, computed) {
+		return &DigestMismatchError{Algorithm: algorithm, Signed: stored, Computed: computed}
+	}
+	if err := verifySignerSignature(p7); err != nil {
+		return err
+	}
+	signer := p7.GetOnlySigner()
+	if signer == nil {
+		return ErrSignerCertificateNotFound
+	}
+
+	chainTo := func(roots []*x509.Certificate) ([][]*x509.Certificate, error) {
+		return signer.Verify(x509.VerifyOptions{
+			Roots:         certificatePool(roots),
+			Intermediates: certificatePool(p7.Certificates),
+			CurrentTime:   signer.NotBefore,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+	}
+	if len(dbx) > 0 {
+		if chains, err := chainTo(dbx); err == nil {
+			revoked := chains[0][len(chains[0])-1]
+			return fmt.Errorf("%w: signer chains to revoked certificate %q", ErrForbiddenByDBX, revoked.Subject.String())
+		}
+	}
+	chains, chainErr := chainTo(db)
+
+	certs := append([]*x509.Certificate{signer}, p7.Certificates...)
+	for _, chain := range chains {
+		certs = append(certs, chain...)
+	}
+	if cert, revokedAt := revokedTBSHash(certs, dbxLists); cert != nil {
+		var ts *TimestampInfo
+		if !revokedAt.IsZero() {
+			ts, _ = verifyTimestamp(p7, &trustConfig{roots: certificatePool(db)})
+		}
+		if ts == nil || !ts.Time.Before(revokedAt) {
+			return fmt.Errorf("%w: certificate %q is revoked", ErrForbiddenByDBX, cert.Subject.String())
+		}
+	}
+
+	if chainErr != nil {
+		return fmt.Errorf("%w: %w", ErrChainVerification, chainErr)
+	}
+	return nil
+}
+
+// imageHashEntry returns the authentihash entry of lists matching the
+// image whose authentihash imageHash computes, or nil
+func imageHashEntry(lists []EFISignatureList, imageHash func(crypto.Hash) ([]byte, error)) (*EFISignatureData, error) {
+	for _, l := range lists {
+		t, ok := eslSignatureTypes[l.Type]
+		if !ok || t.hash == 0 || len(l.Signatures) == 0 || t.size != t.hash.Size() {
+			continue
+		}
+		digest, err := imageHash(t.hash)
+		if err != nil {
+			return nil, err
+		}
+		for i := range l.Signatures {
+			if bytes.Equal(l.Signatures[i].Data, digest) {
+				return &l.Signatures[i], nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// revokedTBSHash returns the first of certs whose TBSCertificate hash is in
+// the X.509 hash lists of dbx and its revocation time
+func revokedTBSHash(certs []*x509.Certificate, dbx []EFISignatureList) (*x509.Certificate, time.Time) {
+	for _, l := range dbx {
+		t, ok := eslSignatureTypes[l.Type]
+		if !ok || t.hash == 0 || t.size != t.hash.Size()+16 {
+			continue
+		}
+		for _, cert := range certs {
+			h := t.hash.New()
+			h.Write(cert.RawTBSCertificate)
+			digest := h.Sum(nil)
+			for _, s := range l.Signatures {
+				if bytes.Equal(s.Data[:len(digest)], digest) {
+					return cert, s.RevocationTime
+				}
+			}
+		}
+	}
+	return nil, time.Time{}
+}
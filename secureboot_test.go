@@ -0,0 +1,114 @@
+package sigtool
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// secureBootSignerForTest returns a signer issued by a UEFI CA, as the
+// db holds it, and that CA
+func secureBootSignerForTest(t testing.TB) (*testIdentity, *testIdentity) {
+	t.Helper()
+	ca := issueCertificateForTest(t, testCATemplate("sigtool UEFI CA", 9201), nil)
+	return issueCertificateForTest(t, testLeafTemplate("sigtool shim", 9202, x509.ExtKeyUsageCodeSigning), ca), ca
+}
+
+// tbsHashEntryForTest returns an EFI_CERT_X509_SHA256 entry revoking cert
+// at revokedAt, or always when it is zero
+func tbsHashEntryForTest(cert *x509.Certificate, revokedAt time.Time) []byte {
+	digest := sha256.Sum256(cert.RawTBSCertificate)
+	entry := make([]byte, 48)
+	copy(entry, digest[:])
+	if !revokedAt.IsZero() {
+		entry[32], entry[33] = byte(revokedAt.Year()), byte(revokedAt.Year()>>8)
+		entry[34], entry[35] = byte(revokedAt.Month()), byte(revokedAt.Day())
+	}
+	return entry
+}
+
+func TestVerify_SecureBoot(t *testing.T) {
+	signer, ca := secureBootSignerForTest(t)
+	filePath := createSignedMockPEAs(t, signer, crypto.SHA256)
+	authentihash, err := ComputeAuthentihash(filePath, crypto.SHA256)
+	if err != nil {
+		t.Fatalf("ComputeAuthentihash failed: %v", err)
+	}
+	db := mustParseSignatureListsForTest(t, eslForTest(t, EFICertX509GUID, ca.Cert.Raw))
+	other, _ := testSigner(t)
+
+	tests := []struct {
+		name   string
+		policy SecureBootPolicy
+		want   error
+	}{
+		{name: "db", policy: SecureBootPolicy{DB: db}},
+		{name: "db signer", policy: SecureBootPolicy{DB: mustParseSignatureListsForTest(t, eslForTest(t, EFICertX509GUID, signer.Cert.Raw))}},
+		{name: "db hash", policy: SecureBootPolicy{DB: mustParseSignatureListsForTest(t, eslForTest(t, EFICertSHA256GUID, authentihash))}},
+		{name: "other db", policy: SecureBootPolicy{DB: mustParseSignatureListsForTest(t, eslForTest(t, EFICertX509GUID, other.Raw))}, want: ErrNotAuthorizedByDB},
+		{name: "dbx hash", policy: SecureBootPolicy{DB: db, DBX: mustParseSignatureListsForTest(t, eslForTest(t, EFICertSHA256GUID, authentihash))}, want: ErrForbiddenByDBX},
+		{name: "dbx signer", policy: SecureBootPolicy{DB: db, DBX: mustParseSignatureListsForTest(t, eslForTest(t, EFICertX509GUID, signer.Cert.Raw))}, want: ErrForbiddenByDBX},
+		{name: "dbx CA", policy: SecureBootPolicy{DB: db, DBX: mustParseSignatureListsForTest(t, eslForTest(t, EFICertX509GUID, ca.Cert.Raw))}, want: ErrForbiddenByDBX},
+		{name: "dbx TBS hash", policy: SecureBootPolicy{DB: db, DBX: mustParseSignatureListsForTest(t, eslForTest(t, EFICertX509SHA256GUID, tbsHashEntryForTest(signer.Cert, time.Time{})))}, want: ErrForbiddenByDBX},
+		{name: "untimestamped TBS revocation", policy: SecureBootPolicy{DB: db, DBX: mustParseSignatureListsForTest(t, eslForTest(t, EFICertX509SHA256GUID, tbsHashEntryForTest(ca.Cert, time.Now().AddDate(1, 0, 0))))}, want: ErrForbiddenByDBX},
+		{name: "other dbx", policy: SecureBootPolicy{DB: db, DBX: mustParseSignatureListsForTest(t, eslForTest(t, EFICertX509GUID, other.Raw))}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(filePath, &VerifyOptions{SecureBoot: &tt.policy})
+			if tt.want == nil && err != nil {
+				t.Errorf("Expected the image to be authorized, got %v", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestVerify_SecureBootTimestampedRevocation(t *testing.T) {
+	signer, ca := secureBootSignerForTest(t)
+	signed := time.Now().Add(-time.Minute).Truncate(time.Second)
+	filePath := createSignedMockPEAs(t, signer, crypto.SHA256, withRFC3161Timestamp(t, signed))
+	tsa, _ := testTSA(t)
+	db := mustParseSignatureListsForTest(t, append(eslForTest(t, EFICertX509GUID, ca.Cert.Raw), eslForTest(t, EFICertX509GUID, tsa.Raw)...))
+
+	later := SecureBootPolicy{DB: db, DBX: mustParseSignatureListsForTest(t, eslForTest(t, EFICertX509SHA256GUID, tbsHashEntryForTest(signer.Cert, signed.AddDate(0, 0, 2))))}
+	if err := Verify(filePath, &VerifyOptions{SecureBoot: &later}); err != nil {
+		t.Errorf("Expected a signature timestamped before the revocation to be authorized, got %v", err)
+	}
+	earlier := SecureBootPolicy{DB: db, DBX: mustParseSignatureListsForTest(t, eslForTest(t, EFICertX509SHA256GUID, tbsHashEntryForTest(signer.Cert, signed.AddDate(0, 0, -2))))}
+	if err := Verify(filePath, &VerifyOptions{SecureBoot: &earlier}); !errors.Is(err, ErrForbiddenByDBX) {
+		t.Errorf("Expected ErrForbiddenByDBX for a signature timestamped after the revocation, got %v", err)
+	}
+}
+
+func TestVerify_SecureBootUnsigned(t *testing.T) {
+	image := mockPEImage([]byte("unsigned EFI application"))
+	filePath := filepath.Join(t.TempDir(), "app.efi")
+	if err := os.WriteFile(filePath, image, 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{SecureBoot: &SecureBootPolicy{}}); !errors.Is(err, ErrNotAuthorizedByDB) {
+		t.Errorf("Expected ErrNotAuthorizedByDB for an unsigned image, got %v", err)
+	}
+	policy := SecureBootPolicy{DB: mustParseSignatureListsForTest(t, eslForTest(t, EFICertSHA256GUID, mockAuthentihash(image, crypto.SHA256)))}
+	if err := Verify(filePath, &VerifyOptions{SecureBoot: &policy}); err != nil {
+		t.Errorf("Expected an unsigned image in the db to be authorized, got %v", err)
+	}
+}
+
+// mustParseSignatureListsForTest is ParseSignatureLists failing t on error
+func mustParseSignatureListsForTest(t testing.TB, data []byte) []EFISignatureList {
+	t.Helper()
+	lists, err := ParseSignatureLists(data)
+	if err != nil {
+		t.Fatalf("ParseSignatureLists failed: %v", err)
+	}
+	return lists
+}
@@ -0,0 +1,419 @@
+package sigtool
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"sort"
+	"unicode/utf16"
+)
+
+var (
+	// PKCS#7 SignedData content type
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+
+	// SpcIndirectDataContent data type for PE images
+	oidSpcPEImageData = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 15}
+
+	// SpcStatementType authenticated attribute and its individual code
+	// signing purpose
+	oidSpcStatementType   = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 11}
+	oidSpcIndividualSPKey = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 21}
+
+	// SignerInfo digestEncryptionAlgorithm identifiers
+	oidSignatureRSA         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSignatureECDSASHA1   = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}
+	oidSignatureECDSASHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidSignatureECDSASHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidSignatureECDSASHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+)
+
+// spcPEImageDataObsolete is the file name signing tools record in
+// SpcPeImageData
+const spcPEImageDataObsolete = "<<<Obsolete>>>"
+
+// SignOptions configures SignPE. The zero value signs with SHA-256.
+type SignOptions struct {
+	// Hash is the digest algorithm for the Authenticode digest and the
+	// signature. Zero means crypto.SHA256.
+	Hash crypto.Hash
+	// Intermediates are embedded after the certificates of the signer so
+	// that verifiers can build the chain to a root
+	Intermediates []*x509.Certificate
+	// ProgramName is recorded in the SpcSpOpusInfo attribute, shown by
+	// Windows as the program description
+	ProgramName string
+	// MoreInfoURL is recorded in the SpcSpOpusInfo attribute as the link
+	// for more information about the program
+	MoreInfoURL string
+	// Timestamp, when set, has the signature countersigned by an RFC 3161
+	// timestamp authority. Signing fails if no authority grants a timestamp.
+	Timestamp *TimestampOptions
+}
+
+// contentInfo mirrors the PKCS#7 ContentInfo structure
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+// signedData mirrors the PKCS#7 SignedData structure produced by SignPE
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      contentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+// parseSignedData decodes a PKCS#7 SignedData signature into the structure
+// signedData re-encodes byte for byte, so that unsigned attributes can be
+// changed without invalidating the signature. Trailing padding is ignored.
+func parseSignedData(signature []byte) (*signedData, error) {
+	var outer contentInfo
+	if _, err := asn1.Unmarshal(signature, &outer); err != nil {
+		return nil, fmt.Errorf("failed to parse ContentInfo: %w", err)
+	}
+	if !outer.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("content type %s is not SignedData", outer.ContentType)
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(outer.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("failed to parse SignedData: %w", err)
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("signature has %d signers, expected 1", len(sd.SignerInfos))
+	}
+	return &sd, nil
+}
+
+// encodeSignedData wraps sd in a PKCS#7 ContentInfo
+func encodeSignedData(sd *signedData) ([]byte, error) {
+	der, err := asn1.Marshal(*sd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode SignedData: %w", err)
+	}
+	p7, err := asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode ContentInfo: %w", err)
+	}
+	return p7, nil
+}
+
+// SignPE signs a PE file with Authenticode, replacing any existing signature.
+//
+// The Authenticode digest of the image is computed, wrapped in an
+// SpcIndirectDataContent and signed as PKCS#7 SignedData by key. The
+// signature is appended as a WIN_CERTIFICATE entry, the security directory
+// is pointed at it and the image checksum is updated. The file is replaced
+// atomically. The signature is timestamped when opts.Timestamp is set.
+//
+// Parameters:
+//   - filePath: The path to the PE file to sign
+//   - cert: The signer certificate, matching key
+//   - key: The private key, RSA or ECDSA
+//   - opts: Signing options, or nil for the defaults
+//
+// Returns:
+//   - error: An error if the file cannot be parsed, signed or written
+//
+// Example usage:
+//
+//	err := sigtool.SignPE("app.exe", cert, key, &sigtool.SignOptions{
+//	    Intermediates: []*x509.Certificate{issuingCA},
+//	    ProgramName:   "My App",
+//	})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+func SignPE(filePath string, cert *x509.Certificate, key crypto.Signer, opts *SignOptions) error {
+	if cert == nil || key == nil {
+		return errors.New("a signer certificate and key are required")
+	}
+	return SignPEWith(filePath, NewSigner(key, cert), opts)
+}
+
+// AttachSignature embeds a pre-built Authenticode PKCS#7 signature, such as
+// one produced by an external signing service, into a PE file, replacing any
+// existing signature.
+//
+// The image is padded with zeros to an 8-byte boundary, the signature is
+// appended as a WIN_CERTIFICATE entry, the security directory is pointed at
+// it and the image checksum is updated. The signature must be Authenticode
+// SignedData, but it is not checked against the file: its digest must cover
+// the padded image, which for images whose size is already a multiple of 8
+// bytes is the ComputeAuthentihash of the unsigned file. Run Verify
+// afterwards to confirm the result.
+//
+// Parameters:
+//   - filePath: The path to the PE file
+//   - signature: The DER-encoded PKCS#7 signature
+//
+// Returns:
+//   - error: An error if the signature is not Authenticode or the file cannot
+//     be parsed or written
+//
+// Example usage:
+//
+//	digest, _ := sigtool.ComputeAuthentihash("app.exe", crypto.SHA256)
+//	signature := signingService.Sign(digest)
+//	if err := sigtool.AttachSignature("app.exe", signature); err != nil {
+//	    log.Fatal(err)
+//	}
+func AttachSignature(filePath string, signature []byte) error {
+	if _, _, err := parseStoredDigest(signature); err != nil {
+		return fmt.Errorf("invalid Authenticode signature: %w", err)
+	}
+	return rewriteCertificateTable(filePath, func([]byte, *peLayout) ([]byte, error) {
+		return signature, nil
+	})
+}
+
+// signAuthenticode returns a PKCS#7 SignedData signature by key over the
+// Authenticode digest of a PE image
+func signAuthenticode(digest []byte, h crypto.Hash, key Signer, opts *SignOptions) ([]byte, error) {
+	chain, err := key.Certificates()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get signer certificates: %w", err)
+	}
+	if len(chain) == 0 || chain[0] == nil {
+		return nil, errors.New("signer provides no certificate")
+	}
+	cert := chain[0]
+	for _, c := range opts.Intermediates {
+		if !containsCertificate(chain, c) {
+			chain = append(chain, c)
+		}
+	}
+	if pub, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(cert.PublicKey) {
+		return nil, errors.New("signer certificate does not match the signing key")
+	}
+	digestOID, err := oidForHash(h)
+	if err != nil {
+		return nil, err
+	}
+	encryptionAlg, err := signatureAlgorithm(key, h)
+	if err != nil {
+		return nil, err
+	}
+	algID := pkix.AlgorithmIdentifier{Algorithm: digestOID, Parameters: asn1.NullRawValue}
+
+	imageData, err := spcPEImageData()
+	if err != nil {
+		return nil, err
+	}
+	idc, err := asn1.Marshal(spcIndirectDataContent{
+		Data:          spcAttributeTypeAndOptionalValue{Type: oidSpcPEImageData, Value: asn1.RawValue{FullBytes: imageData}},
+		MessageDigest: digestInfo{DigestAlgorithm: algID, Digest: digest},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode SpcIndirectDataContent: %w", err)
+	}
+
+	// The messageDigest attribute covers the content without its SEQUENCE header
+	var idcValue asn1.RawValue
+	if _, err := asn1.Unmarshal(idc, &idcValue); err != nil {
+		return nil, fmt.Errorf("failed to encode SpcIndirectDataContent: %w", err)
+	}
+	contentHash := h.New()
+	contentHash.Write(idcValue.Bytes)
+
+	attrs, err := authenticodeAttributes(contentHash.Sum(nil), opts)
+	if err != nil {
+		return nil, err
+	}
+	signedAttrs, err := asn1.Marshal(struct {
+		A []attribute `asn1:"set"`
+	}{A: attrs})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode authenticated attributes: %w", err)
+	}
+	var attrSet asn1.RawValue
+	if _, err := asn1.Unmarshal(signedAttrs, &attrSet); err != nil {
+		return nil, fmt.Errorf("failed to encode authenticated attributes: %w", err)
+	}
+	attrHash := h.New()
+	attrHash.Write(attrSet.Bytes)
+	encryptedDigest, err := key.Sign(rand.Reader, attrHash.Sum(nil), h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	var unsignedAttrs []attribute
+	if opts.Timestamp != nil {
+		token, err := RequestTimestamp(context.Background(), encryptedDigest, opts.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		unsignedAttrs = append(unsignedAttrs, attribute{
+			Type:  oidRFC3161Timestamp,
+			Value: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: token},
+		})
+	}
+
+	var certs []byte
+	for _, c := range chain {
+		certs = append(certs, c.Raw...)
+	}
+	return encodeSignedData(&signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{algID},
+		ContentInfo: contentInfo{
+			ContentType: oidSpcIndirectDataContent,
+			Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: idc},
+		},
+		Certificates: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs},
+		SignerInfos: []signerInfo{{
+			Version: 1,
+			IssuerAndSerialNumber: issuerAndSerial{
+				IssuerName:   asn1.RawValue{FullBytes: cert.RawIssuer},
+				SerialNumber: cert.SerialNumber,
+			},
+			DigestAlgorithm:           algID,
+			AuthenticatedAttributes:   attrs,
+			DigestEncryptionAlgorithm: encryptionAlg,
+			EncryptedDigest:           encryptedDigest,
+			UnauthenticatedAttributes: unsignedAttrs,
+		}},
+	})
+}
+
+// authenticodeAttributes returns the authenticated attributes of an
+// Authenticode signature in DER SET OF order, so that the stored attributes
+// match the encoding that was signed
+func authenticodeAttributes(contentDigest []byte, opts *SignOptions) ([]attribute, error) {
+	statement, err := asn1.Marshal([]asn1.ObjectIdentifier{oidSpcIndividualSPKey})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode SpcStatementType: %w", err)
+	}
+	values := []struct {
+		oid   asn1.ObjectIdentifier
+		value interface{}
+	}{
+		{oidAttributeContentType, oidSpcIndirectDataContent},
+		{oidAttributeMessageDigest, contentDigest},
+		{oidSpcStatementType, asn1.RawValue{FullBytes: statement}},
+		{oidSpcSpOpusInfo, asn1.RawValue{FullBytes: encodeSpcSpOpusInfo(opts.ProgramName, opts.MoreInfoURL)}},
+	}
+
+	attrs := make([]attribute, 0, len(values))
+	encoded := make([][]byte, len(values))
+	for i, v := range values {
+		der, err := asn1.Marshal(v.value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode attribute %s: %w", v.oid, err)
+		}
+		attr := attribute{Type: v.oid, Value: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: der}}
+		if encoded[i], err = asn1.Marshal(attr); err != nil {
+			return nil, fmt.Errorf("failed to encode attribute %s: %w", v.oid, err)
+		}
+		attrs = append(attrs, attr)
+	}
+
+	order := make([]int, len(attrs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return bytes.Compare(encoded[order[a]], encoded[order[b]]) < 0 })
+	sorted := make([]attribute, len(attrs))
+	for i, idx := range order {
+		sorted[i] = attrs[idx]
+	}
+	return sorted, nil
+}
+
+// encodeSpcSpOpusInfo encodes an SpcSpOpusInfo value, the inverse of
+// parseSpcSpOpusInfo. Empty fields are omitted.
+func encodeSpcSpOpusInfo(programName, moreInfo string) []byte {
+	var fields []byte
+	if programName != "" {
+		name := derValue(asn1.ClassContextSpecific, 0, false, bmpString(programName))
+		fields = append(fields, derValue(asn1.ClassContextSpecific, 0, true, name)...)
+	}
+	if moreInfo != "" {
+		link := derValue(asn1.ClassContextSpecific, 0, false, []byte(moreInfo))
+		fields = append(fields, derValue(asn1.ClassContextSpecific, 1, true, link)...)
+	}
+	return derValue(asn1.ClassUniversal, asn1.TagSequence, true, fields)
+}
+
+// spcPEImageData encodes the SpcPeImageData value signing tools emit:
+//
+//	SpcPeImageData ::= SEQUENCE {
+//	    flags BIT STRING,
+//	    file  [0] EXPLICIT SpcLink }
+//
+// with empty flags and the file link set to the "<<<Obsolete>>>" file name.
+func spcPEImageData() ([]byte, error) {
+	flags, err := asn1.Marshal(asn1.BitString{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode SpcPeImageData: %w", err)
+	}
+	name := derValue(asn1.ClassContextSpecific, 0, false, bmpString(spcPEImageDataObsolete))
+	file := derValue(asn1.ClassContextSpecific, 2, true, name)
+	link := derValue(asn1.ClassContextSpecific, 0, true, file)
+	return derValue(asn1.ClassUniversal, asn1.TagSequence, true, append(flags, link...)), nil
+}
+
+// derValue encodes a TLV with the given class, tag and content
+func derValue(class, tag int, compound bool, content []byte) []byte {
+	der, _ := asn1.Marshal(asn1.RawValue{Class: class, Tag: tag, IsCompound: compound, Bytes: content})
+	return der
+}
+
+// bmpString returns s as big-endian UTF-16, the content of a BMPString
+func bmpString(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	out := make([]byte, 0, 2*len(units))
+	for _, u := range units {
+		out = append(out, byte(u>>8), byte(u))
+	}
+	return out
+}
+
+// oidForHash returns the digest algorithm identifier of h
+func oidForHash(h crypto.Hash) (asn1.ObjectIdentifier, error) {
+	switch h {
+	case crypto.SHA1:
+		return oidDigestSHA1, nil
+	case crypto.SHA256:
+		return oidDigestSHA256, nil
+	case crypto.SHA384:
+		return oidDigestSHA384, nil
+	case crypto.SHA512:
+		return oidDigestSHA512, nil
+	}
+	return nil, fmt.Errorf("unsupported signing hash %s", h)
+}
+
+// signatureAlgorithm returns the SignerInfo digestEncryptionAlgorithm for
+// signatures by key with h
+func signatureAlgorithm(key crypto.Signer, h crypto.Hash) (pkix.AlgorithmIdentifier, error) {
+	switch key.Public().(type) {
+	case *rsa.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: oidSignatureRSA, Parameters: asn1.NullRawValue}, nil
+	case *ecdsa.PublicKey:
+		switch h {
+		case crypto.SHA1:
+			return pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSASHA1}, nil
+		case crypto.SHA256:
+			return pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSASHA256}, nil
+		case crypto.SHA384:
+			return pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSASHA384}, nil
+		case crypto.SHA512:
+			return pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSASHA512}, nil
+		}
+	}
+	return pkix.AlgorithmIdentifier{}, fmt.Errorf("unsupported signing key type %T with %s", key.Public(), h)
+}
@@ -0,0 +1,241 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeUnsignedPEForTest writes an unsigned mock PE image with payload
+func writeUnsignedPEForTest(t *testing.T, payload []byte) string {
+	t.Helper()
+
+	filePath := filepath.Join(t.TempDir(), "app.exe")
+	if err := os.WriteFile(filePath, mockPEImage(payload), 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	return filePath
+}
+
+func TestSignPE(t *testing.T) {
+	root := issueCertificateForTest(t, testCATemplate("sign root", 1), nil)
+	intermediate := issueCertificateForTest(t, testCATemplate("sign intermediate", 2), root)
+	leaf := issueCertificateForTest(t, testLeafTemplate("sign signer", 3, x509.ExtKeyUsageCodeSigning), intermediate)
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Cert)
+
+	// An odd payload exercises the padding of the image before the table
+	filePath := writeUnsignedPEForTest(t, []byte("unaligned payload"))
+	err := SignPE(filePath, leaf.Cert, leaf.Key, &SignOptions{
+		Intermediates: leaf.Chain,
+		ProgramName:   "Test Tool™",
+		MoreInfoURL:   "https://example.com/tool",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if err := Verify(filePath, &VerifyOptions{Roots: roots, RequireCodeSigning: true}); err != nil {
+		t.Errorf("Expected signed file to verify, got: %v", err)
+	}
+	bundle, err := ExtractWithDigests(filePath)
+	if err != nil || !bundle.DigestMatch || bundle.StoredAlgorithm != crypto.SHA256 {
+		t.Fatalf("Expected matching SHA-256 digest, got %+v (%v)", bundle, err)
+	}
+	info, err := Inspect(filePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if info.ProgramName != "Test Tool™" || info.MoreInfoURL != "https://example.com/tool" {
+		t.Errorf("Expected SpcSpOpusInfo to round-trip, got %q and %q", info.ProgramName, info.MoreInfoURL)
+	}
+	signer, err := SignerCertificate(filePath)
+	if err != nil || !signer.Equal(leaf.Cert) {
+		t.Errorf("Expected the leaf as signer certificate, got %v (%v)", signer, err)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read signed file: %v", err)
+	}
+	if got, want := binary.LittleEndian.Uint32(data[mockChecksumOffset:]), peChecksum(data, mockChecksumOffset); got != want || got == 0 {
+		t.Errorf("Expected checksum %#x, got %#x", want, got)
+	}
+	if offset := binary.LittleEndian.Uint32(data[mockSecDirOffset:]); offset%8 != 0 {
+		t.Errorf("Expected an 8-byte aligned certificate table, got offset %d", offset)
+	}
+}
+
+func TestSignPE_ReplacesSignature(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+	before, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+
+	id := issueCertificateForTest(t, testLeafTemplate("replacement signer", 7, x509.ExtKeyUsageCodeSigning), nil)
+	if err := SignPE(filePath, id.Cert, id.Key, &SignOptions{Hash: crypto.SHA1}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	entries, err := ExtractAllCertificates(filePath)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Expected a single certificate table entry, got %d (%v)", len(entries), err)
+	}
+	report, err := ReportDigestAlgorithms(filePath)
+	if err != nil || !report.SHA1Only() || report.DualSigned() {
+		t.Errorf("Expected a single SHA-1 signature, got %v (%v)", report, err)
+	}
+	signer, err := SignerCertificate(filePath)
+	if err != nil || !signer.Equal(id.Cert) {
+		t.Errorf("Expected the replacement signer, got %v (%v)", signer, err)
+	}
+	if err := IsValidDigitalSignature(filePath); err != nil {
+		t.Errorf("Expected re-signed file to be valid, got: %v", err)
+	}
+
+	// The image preceding the certificate table is unchanged apart from
+	// the checksum and security directory
+	after, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if !bytes.Equal(mockAuthentihash(before[:binary.LittleEndian.Uint32(before[mockSecDirOffset:])], crypto.SHA256),
+		mockAuthentihash(after[:binary.LittleEndian.Uint32(after[mockSecDirOffset:])], crypto.SHA256)) {
+		t.Error("Expected re-signing to preserve the image contents")
+	}
+}
+
+func TestSignPE_ECDSA(t *testing.T) {
+	root := issueCertificateForTest(t, testCATemplate("ecdsa root", 1), nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Cert)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := testLeafTemplate("ecdsa signer", 2, x509.ExtKeyUsageCodeSigning)
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, template, root.Cert, &key.PublicKey, root.Key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+
+	for _, h := range []crypto.Hash{crypto.SHA256, crypto.SHA384} {
+		filePath := writeUnsignedPEForTest(t, bytes.Repeat([]byte("ecdsa"), 20))
+		if err := SignPE(filePath, cert, key, &SignOptions{Hash: h}); err != nil {
+			t.Fatalf("%s: expected no error, got: %v", h, err)
+		}
+		if err := Verify(filePath, &VerifyOptions{Roots: roots}); err != nil {
+			t.Errorf("%s: expected ECDSA signature to verify, got: %v", h, err)
+		}
+	}
+}
+
+func TestSignPE_Errors(t *testing.T) {
+	id := issueCertificateForTest(t, testLeafTemplate("signer", 1, x509.ExtKeyUsageCodeSigning), nil)
+	other := issueCertificateForTest(t, testLeafTemplate("other", 2, x509.ExtKeyUsageCodeSigning), nil)
+	filePath := writeUnsignedPEForTest(t, []byte("payload"))
+
+	if err := SignPE(filePath, id.Cert, other.Key, nil); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("Expected key mismatch error, got: %v", err)
+	}
+	if err := SignPE(filePath, id.Cert, id.Key, &SignOptions{Hash: crypto.MD5}); err == nil || !strings.Contains(err.Error(), "unsupported signing hash") {
+		t.Errorf("Expected unsupported hash error, got: %v", err)
+	}
+	if _, err := ExtractDigitalSignature(filePath); err == nil {
+		t.Error("Expected failed signing to leave the file unsigned")
+	}
+
+	notPE := filepath.Join(t.TempDir(), "notpe.exe")
+	if err := os.WriteFile(notPE, []byte("not a PE file"), 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if err := SignPE(notPE, id.Cert, id.Key, nil); err == nil {
+		t.Error("Expected error for a non-PE file, got nil")
+	}
+	if err := SignPE(filepath.Join(t.TempDir(), "missing.exe"), id.Cert, id.Key, nil); err == nil {
+		t.Error("Expected error for a missing file, got nil")
+	}
+}
+
+func TestPEChecksum(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		offset int64
+		want   uint32
+	}{
+		{"words", []byte{1, 0, 2, 0}, 100, 3 + 4},
+		{"odd length", []byte{1, 0, 2}, 100, 3 + 3},
+		{"checksum field skipped", []byte{1, 0, 0xff, 0xff, 0xff, 0xff, 2, 0}, 2, 3 + 8},
+		{"carry folded", []byte{0xff, 0xff, 2, 0}, 100, 2 + 4},
+	}
+	for _, tt := range tests {
+		if got := peChecksum(tt.data, tt.offset); got != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestAttachSignature(t *testing.T) {
+	payload := bytes.Repeat([]byte("sigtool-section-data"), 16)
+	image := mockPEImage(payload)
+	filePath := writeUnsignedPEForTest(t, payload)
+
+	digest, err := ComputeAuthentihash(filePath, crypto.SHA256)
+	if err != nil {
+		t.Fatalf("Failed to compute authentihash: %v", err)
+	}
+	if !bytes.Equal(digest, mockAuthentihash(image, crypto.SHA256)) {
+		t.Fatal("Expected ComputeAuthentihash to match the mock image digest")
+	}
+	signature := signAuthenticodeForTest(t, digest, crypto.SHA256)
+	if err := AttachSignature(filePath, signature); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// The extracted blob includes the alignment padding of the entry
+	extracted, err := ExtractDigitalSignature(filePath)
+	if err != nil || !bytes.HasPrefix(extracted, signature) || len(extracted)-len(signature) >= 8 {
+		t.Fatalf("Expected the attached signature to be extracted, got %d bytes (%v)", len(extracted), err)
+	}
+	if err := IsValidDigitalSignature(filePath); err != nil {
+		t.Errorf("Expected attached signature to be valid, got: %v", err)
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if got, want := binary.LittleEndian.Uint32(data[mockChecksumOffset:]), peChecksum(data, mockChecksumOffset); got != want {
+		t.Errorf("Expected checksum %#x, got %#x", want, got)
+	}
+	if size := binary.LittleEndian.Uint32(data[mockSecDirOffset+4:]); size%8 != 0 || int(size) != len(data)-len(image) {
+		t.Errorf("Expected an aligned certificate table at the end of the file, got size %d", size)
+	}
+}
+
+func TestAttachSignature_Invalid(t *testing.T) {
+	filePath := writeUnsignedPEForTest(t, []byte("payload"))
+	if err := AttachSignature(filePath, []byte("not a signature")); err == nil || !strings.Contains(err.Error(), "invalid Authenticode signature") {
+		t.Errorf("Expected invalid signature error, got: %v", err)
+	}
+	if _, err := ExtractDigitalSignature(filePath); err == nil {
+		t.Error("Expected the file to stay unsigned")
+	}
+}
@@ -0,0 +1,87 @@
+package sigtool
+
+import (
+	"crypto/x509"
+	"fmt"
+
+	"go.mozilla.org/pkcs7"
+)
+
+// SignerCertificate returns the certificate that produced the signature of a
+// PE file.
+//
+// The PKCS#7 certificate bag routinely holds intermediates, cross-certificates
+// and timestamp authority certificates alongside the signer, in no particular
+// order. The signing certificate is the one whose issuer and serial number
+// match the SignerInfo of the primary signer.
+//
+// Parameters:
+//   - filePath: The path to the signed PE file
+//
+// Returns:
+//   - *x509.Certificate: The signing certificate
+//   - error: An error if the signature cannot be extracted or parsed, or
+//     ErrSignerCertificateNotFound if the signer certificate is not embedded
+//
+// Example usage:
+//
+//	cert, err := sigtool.SignerCertificate("signed.exe")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	fmt.Printf("Signed by %s\n", cert.Subject)
+func SignerCertificate(filePath string) (*x509.Certificate, error) {
+	signature, err := ExtractDigitalSignature(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract signature: %w", err)
+	}
+	return SignerCertificateFromSignature(signature)
+}
+
+// SignerCertificateFromSignature returns the signing certificate of a raw
+// PKCS#7 signature, as SignerCertificate does for a PE file. The signer of
+// an XML package signature is the KeyInfo certificate that issued no other.
+//
+// Parameters:
+//   - signature: The raw PKCS#7 or XML signature
+//
+// Returns:
+//   - *x509.Certificate: The signing certificate
+//   - error: An error if the signature cannot be parsed, or
+//     ErrSignerCertificateNotFound if the signer certificate is not embedded
+func SignerCertificateFromSignature(signature []byte) (*x509.Certificate, error) {
+	if isXMLSignature(signature) {
+		signer, _, err := xmlSignatureCertificates(signature)
+		return signer, err
+	}
+	p7, err := parsePKCS7(signature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS#7 signature: %w", err)
+	}
+	return signerCertificate(p7)
+}
+
+// signerCertificate returns the certificate of p7 matching the issuer and
+// serial number of its primary SignerInfo
+func signerCertificate(p7 *pkcs7.PKCS7) (*x509.Certificate, error) {
+	if len(p7.Signers) == 0 {
+		return nil, fmt.Errorf("%w: signature has no signers", ErrSignerCertificateNotFound)
+	}
+	ias := p7.Signers[0].IssuerAndSerialNumber
+	cert := findCertificate(p7, issuerAndSerial{IssuerName: ias.IssuerName, SerialNumber: ias.SerialNumber})
+	if cert == nil {
+		return nil, fmt.Errorf("%w: serial %x", ErrSignerCertificateNotFound, ias.SerialNumber)
+	}
+	return cert, nil
+}
+
+// parsePKCS7 parses a PKCS#7 signature like pkcs7.Parse, whose BER decoder
+// panics on some malformed lengths, returning an error instead
+func parsePKCS7(data []byte) (p7 *pkcs7.PKCS7, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			p7, err = nil, fmt.Errorf("malformed PKCS#7 data: %v", v)
+		}
+	}()
+	return pkcs7.Parse(data)
+}
@@ -0,0 +1,69 @@
+package sigtool
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestSignerCertificate(t *testing.T) {
+	root := issueCertificateForTest(t, testCATemplate("signer root", 1), nil)
+	intermediate := issueCertificateForTest(t, testCATemplate("signer intermediate", 2), root)
+	unrelated := issueCertificateForTest(t, testCATemplate("unrelated intermediate", 3), root)
+	leaf := issueCertificateForTest(t, testLeafTemplate("signer leaf", 4, x509.ExtKeyUsageCodeSigning), intermediate)
+	leaf.Chain = append([]*x509.Certificate{unrelated.Cert}, leaf.Chain...)
+	filePath := createSignedMockPEAs(t, leaf, crypto.SHA256, withRFC3161Timestamp(t, time.Now()))
+
+	cert, err := SignerCertificate(filePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !cert.Equal(leaf.Cert) {
+		t.Errorf("Expected signer %s, got %s", leaf.Cert.Subject, cert.Subject)
+	}
+}
+
+func TestSignerCertificate_NotEmbedded(t *testing.T) {
+	digest := mockAuthentihash(mockPEImage([]byte("payload")), crypto.SHA256)
+	signature := signAuthenticodeForTest(t, digest, crypto.SHA256, func(si *testSignerInfo) {
+		si.IssuerAndSerialNumber.SerialNumber = big.NewInt(424242)
+	})
+
+	if _, err := SignerCertificateFromSignature(signature); !errors.Is(err, ErrSignerCertificateNotFound) {
+		t.Errorf("Expected ErrSignerCertificateNotFound, got: %v", err)
+	}
+	if _, err := SignerCertificateFromSignature([]byte("invalid")); err == nil {
+		t.Error("Expected error for invalid PKCS#7, got nil")
+	}
+}
+
+func TestParsePKCS7_Malformed(t *testing.T) {
+	// Long-form lengths running past the end of the data make the BER
+	// decoder of go.mozilla.org/pkcs7 slice out of range
+	for _, data := range [][]byte{
+		{0x30, 0x82, 0x01},
+		{0x30, 0x84, 0x01, 0x00},
+		{0x30, 0x80, 0x30, 0x82, 0x01},
+	} {
+		if _, err := parsePKCS7(data); err == nil {
+			t.Errorf("% x: expected an error", data)
+		}
+		if err := VerifySignatureBytes(data); err == nil {
+			t.Errorf("% x: expected VerifySignatureBytes to fail", data)
+		}
+
+		filePath := createMockPEFile(t, true, data)
+		if _, err := Inspect(filePath); err == nil {
+			t.Errorf("% x: expected Inspect to fail", data)
+		}
+		if err := Verify(filePath, &VerifyOptions{}); err == nil {
+			t.Errorf("% x: expected Verify to fail", data)
+		}
+		if result := VerifyDetailed(filePath, nil); result.Valid() {
+			t.Errorf("% x: expected VerifyDetailed to fail", data)
+		}
+	}
+}
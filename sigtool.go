@@ -28,13 +28,14 @@
 package sigtool
 
 import (
+	"bytes"
 	"debug/pe"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strings"
-
-	"go.mozilla.org/pkcs7"
 )
 
 const (
@@ -48,13 +49,25 @@ const (
 //
 // This function parses the PE file structure and locates the security directory
 // containing the digital signature. It performs comprehensive validation including
-// bounds checking and file integrity verification.
+// bounds checking and file integrity verification. Windows Installer packages
+// (.msi, .msp) are recognized by their compound file header, and the signature
+// is read from their \x05DigitalSignature stream instead.
+//
+// The other file types of DetectFileType are recognised the same way, and
+// the signature returned depends on the type:
+//   - PE, MSI, CAB, MSIX, NuGet, script, VBA, Mach-O, DMG, PKG, kernel
+//     module and JAR files: a DER PKCS#7 SignedData
+//   - OPC packages: the XML-DSig signature part
+//   - RPM and Debian packages and AppImages: the OpenPGP signature, binary
+//     or ASCII-armored as the package stores it
+//   - APK files: the APK Signing Block, or the PKCS#7 signature block of the
+//     JAR signature of an APK without one
 //
 // Parameters:
 //   - filePath: The path to the PE file to extract the signature from
 //
 // Returns:
-//   - []byte: The raw PKCS#7 signature data
+//   - []byte: The raw signature data, PKCS#7 unless the file type says otherwise
 //   - error: An error if extraction fails for any reason
 //
 // Common errors include:
@@ -62,6 +75,7 @@ const (
 //   - Invalid PE file format
 //   - File is not digitally signed
 //   - Signature data is corrupted or extends beyond file bounds
+//   - The entry is not a PKCS#7 signature (see CertificateTypeError)
 //
 // Example usage:
 //
@@ -89,68 +103,268 @@ func ExtractDigitalSignature(filePath string) (buf []byte, err error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to get file info: %w", err)
 	}
-	fileSize := fileInfo.Size()
 
+	return extractSignature(f, fileInfo.Size())
+}
+
+// ExtractDigitalSignatureFromReader extracts the PKCS#7 digital signature from a
+// signed PE image accessible through an io.ReaderAt.
+//
+// This allows extraction from PE files held in memory, stored inside archives
+// or served by custom storage backends without writing a temporary file. It
+// performs the same validation and bounds checking as ExtractDigitalSignature.
+//
+// Parameters:
+//   - r: A reader providing random access to the PE image
+//   - size: The total size of the PE image in bytes
+//
+// Returns:
+//   - []byte: The raw PKCS#7 signature data
+//   - error: An error if extraction fails for any reason
+//
+// Example usage:
+//
+//	data, _ := os.ReadFile("signed.exe")
+//	signature, err := sigtool.ExtractDigitalSignatureFromReader(bytes.NewReader(data), int64(len(data)))
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+func ExtractDigitalSignatureFromReader(r io.ReaderAt, size int64) ([]byte, error) {
+	if r == nil {
+		return nil, errors.New("reader cannot be nil")
+	}
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid file size %d", size)
+	}
+
+	return extractSignature(r, size)
+}
+
+// peLayout records the file offsets of the PE structures that matter for
+// signature extraction and Authenticode hashing.
+type peLayout struct {
+	// size is the total size of the file in bytes
+	size int64
+	// checksumOffset is the offset of the CheckSum field of the optional header
+	checksumOffset int64
+	// securityDirOffset is the offset of the security data directory entry
+	securityDirOffset int64
+	// noSecurityDir is set when NumberOfRvaAndSizes is below five, so the
+	// image has no security directory entry and securityDirOffset points at
+	// whatever follows the data directories
+	noSecurityDir bool
+	// certTableOffset and certTableSize locate the certificate table
+	// (including the 8-byte WIN_CERTIFICATE header); both are zero for
+	// unsigned files
+	certTableOffset int64
+	certTableSize   int64
+}
+
+// extractSignature returns the PKCS#7 signature of the PE image, Windows
+// Installer package, cabinet, MSIX package, NuGet package, signed script,
+// Office VBA project, first Mach-O architecture, disk image, installer
+// package or kernel module r, the XML signature of the OPC package r, the
+// OpenPGP signature of the RPM or Debian package or AppImage r, the APK
+// Signing Block of the APK r or the first signature block of the JAR r
+func extractSignature(r io.ReaderAt, size int64) ([]byte, error) {
+	// Read errors are left to the PE parser to report
+	switch fileType, _ := detectFileType(r, size); fileType {
+	case FileTypeMSI:
+		return readMSISignature(r, size)
+	case FileTypeCAB:
+		return readCABSignature(r, size)
+	case FileTypeMSIX:
+		return readMSIXSignature(r, size)
+	case FileTypeNuGet:
+		return readNuGetSignature(r, size)
+	case FileTypeOPC:
+		return readOPCSignature(r, size)
+	case FileTypeVBScript, FileTypeJScript, FileTypeWSF:
+		return readScriptSignature(r, size)
+	case FileTypeVBA:
+		return readVBASignature(r, size)
+	case FileTypeMachO:
+		return readMachOSignature(r, size)
+	case FileTypeDMG:
+		return readDMGSignature(r, size)
+	case FileTypePKG:
+		return readPKGSignature(r, size)
+	case FileTypeKernelModule:
+		return readKernelModulePKCS7(r, size)
+	case FileTypeRPM:
+		return readRPMSignature(r, size)
+	case FileTypeDeb:
+		return readDebianSignature(r, size)
+	case FileTypeAPK:
+		return readAPKSignature(r, size)
+	case FileTypeJAR:
+		return readJARSignature(r, size)
+	case FileTypeAppImage:
+		return readAppImageSignature(r, size)
+	}
+
+	layout, err := readLayout(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	return readSignature(r, layout)
+}
+
+// readLayout parses the PE headers from r and locates the checksum field,
+// the security directory entry and the certificate table. Images that
+// debug/pe rejects are retried with the lenient header parser.
+func readLayout(r io.ReaderAt, fileSize int64) (*peLayout, error) {
+	return readPELayout(r, fileSize, false)
+}
+
+// readPELayout is readLayout, without the lenient fallback when strict is
+// set
+func readPELayout(r io.ReaderAt, fileSize int64, strict bool) (*peLayout, error) {
+	layout, err := readLayoutStrict(r, fileSize)
+	var formatErr *PEFormatError
+	if err == nil || strict || !errors.As(err, &formatErr) {
+		return layout, err
+	}
+	if lenient, lenientErr := readLayoutLenient(r, fileSize); lenientErr == nil {
+		return lenient, nil
+	}
+	return nil, err
+}
+
+// readLayoutStrict is readLayout for images debug/pe accepts
+func readLayoutStrict(r io.ReaderAt, fileSize int64) (*peLayout, error) {
 	// Parse PE file
-	pefile, err := pe.NewFile(f)
+	pefile, err := pe.NewFile(r)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse PE file: %w", err)
+		return nil, &PEFormatError{Err: err}
 	}
 	defer pefile.Close()
 
+	// The PE header offset lives at 0x3c in the DOS header; the optional
+	// header follows the 4-byte signature and the 20-byte COFF header.
+	var lfanew [4]byte
+	if _, err := r.ReadAt(lfanew[:], 0x3c); err != nil {
+		return nil, fmt.Errorf("failed to read PE header offset: %w", err)
+	}
+	optHeaderOffset := int64(binary.LittleEndian.Uint32(lfanew[:])) + 4 + 20
+
 	var vAddr uint32
 	var size uint32
+	var dataDirOffset int64
+	var dirCount uint32
 	switch t := pefile.OptionalHeader.(type) {
 	case *pe.OptionalHeader32:
+		dirCount = t.NumberOfRvaAndSizes
 		vAddr = t.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_SECURITY].VirtualAddress
 		size = t.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_SECURITY].Size
+		dataDirOffset = optHeaderOffset + 96
 	case *pe.OptionalHeader64:
+		dirCount = t.NumberOfRvaAndSizes
 		vAddr = t.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_SECURITY].VirtualAddress
 		size = t.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_SECURITY].Size
+		dataDirOffset = optHeaderOffset + 112
 	default:
-		return nil, errors.New("unsupported PE optional header type")
+		return nil, &PEFormatError{Err: errors.New("unsupported PE optional header type")}
 	}
 
+	layout := &peLayout{
+		size:              fileSize,
+		checksumOffset:    optHeaderOffset + 64,
+		securityDirOffset: dataDirOffset + pe.IMAGE_DIRECTORY_ENTRY_SECURITY*8,
+		noSecurityDir:     dirCount <= pe.IMAGE_DIRECTORY_ENTRY_SECURITY,
+	}
+	if layout.noSecurityDir || vAddr == 0 || size == 0 {
+		return layout, nil
+	}
+
+	layout.certTableOffset = int64(vAddr)
+	layout.certTableSize = int64(size)
+	return layout, nil
+}
+
+// readSignature reads the PKCS#7 blob out of the certificate table described
+// by layout, validating it against the file bounds.
+func readSignature(r io.ReaderAt, layout *peLayout) ([]byte, error) {
 	// Validate security directory
-	if vAddr == 0 || size == 0 {
-		return nil, errors.New("PE file is not digitally signed")
+	if layout.certTableOffset == 0 || layout.certTableSize == 0 {
+		return nil, ErrNotSigned
 	}
 
 	// Bounds checking
-	if size > MaxSignatureSize {
-		return nil, fmt.Errorf("signature size %d exceeds maximum allowed size %d", size, MaxSignatureSize)
+	if layout.certTableSize > MaxSignatureSize {
+		return nil, &SignatureSizeError{Size: layout.certTableSize, Limit: MaxSignatureSize}
+	}
+
+	if layout.certTableSize <= SecurityDirHeaderSize {
+		return nil, &SignatureBoundsError{
+			Offset:   layout.certTableOffset,
+			Length:   layout.certTableSize,
+			FileSize: layout.size,
+			Reason:   fmt.Sprintf("certificate table of %d bytes holds no signature data", layout.certTableSize),
+		}
 	}
 
 	// Calculate actual signature data size (excluding 8-byte header)
-	signatureDataSize := size - SecurityDirHeaderSize
-	signatureOffset := int64(vAddr + SecurityDirHeaderSize)
+	signatureDataSize := layout.certTableSize - SecurityDirHeaderSize
+	signatureOffset := layout.certTableOffset + SecurityDirHeaderSize
 
-	if signatureOffset < 0 || signatureOffset >= fileSize {
-		return nil, fmt.Errorf("invalid signature offset %d in file of size %d", signatureOffset, fileSize)
+	if signatureOffset < 0 || signatureOffset >= layout.size {
+		return nil, &SignatureBoundsError{
+			Offset:   signatureOffset,
+			Length:   signatureDataSize,
+			FileSize: layout.size,
+			Reason:   fmt.Sprintf("invalid signature offset %d in file of size %d", signatureOffset, layout.size),
+		}
 	}
 
-	if signatureOffset+int64(signatureDataSize) > fileSize {
-		return nil, fmt.Errorf("signature extends beyond file bounds")
+	if signatureOffset+signatureDataSize > layout.size {
+		return nil, &SignatureBoundsError{
+			Offset:   signatureOffset,
+			Length:   signatureDataSize,
+			FileSize: layout.size,
+			Reason:   "signature extends beyond file bounds",
+		}
+	}
+
+	var header [SecurityDirHeaderSize]byte
+	if _, err := r.ReadAt(header[:], layout.certTableOffset); err != nil {
+		return nil, fmt.Errorf("failed to read WIN_CERTIFICATE header: %w", err)
 	}
 
 	// Read signature data (excluding the 8-byte security directory header)
-	buf = make([]byte, signatureDataSize)
-	n, err := f.ReadAt(buf, signatureOffset)
-	if err != nil {
+	buf := make([]byte, signatureDataSize)
+	n, err := r.ReadAt(buf, signatureOffset)
+	if err != nil && !errors.Is(err, io.EOF) {
 		return nil, fmt.Errorf("failed to read signature data: %w", err)
 	}
 	if n != int(signatureDataSize) {
-		return nil, fmt.Errorf("incomplete read: expected %d bytes, got %d", signatureDataSize, n)
+		return nil, &SignatureBoundsError{
+			Offset:   signatureOffset,
+			Length:   signatureDataSize,
+			FileSize: layout.size,
+			Reason:   fmt.Sprintf("incomplete read: expected %d bytes, got %d", signatureDataSize, n),
+		}
+	}
+
+	if certType := binary.LittleEndian.Uint16(header[6:]); certType != WinCertTypePKCSSignedData {
+		return nil, &CertificateTypeError{
+			Type:     certType,
+			Revision: binary.LittleEndian.Uint16(header[4:]),
+			Data:     buf,
+		}
 	}
 
 	return buf, nil
 }
 
-// IsValidDigitalSignature validates the digital signature of a PE file using PKCS#7 verification.
+// IsValidDigitalSignature validates the digital signature of a PE file using Authenticode verification.
 //
-// This function extracts the signature from the PE file and performs cryptographic
-// verification including certificate chain validation. Note that validation may fail
-// even for properly formatted signatures due to certificate trust issues.
+// This function extracts the signature from the PE file, recomputes the Authenticode
+// digest of the file contents and compares it with the digest recorded in the signature,
+// then performs PKCS#7 verification of the signer. A signature copied from another
+// binary, or a file modified after signing, fails with ErrDigestMismatch. Note that
+// validation may fail even for properly formatted signatures due to certificate trust issues.
 //
 // Parameters:
 //   - filePath: The path to the PE file to validate
@@ -159,6 +373,7 @@ func ExtractDigitalSignature(filePath string) (buf []byte, err error) {
 //   - error: nil if the signature is valid, otherwise an error describing the validation failure
 //
 // Common validation failures:
+//   - File contents do not match the signed digest
 //   - Expired certificates
 //   - Missing or untrusted root certificates
 //   - Revoked certificates
@@ -179,19 +394,61 @@ func IsValidDigitalSignature(filePath string) (err error) {
 		return errors.New("file path cannot be empty")
 	}
 
-	peExtract, err := ExtractDigitalSignature(filePath)
+	// #nosec G304 - This tool is designed to read user-specified PE files
+	f, err := os.Open(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to extract signature: %w", err)
+		return fmt.Errorf("failed to extract signature: failed to open file %q: %w", filePath, err)
 	}
+	defer f.Close()
 
-	pc, err := pkcs7.Parse(peExtract)
+	fileInfo, err := f.Stat()
 	if err != nil {
-		return fmt.Errorf("failed to parse PKCS#7 signature: %w", err)
+		return fmt.Errorf("failed to extract signature: failed to get file info: %w", err)
 	}
 
-	if err := pc.Verify(); err != nil {
-		return fmt.Errorf("signature verification failed: %w", err)
+	return verifyAuthenticode(f, fileInfo.Size(), VerifyOptions{})
+}
+
+// ExtractDigitalSignatureFromBytes extracts the PKCS#7 digital signature from a
+// PE image that is already held in memory, such as a file downloaded over the
+// network.
+//
+// Parameters:
+//   - data: The complete contents of the PE file
+//
+// Returns:
+//   - []byte: The raw PKCS#7 signature data
+//   - error: An error if extraction fails for any reason
+func ExtractDigitalSignatureFromBytes(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, errors.New("file data cannot be empty")
+	}
+
+	return ExtractDigitalSignatureFromReader(bytes.NewReader(data), int64(len(data)))
+}
+
+// VerifySignatureBytes validates a raw PKCS#7 signature, such as one returned by
+// ExtractDigitalSignature, using PKCS#7 verification.
+//
+// Only the PKCS#7 structure and the signer's signature over its
+// authenticated attributes are checked. Without the signed file there is no
+// content digest check, so unlike IsValidDigitalSignature a signature
+// copied onto another file still verifies.
+//
+// Parameters:
+//   - signature: The raw PKCS#7 signature data
+//
+// Returns:
+//   - error: nil if the signature is valid, otherwise an error describing the validation failure
+func VerifySignatureBytes(signature []byte) error {
+	if len(signature) == 0 {
+		return errors.New("signature data cannot be empty")
+	}
+
+	pc, err := parsePKCS7(signature)
+	if err != nil {
+		return fmt.Errorf("failed to parse PKCS#7 signature: %w", err)
 	}
 
-	return nil
+	return verifySignerSignature(pc)
 }
@@ -1,7 +1,12 @@
 package sigtool
 
 import (
+	"bytes"
+	"crypto"
+	"debug/macho"
 	"encoding/binary"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -155,6 +160,73 @@ func TestExtractDigitalSignature_LargeSignature(t *testing.T) {
 	}
 }
 
+func TestExtractDigitalSignatureFromReader_ValidSignedPE(t *testing.T) {
+	signatureData := []byte("mock-pkcs7-signature-data")
+	content, err := os.ReadFile(createMockPEFile(t, true, signatureData))
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	result, err := ExtractDigitalSignatureFromReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if string(result) != string(signatureData) {
+		t.Errorf("Expected signature data %q, got %q", signatureData, result)
+	}
+}
+
+func TestExtractDigitalSignatureFromReader_InvalidInput(t *testing.T) {
+	if _, err := ExtractDigitalSignatureFromReader(nil, 100); err == nil {
+		t.Error("Expected error for nil reader, got nil")
+	}
+
+	if _, err := ExtractDigitalSignatureFromReader(bytes.NewReader(nil), 0); err == nil {
+		t.Error("Expected error for zero size, got nil")
+	}
+
+	content, err := os.ReadFile(createMockPEFile(t, false, nil))
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	_, err = ExtractDigitalSignatureFromReader(bytes.NewReader(content), int64(len(content)))
+	if err == nil || !strings.Contains(err.Error(), "not digitally signed") {
+		t.Errorf("Expected 'not digitally signed' error, got: %v", err)
+	}
+}
+
+func TestExtractDigitalSignatureFromBytes(t *testing.T) {
+	signatureData := []byte("mock-pkcs7-signature-data")
+	content, err := os.ReadFile(createMockPEFile(t, true, signatureData))
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	result, err := ExtractDigitalSignatureFromBytes(content)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if string(result) != string(signatureData) {
+		t.Errorf("Expected signature data %q, got %q", signatureData, result)
+	}
+
+	if _, err := ExtractDigitalSignatureFromBytes(nil); err == nil || !strings.Contains(err.Error(), "cannot be empty") {
+		t.Errorf("Expected 'cannot be empty' error, got: %v", err)
+	}
+}
+
+func TestVerifySignatureBytes_InvalidSignature(t *testing.T) {
+	if err := VerifySignatureBytes(nil); err == nil || !strings.Contains(err.Error(), "cannot be empty") {
+		t.Errorf("Expected 'cannot be empty' error, got: %v", err)
+	}
+
+	err := VerifySignatureBytes([]byte("invalid-pkcs7-data"))
+	if err == nil || !strings.Contains(err.Error(), "failed to parse PKCS#7") {
+		t.Errorf("Expected 'failed to parse PKCS#7' error, got: %v", err)
+	}
+}
+
 func TestIsValidDigitalSignature_EmptyFilePath(t *testing.T) {
 	err := IsValidDigitalSignature("")
 	if err == nil {
@@ -269,3 +341,195 @@ func createMockPEFileForBench(b *testing.B, withSignature bool, signatureData []
 
 	return filePath
 }
+
+func TestFewDataDirectories(t *testing.T) {
+	tests := []struct {
+		name          string
+		count         uint32
+		optHeaderSize uint16
+	}{
+		{"no data directories", 0, 96},
+		{"four data directories", 4, 96 + 4*8},
+		// debug/pe rejects the inconsistent size; the lenient parser does not
+		{"four directories in a full header", 4, 224},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image := mockPEImage([]byte("payload"))
+			binary.LittleEndian.PutUint32(image[mockOptHeaderOffset+92:], tt.count)
+			binary.LittleEndian.PutUint16(image[84:], tt.optHeaderSize)
+			// Bytes where a security directory entry would be must not be
+			// read as one
+			binary.LittleEndian.PutUint32(image[mockSecDirOffset:], 8)
+			binary.LittleEndian.PutUint32(image[mockSecDirOffset+4:], 16)
+			filePath := filepath.Join(t.TempDir(), "dirs.exe")
+			if err := os.WriteFile(filePath, image, 0600); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			if _, err := ExtractDigitalSignature(filePath); !errors.Is(err, ErrNotSigned) {
+				t.Errorf("Expected ErrNotSigned from extraction, got: %v", err)
+			}
+			if err := Verify(filePath, nil); !errors.Is(err, ErrNotSigned) {
+				t.Errorf("Expected ErrNotSigned from verification, got: %v", err)
+			}
+
+			// Without a security directory only the checksum is excluded
+			digest, err := ComputeAuthentihash(filePath, crypto.SHA256)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			want := crypto.SHA256.New()
+			want.Write(image[:mockChecksumOffset])
+			want.Write(image[mockChecksumOffset+4:])
+			if !bytes.Equal(digest, want.Sum(nil)) {
+				t.Errorf("Expected the digest to cover the would-be security directory bytes")
+			}
+
+			leaf := issueCertificateForTest(t, testLeafTemplate("dirs signer", 2, 0), nil)
+			err = SignPE(filePath, leaf.Cert, leaf.Key, nil)
+			if err == nil || !strings.Contains(err.Error(), "no security directory") {
+				t.Errorf("Expected signing to fail without a security directory, got: %v", err)
+			}
+		})
+	}
+}
+
+// sparseReaderAt is a reader over a large image that is zero except for
+// the given chunks
+type sparseReaderAt struct {
+	size   int64
+	chunks map[int64][]byte
+}
+
+func (r *sparseReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	n := len(p)
+	if int64(n) > r.size-off {
+		n = int(r.size - off)
+	}
+	clear(p[:n])
+	for start, chunk := range r.chunks {
+		for i := range chunk {
+			if pos := start + int64(i) - off; pos >= 0 && pos < int64(n) {
+				p[pos] = chunk[i]
+			}
+		}
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// sparsePEForTest returns a sparse image of size bytes whose security
+// directory points at offset with length, holding table there
+func sparsePEForTest(size int64, offset, length uint32, table []byte) *sparseReaderAt {
+	header := mockPEImage(nil)
+	binary.LittleEndian.PutUint32(header[mockSecDirOffset:], offset)
+	binary.LittleEndian.PutUint32(header[mockSecDirOffset+4:], length)
+	return &sparseReaderAt{size: size, chunks: map[int64][]byte{0: header, int64(offset): table}}
+}
+
+func TestLargeFileOffsets(t *testing.T) {
+	const fourGiB = int64(1) << 32
+	entry := make([]byte, 16)
+	binary.LittleEndian.PutUint32(entry, 16)
+	binary.LittleEndian.PutUint16(entry[4:], WinCertRevision2_0)
+	binary.LittleEndian.PutUint16(entry[6:], WinCertTypePKCSSignedData)
+	copy(entry[8:], "sigdata!")
+
+	// A table just below the 4 GiB mark of a larger file
+	r := sparsePEForTest(fourGiB+1<<16, 0xffff0000, 16, entry)
+	signature, err := ExtractDigitalSignatureFromReader(r, r.size)
+	if err != nil || string(signature) != "sigdata!" {
+		t.Errorf("Expected the signature below 4 GiB, got %q (%v)", signature, err)
+	}
+	regions, err := findExtraData(r, r.size)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	last := regions[len(regions)-1]
+	if last.Kind != RegionAfterCertificateTable || last.Offset != 0xffff0010 || last.Offset+last.Size != r.size {
+		t.Errorf("Expected trailing data across the 4 GiB mark, got %+v", last)
+	}
+
+	// vAddr+size overflows uint32 but ends exactly at the end of the file
+	r = sparsePEForTest(fourGiB+8, 0xfffffff8, 16, entry)
+	if signature, err := ExtractDigitalSignatureFromReader(r, r.size); err != nil || string(signature) != "sigdata!" {
+		t.Errorf("Expected the signature crossing 4 GiB, got %q (%v)", signature, err)
+	}
+
+	// The same table in a file that ends at 4 GiB must not wrap around
+	r = sparsePEForTest(fourGiB, 0xfffffff8, 16, entry)
+	if _, err := ExtractDigitalSignatureFromReader(r, r.size); !errors.Is(err, ErrSignatureTruncated) {
+		t.Errorf("Expected ErrSignatureTruncated, got: %v", err)
+	}
+}
+
+func TestCertificateTableBoundaries(t *testing.T) {
+	image := mockPEImage(nil)
+	table := []byte("\x10\x00\x00\x00\x00\x02\x02\x00sigdata!")
+	tests := []struct {
+		name   string
+		offset uint32
+		length uint32
+		size   int
+		err    error
+	}{
+		{"ends at end of file", mockHeaderSize, 16, mockHeaderSize + 16, nil},
+		{"one byte beyond end of file", mockHeaderSize, 17, mockHeaderSize + 16, ErrSignatureTruncated},
+		{"starts at end of file", mockHeaderSize + 16, 8, mockHeaderSize + 16, ErrSignatureTruncated},
+		{"header only", mockHeaderSize, 8, mockHeaderSize + 16, ErrSignatureTruncated},
+		{"shorter than its header", mockHeaderSize, 4, mockHeaderSize + 16, ErrSignatureTruncated},
+		{"offset and size overflow uint32", 0xfffffff8, 0x100, mockHeaderSize + 16, ErrSignatureTruncated},
+	}
+	for _, tt := range tests {
+		data := make([]byte, tt.size)
+		copy(data, image)
+		copy(data[mockHeaderSize:], table)
+		binary.LittleEndian.PutUint32(data[mockSecDirOffset:], tt.offset)
+		binary.LittleEndian.PutUint32(data[mockSecDirOffset+4:], tt.length)
+
+		_, err := ExtractDigitalSignatureFromBytes(data)
+		if tt.err == nil && err != nil || tt.err != nil && !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v, got: %v", tt.name, tt.err, err)
+		}
+	}
+}
+
+// FuzzExtractSignature checks that extracting, inspecting and verifying the
+// signature of malformed files of every type returns an error rather than
+// panicking. The seeds are signed files of the types built without a
+// temporary directory.
+func FuzzExtractSignature(f *testing.F) {
+	image := mockPEImage([]byte("fuzz payload"))
+	f.Add(embedSignatureForTest(image, signAuthenticodeForTest(f, mockAuthentihash(image, crypto.SHA256), crypto.SHA256)))
+	f.Add(compoundFileForTest(msiEntriesForTest(signAuthenticodeForTest(f, []byte("msi digest"), crypto.SHA256), nil)))
+	f.Add(cabinetForTest([]byte("cabinet payload"), true, 64))
+	f.Add(vbaDocumentForTest(vbaSourceForTest, digSigBlobForTest(signAuthenticodeForTest(f, []byte("vba digest"), crypto.SHA1))))
+	f.Add(machoForTest(f, macho.CpuAmd64, []byte("code"), false))
+	disk, _ := dmgForTest(f, []byte("disk image data"), true, true)
+	f.Add(disk)
+	f.Add(xarForTest(f, xarSigningForTest{rsa: true, cms: true}))
+	f.Add(kernelModuleForTest(f, kernelKeyForTest(f, "fuzz module key", 1), []byte("\x7fELF module"), crypto.SHA256, false))
+	signer := pgpEntityForTest(f, "Fuzz", 1024)
+	f.Add(rpmPackageForTest(f, signer, []byte("rpm payload"), crypto.SHA256))
+	f.Add(appImageForTest(f, []byte("hsqs payload"), signer, signer))
+	f.Add(arArchiveForTest(append(debCoreMembersForTest, debMemberForTest{"_gpgorigin", pgpSignForTest(f, signer, []byte("deb"), crypto.SHA256)})...))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) == 0 {
+			return
+		}
+		r := bytes.NewReader(data)
+		if signature, err := extractSignature(r, int64(len(data))); err == nil {
+			_, _ = inspectSignature(signature)
+			_ = VerifySignatureBytes(signature)
+		}
+		_ = verifyAuthenticode(r, int64(len(data)), VerifyOptions{})
+		_, _ = extractWithDigests(r, int64(len(data)))
+	})
+}
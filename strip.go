@@ -0,0 +1,50 @@
+package sigtool
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+)
+
+// RemoveDigitalSignature removes the Authenticode signature from a PE file.
+//
+// The certificate table is deleted by truncating the file at its start, the
+// security data directory entry is zeroed and the image checksum is
+// recomputed. Stripping a file signed by a tool that did not pad the image
+// therefore yields the original unsigned binary, apart from the checksum,
+// which makes signed and unsigned builds directly comparable. The file is
+// replaced atomically.
+//
+// Parameters:
+//   - filePath: The path to the signed PE file
+//
+// Returns:
+//   - error: ErrNotSigned if the file has no signature, or an error if the
+//     file cannot be parsed or written
+//
+// Example usage:
+//
+//	if err := sigtool.RemoveDigitalSignature("app.exe"); err != nil && !errors.Is(err, sigtool.ErrNotSigned) {
+//	    log.Fatal(err)
+//	}
+func RemoveDigitalSignature(filePath string) error {
+	// #nosec G304
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	signed, err := readLayout(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	if signed.certTableOffset == 0 || signed.certTableSize == 0 {
+		return ErrNotSigned
+	}
+
+	image, layout, err := unsignedImage(data)
+	if err != nil {
+		return err
+	}
+	updateChecksum(image, layout)
+	return writeFileAtomic(filePath, image)
+}
@@ -0,0 +1,55 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestRemoveDigitalSignature(t *testing.T) {
+	payload := bytes.Repeat([]byte("sigtool-section-data"), 16)
+	image := mockPEImage(payload)
+	filePath, _ := createSignedMockPEWithPayload(t, crypto.SHA256, payload)
+
+	if err := RemoveDigitalSignature(filePath); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+
+	// Apart from the checksum the result is the original unsigned image
+	checksum := binary.LittleEndian.Uint32(data[mockChecksumOffset:])
+	if checksum != peChecksum(data, mockChecksumOffset) {
+		t.Errorf("Expected recomputed checksum, got %#x", checksum)
+	}
+	binary.LittleEndian.PutUint32(data[mockChecksumOffset:], 0)
+	if !bytes.Equal(data, image) {
+		t.Errorf("Expected the original %d-byte unsigned image, got %d bytes", len(image), len(data))
+	}
+	if _, err := ExtractDigitalSignature(filePath); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned after stripping, got: %v", err)
+	}
+
+	if err := RemoveDigitalSignature(filePath); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned for an unsigned file, got: %v", err)
+	}
+}
+
+func TestRemoveDigitalSignature_TrailingData(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+	f, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	_, _ = f.Write([]byte("overlay"))
+	f.Close()
+
+	if err := RemoveDigitalSignature(filePath); err == nil {
+		t.Error("Expected error for a certificate table followed by data, got nil")
+	}
+}
@@ -0,0 +1,379 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"go.mozilla.org/pkcs7"
+)
+
+var (
+	// PKCS#9 authenticated attributes
+	oidAttributeContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttributeMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttributeSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	// oidTimestampToken is the id-aa-timeStampToken unsigned attribute of
+	// RFC 3161, used by CMS signatures other than Authenticode
+	oidTimestampToken = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14}
+)
+
+// TimestampType identifies how a timestamp is attached to a signature.
+type TimestampType string
+
+const (
+	// TimestampRFC3161 is an RFC 3161 timestamp token in the Microsoft
+	// 1.3.6.1.4.1.311.3.3.1 unsigned attribute, or in the id-aa-timeStampToken
+	// attribute of a NuGet package signature
+	TimestampRFC3161 TimestampType = "RFC3161"
+	// TimestampCounterSignature is a legacy PKCS#9 countersignature
+	TimestampCounterSignature TimestampType = "CounterSignature"
+)
+
+// TimestampInfo describes the timestamp countersignature of a signature.
+type TimestampInfo struct {
+	// Type is the kind of timestamp
+	Type TimestampType
+	// Time is the time asserted by the timestamp authority
+	Time time.Time
+	// Signer is the timestamp authority certificate, when it is embedded
+	Signer *CertificateInfo `json:",omitempty"`
+}
+
+// attribute mirrors the PKCS#7 Attribute structure
+type attribute struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+type issuerAndSerial struct {
+	IssuerName   asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// signerInfo mirrors the PKCS#7 SignerInfo structure. It is used to decode the
+// countersignatures embedded as unauthenticated attributes.
+type signerInfo struct {
+	Version                   int `asn1:"default:1"`
+	IssuerAndSerialNumber     issuerAndSerial
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   []attribute `asn1:"optional,omitempty,tag:0"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+	UnauthenticatedAttributes []attribute `asn1:"optional,omitempty,tag:1"`
+}
+
+// tstInfo is the RFC 3161 TSTInfo structure signed by a timestamp authority
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time     `asn1:"generalized"`
+	Accuracy       tstAccuracy   `asn1:"optional"`
+	Ordering       bool          `asn1:"optional,default:false"`
+	Nonce          *big.Int      `asn1:"optional"`
+	TSA            asn1.RawValue `asn1:"optional,explicit,tag:0"`
+	Extensions     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type tstAccuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+// findAttribute returns the value bytes of the first attribute of type oid
+func findAttribute(attrs []attribute, oid asn1.ObjectIdentifier) ([]byte, bool) {
+	for _, attr := range attrs {
+		if attr.Type.Equal(oid) {
+			return attr.Value.Bytes, true
+		}
+	}
+	return nil, false
+}
+
+// unauthenticatedAttributes returns the unsigned attributes of the primary
+// signer of p7 in the local attribute representation.
+func unauthenticatedAttributes(p7 *pkcs7.PKCS7) []attribute {
+	if len(p7.Signers) == 0 {
+		return nil
+	}
+	src := p7.Signers[0].UnauthenticatedAttributes
+	attrs := make([]attribute, 0, len(src))
+	for _, attr := range src {
+		attrs = append(attrs, attribute{Type: attr.Type, Value: attr.Value})
+	}
+	return attrs
+}
+
+// authenticatedAttributes returns the signed attributes of the primary
+// signer of p7 in the local attribute representation.
+func authenticatedAttributes(p7 *pkcs7.PKCS7) []attribute {
+	if len(p7.Signers) == 0 {
+		return nil
+	}
+	src := p7.Signers[0].AuthenticatedAttributes
+	attrs := make([]attribute, 0, len(src))
+	for _, attr := range src {
+		attrs = append(attrs, attribute{Type: attr.Type, Value: attr.Value})
+	}
+	return attrs
+}
+
+// parseTimestamp decodes the timestamp countersignature of the primary
+// signer of p7. It returns nil without error when no timestamp is present.
+func parseTimestamp(p7 *pkcs7.PKCS7) (*TimestampInfo, error) {
+	attrs := unauthenticatedAttributes(p7)
+
+	value, ok := findAttribute(attrs, oidRFC3161Timestamp)
+	if !ok {
+		value, ok = findAttribute(attrs, oidTimestampToken)
+	}
+	if ok {
+		token, info, err := parseTimestampToken(value)
+		if err != nil {
+			return nil, err
+		}
+		ts := &TimestampInfo{Type: TimestampRFC3161, Time: info.GenTime}
+		if signer := token.GetOnlySigner(); signer != nil {
+			ts.Signer = newCertificateInfo(signer)
+		}
+		return ts, nil
+	}
+
+	if value, ok := findAttribute(attrs, oidCounterSignature); ok {
+		var cs signerInfo
+		if _, err := asn1.Unmarshal(value, &cs); err != nil {
+			return nil, fmt.Errorf("failed to parse countersignature: %w", err)
+		}
+		// The repository countersignature of a NuGet package is not a
+		// timestamp
+		if _, ok := findAttribute(cs.AuthenticatedAttributes, oidCommitmentTypeIndication); ok {
+			return nil, nil
+		}
+		signingTime, err := attributeSigningTime(cs.AuthenticatedAttributes)
+		if err != nil {
+			return nil, fmt.Errorf("countersignature has no signing time: %w", err)
+		}
+		ts := &TimestampInfo{Type: TimestampCounterSignature, Time: signingTime}
+		if signer := findCertificate(p7, cs.IssuerAndSerialNumber); signer != nil {
+			ts.Signer = newCertificateInfo(signer)
+		}
+		return ts, nil
+	}
+
+	return nil, nil
+}
+
+// parseTimestampToken decodes an RFC 3161 timestamp token and its TSTInfo
+func parseTimestampToken(value []byte) (*pkcs7.PKCS7, *tstInfo, error) {
+	token, err := parsePKCS7(value)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse RFC 3161 timestamp token: %w", err)
+	}
+	var info tstInfo
+	if _, err := asn1.Unmarshal(token.Content, &info); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse TSTInfo: %w", err)
+	}
+	return token, &info, nil
+}
+
+// verifyTimestamp verifies the timestamp countersignature of the primary
+// signer of p7 and returns it, or nil when the signature is not timestamped.
+//
+// The timestamp must be bound to the primary signer's encrypted digest and
+// its own signature must verify. When trust has roots the timestamp
+// authority certificate must also chain to them for time stamping at the
+// asserted time and pass the configured revocation checks.
+func verifyTimestamp(p7 *pkcs7.PKCS7, trust *trustConfig) (*TimestampInfo, error) {
+	if len(p7.Signers) == 0 {
+		return nil, nil
+	}
+	signed := p7.Signers[0].EncryptedDigest
+	attrs := unauthenticatedAttributes(p7)
+
+	if value, ok := findAttribute(attrs, oidRFC3161Timestamp); ok {
+		return verifyTimestampToken(value, signed, trust)
+	}
+	if value, ok := findAttribute(attrs, oidCounterSignature); ok {
+		return verifyCounterSignature(p7, value, signed, trust)
+	}
+	return nil, nil
+}
+
+// verifyTimestampAttribute verifies the RFC 3161 id-aa-timeStampToken among
+// the unsigned attributes of a CMS signature, such as a NuGet or JAR
+// signature, over signed, its signature value, and returns the asserted
+// time, or the zero time when it is not timestamped
+func verifyTimestampAttribute(unsigned []attribute, signed []byte, trust *trustConfig) (time.Time, error) {
+	value, ok := findAttribute(unsigned, oidTimestampToken)
+	if !ok {
+		return time.Time{}, nil
+	}
+	ts, err := verifyTimestampToken(value, signed, trust)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("timestamp verification failed: %w", err)
+	}
+	return ts.Time, nil
+}
+
+// verifyTimestampToken verifies an RFC 3161 timestamp token over signed
+func verifyTimestampToken(value, signed []byte, trust *trustConfig) (*TimestampInfo, error) {
+	token, info, err := parseTimestampToken(value)
+	if err != nil {
+		return nil, err
+	}
+	if err := token.Verify(); err != nil {
+		return nil, fmt.Errorf("timestamp token signature verification failed: %w", err)
+	}
+
+	algorithm, err := hashForOID(info.MessageImprint.HashAlgorithm.Algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported timestamp imprint algorithm: %w", err)
+	}
+	imprint := algorithm.New()
+	imprint.Write(signed)
+	if !bytes.Equal(imprint.Sum(nil), info.MessageImprint.HashedMessage) {
+		return nil, errors.New("timestamp message imprint does not match the signature")
+	}
+
+	tsa := token.GetOnlySigner()
+	if tsa == nil {
+		return nil, errors.New("timestamp token must have exactly one signer with an embedded certificate")
+	}
+	if err := verifyTimestampChain(tsa, trust, token.Certificates, info.GenTime); err != nil {
+		return nil, err
+	}
+
+	return &TimestampInfo{Type: TimestampRFC3161, Time: info.GenTime, Signer: newCertificateInfo(tsa)}, nil
+}
+
+// verifyCounterSignature verifies a legacy PKCS#9 countersignature over
+// signed. The countersigner certificate must be embedded in p7.
+func verifyCounterSignature(p7 *pkcs7.PKCS7, value, signed []byte, trust *trustConfig) (*TimestampInfo, error) {
+	var cs signerInfo
+	if _, err := asn1.Unmarshal(value, &cs); err != nil {
+		return nil, fmt.Errorf("failed to parse countersignature: %w", err)
+	}
+	signingTime, err := attributeSigningTime(cs.AuthenticatedAttributes)
+	if err != nil {
+		return nil, fmt.Errorf("countersignature has no signing time: %w", err)
+	}
+
+	signer, err := verifyCounterSigner(p7, &cs, signed)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyTimestampChain(signer, trust, p7.Certificates, signingTime); err != nil {
+		return nil, err
+	}
+
+	return &TimestampInfo{Type: TimestampCounterSignature, Time: signingTime, Signer: newCertificateInfo(signer)}, nil
+}
+
+// verifyCounterSigner checks that the countersignature cs is over signed
+// and that its authenticated attributes are signed by its signer, which must
+// be embedded in p7, and returns the signer certificate
+func verifyCounterSigner(p7 *pkcs7.PKCS7, cs *signerInfo, signed []byte) (*x509.Certificate, error) {
+	algorithm, err := hashForOID(cs.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported countersignature digest algorithm: %w", err)
+	}
+	var messageDigest []byte
+	if raw, ok := findAttribute(cs.AuthenticatedAttributes, oidAttributeMessageDigest); !ok {
+		return nil, errors.New("countersignature has no messageDigest attribute")
+	} else if _, err := asn1.Unmarshal(raw, &messageDigest); err != nil {
+		return nil, fmt.Errorf("failed to parse countersignature messageDigest: %w", err)
+	}
+	digest := algorithm.New()
+	digest.Write(signed)
+	if !bytes.Equal(digest.Sum(nil), messageDigest) {
+		return nil, errors.New("countersignature message digest does not match the signature")
+	}
+
+	signer := findCertificate(p7, cs.IssuerAndSerialNumber)
+	if signer == nil {
+		return nil, errors.New("countersignature signer certificate is not embedded in the signature")
+	}
+	encoded, err := asn1.Marshal(struct {
+		A []attribute `asn1:"set"`
+	}{A: cs.AuthenticatedAttributes})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode countersignature attributes: %w", err)
+	}
+	var attrs asn1.RawValue
+	if _, err := asn1.Unmarshal(encoded, &attrs); err != nil {
+		return nil, fmt.Errorf("failed to encode countersignature attributes: %w", err)
+	}
+	attrHash := algorithm.New()
+	attrHash.Write(attrs.Bytes)
+	if err := verifyDigestSignature(signer, algorithm, attrHash.Sum(nil), cs.EncryptedDigest); err != nil {
+		return nil, fmt.Errorf("countersignature verification failed: %w", err)
+	}
+	return signer, nil
+}
+
+// verifyDigestSignature checks sig over the precomputed digest with the
+// public key of cert. Legacy countersignatures are commonly SHA-1 based,
+// which x509.Certificate.CheckSignature rejects, so the key is used directly.
+func verifyDigestSignature(cert *x509.Certificate, algorithm crypto.Hash, digest, sig []byte) error {
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(pub, algorithm, digest, sig)
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, digest, sig) {
+			return errors.New("ECDSA signature is invalid")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported public key type %T", cert.PublicKey)
+	}
+}
+
+// verifyTimestampChain validates the timestamp authority certificate for
+// time stamping at the asserted time when trust has roots
+func verifyTimestampChain(tsa *x509.Certificate, trust *trustConfig, embedded []*x509.Certificate, at time.Time) error {
+	if trust.roots == nil {
+		return nil
+	}
+	chains, err := tsa.Verify(x509.VerifyOptions{
+		Roots:         trust.roots,
+		Intermediates: certificatePool(embedded, trust.intermediates),
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	})
+	if err != nil {
+		return fmt.Errorf("timestamp authority chain verification failed: %w", err)
+	}
+	if err := trust.checkRevocation(chains, at); err != nil {
+		return fmt.Errorf("timestamp authority: %w", err)
+	}
+	return nil
+}
+
+// attributeSigningTime decodes the PKCS#9 signingTime authenticated attribute
+func attributeSigningTime(attrs []attribute) (time.Time, error) {
+	value, ok := findAttribute(attrs, oidAttributeSigningTime)
+	if !ok {
+		return time.Time{}, errors.New("signingTime attribute not present")
+	}
+	var t time.Time
+	if _, err := asn1.Unmarshal(value, &t); err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse signingTime attribute: %w", err)
+	}
+	return t, nil
+}
@@ -0,0 +1,318 @@
+package sigtool
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	oidTSTInfo = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+
+	testTSAOnce sync.Once
+	testTSACert *x509.Certificate
+	testTSAKey  *rsa.PrivateKey
+)
+
+// testTSA returns a cached self-signed time stamping certificate and key
+func testTSA(t testing.TB) (*x509.Certificate, *rsa.PrivateKey) {
+	t.Helper()
+
+	testTSAOnce.Do(func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("Failed to generate key: %v", err)
+		}
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(2001),
+			Subject:               pkix.Name{CommonName: "sigtool test TSA", Organization: []string{"sigtool"}},
+			NotBefore:             time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+			NotAfter:              time.Now().Add(24 * time.Hour),
+			KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+			ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+			BasicConstraintsValid: true,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			t.Fatalf("Failed to create certificate: %v", err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatalf("Failed to parse certificate: %v", err)
+		}
+		testTSACert, testTSAKey = cert, key
+	})
+
+	if testTSACert == nil {
+		t.Fatal("Test TSA is unavailable")
+	}
+	return testTSACert, testTSAKey
+}
+
+type testTSTInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+	Nonce          *big.Int  `asn1:"optional"`
+}
+
+// timestampTokenForTest builds an RFC 3161 timestamp token from the test TSA
+// over imprint, asserting when
+func timestampTokenForTest(t testing.TB, imprint []byte, when time.Time) []byte {
+	t.Helper()
+
+	cert, key := testTSA(t)
+	return timestampTokenAsForTest(t, &testIdentity{Cert: cert, Key: key}, imprint, when)
+}
+
+// timestampTokenAsForTest is timestampTokenForTest signed by tsa, embedding
+// its chain
+func timestampTokenAsForTest(t testing.TB, tsa *testIdentity, imprint []byte, when time.Time) []byte {
+	t.Helper()
+
+	return timestampTokenWithNonceForTest(t, tsa, imprint, when, nil)
+}
+
+// timestampTokenWithNonceForTest is timestampTokenAsForTest answering a
+// request with nonce, which may be nil
+func timestampTokenWithNonceForTest(t testing.TB, tsa *testIdentity, imprint []byte, when time.Time, nonce *big.Int) []byte {
+	t.Helper()
+
+	cert, key := tsa.Cert, tsa.Key
+	certs := append([]byte(nil), cert.Raw...)
+	for _, c := range tsa.Chain {
+		certs = append(certs, c.Raw...)
+	}
+	algID := pkix.AlgorithmIdentifier{Algorithm: oidDigestSHA256, Parameters: asn1.NullRawValue}
+
+	info, err := asn1.Marshal(testTSTInfo{
+		Version:        1,
+		Policy:         asn1.ObjectIdentifier{1, 2, 3, 4},
+		MessageImprint: messageImprint{HashAlgorithm: algID, HashedMessage: imprint},
+		SerialNumber:   big.NewInt(42),
+		GenTime:        when.UTC(),
+		Nonce:          nonce,
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal TSTInfo: %v", err)
+	}
+	econtent, err := asn1.Marshal(info)
+	if err != nil {
+		t.Fatalf("Failed to marshal TSTInfo content: %v", err)
+	}
+
+	infoHash := crypto.SHA256.New()
+	infoHash.Write(info)
+	attrs := []testAttribute{
+		testAttr(t, oidAttributeContentType, oidTSTInfo),
+		testAttr(t, oidAttributeMessageDigest, infoHash.Sum(nil)),
+	}
+
+	sd, err := asn1.Marshal(testSignedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{algID},
+		ContentInfo: testContentInfo{
+			ContentType: oidTSTInfo,
+			Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: econtent},
+		},
+		Certificates: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs},
+		SignerInfos: []testSignerInfo{{
+			Version: 1,
+			IssuerAndSerialNumber: testIssuerAndSerial{
+				IssuerName:   asn1.RawValue{FullBytes: cert.RawIssuer},
+				SerialNumber: cert.SerialNumber,
+			},
+			DigestAlgorithm:         algID,
+			AuthenticatedAttributes: attrs,
+			DigestEncryptionAlgorithm: pkix.AlgorithmIdentifier{
+				Algorithm:  asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1},
+				Parameters: asn1.NullRawValue,
+			},
+			EncryptedDigest: signAttributesWithKeyForTest(t, attrs, crypto.SHA256, key),
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal timestamp SignedData: %v", err)
+	}
+
+	token, err := asn1.Marshal(testContentInfo{
+		ContentType: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2},
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal timestamp token: %v", err)
+	}
+	return token
+}
+
+// withRFC3161Timestamp adds an RFC 3161 timestamp token from the test TSA
+// asserting when
+func withRFC3161Timestamp(t testing.TB, when time.Time) func(*testSignerInfo) {
+	return func(si *testSignerInfo) {
+		t.Helper()
+
+		imprint := crypto.SHA256.New()
+		imprint.Write(si.EncryptedDigest)
+		token := timestampTokenForTest(t, imprint.Sum(nil), when)
+		si.UnauthenticatedAttributes = append(si.UnauthenticatedAttributes,
+			testAttr(t, oidRFC3161Timestamp, asn1.RawValue{FullBytes: token}))
+	}
+}
+
+// withRFC3161TimestampAs adds an RFC 3161 timestamp token from tsa asserting
+// when
+func withRFC3161TimestampAs(t testing.TB, tsa *testIdentity, when time.Time) func(*testSignerInfo) {
+	return func(si *testSignerInfo) {
+		t.Helper()
+
+		imprint := crypto.SHA256.New()
+		imprint.Write(si.EncryptedDigest)
+		token := timestampTokenAsForTest(t, tsa, imprint.Sum(nil), when)
+		si.UnauthenticatedAttributes = append(si.UnauthenticatedAttributes,
+			testAttr(t, oidRFC3161Timestamp, asn1.RawValue{FullBytes: token}))
+	}
+}
+
+// withForeignRFC3161Timestamp adds a well-formed RFC 3161 token whose imprint
+// covers some other signature
+func withForeignRFC3161Timestamp(t testing.TB, when time.Time) func(*testSignerInfo) {
+	return func(si *testSignerInfo) {
+		t.Helper()
+
+		imprint := crypto.SHA256.New()
+		imprint.Write([]byte("some other signature"))
+		token := timestampTokenForTest(t, imprint.Sum(nil), when)
+		si.UnauthenticatedAttributes = append(si.UnauthenticatedAttributes,
+			testAttr(t, oidRFC3161Timestamp, asn1.RawValue{FullBytes: token}))
+	}
+}
+
+// testRootsWithTSA returns a pool trusting the test signer and the test TSA
+func testRootsWithTSA(t *testing.T) *x509.CertPool {
+	t.Helper()
+
+	roots := testRoots(t)
+	tsa, _ := testTSA(t)
+	roots.AddCert(tsa)
+	return roots
+}
+
+func TestInspect_RFC3161Timestamp(t *testing.T) {
+	when := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+	filePath, _ := createSignedMockPEWithPayload(t, crypto.SHA256, []byte("payload"), withRFC3161Timestamp(t, when))
+
+	info, err := Inspect(filePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if info.Timestamp == nil || info.Timestamp.Type != TimestampRFC3161 {
+		t.Fatalf("Expected RFC 3161 timestamp, got %+v", info.Timestamp)
+	}
+	if !info.Timestamp.Time.Equal(when) || !info.SigningTime.Equal(when) {
+		t.Errorf("Expected timestamp %v, got %v / %v", when, info.Timestamp.Time, info.SigningTime)
+	}
+	if info.Timestamp.Signer == nil || !strings.Contains(info.Timestamp.Signer.Subject, "sigtool test TSA") {
+		t.Errorf("Expected TSA signer, got %+v", info.Timestamp.Signer)
+	}
+}
+
+func TestVerify_RFC3161Timestamp(t *testing.T) {
+	cert, _ := testSigner(t)
+	when := cert.NotBefore.Add(time.Minute)
+	filePath, _ := createSignedMockPEWithPayload(t, crypto.SHA256, []byte("payload"), withRFC3161Timestamp(t, when))
+
+	if err := Verify(filePath, nil); err != nil {
+		t.Errorf("Expected valid timestamp without roots, got: %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{Roots: testRootsWithTSA(t)}); err != nil {
+		t.Errorf("Expected valid timestamp with trusted TSA, got: %v", err)
+	}
+
+	err := Verify(filePath, &VerifyOptions{Roots: testRoots(t)})
+	if err == nil || !strings.Contains(err.Error(), "timestamp authority chain verification failed") {
+		t.Errorf("Expected untrusted TSA error, got: %v", err)
+	}
+}
+
+func TestVerify_RFC3161TimestampTime(t *testing.T) {
+	cert, _ := testSigner(t)
+	filePath, _ := createSignedMockPEWithPayload(t, crypto.SHA256, []byte("payload"), withRFC3161Timestamp(t, cert.NotBefore.Add(-time.Hour)))
+
+	err := Verify(filePath, &VerifyOptions{Roots: testRootsWithTSA(t)})
+	if err == nil || !strings.Contains(err.Error(), "certificate chain verification failed") {
+		t.Errorf("Expected chain error at the timestamp time, got: %v", err)
+	}
+}
+
+func TestVerify_RFC3161ImprintMismatch(t *testing.T) {
+	filePath, _ := createSignedMockPEWithPayload(t, crypto.SHA256, []byte("payload"), withForeignRFC3161Timestamp(t, time.Now()))
+
+	err := Verify(filePath, nil)
+	if err == nil || !strings.Contains(err.Error(), "message imprint does not match") {
+		t.Errorf("Expected imprint mismatch error, got: %v", err)
+	}
+}
+
+func TestVerify_CounterSignature(t *testing.T) {
+	cert, _ := testSigner(t)
+	filePath, _ := createSignedMockPEWithPayload(t, crypto.SHA256, []byte("payload"), withCounterSignature(t, cert.NotBefore.Add(time.Minute)))
+
+	if err := Verify(filePath, nil); err != nil {
+		t.Errorf("Expected valid countersignature without roots, got: %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{Roots: testRoots(t)}); err != nil {
+		t.Errorf("Expected valid countersignature with roots, got: %v", err)
+	}
+}
+
+func TestVerify_CounterSignatureSHA1(t *testing.T) {
+	cert, _ := testSigner(t)
+	when := cert.NotBefore.Add(time.Minute)
+	filePath, _ := createSignedMockPEWithPayload(t, crypto.SHA256, []byte("payload"), func(si *testSignerInfo) {
+		si.UnauthenticatedAttributes = append(si.UnauthenticatedAttributes,
+			counterSignatureForTest(t, si, si.EncryptedDigest, crypto.SHA1, when))
+	})
+
+	if err := Verify(filePath, &VerifyOptions{Roots: testRoots(t)}); err != nil {
+		t.Errorf("Expected valid SHA-1 countersignature, got: %v", err)
+	}
+}
+
+func TestVerify_CounterSignatureDigestMismatch(t *testing.T) {
+	filePath, _ := createSignedMockPEWithPayload(t, crypto.SHA256, []byte("payload"), func(si *testSignerInfo) {
+		si.UnauthenticatedAttributes = append(si.UnauthenticatedAttributes,
+			counterSignatureForTest(t, si, []byte("some other signature"), crypto.SHA256, time.Now()))
+	})
+
+	err := Verify(filePath, nil)
+	if err == nil || !strings.Contains(err.Error(), "countersignature message digest does not match") {
+		t.Errorf("Expected countersignature digest error, got: %v", err)
+	}
+}
+
+func TestVerify_CounterSignatureTampered(t *testing.T) {
+	filePath, _ := createSignedMockPEWithPayload(t, crypto.SHA256, []byte("payload"), withCounterSignature(t, time.Now()), func(si *testSignerInfo) {
+		attr := &si.UnauthenticatedAttributes[len(si.UnauthenticatedAttributes)-1]
+		var cs testSignerInfo
+		if _, err := asn1.Unmarshal(attr.Value.Bytes, &cs); err != nil {
+			t.Fatalf("Failed to decode countersignature: %v", err)
+		}
+		cs.EncryptedDigest[0] ^= 0xff
+		*attr = testAttr(t, oidCounterSignature, cs)
+	})
+
+	err := Verify(filePath, nil)
+	if err == nil || !strings.Contains(err.Error(), "countersignature verification failed") {
+		t.Errorf("Expected countersignature verification error, got: %v", err)
+	}
+}
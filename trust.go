@@ -0,0 +1,166 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LoadTrustAnchors loads a CA bundle for use with VerifyOptions: a PEM file,
+// a directory of PEM files, or both.
+//
+// Self-signed certificates become trusted roots; all other certificates are
+// returned as intermediates for chain building. Every regular file in caPath
+// is read, including OpenSSL-style hashed names such as "5ad8a5d6.0", and
+// files without PEM certificates are ignored.
+//
+// Parameters:
+//   - caFile: A PEM file holding one or more certificates, or "" for none
+//   - caPath: A directory of PEM certificate files, or "" for none
+//
+// Returns:
+//   - *x509.CertPool: The self-signed root certificates
+//   - []*x509.Certificate: The remaining intermediate certificates
+//   - error: An error if a file cannot be read or parsed, or no root was found
+//
+// Example usage:
+//
+//	roots, intermediates, err := sigtool.LoadTrustAnchors("corp-ca.pem", "")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	err = sigtool.Verify("signed.exe", &sigtool.VerifyOptions{Roots: roots, Intermediates: intermediates})
+func LoadTrustAnchors(caFile, caPath string) (*x509.CertPool, []*x509.Certificate, error) {
+	if strings.TrimSpace(caFile) == "" && strings.TrimSpace(caPath) == "" {
+		return nil, nil, errors.New("a CA file or CA directory is required")
+	}
+
+	var certs []*x509.Certificate
+	if caFile != "" {
+		loaded, err := LoadPEMCertificates(caFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		certs = append(certs, loaded...)
+	}
+	if caPath != "" {
+		entries, err := os.ReadDir(caPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read CA directory %q: %w", caPath, err)
+		}
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() {
+				continue
+			}
+			loaded, err := LoadPEMCertificates(filepath.Join(caPath, entry.Name()))
+			if errors.Is(err, errNoPEMCertificates) {
+				continue
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			certs = append(certs, loaded...)
+		}
+	}
+
+	roots := x509.NewCertPool()
+	var intermediates []*x509.Certificate
+	var rootCount int
+	for _, cert := range certs {
+		if isSelfSigned(cert) {
+			roots.AddCert(cert)
+			rootCount++
+		} else {
+			intermediates = append(intermediates, cert)
+		}
+	}
+	if rootCount == 0 {
+		return nil, nil, errors.New("no self-signed root certificates found in CA bundle")
+	}
+
+	return roots, intermediates, nil
+}
+
+// errNoPEMCertificates is returned by LoadPEMCertificates for files without
+// CERTIFICATE blocks
+var errNoPEMCertificates = errors.New("no PEM certificates found")
+
+// LoadPEMCertificates parses every CERTIFICATE block of a PEM file.
+//
+// Parameters:
+//   - filePath: The path to the PEM file
+//
+// Returns:
+//   - []*x509.Certificate: The certificates in file order
+//   - error: An error if the file cannot be read, a certificate is malformed
+//     or the file holds no certificates
+func LoadPEMCertificates(filePath string) ([]*x509.Certificate, error) {
+	// #nosec G304 - This tool is designed to read user-specified CA files
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file %q: %w", filePath, err)
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate in %q: %w", filePath, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%w in %q", errNoPEMCertificates, filePath)
+	}
+
+	return certs, nil
+}
+
+// LoadCertificates reads the certificates of a PEM bundle or a single DER
+// certificate, the formats in which cross-certificates are distributed.
+//
+// Parameters:
+//   - filePath: The path to the PEM or DER file
+//
+// Returns:
+//   - []*x509.Certificate: The certificates in file order
+//   - error: An error if the file cannot be read or holds no certificate
+func LoadCertificates(filePath string) ([]*x509.Certificate, error) {
+	certs, err := LoadPEMCertificates(filePath)
+	if !errors.Is(err, errNoPEMCertificates) {
+		return certs, err
+	}
+
+	// #nosec G304 - This tool is designed to read user-specified CA files
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate file %q: %w", filePath, err)
+	}
+	cert, err := x509.ParseCertificate(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate in %q: %w", filePath, err)
+	}
+	return []*x509.Certificate{cert}, nil
+}
+
+// isSelfSigned reports whether cert is issued by itself and verifies under
+// its own key
+func isSelfSigned(cert *x509.Certificate) bool {
+	if !bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		return false
+	}
+	return cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
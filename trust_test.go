@@ -0,0 +1,166 @@
+package sigtool
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writePEMForTest writes certs as a PEM bundle to name in dir
+func writePEMForTest(t *testing.T, dir, name string, certs ...*x509.Certificate) string {
+	t.Helper()
+
+	var data []byte
+	for _, cert := range certs {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	filePath := filepath.Join(dir, name)
+	if err := os.WriteFile(filePath, data, 0600); err != nil {
+		t.Fatalf("Failed to write PEM file: %v", err)
+	}
+	return filePath
+}
+
+func TestLoadTrustAnchors_File(t *testing.T) {
+	root := issueCertificateForTest(t, testCATemplate("corp root", 1), nil)
+	intermediate := issueCertificateForTest(t, testCATemplate("corp intermediate", 2), root)
+	leaf := issueCertificateForTest(t, testLeafTemplate("corp signer", 3, x509.ExtKeyUsageCodeSigning), intermediate)
+
+	// The signature only embeds the leaf, so the bundle must supply the intermediate
+	leaf.Chain = nil
+	filePath := createSignedMockPEAs(t, leaf, crypto.SHA256)
+	caFile := writePEMForTest(t, t.TempDir(), "bundle.pem", root.Cert, intermediate.Cert)
+
+	roots, intermediates, err := LoadTrustAnchors(caFile, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(intermediates) != 1 || !intermediates[0].Equal(intermediate.Cert) {
+		t.Errorf("Expected the intermediate to be separated from the roots, got %d", len(intermediates))
+	}
+
+	if err := Verify(filePath, &VerifyOptions{Roots: roots, Intermediates: intermediates}); err != nil {
+		t.Errorf("Expected chain to verify with the CA bundle, got: %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{Roots: roots}); err == nil {
+		t.Error("Expected chain verification to fail without the intermediate")
+	}
+}
+
+func TestLoadTrustAnchors_Directory(t *testing.T) {
+	root := issueCertificateForTest(t, testCATemplate("corp root", 1), nil)
+	leaf := issueCertificateForTest(t, testLeafTemplate("corp signer", 2, x509.ExtKeyUsageCodeSigning), root)
+	filePath := createSignedMockPEAs(t, leaf, crypto.SHA256)
+
+	dir := t.TempDir()
+	writePEMForTest(t, dir, "5ad8a5d6.0", root.Cert)
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("not a certificate"), 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	roots, intermediates, err := LoadTrustAnchors("", dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{Roots: roots, Intermediates: intermediates}); err != nil {
+		t.Errorf("Expected chain to verify with the CA directory, got: %v", err)
+	}
+}
+
+func TestLoadTrustAnchors_Errors(t *testing.T) {
+	if _, _, err := LoadTrustAnchors("", ""); err == nil || !strings.Contains(err.Error(), "is required") {
+		t.Errorf("Expected 'is required' error, got: %v", err)
+	}
+
+	if _, _, err := LoadTrustAnchors(filepath.Join(t.TempDir(), "missing.pem"), ""); err == nil || !strings.Contains(err.Error(), "failed to read CA file") {
+		t.Errorf("Expected 'failed to read CA file' error, got: %v", err)
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(empty, []byte("no certificates here"), 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if _, _, err := LoadTrustAnchors(empty, ""); err == nil || !strings.Contains(err.Error(), "no PEM certificates found") {
+		t.Errorf("Expected 'no PEM certificates found' error, got: %v", err)
+	}
+
+	root := issueCertificateForTest(t, testCATemplate("corp root", 1), nil)
+	intermediate := issueCertificateForTest(t, testCATemplate("corp intermediate", 2), root)
+	onlyIntermediate := writePEMForTest(t, t.TempDir(), "intermediate.pem", intermediate.Cert)
+	if _, _, err := LoadTrustAnchors(onlyIntermediate, ""); err == nil || !strings.Contains(err.Error(), "no self-signed root") {
+		t.Errorf("Expected 'no self-signed root' error, got: %v", err)
+	}
+}
+
+// crossSignForTest issues a cross-certificate for ca's subject and key,
+// signed by issuer
+func crossSignForTest(t *testing.T, ca, issuer *testIdentity) *x509.Certificate {
+	t.Helper()
+
+	template := *ca.Cert
+	template.SerialNumber = big.NewInt(ca.Cert.SerialNumber.Int64() + 1000)
+	der, err := x509.CreateCertificate(rand.Reader, &template, issuer.Cert, &ca.Key.PublicKey, issuer.Key)
+	if err != nil {
+		t.Fatalf("Failed to create cross-certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse cross-certificate: %v", err)
+	}
+	return cert
+}
+
+func TestVerify_CrossCertificate(t *testing.T) {
+	// The signature chains to a vendor root that is not trusted directly;
+	// the trusted verification root cross-signed the vendor root
+	verificationRoot := issueCertificateForTest(t, testCATemplate("code verification root", 1), nil)
+	vendorRoot := issueCertificateForTest(t, testCATemplate("vendor root", 2), nil)
+	intermediate := issueCertificateForTest(t, testCATemplate("vendor intermediate", 3), vendorRoot)
+	leaf := issueCertificateForTest(t, testLeafTemplate("driver signer", 4, x509.ExtKeyUsageCodeSigning), intermediate)
+	filePath := createSignedMockPEAs(t, leaf, crypto.SHA256)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(verificationRoot.Cert)
+	cross := crossSignForTest(t, vendorRoot, verificationRoot)
+
+	if err := Verify(filePath, &VerifyOptions{Roots: roots}); !errors.Is(err, ErrChainVerification) {
+		t.Errorf("Expected chain failure without the cross-certificate, got: %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{Roots: roots, CrossCertificates: []*x509.Certificate{cross}}); err != nil {
+		t.Errorf("Expected chain to verify through the cross-certificate, got: %v", err)
+	}
+}
+
+func TestLoadCertificates_PEMAndDER(t *testing.T) {
+	root := issueCertificateForTest(t, testCATemplate("corp root", 1), nil)
+	dir := t.TempDir()
+
+	der := filepath.Join(dir, "cross.crt")
+	if err := os.WriteFile(der, root.Cert.Raw, 0600); err != nil {
+		t.Fatalf("Failed to write DER file: %v", err)
+	}
+	certs, err := LoadCertificates(der)
+	if err != nil || len(certs) != 1 || !certs[0].Equal(root.Cert) {
+		t.Errorf("Expected the DER certificate, got %d certificates and: %v", len(certs), err)
+	}
+
+	certs, err = LoadCertificates(writePEMForTest(t, dir, "cross.pem", root.Cert))
+	if err != nil || len(certs) != 1 {
+		t.Errorf("Expected the PEM certificate, got %d certificates and: %v", len(certs), err)
+	}
+
+	junk := filepath.Join(dir, "junk.crt")
+	if err := os.WriteFile(junk, []byte("junk"), 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if _, err := LoadCertificates(junk); err == nil || !strings.Contains(err.Error(), "failed to parse certificate") {
+		t.Errorf("Expected parse error, got: %v", err)
+	}
+}
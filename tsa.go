@@ -0,0 +1,225 @@
+package sigtool
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTSATimeout bounds each timestamp request
+	DefaultTSATimeout = 30 * time.Second
+	// DefaultTSARetryDelay is the pause before retrying a timestamp authority
+	DefaultTSARetryDelay = time.Second
+	// maxTSAResponseSize bounds the size of a timestamp response
+	maxTSAResponseSize = 1 << 20
+)
+
+// TimestampOptions configures RFC 3161 timestamping.
+type TimestampOptions struct {
+	// URLs are the timestamp authorities, tried in order. When one fails
+	// after its retries the next is used, so later entries act as fallbacks.
+	URLs []string
+	// Hash is the message imprint algorithm. Zero means crypto.SHA256.
+	Hash crypto.Hash
+	// Retries is the number of additional attempts per authority
+	Retries int
+	// RetryDelay is the pause before each retry. Zero means
+	// DefaultTSARetryDelay.
+	RetryDelay time.Duration
+	// Client performs the requests. When nil, a client with Timeout is used.
+	Client *http.Client
+	// Timeout bounds each request when Client is nil. Zero means
+	// DefaultTSATimeout.
+	Timeout time.Duration
+}
+
+// timeStampReq is the RFC 3161 TimeStampReq structure
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional,default:false"`
+}
+
+// timeStampResp is the RFC 3161 TimeStampResp structure
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []asn1.RawValue `asn1:"optional"`
+	FailInfo     asn1.BitString  `asn1:"optional"`
+}
+
+// RequestTimestamp obtains an RFC 3161 timestamp token over data from the
+// timestamp authorities of opts.
+//
+// For Authenticode, data is the encrypted digest of the signature being
+// timestamped. The token is checked before it is returned: its signature
+// must verify, it must embed the authority certificate and carry the imprint
+// of data and the nonce of the request. The authority certificate is not
+// validated against any roots; Verify does that.
+//
+// Parameters:
+//   - ctx: Bounds all attempts
+//   - data: The bytes to timestamp
+//   - opts: The authorities, imprint algorithm and retry policy
+//
+// Returns:
+//   - []byte: The DER-encoded timestamp token, a PKCS#7 SignedData
+//   - error: An error if every authority failed
+//
+// Example usage:
+//
+//	token, err := sigtool.RequestTimestamp(ctx, signature, &sigtool.TimestampOptions{
+//	    URLs:    []string{"http://timestamp.digicert.com", "http://timestamp.sectigo.com"},
+//	    Retries: 2,
+//	})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+func RequestTimestamp(ctx context.Context, data []byte, opts *TimestampOptions) ([]byte, error) {
+	if opts == nil || len(opts.URLs) == 0 {
+		return nil, errors.New("no timestamp authority URL configured")
+	}
+	h := opts.Hash
+	if h == 0 {
+		h = crypto.SHA256
+	}
+	hashOID, err := oidForHash(h)
+	if err != nil {
+		return nil, err
+	}
+	imprint := h.New()
+	imprint.Write(data)
+
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate timestamp nonce: %w", err)
+	}
+	request, err := asn1.Marshal(timeStampReq{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: hashOID, Parameters: asn1.NullRawValue},
+			HashedMessage: imprint.Sum(nil),
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode timestamp request: %w", err)
+	}
+
+	delay := opts.RetryDelay
+	if delay <= 0 {
+		delay = DefaultTSARetryDelay
+	}
+	var errs []error
+	for _, url := range opts.URLs {
+		for attempt := 0; attempt <= opts.Retries; attempt++ {
+			if attempt > 0 {
+				select {
+				case <-ctx.Done():
+					return nil, fmt.Errorf("timestamping failed: %w", errors.Join(append(errs, ctx.Err())...))
+				case <-time.After(delay):
+				}
+			}
+			token, err := queryTSA(ctx, opts, url, request)
+			if err == nil {
+				err = checkTimestampToken(token, data, nonce)
+			}
+			if err == nil {
+				return token, nil
+			}
+			errs = append(errs, err)
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("timestamping failed: %w", errors.Join(errs...))
+			}
+		}
+	}
+	return nil, fmt.Errorf("timestamping failed: %w", errors.Join(errs...))
+}
+
+// queryTSA sends request to the authority at url and returns the granted
+// token
+func queryTSA(ctx context.Context, opts *TimestampOptions, url string, request []byte) ([]byte, error) {
+	client := opts.Client
+	if client == nil {
+		timeout := opts.Timeout
+		if timeout <= 0 {
+			timeout = DefaultTSATimeout
+		}
+		client = &http.Client{Timeout: timeout}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(request))
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp authority URL %q: %w", url, err)
+	}
+	req.Header.Set("Content-Type", "application/timestamp-query")
+	req.Header.Set("Accept", "application/timestamp-reply")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("timestamp request to %q failed: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("timestamp request to %q failed: %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxTSAResponseSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("timestamp request to %q failed: %w", url, err)
+	}
+	if len(body) > maxTSAResponseSize {
+		return nil, fmt.Errorf("timestamp response from %q exceeds %d bytes", url, maxTSAResponseSize)
+	}
+
+	var parsed timeStampResp
+	if rest, err := asn1.Unmarshal(body, &parsed); err != nil {
+		return nil, fmt.Errorf("invalid timestamp response from %q: %w", url, err)
+	} else if len(rest) > 0 {
+		return nil, fmt.Errorf("invalid timestamp response from %q: trailing data", url)
+	}
+	// 0 is granted and 1 granted with modifications
+	if parsed.Status.Status > 1 {
+		var text []string
+		for _, s := range parsed.Status.StatusString {
+			text = append(text, string(s.Bytes))
+		}
+		return nil, fmt.Errorf("timestamp authority %q rejected the request with status %d %s", url, parsed.Status.Status, strings.Join(text, "; "))
+	}
+	if len(parsed.TimeStampToken.FullBytes) == 0 {
+		return nil, fmt.Errorf("timestamp response from %q has no token", url)
+	}
+	return parsed.TimeStampToken.FullBytes, nil
+}
+
+// checkTimestampToken verifies that token is a validly signed timestamp of
+// data answering the request with nonce
+func checkTimestampToken(token, data []byte, nonce *big.Int) error {
+	if _, err := verifyTimestampToken(token, data, &trustConfig{}); err != nil {
+		return err
+	}
+	_, info, err := parseTimestampToken(token)
+	if err != nil {
+		return err
+	}
+	if info.Nonce == nil || info.Nonce.Cmp(nonce) != 0 {
+		return errors.New("timestamp token does not carry the request nonce")
+	}
+	return nil
+}
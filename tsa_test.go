@@ -0,0 +1,163 @@
+package sigtool
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// tsaServerForTest runs an RFC 3161 timestamp authority backed by the test
+// TSA. The first failures requests are answered with 503, and respond, when
+// set, may replace the response to a parsed request.
+func tsaServerForTest(t *testing.T, failures int32, respond func(req timeStampReq) *timeStampResp) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var req timeStampReq
+		if r.Header.Get("Content-Type") != "application/timestamp-query" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if _, err := asn1.Unmarshal(body, &req); err != nil || !req.CertReq {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		resp := &timeStampResp{}
+		if respond != nil {
+			resp = respond(req)
+		} else {
+			cert, key := testTSA(t)
+			resp.TimeStampToken = asn1.RawValue{FullBytes: timestampTokenWithNonceForTest(t, &testIdentity{Cert: cert, Key: key},
+				req.MessageImprint.HashedMessage, time.Now().Add(-time.Minute), req.Nonce)}
+		}
+		der, err := asn1.Marshal(*resp)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/timestamp-reply")
+		_, _ = w.Write(der)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestRequestTimestamp(t *testing.T) {
+	server, requests := tsaServerForTest(t, 2, nil)
+
+	token, err := RequestTimestamp(context.Background(), []byte("signature"), &TimestampOptions{
+		URLs:       []string{server.URL},
+		Retries:    2,
+		RetryDelay: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if *requests != 3 {
+		t.Errorf("Expected 3 attempts, got %d", *requests)
+	}
+	if _, err := verifyTimestampToken(token, []byte("signature"), &trustConfig{}); err != nil {
+		t.Errorf("Expected a token over the data, got: %v", err)
+	}
+}
+
+func TestRequestTimestamp_Fallback(t *testing.T) {
+	down, _ := tsaServerForTest(t, 100, nil)
+	server, _ := tsaServerForTest(t, 0, nil)
+
+	_, err := RequestTimestamp(context.Background(), []byte("signature"), &TimestampOptions{
+		URLs:       []string{down.URL, server.URL},
+		Retries:    1,
+		RetryDelay: time.Millisecond,
+	})
+	if err != nil {
+		t.Errorf("Expected the fallback authority to answer, got: %v", err)
+	}
+
+	_, err = RequestTimestamp(context.Background(), []byte("signature"), &TimestampOptions{URLs: []string{down.URL}})
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("Expected the authority failure, got: %v", err)
+	}
+}
+
+func TestRequestTimestamp_Rejected(t *testing.T) {
+	rejected, _ := tsaServerForTest(t, 0, func(timeStampReq) *timeStampResp {
+		return &timeStampResp{Status: pkiStatusInfo{
+			Status:       2,
+			StatusString: []asn1.RawValue{{Tag: asn1.TagUTF8String, Bytes: []byte("unsupported algorithm")}},
+		}}
+	})
+	_, err := RequestTimestamp(context.Background(), []byte("signature"), &TimestampOptions{URLs: []string{rejected.URL}})
+	if err == nil || !strings.Contains(err.Error(), "status 2 unsupported algorithm") {
+		t.Errorf("Expected the rejection status, got: %v", err)
+	}
+
+	replayed, _ := tsaServerForTest(t, 0, func(req timeStampReq) *timeStampResp {
+		cert, key := testTSA(t)
+		token := timestampTokenWithNonceForTest(t, &testIdentity{Cert: cert, Key: key},
+			req.MessageImprint.HashedMessage, time.Now(), big.NewInt(7))
+		return &timeStampResp{TimeStampToken: asn1.RawValue{FullBytes: token}}
+	})
+	_, err = RequestTimestamp(context.Background(), []byte("signature"), &TimestampOptions{URLs: []string{replayed.URL}})
+	if err == nil || !strings.Contains(err.Error(), "nonce") {
+		t.Errorf("Expected a nonce mismatch, got: %v", err)
+	}
+
+	foreign, _ := tsaServerForTest(t, 0, func(req timeStampReq) *timeStampResp {
+		return &timeStampResp{TimeStampToken: asn1.RawValue{FullBytes: timestampTokenForTest(t, make([]byte, 32), time.Now())}}
+	})
+	_, err = RequestTimestamp(context.Background(), []byte("signature"), &TimestampOptions{URLs: []string{foreign.URL}})
+	if err == nil || !strings.Contains(err.Error(), "message imprint does not match") {
+		t.Errorf("Expected an imprint mismatch, got: %v", err)
+	}
+
+	if _, err := RequestTimestamp(context.Background(), []byte("signature"), nil); err == nil {
+		t.Error("Expected error without authorities, got nil")
+	}
+}
+
+func TestSignPE_Timestamp(t *testing.T) {
+	root := issueCertificateForTest(t, testCATemplate("timestamp root", 1), nil)
+	leaf := issueCertificateForTest(t, testLeafTemplate("timestamp signer", 2, x509.ExtKeyUsageCodeSigning), root)
+	tsa, _ := testTSA(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Cert)
+	roots.AddCert(tsa)
+	server, _ := tsaServerForTest(t, 0, nil)
+
+	filePath := writeUnsignedPEForTest(t, []byte("timestamped payload"))
+	err := SignPE(filePath, leaf.Cert, leaf.Key, &SignOptions{Timestamp: &TimestampOptions{URLs: []string{server.URL}}})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{Roots: roots}); err != nil {
+		t.Errorf("Expected timestamped signature to verify, got: %v", err)
+	}
+	info, err := Inspect(filePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if info.Timestamp == nil || info.Timestamp.Type != TimestampRFC3161 {
+		t.Errorf("Expected an RFC 3161 timestamp, got %+v", info.Timestamp)
+	}
+
+	down, _ := tsaServerForTest(t, 100, nil)
+	err = SignPE(filePath, leaf.Cert, leaf.Key, &SignOptions{Timestamp: &TimestampOptions{URLs: []string{down.URL}}})
+	if err == nil || !strings.Contains(err.Error(), "timestamping failed") {
+		t.Errorf("Expected timestamping failure, got: %v", err)
+	}
+}
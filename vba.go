@@ -0,0 +1,505 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/md5" // #nosec G501 - the legacy VBA content hash is MD5 by definition
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// Storages that hold the VBA project of a legacy Excel workbook and Word
+// document, and the project storage holding the module streams
+const (
+	vbaExcelStorage  = "_VBA_PROJECT_CUR"
+	vbaWordStorage   = "Macros"
+	vbaModuleStorage = "VBA"
+	vbaDirStream     = "dir"
+	vbaProjectPart   = "vbaProject.bin"
+)
+
+// maxVBASourceSize bounds the decompressed dir and module streams of a VBA
+// project
+const maxVBASourceSize = 64 << 20
+
+// vbaSignature is one of the signatures of a VBA project: the legacy
+// signature over the MD5 content hash, the Agile signature and the V3
+// signature, stored in the project storage of a compound file or in parts
+// next to vbaProject.bin in an Office Open XML document
+type vbaSignature struct {
+	stream, part string
+}
+
+var vbaSignatures = []vbaSignature{
+	{msiSignatureStream, "vbaProjectSignature.bin"},
+	{"\x05DigitalSignatureEx", "vbaProjectSignatureAgile.bin"},
+	{"\x05DigitalSignatureExt", "vbaProjectSignatureV3.bin"},
+}
+
+// dir stream record IDs (MS-OVBA 2.3.4.2) the content hash reads
+const (
+	vbaProjectName         = 0x0004
+	vbaProjectVersion      = 0x0009
+	vbaProjectConstants    = 0x000c
+	vbaReferenceRegistered = 0x000d
+	vbaReferenceProject    = 0x000e
+	vbaDirTerminator       = 0x0010
+	vbaModuleStreamName    = 0x001a
+	vbaModuleOffset        = 0x0031
+	vbaModuleStreamUnicode = 0x0032
+	vbaModuleTerminator    = 0x002b
+	vbaReferenceControl    = 0x002f
+	vbaReferenceExtended   = 0x0030
+	vbaReferenceOriginal   = 0x0033
+)
+
+// vbaProject is a VBA project and its signatures
+type vbaProject struct {
+	cf *compoundFile
+	// root is the storage holding the VBA storage and PROJECT stream
+	root uint32
+	// signatures holds the data of each of vbaSignatures, nil when absent
+	signatures [][]byte
+}
+
+// vbaRecord is a record of the decompressed dir stream
+type vbaRecord struct {
+	id   uint16
+	data []byte
+}
+
+// isVBACompoundFile reports whether cf is a legacy Office document whose
+// VBA project is signed
+func isVBACompoundFile(cf *compoundFile) bool {
+	root, err := vbaProjectStorage(cf)
+	if err != nil || root == nil {
+		return false
+	}
+	for _, sig := range vbaSignatures {
+		if e, err := cf.findChild(root.id, sig.stream); err == nil && e != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// vbaProjectStorage returns the storage of cf holding its VBA project, or
+// nil when it has none
+func vbaProjectStorage(cf *compoundFile) (*cfbEntry, error) {
+	for _, name := range []string{vbaExcelStorage, vbaWordStorage} {
+		e, err := cf.findChild(0, name)
+		if err != nil {
+			return nil, err
+		}
+		if e != nil && e.objectType == cfbStorage {
+			return e, nil
+		}
+	}
+	return nil, nil
+}
+
+// vbaProjectEntry returns the vbaProject.bin part of an Office Open XML
+// document, or nil when it has none
+func vbaProjectEntry(a *zipArchive) *zipEntry {
+	for i, e := range a.entries {
+		if strings.EqualFold(path.Base(e.name), vbaProjectPart) {
+			return &a.entries[i]
+		}
+	}
+	return nil
+}
+
+// isVBAPackage reports whether the ZIP archive a is an Office Open XML
+// document whose VBA project is signed
+func isVBAPackage(a *zipArchive) bool {
+	project := vbaProjectEntry(a)
+	if project == nil {
+		return false
+	}
+	for _, sig := range vbaSignatures {
+		if a.entry(path.Join(path.Dir(project.name), sig.part)) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// openVBAProject reads the VBA project and signatures of the Office
+// document r, a compound file or an Office Open XML package
+func openVBAProject(r io.ReaderAt, size int64) (*vbaProject, error) {
+	if isCompoundFile(r, size) {
+		cf, err := openCompoundFile(r, size)
+		if err != nil {
+			return nil, err
+		}
+		root, err := vbaProjectStorage(cf)
+		if err != nil {
+			return nil, err
+		}
+		if root == nil {
+			return nil, fmt.Errorf("%w (document has no VBA project)", ErrNotSigned)
+		}
+		project := &vbaProject{cf: cf, root: root.id}
+		for _, sig := range vbaSignatures {
+			e, err := cf.findChild(root.id, sig.stream)
+			if err != nil {
+				return nil, err
+			}
+			var data []byte
+			if e != nil && e.objectType == cfbStream {
+				if e.size > MaxSignatureSize {
+					return nil, &SignatureSizeError{Size: int64(e.size), Limit: MaxSignatureSize}
+				}
+				if data, err = cf.readStream(e); err != nil {
+					return nil, err
+				}
+			}
+			project.signatures = append(project.signatures, data)
+		}
+		return project, nil
+	}
+
+	a, err := openZipArchive(r, size)
+	if err != nil {
+		return nil, err
+	}
+	entry := vbaProjectEntry(a)
+	if entry == nil {
+		return nil, fmt.Errorf("%w (document has no VBA project)", ErrNotSigned)
+	}
+	data, err := a.readFile(entry.name)
+	if err != nil {
+		return nil, err
+	}
+	cf, err := openCompoundFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", entry.name, err)
+	}
+	project := &vbaProject{cf: cf}
+	for _, sig := range vbaSignatures {
+		data, err := a.readFile(path.Join(path.Dir(entry.name), sig.part))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > MaxSignatureSize {
+			return nil, &SignatureSizeError{Size: int64(len(data)), Limit: MaxSignatureSize}
+		}
+		project.signatures = append(project.signatures, data)
+	}
+	return project, nil
+}
+
+// vbaSignatureData returns the PKCS#7 signature held by a VBA signature
+// stream or part: a DigSigBlob (MS-OSHARED 2.3.2.1), whose
+// DigSigInfoSerialized gives the size and offset of the signature, or the
+// bare signature
+func vbaSignatureData(data []byte) ([]byte, error) {
+	if len(data) > 0 && data[0] == 0x30 {
+		return data, nil
+	}
+	// The DigSigBlob header is followed by the nine DigSigInfoSerialized
+	// fields
+	if len(data) < 8+36 {
+		return nil, fmt.Errorf("%w: VBA signature of %d bytes", ErrSignatureTruncated, len(data))
+	}
+	if pointer := binary.LittleEndian.Uint32(data[4:]); pointer != 8 {
+		return nil, fmt.Errorf("VBA signature info at offset %d, expected 8", pointer)
+	}
+	cb := uint64(binary.LittleEndian.Uint32(data[8:]))
+	offset := uint64(binary.LittleEndian.Uint32(data[12:]))
+	if offset+cb > uint64(len(data)) {
+		return nil, &SignatureBoundsError{
+			Offset: int64(offset), Length: int64(cb), FileSize: int64(len(data)),
+			Reason: fmt.Sprintf("VBA signature at offset %d of %d bytes exceeds its %d byte stream", offset, cb, len(data)),
+		}
+	}
+	return data[offset : offset+cb], nil
+}
+
+// signature returns the first signature of the project, in vbaSignatures
+// order
+func (p *vbaProject) signature() ([]byte, error) {
+	for _, data := range p.signatures {
+		if data != nil {
+			return vbaSignatureData(data)
+		}
+	}
+	return nil, fmt.Errorf("%w (VBA project has no signature)", ErrNotSigned)
+}
+
+// readVBASignature returns the PKCS#7 signature of the VBA project of the
+// Office document r
+func readVBASignature(r io.ReaderAt, size int64) ([]byte, error) {
+	project, err := openVBAProject(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return project.signature()
+}
+
+// verifyVBA verifies every signature of the VBA project of the Office
+// document r: unless disabled, the MD5 content hash of the project must
+// match the legacy signature; the signer signature and chain of each
+// signature are checked per opts. The content hashes of the Agile and V3
+// signatures also cover the project forms and are not computed, so a
+// project signed only with them verifies only with SkipContentDigest.
+func verifyVBA(r io.ReaderAt, size int64, opts VerifyOptions) error {
+	project, err := openVBAProject(r, size)
+	if err != nil {
+		return fmt.Errorf("failed to extract signature: %w", err)
+	}
+	if _, err := project.signature(); err != nil {
+		return fmt.Errorf("failed to extract signature: %w", err)
+	}
+	if project.signatures[0] == nil && !opts.SkipContentDigest {
+		return errors.New("VBA project has no legacy signature, and the content hash of Agile and V3 signatures is not supported")
+	}
+
+	for i, data := range project.signatures {
+		if data == nil {
+			continue
+		}
+		signature, err := vbaSignatureData(data)
+		if err != nil {
+			return fmt.Errorf("failed to extract signature: %w", err)
+		}
+		opts.logger().Debug("read VBA project signature", "stream", strings.TrimPrefix(vbaSignatures[i].stream, "\x05"), "size", len(signature))
+		signatureOpts := opts
+		if i > 0 {
+			signatureOpts.SkipContentDigest = true
+		}
+		err = verifySignatureDigest(signature, signatureOpts, func(crypto.Hash) ([]byte, error) {
+			// The legacy content hash is MD5 whatever digest algorithm the
+			// signature names
+			normalized, err := project.contentNormalizedData()
+			if err != nil {
+				return nil, err
+			}
+			sum := md5.Sum(normalized) // #nosec G401 - the legacy VBA content hash is MD5 by definition
+			return sum[:], nil
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", strings.TrimPrefix(vbaSignatures[i].stream, "\x05"), err)
+		}
+	}
+	return nil
+}
+
+// contentNormalizedData returns the Content Normalized Data of the project
+// (MS-OVBA 2.4.2.1) that the legacy content hash covers: the project name
+// and constants, the reference records without their size, and the source
+// lines of every module other than its Attribute lines
+func (p *vbaProject) contentNormalizedData() ([]byte, error) {
+	storage, err := p.cf.findChild(p.root, vbaModuleStorage)
+	if err != nil {
+		return nil, err
+	}
+	if storage == nil || storage.objectType != cfbStorage {
+		return nil, errors.New("VBA project has no VBA storage")
+	}
+	records, err := p.dirRecords(storage.id)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	var streamName, streamNameUnicode string
+	var textOffset uint32
+	for _, rec := range records {
+		switch rec.id {
+		case vbaProjectName, vbaProjectConstants:
+			buf.Write(rec.data)
+		case vbaReferenceRegistered, vbaReferenceProject, vbaReferenceControl, vbaReferenceExtended:
+			buf.Write(binary.LittleEndian.AppendUint16(nil, rec.id))
+			buf.Write(rec.data)
+		case vbaReferenceOriginal:
+			// The size of REFERENCEORIGINAL is its SizeOfLibidOriginal field
+			buf.Write(binary.LittleEndian.AppendUint16(nil, rec.id))
+			buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(rec.data))))
+			buf.Write(rec.data)
+		case vbaModuleStreamName:
+			streamName, streamNameUnicode = string(rec.data), ""
+		case vbaModuleStreamUnicode:
+			streamNameUnicode = decodeScriptText(rec.data, true)
+		case vbaModuleOffset:
+			if len(rec.data) < 4 {
+				return nil, errors.New("malformed VBA MODULEOFFSET record")
+			}
+			textOffset = binary.LittleEndian.Uint32(rec.data)
+		case vbaModuleTerminator:
+			name := streamNameUnicode
+			if name == "" {
+				name = streamName
+			}
+			source, err := p.moduleSource(storage.id, name, textOffset)
+			if err != nil {
+				return nil, err
+			}
+			for _, line := range splitVBALines(source) {
+				if !bytes.HasPrefix(bytes.ToLower(line), []byte("attribute")) {
+					buf.Write(line)
+				}
+			}
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// dirRecords returns the records of the decompressed dir stream of the VBA
+// storage id
+func (p *vbaProject) dirRecords(id uint32) ([]vbaRecord, error) {
+	e, err := p.cf.findChild(id, vbaDirStream)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil || e.objectType != cfbStream {
+		return nil, errors.New("VBA project has no dir stream")
+	}
+	compressed, err := p.cf.readStream(e)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := decompressVBA(compressed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress VBA dir stream: %w", err)
+	}
+
+	var records []vbaRecord
+	for pos := 0; pos < len(dir); {
+		if len(dir)-pos < 6 {
+			return nil, errors.New("VBA dir stream is truncated")
+		}
+		rec := vbaRecord{id: binary.LittleEndian.Uint16(dir[pos:])}
+		size := int64(binary.LittleEndian.Uint32(dir[pos+2:]))
+		pos += 6
+		// PROJECTVERSION declares 4 bytes but holds a 2-byte minor version
+		// after them
+		if rec.id == vbaProjectVersion {
+			size = 6
+		}
+		if size > int64(len(dir)-pos) {
+			return nil, fmt.Errorf("VBA dir record 0x%04x of %d bytes is truncated", rec.id, size)
+		}
+		rec.data = dir[pos : pos+int(size)]
+		pos += int(size)
+		records = append(records, rec)
+		if rec.id == vbaDirTerminator {
+			break
+		}
+	}
+	return records, nil
+}
+
+// moduleSource returns the decompressed source code of the module stream
+// name of the VBA storage id, which starts at offset
+func (p *vbaProject) moduleSource(id uint32, name string, offset uint32) ([]byte, error) {
+	e, err := p.cf.findChild(id, name)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil || e.objectType != cfbStream {
+		return nil, fmt.Errorf("VBA project has no module stream %q", name)
+	}
+	data, err := p.cf.readStream(e)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(offset) > uint64(len(data)) {
+		return nil, fmt.Errorf("VBA module %q source offset %d is beyond its %d bytes", name, offset, len(data))
+	}
+	source, err := decompressVBA(data[offset:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress VBA module %q: %w", name, err)
+	}
+	return source, nil
+}
+
+// splitVBALines splits source at each CR, LF or CRLF line break
+func splitVBALines(source []byte) [][]byte {
+	var lines [][]byte
+	start := 0
+	for i := 0; i < len(source); i++ {
+		switch source[i] {
+		case '\r':
+			lines = append(lines, source[start:i])
+			if i+1 < len(source) && source[i+1] == '\n' {
+				i++
+			}
+			start = i + 1
+		case '\n':
+			lines = append(lines, source[start:i])
+			start = i + 1
+		}
+	}
+	if start < len(source) {
+		lines = append(lines, source[start:])
+	}
+	return lines
+}
+
+// decompressVBA decompresses an MS-OVBA CompressedContainer (2.4.1): a
+// signature byte followed by chunks of literal bytes and copy tokens,
+// each chunk decompressing to at most 4096 bytes
+func decompressVBA(data []byte) ([]byte, error) {
+	if len(data) == 0 || data[0] != 1 {
+		return nil, errors.New("compressed container does not start with 0x01")
+	}
+	var out []byte
+	for pos := 1; pos < len(data); {
+		if len(data)-pos < 2 {
+			return nil, errors.New("compressed chunk header is truncated")
+		}
+		header := binary.LittleEndian.Uint16(data[pos:])
+		if header>>12&7 != 3 {
+			return nil, fmt.Errorf("compressed chunk header 0x%04x has an invalid signature", header)
+		}
+		end := min(pos+int(header&0x0fff)+3, len(data))
+		chunk := data[pos+2 : end]
+		pos = end
+		if len(out) > maxVBASourceSize {
+			return nil, fmt.Errorf("decompressed data exceeds the %d byte limit", maxVBASourceSize)
+		}
+		if header&0x8000 == 0 {
+			out = append(out, chunk...)
+			continue
+		}
+
+		start := len(out)
+		for i := 0; i < len(chunk); {
+			flags := chunk[i]
+			i++
+			for bit := 0; bit < 8 && i < len(chunk); bit++ {
+				if flags&(1<<bit) == 0 {
+					out = append(out, chunk[i])
+					i++
+					continue
+				}
+				if len(chunk)-i < 2 {
+					return nil, errors.New("copy token is truncated")
+				}
+				token := binary.LittleEndian.Uint16(chunk[i:])
+				i += 2
+				// The offset takes the fewest bits, at least 4, that can
+				// reach the start of the chunk
+				difference := len(out) - start
+				bitCount := 4
+				for 1<<bitCount < difference {
+					bitCount++
+				}
+				length := int(token&(0xffff>>bitCount)) + 3
+				offset := int(token>>(16-bitCount)) + 1
+				if offset > difference {
+					return nil, fmt.Errorf("copy token offset %d is before the chunk", offset)
+				}
+				for n := 0; n < length; n++ {
+					out = append(out, out[len(out)-offset])
+				}
+			}
+		}
+	}
+	return out, nil
+}
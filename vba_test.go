@@ -0,0 +1,285 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/md5" // #nosec G501 - the legacy VBA content hash is MD5 by definition
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// vbaSourceForTest is the source of the module of vbaProjectForTest
+const vbaSourceForTest = "Attribute VB_Name = \"Module1\"\r\nSub Hello()\r\n    MsgBox \"Hello\"\r\nEnd Sub\r\n"
+
+// vbaCompressForTest returns data as an MS-OVBA compressed container of
+// literal tokens only
+func vbaCompressForTest(data []byte) []byte {
+	out := []byte{1}
+	for len(data) > 0 {
+		n := min(len(data), 3640)
+		var chunk []byte
+		for i := 0; i < n; i += 8 {
+			chunk = append(chunk, 0)
+			chunk = append(chunk, data[i:min(i+8, n)]...)
+		}
+		out = binary.LittleEndian.AppendUint16(out, 0xb000|uint16(len(chunk)+2-3))
+		out = append(out, chunk...)
+		data = data[n:]
+	}
+	return out
+}
+
+// vbaRecordForTest returns a dir stream record
+func vbaRecordForTest(id uint16, data []byte) []byte {
+	b := binary.LittleEndian.AppendUint16(nil, id)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(data)))
+	return append(b, data...)
+}
+
+// vbaProjectForTest returns the entries of a VBA project storage named
+// name holding a single module with source, and signatures, one per
+// vbaSignatures entry, stored when not nil
+func vbaProjectForTest(name, source string, signatures ...[]byte) []cfbEntryForTest {
+	var unicode []byte
+	for _, u := range utf16.Encode([]rune("Module1")) {
+		unicode = binary.LittleEndian.AppendUint16(unicode, u)
+	}
+	var dir []byte
+	dir = append(dir, vbaRecordForTest(0x0001, []byte{1, 0, 0, 0})...)
+	dir = append(dir, vbaRecordForTest(vbaProjectName, []byte("VBAProject"))...)
+	dir = append(dir, vbaRecordForTest(vbaProjectVersion, []byte{1, 0, 0, 0})...)
+	dir = append(dir, 2, 0)
+	dir = append(dir, vbaRecordForTest(vbaProjectConstants, []byte("DEBUG = 1"))...)
+	dir = append(dir, vbaRecordForTest(vbaReferenceRegistered, []byte("*\\G{000204EF-0000-0000-C000-000000000046}"))...)
+	dir = append(dir, vbaRecordForTest(0x0019, []byte("Module1"))...)
+	dir = append(dir, vbaRecordForTest(vbaModuleStreamName, []byte("Module1"))...)
+	dir = append(dir, vbaRecordForTest(vbaModuleStreamUnicode, unicode)...)
+	dir = append(dir, vbaRecordForTest(vbaModuleOffset, []byte{16, 0, 0, 0})...)
+	dir = append(dir, vbaRecordForTest(vbaModuleTerminator, nil)...)
+	dir = append(dir, vbaRecordForTest(vbaDirTerminator, nil)...)
+	// The performance cache precedes the source of the module
+	module := append(bytes.Repeat([]byte{0xcc}, 16), vbaCompressForTest([]byte(source))...)
+
+	entries := []cfbEntryForTest{
+		{name: name, objectType: cfbStorage, child: 1, right: cfbNoStream},
+		{name: vbaModuleStorage, objectType: cfbStorage, child: 3, right: 2},
+		{name: "PROJECT", objectType: cfbStream, data: []byte("ID=\"{00000000-0000-0000-0000-000000000000}\"\r\n"), child: cfbNoStream, right: cfbNoStream},
+		{name: vbaDirStream, objectType: cfbStream, data: vbaCompressForTest(dir), child: cfbNoStream, right: 4},
+		{name: "Module1", objectType: cfbStream, data: module, child: cfbNoStream, right: cfbNoStream},
+	}
+	// The signatures follow VBA and PROJECT among the children of name
+	last := 2
+	for i, signature := range signatures {
+		if signature == nil {
+			continue
+		}
+		entries[last].right = uint32(len(entries))
+		last = len(entries)
+		entries = append(entries, cfbEntryForTest{name: vbaSignatures[i].stream, objectType: cfbStream, data: signature, child: cfbNoStream, right: cfbNoStream})
+	}
+	return entries
+}
+
+// vbaNormalizedForTest is the Content Normalized Data of vbaProjectForTest
+// with source
+func vbaNormalizedForTest(source string) []byte {
+	b := []byte("VBAProjectDEBUG = 1")
+	b = append(b, 0x0d, 0x00)
+	b = append(b, "*\\G{000204EF-0000-0000-C000-000000000046}"...)
+	for _, line := range strings.Split(source, "\r\n") {
+		if !strings.HasPrefix(line, "Attribute") {
+			b = append(b, line...)
+		}
+	}
+	return b
+}
+
+// signVBAForTest returns a legacy VBA signature by the test signer over the
+// MD5 content hash of vbaProjectForTest with source
+func signVBAForTest(t *testing.T, source string) []byte {
+	t.Helper()
+	sum := md5.Sum(vbaNormalizedForTest(source)) // #nosec G401 - the legacy VBA content hash is MD5 by definition
+	return signAuthenticodeForTest(t, sum[:], crypto.SHA1)
+}
+
+// digSigBlobForTest wraps signature in a DigSigBlob
+func digSigBlobForTest(signature []byte) []byte {
+	const offset = 8 + 36
+	b := binary.LittleEndian.AppendUint32(nil, uint32(offset+len(signature)))
+	b = binary.LittleEndian.AppendUint32(b, 8)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(signature)))
+	b = binary.LittleEndian.AppendUint32(b, offset)
+	b = append(b, make([]byte, offset-len(b))...)
+	return append(b, signature...)
+}
+
+// vbaDocumentForTest returns a legacy Excel workbook whose VBA project is
+// built by vbaProjectForTest
+func vbaDocumentForTest(source string, signatures ...[]byte) []byte {
+	project := vbaProjectForTest(vbaExcelStorage, source, signatures...)
+	entries := []cfbEntryForTest{{name: "Root Entry", objectType: cfbRoot, child: 1, right: cfbNoStream}}
+	entries = append(entries, cfbEntryForTest{name: "Workbook", objectType: cfbStream, data: []byte("workbook"), child: cfbNoStream, right: 2})
+	for _, e := range project {
+		if e.child != cfbNoStream {
+			e.child += 2
+		}
+		if e.right != cfbNoStream {
+			e.right += 2
+		}
+		entries = append(entries, e)
+	}
+	return compoundFileForTest(entries)
+}
+
+// vbaPackageForTest returns a macro-enabled workbook whose vbaProject.bin is
+// built by vbaProjectForTest, with signatures stored as parts next to it
+func vbaPackageForTest(t *testing.T, source string, signatures ...[]byte) []byte {
+	t.Helper()
+	project := vbaProjectForTest("", source)
+	project[0] = cfbEntryForTest{name: "Root Entry", objectType: cfbRoot, child: 1, right: cfbNoStream}
+	members := []zipMemberForTest{
+		{"[Content_Types].xml", []byte(`<?xml version="1.0" encoding="UTF-8"?><Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"/>`)},
+		{"xl/workbook.xml", []byte("<workbook/>")},
+		{"xl/vbaProject.bin", compoundFileForTest(project)},
+	}
+	for i, signature := range signatures {
+		if signature != nil {
+			members = append(members, zipMemberForTest{"xl/" + vbaSignatures[i].part, signature})
+		}
+	}
+	return zipForTest(t, members)
+}
+
+func TestDecompressVBA(t *testing.T) {
+	// The examples of MS-OVBA 3.2
+	tests := []struct {
+		name, compressed, want string
+	}{
+		{"literals", "0119B000616263646566676800696A6B6C6D6E6F70007172737475762E", "abcdefghijklmnopqrstuv."},
+		{"copy tokens", "012FB000236161616263646582660070616768696A013808616B6C00306D6E6F700671027004107273747576107778797A003C", "#aaabcdefaaaaghijaaaaaklaaamnopqaaaaaaaaaaaarstuvwxyzaaa"},
+		{"uncompressed", "01FF3F" + strings.Repeat("41", 4096), strings.Repeat("A", 4096)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compressed, err := hex.DecodeString(tt.compressed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := decompressVBA(compressed)
+			if err != nil {
+				t.Fatalf("decompressVBA failed: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	for _, compressed := range [][]byte{nil, {0}, {1, 0x19}, {1, 0x19, 0x00}, {1, 0x01, 0xb0, 0x01, 0x00}} {
+		if _, err := decompressVBA(compressed); err == nil {
+			t.Errorf("Expected an error for % x", compressed)
+		}
+	}
+}
+
+func TestVerify_VBA(t *testing.T) {
+	signature := signVBAForTest(t, vbaSourceForTest)
+	tests := []struct {
+		name     string
+		document func(source string, signature []byte) []byte
+	}{
+		{"Book1.xls", func(source string, signature []byte) []byte {
+			return vbaDocumentForTest(source, digSigBlobForTest(signature))
+		}},
+		{"Book1.xlsm", func(source string, signature []byte) []byte {
+			return vbaPackageForTest(t, source, signature)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), tt.name)
+			if err := os.WriteFile(filePath, tt.document(vbaSourceForTest, signature), 0600); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+			if fileType, err := DetectFileType(filePath); err != nil || fileType != FileTypeVBA {
+				t.Fatalf("Expected %q, got %q (%v)", FileTypeVBA, fileType, err)
+			}
+			if err := Verify(filePath, &VerifyOptions{Roots: testRoots(t)}); err != nil {
+				t.Fatalf("Expected valid VBA project, got %v", err)
+			}
+			extracted, err := ExtractDigitalSignature(filePath)
+			if err != nil {
+				t.Fatalf("ExtractDigitalSignature failed: %v", err)
+			}
+			if !bytes.Equal(extracted, signature) {
+				t.Error("Expected the signature of the VBA project")
+			}
+
+			tampered := strings.Replace(vbaSourceForTest, "Hello\"", "Hullo\"", 1)
+			if err := os.WriteFile(filePath, tt.document(tampered, signature), 0600); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+			if err := Verify(filePath, nil); !errors.Is(err, ErrDigestMismatch) {
+				t.Errorf("Expected ErrDigestMismatch for a modified module, got %v", err)
+			}
+
+			// Attribute lines are not covered by the content hash
+			reattributed := strings.Replace(vbaSourceForTest, "Module1\"", "Module2\"", 1)
+			if err := os.WriteFile(filePath, tt.document(reattributed, signature), 0600); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+			if err := Verify(filePath, nil); err != nil {
+				t.Errorf("Expected a changed Attribute line to verify, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVerify_VBAAgileOnly(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "Book1.xls")
+	data := vbaDocumentForTest(vbaSourceForTest, nil, digSigBlobForTest(signVBAForTest(t, vbaSourceForTest)))
+	if err := os.WriteFile(filePath, data, 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if err := Verify(filePath, nil); err == nil {
+		t.Error("Expected an error for a project with only an Agile signature")
+	}
+	if err := Verify(filePath, &VerifyOptions{SkipContentDigest: true}); err != nil {
+		t.Errorf("Expected the Agile signature to verify without its content hash, got %v", err)
+	}
+}
+
+func TestVerify_VBAUnsigned(t *testing.T) {
+	// A project without signatures is an ordinary compound file or package
+	data := vbaDocumentForTest(vbaSourceForTest)
+	filePath := filepath.Join(t.TempDir(), "Book1.xls")
+	if err := os.WriteFile(filePath, data, 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if fileType, err := DetectFileType(filePath); err != nil || fileType != FileTypeMSI {
+		t.Errorf("Expected %q, got %q (%v)", FileTypeMSI, fileType, err)
+	}
+
+	project, err := openVBAProject(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("openVBAProject failed: %v", err)
+	}
+	if _, err := project.signature(); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Expected ErrNotSigned, got %v", err)
+	}
+}
+
+func TestVBASignatureData_Truncated(t *testing.T) {
+	blob := digSigBlobForTest(bytes.Repeat([]byte{0x30}, 100))
+	for _, data := range [][]byte{blob[:20], blob[:len(blob)-1]} {
+		if _, err := vbaSignatureData(data); !errors.Is(err, ErrSignatureTruncated) {
+			t.Errorf("Expected ErrSignatureTruncated, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,713 @@
+package sigtool
+
+import (
+	"context"
+	"crypto"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"go.mozilla.org/pkcs7"
+)
+
+// VerifyOptions controls how signatures are verified.
+//
+// The zero value recomputes the content digest and verifies the signature
+// itself but does not perform any certificate chain validation, matching
+// IsValidDigitalSignature.
+type VerifyOptions struct {
+	// Roots is the set of trusted root certificates. When nil and
+	// UseSystemRoots is false, the signer certificate chain is not validated.
+	Roots *x509.CertPool
+	// UseSystemRoots validates the chain against the operating system trust
+	// store when Roots is nil.
+	UseSystemRoots bool
+	// UseWindowsStores adds the local machine's Windows CA store to the
+	// intermediates and, when Roots is nil, validates the chain against the
+	// ROOT store. It takes precedence over UseMicrosoftRoots and
+	// UseSystemRoots and fails with ErrWindowsStoresUnavailable elsewhere.
+	UseWindowsStores bool
+	// RequireTrustedPublisher additionally requires the signer certificate
+	// to be in the Windows TrustedPublisher store. It needs UseWindowsStores.
+	RequireTrustedPublisher bool
+	// UseMicrosoftRoots validates the chain against the embedded Microsoft
+	// Trusted Root Program code-signing roots when Roots is nil. It takes
+	// precedence over UseSystemRoots and requires the sigtool_msroots build
+	// tag; otherwise verification fails with ErrMicrosoftRootsUnavailable.
+	UseMicrosoftRoots bool
+	// Intermediates are additional intermediate certificates used for chain
+	// building on top of the certificates embedded in the signature.
+	Intermediates []*x509.Certificate
+	// CrossCertificates are cross-signed CA certificates, such as those that
+	// chain kernel-mode signing CAs to the Microsoft Code Verification Root.
+	// They are offered as alternative issuers, so a chain that does not
+	// reach a trusted root through the embedded certificates can still be
+	// built through a cross-certificate.
+	CrossCertificates []*x509.Certificate
+	// ModuleSigningCertificates are the certificates of the keys a Linux
+	// kernel trusts for module signatures, such as its signing_key.x509.
+	// Module signatures do not embed their signer, so a signed kernel
+	// module verifies only against one of these. Other file types ignore
+	// them.
+	ModuleSigningCertificates []*x509.Certificate
+	// PGPKeyring holds the OpenPGP keys trusted to sign RPM and Debian
+	// packages, such as the RPM-GPG-KEY files of a distribution. Without it, or when the
+	// signing key is not in it, package signatures fail with
+	// ErrSignerCertificateNotFound. The X.509 trust, pinning and revocation
+	// options do not apply to OpenPGP signatures.
+	PGPKeyring *PGPKeyring
+	// SecureBoot, when set, verifies PE images as UEFI firmware does with
+	// Secure Boot enabled: a signature must chain to a certificate of its
+	// db, or the authentihash be in its db, and neither the authentihash
+	// nor any signer may be in its dbx. The trust, pinning and revocation
+	// options do not apply to PE images then. VerifyDetailed and other
+	// file types ignore it.
+	SecureBoot *SecureBootPolicy
+	// VerificationTime is the time at which the certificate chain must be
+	// valid. When zero, the time asserted by the timestamp countersignature
+	// is used if the signature is timestamped and the current time otherwise,
+	// so signatures made while the certificate was valid survive its expiry.
+	VerificationTime time.Time
+	// RequiredEKUs lists the extended key usages acceptable for the signer
+	// chain; the chain must be valid for at least one of them, including
+	// through every intermediate. When empty, any usage is accepted.
+	RequiredEKUs []x509.ExtKeyUsage
+	// RequireCodeSigning requires the signer certificate to explicitly carry
+	// the Code Signing extended key usage (1.3.6.1.5.5.7.3.3). When the chain
+	// is validated and RequiredEKUs is empty, every intermediate must also
+	// permit code signing.
+	RequireCodeSigning bool
+	// AIAFetcher, when set, downloads intermediate certificates missing from
+	// the signature via Authority Information Access and retries chain
+	// validation with them
+	AIAFetcher *AIAFetcher
+	// OCSP, when set, checks every certificate of the validated signer and
+	// timestamp authority chains with the OCSP responders named in their
+	// Authority Information Access extensions. It has no effect when the
+	// chain is not validated.
+	OCSP *OCSPChecker
+	// CRL, when set, checks the same chains against certificate revocation
+	// lists. With OCSP also set, CRLs are consulted for certificates whose
+	// OCSP status cannot be determined.
+	CRL *CRLChecker
+	// SkipContentDigest disables recomputing the Authenticode digest of the
+	// file and comparing it with the signed digest.
+	SkipContentDigest bool
+	// RejectCertificateSlack fails verification with ErrCertificateSlack
+	// when the certificate table holds data beyond the PKCS#7 signature
+	// other than alignment padding, as Windows does with
+	// EnableCertPaddingCheck set.
+	RejectCertificateSlack bool
+	// StrictPEParsing fails verification of images whose headers debug/pe
+	// rejects instead of falling back to the lenient header parser
+	StrictPEParsing bool
+	// RejectWeakCrypto fails verification with a WeakCryptoError when the
+	// file digest is MD5 or SHA-1, or an embedded or validated chain
+	// certificate is signed with MD5 or SHA-1 or has an RSA key shorter than
+	// MinRSAKeyBits or a DSA key. Self-signed root signatures are ignored.
+	RejectWeakCrypto bool
+	// Denylist, when set, fails verification with a DeniedCertificateError
+	// when an embedded or validated chain certificate is on it. NewDenylist
+	// includes the known-bad certificates shipped with sigtool.
+	Denylist *Denylist
+	// RequiredThumbprints pins the signer certificate: when set, its SHA-1
+	// or SHA-256 fingerprint (hexadecimal, colons allowed) must be one of
+	// them, even if the chain is valid. Verification fails with
+	// ErrSignerNotPinned otherwise.
+	RequiredThumbprints []string
+	// RequiredSubjects pins the signer certificate by subject: when set, its
+	// distinguished name or its common name must match one of them. Names
+	// are compared with NamesMatch, so attribute order, case and spacing do
+	// not matter.
+	RequiredSubjects []string
+	// RequiredTeamID requires the code directory of every Mach-O slice and
+	// disk image to carry this Apple Developer Team ID, failing with
+	// ErrTeamIDMismatch otherwise. Other file types ignore it.
+	RequiredTeamID string
+	// FormatOnly checks the structure of the signature, the file digest and
+	// the signer and timestamp signatures but never validates certificate
+	// chains: the trust options, TrustedPublisher and revocation checks are
+	// ignored. It suits offline forensic analysis, where no trust store is
+	// meaningful but tampering must still be detected.
+	FormatOnly bool
+	// Workers bounds the number of files VerifyAll verifies concurrently;
+	// zero means runtime.GOMAXPROCS(0). Other functions ignore it.
+	Workers int
+	// Logger, when set, receives diagnostic records of the verification at
+	// debug level: the certificate table read, the digests compared, the
+	// trust anchors selected, the chains built and the revocation checks.
+	// Missing intermediates fetched via AIA are logged at info level. When
+	// nil, nothing is logged.
+	Logger *slog.Logger
+
+	// ctx is the context of VerifyContext, which bounds the OCSP, CRL and
+	// AIA requests of the verification
+	ctx context.Context
+}
+
+// Verify verifies the Authenticode signature of a PE file according to opts.
+//
+// Unlike IsValidDigitalSignature, Verify can validate the signer certificate
+// chain against a custom or system root pool with extra intermediates, at a
+// specific point in time and for specific extended key usages. Passing nil
+// opts is equivalent to passing the zero VerifyOptions. Windows Installer
+// packages are verified too: their digest covers every stream of the
+// package and, with an MsiDigitalSignatureEx stream, its directory metadata.
+//
+// Parameters:
+//   - filePath: The path to the PE file or Windows Installer package to verify
+//   - opts: Verification options, or nil for the defaults
+//
+// Returns:
+//   - error: nil if the signature is valid, otherwise an error describing the failure
+//
+// Example usage:
+//
+//	roots := x509.NewCertPool()
+//	roots.AppendCertsFromPEM(rootPEM)
+//	err := sigtool.Verify("signed.exe", &sigtool.VerifyOptions{
+//	    Roots:        roots,
+//	    RequiredEKUs: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+//	})
+func Verify(filePath string, opts *VerifyOptions) error {
+	if strings.TrimSpace(filePath) == "" {
+		return errors.New("file path cannot be empty")
+	}
+	if opts == nil {
+		opts = &VerifyOptions{}
+	}
+
+	// #nosec G304 - This tool is designed to read user-specified PE files
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to extract signature: failed to open file %q: %w", filePath, err)
+	}
+	defer f.Close()
+
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to extract signature: failed to get file info: %w", err)
+	}
+
+	return verifyAuthenticode(f, fileInfo.Size(), *opts)
+}
+
+// VerifyHashAndSignature verifies an Authenticode signature against a file
+// digest computed elsewhere, without access to the file itself.
+//
+// This supports detached and remote-signing workflows where only the
+// Authenticode hash of the image and its signature are available. The
+// function confirms that the digest stored in the signature matches
+// fileDigest, verifies the signer's signature over the authenticated
+// attributes and, when opts.Roots is set, validates the certificate chain.
+//
+// Security note: the result is only as trustworthy as fileDigest. The caller
+// is responsible for computing it with the Authenticode hashing rules over
+// the exact image being vouched for; this function cannot detect a digest
+// that was computed incorrectly or over a different file.
+//
+// Parameters:
+//   - algorithm: The hash algorithm used to compute fileDigest
+//   - fileDigest: The Authenticode digest of the PE image
+//   - signature: The raw PKCS#7 signature
+//   - opts: Certificate chain verification options
+//
+// Returns:
+//   - error: nil if the signature is valid for fileDigest, otherwise an error
+//     describing the failure
+//
+// Example usage:
+//
+//	err := sigtool.VerifyHashAndSignature(crypto.SHA256, digest, signature, sigtool.VerifyOptions{Roots: roots})
+//	if err != nil {
+//	    fmt.Printf("Signature validation failed: %v\n", err)
+//	}
+func VerifyHashAndSignature(algorithm crypto.Hash, fileDigest []byte, signature []byte, opts VerifyOptions) error {
+	if len(fileDigest) == 0 {
+		return errors.New("file digest cannot be empty")
+	}
+
+	p7, err := parsePKCS7(signature)
+	if err != nil {
+		return fmt.Errorf("failed to parse PKCS#7 signature: %w", err)
+	}
+
+	storedAlgorithm, stored, err := storedDigest(p7)
+	if err != nil {
+		return err
+	}
+	if storedAlgorithm != algorithm {
+		return fmt.Errorf("signature digest algorithm %v does not match %v", storedAlgorithm, algorithm)
+	}
+	if subtle.ConstantTimeCompare(stored, fileDigest) != 1 {
+		return &DigestMismatchError{Algorithm: algorithm, Signed: stored, Computed: fileDigest}
+	}
+
+	return verifySignedData(p7, opts)
+}
+
+// verifySignedData checks the PKCS#7 signer signature and timestamp and,
+// when roots are configured, the signer certificate chain.
+func verifySignedData(p7 *pkcs7.PKCS7, opts VerifyOptions) error {
+	if err := verifySignerSignature(p7); err != nil {
+		return err
+	}
+
+	if opts.Denylist != nil {
+		if err := opts.Denylist.check(p7.Certificates); err != nil {
+			return err
+		}
+	}
+	if len(opts.RequiredThumbprints) > 0 || len(opts.RequiredSubjects) > 0 {
+		signer := p7.GetOnlySigner()
+		if signer == nil {
+			return errors.New("signature must have exactly one signer with an embedded certificate")
+		}
+		if err := checkSignerPins(signer, opts); err != nil {
+			return err
+		}
+	}
+
+	trust, err := resolveTrust(opts)
+	if err != nil {
+		return err
+	}
+	roots := trust.roots
+	if roots == nil {
+		opts.logger().Debug("certificate chain not validated: no trust anchors selected")
+	}
+
+	if opts.RequireCodeSigning {
+		if err := checkCodeSigningEKU(p7); err != nil {
+			return err
+		}
+	}
+
+	ts, err := verifyTimestamp(p7, trust)
+	if err != nil {
+		return fmt.Errorf("timestamp verification failed: %w", err)
+	}
+	if roots == nil {
+		if opts.RejectWeakCrypto {
+			return checkWeakCrypto(p7, nil)
+		}
+		return nil
+	}
+
+	signer := p7.GetOnlySigner()
+	if signer == nil {
+		return errors.New("signature must have exactly one signer with an embedded certificate")
+	}
+	if trust.publishers != nil {
+		if err := checkTrustedPublisher(signer, trust.publishers); err != nil {
+			return err
+		}
+	}
+
+	verificationTime := opts.VerificationTime
+	if verificationTime.IsZero() && ts != nil {
+		verificationTime = ts.Time
+	}
+	chains, err := verifySignerChain(p7.Certificates, signer, opts, trust, verificationTime)
+	if err != nil {
+		return err
+	}
+	if opts.Denylist != nil {
+		for _, chain := range chains {
+			if err := opts.Denylist.check(chain); err != nil {
+				return err
+			}
+		}
+	}
+	if opts.RejectWeakCrypto {
+		if err := checkWeakCrypto(p7, chains); err != nil {
+			return err
+		}
+	}
+
+	return trust.checkRevocation(chains, verificationTime)
+}
+
+// verifyCertificateTrust applies the certificate checks of verifySignedData
+// to signer and the certificates certs accompanying it, for signatures that
+// are not Authenticode: the chain is validated against trust at
+// opts.VerificationTime, else at signingTime when it is not zero, else at
+// the current time. weak lists the weak cryptography of the signature
+// itself, reported with RejectWeakCrypto.
+func verifyCertificateTrust(signer *x509.Certificate, certs []*x509.Certificate, weak []WeakCryptoFinding, opts VerifyOptions, trust *trustConfig, signingTime time.Time) error {
+	if opts.Denylist != nil {
+		if err := opts.Denylist.check(certs); err != nil {
+			return err
+		}
+	}
+	if len(opts.RequiredThumbprints) > 0 || len(opts.RequiredSubjects) > 0 {
+		if err := checkSignerPins(signer, opts); err != nil {
+			return err
+		}
+	}
+
+	if opts.RequireCodeSigning {
+		if err := checkSignerCodeSigning(signer); err != nil {
+			return err
+		}
+	}
+	if trust.roots == nil {
+		opts.logger().Debug("certificate chain not validated: no trust anchors selected")
+		if opts.RejectWeakCrypto {
+			return weakCryptoError(weak, certs, nil)
+		}
+		return nil
+	}
+	if trust.publishers != nil {
+		if err := checkTrustedPublisher(signer, trust.publishers); err != nil {
+			return err
+		}
+	}
+
+	verificationTime := opts.VerificationTime
+	if verificationTime.IsZero() {
+		verificationTime = signingTime
+	}
+	chains, err := verifySignerChain(certs, signer, opts, trust, verificationTime)
+	if err != nil {
+		return err
+	}
+	if opts.Denylist != nil {
+		for _, chain := range chains {
+			if err := opts.Denylist.check(chain); err != nil {
+				return err
+			}
+		}
+	}
+	if opts.RejectWeakCrypto {
+		if err := weakCryptoError(weak, certs, chains); err != nil {
+			return err
+		}
+	}
+	return trust.checkRevocation(chains, verificationTime)
+}
+
+// verifySignerChain validates the chain of signer, using the certificates
+// embedded with it, against the roots of trust at verificationTime,
+// downloading missing intermediates when opts has an AIAFetcher
+func verifySignerChain(embedded []*x509.Certificate, signer *x509.Certificate, opts VerifyOptions, trust *trustConfig, verificationTime time.Time) ([][]*x509.Certificate, error) {
+	intermediates := trust.intermediates
+	keyUsages := opts.RequiredEKUs
+	if len(keyUsages) == 0 {
+		keyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+		if opts.RequireCodeSigning {
+			keyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}
+		}
+	}
+
+	chainOpts := x509.VerifyOptions{
+		Roots:         trust.roots,
+		Intermediates: certificatePool(embedded, intermediates),
+		CurrentTime:   verificationTime,
+		KeyUsages:     keyUsages,
+	}
+	log := opts.logger()
+	log.Debug("building certificate chain", "signer", signer.Subject.String(), "embedded", len(embedded), "intermediates", len(intermediates), "time", verificationTime)
+	chains, err := signer.Verify(chainOpts)
+	var unknownAuthority x509.UnknownAuthorityError
+	if err != nil && opts.AIAFetcher != nil && errors.As(err, &unknownAuthority) {
+		known := append([]*x509.Certificate{signer}, embedded...)
+		known = append(known, intermediates...)
+		fetched, fetchErr := opts.AIAFetcher.FetchIssuersContext(trust.context(), known)
+		log.Info("fetched intermediates via AIA", "count", len(fetched), "error", fetchErr)
+		if len(fetched) > 0 {
+			chainOpts.Intermediates = certificatePool(embedded, intermediates, fetched)
+			chains, err = signer.Verify(chainOpts)
+		}
+		if err != nil && fetchErr != nil {
+			return nil, fmt.Errorf("%w: %w (AIA fetch: %v)", ErrChainVerification, err, fetchErr)
+		}
+	}
+	if err != nil {
+		log.Debug("certificate chain rejected", "error", err)
+		return nil, fmt.Errorf("%w: %w", ErrChainVerification, err)
+	}
+	for _, chain := range chains {
+		log.Debug("built certificate chain", "chain", chainSubjects(chain))
+	}
+	return chains, nil
+}
+
+// trustConfig is the trust material selected by VerifyOptions
+type trustConfig struct {
+	// roots is nil when the chain is not validated
+	roots         *x509.CertPool
+	intermediates []*x509.Certificate
+	// publishers is non-nil when the signer must be a trusted publisher
+	publishers []*x509.Certificate
+	// ocsp and crl are non-nil when validated chains must pass OCSP and
+	// CRL checks
+	ocsp *OCSPChecker
+	crl  *CRLChecker
+	// log receives the revocation check records
+	log *slog.Logger
+	// ctx bounds the OCSP requests and CRL downloads of the revocation
+	// checks and the AIA downloads of chain building
+	ctx context.Context
+}
+
+// resolveTrust selects the roots and intermediates requested by opts
+func resolveTrust(opts VerifyOptions) (*trustConfig, error) {
+	log := opts.logger()
+	if opts.FormatOnly {
+		log.Debug("format-only verification: certificate chains are not validated")
+		return &trustConfig{log: log, ctx: opts.ctx}, nil
+	}
+	if opts.RequireTrustedPublisher && !opts.UseWindowsStores {
+		return nil, errors.New("RequireTrustedPublisher requires UseWindowsStores")
+	}
+	trust := &trustConfig{roots: opts.Roots, ocsp: opts.OCSP, crl: opts.CRL, log: log, ctx: opts.ctx}
+	trust.intermediates = append(append([]*x509.Certificate(nil), opts.Intermediates...), opts.CrossCertificates...)
+
+	var err error
+	switch {
+	case opts.UseWindowsStores:
+		log.Debug("using the Windows certificate stores")
+		stores, err := LoadWindowsStores()
+		if err != nil {
+			return nil, err
+		}
+		if trust.roots == nil {
+			trust.roots = stores.Roots
+		}
+		trust.intermediates = append(trust.intermediates, stores.Intermediates...)
+		if opts.RequireTrustedPublisher {
+			trust.publishers = append([]*x509.Certificate{}, stores.TrustedPublishers...)
+		}
+	case trust.roots != nil:
+		log.Debug("using the configured root certificates")
+	case opts.UseMicrosoftRoots:
+		log.Debug("using the Microsoft code-signing roots")
+		if trust.roots, err = MicrosoftRoots(); err != nil {
+			return nil, err
+		}
+	case opts.UseSystemRoots:
+		log.Debug("using the system root certificates")
+		if trust.roots, err = x509.SystemCertPool(); err != nil {
+			return nil, fmt.Errorf("failed to load system root certificates: %w", err)
+		}
+	}
+	return trust, nil
+}
+
+// context returns the context bounding the network requests of t, or
+// context.Background() when verification was not started with one
+func (t *trustConfig) context() context.Context {
+	if t.ctx == nil {
+		return context.Background()
+	}
+	return t.ctx
+}
+
+// checkRevocation applies the configured revocation checks to chains, the
+// candidate chains returned by x509.Certificate.Verify. One chain free of
+// revoked certificates is enough; otherwise the first failure is returned.
+// OCSP is consulted before CRLs, and a status neither determines fails only
+// when a hard-fail checker is configured. A zero at means the current time.
+func (t *trustConfig) checkRevocation(chains [][]*x509.Certificate, at time.Time) error {
+	var sources []revocationSource
+	hardFail := false
+	if t.ocsp != nil {
+		sources = append(sources, t.ocsp)
+		hardFail = hardFail || t.ocsp.HardFail
+	}
+	if t.crl != nil {
+		sources = append(sources, t.crl)
+		hardFail = hardFail || t.crl.HardFail
+	}
+	if len(sources) == 0 {
+		return nil
+	}
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	var firstErr error
+	for _, chain := range chains {
+		err := checkChainRevocation(t.context(), chain, at, hardFail, sources...)
+		if t.log != nil {
+			t.log.Debug("checked chain revocation", "chain", chainSubjects(chain), "hardFail", hardFail, "error", err)
+		}
+		if err == nil {
+			return nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// verifySignerSignature checks the signed messageDigest attribute of the
+// primary signer against the digest of the signed content, then verifies the
+// signer's signature over the authenticated attributes. The two failures are
+// reported as ErrMessageDigestMismatch and ErrInvalidSignature respectively.
+func verifySignerSignature(p7 *pkcs7.PKCS7) error {
+	if len(p7.Signers) == 0 {
+		return fmt.Errorf("%w: signature has no signers", ErrInvalidSignature)
+	}
+
+	algorithm, err := hashForOID(p7.Signers[0].DigestAlgorithm.Algorithm)
+	if err != nil {
+		return fmt.Errorf("unsupported signer digest algorithm: %w", err)
+	}
+	var messageDigest []byte
+	if err := p7.UnmarshalSignedAttribute(oidAttributeMessageDigest, &messageDigest); err != nil {
+		return fmt.Errorf("failed to read messageDigest attribute: %w", err)
+	}
+	content := algorithm.New()
+	content.Write(p7.Content)
+	if subtle.ConstantTimeCompare(content.Sum(nil), messageDigest) != 1 {
+		return ErrMessageDigestMismatch
+	}
+
+	if err := p7.Verify(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+	return nil
+}
+
+// checkCodeSigningEKU reports an error unless the signer certificate of p7
+// lists the Code Signing extended key usage
+func checkCodeSigningEKU(p7 *pkcs7.PKCS7) error {
+	signer := p7.GetOnlySigner()
+	if signer == nil {
+		return errors.New("signature must have exactly one signer with an embedded certificate")
+	}
+	return checkSignerCodeSigning(signer)
+}
+
+// checkSignerCodeSigning reports an error unless signer lists the Code
+// Signing extended key usage
+func checkSignerCodeSigning(signer *x509.Certificate) error {
+	for _, usage := range signer.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageCodeSigning {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrNotCodeSigning, signer.Subject)
+}
+
+// certificatePool returns a pool holding every certificate in sets
+func certificatePool(sets ...[]*x509.Certificate) *x509.CertPool {
+	pool := x509.NewCertPool()
+	for _, certs := range sets {
+		for _, cert := range certs {
+			pool.AddCert(cert)
+		}
+	}
+	return pool
+}
+
+// verifyAuthenticode performs full Authenticode verification of the PE image
+// in r: unless disabled, the recomputed file digest must match the signed
+// digest; the signer signature must verify and the chain is checked per opts.
+// Windows Installer packages, cabinets, MSIX, NuGet and OPC packages,
+// scripts, VBA projects, Mach-O binaries, disk images, installer packages,
+// kernel modules, RPM and Debian packages, APKs, JARs and AppImages are
+// verified by verifyMSI, verifyCAB, verifyMSIX, verifyNuGet, verifyOPC,
+// verifyScript, verifyVBA, verifyMachO, verifyDMG, verifyPKG,
+// verifyKernelModule, verifyRPM, verifyDebian, verifyAPK, verifyJAR and
+// verifyAppImage.
+func verifyAuthenticode(r io.ReaderAt, size int64, opts VerifyOptions) error {
+	// Read errors are left to the PE parser to report
+	switch fileType, _ := detectFileType(r, size); fileType {
+	case FileTypeMSI:
+		return verifyMSI(r, size, opts)
+	case FileTypeCAB:
+		return verifyCAB(r, size, opts)
+	case FileTypeMSIX:
+		return verifyMSIX(r, size, opts)
+	case FileTypeNuGet:
+		return verifyNuGet(r, size, opts)
+	case FileTypeOPC:
+		return verifyOPC(r, size, opts)
+	case FileTypeVBScript, FileTypeJScript, FileTypeWSF:
+		return verifyScript(r, size, opts)
+	case FileTypeVBA:
+		return verifyVBA(r, size, opts)
+	case FileTypeMachO:
+		return verifyMachO(r, size, opts)
+	case FileTypeDMG:
+		return verifyDMG(r, size, opts)
+	case FileTypePKG:
+		return verifyPKG(r, size, opts)
+	case FileTypeKernelModule:
+		return verifyKernelModule(r, size, opts)
+	case FileTypeRPM:
+		return verifyRPM(r, size, opts)
+	case FileTypeDeb:
+		return verifyDebian(r, size, opts)
+	case FileTypeAPK:
+		return verifyAPK(r, size, opts)
+	case FileTypeJAR:
+		return verifyJAR(r, size, opts)
+	case FileTypeAppImage:
+		return verifyAppImage(r, size, opts)
+	}
+	log := opts.logger()
+	layout, err := readPELayout(r, size, opts.StrictPEParsing)
+	if err != nil {
+		return fmt.Errorf("failed to extract signature: %w", err)
+	}
+	log.Debug("read certificate table", "fileSize", size, "offset", layout.certTableOffset, "size", layout.certTableSize)
+	if opts.SecureBoot != nil {
+		return verifySecureBoot(r, layout, opts.SecureBoot, opts)
+	}
+	signature, err := readSignature(r, layout)
+	if err != nil {
+		return fmt.Errorf("failed to extract signature: %w", err)
+	}
+	if opts.RejectCertificateSlack {
+		slack, err := certificateSlack(r, layout)
+		if err != nil {
+			return fmt.Errorf("failed to extract signature: %w", err)
+		}
+		if len(slack) > 0 {
+			return fmt.Errorf("%w: %d bytes at offset %d", ErrCertificateSlack, slack[0].Size, slack[0].Offset)
+		}
+	}
+
+	return verifySignatureDigest(signature, opts, func(algorithm crypto.Hash) ([]byte, error) {
+		return authentihash(r, layout, algorithm)
+	})
+}
+
+// verifySignatureDigest parses signature and, unless disabled, checks that the
+// digest of the signed file computed by digest matches the signed digest
+// before checking the signer signature and chain per opts
+func verifySignatureDigest(signature []byte, opts VerifyOptions, digest func(crypto.Hash) ([]byte, error)) error {
+	p7, err := parsePKCS7(signature)
+	if err != nil {
+		return fmt.Errorf("failed to parse PKCS#7 signature: %w", err)
+	}
+
+	if !opts.SkipContentDigest {
+		algorithm, stored, err := storedDigest(p7)
+		if err != nil {
+			return err
+		}
+		computed, err := digest(algorithm)
+		if err != nil {
+			return err
+		}
+		opts.logger().Debug("computed file digest", "algorithm", algorithm.String(), "signed", hex.EncodeToString(stored), "computed", hex.EncodeToString(computed))
+		if subtle.ConstantTimeCompare(stored, computed) != 1 {
+			return &DigestMismatchError{Algorithm: algorithm, Signed: stored, Computed: computed}
+		}
+	}
+
+	return verifySignedData(p7, opts)
+}
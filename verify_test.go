@@ -0,0 +1,267 @@
+package sigtool
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyHashAndSignature_Valid(t *testing.T) {
+	digest := mockAuthentihash(mockPEImage([]byte("payload")), crypto.SHA256)
+	signature := signAuthenticodeForTest(t, digest, crypto.SHA256)
+
+	if err := VerifyHashAndSignature(crypto.SHA256, digest, signature, VerifyOptions{}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if err := VerifyHashAndSignature(crypto.SHA256, digest, signature, VerifyOptions{Roots: testRoots(t)}); err != nil {
+		t.Fatalf("Expected chain verification to succeed, got: %v", err)
+	}
+}
+
+func TestVerifyHashAndSignature_DigestMismatch(t *testing.T) {
+	digest := mockAuthentihash(mockPEImage([]byte("payload")), crypto.SHA256)
+	signature := signAuthenticodeForTest(t, digest, crypto.SHA256)
+
+	other := mockAuthentihash(mockPEImage([]byte("tampered")), crypto.SHA256)
+	err := VerifyHashAndSignature(crypto.SHA256, other, signature, VerifyOptions{})
+	if err == nil {
+		t.Fatal("Expected error for mismatched digest, got nil")
+	}
+	if !strings.Contains(err.Error(), "does not match signed digest") {
+		t.Errorf("Expected 'does not match signed digest' error, got: %v", err)
+	}
+}
+
+func TestVerifyHashAndSignature_AlgorithmMismatch(t *testing.T) {
+	digest := mockAuthentihash(mockPEImage([]byte("payload")), crypto.SHA1)
+	signature := signAuthenticodeForTest(t, digest, crypto.SHA1)
+
+	err := VerifyHashAndSignature(crypto.SHA256, digest, signature, VerifyOptions{})
+	if err == nil {
+		t.Fatal("Expected error for mismatched algorithm, got nil")
+	}
+	if !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("Expected algorithm mismatch error, got: %v", err)
+	}
+}
+
+func TestVerifyHashAndSignature_UntrustedRoot(t *testing.T) {
+	digest := mockAuthentihash(mockPEImage([]byte("payload")), crypto.SHA256)
+	signature := signAuthenticodeForTest(t, digest, crypto.SHA256)
+
+	err := VerifyHashAndSignature(crypto.SHA256, digest, signature, VerifyOptions{Roots: x509.NewCertPool()})
+	if err == nil {
+		t.Fatal("Expected error for untrusted root, got nil")
+	}
+	if !strings.Contains(err.Error(), "certificate chain verification failed") {
+		t.Errorf("Expected chain verification error, got: %v", err)
+	}
+}
+
+func TestVerifyHashAndSignature_InvalidInput(t *testing.T) {
+	if err := VerifyHashAndSignature(crypto.SHA256, nil, []byte("x"), VerifyOptions{}); err == nil {
+		t.Error("Expected error for empty digest, got nil")
+	}
+
+	err := VerifyHashAndSignature(crypto.SHA256, []byte{1}, []byte("invalid-pkcs7-data"), VerifyOptions{})
+	if err == nil || !strings.Contains(err.Error(), "failed to parse PKCS#7") {
+		t.Errorf("Expected 'failed to parse PKCS#7' error, got: %v", err)
+	}
+}
+
+// testRoots returns a pool trusting the test signer certificate
+func testRoots(t *testing.T) *x509.CertPool {
+	t.Helper()
+
+	cert, _ := testSigner(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	return roots
+}
+
+func TestVerify_Options(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+
+	if err := Verify(filePath, nil); err != nil {
+		t.Fatalf("Expected nil options to verify, got: %v", err)
+	}
+
+	err := Verify(filePath, &VerifyOptions{
+		Roots:        testRoots(t),
+		RequiredEKUs: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	})
+	if err != nil {
+		t.Fatalf("Expected chain verification to succeed, got: %v", err)
+	}
+}
+
+func TestVerify_VerificationTime(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+
+	err := Verify(filePath, &VerifyOptions{
+		Roots:            testRoots(t),
+		VerificationTime: time.Now().Add(30 * 24 * time.Hour),
+	})
+	if err == nil || !strings.Contains(err.Error(), "certificate chain verification failed") {
+		t.Errorf("Expected expired chain error, got: %v", err)
+	}
+}
+
+func TestVerify_VerificationTimeWithinValidity(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+	cert, _ := testSigner(t)
+
+	err := Verify(filePath, &VerifyOptions{
+		Roots:            testRoots(t),
+		VerificationTime: cert.NotAfter.Add(-time.Minute),
+	})
+	if err != nil {
+		t.Errorf("Expected chain to verify at a time within its validity, got: %v", err)
+	}
+
+	err = Verify(filePath, &VerifyOptions{
+		Roots:            testRoots(t),
+		VerificationTime: cert.NotBefore.Add(-time.Minute),
+	})
+	if err == nil || !strings.Contains(err.Error(), "certificate chain verification failed") {
+		t.Errorf("Expected chain error before validity period, got: %v", err)
+	}
+}
+
+func TestVerify_TimestampTime(t *testing.T) {
+	cert, _ := testSigner(t)
+	payload := []byte("timestamped")
+
+	filePath, _ := createSignedMockPEWithPayload(t, crypto.SHA256, payload, withCounterSignature(t, cert.NotBefore.Add(time.Minute)))
+	if err := Verify(filePath, &VerifyOptions{Roots: testRoots(t)}); err != nil {
+		t.Errorf("Expected chain to verify at the timestamp time, got: %v", err)
+	}
+
+	// A timestamp outside the validity window fails even though the
+	// certificate is valid now, proving the timestamp time is used
+	filePath, _ = createSignedMockPEWithPayload(t, crypto.SHA256, payload, withRFC3161Timestamp(t, cert.NotBefore.Add(-time.Hour)))
+	err := Verify(filePath, &VerifyOptions{Roots: testRootsWithTSA(t)})
+	if err == nil || !strings.Contains(err.Error(), "certificate chain verification failed") {
+		t.Errorf("Expected chain error at the timestamp time, got: %v", err)
+	}
+
+	// An explicit verification time takes precedence over the timestamp
+	if err := Verify(filePath, &VerifyOptions{Roots: testRootsWithTSA(t), VerificationTime: time.Now()}); err != nil {
+		t.Errorf("Expected explicit verification time to take precedence, got: %v", err)
+	}
+}
+
+func TestVerify_RequiredEKUs(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+
+	err := Verify(filePath, &VerifyOptions{
+		Roots:        testRoots(t),
+		RequiredEKUs: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	if err == nil || !strings.Contains(err.Error(), "certificate chain verification failed") {
+		t.Errorf("Expected EKU error, got: %v", err)
+	}
+}
+
+func TestVerify_SkipContentDigest(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	content[mockHeaderSize] ^= 0xff
+	if err := os.WriteFile(filePath, content, 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	if err := Verify(filePath, &VerifyOptions{}); !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("Expected ErrDigestMismatch, got: %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{SkipContentDigest: true}); err != nil {
+		t.Errorf("Expected success with content digest check disabled, got: %v", err)
+	}
+}
+
+func TestVerify_EmptyPath(t *testing.T) {
+	if err := Verify(" ", nil); err == nil || !strings.Contains(err.Error(), "cannot be empty") {
+		t.Errorf("Expected 'cannot be empty' error, got: %v", err)
+	}
+}
+
+func TestVerify_RequireCodeSigning(t *testing.T) {
+	root := issueCertificateForTest(t, testCATemplate("sigtool test root", 1), nil)
+	intermediate := issueCertificateForTest(t, testCATemplate("sigtool test intermediate", 2), root)
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Cert)
+
+	codeSigner := issueCertificateForTest(t, testLeafTemplate("code signer", 3, x509.ExtKeyUsageCodeSigning), intermediate)
+	filePath := createSignedMockPEAs(t, codeSigner, crypto.SHA256)
+	if err := Verify(filePath, &VerifyOptions{Roots: roots, RequireCodeSigning: true}); err != nil {
+		t.Errorf("Expected code signing certificate to verify, got: %v", err)
+	}
+
+	tlsSigner := issueCertificateForTest(t, testLeafTemplate("tls server", 4, x509.ExtKeyUsageServerAuth), intermediate)
+	filePath = createSignedMockPEAs(t, tlsSigner, crypto.SHA256)
+	if err := Verify(filePath, &VerifyOptions{Roots: roots}); err != nil {
+		t.Errorf("Expected TLS certificate to pass without enforcement, got: %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{RequireCodeSigning: true}); !errors.Is(err, ErrNotCodeSigning) {
+		t.Errorf("Expected ErrNotCodeSigning, got: %v", err)
+	}
+
+	noEKU := issueCertificateForTest(t, testLeafTemplate("no eku", 5), intermediate)
+	filePath = createSignedMockPEAs(t, noEKU, crypto.SHA256)
+	if err := Verify(filePath, &VerifyOptions{Roots: roots, RequireCodeSigning: true}); !errors.Is(err, ErrNotCodeSigning) {
+		t.Errorf("Expected ErrNotCodeSigning for a certificate without EKUs, got: %v", err)
+	}
+}
+
+func TestVerify_RequireCodeSigningThroughIntermediates(t *testing.T) {
+	root := issueCertificateForTest(t, testCATemplate("sigtool test root", 1), nil)
+	tlsOnly := testCATemplate("tls only intermediate", 2)
+	tlsOnly.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	intermediate := issueCertificateForTest(t, tlsOnly, root)
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Cert)
+
+	signer := issueCertificateForTest(t, testLeafTemplate("code signer", 3, x509.ExtKeyUsageCodeSigning), intermediate)
+	filePath := createSignedMockPEAs(t, signer, crypto.SHA256)
+
+	err := Verify(filePath, &VerifyOptions{Roots: roots, RequireCodeSigning: true})
+	if err == nil || !strings.Contains(err.Error(), "certificate chain verification failed") {
+		t.Errorf("Expected intermediate EKU chaining error, got: %v", err)
+	}
+}
+
+func TestVerify_FormatOnly(t *testing.T) {
+	filePath, _ := createSignedMockPE(t, crypto.SHA256)
+
+	untrusted := &VerifyOptions{Roots: x509.NewCertPool(), UseWindowsStores: true, OCSP: NewOCSPChecker(0, true)}
+	if err := Verify(filePath, untrusted); err == nil {
+		t.Fatal("Expected chain validation against an empty pool to fail")
+	}
+	untrusted.FormatOnly = true
+	if err := Verify(filePath, untrusted); err != nil {
+		t.Fatalf("Expected format-only verification to ignore trust, got: %v", err)
+	}
+	if c := VerifyDetailed(filePath, untrusted).Check(CheckChain); c == nil || c.Status != StatusSkipped {
+		t.Errorf("Expected the chain check to be skipped, got: %+v", c)
+	}
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	content[mockHeaderSize] ^= 0xff
+	if err := os.WriteFile(filePath, content, 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if err := Verify(filePath, &VerifyOptions{FormatOnly: true}); !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("Expected format-only verification to detect tampering, got: %v", err)
+	}
+}
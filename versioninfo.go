@@ -0,0 +1,282 @@
+package sigtool
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	// rtVersion is the RT_VERSION resource type
+	rtVersion = 16
+	// vsFixedFileInfoSignature starts a VS_FIXEDFILEINFO structure
+	vsFixedFileInfoSignature = 0xfeef04bd
+	// maxResourceDepth bounds the resource directory tree walk
+	maxResourceDepth = 3
+)
+
+// VersionInfo is the VERSIONINFO resource of a PE file.
+type VersionInfo struct {
+	// FileVersion and ProductVersion are the binary versions of the
+	// VS_FIXEDFILEINFO structure, e.g. "10.0.19041.1"
+	FileVersion    string
+	ProductVersion string
+	// Language is the key of the string table used, e.g. "040904b0"
+	Language string
+	// CompanyName, FileDescription, ProductName and OriginalFilename are
+	// the corresponding entries of Strings
+	CompanyName      string
+	FileDescription  string
+	ProductName      string
+	OriginalFilename string
+	// Strings holds every entry of the string table
+	Strings map[string]string
+}
+
+// versionBlock is a node of the VS_VERSIONINFO tree
+type versionBlock struct {
+	key      string
+	value    []byte
+	text     bool
+	children []versionBlock
+}
+
+// ReadVersionInfo parses the VERSIONINFO resource of a PE file.
+//
+// The fixed file and product versions are read from VS_FIXEDFILEINFO and
+// the strings from the first StringFileInfo table, which is the one
+// Explorer shows for single-language binaries. These fields are chosen by
+// whoever built the binary and prove nothing on their own; compare them
+// with the signer, as CheckCompanyName does.
+//
+// Parameters:
+//   - filePath: The path to the PE file
+//
+// Returns:
+//   - *VersionInfo: The parsed resource
+//   - error: ErrNoVersionInfo if the file has no VERSIONINFO resource, or an
+//     error if it is not a PE file or the resource is malformed
+//
+// Example usage:
+//
+//	vi, err := sigtool.ReadVersionInfo("app.exe")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	fmt.Printf("%s %s\n", vi.CompanyName, vi.FileVersion)
+func ReadVersionInfo(filePath string) (*VersionInfo, error) {
+	// #nosec G304 - This tool is designed to read user-specified PE files
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %q: %w", filePath, err)
+	}
+	defer f.Close()
+
+	pefile, err := pe.NewFile(f)
+	if err != nil {
+		return nil, &PEFormatError{Err: err}
+	}
+	defer pefile.Close()
+
+	data, err := versionResource(pefile)
+	if err != nil {
+		return nil, err
+	}
+	root, _, err := parseVersionBlock(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VERSIONINFO resource: %w", err)
+	}
+	if root.key != "VS_VERSION_INFO" {
+		return nil, fmt.Errorf("invalid VERSIONINFO resource: unexpected key %q", root.key)
+	}
+
+	vi := &VersionInfo{Strings: make(map[string]string)}
+	if len(root.value) >= 24 && binary.LittleEndian.Uint32(root.value) == vsFixedFileInfoSignature {
+		vi.FileVersion = formatFixedVersion(root.value[8:16])
+		vi.ProductVersion = formatFixedVersion(root.value[16:24])
+	}
+	for _, child := range root.children {
+		if child.key != "StringFileInfo" || len(child.children) == 0 {
+			continue
+		}
+		table := child.children[0]
+		vi.Language = table.key
+		for _, s := range table.children {
+			vi.Strings[s.key] = decodeUTF16(s.value)
+		}
+		break
+	}
+	vi.CompanyName = vi.Strings["CompanyName"]
+	vi.FileDescription = vi.Strings["FileDescription"]
+	vi.ProductName = vi.Strings["ProductName"]
+	vi.OriginalFilename = vi.Strings["OriginalFilename"]
+	return vi, nil
+}
+
+// versionResource returns the data of the first RT_VERSION resource of
+// pefile
+func versionResource(pefile *pe.File) ([]byte, error) {
+	var dir pe.DataDirectory
+	switch h := pefile.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		if h.NumberOfRvaAndSizes > pe.IMAGE_DIRECTORY_ENTRY_RESOURCE {
+			dir = h.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_RESOURCE]
+		}
+	case *pe.OptionalHeader64:
+		if h.NumberOfRvaAndSizes > pe.IMAGE_DIRECTORY_ENTRY_RESOURCE {
+			dir = h.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_RESOURCE]
+		}
+	}
+	if dir.VirtualAddress == 0 || dir.Size == 0 {
+		return nil, ErrNoVersionInfo
+	}
+	rsrc, err := readRVA(pefile, dir.VirtualAddress, dir.Size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read resource directory: %w", err)
+	}
+
+	// The tree has type, name and language levels; the first entry of the
+	// RT_VERSION type is used at the lower levels
+	offset := uint32(0)
+	want := uint32(rtVersion)
+	for depth := 0; depth < maxResourceDepth; depth++ {
+		next, ok, err := findResourceEntry(rsrc, offset, want, depth > 0)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrNoVersionInfo
+		}
+		if depth < maxResourceDepth-1 {
+			if next&0x80000000 == 0 {
+				return nil, errors.New("invalid resource directory: expected a subdirectory")
+			}
+			offset = next &^ 0x80000000
+			continue
+		}
+		if next&0x80000000 != 0 || int64(next)+16 > int64(len(rsrc)) {
+			return nil, errors.New("invalid resource directory: bad data entry")
+		}
+		rva := binary.LittleEndian.Uint32(rsrc[next:])
+		size := binary.LittleEndian.Uint32(rsrc[next+4:])
+		return readRVA(pefile, rva, size)
+	}
+	return nil, ErrNoVersionInfo
+}
+
+// findResourceEntry returns the offset field of the entry with integer ID
+// id in the resource directory at offset, or of its first entry when first is
+// set
+func findResourceEntry(rsrc []byte, offset, id uint32, first bool) (uint32, bool, error) {
+	if int64(offset)+16 > int64(len(rsrc)) {
+		return 0, false, errors.New("invalid resource directory: truncated")
+	}
+	named := uint32(binary.LittleEndian.Uint16(rsrc[offset+12:]))
+	ids := uint32(binary.LittleEndian.Uint16(rsrc[offset+14:]))
+	entries := int64(offset) + 16
+	if entries+8*int64(named+ids) > int64(len(rsrc)) {
+		return 0, false, errors.New("invalid resource directory: truncated")
+	}
+	for i := uint32(0); i < named+ids; i++ {
+		entry := rsrc[entries+8*int64(i):]
+		name := binary.LittleEndian.Uint32(entry)
+		if first || (name&0x80000000 == 0 && name == id) {
+			return binary.LittleEndian.Uint32(entry[4:]), true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// readRVA returns size bytes of pefile at the relative virtual address rva
+func readRVA(pefile *pe.File, rva, size uint32) ([]byte, error) {
+	for _, s := range pefile.Sections {
+		if rva < s.VirtualAddress || rva-s.VirtualAddress >= max(s.VirtualSize, s.Size) {
+			continue
+		}
+		start := int64(rva - s.VirtualAddress)
+		if start+int64(size) > int64(s.Size) {
+			return nil, fmt.Errorf("RVA range %#x+%d exceeds section %s", rva, size, s.Name)
+		}
+		buf := make([]byte, size)
+		if _, err := s.ReadAt(buf, start); err != nil {
+			return nil, fmt.Errorf("failed to read section %s: %w", s.Name, err)
+		}
+		return buf, nil
+	}
+	return nil, fmt.Errorf("RVA %#x is not in any section", rva)
+}
+
+// parseVersionBlock parses the version block at the start of b and returns
+// it with its length
+func parseVersionBlock(b []byte) (versionBlock, int, error) {
+	if len(b) < 6 {
+		return versionBlock{}, 0, errors.New("truncated block")
+	}
+	length := int(binary.LittleEndian.Uint16(b))
+	valueLength := int(binary.LittleEndian.Uint16(b[2:]))
+	blockType := binary.LittleEndian.Uint16(b[4:])
+	if length < 6 || length > len(b) {
+		return versionBlock{}, 0, fmt.Errorf("block length %d out of range", length)
+	}
+	b = b[:length]
+
+	var key []uint16
+	pos := 6
+	for ; pos+1 < length; pos += 2 {
+		c := binary.LittleEndian.Uint16(b[pos:])
+		if c == 0 {
+			break
+		}
+		key = append(key, c)
+	}
+	block := versionBlock{key: string(utf16.Decode(key)), text: blockType == 1}
+	pos = align4(pos + 2)
+
+	// Text values are measured in characters
+	if block.text {
+		valueLength *= 2
+	}
+	if pos < length {
+		valueLength = min(valueLength, length-pos)
+		block.value = b[pos : pos+valueLength]
+		pos = align4(pos + valueLength)
+	}
+	for pos < length {
+		child, n, err := parseVersionBlock(b[pos:])
+		if err != nil {
+			return versionBlock{}, 0, err
+		}
+		block.children = append(block.children, child)
+		pos = align4(pos + n)
+	}
+	return block, length, nil
+}
+
+func align4(n int) int {
+	return (n + 3) &^ 3
+}
+
+// formatFixedVersion renders the most and least significant doublewords of
+// a VS_FIXEDFILEINFO version
+func formatFixedVersion(b []byte) string {
+	ms := binary.LittleEndian.Uint32(b)
+	ls := binary.LittleEndian.Uint32(b[4:])
+	return fmt.Sprintf("%d.%d.%d.%d", ms>>16, ms&0xffff, ls>>16, ls&0xffff)
+}
+
+// decodeUTF16 decodes a little-endian UTF-16 value up to its terminator
+func decodeUTF16(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		c := binary.LittleEndian.Uint16(b[i:])
+		if c == 0 {
+			break
+		}
+		units = append(units, c)
+	}
+	return strings.TrimSpace(string(utf16.Decode(units)))
+}
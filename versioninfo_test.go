@@ -0,0 +1,177 @@
+package sigtool
+
+import (
+	"crypto"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+)
+
+// utf16ForTest encodes s as NUL-terminated little-endian UTF-16
+func utf16ForTest(s string) []byte {
+	units := append(utf16.Encode([]rune(s)), 0)
+	b := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(b[2*i:], u)
+	}
+	return b
+}
+
+// versionBlockForTest encodes a VS_VERSIONINFO block
+func versionBlockForTest(key string, value []byte, text bool, children ...[]byte) []byte {
+	pad := func(b []byte) []byte {
+		for len(b)%4 != 0 {
+			b = append(b, 0)
+		}
+		return b
+	}
+	b := pad(append(make([]byte, 6), utf16ForTest(key)...))
+	b = append(b, value...)
+	for _, child := range children {
+		b = append(pad(b), child...)
+	}
+	valueLength, blockType := len(value), uint16(0)
+	if text {
+		valueLength, blockType = len(value)/2, 1
+	}
+	binary.LittleEndian.PutUint16(b, uint16(len(b)))
+	binary.LittleEndian.PutUint16(b[2:], uint16(valueLength))
+	binary.LittleEndian.PutUint16(b[4:], blockType)
+	return b
+}
+
+// versionInfoPEForTest builds a PE image with a .rsrc section holding a
+// VERSIONINFO resource with file version 1.2.3.4 and strings
+func versionInfoPEForTest(strings map[string]string) []byte {
+	const (
+		rawOffset = 0x200
+		rva       = 0x1000
+	)
+	fixed := make([]byte, 52)
+	binary.LittleEndian.PutUint32(fixed, vsFixedFileInfoSignature)
+	binary.LittleEndian.PutUint32(fixed[4:], 0x10000)
+	binary.LittleEndian.PutUint32(fixed[8:], 1<<16|2)
+	binary.LittleEndian.PutUint32(fixed[12:], 3<<16|4)
+	binary.LittleEndian.PutUint32(fixed[16:], 5<<16|6)
+	var entries [][]byte
+	for _, key := range []string{"CompanyName", "FileDescription", "ProductName", "OriginalFilename"} {
+		if value, ok := strings[key]; ok {
+			entries = append(entries, versionBlockForTest(key, utf16ForTest(value), true))
+		}
+	}
+	info := versionBlockForTest("VS_VERSION_INFO", fixed, false,
+		versionBlockForTest("StringFileInfo", nil, true, versionBlockForTest("040904b0", nil, true, entries...)),
+		versionBlockForTest("VarFileInfo", nil, true, versionBlockForTest("Translation", []byte{0x09, 0x04, 0xb0, 0x04}, false)))
+
+	// Type, name and language directories, each with one entry, then the
+	// data entry and the resource data
+	rsrc := make([]byte, 88, 88+len(info))
+	binary.LittleEndian.PutUint16(rsrc[14:], 1)
+	binary.LittleEndian.PutUint32(rsrc[16:], rtVersion)
+	binary.LittleEndian.PutUint32(rsrc[20:], 0x80000000|24)
+	binary.LittleEndian.PutUint16(rsrc[24+14:], 1)
+	binary.LittleEndian.PutUint32(rsrc[40:], 1)
+	binary.LittleEndian.PutUint32(rsrc[44:], 0x80000000|48)
+	binary.LittleEndian.PutUint16(rsrc[48+14:], 1)
+	binary.LittleEndian.PutUint32(rsrc[64:], 0x409)
+	binary.LittleEndian.PutUint32(rsrc[68:], 72)
+	binary.LittleEndian.PutUint32(rsrc[72:], rva+88)
+	binary.LittleEndian.PutUint32(rsrc[76:], uint32(len(info)))
+	rsrc = append(rsrc, info...)
+	rawSize := (len(rsrc) + 0x1ff) &^ 0x1ff
+
+	image := mockPEImage(make([]byte, rawOffset-mockHeaderSize+rawSize))
+	binary.LittleEndian.PutUint16(image[70:], 1)
+	binary.LittleEndian.PutUint32(image[mockOptHeaderOffset+56:], rva+0x1000)
+	binary.LittleEndian.PutUint32(image[mockOptHeaderOffset+60:], rawOffset)
+	binary.LittleEndian.PutUint32(image[mockOptHeaderOffset+96+2*8:], rva)
+	binary.LittleEndian.PutUint32(image[mockOptHeaderOffset+96+2*8+4:], uint32(len(rsrc)))
+	section := image[mockHeaderSize:]
+	copy(section, ".rsrc")
+	binary.LittleEndian.PutUint32(section[8:], uint32(len(rsrc)))
+	binary.LittleEndian.PutUint32(section[12:], rva)
+	binary.LittleEndian.PutUint32(section[16:], uint32(rawSize))
+	binary.LittleEndian.PutUint32(section[20:], rawOffset)
+	binary.LittleEndian.PutUint32(section[36:], 0x40000040)
+	copy(image[rawOffset:], rsrc)
+	return image
+}
+
+// writeSignedVersionInfoPEForTest signs a VERSIONINFO image as id and
+// writes it to a file
+func writeSignedVersionInfoPEForTest(t *testing.T, id *testIdentity, company string) string {
+	t.Helper()
+	image := versionInfoPEForTest(map[string]string{"CompanyName": company, "ProductName": "Test Product"})
+	signed := embedSignatureForTest(image, signAuthenticodeAsForTest(t, id, mockAuthentihash(image, crypto.SHA256), crypto.SHA256))
+	filePath := filepath.Join(t.TempDir(), "versioned.exe")
+	if err := os.WriteFile(filePath, signed, 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	return filePath
+}
+
+func TestReadVersionInfo(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "versioned.exe")
+	image := versionInfoPEForTest(map[string]string{"CompanyName": "Contoso Ltd", "FileDescription": "Contoso Updater", "OriginalFilename": "update.exe"})
+	if err := os.WriteFile(filePath, image, 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	vi, err := ReadVersionInfo(filePath)
+	if err != nil {
+		t.Fatalf("ReadVersionInfo failed: %v", err)
+	}
+	if vi.CompanyName != "Contoso Ltd" || vi.FileDescription != "Contoso Updater" || vi.OriginalFilename != "update.exe" {
+		t.Errorf("Unexpected strings: %+v", vi.Strings)
+	}
+	if vi.FileVersion != "1.2.3.4" || vi.ProductVersion != "5.6.0.0" {
+		t.Errorf("Unexpected versions %q and %q", vi.FileVersion, vi.ProductVersion)
+	}
+	if vi.Language != "040904b0" {
+		t.Errorf("Language = %q, want 040904b0", vi.Language)
+	}
+}
+
+func TestReadVersionInfo_Missing(t *testing.T) {
+	filePath := writeUnsignedPEForTest(t, []byte("no resources"))
+	if _, err := ReadVersionInfo(filePath); !errors.Is(err, ErrNoVersionInfo) {
+		t.Errorf("Expected ErrNoVersionInfo, got: %v", err)
+	}
+}
+
+func TestCheckCompanyName(t *testing.T) {
+	microsoft := testLeafTemplate("Microsoft Corporation", 1)
+	microsoft.Subject.Organization = []string{"Microsoft Corporation"}
+	microsoftSigner := issueCertificateForTest(t, microsoft, nil)
+	otherSigner := issueCertificateForTest(t, testLeafTemplate("Totally Legit Software LLC", 2), nil)
+
+	tests := []struct {
+		name     string
+		signer   *testIdentity
+		company  string
+		mismatch bool
+	}{
+		{"impersonation", otherSigner, "Microsoft Corporation", true},
+		{"trademark punctuation", otherSigner, "Microsoft® Corporation", true},
+		{"genuine vendor", microsoftSigner, "Microsoft Corporation", false},
+		{"unknown vendor", otherSigner, "Contoso Ltd", false},
+		{"word boundary", otherSigner, "Intellectual Ventures", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mismatch, err := CheckCompanyName(writeSignedVersionInfoPEForTest(t, tt.signer, tt.company))
+			if err != nil {
+				t.Fatalf("CheckCompanyName failed: %v", err)
+			}
+			if (mismatch != nil) != tt.mismatch {
+				t.Fatalf("mismatch = %v, want %v", mismatch, tt.mismatch)
+			}
+			if mismatch != nil && (mismatch.Vendor != "Microsoft" || mismatch.CompanyName != tt.company) {
+				t.Errorf("Unexpected mismatch: %+v", mismatch)
+			}
+		})
+	}
+}
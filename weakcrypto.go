@@ -0,0 +1,234 @@
+package sigtool
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mozilla.org/pkcs7"
+)
+
+// MinRSAKeyBits is the smallest RSA modulus not reported as weak
+const MinRSAKeyBits = 2048
+
+// WeakCryptoKind classifies a weak cryptography finding.
+type WeakCryptoKind int
+
+const (
+	// WeakFileDigest is an MD5 or SHA-1 Authenticode file digest
+	WeakFileDigest WeakCryptoKind = iota + 1
+	// WeakCertificateSignature is a certificate signed with MD5 or SHA-1
+	WeakCertificateSignature
+	// WeakRSAKey is an RSA key shorter than MinRSAKeyBits
+	WeakRSAKey
+	// WeakDSAKey is a DSA key of any size
+	WeakDSAKey
+)
+
+func (k WeakCryptoKind) String() string {
+	switch k {
+	case WeakFileDigest:
+		return "weak file digest"
+	case WeakCertificateSignature:
+		return "weak certificate signature"
+	case WeakRSAKey:
+		return "weak RSA key"
+	case WeakDSAKey:
+		return "DSA key"
+	}
+	return fmt.Sprintf("WeakCryptoKind(%d)", int(k))
+}
+
+// WeakCryptoFinding is a use of deprecated cryptography in a signature.
+type WeakCryptoFinding struct {
+	// Kind classifies the finding
+	Kind WeakCryptoKind
+	// Signature is the index of the affected signature: 0 for the primary
+	// signature, followed by nested signatures in order
+	Signature int
+	// Certificate is the affected certificate, nil for WeakFileDigest
+	Certificate *x509.Certificate `json:"-"`
+	// Subject is the subject of Certificate, empty for WeakFileDigest
+	Subject string `json:",omitempty"`
+	// Detail names the weak algorithm, e.g. "SHA1-RSA" or "RSA 1024-bit"
+	Detail string
+}
+
+func (f WeakCryptoFinding) String() string {
+	if f.Certificate == nil {
+		return fmt.Sprintf("%s: %s", f.Kind, f.Detail)
+	}
+	return fmt.Sprintf("%s: %s in certificate %q", f.Kind, f.Detail, f.Subject)
+}
+
+// WeakCryptoError is returned by verification with RejectWeakCrypto when
+// the signature relies on weak cryptography. It matches ErrWeakCrypto with
+// errors.Is.
+type WeakCryptoError struct {
+	// Findings lists every weak algorithm found
+	Findings []WeakCryptoFinding
+}
+
+func (e *WeakCryptoError) Error() string {
+	findings := make([]string, len(e.Findings))
+	for i, f := range e.Findings {
+		findings[i] = f.String()
+	}
+	return fmt.Sprintf("%v: %s", ErrWeakCrypto, strings.Join(findings, "; "))
+}
+
+// Is reports whether target is ErrWeakCrypto.
+func (e *WeakCryptoError) Is(target error) bool { return target == ErrWeakCrypto }
+
+// FindWeakCrypto reports the weak cryptography used by the signatures of a
+// PE file without verifying them.
+//
+// MD5 and SHA-1 file digests, certificates signed with MD5 or SHA-1, RSA keys
+// shorter than MinRSAKeyBits and DSA keys are reported for the primary and
+// every nested signature. The signatures of self-signed roots are not
+// reported, since their trust does not depend on them. Only embedded
+// certificates are inspected; verification with RejectWeakCrypto also checks
+// the roots of the validated chain.
+//
+// Parameters:
+//   - filePath: The path to the signed PE file
+//
+// Returns:
+//   - []WeakCryptoFinding: The findings, empty when none is found
+//   - error: An error if a signature cannot be extracted or parsed
+//
+// Example usage:
+//
+//	findings, err := sigtool.FindWeakCrypto("signed.exe")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	for _, f := range findings {
+//	    fmt.Printf("signature %d: %s\n", f.Signature, f)
+//	}
+func FindWeakCrypto(filePath string) ([]WeakCryptoFinding, error) {
+	if strings.TrimSpace(filePath) == "" {
+		return nil, errors.New("file path cannot be empty")
+	}
+
+	raw, err := ExtractDigitalSignature(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if isXMLSignature(raw) {
+		sig, err := parseXMLSignature(raw)
+		if err != nil {
+			return nil, err
+		}
+		return sig.weakFindings(), nil
+	}
+	primary, err := parsePKCS7(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS#7 signature: %w", err)
+	}
+	signatures := []*pkcs7.PKCS7{primary}
+
+	nested, err := nestedSignatures(primary)
+	if err != nil {
+		return nil, err
+	}
+	for _, der := range nested {
+		p7, err := parsePKCS7(der)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse nested PKCS#7 signature: %w", err)
+		}
+		signatures = append(signatures, p7)
+	}
+
+	var findings []WeakCryptoFinding
+	for i, p7 := range signatures {
+		found, err := weakSignatureFindings(p7, i)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, found...)
+	}
+	return findings, nil
+}
+
+// weakSignatureFindings reports the weak file digest and embedded
+// certificates of p7, the signature at index
+func weakSignatureFindings(p7 *pkcs7.PKCS7, index int) ([]WeakCryptoFinding, error) {
+	algorithm, _, err := storedDigest(p7)
+	if err != nil {
+		return nil, err
+	}
+	var findings []WeakCryptoFinding
+	if algorithm == crypto.MD5 || algorithm == crypto.SHA1 {
+		findings = append(findings, WeakCryptoFinding{Kind: WeakFileDigest, Signature: index, Detail: algorithm.String()})
+	}
+	return append(findings, weakCertificateFindings(p7.Certificates, index)...), nil
+}
+
+// weakCertificateFindings reports the weak signatures and keys of certs
+func weakCertificateFindings(certs []*x509.Certificate, index int) []WeakCryptoFinding {
+	var findings []WeakCryptoFinding
+	add := func(cert *x509.Certificate, kind WeakCryptoKind, detail string) {
+		findings = append(findings, WeakCryptoFinding{
+			Kind:        kind,
+			Signature:   index,
+			Certificate: cert,
+			Subject:     cert.Subject.String(),
+			Detail:      detail,
+		})
+	}
+
+	for _, cert := range certs {
+		switch cert.SignatureAlgorithm {
+		case x509.MD2WithRSA, x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+			if !selfIssued(cert) {
+				add(cert, WeakCertificateSignature, cert.SignatureAlgorithm.String())
+			}
+		}
+		if key, ok := cert.PublicKey.(*rsa.PublicKey); ok && key.N.BitLen() < MinRSAKeyBits {
+			add(cert, WeakRSAKey, fmt.Sprintf("RSA %d-bit", key.N.BitLen()))
+		}
+		if cert.PublicKeyAlgorithm == x509.DSA {
+			add(cert, WeakDSAKey, "DSA")
+		}
+	}
+	return findings
+}
+
+// checkWeakCrypto fails with a WeakCryptoError when p7 or the certificates
+// of chains use weak cryptography
+func checkWeakCrypto(p7 *pkcs7.PKCS7, chains [][]*x509.Certificate) error {
+	findings, err := weakSignatureFindings(p7, 0)
+	if err != nil {
+		return err
+	}
+	return weakCryptoError(findings, p7.Certificates, chains)
+}
+
+// weakCryptoError returns a WeakCryptoError of findings, the findings of a
+// signature and its embedded certificates embedded, and of the other
+// certificates of chains, or nil when there are none
+func weakCryptoError(findings []WeakCryptoFinding, embedded []*x509.Certificate, chains [][]*x509.Certificate) error {
+	seen := make(map[string]bool)
+	for _, cert := range embedded {
+		seen[string(cert.Raw)] = true
+	}
+	var chained []*x509.Certificate
+	for _, chain := range chains {
+		for _, cert := range chain {
+			if !seen[string(cert.Raw)] {
+				seen[string(cert.Raw)] = true
+				chained = append(chained, cert)
+			}
+		}
+	}
+	findings = append(findings, weakCertificateFindings(chained, 0)...)
+
+	if len(findings) > 0 {
+		return &WeakCryptoError{Findings: findings}
+	}
+	return nil
+}
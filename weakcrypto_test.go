@@ -0,0 +1,109 @@
+package sigtool
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// weakCertificateForTest returns a 1024-bit certificate signed with SHA-1
+// by parent
+func weakCertificateForTest(t *testing.T, parent *testIdentity) *x509.Certificate {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := testCATemplate("weak intermediate", 77)
+	template.NotBefore, template.NotAfter = parent.Cert.NotBefore, parent.Cert.NotAfter
+	template.SignatureAlgorithm = x509.SHA1WithRSA
+	der, err := x509.CreateCertificate(rand.Reader, template, parent.Cert, &key.PublicKey, parent.Key)
+	if err != nil {
+		t.Skipf("SHA-1 certificates cannot be created: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	return cert
+}
+
+func TestFindWeakCrypto(t *testing.T) {
+	ca := issueCertificateForTest(t, testCATemplate("weak crypto root", 70), nil)
+	leaf := issueCertificateForTest(t, testLeafTemplate("weak crypto signer", 71, x509.ExtKeyUsageCodeSigning), ca)
+
+	findings, err := FindWeakCrypto(createSignedMockPEAs(t, leaf, crypto.SHA256))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(findings) != 0 {
+		t.Errorf("Expected no findings, got %v", findings)
+	}
+
+	findings, err = FindWeakCrypto(createSignedMockPEAs(t, leaf, crypto.SHA1))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(findings) != 1 || findings[0].Kind != WeakFileDigest || findings[0].Detail != "SHA-1" {
+		t.Errorf("Expected a SHA-1 file digest finding, got %v", findings)
+	}
+
+	weak := weakCertificateForTest(t, ca)
+	leaf.Chain = append(leaf.Chain, weak)
+	findings, err = FindWeakCrypto(createSignedMockPEAs(t, leaf, crypto.SHA256))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	kinds := make(map[WeakCryptoKind]bool)
+	for _, f := range findings {
+		if !f.Certificate.Equal(weak) {
+			t.Errorf("Unexpected finding for %q: %s", f.Subject, f)
+		}
+		kinds[f.Kind] = true
+	}
+	if len(findings) != 2 || !kinds[WeakCertificateSignature] || !kinds[WeakRSAKey] {
+		t.Errorf("Expected weak signature and key findings, got %v", findings)
+	}
+	if err := (&WeakCryptoError{Findings: findings}); !strings.Contains(err.Error(), "RSA 1024-bit") {
+		t.Errorf("Expected the key size in the error, got: %v", err)
+	}
+}
+
+func TestFindWeakCrypto_SelfSignedRootIgnored(t *testing.T) {
+	findings := weakCertificateFindings([]*x509.Certificate{issueCertificateForTest(t, testCATemplate("root", 72), nil).Cert}, 0)
+	if len(findings) != 0 {
+		t.Errorf("Expected no findings for a strong root, got %v", findings)
+	}
+}
+
+func TestVerify_RejectWeakCrypto(t *testing.T) {
+	ca := issueCertificateForTest(t, testCATemplate("weak crypto root", 73), nil)
+	leaf := issueCertificateForTest(t, testLeafTemplate("weak crypto signer", 74, x509.ExtKeyUsageCodeSigning), ca)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+
+	strong := createSignedMockPEAs(t, leaf, crypto.SHA256)
+	if err := Verify(strong, &VerifyOptions{Roots: roots, RejectWeakCrypto: true}); err != nil {
+		t.Errorf("Expected a SHA-256 signature to pass, got: %v", err)
+	}
+
+	sha1 := createSignedMockPEAs(t, leaf, crypto.SHA1)
+	if err := Verify(sha1, &VerifyOptions{Roots: roots}); err != nil {
+		t.Fatalf("Expected SHA-1 to pass without RejectWeakCrypto, got: %v", err)
+	}
+	for _, opts := range []*VerifyOptions{{RejectWeakCrypto: true}, {Roots: roots, RejectWeakCrypto: true}} {
+		err := Verify(sha1, opts)
+		if !errors.Is(err, ErrWeakCrypto) {
+			t.Fatalf("Expected ErrWeakCrypto, got: %v", err)
+		}
+		var weakErr *WeakCryptoError
+		if !errors.As(err, &weakErr) || len(weakErr.Findings) != 1 || weakErr.Findings[0].Kind != WeakFileDigest {
+			t.Errorf("Expected a single file digest finding, got: %v", err)
+		}
+	}
+}
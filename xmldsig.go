@@ -0,0 +1,356 @@
+package sigtool
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// XML-DSig namespace and the algorithm identifiers sigtool handles
+const (
+	xmldsigNamespace = "http://www.w3.org/2000/09/xmldsig#"
+	// xmldsigObjectType is the Type of references to an Object element
+	xmldsigObjectType = "http://www.w3.org/2000/09/xmldsig#Object"
+)
+
+// xmlDigestMethods maps the DigestMethod URIs of XML signatures to hash
+// algorithms
+var xmlDigestMethods = map[string]crypto.Hash{
+	"http://www.w3.org/2000/09/xmldsig#sha1":        crypto.SHA1,
+	"http://www.w3.org/2001/04/xmlenc#sha256":       crypto.SHA256,
+	"http://www.w3.org/2001/04/xmldsig-more#sha384": crypto.SHA384,
+	"http://www.w3.org/2001/04/xmlenc#sha512":       crypto.SHA512,
+}
+
+// xmlSignatureMethod is a SignatureMethod of XML signatures
+type xmlSignatureMethod struct {
+	hash crypto.Hash
+	// ecdsa is set for ECDSA signatures, whose value is r and s as
+	// fixed-size big-endian integers; RSA signatures are PKCS #1 v1.5
+	ecdsa bool
+}
+
+// xmlSignatureMethods maps the SignatureMethod URIs of XML signatures to
+// their algorithms
+var xmlSignatureMethods = map[string]xmlSignatureMethod{
+	"http://www.w3.org/2000/09/xmldsig#rsa-sha1":          {crypto.SHA1, false},
+	"http://www.w3.org/2001/04/xmldsig-more#rsa-sha256":   {crypto.SHA256, false},
+	"http://www.w3.org/2001/04/xmldsig-more#rsa-sha384":   {crypto.SHA384, false},
+	"http://www.w3.org/2001/04/xmldsig-more#rsa-sha512":   {crypto.SHA512, false},
+	"http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256": {crypto.SHA256, true},
+	"http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha384": {crypto.SHA384, true},
+	"http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha512": {crypto.SHA512, true},
+}
+
+// xmlSignature is a parsed XML-DSig Signature element
+type xmlSignature struct {
+	element    *xmlNode
+	signedInfo *xmlNode
+	// canonicalization and inclusivePrefixes canonicalize SignedInfo
+	canonicalization  string
+	inclusivePrefixes []string
+	signatureMethod   string
+	references        []xmlReference
+	value             []byte
+	// certificates are the X509Certificate elements of KeyInfo
+	certificates []*x509.Certificate
+}
+
+// xmlReference is a Reference of SignedInfo or of a Manifest
+type xmlReference struct {
+	uri          string
+	refType      string
+	transforms   []xmlTransform
+	digestMethod string
+	digest       []byte
+}
+
+// xmlTransform is a Transform of a reference
+type xmlTransform struct {
+	algorithm string
+	element   *xmlNode
+}
+
+// isXMLSignature reports whether signature is an XML document rather than
+// DER, which always starts with a SEQUENCE tag
+func isXMLSignature(signature []byte) bool {
+	signature = bytes.TrimPrefix(signature, []byte("\xef\xbb\xbf"))
+	return bytes.HasPrefix(bytes.TrimLeft(signature, " \t\r\n"), []byte("<"))
+}
+
+// parseXMLSignature parses a document whose element is an XML-DSig
+// Signature
+func parseXMLSignature(data []byte) (*xmlSignature, error) {
+	root, err := parseXML(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse XML signature: %w", err)
+	}
+	if !root.is(xmldsigNamespace, "Signature") {
+		return nil, fmt.Errorf("failed to parse XML signature: document element is %s, not Signature", root.name.Local)
+	}
+	sig := &xmlSignature{element: root, signedInfo: root.element(xmldsigNamespace, "SignedInfo")}
+	if sig.signedInfo == nil {
+		return nil, errors.New("failed to parse XML signature: no SignedInfo")
+	}
+	if method := sig.signedInfo.element(xmldsigNamespace, "CanonicalizationMethod"); method != nil {
+		sig.canonicalization = method.attr("Algorithm")
+		sig.inclusivePrefixes = inclusivePrefixes(method)
+	}
+	if method := sig.signedInfo.element(xmldsigNamespace, "SignatureMethod"); method != nil {
+		sig.signatureMethod = method.attr("Algorithm")
+	}
+	if sig.references, err = parseXMLReferences(sig.signedInfo); err != nil {
+		return nil, err
+	}
+	if len(sig.references) == 0 {
+		return nil, errors.New("failed to parse XML signature: SignedInfo has no references")
+	}
+	value := root.element(xmldsigNamespace, "SignatureValue")
+	if value == nil {
+		return nil, errors.New("failed to parse XML signature: no SignatureValue")
+	}
+	if sig.value, err = decodeXMLBase64(value.text()); err != nil {
+		return nil, fmt.Errorf("failed to parse XML signature: bad SignatureValue: %w", err)
+	}
+
+	if keyInfo := root.element(xmldsigNamespace, "KeyInfo"); keyInfo != nil {
+		for _, data := range keyInfo.elements(xmldsigNamespace, "X509Data") {
+			for _, c := range data.elements(xmldsigNamespace, "X509Certificate") {
+				der, err := decodeXMLBase64(c.text())
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse XML signature: bad X509Certificate: %w", err)
+				}
+				cert, err := x509.ParseCertificate(der)
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse XML signature certificate: %w", err)
+				}
+				sig.certificates = append(sig.certificates, cert)
+			}
+		}
+	}
+	return sig, nil
+}
+
+// parseXMLReferences parses the Reference children of n, a SignedInfo or
+// Manifest element
+func parseXMLReferences(n *xmlNode) ([]xmlReference, error) {
+	var references []xmlReference
+	for _, r := range n.elements(xmldsigNamespace, "Reference") {
+		ref := xmlReference{uri: r.attr("URI"), refType: r.attr("Type")}
+		if transforms := r.element(xmldsigNamespace, "Transforms"); transforms != nil {
+			for _, t := range transforms.elements(xmldsigNamespace, "Transform") {
+				ref.transforms = append(ref.transforms, xmlTransform{algorithm: t.attr("Algorithm"), element: t})
+			}
+		}
+		if method := r.element(xmldsigNamespace, "DigestMethod"); method != nil {
+			ref.digestMethod = method.attr("Algorithm")
+		}
+		value := r.element(xmldsigNamespace, "DigestValue")
+		if value == nil {
+			return nil, fmt.Errorf("failed to parse XML signature: reference %q has no DigestValue", ref.uri)
+		}
+		digest, err := decodeXMLBase64(value.text())
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse XML signature: bad DigestValue of reference %q: %w", ref.uri, err)
+		}
+		ref.digest = digest
+		references = append(references, ref)
+	}
+	return references, nil
+}
+
+// inclusivePrefixes returns the PrefixList of the InclusiveNamespaces
+// parameter of an exclusive canonicalization method or transform n
+func inclusivePrefixes(n *xmlNode) []string {
+	// The parameter is in the namespace of the algorithm URI
+	if p := n.element(c14nExclusive, "InclusiveNamespaces"); p != nil {
+		return strings.Fields(p.attr("PrefixList"))
+	}
+	return nil
+}
+
+// decodeXMLBase64 decodes base64 text that may be wrapped with whitespace
+func decodeXMLBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+}
+
+// signer returns the signer certificate: the certificate of KeyInfo that
+// issued none of the others
+func (s *xmlSignature) signer() (*x509.Certificate, error) {
+	for _, cert := range s.certificates {
+		issuer := false
+		for _, other := range s.certificates {
+			if other != cert && bytes.Equal(other.RawIssuer, cert.RawSubject) && !bytes.Equal(other.RawSubject, cert.RawSubject) {
+				issuer = true
+				break
+			}
+		}
+		if !issuer {
+			return cert, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: XML signature has no X509Certificate", ErrSignerCertificateNotFound)
+}
+
+// verify checks the signature value over SignedInfo with the signer key
+// and the digests of the references, which must be to elements of the
+// signature itself
+func (s *xmlSignature) verify() error {
+	signer, err := s.signer()
+	if err != nil {
+		return err
+	}
+	method, ok := xmlSignatureMethods[s.signatureMethod]
+	if !ok {
+		return fmt.Errorf("unsupported XML signature method %q", s.signatureMethod)
+	}
+	canonical, err := canonicalize(s.signedInfo, s.canonicalization, s.inclusivePrefixes)
+	if err != nil {
+		return err
+	}
+	h := method.hash.New()
+	h.Write(canonical)
+	if err := verifyXMLSignatureValue(signer, method, h.Sum(nil), s.value); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+
+	for _, ref := range s.references {
+		if err := s.verifyReference(ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyXMLSignatureValue verifies value, a signature by signer over
+// digest with method
+func verifyXMLSignatureValue(signer *x509.Certificate, method xmlSignatureMethod, digest, value []byte) error {
+	switch key := signer.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if method.ecdsa {
+			return errors.New("ECDSA signature method with an RSA key")
+		}
+		return rsa.VerifyPKCS1v15(key, method.hash, digest, value)
+	case *ecdsa.PublicKey:
+		if !method.ecdsa {
+			return errors.New("RSA signature method with an ECDSA key")
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(value) != 2*size {
+			return fmt.Errorf("ECDSA signature value is %d bytes, want %d", len(value), 2*size)
+		}
+		r := new(big.Int).SetBytes(value[:size])
+		sv := new(big.Int).SetBytes(value[size:])
+		if !ecdsa.Verify(key, digest, r, sv) {
+			return errors.New("ECDSA verification failure")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported signer key type %T", signer.PublicKey)
+}
+
+// verifyReference checks the digest of ref, a reference to the element of
+// the signature whose Id is the URI fragment, canonicalized
+func (s *xmlSignature) verifyReference(ref xmlReference) error {
+	id, ok := strings.CutPrefix(ref.uri, "#")
+	if !ok || id == "" {
+		return fmt.Errorf("unsupported XML signature reference %q", ref.uri)
+	}
+	target := s.element.findByID(id)
+	if target == nil {
+		return fmt.Errorf("%w: referenced element %q is missing", ErrDigestMismatch, ref.uri)
+	}
+	// A same-document reference without transforms is canonicalized
+	// inclusively
+	method, prefixes := c14nInclusive, []string(nil)
+	for _, t := range ref.transforms {
+		switch t.algorithm {
+		case c14nInclusive, c14nInclusiveComments, c14nExclusive, c14nExclusiveComments:
+			method, prefixes = t.algorithm, inclusivePrefixes(t.element)
+		default:
+			return fmt.Errorf("unsupported transform %q of reference %q", t.algorithm, ref.uri)
+		}
+	}
+	canonical, err := canonicalize(target, method, prefixes)
+	if err != nil {
+		return err
+	}
+	return ref.check(canonical)
+}
+
+// check compares the digest of data with the digest of ref
+func (ref xmlReference) check(data []byte) error {
+	algorithm, ok := xmlDigestMethods[ref.digestMethod]
+	if !ok {
+		return fmt.Errorf("unsupported digest method %q of reference %q", ref.digestMethod, ref.uri)
+	}
+	h := algorithm.New()
+	h.Write(data)
+	computed := h.Sum(nil)
+	if subtle.ConstantTimeCompare(ref.digest, computed) != 1 {
+		return &DigestMismatchError{Algorithm: algorithm, Signed: ref.digest, Computed: computed}
+	}
+	return nil
+}
+
+// weakFindings reports the MD5 and SHA-1 digests of the signature method
+// and references and the weak embedded certificates
+func (s *xmlSignature) weakFindings() []WeakCryptoFinding {
+	var findings []WeakCryptoFinding
+	seen := make(map[crypto.Hash]bool)
+	add := func(algorithm crypto.Hash) {
+		if (algorithm == crypto.MD5 || algorithm == crypto.SHA1) && !seen[algorithm] {
+			seen[algorithm] = true
+			findings = append(findings, WeakCryptoFinding{Kind: WeakFileDigest, Detail: algorithm.String()})
+		}
+	}
+	add(xmlSignatureMethods[s.signatureMethod].hash)
+	for _, ref := range s.references {
+		add(xmlDigestMethods[ref.digestMethod])
+	}
+	return append(findings, weakCertificateFindings(s.certificates, 0)...)
+}
+
+// inspectXMLSignature builds a SignatureInfo from an XML signature. The
+// digest is that of the first reference, which in package signatures
+// covers the manifest of signed parts.
+func inspectXMLSignature(signature []byte) (*SignatureInfo, error) {
+	sig, err := parseXMLSignature(signature)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := sig.signer()
+	if err != nil {
+		return nil, err
+	}
+	info := &SignatureInfo{
+		Signer:          newCertificateInfo(signer),
+		DigestAlgorithm: xmlDigestMethods[sig.references[0].digestMethod],
+		Digest:          sig.references[0].digest,
+		SigningTime:     opcSigningTime(sig),
+	}
+	addCertificateInfo(info, sig.certificates)
+	return info, nil
+}
+
+// xmlSignatureCertificates returns the signer certificate and the
+// certificates of the XML signature data
+func xmlSignatureCertificates(data []byte) (*x509.Certificate, []*x509.Certificate, error) {
+	sig, err := parseXMLSignature(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, err := sig.signer()
+	if err != nil {
+		return nil, nil, err
+	}
+	return signer, sig.certificates, nil
+}
@@ -0,0 +1,309 @@
+package sigtool
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ZIP record signatures
+const (
+	zipLocalHeaderMagic   = 0x04034b50
+	zipCentralHeaderMagic = 0x02014b50
+	zipEOCDMagic          = 0x06054b50
+	zip64EOCDMagic        = 0x06064b50
+	zip64LocatorMagic     = 0x07064b50
+)
+
+const (
+	zipCentralHeaderSize = 46
+	zipEOCDSize          = 22
+	zip64EOCDSize        = 56
+	zip64LocatorSize     = 20
+	// zip64ExtraID is the header ID of the Zip64 extended information field
+	zip64ExtraID = 0x0001
+	// maxZipFileSize bounds the archive members read into memory
+	maxZipFileSize = 64 << 20
+)
+
+// zipArchive is a ZIP archive parsed down to the raw records its package
+// signatures cover: the central directory entries in directory order and
+// the end of central directory records
+type zipArchive struct {
+	r    io.ReaderAt
+	size int64
+	// reader reads and decompresses the members
+	reader  *zip.Reader
+	entries []zipEntry
+	// directoryOffset and directorySize locate the central directory
+	directoryOffset int64
+	directorySize   int64
+	// eocd is the end of central directory record with its comment
+	eocd []byte
+	// zip64EOCD and zip64Locator are the Zip64 end of central directory
+	// record and locator, nil for archives without them
+	zip64EOCD    []byte
+	zip64Locator []byte
+}
+
+// zipEntry is a central directory entry
+type zipEntry struct {
+	name string
+	// header is the raw central directory record, with its name, extra
+	// field and comment
+	header []byte
+	// localOffset is the offset of the local file header
+	localOffset int64
+}
+
+// isZipArchive reports whether r starts with a ZIP local file header
+func isZipArchive(r io.ReaderAt, size int64) bool {
+	var magic [4]byte
+	if size < zipEOCDSize+int64(len(magic)) {
+		return false
+	}
+	if _, err := r.ReadAt(magic[:], 0); err != nil {
+		return false
+	}
+	return binary.LittleEndian.Uint32(magic[:]) == zipLocalHeaderMagic
+}
+
+// openZipArchive locates the end of central directory records of the ZIP
+// archive r and parses its central directory
+func openZipArchive(r io.ReaderAt, size int64) (*zipArchive, error) {
+	if !isZipArchive(r, size) {
+		return nil, ErrNotZipArchive
+	}
+	a := &zipArchive{r: r, size: size}
+	if err := a.readEnd(); err != nil {
+		return nil, err
+	}
+
+	directory := make([]byte, a.directorySize)
+	if _, err := r.ReadAt(directory, a.directoryOffset); err != nil {
+		return nil, fmt.Errorf("failed to read central directory: %w", err)
+	}
+	for offset := 0; offset < len(directory); {
+		b := directory[offset:]
+		if len(b) < zipCentralHeaderSize || binary.LittleEndian.Uint32(b) != zipCentralHeaderMagic {
+			return nil, fmt.Errorf("%w: bad central directory entry at offset %d", ErrNotZipArchive, a.directoryOffset+int64(offset))
+		}
+		nameLen := int(binary.LittleEndian.Uint16(b[28:]))
+		extraLen := int(binary.LittleEndian.Uint16(b[30:]))
+		commentLen := int(binary.LittleEndian.Uint16(b[32:]))
+		n := zipCentralHeaderSize + nameLen + extraLen + commentLen
+		if n > len(b) {
+			return nil, fmt.Errorf("%w: truncated central directory entry at offset %d", ErrNotZipArchive, a.directoryOffset+int64(offset))
+		}
+		e := zipEntry{
+			name:        string(b[zipCentralHeaderSize : zipCentralHeaderSize+nameLen]),
+			header:      b[:n],
+			localOffset: int64(binary.LittleEndian.Uint32(b[42:])),
+		}
+		if e.localOffset == 0xffffffff {
+			e.localOffset = zip64LocalOffset(b[:zipCentralHeaderSize], b[zipCentralHeaderSize+nameLen:zipCentralHeaderSize+nameLen+extraLen])
+		}
+		if e.localOffset < 0 || e.localOffset >= a.directoryOffset {
+			return nil, fmt.Errorf("%w: local header of %q is outside the archive data", ErrNotZipArchive, e.name)
+		}
+		a.entries = append(a.entries, e)
+		offset += n
+	}
+
+	reader, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotZipArchive, err)
+	}
+	a.reader = reader
+	return a, nil
+}
+
+// readEnd reads the end of central directory record and, when present, the
+// Zip64 locator and record, and locates the central directory
+func (a *zipArchive) readEnd() error {
+	tail := make([]byte, min(a.size, zipEOCDSize+0xffff))
+	tailOffset := a.size - int64(len(tail))
+	if _, err := a.r.ReadAt(tail, tailOffset); err != nil {
+		return fmt.Errorf("failed to read end of central directory: %w", err)
+	}
+	// The record ends the file, followed only by its comment
+	eocdOffset := int64(-1)
+	for i := len(tail) - zipEOCDSize; i >= 0; i-- {
+		if binary.LittleEndian.Uint32(tail[i:]) == zipEOCDMagic &&
+			i+zipEOCDSize+int(binary.LittleEndian.Uint16(tail[i+20:])) == len(tail) {
+			eocdOffset = tailOffset + int64(i)
+			a.eocd = tail[i:]
+			break
+		}
+	}
+	if eocdOffset < 0 {
+		return fmt.Errorf("%w: no end of central directory record", ErrNotZipArchive)
+	}
+	a.directorySize = int64(binary.LittleEndian.Uint32(a.eocd[12:]))
+	a.directoryOffset = int64(binary.LittleEndian.Uint32(a.eocd[16:]))
+	end := eocdOffset
+
+	if locatorOffset := eocdOffset - zip64LocatorSize; locatorOffset >= 0 {
+		locator := make([]byte, zip64LocatorSize)
+		if _, err := a.r.ReadAt(locator, locatorOffset); err != nil {
+			return fmt.Errorf("failed to read Zip64 locator: %w", err)
+		}
+		if binary.LittleEndian.Uint32(locator) == zip64LocatorMagic {
+			recordOffset := int64(binary.LittleEndian.Uint64(locator[8:]))
+			if recordOffset < 0 || recordOffset+zip64EOCDSize > locatorOffset {
+				return fmt.Errorf("%w: Zip64 end of central directory record is outside the file", ErrNotZipArchive)
+			}
+			record := make([]byte, locatorOffset-recordOffset)
+			if _, err := a.r.ReadAt(record, recordOffset); err != nil {
+				return fmt.Errorf("failed to read Zip64 end of central directory record: %w", err)
+			}
+			if binary.LittleEndian.Uint32(record) != zip64EOCDMagic {
+				return fmt.Errorf("%w: bad Zip64 end of central directory record", ErrNotZipArchive)
+			}
+			n := 12 + binary.LittleEndian.Uint64(record[4:])
+			if n < zip64EOCDSize || n > uint64(len(record)) {
+				return fmt.Errorf("%w: bad Zip64 end of central directory record size", ErrNotZipArchive)
+			}
+			record = record[:n]
+			a.zip64EOCD, a.zip64Locator = record, locator
+			a.directorySize = int64(binary.LittleEndian.Uint64(record[40:]))
+			a.directoryOffset = int64(binary.LittleEndian.Uint64(record[48:]))
+			end = recordOffset
+		}
+	}
+	if a.directoryOffset < 0 || a.directorySize < 0 || a.directorySize > end || a.directoryOffset+a.directorySize != end {
+		return fmt.Errorf("%w: central directory at offset %d of %d bytes does not precede its end record", ErrNotZipArchive, a.directoryOffset, a.directorySize)
+	}
+	return nil
+}
+
+// zip64LocalOffset returns the local header offset from the Zip64 extended
+// information in extra, which lists the 64-bit values of the header fields
+// set to 0xffffffff in order, or -1 when it is missing
+func zip64LocalOffset(header, extra []byte) int64 {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		n := int(binary.LittleEndian.Uint16(extra[2:]))
+		if 4+n > len(extra) {
+			break
+		}
+		if id == zip64ExtraID {
+			field := extra[4 : 4+n]
+			for _, offset := range []int{24, 20} {
+				// Uncompressed, then compressed size
+				if binary.LittleEndian.Uint32(header[offset:]) == 0xffffffff {
+					if len(field) < 8 {
+						return -1
+					}
+					field = field[8:]
+				}
+			}
+			if len(field) < 8 {
+				return -1
+			}
+			return int64(binary.LittleEndian.Uint64(field))
+		}
+		extra = extra[4+n:]
+	}
+	return -1
+}
+
+// entry returns the central directory entry of the member name, or nil
+func (a *zipArchive) entry(name string) *zipEntry {
+	for i := range a.entries {
+		if a.entries[i].name == name {
+			return &a.entries[i]
+		}
+	}
+	return nil
+}
+
+// readFile returns the decompressed contents of the member name, or nil
+// with no error when the archive has no such member
+func (a *zipArchive) readFile(name string) ([]byte, error) {
+	for _, f := range a.reader.File {
+		if f.Name != name {
+			continue
+		}
+		if f.UncompressedSize64 > maxZipFileSize {
+			return nil, fmt.Errorf("%w: %s of %d bytes is too large", ErrNotZipArchive, name, f.UncompressedSize64)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", name, err)
+		}
+		defer rc.Close()
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, rc); err != nil {
+			if errors.Is(err, zip.ErrChecksum) || errors.Is(err, zip.ErrFormat) {
+				return nil, fmt.Errorf("%w: %s: %v", ErrNotZipArchive, name, err)
+			}
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, nil
+}
+
+// writeWithout writes a as it would be without the member name, which must
+// be the last local record: the local records to records, and the central
+// directory and end records, with the entry count, directory size and
+// offset adjusted, to directory. Without such a member, a is written as is.
+func (a *zipArchive) writeWithout(name string, records, directory io.Writer) error {
+	// Removing the last member leaves the other local records and their
+	// offsets in place
+	dataEnd, directorySize, entries := a.directoryOffset, a.directorySize, uint64(len(a.entries))
+	member := a.entry(name)
+	if member != nil {
+		for _, e := range a.entries {
+			if e.localOffset > member.localOffset {
+				return fmt.Errorf("%w: %s is not the last member of the package", ErrNotZipArchive, name)
+			}
+		}
+		dataEnd = member.localOffset
+		directorySize -= int64(len(member.header))
+		entries--
+	}
+
+	if _, err := io.Copy(records, io.NewSectionReader(a.r, 0, dataEnd)); err != nil {
+		return fmt.Errorf("failed to hash package: %w", err)
+	}
+
+	for i := range a.entries {
+		if &a.entries[i] != member {
+			if _, err := directory.Write(a.entries[i].header); err != nil {
+				return err
+			}
+		}
+	}
+	if a.zip64EOCD != nil {
+		record := append([]byte(nil), a.zip64EOCD...)
+		binary.LittleEndian.PutUint64(record[24:], entries)
+		binary.LittleEndian.PutUint64(record[32:], entries)
+		binary.LittleEndian.PutUint64(record[40:], uint64(directorySize))
+		binary.LittleEndian.PutUint64(record[48:], uint64(dataEnd))
+		locator := append([]byte(nil), a.zip64Locator...)
+		binary.LittleEndian.PutUint64(locator[8:], uint64(dataEnd+directorySize))
+		if _, err := directory.Write(append(record, locator...)); err != nil {
+			return err
+		}
+	}
+	// Fields that defer to the Zip64 record are left as they are
+	eocd := append([]byte(nil), a.eocd...)
+	for _, offset := range []int{8, 10} {
+		if binary.LittleEndian.Uint16(eocd[offset:]) != 0xffff {
+			binary.LittleEndian.PutUint16(eocd[offset:], uint16(entries))
+		}
+	}
+	if binary.LittleEndian.Uint32(eocd[12:]) != 0xffffffff {
+		binary.LittleEndian.PutUint32(eocd[12:], uint32(directorySize))
+	}
+	if binary.LittleEndian.Uint32(eocd[16:]) != 0xffffffff {
+		binary.LittleEndian.PutUint32(eocd[16:], uint32(dataEnd))
+	}
+	_, err := directory.Write(eocd)
+	return err
+}